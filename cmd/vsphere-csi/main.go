@@ -79,6 +79,7 @@ func main() {
 		}
 	}()
 
+	vSphereCSIDriver := service.NewDriver()
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGTERM)
 	go func() {
@@ -86,14 +87,14 @@ func main() {
 			sig := <-ch
 			if sig == syscall.SIGTERM {
 				log.Info("SIGTERM signal received")
-				utils.LogoutAllvCenterSessions(ctx)
-				os.Exit(0)
+				vSphereCSIDriver.Shutdown(ctx)
+				return
 			}
 		}
 	}()
 
-	vSphereCSIDriver := service.NewDriver()
 	vSphereCSIDriver.Run(ctx, CSIEndpoint)
+	utils.LogoutAllvCenterSessions(ctx)
 
 }
 
@@ -53,6 +53,9 @@ type Client interface {
 	GetDefaultEncryptionClass(ctx context.Context, namespace string) (*byokv1.EncryptionClass, error)
 	// GetEncryptionClassForPVC retrieves the encryption class associated with a PersistentVolumeClaim (PVC).
 	GetEncryptionClassForPVC(ctx context.Context, name, namespace string) (*byokv1.EncryptionClass, error)
+	// ResolveEncryptionClassNameForPVC returns the name of the encryption class
+	// to use for a PersistentVolumeClaim (PVC).
+	ResolveEncryptionClassNameForPVC(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (string, error)
 }
 
 // NewClient creates and returns a new instance of a crypto Client implementation based on
@@ -277,10 +280,43 @@ func (c *defaultClient) GetEncryptionClassForPVC(
 		return nil, err
 	}
 
-	encClassName := GetEncryptionClassNameForPVC(&pvc)
+	encClassName, err := c.ResolveEncryptionClassNameForPVC(ctx, &pvc)
+	if err != nil {
+		if err == ErrDefaultEncryptionClassNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
 	if encClassName == "" {
 		return nil, nil
 	}
 
 	return c.GetEncryptionClass(ctx, encClassName, namespace)
 }
+
+// ResolveEncryptionClassNameForPVC returns the EncryptionClass specified by
+// the PVC. If the PVC does not specify one and its StorageClass is an
+// encryption storage class, the default EncryptionClass of the namespace is
+// returned, or ErrDefaultEncryptionClassNotFound if the namespace has none.
+// An empty name is returned if the PVC is not encrypted.
+func (c *defaultClient) ResolveEncryptionClassNameForPVC(
+	ctx context.Context,
+	pvc *corev1.PersistentVolumeClaim,
+) (string, error) {
+	if encClassName := GetEncryptionClassNameForPVC(pvc); encClassName != "" {
+		return encClassName, nil
+	}
+	if pvc.Spec.StorageClassName == nil {
+		return "", nil
+	}
+	if ok, _, err := c.IsEncryptedStorageClass(ctx, *pvc.Spec.StorageClassName); err != nil {
+		return "", err
+	} else if !ok {
+		return "", nil
+	}
+	defaultEncClass, err := c.GetDefaultEncryptionClass(ctx, pvc.Namespace)
+	if err != nil {
+		return "", err
+	}
+	return defaultEncClass.Name, nil
+}
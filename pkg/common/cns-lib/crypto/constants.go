@@ -24,6 +24,23 @@ const (
 	// PVCEncryptionClassAnnotationName is a PVC annotation indicating the associated EncryptionClass
 	PVCEncryptionClassAnnotationName = "csi.vsphere.encryption-class"
 
+	// PVCEncryptionMigrationAnnotationName is a PVC annotation requesting, if
+	// set to "true", that the unencrypted volume of a PVC using an encryption
+	// StorageClass be encrypted in place, e.g. for a PVC created before
+	// encryption was enabled. The annotation is removed once the volume is
+	// encrypted.
+	PVCEncryptionMigrationAnnotationName = "csi.vsphere.encryption-migration"
+
+	// PVCEncryptionMigrationStatusAnnotationName is a PVC annotation recording
+	// the status of the encryption migration of its volume.
+	PVCEncryptionMigrationStatusAnnotationName = "csi.vsphere.encryption-migration-status"
+
+	// Statuses of the encryption migration of a volume.
+	EncryptionMigrationStatusWaitingForDetach = "WaitingForDetach"
+	EncryptionMigrationStatusInProgress       = "InProgress"
+	EncryptionMigrationStatusFailed           = "Failed"
+	EncryptionMigrationStatusCompleted        = "Completed"
+
 	// DefaultEncryptionClassLabelName is the name of the label that identifies
 	// the default EncryptionClass in a given namespace.
 	DefaultEncryptionClassLabelName = "encryption.vmware.com/default"
@@ -0,0 +1,66 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"errors"
+	"sync"
+	"syscall"
+)
+
+// VolumeHealthTracker counts the consecutive failed checks of the mount of
+// each volume ID, so that a volume is reported abnormal only if the failure
+// persists, and not on a transient error.
+type VolumeHealthTracker struct {
+	threshold int
+	failures  map[string]int
+	mux       sync.Mutex
+}
+
+// NewVolumeHealthTracker returns a VolumeHealthTracker reporting volumes as
+// abnormal after the given number of consecutive failed checks.
+func NewVolumeHealthTracker(threshold int) *VolumeHealthTracker {
+	return &VolumeHealthTracker{
+		threshold: max(threshold, 1),
+		failures:  make(map[string]int),
+	}
+}
+
+// RecordFailure records a failed check of the mount of volumeID and returns
+// true if the volume is abnormal, i.e. if the threshold of consecutive failed
+// checks is reached.
+func (vt *VolumeHealthTracker) RecordFailure(volumeID string) bool {
+	vt.mux.Lock()
+	defer vt.mux.Unlock()
+	vt.failures[volumeID]++
+	return vt.failures[volumeID] >= vt.threshold
+}
+
+// Reset forgets the failed checks of the mount of volumeID, e.g. after a
+// successful check or once the volume is unpublished.
+func (vt *VolumeHealthTracker) Reset(volumeID string) {
+	vt.mux.Lock()
+	defer vt.mux.Unlock()
+	delete(vt.failures, volumeID)
+}
+
+// IsStaleMountError returns true if err is returned for a mount whose backing
+// storage is not reachable, e.g. when the datastore of the volume becomes
+// inaccessible.
+func IsStaleMountError(err error) bool {
+	return errors.Is(err, syscall.EIO) || errors.Is(err, syscall.ESTALE) || errors.Is(err, syscall.ENOTCONN)
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVolumeHealthTracker(t *testing.T) {
+	vt := NewVolumeHealthTracker(3)
+	assert.False(t, vt.RecordFailure("vol-1"))
+	assert.False(t, vt.RecordFailure("vol-1"))
+	// The failures of another volume are counted separately.
+	assert.False(t, vt.RecordFailure("vol-2"))
+	assert.True(t, vt.RecordFailure("vol-1"))
+	assert.True(t, vt.RecordFailure("vol-1"))
+
+	// A successful check starts counting the failures again.
+	vt.Reset("vol-1")
+	assert.False(t, vt.RecordFailure("vol-1"))
+	assert.False(t, vt.RecordFailure("vol-2"))
+	assert.True(t, vt.RecordFailure("vol-2"))
+}
+
+func TestVolumeHealthTrackerMinimumThreshold(t *testing.T) {
+	// A threshold below 1 reports a volume abnormal on its first failure.
+	vt := NewVolumeHealthTracker(0)
+	assert.True(t, vt.RecordFailure("vol-1"))
+}
+
+func TestIsStaleMountError(t *testing.T) {
+	assert.True(t, IsStaleMountError(syscall.EIO))
+	assert.True(t, IsStaleMountError(syscall.ESTALE))
+	assert.True(t, IsStaleMountError(fmt.Errorf("statfs failed: %w", syscall.ENOTCONN)))
+	assert.False(t, IsStaleMountError(syscall.ENOENT))
+	assert.False(t, IsStaleMountError(errors.New("timeout")))
+	assert.False(t, IsStaleMountError(nil))
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"sync"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+type volumeStatsEntry struct {
+	stats     *csi.NodeGetVolumeStatsResponse
+	timestamp time.Time
+}
+
+// VolumeStatsCache stores the last volume stats computed for each volume ID,
+// so that repeated NodeGetVolumeStats requests within the TTL do not issue
+// a statfs call each time.
+type VolumeStatsCache struct {
+	ttl     time.Duration
+	entries map[string]volumeStatsEntry
+	mux     sync.Mutex
+}
+
+// NewVolumeStatsCache returns a VolumeStatsCache with the given TTL.
+// A TTL of zero disables caching.
+func NewVolumeStatsCache(ttl time.Duration) *VolumeStatsCache {
+	return &VolumeStatsCache{
+		ttl:     ttl,
+		entries: make(map[string]volumeStatsEntry),
+	}
+}
+
+// Get returns the cached stats for volumeID if they are younger than the TTL.
+func (vc *VolumeStatsCache) Get(volumeID string) (*csi.NodeGetVolumeStatsResponse, bool) {
+	vc.mux.Lock()
+	defer vc.mux.Unlock()
+	entry, ok := vc.entries[volumeID]
+	if !ok {
+		return nil, false
+	}
+	if time.Since(entry.timestamp) >= vc.ttl {
+		delete(vc.entries, volumeID)
+		return nil, false
+	}
+	return entry.stats, true
+}
+
+// Set stores the stats computed for volumeID.
+func (vc *VolumeStatsCache) Set(volumeID string, stats *csi.NodeGetVolumeStatsResponse) {
+	if vc.ttl <= 0 {
+		return
+	}
+	vc.mux.Lock()
+	defer vc.mux.Unlock()
+	vc.entries[volumeID] = volumeStatsEntry{
+		stats:     stats,
+		timestamp: time.Now(),
+	}
+}
+
+// Invalidate removes the cached stats for volumeID, so that the next request
+// computes fresh stats.
+func (vc *VolumeStatsCache) Invalidate(volumeID string) {
+	vc.mux.Lock()
+	defer vc.mux.Unlock()
+	delete(vc.entries, volumeID)
+}
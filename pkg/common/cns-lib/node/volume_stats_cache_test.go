@@ -0,0 +1,64 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVolumeStatsCache(t *testing.T) {
+	vc := NewVolumeStatsCache(time.Minute)
+	stats := &csi.NodeGetVolumeStatsResponse{}
+	_, found := vc.Get("vol-1")
+	assert.False(t, found)
+
+	vc.Set("vol-1", stats)
+	cachedStats, found := vc.Get("vol-1")
+	assert.True(t, found)
+	assert.Same(t, stats, cachedStats)
+	// The stats of another volume are cached separately.
+	_, found = vc.Get("vol-2")
+	assert.False(t, found)
+
+	vc.Invalidate("vol-1")
+	_, found = vc.Get("vol-1")
+	assert.False(t, found)
+}
+
+func TestVolumeStatsCacheExpiry(t *testing.T) {
+	vc := NewVolumeStatsCache(10 * time.Millisecond)
+	vc.Set("vol-1", &csi.NodeGetVolumeStatsResponse{})
+	_, found := vc.Get("vol-1")
+	assert.True(t, found)
+
+	time.Sleep(20 * time.Millisecond)
+	_, found = vc.Get("vol-1")
+	assert.False(t, found)
+	// The expired entry is removed.
+	assert.Empty(t, vc.entries)
+}
+
+func TestVolumeStatsCacheDisabled(t *testing.T) {
+	vc := NewVolumeStatsCache(0)
+	vc.Set("vol-1", &csi.NodeGetVolumeStatsResponse{})
+	_, found := vc.Get("vol-1")
+	assert.False(t, found)
+}
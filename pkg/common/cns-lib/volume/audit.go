@@ -0,0 +1,290 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	vim25types "github.com/vmware/govmomi/vim25/types"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+)
+
+// Operations recorded in the audit log.
+const (
+	auditOpCreateVolume         = "CreateVolume"
+	auditOpDeleteVolume         = "DeleteVolume"
+	auditOpAttachVolume         = "AttachVolume"
+	auditOpDetachVolume         = "DetachVolume"
+	auditOpExpandVolume         = "ExpandVolume"
+	auditOpUpdateVolumeMetadata = "UpdateVolumeMetadata"
+	auditOpUpdateVolumeCrypto   = "UpdateVolumeCrypto"
+	auditOpUpdateVolumePolicy   = "UpdateVolumePolicy"
+	auditOpRelocateVolume       = "RelocateVolume"
+	auditOpConfigureVolumeACLs  = "ConfigureVolumeACLs"
+	auditOpCreateSnapshot       = "CreateSnapshot"
+	auditOpDeleteSnapshot       = "DeleteSnapshot"
+	// Operations changing FCDs through the Vslm endpoint.
+	auditOpCreateDisk         = "CreateDisk"
+	auditOpCloneDisk          = "CloneDisk"
+	auditOpDeleteDisk         = "DeleteDisk"
+	auditOpRegisterDisk       = "RegisterDisk"
+	auditOpUpdateDiskMetadata = "UpdateDiskMetadata"
+	// Operations changing the disk of a volume by reconfiguring a VM.
+	auditOpAttachMultiWriterVolume = "AttachMultiWriterVolume"
+	auditOpDetachMultiWriterVolume = "DetachMultiWriterVolume"
+	auditOpSetVolumeIopsLimit      = "SetVolumeIopsLimit"
+)
+
+var (
+	// auditLogger writes the audit log. It is nil while the audit log is disabled.
+	auditLogger *zap.Logger
+	// auditLoggerLock is used to serialize access to auditLogger.
+	auditLoggerLock sync.RWMutex
+)
+
+// SetAuditLogEnabled enables or disables the audit log of the CNS operations
+// changing volumes. Audit records are written to stdout as JSON, one record
+// per line, with the logger name "audit", independent of the log level of
+// the driver.
+func SetAuditLogEnabled(ctx context.Context, enabled bool) {
+	log := logger.GetLogger(ctx)
+	auditLoggerLock.Lock()
+	defer auditLoggerLock.Unlock()
+	if !enabled {
+		auditLogger = nil
+		log.Infof("CNS audit log is disabled")
+		return
+	}
+	if auditLogger != nil {
+		return
+	}
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = "time"
+	encoderConfig.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+	loggerConfig := zap.Config{
+		Level:            zap.NewAtomicLevelAt(zapcore.InfoLevel),
+		Encoding:         "json",
+		EncoderConfig:    encoderConfig,
+		OutputPaths:      []string{"stdout"},
+		ErrorOutputPaths: []string{"stderr"},
+	}
+	auditLog, err := loggerConfig.Build()
+	if err != nil {
+		log.Errorf("failed to create CNS audit logger. Err: %v", err)
+		return
+	}
+	auditLogger = auditLog.Named("audit")
+	log.Infof("CNS audit log is enabled")
+}
+
+func getAuditLogger() *zap.Logger {
+	auditLoggerLock.RLock()
+	defer auditLoggerLock.RUnlock()
+	return auditLogger
+}
+
+// auditRequesterKey is the context key of the Kubernetes object requesting
+// the volume operation.
+type auditRequesterKey struct{}
+
+// auditRequester is the Kubernetes object, e.g. a PVC or a VolumeSnapshot,
+// which requested the volume operation.
+type auditRequester struct {
+	namespace string
+	name      string
+}
+
+// ContextWithAuditRequester returns a child context recording the namespace
+// and name of the Kubernetes object, e.g. the PVC, requesting the volume
+// operation, as received in the CSI request parameters.
+func ContextWithAuditRequester(ctx context.Context, namespace string, name string) context.Context {
+	if namespace == "" && name == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, auditRequesterKey{}, auditRequester{namespace: namespace, name: name})
+}
+
+// auditRecordKey is the context key of the audit record of the volume
+// operation in progress.
+type auditRecordKey struct{}
+
+// auditRecord is the audit log entry of a single CNS operation. It must not
+// hold any key material, hence crypto specs are never recorded.
+type auditRecord struct {
+	mux             sync.Mutex
+	operation       string
+	vCenterHost     string
+	volumeID        string
+	snapshotID      string
+	storagePolicyID string
+	datastores      []string
+	vm              string
+	requesterNS     string
+	requesterName   string
+	taskIDs         []string
+	start           time.Time
+}
+
+// startAudit creates the audit record of the operation and returns a child
+// context carrying it, so that the IDs of the CNS tasks created for the
+// operation are added to the record. Nil is returned for the record if the
+// audit log is disabled.
+func (m *defaultManager) startAudit(ctx context.Context, operation string, volumeID string) (
+	context.Context, *auditRecord) {
+	if getAuditLogger() == nil {
+		return ctx, nil
+	}
+	record := &auditRecord{
+		operation: operation,
+		volumeID:  volumeID,
+		start:     time.Now(),
+	}
+	if m.virtualCenter != nil && m.virtualCenter.Config != nil {
+		record.vCenterHost = m.virtualCenter.Config.Host
+	}
+	if requester, ok := ctx.Value(auditRequesterKey{}).(auditRequester); ok {
+		record.requesterNS = requester.namespace
+		record.requesterName = requester.name
+	}
+	return context.WithValue(ctx, auditRecordKey{}, record), record
+}
+
+// setCreateSpec records the storage policy, datastores and the PVC of the
+// given create spec.
+func (r *auditRecord) setCreateSpec(spec *cnstypes.CnsVolumeCreateSpec) {
+	if r == nil || spec == nil {
+		return
+	}
+	for _, profile := range spec.Profile {
+		if vmProfile, ok := profile.(*vim25types.VirtualMachineDefinedProfileSpec); ok {
+			r.storagePolicyID = vmProfile.ProfileId
+		}
+	}
+	for _, ds := range spec.Datastores {
+		r.datastores = append(r.datastores, ds.Value)
+	}
+	if r.requesterName != "" {
+		return
+	}
+	for _, entity := range spec.Metadata.EntityMetadata {
+		k8sEntity, ok := entity.(*cnstypes.CnsKubernetesEntityMetadata)
+		if ok && k8sEntity.EntityType == string(cnstypes.CnsKubernetesEntityTypePVC) {
+			r.requesterNS = k8sEntity.Namespace
+			r.requesterName = k8sEntity.EntityName
+		}
+	}
+}
+
+// addAuditTaskID adds the CNS task ID to the audit record carried by ctx.
+func addAuditTaskID(ctx context.Context, taskID string) {
+	record, ok := ctx.Value(auditRecordKey{}).(*auditRecord)
+	if !ok || record == nil {
+		return
+	}
+	record.mux.Lock()
+	defer record.mux.Unlock()
+	record.taskIDs = append(record.taskIDs, taskID)
+}
+
+// finish writes the audit record with the result of the operation.
+func (r *auditRecord) finish(err error) {
+	if r == nil {
+		return
+	}
+	auditLog := getAuditLogger()
+	if auditLog == nil {
+		return
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	fields := []zap.Field{
+		zap.String("operation", r.operation),
+		zap.String("vCenter", r.vCenterHost),
+		zap.Duration("duration", time.Since(r.start)),
+	}
+	optionalFields := []struct{ key, value string }{
+		{"volumeID", r.volumeID},
+		{"snapshotID", r.snapshotID},
+		{"storagePolicyID", r.storagePolicyID},
+		{"vm", r.vm},
+		{"requesterNamespace", r.requesterNS},
+		{"requesterName", r.requesterName},
+	}
+	for _, field := range optionalFields {
+		if field.value != "" {
+			fields = append(fields, zap.String(field.key, field.value))
+		}
+	}
+	if len(r.datastores) > 0 {
+		fields = append(fields, zap.Strings("datastores", r.datastores))
+	}
+	if len(r.taskIDs) > 0 {
+		fields = append(fields, zap.Strings("taskIDs", r.taskIDs))
+	}
+	if err != nil {
+		fields = append(fields, zap.String("status", "failure"), zap.String("error", err.Error()))
+	} else {
+		fields = append(fields, zap.String("status", "success"))
+	}
+	auditLog.Info("CNS volume operation", fields...)
+}
+
+// setVolumeID records the ID of the volume, e.g. the one created by the operation.
+func (r *auditRecord) setVolumeID(volumeID string) {
+	if r == nil || volumeID == "" {
+		return
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.volumeID = volumeID
+}
+
+// setSnapshotID records the ID of the snapshot created or deleted by the operation.
+func (r *auditRecord) setSnapshotID(snapshotID string) {
+	if r == nil || snapshotID == "" {
+		return
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.snapshotID = snapshotID
+}
+
+// setVM records the VM a volume is attached to or detached from.
+func (r *auditRecord) setVM(vm string) {
+	if r == nil {
+		return
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.vm = vm
+}
+
+// setStoragePolicyID records the storage policy applied by the operation.
+func (r *auditRecord) setStoragePolicyID(storagePolicyID string) {
+	if r == nil {
+		return
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.storagePolicyID = storagePolicyID
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	vim25types "github.com/vmware/govmomi/vim25/types"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+)
+
+// ErrClusterDistributionRejected is returned for a CreateVolume task which
+// failed because CNS does not accept the cluster distribution of the spec.
+var ErrClusterDistributionRejected = errors.New("cluster distribution rejected by CNS")
+
+// clusterDistributionProperty is the name of the property of the container
+// cluster holding the cluster distribution.
+const clusterDistributionProperty = "clusterDistribution"
+
+// rejectedClusterDistributions holds the cluster distributions which CNS
+// rejected, so that the subsequent CreateVolume calls fall back to the
+// default distribution right away.
+var rejectedClusterDistributions sync.Map
+
+// isClusterDistributionFault returns true if the fault is raised by CNS for
+// an invalid cluster distribution.
+func isClusterDistributionFault(fault *vim25types.LocalizedMethodFault) bool {
+	if fault == nil {
+		return false
+	}
+	invalidArgument, ok := fault.Fault.(*vim25types.InvalidArgument)
+	if !ok {
+		return false
+	}
+	return strings.Contains(strings.ToLower(invalidArgument.InvalidProperty),
+		strings.ToLower(clusterDistributionProperty)) ||
+		strings.Contains(strings.ToLower(fault.LocalizedMessage), strings.ToLower(clusterDistributionProperty))
+}
+
+// getClusterDistribution returns the cluster distribution of the container
+// cluster of the spec.
+func getClusterDistribution(spec *cnstypes.CnsVolumeCreateSpec) string {
+	return spec.Metadata.ContainerCluster.ClusterDistribution
+}
+
+// setClusterDistribution sets the cluster distribution of the container
+// clusters of the spec which have the distribution from.
+func setClusterDistribution(spec *cnstypes.CnsVolumeCreateSpec, from, to string) {
+	if spec.Metadata.ContainerCluster.ClusterDistribution == from {
+		spec.Metadata.ContainerCluster.ClusterDistribution = to
+	}
+	for i := range spec.Metadata.ContainerClusterArray {
+		if spec.Metadata.ContainerClusterArray[i].ClusterDistribution == from {
+			spec.Metadata.ContainerClusterArray[i].ClusterDistribution = to
+		}
+	}
+}
+
+// fallBackFromRejectedClusterDistribution resets the cluster distribution of
+// the spec to the default one, i.e. the distribution assigned by CNS, if CNS
+// has rejected it before. It returns true if the spec was updated.
+func fallBackFromRejectedClusterDistribution(ctx context.Context, spec *cnstypes.CnsVolumeCreateSpec) bool {
+	log := logger.GetLogger(ctx)
+	distribution := getClusterDistribution(spec)
+	if distribution == "" {
+		return false
+	}
+	if _, rejected := rejectedClusterDistributions.Load(distribution); !rejected {
+		return false
+	}
+	log.Debugf("Cluster distribution %q was rejected by CNS, creating volume %q with the default distribution",
+		distribution, spec.Name)
+	setClusterDistribution(spec, distribution, "")
+	return true
+}
+
+// recordRejectedClusterDistribution records the cluster distribution of the
+// spec as rejected by CNS.
+func recordRejectedClusterDistribution(ctx context.Context, spec *cnstypes.CnsVolumeCreateSpec) {
+	log := logger.GetLogger(ctx)
+	distribution := getClusterDistribution(spec)
+	if distribution == "" {
+		return
+	}
+	if _, loaded := rejectedClusterDistributions.LoadOrStore(distribution, struct{}{}); !loaded {
+		log.Warnf("Cluster distribution %q is not accepted by CNS. Volumes are created with the default "+
+			"distribution. Set a distribution accepted by vCenter in the cluster-distribution config.", distribution)
+	}
+}
@@ -194,6 +194,17 @@ func (l *ListViewImpl) IsListViewReady() bool {
 	return l.isReady
 }
 
+// GetPendingTasks returns the tasks in the internal map which are not marked for removal
+func (l *ListViewImpl) GetPendingTasks() []types.ManagedObjectReference {
+	var pendingTasks []types.ManagedObjectReference
+	for _, taskDetails := range l.taskMap.GetAll() {
+		if !taskDetails.MarkedForRemoval {
+			pendingTasks = append(pendingTasks, taskDetails.Reference)
+		}
+	}
+	return pendingTasks
+}
+
 // AddTask adds task to listView and the internal map
 func (l *ListViewImpl) AddTask(ctx context.Context, taskMoRef types.ManagedObjectReference, ch chan TaskResult) error {
 	log := logger.GetLogger(ctx)
@@ -248,9 +259,10 @@ func (l *ListViewImpl) RemoveTask(ctx context.Context, taskMoRef types.ManagedOb
 	// the op context has a timeout of 5 mins.
 	// if CNS doesn't respond within that time, the context deadline is exceeded.
 	// in that case, we need to use the context used my ListViewImpl which is init from controller or syncer main
+	// The same applies if the caller cancelled the operation.
 	deadline, ok := ctx.Deadline()
-	if !ok || time.Now().After(deadline) {
-		log.Infof("op timeout. context deadline exceeded. using listview context without a timeout")
+	if !ok || time.Now().After(deadline) || ctx.Err() != nil {
+		log.Infof("op timeout. context deadline exceeded or cancelled. using listview context without a timeout")
 		ctx = l.ctx
 	}
 
@@ -400,7 +412,20 @@ func (l *ListViewImpl) reportErrorOnAllPendingTasks(err error) {
 			TaskInfo: nil,
 			Err:      err,
 		}
-		taskDetails.ResultCh <- result
+		l.sendTaskResult(taskDetails, result)
+	}
+}
+
+// sendTaskResult delivers the result of the task to its waiter. The result is
+// dropped if the waiter has stopped waiting, e.g. because the deadline of the
+// CSI operation expired, and an earlier result of the task was not consumed,
+// so that the listener never blocks on a task nobody waits for.
+func (l *ListViewImpl) sendTaskResult(taskDetails TaskDetails, result TaskResult) {
+	select {
+	case taskDetails.ResultCh <- result:
+	default:
+		log := logger.GetLogger(l.ctx)
+		log.Infof("dropping result of task %v as its waiter is gone", taskDetails.Reference)
 	}
 }
 
@@ -432,7 +457,7 @@ func (l *ListViewImpl) processTaskUpdate(prop types.PropertyChange) {
 		result.Err = nil
 	}
 
-	taskDetails.ResultCh <- result
+	l.sendTaskResult(taskDetails, result)
 }
 
 // RemoveTasksMarkedForDeletion goes over the list of tasks in the map
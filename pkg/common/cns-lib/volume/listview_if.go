@@ -29,4 +29,7 @@ type ListViewIf interface {
 	// SetListViewNotReady explicitly states the listview state as not ready
 	// use case: unit tests
 	SetListViewNotReady(ctx context.Context)
+	// GetPendingTasks returns the tasks on which CSI operations are waiting for a result
+	// use case: logging the tasks which did not complete before the driver shut down
+	GetPendingTasks() []types.ManagedObjectReference
 }
@@ -20,6 +20,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"strings"
 	"sync"
 	"time"
@@ -28,12 +29,17 @@ import (
 	"github.com/vmware/govmomi/cns"
 	cnstypes "github.com/vmware/govmomi/cns/types"
 	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
 	"github.com/vmware/govmomi/vim25/soap"
 	vim25types "github.com/vmware/govmomi/vim25/types"
 	"github.com/vmware/govmomi/vslm"
+	vslmtypes "github.com/vmware/govmomi/vslm/types"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 
 	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/vsphere"
 	csifault "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/fault"
@@ -73,6 +79,10 @@ const (
 
 	// MbInBytes is the number of bytes in one mebibyte.
 	MbInBytes = int64(1024 * 1024)
+
+	// taskPollJitter is the jitter factor applied to the interval between two
+	// polls of a task, so that concurrent operations do not poll vCenter in lockstep.
+	taskPollJitter = 0.2
 )
 
 // Manager provides functionality to manage volumes.
@@ -129,6 +139,40 @@ type Manager interface {
 	RegisterDisk(ctx context.Context, path string, name string) (string, error)
 	// RetrieveVStorageObject helps in retreiving virtual disk information for a given volume id.
 	RetrieveVStorageObject(ctx context.Context, volumeID string) (*vim25types.VStorageObject, error)
+	// RetrieveVStorageObjectAssociations returns the VMs the given FCD is attached to,
+	// as recorded by the Vslm endpoint.
+	RetrieveVStorageObjectAssociations(ctx context.Context,
+		volumeID string) ([]vslmtypes.VslmVsoVStorageObjectAssociationsVmDiskAssociation, error)
+	// UpdateVStorageObjectMetadata sets the given metadata key-value pairs on the FCD
+	// using Vslm endpoint.
+	UpdateVStorageObjectMetadata(ctx context.Context, volumeID string, metadata []vim25types.KeyValue) error
+	// RetrieveVStorageObjectMetadata returns the metadata key-value pairs of the FCD
+	// whose keys start with the given prefix, using Vslm endpoint.
+	RetrieveVStorageObjectMetadata(ctx context.Context, volumeID string, prefix string) ([]vim25types.KeyValue, error)
+	// CloneVStorageObject creates a full copy of the given FCD using Vslm endpoint and
+	// returns the id of the cloned FCD.
+	CloneVStorageObject(ctx context.Context, volumeID string, spec vim25types.VslmCloneSpec) (string, error)
+	// CreateVStorageObject creates a new FCD using Vslm endpoint and returns the id
+	// of the created FCD.
+	CreateVStorageObject(ctx context.Context, spec vim25types.VslmCreateSpec) (string, error)
+	// DeleteVStorageObject deletes the FCD, which must not be registered with CNS,
+	// using Vslm endpoint.
+	DeleteVStorageObject(ctx context.Context, volumeID string) error
+	// UpdateVStorageObjectPolicy applies the given storage policy to the FCD in place
+	// using Vslm endpoint.
+	UpdateVStorageObjectPolicy(ctx context.Context, volumeID string, storagePolicyID string) error
+	// AttachMultiWriterDisk attaches the FCD backed by the given file to the VM in
+	// multi-writer sharing mode by reconfiguring the VM.
+	AttachMultiWriterDisk(ctx context.Context, vm *cnsvsphere.VirtualMachine, volumeID string, fileName string,
+		datastore *cnsvsphere.Datastore, busNumber int32, unitNumber int32) error
+	// DetachMultiWriterDisk detaches the FCD attached in multi-writer sharing mode
+	// from the VM by reconfiguring the VM. False is returned if it is not attached
+	// to the VM in multi-writer mode.
+	DetachMultiWriterDisk(ctx context.Context, vm *cnsvsphere.VirtualMachine, volumeID string) (bool, error)
+	// SetDiskIOPSLimit sets the IOPS limit of the disk of the FCD attached to the VM
+	// by reconfiguring the VM. False is returned if it is not attached to the VM.
+	SetDiskIOPSLimit(ctx context.Context, vm *cnsvsphere.VirtualMachine, volumeID string,
+		iopsLimit int64) (bool, error)
 	// ProtectVolumeFromVMDeletion sets keepAfterDeleteVm control flag on migrated volume
 	ProtectVolumeFromVMDeletion(ctx context.Context, volumeID string) error
 	// CreateSnapshot helps create a snapshot for a block volume
@@ -208,6 +252,14 @@ type ExpandVolumeExtraParams struct {
 	IsPodVMOnStretchSupervisorFSSEnabled bool
 }
 
+// TaskPollBackoff defines the exponential backoff used while polling
+// a vCenter task for completion.
+type TaskPollBackoff struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+}
+
 var (
 	// managerInstance is a Manager singleton.
 	managerInstance *defaultManager
@@ -225,8 +277,37 @@ var (
 	snapshotTaskMapLock sync.Mutex
 	// Alias for CreateVolumeOperationRequestDetails function declaration.
 	createRequestDetails = cnsvolumeoperationrequest.CreateVolumeOperationRequestDetails
+	// taskPollBackoff is the backoff used while polling vCenter tasks.
+	taskPollBackoff = TaskPollBackoff{
+		InitialInterval: 500 * time.Millisecond,
+		MaxInterval:     10 * time.Second,
+		Multiplier:      2,
+	}
+	// taskPollBackoffLock is used to serialize access to taskPollBackoff.
+	taskPollBackoffLock sync.RWMutex
+	// ErrSnapshotVolumeNotFound is returned by DeleteSnapshot when the volume
+	// of the snapshot to be deleted does not exist on CNS.
+	ErrSnapshotVolumeNotFound = errors.New("volume of the snapshot not found")
 )
 
+// SetTaskPollBackoff sets the backoff used while polling vCenter tasks for
+// completion. Unset fields retain their current values.
+func SetTaskPollBackoff(ctx context.Context, backoff TaskPollBackoff) {
+	log := logger.GetLogger(ctx)
+	taskPollBackoffLock.Lock()
+	defer taskPollBackoffLock.Unlock()
+	if backoff.InitialInterval > 0 {
+		taskPollBackoff.InitialInterval = backoff.InitialInterval
+	}
+	if backoff.MaxInterval > 0 {
+		taskPollBackoff.MaxInterval = backoff.MaxInterval
+	}
+	if backoff.Multiplier >= 1 {
+		taskPollBackoff.Multiplier = backoff.Multiplier
+	}
+	log.Infof("Task poll backoff set to %+v", taskPollBackoff)
+}
+
 // createSnapshotTaskDetails has the same structure as createVolumeTaskDetails
 type createSnapshotTaskDetails struct {
 	createVolumeTaskDetails
@@ -258,6 +339,7 @@ func GetManager(ctx context.Context, vc *cnsvsphere.VirtualCenter,
 			operationStore:             operationStore,
 			idempotencyHandlingEnabled: idempotencyHandlingEnabled,
 			clusterFlavor:              clusterFlavor,
+			queryCache:                 newQueryVolumeCache(),
 		}
 	} else {
 		managerInstance = managerInstanceMap[vc.Config.Host]
@@ -272,6 +354,7 @@ func GetManager(ctx context.Context, vc *cnsvsphere.VirtualCenter,
 			idempotencyHandlingEnabled:     idempotencyHandlingEnabled,
 			multivCenterTopologyDeployment: multivCenterTopologyDeployment,
 			clusterFlavor:                  clusterFlavor,
+			queryCache:                     newQueryVolumeCache(),
 		}
 		managerInstanceMap[vc.Config.Host] = managerInstance
 	}
@@ -282,6 +365,32 @@ func GetManager(ctx context.Context, vc *cnsvsphere.VirtualCenter,
 	return managerInstance, nil
 }
 
+// GetPendingTasks returns the CNS tasks on which the volume managers are
+// waiting for a result, keyed by vCenter server.
+func GetPendingTasks() map[string][]vim25types.ManagedObjectReference {
+	managerInstanceLock.Lock()
+	defer managerInstanceLock.Unlock()
+	managers := make(map[*defaultManager]struct{})
+	if managerInstance != nil {
+		managers[managerInstance] = struct{}{}
+	}
+	for _, manager := range managerInstanceMap {
+		managers[manager] = struct{}{}
+	}
+	pendingTasks := make(map[string][]vim25types.ManagedObjectReference)
+	for manager := range managers {
+		if manager.listViewIf == nil || manager.virtualCenter == nil {
+			continue
+		}
+		tasks := manager.listViewIf.GetPendingTasks()
+		if len(tasks) != 0 {
+			vcHost := manager.virtualCenter.Config.Host
+			pendingTasks[vcHost] = append(pendingTasks[vcHost], tasks...)
+		}
+	}
+	return pendingTasks
+}
+
 // DefaultManager provides functionality to manage volumes.
 type defaultManager struct {
 	virtualCenter                  *cnsvsphere.VirtualCenter
@@ -290,6 +399,8 @@ type defaultManager struct {
 	multivCenterTopologyDeployment bool
 	listViewIf                     ListViewIf
 	clusterFlavor                  cnstypes.CnsClusterFlavor
+	// queryCache caches QueryVolume results for single volumes.
+	queryCache *queryVolumeCache
 }
 
 // ClearTaskInfoObjects is a go routine which runs in the background to clean
@@ -379,6 +490,7 @@ func (m *defaultManager) GetOperationStore() cnsvolumeoperationrequest.VolumeOpe
 func (m *defaultManager) MonitorCreateVolumeTask(ctx context.Context,
 	volumeOperationDetails **cnsvolumeoperationrequest.VolumeOperationRequestDetails, task *object.Task,
 	volNameFromInputSpec, clusterID string) (*CnsVolumeInfo, string, error) {
+	resetCnsTaskError(ctx)
 	var (
 		err                               error
 		faultType                         string
@@ -393,10 +505,12 @@ func (m *defaultManager) MonitorCreateVolumeTask(ctx context.Context,
 	taskInfo, err = m.waitOnTask(ctx, task.Reference())
 
 	if err != nil {
-		if cnsvsphere.IsManagedObjectNotFound(err, task.Reference()) {
-			log.Debugf("CreateVolume task %s not found in vCenter %s. Querying CNS "+
+		// The volume may have been created even if the task is no longer found
+		// in vCenter or is stuck.
+		if cnsvsphere.IsManagedObjectNotFound(err, task.Reference()) || errors.Is(err, ErrCnsTaskStuck) {
+			log.Debugf("CreateVolume task %s not found or stuck in vCenter %s. Querying CNS "+
 				"to determine if the volume %s was successfully created.",
-				m.virtualCenter.Config.Host, task.Reference().Value, volNameFromInputSpec)
+				task.Reference().Value, m.virtualCenter.Config.Host, volNameFromInputSpec)
 			queryFilter := cnstypes.CnsQueryFilter{
 				Names:               []string{volNameFromInputSpec},
 				ContainerClusterIds: []string{clusterID},
@@ -428,6 +542,13 @@ func (m *defaultManager) MonitorCreateVolumeTask(ctx context.Context,
 					},
 				}, "", nil
 			}
+			if errors.Is(err, ErrCnsTaskStuck) && !isStuckTaskCancelled(err) {
+				// The stuck task may still create the volume, so it is kept
+				// pending rather than creating another volume on retry.
+				log.Errorf("volume with name %s not present in CNS. Stuck task %s could not be cancelled, "+
+					"waiting on it again on retry.", volNameFromInputSpec, task.Reference().Value)
+				return nil, ExtractFaultTypeFromErr(ctx, err), err
+			}
 			log.Errorf("volume with name %s not present in CNS. Marking task %s as failed.",
 				volNameFromInputSpec, task.Reference().Value)
 			*volumeOperationDetails = createRequestDetails(volNameFromInputSpec, "", "", 0,
@@ -471,6 +592,7 @@ func (m *defaultManager) MonitorCreateVolumeTask(ctx context.Context,
 		faultType = ExtractFaultTypeFromVolumeResponseResult(ctx, volumeOperationRes)
 		resp, err := validateCreateVolumeResponseFault(ctx, volNameFromInputSpec, volumeOperationRes)
 		if err != nil {
+			err = newCnsTaskError(ctx, err, taskInfo, "", faultType)
 			*volumeOperationDetails = createRequestDetails(volNameFromInputSpec, "", "", 0,
 				(*volumeOperationDetails).QuotaDetails, (*volumeOperationDetails).OperationDetails.TaskInvocationTimestamp,
 				task.Reference().Value, vCenterServerForVolumeOperationCR, taskInfo.ActivationId,
@@ -654,8 +776,13 @@ func (m *defaultManager) createVolumeWithImprovedIdempotency(ctx context.Context
 		}
 	}
 
-	return m.MonitorCreateVolumeTask(ctx, &volumeOperationDetails, task, volNameFromInputSpec,
+	taskStart := time.Now()
+	resp, faultType, finalErr = m.MonitorCreateVolumeTask(ctx, &volumeOperationDetails, task, volNameFromInputSpec,
 		spec.Metadata.ContainerClusterArray[0].ClusterId)
+	datastore, storagePolicy := getCnsTaskLabelsFromCreateSpec(spec)
+	observeCnsTaskLatency(prometheus.PrometheusCnsCreateVolumeOpType, datastore, storagePolicy,
+		time.Since(taskStart), finalErr)
+	return resp, faultType, finalErr
 }
 
 // IsTaskPending returns true in two cases -
@@ -682,7 +809,11 @@ func (m *defaultManager) waitOnTask(csiOpContext context.Context,
 			return nil, err
 		}
 	}
-	ch := make(chan TaskResult)
+	addAuditTaskID(csiOpContext, taskMoRef.Value)
+	addCnsTaskID(csiOpContext, taskMoRef.Value)
+	// The channel is buffered so that the result of the task can be delivered
+	// even if the caller has stopped waiting for it.
+	ch := make(chan TaskResult, 1)
 	err := m.listViewIf.AddTask(csiOpContext, taskMoRef, ch)
 	if errors.Unwrap(err) == ErrListViewTaskAddition {
 		return nil, logger.LogNewErrorf(log, "%s. err: %v", listviewAdditionError, err)
@@ -704,19 +835,26 @@ func (m *defaultManager) waitOnTask(csiOpContext context.Context,
 			}
 		}
 	}()
-	return waitForResultOrTimeout(csiOpContext, taskMoRef, ch)
+	start := time.Now()
+	taskInfo, err := m.waitForResultOrStuck(csiOpContext, taskMoRef, ch)
+	logSlowCnsTask(csiOpContext, taskMoRef, taskInfo, time.Since(start))
+	return taskInfo, err
 }
 
 // waitForResultOrTimeout uses the context provided by the sidecars when CSI driver operations are called.
 // This context has a timeout associated with it (see manifests for more details).
 // Once this caller timeout is over, we want to return an error back to the caller
+// The task itself is not cancelled: it keeps running in vCenter and its result
+// is picked up by the retry of the operation. The returned error wraps the
+// error of the context, i.e. context.DeadlineExceeded or context.Canceled.
 func waitForResultOrTimeout(csiOpContext context.Context, taskMoRef vim25types.ManagedObjectReference,
 	ch chan TaskResult) (*vim25types.TaskInfo, error) {
 	var taskInfo *vim25types.TaskInfo
 	var err error
 	select {
 	case <-csiOpContext.Done():
-		err = fmt.Errorf("time out for task %v before response from CNS", taskMoRef)
+		err = fmt.Errorf("stopped waiting for task %v before response from CNS: %w", taskMoRef,
+			csiOpContext.Err())
 		taskInfo = nil
 	case result := <-ch:
 		err = result.Err
@@ -725,6 +863,88 @@ func waitForResultOrTimeout(csiOpContext context.Context, taskMoRef vim25types.M
 	return taskInfo, err
 }
 
+// newTaskPollBackoff returns the backoff to be used while polling a task. The
+// interval between polls grows exponentially with jitter as per
+// taskPollBackoff, starting afresh for every task.
+func newTaskPollBackoff() wait.Backoff {
+	taskPollBackoffLock.RLock()
+	defer taskPollBackoffLock.RUnlock()
+	return wait.Backoff{
+		Duration: taskPollBackoff.InitialInterval,
+		Factor:   taskPollBackoff.Multiplier,
+		Jitter:   taskPollJitter,
+		Steps:    math.MaxInt32,
+		Cap:      taskPollBackoff.MaxInterval,
+	}
+}
+
+// waitForNextTaskPoll waits for the next poll of the given task as per the
+// backoff. It returns an error if the context is done before.
+func waitForNextTaskPoll(ctx context.Context, backoff *wait.Backoff,
+	taskMoRef vim25types.ManagedObjectReference) error {
+	timer := time.NewTimer(backoff.Step())
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("time out for task %v before completion. err: %w", taskMoRef, ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
+
+// waitOnVslmTask polls the given vslm task until it completes and returns its
+// result, as per the task poll backoff. Polling stops when the context is done.
+func waitOnVslmTask(ctx context.Context, task *vslm.Task) (vim25types.AnyType, error) {
+	addAuditTaskID(ctx, task.ManagedObjectReference.Value)
+	backoff := newTaskPollBackoff()
+	for {
+		info, err := task.QueryInfo(ctx)
+		if err != nil {
+			return nil, err
+		}
+		switch info.State {
+		case vslmtypes.VslmTaskInfoStateSuccess:
+			return task.QueryResult(ctx)
+		case vslmtypes.VslmTaskInfoStateError:
+			if info.Error == nil {
+				return nil, fmt.Errorf("task %v failed", task.ManagedObjectReference)
+			}
+			return nil, soap.WrapVimFault(info.Error.Fault)
+		}
+		if err = waitForNextTaskPoll(ctx, &backoff, task.ManagedObjectReference); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// waitOnVimTask polls the given vCenter task until it completes and returns
+// its info, as per the task poll backoff. Polling stops when the context is
+// done.
+func (m *defaultManager) waitOnVimTask(ctx context.Context,
+	taskMoRef vim25types.ManagedObjectReference) (*vim25types.TaskInfo, error) {
+	backoff := newTaskPollBackoff()
+	for {
+		var task mo.Task
+		err := property.DefaultCollector(m.virtualCenter.Client.Client).RetrieveOne(ctx, taskMoRef,
+			[]string{"info"}, &task)
+		if err != nil {
+			return nil, err
+		}
+		switch task.Info.State {
+		case vim25types.TaskInfoStateSuccess:
+			return &task.Info, nil
+		case vim25types.TaskInfoStateError:
+			if task.Info.Error == nil {
+				return nil, fmt.Errorf("task %v failed", taskMoRef)
+			}
+			return nil, soap.WrapVimFault(task.Info.Error.Fault)
+		}
+		if err = waitForNextTaskPoll(ctx, &backoff, taskMoRef); err != nil {
+			return nil, err
+		}
+	}
+}
+
 func (m *defaultManager) initListView(ctx context.Context) error {
 	log := logger.GetLogger(ctx)
 	var err error
@@ -738,18 +958,16 @@ func (m *defaultManager) initListView(ctx context.Context) error {
 // createVolume invokes CNS CreateVolume. It stores task information in an
 // in-memory map to handle idempotency of CreateVolume calls for the same
 // volume.
-func (m *defaultManager) createVolume(ctx context.Context, spec *cnstypes.CnsVolumeCreateSpec) (*CnsVolumeInfo,
-	string, error) {
+func (m *defaultManager) createVolume(ctx context.Context, spec *cnstypes.CnsVolumeCreateSpec) (
+	volumeInfo *CnsVolumeInfo, faultType string, err error) {
 	log := logger.GetLogger(ctx)
 	var (
 		// Reference to the CreateVolume task on CNS.
 		task *object.Task
-		err  error
 		// Store the volume name passed in by input spec, this
 		// name may exceed 80 characters.
 		volNameFromInputSpec = spec.Name
 	)
-	var faultType string
 	task = getPendingCreateVolumeTaskFromMap(ctx, volNameFromInputSpec)
 	if task == nil {
 		task, err = invokeCNSCreateVolume(ctx, m.virtualCenter, spec)
@@ -776,7 +994,14 @@ func (m *defaultManager) createVolume(ctx context.Context, spec *cnstypes.CnsVol
 	}
 
 	var taskInfo *vim25types.TaskInfo
+	taskStart := time.Now()
 	taskInfo, err = m.waitOnTask(ctx, task.Reference())
+	taskLatency := time.Since(taskStart)
+	defer func() {
+		datastore, storagePolicy := getCnsTaskLabelsFromCreateSpec(spec)
+		observeCnsTaskLatency(prometheus.PrometheusCnsCreateVolumeOpType, datastore, storagePolicy, taskLatency,
+			err)
+	}()
 
 	if err != nil || taskInfo == nil {
 		log.Errorf("failed to get taskInfo for CreateVolume task with err: %v", err)
@@ -785,6 +1010,19 @@ func (m *defaultManager) createVolume(ctx context.Context, spec *cnstypes.CnsVol
 		} else {
 			faultType = csifault.CSITaskInfoEmptyFault
 		}
+		// A stuck task which has been cancelled will not create the volume, so
+		// the subsequent create volume call has to invoke Create Volume again.
+		// A stuck task which could not be cancelled is waited on again instead,
+		// so that no duplicate volume is created.
+		if isStuckTaskCancelled(err) {
+			func() {
+				volumeTaskMapLock.Lock()
+				defer volumeTaskMapLock.Unlock()
+				log.Debugf("Deleted task for %s from volumeTaskMap because the task was stuck",
+					volNameFromInputSpec)
+				delete(volumeTaskMap, volNameFromInputSpec)
+			}()
+		}
 		return nil, faultType, err
 	}
 
@@ -807,6 +1045,7 @@ func (m *defaultManager) createVolume(ctx context.Context, spec *cnstypes.CnsVol
 		// Validate if the volume is already registered.
 		resp, err := validateCreateVolumeResponseFault(ctx, volNameFromInputSpec, volumeOperationRes)
 		if err != nil {
+			err = newCnsTaskError(ctx, err, taskInfo, "", faultType)
 			// Remove the taskInfo object associated with the volume name when the
 			// current task fails. This is needed to ensure the sub-sequent create
 			// volume call from the external provisioner invokes Create Volume.
@@ -836,6 +1075,9 @@ func (m *defaultManager) CreateVolume(ctx context.Context, spec *cnstypes.CnsVol
 	extraParams interface{}) (*CnsVolumeInfo, string, error) {
 	ctx, cancelFunc := ensureOperationContextHasATimeout(ctx)
 	defer cancelFunc()
+	resetCnsTaskError(ctx)
+	ctx, audit := m.startAudit(ctx, auditOpCreateVolume, "")
+	audit.setCreateSpec(spec)
 	internalCreateVolume := func() (*CnsVolumeInfo, string, error) {
 		log := logger.GetLogger(ctx)
 		var faultType string
@@ -858,7 +1100,22 @@ func (m *defaultManager) CreateVolume(ctx context.Context, spec *cnstypes.CnsVol
 		return m.createVolume(ctx, spec)
 	}
 	start := time.Now()
+	// The name in the spec may be truncated when CNS CreateVolume is invoked.
+	volNameFromInputSpec := spec.Name
+	fallBackFromRejectedClusterDistribution(ctx, spec)
 	resp, faultType, err := internalCreateVolume()
+	if errors.Is(err, ErrClusterDistributionRejected) {
+		// Retry with the default cluster distribution.
+		recordRejectedClusterDistribution(ctx, spec)
+		spec.Name = volNameFromInputSpec
+		if fallBackFromRejectedClusterDistribution(ctx, spec) {
+			resp, faultType, err = internalCreateVolume()
+		}
+	}
+	if resp != nil {
+		audit.setVolumeID(resp.VolumeID.Id)
+	}
+	audit.finish(err)
 	log := logger.GetLogger(ctx)
 	log.Debugf("internalCreateVolume: returns fault %q", faultType)
 	if err != nil {
@@ -889,10 +1146,13 @@ func (m *defaultManager) AttachVolume(ctx context.Context,
 	vm *cnsvsphere.VirtualMachine, volumeID string, checkNVMeController bool) (string, string, error) {
 	ctx, cancelFunc := ensureOperationContextHasATimeout(ctx)
 	defer cancelFunc()
-	internalAttachVolume := func() (string, string, error) {
+	resetCnsTaskError(ctx)
+	defer m.queryCache.invalidate(volumeID)
+	ctx, audit := m.startAudit(ctx, auditOpAttachVolume, volumeID)
+	audit.setVM(vm.String())
+	internalAttachVolume := func() (diskUUID string, faultType string, err error) {
 		log := logger.GetLogger(ctx)
-		var faultType string
-		err := validateManager(ctx, m)
+		err = validateManager(ctx, m)
 		if err != nil {
 			faultType = ExtractFaultTypeFromErr(ctx, err)
 			return "", faultType, err
@@ -923,7 +1183,12 @@ func (m *defaultManager) AttachVolume(ctx context.Context,
 		// Get the taskInfo.
 
 		var taskInfo *vim25types.TaskInfo
+		taskStart := time.Now()
 		taskInfo, err = m.waitOnTask(ctx, task.Reference())
+		taskLatency := time.Since(taskStart)
+		defer func() {
+			observeCnsTaskLatency(prometheus.PrometheusCnsAttachVolumeOpType, "", "", taskLatency, err)
+		}()
 
 		if err != nil || taskInfo == nil {
 			log.Errorf("failed to get taskInfo for AttachVolume task from vCenter %q with err: %v",
@@ -966,16 +1231,19 @@ func (m *defaultManager) AttachVolume(ctx context.Context,
 					return diskUUID, "", nil
 				}
 			}
-			return "", faultType, logger.LogNewErrorf(log, "failed to attach cns volume: %q to node vm: %q. fault: %q. opId: %q",
-				volumeID, vm.String(), spew.Sdump(volumeOperationRes.Fault), taskInfo.ActivationId)
+			return "", faultType, newCnsTaskError(ctx, logger.LogNewErrorf(log,
+				"failed to attach cns volume: %q to node vm: %q. fault: %q. opId: %q",
+				volumeID, vm.String(), spew.Sdump(volumeOperationRes.Fault), taskInfo.ActivationId),
+				taskInfo, volumeID, faultType)
 		}
-		diskUUID := interface{}(taskResult).(*cnstypes.CnsVolumeAttachResult).DiskUUID
+		diskUUID = interface{}(taskResult).(*cnstypes.CnsVolumeAttachResult).DiskUUID
 		log.Infof("AttachVolume: Volume attached successfully. volumeID: %q, opId: %q, vm: %q, diskUUID: %q",
 			volumeID, taskInfo.ActivationId, vm.String(), diskUUID)
 		return diskUUID, "", nil
 	}
 	start := time.Now()
 	resp, faultType, err := internalAttachVolume()
+	audit.finish(err)
 	log := logger.GetLogger(ctx)
 	log.Debugf("internalAttachVolume: returns fault %q for volume %q", faultType, volumeID)
 	if err != nil {
@@ -993,10 +1261,13 @@ func (m *defaultManager) DetachVolume(ctx context.Context, vm *cnsvsphere.Virtua
 	error) {
 	ctx, cancelFunc := ensureOperationContextHasATimeout(ctx)
 	defer cancelFunc()
-	internalDetachVolume := func() (string, error) {
+	resetCnsTaskError(ctx)
+	defer m.queryCache.invalidate(volumeID)
+	ctx, audit := m.startAudit(ctx, auditOpDetachVolume, volumeID)
+	audit.setVM(vm.String())
+	internalDetachVolume := func() (faultType string, err error) {
 		log := logger.GetLogger(ctx)
-		var faultType string
-		err := validateManager(ctx, m)
+		err = validateManager(ctx, m)
 		if err != nil {
 			faultType = ExtractFaultTypeFromErr(ctx, err)
 			return faultType, err
@@ -1048,7 +1319,12 @@ func (m *defaultManager) DetachVolume(ctx context.Context, vm *cnsvsphere.Virtua
 		}
 		// Get the taskInfo.
 		var taskInfo *vim25types.TaskInfo
+		taskStart := time.Now()
 		taskInfo, err = m.waitOnTask(ctx, task.Reference())
+		taskLatency := time.Since(taskStart)
+		defer func() {
+			observeCnsTaskLatency(prometheus.PrometheusCnsDetachVolumeOpType, "", "", taskLatency, err)
+		}()
 
 		if err != nil || taskInfo == nil {
 			log.Errorf("failed to get taskInfo for DetachVolume task from vCenter %q with err: %v",
@@ -1107,8 +1383,10 @@ func (m *defaultManager) DetachVolume(ctx context.Context, vm *cnsvsphere.Virtua
 					}
 				}
 			}
-			return faultType, logger.LogNewErrorf(log, "failed to detach cns volume: %q from node vm: %+v. fault: %+v, opId: %q",
-				volumeID, vm, spew.Sdump(volumeOperationRes.Fault), taskInfo.ActivationId)
+			return faultType, newCnsTaskError(ctx, logger.LogNewErrorf(log,
+				"failed to detach cns volume: %q from node vm: %+v. fault: %+v, opId: %q",
+				volumeID, vm, spew.Sdump(volumeOperationRes.Fault), taskInfo.ActivationId),
+				taskInfo, volumeID, faultType)
 		}
 		log.Infof("DetachVolume: Volume detached successfully. volumeID: %q, vm: %q, opId: %q",
 			volumeID, vm.String(), taskInfo.ActivationId)
@@ -1116,6 +1394,7 @@ func (m *defaultManager) DetachVolume(ctx context.Context, vm *cnsvsphere.Virtua
 	}
 	start := time.Now()
 	faultType, err := internalDetachVolume()
+	audit.finish(err)
 	log := logger.GetLogger(ctx)
 	log.Debugf("internalDetachVolume: returns fault %q for volume %q", faultType, volumeID)
 	if err != nil {
@@ -1132,6 +1411,9 @@ func (m *defaultManager) DetachVolume(ctx context.Context, vm *cnsvsphere.Virtua
 func (m *defaultManager) DeleteVolume(ctx context.Context, volumeID string, deleteDisk bool) (string, error) {
 	ctx, cancelFunc := ensureOperationContextHasATimeout(ctx)
 	defer cancelFunc()
+	resetCnsTaskError(ctx)
+	defer m.queryCache.invalidate(volumeID)
+	ctx, audit := m.startAudit(ctx, auditOpDeleteVolume, volumeID)
 	internalDeleteVolume := func() (string, error) {
 		log := logger.GetLogger(ctx)
 		var faultType string
@@ -1155,6 +1437,7 @@ func (m *defaultManager) DeleteVolume(ctx context.Context, volumeID string, dele
 	}
 	start := time.Now()
 	faultType, err := internalDeleteVolume()
+	audit.finish(err)
 	log := logger.GetLogger(ctx)
 	log.Debugf("internalDeleteVolume: returns fault %q for volume %q", faultType, volumeID)
 	if err != nil {
@@ -1169,7 +1452,8 @@ func (m *defaultManager) DeleteVolume(ctx context.Context, volumeID string, dele
 
 // deleteVolume attempts to delete the volume on CNS. CNS task information
 // is not persisted.
-func (m *defaultManager) deleteVolume(ctx context.Context, volumeID string, deleteDisk bool) (string, error) {
+func (m *defaultManager) deleteVolume(ctx context.Context, volumeID string, deleteDisk bool) (
+	faultType string, err error) {
 	log := logger.GetLogger(ctx)
 	// Construct the CNS VolumeId list.
 	var cnsVolumeIDList []cnstypes.CnsVolumeId
@@ -1179,7 +1463,6 @@ func (m *defaultManager) deleteVolume(ctx context.Context, volumeID string, dele
 	// Call the CNS DeleteVolume.
 	cnsVolumeIDList = append(cnsVolumeIDList, cnsVolumeID)
 	task, err := m.virtualCenter.CnsClient.DeleteVolume(ctx, cnsVolumeIDList, deleteDisk)
-	var faultType string
 	if err != nil {
 		faultType = ExtractFaultTypeFromErr(ctx, err)
 		if cnsvsphere.IsNotFoundError(err) {
@@ -1191,7 +1474,12 @@ func (m *defaultManager) deleteVolume(ctx context.Context, volumeID string, dele
 	}
 	// Get the taskInfo.
 	var taskInfo *vim25types.TaskInfo
+	taskStart := time.Now()
 	taskInfo, err = m.waitOnTask(ctx, task.Reference())
+	taskLatency := time.Since(taskStart)
+	defer func() {
+		observeCnsTaskLatency(prometheus.PrometheusCnsDeleteVolumeOpType, "", "", taskLatency, err)
+	}()
 
 	if err != nil || taskInfo == nil {
 		log.Errorf("failed to get DeleteVolume taskInfo from vCenter %q with err: %v",
@@ -1225,8 +1513,10 @@ func (m *defaultManager) deleteVolume(ctx context.Context, volumeID string, dele
 			log.Infof("DeleteVolume: VolumeID %q, not found, thus returning success", volumeID)
 			return "", nil
 		}
-		return faultType, logger.LogNewErrorf(log, "failed to delete volume: %q, fault: %q, opID: %q",
-			volumeID, spew.Sdump(volumeOperationRes.Fault), taskInfo.ActivationId)
+		return faultType, newCnsTaskError(ctx, logger.LogNewErrorf(log,
+			"failed to delete volume: %q, fault: %q, opID: %q",
+			volumeID, spew.Sdump(volumeOperationRes.Fault), taskInfo.ActivationId),
+			taskInfo, volumeID, faultType)
 	}
 	log.Infof("DeleteVolume: Volume deleted successfully. volumeID: %q, opId: %q",
 		volumeID, taskInfo.ActivationId)
@@ -1237,7 +1527,7 @@ func (m *defaultManager) deleteVolume(ctx context.Context, volumeID string, dele
 // CNS task information is persisted by leveraging the VolumeOperationRequest
 // interface.
 func (m *defaultManager) deleteVolumeWithImprovedIdempotency(ctx context.Context,
-	volumeID string, deleteDisk bool) (string, error) {
+	volumeID string, deleteDisk bool) (faultType string, err error) {
 	log := logger.GetLogger(ctx)
 	var (
 		// Reference to the DeleteVolume task on CNS.
@@ -1248,7 +1538,6 @@ func (m *defaultManager) deleteVolumeWithImprovedIdempotency(ctx context.Context
 		// be persisted.
 		volumeOperationDetails *cnsvolumeoperationrequest.VolumeOperationRequestDetails
 	)
-	var faultType string
 	if m.operationStore == nil {
 		return csifault.CSIInternalFault, logger.LogNewError(log, "operation store cannot be nil")
 	}
@@ -1258,7 +1547,7 @@ func (m *defaultManager) deleteVolumeWithImprovedIdempotency(ctx context.Context
 	}
 
 	// Determine if CNS needs to be invoked.
-	volumeOperationDetails, err := m.operationStore.GetRequestDetails(ctx, instanceName)
+	volumeOperationDetails, err = m.operationStore.GetRequestDetails(ctx, instanceName)
 	switch {
 	case err == nil:
 		if volumeOperationDetails.OperationDetails != nil {
@@ -1340,7 +1629,12 @@ func (m *defaultManager) deleteVolumeWithImprovedIdempotency(ctx context.Context
 
 	// Get the taskInfo.
 	var taskInfo *vim25types.TaskInfo
+	taskStart := time.Now()
 	taskInfo, err = m.waitOnTask(ctx, task.Reference())
+	taskLatency := time.Since(taskStart)
+	defer func() {
+		observeCnsTaskLatency(prometheus.PrometheusCnsDeleteVolumeOpType, "", "", taskLatency, err)
+	}()
 
 	if err != nil || taskInfo == nil {
 		log.Errorf("failed to get taskInfo for DeleteVolume task from vCenter %q with err: %v",
@@ -1391,7 +1685,7 @@ func (m *defaultManager) deleteVolumeWithImprovedIdempotency(ctx context.Context
 		volumeOperationDetails = createRequestDetails(instanceName, "", "", 0,
 			nil, volumeOperationDetails.OperationDetails.TaskInvocationTimestamp,
 			task.Reference().Value, "", taskInfo.ActivationId, taskInvocationStatusError, msg)
-		return faultType, logger.LogNewError(log, msg)
+		return faultType, newCnsTaskError(ctx, logger.LogNewError(log, msg), taskInfo, volumeID, faultType)
 	}
 	log.Infof("DeleteVolume: Volume deleted successfully. volumeID: %q, opId: %q",
 		volumeID, taskInfo.ActivationId)
@@ -1405,6 +1699,9 @@ func (m *defaultManager) deleteVolumeWithImprovedIdempotency(ctx context.Context
 func (m *defaultManager) UpdateVolumeMetadata(ctx context.Context, spec *cnstypes.CnsVolumeMetadataUpdateSpec) error {
 	ctx, cancelFunc := ensureOperationContextHasATimeout(ctx)
 	defer cancelFunc()
+	resetCnsTaskError(ctx)
+	defer m.queryCache.invalidate(spec.VolumeId.Id)
+	ctx, audit := m.startAudit(ctx, auditOpUpdateVolumeMetadata, spec.VolumeId.Id)
 	internalUpdateVolumeMetadata := func() error {
 		log := logger.GetLogger(ctx)
 		err := validateManager(ctx, m)
@@ -1470,8 +1767,10 @@ func (m *defaultManager) UpdateVolumeMetadata(ctx context.Context, spec *cnstype
 		}
 		volumeOperationRes := taskResult.GetCnsVolumeOperationResult()
 		if volumeOperationRes.Fault != nil {
-			return logger.LogNewErrorf(log, "failed to update volume. updateSpec: %q, fault: %q, opID: %q",
-				spew.Sdump(spec), spew.Sdump(volumeOperationRes.Fault), taskInfo.ActivationId)
+			return newCnsTaskError(ctx, logger.LogNewErrorf(log,
+				"failed to update volume. updateSpec: %q, fault: %q, opID: %q",
+				spew.Sdump(spec), spew.Sdump(volumeOperationRes.Fault), taskInfo.ActivationId),
+				taskInfo, spec.VolumeId.Id, ExtractFaultTypeFromVolumeResponseResult(ctx, volumeOperationRes))
 		}
 		log.Infof("UpdateVolumeMetadata: Volume metadata updated successfully. volumeID: %q, opId: %q",
 			spec.VolumeId.Id, taskInfo.ActivationId)
@@ -1479,6 +1778,7 @@ func (m *defaultManager) UpdateVolumeMetadata(ctx context.Context, spec *cnstype
 	}
 	start := time.Now()
 	err := internalUpdateVolumeMetadata()
+	audit.finish(err)
 	if err != nil {
 		prometheus.CnsControlOpsHistVec.WithLabelValues(prometheus.PrometheusCnsUpdateVolumeMetadataOpType,
 			prometheus.PrometheusFailStatus).Observe(time.Since(start).Seconds())
@@ -1493,6 +1793,10 @@ func (m *defaultManager) UpdateVolumeMetadata(ctx context.Context, spec *cnstype
 func (m *defaultManager) UpdateVolumeCrypto(ctx context.Context, spec *cnstypes.CnsVolumeCryptoUpdateSpec) error {
 	ctx, cancelFunc := ensureOperationContextHasATimeout(ctx)
 	defer cancelFunc()
+	resetCnsTaskError(ctx)
+	defer m.queryCache.invalidate(spec.VolumeId.Id)
+	// Only the volume is recorded, the crypto spec holds key details.
+	ctx, audit := m.startAudit(ctx, auditOpUpdateVolumeCrypto, spec.VolumeId.Id)
 	internalUpdateVolumeCrypto := func() error {
 		log := logger.GetLogger(ctx)
 		err := validateManager(ctx, m)
@@ -1535,8 +1839,10 @@ func (m *defaultManager) UpdateVolumeCrypto(ctx context.Context, spec *cnstypes.
 		}
 		volumeOperationRes := taskResult.GetCnsVolumeOperationResult()
 		if volumeOperationRes.Fault != nil {
-			return logger.LogNewErrorf(log, "failed to update volume. updateSpec: %q, fault: %q, opID: %q",
-				spew.Sdump(spec), spew.Sdump(volumeOperationRes.Fault), taskInfo.ActivationId)
+			return newCnsTaskError(ctx, logger.LogNewErrorf(log,
+				"failed to update volume. updateSpec: %q, fault: %q, opID: %q",
+				spew.Sdump(spec), spew.Sdump(volumeOperationRes.Fault), taskInfo.ActivationId),
+				taskInfo, spec.VolumeId.Id, ExtractFaultTypeFromVolumeResponseResult(ctx, volumeOperationRes))
 		}
 		log.Infof("UpdateVolumeCrypto: Volume crypto updated successfully. volumeID: %q, opId: %q",
 			spec.VolumeId.Id, taskInfo.ActivationId)
@@ -1544,6 +1850,7 @@ func (m *defaultManager) UpdateVolumeCrypto(ctx context.Context, spec *cnstypes.
 	}
 	start := time.Now()
 	err := internalUpdateVolumeCrypto()
+	audit.finish(err)
 	if err != nil {
 		prometheus.CnsControlOpsHistVec.WithLabelValues(prometheus.PrometheusCnsUpdateVolumeCryptoOpType,
 			prometheus.PrometheusFailStatus).Observe(time.Since(start).Seconds())
@@ -1559,6 +1866,9 @@ func (m *defaultManager) ExpandVolume(ctx context.Context, volumeID string, size
 	extraParams interface{}) (string, error) {
 	ctx, cancelFunc := ensureOperationContextHasATimeout(ctx)
 	defer cancelFunc()
+	resetCnsTaskError(ctx)
+	defer m.queryCache.invalidate(volumeID)
+	ctx, audit := m.startAudit(ctx, auditOpExpandVolume, volumeID)
 	internalExpandVolume := func() (string, error) {
 		log := logger.GetLogger(ctx)
 		var faultType string
@@ -1583,6 +1893,7 @@ func (m *defaultManager) ExpandVolume(ctx context.Context, volumeID string, size
 	}
 	start := time.Now()
 	faultType, err := internalExpandVolume()
+	audit.finish(err)
 	log := logger.GetLogger(ctx)
 	log.Debugf("internalExpandVolume: returns fault %q for volume %q", faultType, volumeID)
 	if err != nil {
@@ -1652,8 +1963,10 @@ func (m *defaultManager) expandVolume(ctx context.Context, volumeID string, size
 	volumeOperationRes := taskResult.GetCnsVolumeOperationResult()
 	if volumeOperationRes.Fault != nil {
 		faultType = ExtractFaultTypeFromVolumeResponseResult(ctx, volumeOperationRes)
-		return faultType, logger.LogNewErrorf(log, "failed to extend volume: %q, fault: %q, opID: %q",
-			volumeID, spew.Sdump(volumeOperationRes.Fault), taskInfo.ActivationId)
+		return faultType, newCnsTaskError(ctx, logger.LogNewErrorf(log,
+			"failed to extend volume: %q, fault: %q, opID: %q",
+			volumeID, spew.Sdump(volumeOperationRes.Fault), taskInfo.ActivationId),
+			taskInfo, volumeID, faultType)
 	}
 	log.Infof("ExpandVolume: Volume expanded successfully. volumeID: %q, opId: %q", volumeID, taskInfo.ActivationId)
 	return "", nil
@@ -1873,8 +2186,10 @@ func (m *defaultManager) expandVolumeWithImprovedIdempotency(ctx context.Context
 			volumeOperationDetails.Capacity, quotaInfo, volumeOperationDetails.OperationDetails.TaskInvocationTimestamp,
 			task.Reference().Value, "", taskInfo.ActivationId, taskInvocationStatusError,
 			volumeOperationRes.Fault.LocalizedMessage)
-		return faultType, logger.LogNewErrorf(log, "failed to extend volume: %q, fault: %q, opID: %q",
-			volumeID, spew.Sdump(volumeOperationRes.Fault), taskInfo.ActivationId)
+		return faultType, newCnsTaskError(ctx, logger.LogNewErrorf(log,
+			"failed to extend volume: %q, fault: %q, opID: %q",
+			volumeID, spew.Sdump(volumeOperationRes.Fault), taskInfo.ActivationId),
+			taskInfo, volumeID, faultType)
 	}
 
 	log.Infof("ExpandVolume: Volume expanded successfully to size %d. volumeID: %q, opId: %q",
@@ -1917,6 +2232,15 @@ func (m *defaultManager) QueryVolume(ctx context.Context,
 		res = updateQueryResult(ctx, m, res)
 		return res, err
 	}
+	volumeID, cacheable := m.queryCache.cacheKey(queryFilter)
+	var cacheGeneration uint64
+	if cacheable {
+		if res, ok := m.queryCache.get(volumeID); ok {
+			logger.GetLogger(ctx).Debugf("Returning cached QueryVolume result for volume %q", volumeID)
+			return res, nil
+		}
+		cacheGeneration = m.queryCache.getGeneration()
+	}
 	start := time.Now()
 	resp, err := internalQueryVolume()
 	if err != nil {
@@ -1925,6 +2249,11 @@ func (m *defaultManager) QueryVolume(ctx context.Context,
 	} else {
 		prometheus.CnsControlOpsHistVec.WithLabelValues(prometheus.PrometheusCnsQueryVolumeOpType,
 			prometheus.PrometheusPassStatus).Observe(time.Since(start).Seconds())
+		// Only cache results which found the volume, so that a volume which
+		// is being created or registered is not reported missing.
+		if cacheable && len(resp.Volumes) == 1 {
+			m.queryCache.set(volumeID, resp, cacheGeneration)
+		}
 	}
 	return resp, err
 }
@@ -2035,10 +2364,39 @@ func (m *defaultManager) QueryVolumeInfo(ctx context.Context,
 	return resp, err
 }
 
+// finishRelocateVolumeAudit waits for the RelocateVolume task to complete and
+// writes the audit record with its result, including the faults of the
+// relocated volumes.
+func (m *defaultManager) finishRelocateVolumeAudit(ctx context.Context, audit *auditRecord,
+	taskMoRef vim25types.ManagedObjectReference) {
+	taskInfo, err := m.waitOnVimTask(ctx, taskMoRef)
+	if err == nil {
+		var results []cnstypes.BaseCnsVolumeOperationResult
+		results, err = cns.GetTaskResultArray(ctx, taskInfo)
+		for _, result := range results {
+			if fault := result.GetCnsVolumeOperationResult().Fault; fault != nil && err == nil {
+				err = fmt.Errorf("failed to relocate volume %q. fault: %q",
+					result.GetCnsVolumeOperationResult().VolumeId.Id, fault.LocalizedMessage)
+			}
+		}
+	}
+	audit.finish(err)
+}
+
 func (m *defaultManager) RelocateVolume(ctx context.Context,
 	relocateSpecList ...cnstypes.BaseCnsVolumeRelocateSpec) (*object.Task, error) {
 	ctx, cancelFunc := ensureOperationContextHasATimeout(ctx)
 	defer cancelFunc()
+	var relocatedVolumeIDs, relocateDatastores []string
+	for _, relocateSpec := range relocateSpecList {
+		defer m.queryCache.invalidate(relocateSpec.GetCnsVolumeRelocateSpec().VolumeId.Id)
+		relocatedVolumeIDs = append(relocatedVolumeIDs, relocateSpec.GetCnsVolumeRelocateSpec().VolumeId.Id)
+		relocateDatastores = append(relocateDatastores, relocateSpec.GetCnsVolumeRelocateSpec().Datastore.Value)
+	}
+	ctx, audit := m.startAudit(ctx, auditOpRelocateVolume, strings.Join(relocatedVolumeIDs, ","))
+	if audit != nil {
+		audit.datastores = relocateDatastores
+	}
 	internalRelocateVolume := func() (*object.Task, error) {
 		log := logger.GetLogger(ctx)
 		err := validateManager(ctx, m)
@@ -2062,6 +2420,14 @@ func (m *defaultManager) RelocateVolume(ctx context.Context,
 	}
 	start := time.Now()
 	resp, err := internalRelocateVolume()
+	if resp != nil && audit != nil {
+		addAuditTaskID(ctx, resp.Reference().Value)
+		// The volumes are relocated once the task completes, which callers
+		// wait for, so the audit record is written with the result of the task.
+		go m.finishRelocateVolumeAudit(context.WithoutCancel(ctx), audit, resp.Reference())
+	} else {
+		audit.finish(err)
+	}
 	if err != nil {
 		prometheus.CnsControlOpsHistVec.WithLabelValues(prometheus.PrometheusCnsRelocateVolumeOpType,
 			prometheus.PrometheusFailStatus).Observe(time.Since(start).Seconds())
@@ -2076,6 +2442,9 @@ func (m *defaultManager) RelocateVolume(ctx context.Context,
 func (m *defaultManager) ConfigureVolumeACLs(ctx context.Context, spec cnstypes.CnsVolumeACLConfigureSpec) error {
 	ctx, cancelFunc := ensureOperationContextHasATimeout(ctx)
 	defer cancelFunc()
+	resetCnsTaskError(ctx)
+	defer m.queryCache.invalidate(spec.VolumeId.Id)
+	ctx, audit := m.startAudit(ctx, auditOpConfigureVolumeACLs, spec.VolumeId.Id)
 	internalConfigureVolumeACLs := func() error {
 		log := logger.GetLogger(ctx)
 		err := validateManager(ctx, m)
@@ -2121,9 +2490,10 @@ func (m *defaultManager) ConfigureVolumeACLs(ctx context.Context, spec cnstypes.
 		}
 		volumeOperationRes := taskResult.GetCnsVolumeOperationResult()
 		if volumeOperationRes.Fault != nil {
-			return logger.LogNewErrorf(log,
+			return newCnsTaskError(ctx, logger.LogNewErrorf(log,
 				"failed to apply ConfigureVolumeACLs. VolumeID: %s spec: %q, fault: %q, opId: %q",
-				spec.VolumeId.Id, spew.Sdump(spec), spew.Sdump(volumeOperationRes.Fault), taskInfo.ActivationId)
+				spec.VolumeId.Id, spew.Sdump(spec), spew.Sdump(volumeOperationRes.Fault), taskInfo.ActivationId),
+				taskInfo, spec.VolumeId.Id, ExtractFaultTypeFromVolumeResponseResult(ctx, volumeOperationRes))
 		}
 
 		log.Infof("ConfigureVolumeACLs: Volume ACLs configured successfully. VolumeName: %q, opId: %q, volumeID: %q",
@@ -2132,6 +2502,7 @@ func (m *defaultManager) ConfigureVolumeACLs(ctx context.Context, spec cnstypes.
 	}
 	start := time.Now()
 	err := internalConfigureVolumeACLs()
+	audit.finish(err)
 	if err != nil {
 		prometheus.CnsControlOpsHistVec.WithLabelValues(prometheus.PrometheusCnsConfigureVolumeACLOpType,
 			prometheus.PrometheusFailStatus).Observe(time.Since(start).Seconds())
@@ -2148,9 +2519,14 @@ func (m *defaultManager) ConfigureVolumeACLs(ctx context.Context, spec cnstypes.
 // containing the vmdkPath and name is any given string for the FCD.
 // RegisterDisk API takes this name as optional parameter, so it need not be
 // a unique string or anything.
-func (m *defaultManager) RegisterDisk(ctx context.Context, path string, name string) (string, error) {
+func (m *defaultManager) RegisterDisk(ctx context.Context, path string, name string) (volumeID string, err error) {
+	ctx, audit := m.startAudit(ctx, auditOpRegisterDisk, "")
+	defer func() {
+		audit.setVolumeID(volumeID)
+		audit.finish(err)
+	}()
 	log := logger.GetLogger(ctx)
-	err := validateManager(ctx, m)
+	err = validateManager(ctx, m)
 	if err != nil {
 		log.Errorf("failed to validate volume manager with err: %+v", err)
 		return "", err
@@ -2162,7 +2538,11 @@ func (m *defaultManager) RegisterDisk(ctx context.Context, path string, name str
 		return "", err
 	}
 	globalObjectManager := vslm.NewGlobalObjectManager(m.virtualCenter.VslmClient)
-	vStorageObject, err := globalObjectManager.RegisterDisk(ctx, path, name)
+	var vStorageObject *vim25types.VStorageObject
+	err = m.virtualCenter.WithSessionRetry(ctx, func(ctx context.Context) error {
+		vStorageObject, err = globalObjectManager.RegisterDisk(ctx, path, name)
+		return err
+	})
 	if err != nil {
 		alreadyExists, objectID := cnsvsphere.IsAlreadyExists(err)
 		if alreadyExists {
@@ -2192,7 +2572,11 @@ func (m *defaultManager) RetrieveVStorageObject(ctx context.Context,
 		return nil, err
 	}
 	globalObjectManager := vslm.NewGlobalObjectManager(m.virtualCenter.VslmClient)
-	vStorageObject, err := globalObjectManager.Retrieve(ctx, vim25types.ID{Id: volumeID})
+	var vStorageObject *vim25types.VStorageObject
+	err = m.virtualCenter.WithSessionRetry(ctx, func(ctx context.Context) error {
+		vStorageObject, err = globalObjectManager.Retrieve(ctx, vim25types.ID{Id: volumeID})
+		return err
+	})
 	if err != nil {
 		log.Errorf("failed to retrieve virtual disk for volumeID %q with err: %v", volumeID, err)
 		return nil, err
@@ -2202,6 +2586,348 @@ func (m *defaultManager) RetrieveVStorageObject(ctx context.Context,
 	return vStorageObject, nil
 }
 
+// RetrieveVStorageObjectAssociations returns the VM disk associations of the
+// given volume id, i.e. the VMs the FCD is attached to, using vslm endpoint.
+func (m *defaultManager) RetrieveVStorageObjectAssociations(ctx context.Context,
+	volumeID string) ([]vslmtypes.VslmVsoVStorageObjectAssociationsVmDiskAssociation, error) {
+	log := logger.GetLogger(ctx)
+	err := validateManager(ctx, m)
+	if err != nil {
+		log.Errorf("failed to validate volume manager with err: %+v", err)
+		return nil, err
+	}
+	// Set up the VC connection
+	err = m.virtualCenter.ConnectVslm(ctx)
+	if err != nil {
+		log.Errorf("ConnectVslm failed with err: %+v", err)
+		return nil, err
+	}
+	globalObjectManager := vslm.NewGlobalObjectManager(m.virtualCenter.VslmClient)
+	var associations []vslmtypes.VslmVsoVStorageObjectAssociations
+	err = m.virtualCenter.WithSessionRetry(ctx, func(ctx context.Context) error {
+		associations, err = globalObjectManager.RetrieveAssociations(ctx, []vim25types.ID{{Id: volumeID}})
+		return err
+	})
+	if err != nil {
+		log.Errorf("failed to retrieve associations of virtual disk for volumeID %q with err: %v", volumeID, err)
+		return nil, err
+	}
+	var vmDiskAssociations []vslmtypes.VslmVsoVStorageObjectAssociationsVmDiskAssociation
+	for _, association := range associations {
+		if association.Fault != nil {
+			return nil, logger.LogNewErrorf(log, "failed to retrieve associations of virtual disk for "+
+				"volumeID %q with fault: %+v", volumeID, association.Fault.LocalizedMessage)
+		}
+		vmDiskAssociations = append(vmDiskAssociations, association.VmDiskAssociation...)
+	}
+	log.Debugf("Associations of volumeID %q: %+v", volumeID, vmDiskAssociations)
+	return vmDiskAssociations, nil
+}
+
+// UpdateVStorageObjectMetadata sets the given metadata key-value pairs on the
+// virtual disk backing the given volume id using vslm endpoint.
+func (m *defaultManager) UpdateVStorageObjectMetadata(ctx context.Context, volumeID string,
+	metadata []vim25types.KeyValue) (err error) {
+	ctx, cancelFunc := ensureOperationContextHasATimeout(ctx)
+	defer cancelFunc()
+	ctx, audit := m.startAudit(ctx, auditOpUpdateDiskMetadata, volumeID)
+	defer func() { audit.finish(err) }()
+	log := logger.GetLogger(ctx)
+	err = validateManager(ctx, m)
+	if err != nil {
+		log.Errorf("failed to validate volume manager with err: %+v", err)
+		return err
+	}
+	// Set up the VC connection
+	err = m.virtualCenter.ConnectVslm(ctx)
+	if err != nil {
+		log.Errorf("ConnectVslm failed with err: %+v", err)
+		return err
+	}
+	globalObjectManager := vslm.NewGlobalObjectManager(m.virtualCenter.VslmClient)
+	var task *vslm.Task
+	err = m.virtualCenter.WithSessionRetry(ctx, func(ctx context.Context) error {
+		task, err = globalObjectManager.UpdateMetadata(ctx, vim25types.ID{Id: volumeID}, metadata, nil)
+		return err
+	})
+	if err != nil {
+		log.Errorf("failed to update metadata of virtual disk for volumeID %q with err: %v", volumeID, err)
+		return err
+	}
+	if _, err = waitOnVslmTask(ctx, task); err != nil {
+		log.Errorf("update metadata task for volumeID %q failed with err: %v", volumeID, err)
+		return err
+	}
+	log.Infof("Successfully updated metadata of volumeID %q: %+v", volumeID, metadata)
+	return nil
+}
+
+// RetrieveVStorageObjectMetadata returns the metadata key-value pairs of the
+// virtual disk backing the given volume id whose keys start with prefix,
+// using vslm endpoint.
+func (m *defaultManager) RetrieveVStorageObjectMetadata(ctx context.Context, volumeID string,
+	prefix string) ([]vim25types.KeyValue, error) {
+	log := logger.GetLogger(ctx)
+	err := validateManager(ctx, m)
+	if err != nil {
+		log.Errorf("failed to validate volume manager with err: %+v", err)
+		return nil, err
+	}
+	// Set up the VC connection
+	err = m.virtualCenter.ConnectVslm(ctx)
+	if err != nil {
+		log.Errorf("ConnectVslm failed with err: %+v", err)
+		return nil, err
+	}
+	globalObjectManager := vslm.NewGlobalObjectManager(m.virtualCenter.VslmClient)
+	var metadata []vim25types.KeyValue
+	err = m.virtualCenter.WithSessionRetry(ctx, func(ctx context.Context) error {
+		metadata, err = globalObjectManager.RetrieveMetadata(ctx, vim25types.ID{Id: volumeID}, nil, prefix)
+		return err
+	})
+	if err != nil {
+		log.Errorf("failed to retrieve metadata of virtual disk for volumeID %q with err: %v", volumeID, err)
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// CloneVStorageObject creates a full copy of the virtual disk backing the given
+// volume id using vslm endpoint and returns the id of the cloned FCD. The clone
+// is not registered with CNS; callers are expected to register it.
+// If an FCD with the name in the clone spec already exists, its id is returned
+// so that retried requests do not leave behind duplicate clones.
+func (m *defaultManager) CloneVStorageObject(ctx context.Context, volumeID string,
+	spec vim25types.VslmCloneSpec) (clonedVolumeID string, err error) {
+	ctx, cancelFunc := ensureOperationContextHasATimeout(ctx)
+	defer cancelFunc()
+	// The audit record of the clone is recorded with the ID of the source
+	// volume, as the clone is only known once it has been created.
+	ctx, audit := m.startAudit(ctx, auditOpCloneDisk, volumeID)
+	defer func() { audit.finish(err) }()
+	log := logger.GetLogger(ctx)
+	err = validateManager(ctx, m)
+	if err != nil {
+		log.Errorf("failed to validate volume manager with err: %+v", err)
+		return "", err
+	}
+	// Set up the VC connection
+	err = m.virtualCenter.ConnectVslm(ctx)
+	if err != nil {
+		log.Errorf("ConnectVslm failed with err: %+v", err)
+		return "", err
+	}
+	globalObjectManager := vslm.NewGlobalObjectManager(m.virtualCenter.VslmClient)
+	var existingID string
+	err = m.virtualCenter.WithSessionRetry(ctx, func(ctx context.Context) error {
+		existingID, err = findVStorageObjectByName(ctx, globalObjectManager, spec.Name)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if existingID != "" {
+		return existingID, nil
+	}
+	var task *vslm.Task
+	err = m.virtualCenter.WithSessionRetry(ctx, func(ctx context.Context) error {
+		task, err = globalObjectManager.Clone(ctx, vim25types.ID{Id: volumeID}, spec)
+		return err
+	})
+	if err != nil {
+		log.Errorf("failed to clone virtual disk for volumeID %q with err: %v", volumeID, err)
+		return "", err
+	}
+	res, err := waitOnVslmTask(ctx, task)
+	if err != nil {
+		log.Errorf("clone task for volumeID %q failed with err: %v", volumeID, err)
+		return "", err
+	}
+	vStorageObject, ok := res.(vim25types.VStorageObject)
+	if !ok {
+		return "", logger.LogNewErrorf(log, "unexpected result %+v returned by clone task for volumeID %q",
+			res, volumeID)
+	}
+	log.Infof("Successfully cloned volumeID: %q to FCD: %q", volumeID, vStorageObject.Config.Id.Id)
+	return vStorageObject.Config.Id.Id, nil
+}
+
+// CreateVStorageObject creates a new virtual disk using vslm endpoint and
+// returns the id of the created FCD. The FCD is not registered with CNS;
+// callers are expected to register it.
+// If an FCD with the name in the create spec already exists, its id is returned
+// so that retried requests do not leave behind duplicate disks.
+func (m *defaultManager) CreateVStorageObject(ctx context.Context,
+	spec vim25types.VslmCreateSpec) (volumeID string, err error) {
+	ctx, cancelFunc := ensureOperationContextHasATimeout(ctx)
+	defer cancelFunc()
+	ctx, audit := m.startAudit(ctx, auditOpCreateDisk, "")
+	defer func() {
+		audit.setVolumeID(volumeID)
+		audit.finish(err)
+	}()
+	log := logger.GetLogger(ctx)
+	err = validateManager(ctx, m)
+	if err != nil {
+		log.Errorf("failed to validate volume manager with err: %+v", err)
+		return "", err
+	}
+	// Set up the VC connection
+	err = m.virtualCenter.ConnectVslm(ctx)
+	if err != nil {
+		log.Errorf("ConnectVslm failed with err: %+v", err)
+		return "", err
+	}
+	globalObjectManager := vslm.NewGlobalObjectManager(m.virtualCenter.VslmClient)
+	var existingID string
+	err = m.virtualCenter.WithSessionRetry(ctx, func(ctx context.Context) error {
+		existingID, err = findVStorageObjectByName(ctx, globalObjectManager, spec.Name)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if existingID != "" {
+		return existingID, nil
+	}
+	var task *vslm.Task
+	err = m.virtualCenter.WithSessionRetry(ctx, func(ctx context.Context) error {
+		task, err = globalObjectManager.CreateDisk(ctx, spec)
+		return err
+	})
+	if err != nil {
+		log.Errorf("failed to create virtual disk %q with err: %v", spec.Name, err)
+		return "", err
+	}
+	res, err := waitOnVslmTask(ctx, task)
+	if err != nil {
+		log.Errorf("create task for virtual disk %q failed with err: %v", spec.Name, err)
+		return "", err
+	}
+	vStorageObject, ok := res.(vim25types.VStorageObject)
+	if !ok {
+		return "", logger.LogNewErrorf(log, "unexpected result %+v returned by create task for virtual disk %q",
+			res, spec.Name)
+	}
+	log.Infof("Successfully created FCD: %q with name %q", vStorageObject.Config.Id.Id, spec.Name)
+	return vStorageObject.Config.Id.Id, nil
+}
+
+// DeleteVStorageObject deletes the FCD using vslm endpoint. It is used to
+// clean up a FCD which failed to be registered with CNS.
+func (m *defaultManager) DeleteVStorageObject(ctx context.Context, volumeID string) (err error) {
+	ctx, cancelFunc := ensureOperationContextHasATimeout(ctx)
+	defer cancelFunc()
+	ctx, audit := m.startAudit(ctx, auditOpDeleteDisk, volumeID)
+	defer func() { audit.finish(err) }()
+	log := logger.GetLogger(ctx)
+	err = validateManager(ctx, m)
+	if err != nil {
+		log.Errorf("failed to validate volume manager with err: %+v", err)
+		return err
+	}
+	// Set up the VC connection
+	err = m.virtualCenter.ConnectVslm(ctx)
+	if err != nil {
+		log.Errorf("ConnectVslm failed with err: %+v", err)
+		return err
+	}
+	globalObjectManager := vslm.NewGlobalObjectManager(m.virtualCenter.VslmClient)
+	var task *vslm.Task
+	err = m.virtualCenter.WithSessionRetry(ctx, func(ctx context.Context) error {
+		task, err = globalObjectManager.Delete(ctx, vim25types.ID{Id: volumeID})
+		return err
+	})
+	if err != nil {
+		log.Errorf("failed to delete virtual disk %q with err: %v", volumeID, err)
+		return err
+	}
+	if _, err = waitOnVslmTask(ctx, task); err != nil {
+		log.Errorf("delete task for virtual disk %q failed with err: %v", volumeID, err)
+		return err
+	}
+	log.Infof("Successfully deleted FCD: %q", volumeID)
+	return nil
+}
+
+// UpdateVStorageObjectPolicy applies the given storage policy to the virtual
+// disk backing the volume using vslm endpoint, without moving the disk to
+// another datastore.
+func (m *defaultManager) UpdateVStorageObjectPolicy(ctx context.Context, volumeID string,
+	storagePolicyID string) (err error) {
+	ctx, cancelFunc := ensureOperationContextHasATimeout(ctx)
+	defer cancelFunc()
+	defer m.queryCache.invalidate(volumeID)
+	ctx, audit := m.startAudit(ctx, auditOpUpdateVolumePolicy, volumeID)
+	audit.setStoragePolicyID(storagePolicyID)
+	defer func() { audit.finish(err) }()
+	log := logger.GetLogger(ctx)
+	err = validateManager(ctx, m)
+	if err != nil {
+		log.Errorf("failed to validate volume manager with err: %+v", err)
+		return err
+	}
+	// Set up the VC connection
+	err = m.virtualCenter.ConnectVslm(ctx)
+	if err != nil {
+		log.Errorf("ConnectVslm failed with err: %+v", err)
+		return err
+	}
+	globalObjectManager := vslm.NewGlobalObjectManager(m.virtualCenter.VslmClient)
+	var vStorageObject *vim25types.VStorageObject
+	err = m.virtualCenter.WithSessionRetry(ctx, func(ctx context.Context) error {
+		vStorageObject, err = globalObjectManager.Retrieve(ctx, vim25types.ID{Id: volumeID})
+		return err
+	})
+	if err != nil {
+		log.Errorf("failed to retrieve virtual disk for volumeID %q with err: %v", volumeID, err)
+		return err
+	}
+	// The vslm UpdatePolicy API does not accept a defined profile spec, use the
+	// VStorageObjectManager of vCenter instead.
+	res, err := methods.UpdateVStorageObjectPolicy_Task(ctx, m.virtualCenter.Client.Client,
+		&vim25types.UpdateVStorageObjectPolicy_Task{
+			This:      *m.virtualCenter.Client.ServiceContent.VStorageObjectManager,
+			Id:        vim25types.ID{Id: volumeID},
+			Datastore: vStorageObject.Config.Backing.GetBaseConfigInfoBackingInfo().Datastore,
+			Profile: []vim25types.BaseVirtualMachineProfileSpec{
+				&vim25types.VirtualMachineDefinedProfileSpec{ProfileId: storagePolicyID},
+			},
+		})
+	if err != nil {
+		log.Errorf("failed to update storage policy of FCD %q to %q with err: %v", volumeID, storagePolicyID, err)
+		return err
+	}
+	addAuditTaskID(ctx, res.Returnval.Value)
+	if _, err = m.waitOnVimTask(ctx, res.Returnval); err != nil {
+		log.Errorf("update policy task for FCD %q failed with err: %v", volumeID, err)
+		return err
+	}
+	log.Infof("Successfully updated storage policy of FCD: %q to %q", volumeID, storagePolicyID)
+	return nil
+}
+
+// findVStorageObjectByName returns the id of the FCD with the given name, or
+// an empty string if no such FCD exists.
+func findVStorageObjectByName(ctx context.Context, globalObjectManager *vslm.GlobalObjectManager,
+	name string) (string, error) {
+	log := logger.GetLogger(ctx)
+	listResult, err := globalObjectManager.List(ctx, vslmtypes.VslmVsoVStorageObjectQuerySpec{
+		QueryField:    string(vslmtypes.VslmVsoVStorageObjectQuerySpecQueryFieldEnumName),
+		QueryOperator: string(vslmtypes.VslmVsoVStorageObjectQuerySpecQueryOperatorEnumEquals),
+		QueryValue:    []string{name},
+	})
+	if err != nil {
+		log.Errorf("failed to list virtual disks with name %q. err: %v", name, err)
+		return "", err
+	}
+	if len(listResult.Id) > 0 {
+		log.Infof("FCD: %q with name %q already exists, returning success", listResult.Id[0].Id, name)
+		return listResult.Id[0].Id, nil
+	}
+	return "", nil
+}
+
 // QueryVolumeAsync returns volumes matching the given filter by using
 // CnsQueryAsync API. QueryVolumeAsync takes querySelection spec which helps
 // to specify which fields for the query entities to be returned. All volume
@@ -2329,7 +3055,7 @@ func (m *defaultManager) createSnapshotWithImprovedIdempotencyCheck(ctx context.
 		// Reference to the CreateSnapshot task on CNS.
 		createSnapshotsTask *object.Task
 		// Name of the CnsVolumeOperationRequest instance.
-		instanceName = snapshotName + "-" + volumeID
+		instanceName = GetCnsSnapshotDescription(snapshotName, volumeID)
 		// Local instance of CreateSnapshot details that needs to be persisted.
 		volumeOperationDetails *cnsvolumeoperationrequest.VolumeOperationRequestDetails
 		// error
@@ -2587,7 +3313,8 @@ func (m *defaultManager) createSnapshotWithImprovedIdempotencyCheck(ctx context.
 			}
 		}
 
-		return nil, logger.LogNewError(log, errMsg)
+		return nil, newCnsTaskError(ctx, logger.LogNewError(log, errMsg), createSnapshotsTaskInfo, volumeID,
+			ExtractFaultTypeFromVolumeResponseResult(ctx, createSnapshotsOperationRes))
 	}
 
 	snapshotCreateResult := interface{}(createSnapshotsTaskResult).(*cnstypes.CnsSnapshotCreateResult)
@@ -2630,6 +3357,9 @@ func (m *defaultManager) CreateSnapshot(
 	ctx context.Context, volumeID string, snapshotName string, extraParams interface{}) (*CnsSnapshotInfo, error) {
 	ctx, cancelFunc := ensureOperationContextHasATimeout(ctx)
 	defer cancelFunc()
+	resetCnsTaskError(ctx)
+	defer m.queryCache.invalidate(volumeID)
+	ctx, audit := m.startAudit(ctx, auditOpCreateSnapshot, volumeID)
 	internalCreateSnapshot := func() (*CnsSnapshotInfo, error) {
 		log := logger.GetLogger(ctx)
 		err := validateManager(ctx, m)
@@ -2647,6 +3377,10 @@ func (m *defaultManager) CreateSnapshot(
 
 	start := time.Now()
 	cnsSnapshotInfo, err := internalCreateSnapshot()
+	if cnsSnapshotInfo != nil {
+		audit.setSnapshotID(cnsSnapshotInfo.SnapshotID)
+	}
+	audit.finish(err)
 	if err != nil {
 		prometheus.CnsControlOpsHistVec.WithLabelValues(prometheus.PrometheusCnsCreateSnapshotOpType,
 			prometheus.PrometheusFailStatus).Observe(time.Since(start).Seconds())
@@ -2875,6 +3609,24 @@ func (m *defaultManager) deleteSnapshotWithImprovedIdempotencyCheck(
 	// Get the taskResult
 	deleteSnapshotsTaskResult, err := getTaskResultFromTaskInfo(ctx, deleteSnapshotsTaskInfo)
 	if err != nil {
+		// CNS may complete the task without any result if the snapshot does
+		// not exist. Check whether the snapshot was already deleted.
+		if checkErr := checkSnapshotAlreadyDeleted(ctx, m, volumeID, snapshotID); checkErr == nil {
+			log.Infof("DeleteSnapshot: Snapshot %q on volume %q is already deleted", snapshotID, volumeID)
+			cnsSnapshotInfo, err = m.deletedSnapshotInfo(ctx, volumeID, snapshotID, quotaInfo)
+			if err != nil {
+				return nil, err
+			}
+			if m.idempotencyHandlingEnabled {
+				volumeOperationDetails = createRequestDetails(instanceName, "", "", 0, quotaInfo,
+					volumeOperationDetails.OperationDetails.TaskInvocationTimestamp, deleteSnapshotTask.Reference().Value, "",
+					deleteSnapshotsTaskInfo.ActivationId, taskInvocationStatusSuccess, "")
+			}
+			return cnsSnapshotInfo, nil
+		} else if errors.Is(checkErr, ErrSnapshotVolumeNotFound) {
+			log.Errorf("failed to delete snapshot %q on volume %q. Err: %v", snapshotID, volumeID, checkErr)
+			return nil, checkErr
+		}
 		return nil, logger.LogNewErrorf(log, "failed to get the task result for DeleteSnapshots task "+
 			"from vCenter %q. taskID: %q, opId: %q createResults: %+v", m.virtualCenter.Config.Host,
 			deleteSnapshotsTaskInfo.Task.Value, deleteSnapshotsTaskInfo.ActivationId, deleteSnapshotsTaskResult)
@@ -2895,7 +3647,22 @@ func (m *defaultManager) deleteSnapshotWithImprovedIdempotencyCheck(
 			invalidProperty = deleteSnapshotsOperationRes.Fault.Fault.(*vim25types.InvalidArgument).InvalidProperty
 		}
 
-		// Ignore errors, NotFound and InvalidArgument, in DeleteSnapshot
+		// Ignore errors, NotFound and InvalidArgument, in DeleteSnapshot unless
+		// the volume of the snapshot is not found either.
+		if cnsvsphere.IsVimFaultNotFoundError(err) || (isInvalidArgumentError && invalidProperty == "") {
+			if checkErr := checkSnapshotAlreadyDeleted(ctx, m, volumeID, snapshotID); errors.Is(checkErr,
+				ErrSnapshotVolumeNotFound) {
+				errMsg := fmt.Sprintf("failed to delete snapshot %q on volume %q. opId: %q. Err: %v",
+					snapshotID, volumeID, deleteSnapshotsTaskInfo.ActivationId, checkErr)
+				if m.idempotencyHandlingEnabled {
+					volumeOperationDetails = createRequestDetails(instanceName, "", "", 0, nil,
+						volumeOperationDetails.OperationDetails.TaskInvocationTimestamp, deleteSnapshotTask.Reference().Value,
+						"", deleteSnapshotsTaskInfo.ActivationId, taskInvocationStatusError, errMsg)
+				}
+				log.Error(errMsg)
+				return nil, checkErr
+			}
+		}
 		if cnsvsphere.IsVimFaultNotFoundError(err) {
 			log.Infof("Snapshot %q on volume %q might have already been deleted "+
 				"with the error %v. Ignore the error for DeleteSnapshot", snapshotID, volumeID,
@@ -2914,7 +3681,8 @@ func (m *defaultManager) deleteSnapshotWithImprovedIdempotencyCheck(
 					"", deleteSnapshotsTaskInfo.ActivationId, taskInvocationStatusError, errMsg)
 			}
 
-			return nil, logger.LogNewError(log, errMsg)
+			return nil, newCnsTaskError(ctx, logger.LogNewError(log, errMsg), deleteSnapshotsTaskInfo, volumeID,
+				ExtractFaultTypeFromVolumeResponseResult(ctx, deleteSnapshotsOperationRes))
 		}
 	}
 	if isStorageQuotaM2FSSEnabled && m.clusterFlavor == cnstypes.CnsClusterFlavorWorkload {
@@ -2944,10 +3712,40 @@ func (m *defaultManager) deleteSnapshotWithImprovedIdempotencyCheck(
 	return cnsSnapshotInfo, nil
 }
 
+// deletedSnapshotInfo returns the CnsSnapshotInfo for a snapshot found to be
+// already deleted. The aggregated snapshot size of the volume is refreshed in
+// quotaInfo, if set.
+func (m *defaultManager) deletedSnapshotInfo(ctx context.Context, volumeID string, snapshotID string,
+	quotaInfo *cnsvolumeoperationrequest.QuotaDetails) (*CnsSnapshotInfo, error) {
+	log := logger.GetLogger(ctx)
+	if quotaInfo == nil {
+		return nil, nil
+	}
+	aggregatedSnapshotCapacityInMb, err := m.getAggregatedSnapshotSize(ctx, volumeID)
+	if err != nil {
+		return nil, logger.LogNewErrorf(log,
+			"Failed to get aggregated snapshot size for volume %q with error %v", volumeID, err)
+	}
+	currentTime := time.Now()
+	quotaInfo.AggregatedSnapshotSize = resource.NewQuantity(aggregatedSnapshotCapacityInMb*MbInBytes,
+		resource.BinarySI)
+	quotaInfo.SnapshotLatestOperationCompleteTime.Time = currentTime
+	return &CnsSnapshotInfo{
+		SnapshotID:                          snapshotID,
+		SourceVolumeID:                      volumeID,
+		AggregatedSnapshotCapacityInMb:      aggregatedSnapshotCapacityInMb,
+		SnapshotLatestOperationCompleteTime: currentTime,
+	}, nil
+}
+
 func (m *defaultManager) DeleteSnapshot(ctx context.Context, volumeID string, snapshotID string,
 	extraParams interface{}) (*CnsSnapshotInfo, error) {
 	ctx, cancelFunc := ensureOperationContextHasATimeout(ctx)
 	defer cancelFunc()
+	resetCnsTaskError(ctx)
+	defer m.queryCache.invalidate(volumeID)
+	ctx, audit := m.startAudit(ctx, auditOpDeleteSnapshot, volumeID)
+	audit.setSnapshotID(snapshotID)
 	internalDeleteSnapshot := func() (*CnsSnapshotInfo, error) {
 		log := logger.GetLogger(ctx)
 		err := validateManager(ctx, m)
@@ -2966,6 +3764,7 @@ func (m *defaultManager) DeleteSnapshot(ctx context.Context, volumeID string, sn
 
 	start := time.Now()
 	cnsSnapshotInfo, err := internalDeleteSnapshot()
+	audit.finish(err)
 	if err != nil {
 		prometheus.CnsControlOpsHistVec.WithLabelValues(prometheus.PrometheusCnsDeleteSnapshotOpType,
 			prometheus.PrometheusFailStatus).Observe(time.Since(start).Seconds())
@@ -2976,9 +3775,59 @@ func (m *defaultManager) DeleteSnapshot(ctx context.Context, volumeID string, sn
 	return cnsSnapshotInfo, err
 }
 
+// AttachMultiWriterDisk attaches the FCD backed by the given file to the VM in
+// multi-writer sharing mode. The VM is reconfigured, as the attach in
+// multi-writer mode is not supported by CNS.
+func (m *defaultManager) AttachMultiWriterDisk(ctx context.Context, vm *cnsvsphere.VirtualMachine, volumeID string,
+	fileName string, datastore *cnsvsphere.Datastore, busNumber int32, unitNumber int32) error {
+	ctx, cancelFunc := ensureOperationContextHasATimeout(ctx)
+	defer cancelFunc()
+	defer m.queryCache.invalidate(volumeID)
+	_, audit := m.startAudit(ctx, auditOpAttachMultiWriterVolume, volumeID)
+	audit.setVM(vm.String())
+	err := vm.AttachMultiWriterDisk(ctx, volumeID, fileName, datastore, busNumber, unitNumber)
+	audit.finish(err)
+	return err
+}
+
+// DetachMultiWriterDisk detaches the FCD attached in multi-writer sharing mode
+// from the VM by reconfiguring the VM, leaving it attached to the other VMs
+// sharing it. No audit record is written if the FCD is not attached to the VM
+// in multi-writer mode.
+func (m *defaultManager) DetachMultiWriterDisk(ctx context.Context, vm *cnsvsphere.VirtualMachine,
+	volumeID string) (bool, error) {
+	ctx, cancelFunc := ensureOperationContextHasATimeout(ctx)
+	defer cancelFunc()
+	defer m.queryCache.invalidate(volumeID)
+	_, audit := m.startAudit(ctx, auditOpDetachMultiWriterVolume, volumeID)
+	audit.setVM(vm.String())
+	detached, err := vm.DetachMultiWriterDisk(ctx, volumeID)
+	if detached || err != nil {
+		audit.finish(err)
+	}
+	return detached, err
+}
+
+// SetDiskIOPSLimit sets the IOPS limit of the disk of the FCD attached to the
+// VM by reconfiguring the VM. No audit record is written if the FCD is not
+// attached to the VM.
+func (m *defaultManager) SetDiskIOPSLimit(ctx context.Context, vm *cnsvsphere.VirtualMachine, volumeID string,
+	iopsLimit int64) (bool, error) {
+	ctx, cancelFunc := ensureOperationContextHasATimeout(ctx)
+	defer cancelFunc()
+	_, audit := m.startAudit(ctx, auditOpSetVolumeIopsLimit, volumeID)
+	audit.setVM(vm.String())
+	found, err := vm.SetDiskIOPSLimit(ctx, volumeID, iopsLimit)
+	if found || err != nil {
+		audit.finish(err)
+	}
+	return found, err
+}
+
 // ProtectVolumeFromVMDeletion helps set keepAfterDeleteVm control flag for given volumeID
 func (m *defaultManager) ProtectVolumeFromVMDeletion(ctx context.Context, volumeID string) error {
 	log := logger.GetLogger(ctx)
+	defer m.queryCache.invalidate(volumeID)
 	err := validateManager(ctx, m)
 	if err != nil {
 		log.Errorf("failed to validate volume manager with err: %+v", err)
@@ -2999,8 +3848,10 @@ func (m *defaultManager) ProtectVolumeFromVMDeletion(ctx context.Context, volume
 			return err
 		}
 		globalObjectManager := vslm.NewGlobalObjectManager(m.virtualCenter.VslmClient)
-		err = globalObjectManager.SetControlFlags(ctx, vim25types.ID{Id: volumeID}, []string{
-			string(vim25types.VslmVStorageObjectControlFlagKeepAfterDeleteVm)})
+		err = m.virtualCenter.WithSessionRetry(ctx, func(ctx context.Context) error {
+			return globalObjectManager.SetControlFlags(ctx, vim25types.ID{Id: volumeID}, []string{
+				string(vim25types.VslmVStorageObjectControlFlagKeepAfterDeleteVm)})
+		})
 		if err != nil {
 			log.Errorf("failed to set control flag keepAfterDeleteVm  for volumeID %q with err: %v", volumeID, err)
 			return err
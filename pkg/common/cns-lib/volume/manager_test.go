@@ -2,11 +2,20 @@ package volume
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/vmware/govmomi"
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/soap"
 	vim25types "github.com/vmware/govmomi/vim25/types"
+
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/vsphere"
 )
 
 const createVolumeTaskTimeout = 3 * time.Second
@@ -43,6 +52,78 @@ func TestWaitForResultOrTimeoutPass(t *testing.T) {
 	assert.Equal(t, expectedTaskInfo, taskInfo)
 }
 
+func TestWaitForResultOrTimeoutDeadline(t *testing.T) {
+	// the wait stops as soon as the short deadline of the caller expires
+	ctx, cancelFunc := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancelFunc()
+	ch := make(chan TaskResult, 1)
+	taskMoRef := vim25types.ManagedObjectReference{
+		Type:  "Task",
+		Value: "task-42",
+	}
+	start := time.Now()
+	taskInfo, err := waitForResultOrTimeout(ctx, taskMoRef, ch)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Nil(t, taskInfo)
+	assert.Less(t, time.Since(start), createVolumeTaskTimeout)
+	// A result delivered after the waiter has given up does not block the sender.
+	select {
+	case ch <- TaskResult{TaskInfo: &vim25types.TaskInfo{State: vim25types.TaskInfoStateSuccess}}:
+	default:
+		t.Fatal("task result was not delivered to the buffered channel")
+	}
+}
+
+func TestQueryVolumeCache(t *testing.T) {
+	cache := newQueryVolumeCache()
+	filter := cnstypes.CnsQueryFilter{VolumeIds: []cnstypes.CnsVolumeId{{Id: "vol-1"}}}
+	volumeID, ok := cache.cacheKey(filter)
+	assert.True(t, ok)
+	assert.Equal(t, "vol-1", volumeID)
+	// Filters selecting on anything other than a single volume ID are not cached.
+	filter.Names = []string{"pvc-1"}
+	_, ok = cache.cacheKey(filter)
+	assert.False(t, ok)
+
+	result := &cnstypes.CnsQueryResult{Volumes: []cnstypes.CnsVolume{{
+		VolumeId: cnstypes.CnsVolumeId{Id: "vol-1"},
+		Metadata: cnstypes.CnsVolumeMetadata{
+			EntityMetadata: []cnstypes.BaseCnsEntityMetadata{
+				&cnstypes.CnsKubernetesEntityMetadata{
+					CnsEntityMetadata: cnstypes.CnsEntityMetadata{EntityName: "pvc-1"},
+					EntityType:        string(cnstypes.CnsKubernetesEntityTypePVC),
+				},
+			},
+		},
+		BackingObjectDetails: &cnstypes.CnsBlockBackingDetails{BackingDiskId: "disk-1"},
+	}}}
+	cache.set(volumeID, result, cache.getGeneration())
+	cached, ok := cache.get(volumeID)
+	assert.True(t, ok)
+	assert.Equal(t, result, cached)
+	// Changes to the returned result, including its nested fields, must not
+	// leak into the cache.
+	cached.Volumes[0].Name = "modified"
+	cached.Volumes[0].Metadata.EntityMetadata[0].(*cnstypes.CnsKubernetesEntityMetadata).EntityName = "modified"
+	cached.Volumes[0].BackingObjectDetails.(*cnstypes.CnsBlockBackingDetails).BackingDiskId = "modified"
+	cached, _ = cache.get(volumeID)
+	assert.Empty(t, cached.Volumes[0].Name)
+	assert.Equal(t, "pvc-1",
+		cached.Volumes[0].Metadata.EntityMetadata[0].(*cnstypes.CnsKubernetesEntityMetadata).EntityName)
+	assert.Equal(t, "disk-1", cached.Volumes[0].BackingObjectDetails.(*cnstypes.CnsBlockBackingDetails).BackingDiskId)
+
+	cache.invalidate(volumeID)
+	_, ok = cache.get(volumeID)
+	assert.False(t, ok)
+
+	// A result queried before the cache was invalidated is not cached.
+	generation := cache.getGeneration()
+	cache.invalidate(volumeID)
+	cache.set(volumeID, result, generation)
+	_, ok = cache.get(volumeID)
+	assert.False(t, ok)
+}
+
 func performSlowTask(ch chan TaskResult, delay time.Duration) {
 	time.Sleep(delay)
 	ch <- TaskResult{
@@ -50,3 +131,218 @@ func performSlowTask(ch chan TaskResult, delay time.Duration) {
 		Err:      nil,
 	}
 }
+
+func TestAuditRecord(t *testing.T) {
+	ctx := context.Background()
+	m := &defaultManager{}
+
+	SetAuditLogEnabled(ctx, false)
+	_, record := m.startAudit(ctx, auditOpCreateVolume, "")
+	assert.Nil(t, record, "no audit record expected while the audit log is disabled")
+	// Methods of a nil record are no-ops.
+	record.setCreateSpec(&cnstypes.CnsVolumeCreateSpec{})
+	record.finish(nil)
+
+	SetAuditLogEnabled(ctx, true)
+	defer SetAuditLogEnabled(ctx, false)
+	auditCtx, record := m.startAudit(ContextWithAuditRequester(ctx, "ns", "pvc-from-params"),
+		auditOpCreateVolume, "")
+	assert.NotNil(t, record)
+	record.setCreateSpec(&cnstypes.CnsVolumeCreateSpec{
+		Datastores: []vim25types.ManagedObjectReference{{Type: "Datastore", Value: "datastore-1"}},
+		Profile: []vim25types.BaseVirtualMachineProfileSpec{
+			&vim25types.VirtualMachineDefinedProfileSpec{ProfileId: "policy-1"},
+		},
+		Metadata: cnstypes.CnsVolumeMetadata{
+			EntityMetadata: []cnstypes.BaseCnsEntityMetadata{
+				&cnstypes.CnsKubernetesEntityMetadata{
+					CnsEntityMetadata: cnstypes.CnsEntityMetadata{EntityName: "pvc-from-spec"},
+					EntityType:        string(cnstypes.CnsKubernetesEntityTypePVC),
+					Namespace:         "ns",
+				},
+			},
+		},
+	})
+	addAuditTaskID(auditCtx, "task-1")
+	record.setVolumeID("vol-1")
+
+	assert.Equal(t, "vol-1", record.volumeID)
+	assert.Equal(t, "policy-1", record.storagePolicyID)
+	assert.Equal(t, []string{"datastore-1"}, record.datastores)
+	// The requester from the CSI request parameters takes precedence over the spec.
+	assert.Equal(t, "pvc-from-params", record.requesterName)
+	assert.Equal(t, []string{"task-1"}, record.taskIDs)
+	record.finish(nil)
+}
+
+func TestNewCnsTaskError(t *testing.T) {
+	ctx := ContextWithCnsTaskErrorRecorder(context.Background())
+	assert.Nil(t, LastCnsTaskError(ctx))
+	assert.NoError(t, newCnsTaskError(ctx, nil, &vim25types.TaskInfo{}, "vol-1", "vim.fault.NotFound"))
+
+	baseErr := errors.New("failed to delete volume")
+	taskInfo := &vim25types.TaskInfo{
+		Task:         vim25types.ManagedObjectReference{Type: "Task", Value: "task-42"},
+		ActivationId: "op-1",
+	}
+	err := newCnsTaskError(ctx, baseErr, taskInfo, "vol-1", "vim.fault.NotFound")
+	assert.ErrorIs(t, err, baseErr)
+	assert.Equal(t, "failed to delete volume [CNS task: task-42, opId: op-1, volumeID: vol-1, "+
+		"fault: vim.fault.NotFound]", err.Error())
+	taskErr := LastCnsTaskError(ctx)
+	if assert.NotNil(t, taskErr) {
+		assert.Equal(t, "task-42", taskErr.TaskID)
+		assert.Equal(t, "vim.fault.NotFound", taskErr.FaultType)
+	}
+	// The task error of an earlier operation is not kept for the next one.
+	resetCnsTaskError(ctx)
+	assert.Nil(t, LastCnsTaskError(ctx))
+	resetCnsTaskError(context.Background())
+}
+
+func TestStuckTask(t *testing.T) {
+	now := time.Now()
+	taskInfo := &vim25types.TaskInfo{
+		Task:      vim25types.ManagedObjectReference{Type: "Task", Value: "task-7"},
+		State:     vim25types.TaskInfoStateRunning,
+		QueueTime: now.Add(-time.Hour),
+	}
+	assert.True(t, isTaskStuck(taskInfo, 30*time.Minute, now))
+	assert.False(t, isTaskStuck(taskInfo, 2*time.Hour, now))
+	taskInfo.State = vim25types.TaskInfoStateSuccess
+	assert.False(t, isTaskStuck(taskInfo, 30*time.Minute, now))
+
+	ctx := ContextWithCnsTaskErrorRecorder(context.Background())
+	err := newCnsTaskError(ctx, &stuckTaskError{taskID: "task-7", queueTime: taskInfo.QueueTime}, taskInfo, "", "")
+	assert.ErrorIs(t, err, ErrCnsTaskStuck)
+	assert.False(t, isStuckTaskCancelled(err))
+	assert.ErrorIs(t, LastCnsTaskError(ctx), ErrCnsTaskStuck)
+	err = newCnsTaskError(ctx, &stuckTaskError{taskID: "task-7", cancelled: true}, taskInfo, "", "")
+	assert.True(t, isStuckTaskCancelled(err))
+	assert.False(t, isStuckTaskCancelled(errors.New("task failed")))
+}
+
+func TestTaskPolling(t *testing.T) {
+	defer SetStuckTaskTimeout(context.Background(), defaultStuckTaskTimeout)
+	taskPollBackoffLock.RLock()
+	defaultBackoff := taskPollBackoff
+	taskPollBackoffLock.RUnlock()
+	defer func() {
+		taskPollBackoffLock.Lock()
+		taskPollBackoff = defaultBackoff
+		taskPollBackoffLock.Unlock()
+	}()
+	SetTaskPollBackoff(context.Background(), TaskPollBackoff{
+		InitialInterval: 10 * time.Millisecond,
+		MaxInterval:     20 * time.Millisecond,
+	})
+
+	simulator.Test(func(ctx context.Context, c *vim25.Client) {
+		m := &defaultManager{virtualCenter: &cnsvsphere.VirtualCenter{Client: &govmomi.Client{Client: c}}}
+		vm, err := find.NewFinder(c).VirtualMachine(ctx, "DC0_H0_VM0")
+		if !assert.NoError(t, err) {
+			return
+		}
+		task, err := vm.PowerOff(ctx)
+		if !assert.NoError(t, err) {
+			return
+		}
+		taskInfo, err := m.waitOnVimTask(ctx, task.Reference())
+		assert.NoError(t, err)
+		if assert.NotNil(t, taskInfo) {
+			assert.Equal(t, vim25types.TaskInfoStateSuccess, taskInfo.State)
+		}
+		// vCenter is not polled for the result of a CNS task before the stuck
+		// task timeout has elapsed.
+		SetStuckTaskTimeout(ctx, -1)
+		waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		_, err = m.waitForResultOrStuck(waitCtx, task.Reference(), make(chan TaskResult))
+		cancel()
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		// The result of a CNS task is picked up once the stuck task timeout has
+		// elapsed, even if the list view does not deliver it.
+		SetStuckTaskTimeout(ctx, 10*time.Millisecond)
+		taskInfo, err = m.waitForResultOrStuck(ctx, task.Reference(), make(chan TaskResult))
+		assert.NoError(t, err)
+		if assert.NotNil(t, taskInfo) {
+			assert.Equal(t, task.Reference(), taskInfo.Task)
+		}
+
+		// Powering off a VM which is already powered off fails.
+		task, err = vm.PowerOff(ctx)
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = m.waitOnVimTask(ctx, task.Reference())
+		assert.Error(t, err)
+		_, err = m.waitForResultOrStuck(ctx, task.Reference(), make(chan TaskResult))
+		assert.True(t, soap.IsVimFault(err))
+	})
+
+	// The polling stops once the context is done.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	backoff := newTaskPollBackoff()
+	err := waitForNextTaskPoll(ctx, &backoff, vim25types.ManagedObjectReference{Type: "Task", Value: "task-1"})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestSlowOperationTaskIDs(t *testing.T) {
+	assert.Nil(t, GetCnsTaskIDs(context.Background()))
+	addCnsTaskID(context.Background(), "task-1")
+
+	ctx := ContextWithCnsTaskIDs(context.Background())
+	addCnsTaskID(ctx, "task-1")
+	addCnsTaskID(ctx, "task-2")
+	assert.Equal(t, []string{"task-1", "task-2"}, GetCnsTaskIDs(ctx))
+
+	taskInfo := &vim25types.TaskInfo{
+		Result: cnstypes.CnsVolumeOperationBatchResult{
+			VolumeResults: []cnstypes.BaseCnsVolumeOperationResult{
+				&cnstypes.CnsVolumeOperationResult{VolumeId: cnstypes.CnsVolumeId{Id: "vol-1"}},
+			},
+		},
+	}
+	assert.Equal(t, "vol-1", getTaskVolumeID(taskInfo))
+	assert.Equal(t, "", getTaskVolumeID(&vim25types.TaskInfo{}))
+}
+
+func TestClusterDistributionFallback(t *testing.T) {
+	ctx := context.Background()
+	assert.True(t, isClusterDistributionFault(&vim25types.LocalizedMethodFault{
+		Fault: &vim25types.InvalidArgument{InvalidProperty: "containerCluster.clusterDistribution"},
+	}))
+	assert.False(t, isClusterDistributionFault(&vim25types.LocalizedMethodFault{
+		Fault: &vim25types.InvalidArgument{InvalidProperty: "capacityInMb"},
+	}))
+	assert.False(t, isClusterDistributionFault(nil))
+
+	spec := &cnstypes.CnsVolumeCreateSpec{
+		Metadata: cnstypes.CnsVolumeMetadata{
+			ContainerCluster:      cnstypes.CnsContainerCluster{ClusterDistribution: "Acme"},
+			ContainerClusterArray: []cnstypes.CnsContainerCluster{{ClusterDistribution: "Acme"}},
+		},
+	}
+	assert.False(t, fallBackFromRejectedClusterDistribution(ctx, spec))
+	assert.Equal(t, "Acme", spec.Metadata.ContainerCluster.ClusterDistribution)
+	recordRejectedClusterDistribution(ctx, spec)
+	defer rejectedClusterDistributions.Delete("Acme")
+	assert.True(t, fallBackFromRejectedClusterDistribution(ctx, spec))
+	assert.Equal(t, "", spec.Metadata.ContainerCluster.ClusterDistribution)
+	assert.Equal(t, "", spec.Metadata.ContainerClusterArray[0].ClusterDistribution)
+}
+
+func TestGetSlowOperationThresholdFromEnv(t *testing.T) {
+	ctx := context.Background()
+	tests := map[string]time.Duration{
+		"":        defaultSlowOperationThreshold,
+		"30":      30 * time.Second,
+		"0":       0,
+		"-1":      defaultSlowOperationThreshold,
+		"invalid": defaultSlowOperationThreshold,
+	}
+	for value, expected := range tests {
+		t.Setenv(envSlowOperationThresholdSeconds, value)
+		assert.Equal(t, expected, GetSlowOperationThresholdFromEnv(ctx), "value %q", value)
+	}
+}
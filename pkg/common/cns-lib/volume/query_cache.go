@@ -0,0 +1,173 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	vim25types "github.com/vmware/govmomi/vim25/types"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+)
+
+// defaultQueryVolumeCacheTTL is the time for which a QueryVolume result is
+// cached unless overridden using SetQueryVolumeCacheTTL.
+const defaultQueryVolumeCacheTTL = 10 * time.Second
+
+var (
+	// queryVolumeCacheTTL is the TTL of QueryVolume results cached by the
+	// volume managers. A TTL of 0 disables the cache.
+	queryVolumeCacheTTL = defaultQueryVolumeCacheTTL
+	// queryVolumeCacheTTLLock is used to serialize access to queryVolumeCacheTTL.
+	queryVolumeCacheTTLLock sync.RWMutex
+)
+
+// SetQueryVolumeCacheTTL sets the time for which QueryVolume results for a
+// single volume are cached. A TTL of 0 disables the cache.
+func SetQueryVolumeCacheTTL(ctx context.Context, ttl time.Duration) {
+	log := logger.GetLogger(ctx)
+	queryVolumeCacheTTLLock.Lock()
+	defer queryVolumeCacheTTLLock.Unlock()
+	if ttl < 0 {
+		ttl = 0
+	}
+	queryVolumeCacheTTL = ttl
+	log.Infof("QueryVolume cache TTL set to %v", queryVolumeCacheTTL)
+}
+
+// SetQueryVolumeCacheConfig sets the TTL of the QueryVolume cache as per the
+// driver configuration, in which the cache can also be disabled.
+func SetQueryVolumeCacheConfig(ctx context.Context, ttlInSec int, disabled bool) {
+	ttl := time.Duration(ttlInSec) * time.Second
+	if disabled {
+		ttl = 0
+	}
+	SetQueryVolumeCacheTTL(ctx, ttl)
+}
+
+func getQueryVolumeCacheTTL() time.Duration {
+	queryVolumeCacheTTLLock.RLock()
+	defer queryVolumeCacheTTLLock.RUnlock()
+	return queryVolumeCacheTTL
+}
+
+type queryVolumeCacheEntry struct {
+	result    *cnstypes.CnsQueryResult
+	timestamp time.Time
+}
+
+// queryVolumeCache caches QueryVolume results keyed by volume ID, so that
+// repeated queries for the same volume, e.g. during attach retries, do not
+// all go to vCenter. Entries are invalidated by every operation which
+// changes the volume.
+type queryVolumeCache struct {
+	mu      sync.Mutex
+	entries map[string]queryVolumeCacheEntry
+	// generation is incremented by every invalidation, so that a result
+	// queried before a volume was changed is not cached once the change
+	// has invalidated the cache.
+	generation uint64
+}
+
+func newQueryVolumeCache() *queryVolumeCache {
+	return &queryVolumeCache{
+		entries: make(map[string]queryVolumeCacheEntry),
+	}
+}
+
+// cacheKey returns the volume ID the given filter queries, if the filter
+// selects a single volume by ID and nothing else.
+func (c *queryVolumeCache) cacheKey(queryFilter cnstypes.CnsQueryFilter) (string, bool) {
+	if c == nil || len(queryFilter.VolumeIds) != 1 || getQueryVolumeCacheTTL() == 0 {
+		return "", false
+	}
+	if !reflect.DeepEqual(queryFilter, cnstypes.CnsQueryFilter{VolumeIds: queryFilter.VolumeIds}) {
+		return "", false
+	}
+	return queryFilter.VolumeIds[0].Id, true
+}
+
+// get returns a copy of the cached result for the volume if it has not
+// expired.
+func (c *queryVolumeCache) get(volumeID string) (*cnstypes.CnsQueryResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[volumeID]
+	if !ok {
+		return nil, false
+	}
+	if time.Since(entry.timestamp) > getQueryVolumeCacheTTL() {
+		delete(c.entries, volumeID)
+		return nil, false
+	}
+	result := copyQueryResult(entry.result)
+	return result, result != nil
+}
+
+// getGeneration returns the generation of the cache, to be passed to set for
+// the result of a query started afterwards.
+func (c *queryVolumeCache) getGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// set caches the result for the volume, unless the cache has been invalidated
+// since the given generation, i.e. while the result was being queried.
+func (c *queryVolumeCache) set(volumeID string, result *cnstypes.CnsQueryResult, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	resultCopy := copyQueryResult(result)
+	if resultCopy == nil {
+		return
+	}
+	c.entries[volumeID] = queryVolumeCacheEntry{
+		result:    resultCopy,
+		timestamp: time.Now(),
+	}
+}
+
+// invalidate removes the cached results for the given volumes.
+func (c *queryVolumeCache) invalidate(volumeIDs ...string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for _, volumeID := range volumeIDs {
+		delete(c.entries, volumeID)
+	}
+}
+
+// copyQueryResult returns a deep copy of the result so that callers modifying
+// the returned volumes, including their metadata and backing details, do not
+// change the cached entry. Nil is returned if the result cannot be copied.
+func copyQueryResult(result *cnstypes.CnsQueryResult) *cnstypes.CnsQueryResult {
+	resultCopy, err := vim25types.DeepCopy(*result)
+	if err != nil {
+		return nil
+	}
+	return &resultCopy
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	vim25types "github.com/vmware/govmomi/vim25/types"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+)
+
+const (
+	// envSlowOperationThresholdSeconds is the env variable to set the time in
+	// seconds above which CSI requests and CNS tasks are logged as slow. 0
+	// disables the logging of slow operations.
+	envSlowOperationThresholdSeconds = "SLOW_OPERATION_THRESHOLD_SECONDS"
+	// defaultSlowOperationThreshold is the default time above which CSI
+	// requests and CNS tasks are logged as slow.
+	defaultSlowOperationThreshold = 60 * time.Second
+)
+
+var (
+	// slowOperationThreshold is the duration above which CSI requests and CNS
+	// tasks are logged as slow. Slow operations are not logged if it is zero.
+	slowOperationThreshold time.Duration
+	// slowOperationThresholdLock is used to serialize access to
+	// slowOperationThreshold.
+	slowOperationThresholdLock sync.RWMutex
+)
+
+// SetSlowOperationThreshold sets the duration above which CSI requests and
+// CNS tasks are logged as slow, at warning level. Slow operations are not
+// logged if the threshold is not positive.
+func SetSlowOperationThreshold(ctx context.Context, threshold time.Duration) {
+	log := logger.GetLogger(ctx)
+	slowOperationThresholdLock.Lock()
+	defer slowOperationThresholdLock.Unlock()
+	slowOperationThreshold = max(threshold, 0)
+	if slowOperationThreshold == 0 {
+		log.Infof("Logging of slow operations is disabled")
+		return
+	}
+	log.Infof("Operations taking longer than %v are logged as slow", slowOperationThreshold)
+}
+
+// GetSlowOperationThresholdFromEnv returns the time above which operations
+// are logged as slow, as set by the SLOW_OPERATION_THRESHOLD_SECONDS env
+// variable, 0 disabling the logging of slow operations.
+func GetSlowOperationThresholdFromEnv(ctx context.Context) time.Duration {
+	log := logger.GetLogger(ctx)
+	if v := os.Getenv(envSlowOperationThresholdSeconds); v != "" {
+		if value, err := strconv.Atoi(v); err == nil && value >= 0 {
+			return time.Duration(value) * time.Second
+		}
+		log.Warnf("Invalid value %q for %s, using the default slow operation threshold of %v",
+			v, envSlowOperationThresholdSeconds, defaultSlowOperationThreshold)
+	}
+	return defaultSlowOperationThreshold
+}
+
+// GetSlowOperationThreshold returns the duration above which operations are
+// logged as slow, or zero if slow operations are not logged.
+func GetSlowOperationThreshold() time.Duration {
+	slowOperationThresholdLock.RLock()
+	defer slowOperationThresholdLock.RUnlock()
+	return slowOperationThreshold
+}
+
+// cnsTaskIDsKey is the context key of the IDs of the CNS tasks waited on for
+// a request.
+type cnsTaskIDsKey struct{}
+
+// cnsTaskIDs holds the IDs of the CNS tasks waited on for a request.
+type cnsTaskIDs struct {
+	mux sync.Mutex
+	ids []string
+}
+
+// ContextWithCnsTaskIDs returns a child context recording the IDs of the CNS
+// tasks waited on by the volume manager, so that they can be retrieved using
+// GetCnsTaskIDs, e.g. to correlate a slow request with its tasks in vCenter.
+func ContextWithCnsTaskIDs(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cnsTaskIDsKey{}, &cnsTaskIDs{})
+}
+
+// GetCnsTaskIDs returns the IDs of the CNS tasks recorded in ctx.
+func GetCnsTaskIDs(ctx context.Context) []string {
+	taskIDs, ok := ctx.Value(cnsTaskIDsKey{}).(*cnsTaskIDs)
+	if !ok {
+		return nil
+	}
+	taskIDs.mux.Lock()
+	defer taskIDs.mux.Unlock()
+	return append([]string(nil), taskIDs.ids...)
+}
+
+// addCnsTaskID records the ID of the CNS task in ctx.
+func addCnsTaskID(ctx context.Context, taskID string) {
+	taskIDs, ok := ctx.Value(cnsTaskIDsKey{}).(*cnsTaskIDs)
+	if !ok {
+		return
+	}
+	taskIDs.mux.Lock()
+	defer taskIDs.mux.Unlock()
+	taskIDs.ids = append(taskIDs.ids, taskID)
+}
+
+// logSlowCnsTask logs the CNS task at warning level if it was waited on for
+// longer than the slow operation threshold.
+func logSlowCnsTask(ctx context.Context, taskMoRef vim25types.ManagedObjectReference,
+	taskInfo *vim25types.TaskInfo, elapsed time.Duration) {
+	threshold := GetSlowOperationThreshold()
+	if threshold == 0 || elapsed < threshold {
+		return
+	}
+	log := logger.GetLogger(ctx)
+	operation, volumeID := "unknown", ""
+	if taskInfo != nil {
+		operation = taskInfo.DescriptionId
+		volumeID = getTaskVolumeID(taskInfo)
+	}
+	log.Warnf("Slow operation: CNS task %q (%s) for volume %q took %v, above the threshold of %v",
+		taskMoRef.Value, operation, volumeID, elapsed.Round(time.Millisecond), threshold)
+}
+
+// getTaskVolumeID returns the ID of the volume of the first result of the CNS
+// task, or an empty string if the task has no volume result.
+func getTaskVolumeID(taskInfo *vim25types.TaskInfo) string {
+	batchResult, ok := taskInfo.Result.(cnstypes.CnsVolumeOperationBatchResult)
+	if !ok || len(batchResult.VolumeResults) == 0 || batchResult.VolumeResults[0] == nil {
+		return ""
+	}
+	return batchResult.VolumeResults[0].GetCnsVolumeOperationResult().VolumeId.Id
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/soap"
+	vim25types "github.com/vmware/govmomi/vim25/types"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/prometheus"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+)
+
+// ErrCnsTaskStuck is returned by the volume manager for a CNS task which has
+// not reached a terminal state within the stuck task timeout. The operation
+// is expected to be retried.
+var ErrCnsTaskStuck = errors.New("CNS task is stuck")
+
+const (
+	// defaultStuckTaskTimeout is the time after which a CNS task which is still
+	// queued or running is considered abandoned, unless overridden using
+	// SetStuckTaskTimeout.
+	defaultStuckTaskTimeout = 30 * time.Minute
+)
+
+var (
+	stuckTaskTimeout = defaultStuckTaskTimeout
+	// stuckTaskTimeoutLock is used to serialize access to stuckTaskTimeout.
+	stuckTaskTimeoutLock sync.RWMutex
+)
+
+// SetStuckTaskTimeout sets the time after which a CNS task which is still
+// queued or running is considered abandoned. The watchdog is disabled if the
+// timeout is negative.
+func SetStuckTaskTimeout(ctx context.Context, timeout time.Duration) {
+	log := logger.GetLogger(ctx)
+	stuckTaskTimeoutLock.Lock()
+	defer stuckTaskTimeoutLock.Unlock()
+	if timeout == 0 {
+		return
+	}
+	stuckTaskTimeout = timeout
+	if timeout < 0 {
+		log.Infof("Stuck CNS task watchdog is disabled")
+		return
+	}
+	log.Infof("CNS tasks not completed %v after being queued are considered stuck", stuckTaskTimeout)
+}
+
+func getStuckTaskTimeout() time.Duration {
+	stuckTaskTimeoutLock.RLock()
+	defer stuckTaskTimeoutLock.RUnlock()
+	return stuckTaskTimeout
+}
+
+// stuckTaskError is the error returned for a CNS task considered abandoned.
+// It matches ErrCnsTaskStuck using errors.Is.
+type stuckTaskError struct {
+	taskID    string
+	queueTime time.Time
+	// cancelled is true if the task was cancelled, i.e. the task will not
+	// complete the operation once the error has been returned.
+	cancelled bool
+}
+
+func (e *stuckTaskError) Error() string {
+	msg := fmt.Sprintf("%v: task %s queued at %v has not completed", ErrCnsTaskStuck, e.taskID,
+		e.queueTime.UTC().Format(time.RFC3339))
+	if e.cancelled {
+		msg += ", task cancelled"
+	}
+	return msg
+}
+
+func (e *stuckTaskError) Is(target error) bool {
+	return target == ErrCnsTaskStuck
+}
+
+// isStuckTaskCancelled returns true if err is returned for a stuck CNS task
+// which has been cancelled.
+func isStuckTaskCancelled(err error) bool {
+	var stuckErr *stuckTaskError
+	return errors.As(err, &stuckErr) && stuckErr.cancelled
+}
+
+// isTaskStuck returns true if the task is still queued or running timeout
+// after it was queued.
+func isTaskStuck(taskInfo *vim25types.TaskInfo, timeout time.Duration, now time.Time) bool {
+	if taskInfo.State != vim25types.TaskInfoStateQueued && taskInfo.State != vim25types.TaskInfoStateRunning {
+		return false
+	}
+	return now.Sub(taskInfo.QueueTime) >= timeout
+}
+
+// waitForResultOrStuck waits for the result of the task delivered by the list
+// view like waitForResultOrTimeout. Once the stuck task timeout has elapsed,
+// the status of the task is retrieved from vCenter: the result of a task which
+// has completed meanwhile is returned, while a task which is still queued or
+// running that long after it was queued is considered abandoned. An abandoned
+// task is cancelled if possible, and an error matching ErrCnsTaskStuck is
+// returned, so that the operation is retried.
+func (m *defaultManager) waitForResultOrStuck(ctx context.Context, taskMoRef vim25types.ManagedObjectReference,
+	ch chan TaskResult) (*vim25types.TaskInfo, error) {
+	log := logger.GetLogger(ctx)
+	timeout := getStuckTaskTimeout()
+	var timer *time.Timer
+	var stuckCheck <-chan time.Time
+	if timeout >= 0 {
+		timer = time.NewTimer(timeout)
+		defer timer.Stop()
+		stuckCheck = timer.C
+	}
+	backoff := newTaskPollBackoff()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("stopped waiting for task %v before response from CNS: %w", taskMoRef,
+				ctx.Err())
+		case result := <-ch:
+			return result.TaskInfo, result.Err
+		case <-stuckCheck:
+			var task mo.Task
+			err := property.DefaultCollector(m.virtualCenter.Client.Client).RetrieveOne(ctx, taskMoRef,
+				[]string{"info"}, &task)
+			if err != nil {
+				log.Warnf("failed to retrieve status of task %v. err: %v", taskMoRef, err)
+				timer.Reset(backoff.Step())
+				continue
+			}
+			switch task.Info.State {
+			case vim25types.TaskInfoStateSuccess:
+				return &task.Info, nil
+			case vim25types.TaskInfoStateError:
+				if task.Info.Error == nil {
+					return nil, fmt.Errorf("task %v failed", taskMoRef)
+				}
+				return nil, soap.WrapVimFault(task.Info.Error.Fault)
+			}
+			now := time.Now()
+			if isTaskStuck(&task.Info, timeout, now) {
+				return nil, m.recoverStuckTask(ctx, &task.Info)
+			}
+			// The task was queued later than it was submitted, check it again
+			// once the timeout has elapsed since it was queued.
+			timer.Reset(task.Info.QueueTime.Add(timeout).Sub(now))
+		}
+	}
+}
+
+// recoverStuckTask cancels the stuck task if possible and returns the error
+// to be returned for it.
+func (m *defaultManager) recoverStuckTask(ctx context.Context, taskInfo *vim25types.TaskInfo) error {
+	log := logger.GetLogger(ctx)
+	log.Errorf("task %s (%s, opId: %s) queued at %v is still %s. Considering it as stuck.",
+		taskInfo.Task.Value, taskInfo.DescriptionId, taskInfo.ActivationId, taskInfo.QueueTime, taskInfo.State)
+	prometheus.CnsStuckTaskCount.WithLabelValues(taskInfo.DescriptionId).Inc()
+	stuckErr := &stuckTaskError{
+		taskID:    taskInfo.Task.Value,
+		queueTime: taskInfo.QueueTime,
+	}
+	if taskInfo.Cancelable {
+		err := object.NewTask(m.virtualCenter.Client.Client, taskInfo.Task).Cancel(ctx)
+		if err != nil {
+			log.Errorf("failed to cancel stuck task %s. err: %v", taskInfo.Task.Value, err)
+		} else {
+			stuckErr.cancelled = true
+		}
+	}
+	return newCnsTaskError(ctx, stuckErr, taskInfo, "", "")
+}
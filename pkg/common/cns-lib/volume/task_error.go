@@ -0,0 +1,127 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	vim25types "github.com/vmware/govmomi/vim25/types"
+)
+
+// CnsTaskError is the error returned by the volume manager for a CNS task
+// which failed. Besides the underlying error, it carries the references
+// needed to look the task up in vCenter.
+type CnsTaskError struct {
+	// TaskID is the ID of the CNS task, e.g. "task-1234".
+	TaskID string
+	// OpID is the activation ID of the CNS task.
+	OpID string
+	// VolumeID is the ID of the volume the task operated on, if known.
+	VolumeID string
+	// FaultType is the fault type of the task, e.g. "vim.fault.NotFound".
+	FaultType string
+	// Err is the underlying error.
+	Err error
+}
+
+// Error returns the message of the underlying error followed by the
+// references of the CNS task.
+func (e *CnsTaskError) Error() string {
+	refs := []string{"CNS task: " + e.TaskID}
+	if e.OpID != "" {
+		refs = append(refs, "opId: "+e.OpID)
+	}
+	if e.VolumeID != "" {
+		refs = append(refs, "volumeID: "+e.VolumeID)
+	}
+	if e.FaultType != "" {
+		refs = append(refs, "fault: "+e.FaultType)
+	}
+	return fmt.Sprintf("%v [%s]", e.Err, strings.Join(refs, ", "))
+}
+
+// Unwrap returns the underlying error.
+func (e *CnsTaskError) Unwrap() error {
+	return e.Err
+}
+
+// cnsTaskErrorRecorderKey is the context key of the cnsTaskErrorRecorder.
+type cnsTaskErrorRecorderKey struct{}
+
+// cnsTaskErrorRecorder holds the CNS task error of the last volume manager
+// operation of a request.
+type cnsTaskErrorRecorder struct {
+	mux     sync.Mutex
+	taskErr *CnsTaskError
+}
+
+// ContextWithCnsTaskErrorRecorder returns a child context recording the CNS
+// task errors returned by the volume manager, so that they can be retrieved
+// using LastCnsTaskError even if the error has been converted, e.g. into a
+// gRPC status, on its way up.
+func ContextWithCnsTaskErrorRecorder(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cnsTaskErrorRecorderKey{}, &cnsTaskErrorRecorder{})
+}
+
+// LastCnsTaskError returns the last CNS task error recorded in ctx, or nil if
+// none was recorded.
+func LastCnsTaskError(ctx context.Context) *CnsTaskError {
+	recorder, ok := ctx.Value(cnsTaskErrorRecorderKey{}).(*cnsTaskErrorRecorder)
+	if !ok {
+		return nil
+	}
+	recorder.mux.Lock()
+	defer recorder.mux.Unlock()
+	return recorder.taskErr
+}
+
+// resetCnsTaskError clears the CNS task error recorded in ctx, if any. It is
+// called at the start of each volume manager operation, so that the task error
+// of an earlier operation of the request is not attached to a later failure
+// unrelated to it.
+func resetCnsTaskError(ctx context.Context) {
+	if recorder, ok := ctx.Value(cnsTaskErrorRecorderKey{}).(*cnsTaskErrorRecorder); ok {
+		recorder.mux.Lock()
+		recorder.taskErr = nil
+		recorder.mux.Unlock()
+	}
+}
+
+// newCnsTaskError attaches the references of the CNS task to err, and records
+// the resulting error in ctx. It returns nil if err is nil.
+func newCnsTaskError(ctx context.Context, err error, taskInfo *vim25types.TaskInfo, volumeID string,
+	faultType string) error {
+	if err == nil || taskInfo == nil {
+		return err
+	}
+	taskErr := &CnsTaskError{
+		TaskID:    taskInfo.Task.Value,
+		OpID:      taskInfo.ActivationId,
+		VolumeID:  volumeID,
+		FaultType: faultType,
+		Err:       err,
+	}
+	if recorder, ok := ctx.Value(cnsTaskErrorRecorderKey{}).(*cnsTaskErrorRecorder); ok {
+		recorder.mux.Lock()
+		recorder.taskErr = taskErr
+		recorder.mux.Unlock()
+	}
+	return taskErr
+}
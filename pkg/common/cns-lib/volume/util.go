@@ -19,8 +19,10 @@ package volume
 import (
 	"context"
 	"errors"
+	"fmt"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	uuidlib "github.com/google/uuid"
@@ -34,6 +36,7 @@ import (
 
 	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/vsphere"
 	csifault "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/fault"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/prometheus"
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
 )
 
@@ -294,6 +297,11 @@ func validateCreateVolumeResponseFault(ctx context.Context, name string,
 		}, nil
 	}
 
+	if isClusterDistributionFault(resp.Fault) {
+		log.Errorf("failed to create volume with fault: %q", spew.Sdump(resp.Fault))
+		return nil, fmt.Errorf("%w: failed to create volume with fault: %s", ErrClusterDistributionRejected,
+			resp.Fault.LocalizedMessage)
+	}
 	return nil, logger.LogNewErrorf(log, "failed to create volume with fault: %q", spew.Sdump(resp.Fault))
 
 }
@@ -386,6 +394,13 @@ func ExtractFaultTypeFromVolumeResponseResult(ctx context.Context,
 	return ""
 }
 
+// GetCnsSnapshotDescription returns the description of the CNS snapshot
+// created for the CSI snapshot snapshotName of the volume volumeID, which is
+// also the name of the CnsVolumeOperationRequest of its creation.
+func GetCnsSnapshotDescription(snapshotName string, volumeID string) string {
+	return snapshotName + "-" + volumeID
+}
+
 // invokeCNSCreateSnapshot invokes CreateSnapshot operation for that volume on CNS.
 func invokeCNSCreateSnapshot(ctx context.Context, virtualCenter *cnsvsphere.VirtualCenter,
 	volumeID string, snapshotName string) (*object.Task, error) {
@@ -512,6 +527,35 @@ func validateSnapshotDeleted(ctx context.Context, m *defaultManager, volumeID st
 	return cnsvsphere.IsCnsSnapshotNotFoundError(soap.WrapVimFault(faultInQuerySnapshotResult))
 }
 
+// checkSnapshotAlreadyDeleted queries CNS to find out whether a snapshot
+// which could not be found during DeleteSnapshot was already deleted. It
+// returns nil if the volume exists but the snapshot does not, and an error
+// wrapping ErrSnapshotVolumeNotFound if the volume of the snapshot does not
+// exist either.
+func checkSnapshotAlreadyDeleted(ctx context.Context, m *defaultManager, volumeID string, snapshotID string) error {
+	snapshotQueryFilter := cnstypes.CnsSnapshotQueryFilter{
+		SnapshotQuerySpecs: []cnstypes.CnsSnapshotQuerySpec{
+			{VolumeId: cnstypes.CnsVolumeId{Id: volumeID}, SnapshotId: &cnstypes.CnsSnapshotId{Id: snapshotID}},
+		},
+		Cursor: &cnstypes.CnsCursor{Offset: 0, Limit: 1},
+	}
+	querySnapshotResult, err := m.QuerySnapshots(ctx, snapshotQueryFilter)
+	if err != nil {
+		return fmt.Errorf("failed to query snapshot %q on volume %q. Err: %v", snapshotID, volumeID, err)
+	}
+	if len(querySnapshotResult.Entries) == 0 || querySnapshotResult.Entries[0].Error == nil {
+		return fmt.Errorf("snapshot %q on volume %q still exists", snapshotID, volumeID)
+	}
+	fault := soap.WrapVimFault(querySnapshotResult.Entries[0].Error.Fault)
+	if cnsvsphere.IsCnsSnapshotNotFoundError(fault) {
+		return nil
+	}
+	if cnsvsphere.IsCnsVolumeNotFoundError(fault) {
+		return fmt.Errorf("%w: volume %q of snapshot %q", ErrSnapshotVolumeNotFound, volumeID, snapshotID)
+	}
+	return fmt.Errorf("failed to query snapshot %q on volume %q. fault: %v", snapshotID, volumeID, fault)
+}
+
 func queryCreatedSnapshotByName(ctx context.Context, m *defaultManager, volumeID string,
 	snapshotName string) (*cnstypes.CnsSnapshot, bool) {
 	log := logger.GetLogger(ctx)
@@ -557,3 +601,34 @@ func IsNotFoundFault(ctx context.Context, faultType string) bool {
 	return faultType == "vim.fault.NotFound"
 
 }
+
+// observeCnsTaskLatency records the time taken by a CNS task in CnsTaskLatencyHistVec.
+// taskErr is the error returned for the operation once the result of the task,
+// including the fault of the volume operation, has been inspected. Tasks which
+// failed, timed out or completed with a fault are recorded with the "error" result.
+func observeCnsTaskLatency(opType string, datastore string, storagePolicy string, latency time.Duration,
+	taskErr error) {
+	result := prometheus.PrometheusSuccessResult
+	if taskErr != nil {
+		result = prometheus.PrometheusErrorResult
+	}
+	prometheus.CnsTaskLatencyHistVec.WithLabelValues(opType, datastore, storagePolicy,
+		result).Observe(latency.Seconds())
+}
+
+// getCnsTaskLabelsFromCreateSpec returns the datastore and storage policy labels
+// for CnsTaskLatencyHistVec from the given CreateVolume spec. Datastore label is
+// only set when a single datastore is specified in the spec.
+func getCnsTaskLabelsFromCreateSpec(spec *cnstypes.CnsVolumeCreateSpec) (string, string) {
+	var datastore, storagePolicy string
+	if len(spec.Datastores) == 1 {
+		datastore = spec.Datastores[0].Value
+	}
+	for _, profile := range spec.Profile {
+		if profileSpec, ok := profile.(*types.VirtualMachineDefinedProfileSpec); ok {
+			storagePolicy = profileSpec.ProfileId
+			break
+		}
+	}
+	return datastore, storagePolicy
+}
@@ -32,7 +32,8 @@ func NewCnsClient(ctx context.Context, c *vim25.Client) (*cns.Client, error) {
 		log.Errorf("failed to create a new client for CNS. err: %v", err)
 		return nil, err
 	}
-	cnsClient.RoundTripper = &MetricRoundTripper{"cns", cnsClient.RoundTripper}
+	cnsClient.RoundTripper = newServiceSessionRetryRoundTripper(c, cnsClient.Client,
+		&MetricRoundTripper{"cns", &apiCallRoundTripper{"cns", cnsClient.RoundTripper}})
 
 	return cnsClient, nil
 }
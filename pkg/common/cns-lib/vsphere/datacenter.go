@@ -85,6 +85,54 @@ func (dc *Datacenter) GetDatastoreInfoByURL(ctx context.Context, datastoreURL st
 	return nil, err
 }
 
+// GetStoragePodByName returns the datastore cluster with the given name or
+// inventory path in the datacenter. A *find.NotFoundError is returned if the
+// datacenter has no such datastore cluster.
+func (dc *Datacenter) GetStoragePodByName(ctx context.Context, name string) (*mo.StoragePod, error) {
+	log := logger.GetLogger(ctx)
+	finder := find.NewFinder(dc.Datacenter.Client(), false)
+	finder.SetDatacenter(dc.Datacenter)
+	storagePod, err := finder.DatastoreCluster(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	var storagePodMo mo.StoragePod
+	pc := property.DefaultCollector(dc.Client())
+	properties := []string{"name", "childEntity", "podStorageDrsEntry"}
+	err = pc.RetrieveOne(ctx, storagePod.Reference(), properties, &storagePodMo)
+	if err != nil {
+		log.Errorf("failed to get StoragePod managed object of datastore cluster %q. properties: %+v, err: %v",
+			name, properties, err)
+		return nil, err
+	}
+	return &storagePodMo, nil
+}
+
+// GetDatastoreInfoByName returns the DatastoreInfo of the datastore with the
+// given name in the datacenter. A *find.NotFoundError is returned if the
+// datacenter has no such datastore.
+func (dc *Datacenter) GetDatastoreInfoByName(ctx context.Context, name string) (*DatastoreInfo, error) {
+	log := logger.GetLogger(ctx)
+	finder := find.NewFinder(dc.Datacenter.Client(), false)
+	finder.SetDatacenter(dc.Datacenter)
+	datastore, err := finder.Datastore(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	var dsMo mo.Datastore
+	pc := property.DefaultCollector(dc.Client())
+	properties := []string{DatastoreInfoProperty, "customValue"}
+	err = pc.RetrieveOne(ctx, datastore.Reference(), properties, &dsMo)
+	if err != nil {
+		log.Errorf("failed to get Datastore managed object of datastore %q. properties: %+v, err: %v",
+			name, properties, err)
+		return nil, err
+	}
+	return &DatastoreInfo{
+		&Datastore{object.NewDatastore(dc.Client(), dsMo.Reference()), dc},
+		dsMo.Info.GetDatastoreInfo(), dsMo.CustomValue}, nil
+}
+
 // GetVirtualMachineByUUID returns the VirtualMachine instance given its UUID
 // in a datacenter.
 // If instanceUUID is set to true, then UUID is an instance UUID.
@@ -99,7 +147,12 @@ func (dc *Datacenter) GetVirtualMachineByUUID(ctx context.Context,
 	log := logger.GetLogger(ctx)
 	uuid = strings.ToLower(strings.TrimSpace(uuid))
 	searchIndex := object.NewSearchIndex(dc.Datacenter.Client())
-	svm, err := searchIndex.FindByUuid(ctx, dc.Datacenter, uuid, true, &instanceUUID)
+	var svm object.Reference
+	err := callInventory(ctx, dc.VirtualCenterHost, func(ctx context.Context) error {
+		var err error
+		svm, err = searchIndex.FindByUuid(ctx, dc.Datacenter, uuid, true, &instanceUUID)
+		return err
+	})
 	if err != nil {
 		log.Errorf("couldn't find VM for the given uuid %s. Either VM is not present in the VC "+
 			"or the CSI storage user does not have privileges. err: %v", uuid, err)
@@ -195,7 +248,9 @@ func (dc *Datacenter) GetVMMoList(ctx context.Context, vmObjList []*VirtualMachi
 		vmRefs = append(vmRefs, vmObj.Reference())
 	}
 	pc := property.DefaultCollector(dc.Client())
-	err := pc.Retrieve(ctx, vmRefs, properties, &vmMoList)
+	err := callInventory(ctx, dc.VirtualCenterHost, func(ctx context.Context) error {
+		return pc.Retrieve(ctx, vmRefs, properties, &vmMoList)
+	})
 	if err != nil {
 		log.Errorf("failed to get VM managed objects from VM objects. vmObjList: %+v, properties: %+v, err: %v",
 			vmObjList, properties, err)
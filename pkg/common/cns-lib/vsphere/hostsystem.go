@@ -20,6 +20,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
 
@@ -91,6 +92,22 @@ func (host *HostSystem) GetHostVsanNodeUUID(ctx context.Context) (string, error)
 	return vsan.Config.ClusterInfo.NodeUuid, nil
 }
 
+// GetHostUUID gets the hardware UUID of this host. Unlike the moref of the
+// host, the UUID identifies the host across vCenters.
+func (host *HostSystem) GetHostUUID(ctx context.Context) (string, error) {
+	log := logger.GetLogger(ctx)
+	var hostMo mo.HostSystem
+	err := host.Properties(ctx, host.Reference(), []string{"summary.hardware"}, &hostMo)
+	if err != nil {
+		log.Errorf("Failed fetching 'summary.hardware' of host %v with err: %v", host, err)
+		return "", err
+	}
+	if hostMo.Summary.Hardware == nil || hostMo.Summary.Hardware.Uuid == "" {
+		return "", fmt.Errorf("hardware UUID of host %v is not set", host.Reference())
+	}
+	return hostMo.Summary.Hardware.Uuid, nil
+}
+
 // VsanHostCapacity captures the capacity info of a host. It exists to support
 // the API within this Go helper module.
 type VsanHostCapacity struct {
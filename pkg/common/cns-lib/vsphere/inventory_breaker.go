@@ -0,0 +1,146 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/prometheus"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+)
+
+// ErrVCenterInventoryUnavailable is returned by the vCenter inventory calls
+// which time out, or fail fast while the circuit breaker of the vCenter is open.
+var ErrVCenterInventoryUnavailable = errors.New("vCenter inventory is unavailable")
+
+const (
+	// defaultInventoryCallTimeout is the timeout of the vCenter inventory calls
+	// unless overridden using SetInventoryCallLimits.
+	defaultInventoryCallTimeout = 60 * time.Second
+	// defaultInventoryCircuitBreakerThreshold is the number of consecutive
+	// timeouts opening the circuit breaker unless overridden using
+	// SetInventoryCallLimits.
+	defaultInventoryCircuitBreakerThreshold = 5
+	// inventoryCircuitBreakerCooldown is the time for which inventory calls
+	// fail fast once the circuit breaker is open.
+	inventoryCircuitBreakerCooldown = 30 * time.Second
+)
+
+var (
+	inventoryCallTimeout             = defaultInventoryCallTimeout
+	inventoryCircuitBreakerThreshold = defaultInventoryCircuitBreakerThreshold
+	// inventoryCallLimitsLock is used to serialize access to the limits above.
+	inventoryCallLimitsLock sync.RWMutex
+	// inventoryBreakers holds the circuit breaker of each vCenter, keyed by host.
+	inventoryBreakers sync.Map
+)
+
+// SetInventoryCallLimits sets the timeout of the vCenter inventory calls, and
+// the number of consecutive timeouts after which the calls to the vCenter
+// fail fast for a cooldown period.
+func SetInventoryCallLimits(ctx context.Context, timeout time.Duration, threshold int) {
+	log := logger.GetLogger(ctx)
+	inventoryCallLimitsLock.Lock()
+	defer inventoryCallLimitsLock.Unlock()
+	if timeout > 0 {
+		inventoryCallTimeout = timeout
+	}
+	if threshold > 0 {
+		inventoryCircuitBreakerThreshold = threshold
+	}
+	log.Infof("vCenter inventory call timeout set to %v, circuit breaker opens after %d consecutive timeouts",
+		inventoryCallTimeout, inventoryCircuitBreakerThreshold)
+}
+
+func getInventoryCallLimits() (time.Duration, int) {
+	inventoryCallLimitsLock.RLock()
+	defer inventoryCallLimitsLock.RUnlock()
+	return inventoryCallTimeout, inventoryCircuitBreakerThreshold
+}
+
+// inventoryCircuitBreaker counts the consecutive timeouts of the inventory
+// calls to a vCenter. Once the threshold is reached, the breaker opens and
+// calls fail fast until the cooldown has elapsed. The next call is then let
+// through; the breaker closes if it does not time out, and opens again
+// otherwise.
+type inventoryCircuitBreaker struct {
+	mu                  sync.Mutex
+	vcHost              string
+	consecutiveTimeouts int
+	openUntil           time.Time
+}
+
+func getInventoryCircuitBreaker(vcHost string) *inventoryCircuitBreaker {
+	breaker, _ := inventoryBreakers.LoadOrStore(vcHost, &inventoryCircuitBreaker{vcHost: vcHost})
+	return breaker.(*inventoryCircuitBreaker)
+}
+
+// allow returns false while the breaker is open.
+func (b *inventoryCircuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !time.Now().Before(b.openUntil)
+}
+
+func (b *inventoryCircuitBreaker) recordTimeout(threshold int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.consecutiveTimeouts++
+	if b.consecutiveTimeouts >= threshold {
+		b.openUntil = time.Now().Add(inventoryCircuitBreakerCooldown)
+		prometheus.VCInventoryCircuitBreakerOpen.WithLabelValues(b.vcHost).Set(1)
+	}
+}
+
+func (b *inventoryCircuitBreaker) recordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.consecutiveTimeouts > 0 {
+		b.consecutiveTimeouts = 0
+		b.openUntil = time.Time{}
+		prometheus.VCInventoryCircuitBreakerOpen.WithLabelValues(b.vcHost).Set(0)
+	}
+}
+
+// callInventory runs the inventory call to the vCenter with the inventory
+// call timeout. ErrVCenterInventoryUnavailable is returned if the call times
+// out, or without making the call if the circuit breaker of the vCenter is
+// open.
+func callInventory(ctx context.Context, vcHost string, call func(ctx context.Context) error) error {
+	log := logger.GetLogger(ctx)
+	timeout, threshold := getInventoryCallLimits()
+	breaker := getInventoryCircuitBreaker(vcHost)
+	if !breaker.allow() {
+		return fmt.Errorf("%w: circuit breaker of vCenter %q is open after %d consecutive timeouts",
+			ErrVCenterInventoryUnavailable, vcHost, threshold)
+	}
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := call(callCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+		breaker.recordTimeout(threshold)
+		log.Errorf("vCenter %q inventory call timed out after %v. Err: %v", vcHost, timeout, err)
+		return fmt.Errorf("%w: call to vCenter %q timed out after %v", ErrVCenterInventoryUnavailable,
+			vcHost, timeout)
+	}
+	breaker.recordSuccess()
+	return err
+}
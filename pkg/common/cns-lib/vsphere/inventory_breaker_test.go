@@ -0,0 +1,50 @@
+package vsphere
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallInventoryCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	SetInventoryCallLimits(ctx, 10*time.Millisecond, 2)
+	defer SetInventoryCallLimits(ctx, defaultInventoryCallTimeout, defaultInventoryCircuitBreakerThreshold)
+	vcHost := "breaker-test-vc"
+	defer inventoryBreakers.Delete(vcHost)
+
+	slowCall := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	calls := 0
+	fastCall := func(ctx context.Context) error {
+		calls++
+		return nil
+	}
+
+	// Timeouts below the threshold keep the breaker closed.
+	err := callInventory(ctx, vcHost, slowCall)
+	assert.True(t, errors.Is(err, ErrVCenterInventoryUnavailable))
+	assert.NoError(t, callInventory(ctx, vcHost, fastCall))
+	assert.Equal(t, 1, calls)
+
+	// Consecutive timeouts reaching the threshold open the breaker, and calls
+	// then fail fast.
+	for range 2 {
+		err = callInventory(ctx, vcHost, slowCall)
+		assert.True(t, errors.Is(err, ErrVCenterInventoryUnavailable))
+	}
+	err = callInventory(ctx, vcHost, fastCall)
+	assert.True(t, errors.Is(err, ErrVCenterInventoryUnavailable))
+	assert.Equal(t, 1, calls)
+
+	// Once the cooldown has elapsed, a successful call closes the breaker.
+	getInventoryCircuitBreaker(vcHost).openUntil = time.Now()
+	assert.NoError(t, callInventory(ctx, vcHost, fastCall))
+	assert.NoError(t, callInventory(ctx, vcHost, fastCall))
+	assert.Equal(t, 3, calls)
+}
@@ -19,10 +19,12 @@ package vsphere
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/vmware/govmomi/pbm"
 	pbmmethods "github.com/vmware/govmomi/pbm/methods"
 	pbmtypes "github.com/vmware/govmomi/pbm/types"
+	"github.com/vmware/govmomi/vim25"
 	vimtypes "github.com/vmware/govmomi/vim25/types"
 
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
@@ -53,6 +55,17 @@ type SpbmPolicyContent struct {
 	Profiles []SpbmPolicySubProfile `json:"profiles"`
 }
 
+// NewPbmClient creates a new PBM client.
+func NewPbmClient(ctx context.Context, c *vim25.Client) (*pbm.Client, error) {
+	pbmClient, err := pbm.NewClient(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	pbmClient.RoundTripper = newServiceSessionRetryRoundTripper(c, pbmClient.Client,
+		&MetricRoundTripper{"pbm", &apiCallRoundTripper{"pbm", pbmClient.RoundTripper}})
+	return pbmClient, nil
+}
+
 // ConnectPbm creates a PBM client for the virtual center.
 func (vc *VirtualCenter) ConnectPbm(ctx context.Context) error {
 	log := logger.GetLogger(ctx)
@@ -62,7 +75,7 @@ func (vc *VirtualCenter) ConnectPbm(ctx context.Context) error {
 		return err
 	}
 	if vc.PbmClient == nil {
-		if vc.PbmClient, err = pbm.NewClient(ctx, vc.Client.Client); err != nil {
+		if vc.PbmClient, err = NewPbmClient(ctx, vc.Client.Client); err != nil {
 			log.Errorf("failed to create pbm client with err: %v", err)
 			return err
 		}
@@ -97,6 +110,37 @@ func (vc *VirtualCenter) GetStoragePolicyIDByName(ctx context.Context, storagePo
 	return storagePolicyID, nil
 }
 
+// GetStoragePolicyIDsByName returns the IDs of the storage policies, keyed by
+// their name.
+func (vc *VirtualCenter) GetStoragePolicyIDsByName(ctx context.Context) (map[string]string, error) {
+	log := logger.GetLogger(ctx)
+	err := vc.ConnectPbm(ctx)
+	if err != nil {
+		log.Errorf("Error occurred while connecting to PBM, err: %+v", err)
+		return nil, err
+	}
+	resourceType := pbmtypes.PbmProfileResourceType{
+		ResourceType: string(pbmtypes.PbmProfileResourceTypeEnumSTORAGE),
+	}
+	profileIDs, err := vc.PbmClient.QueryProfile(ctx, resourceType,
+		string(pbmtypes.PbmProfileCategoryEnumREQUIREMENT))
+	if err != nil {
+		log.Errorf("failed to query storage policies with err: %v", err)
+		return nil, err
+	}
+	profiles, err := vc.PbmClient.RetrieveContent(ctx, profileIDs)
+	if err != nil {
+		log.Errorf("failed to retrieve content of storage policies with err: %v", err)
+		return nil, err
+	}
+	storagePolicyIDs := make(map[string]string, len(profiles))
+	for _, profile := range profiles {
+		pbmProfile := profile.GetPbmProfile()
+		storagePolicyIDs[pbmProfile.Name] = pbmProfile.ProfileId.UniqueId
+	}
+	return storagePolicyIDs, nil
+}
+
 // PbmCheckCompatibility performs a compatibility check for the given profileID
 // with the given datastores.
 func (vc *VirtualCenter) PbmCheckCompatibility(ctx context.Context,
@@ -152,6 +196,30 @@ func (vc *VirtualCenter) PbmRetrieveContent(ctx context.Context, policyIds []str
 	return simplifyProfileStructs(ctx, profiles), err
 }
 
+// vmCryptCapabilityNamespace is the capability namespace of the VM encryption
+// IO filter in storage policies.
+const vmCryptCapabilityNamespace = "vmwarevmcrypt"
+
+// IsEncryptionPolicy returns true if the given storage policy enables VM encryption.
+func (vc *VirtualCenter) IsEncryptionPolicy(ctx context.Context, policyID string) (bool, error) {
+	log := logger.GetLogger(ctx)
+	policies, err := vc.PbmRetrieveContent(ctx, []string{policyID})
+	if err != nil {
+		log.Errorf("failed to retrieve content of storage policy %q. Error: %+v", policyID, err)
+		return false, err
+	}
+	for _, policy := range policies {
+		for _, profile := range policy.Profiles {
+			for _, rule := range profile.Rules {
+				if strings.HasPrefix(rule.Ns, vmCryptCapabilityNamespace) {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
 func simplifyProfileStructs(ctx context.Context, profiles []pbmtypes.BasePbmProfile) []SpbmPolicyContent {
 	log := logger.GetLogger(ctx)
 	out := make([]SpbmPolicyContent, 0)
@@ -0,0 +1,250 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/prometheus"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+)
+
+const (
+	// sessionReloginMaxAttempts is the maximum number of re-login attempts made
+	// after vCenter rejects a request with a NotAuthenticated fault. Retries are
+	// capped so that a vCenter which is genuinely down is not masked.
+	sessionReloginMaxAttempts = 3
+)
+
+var (
+	// sessionReloginInitialBackoff is the wait before the first re-login attempt.
+	// The wait doubles for every subsequent attempt.
+	sessionReloginInitialBackoff = 500 * time.Millisecond
+)
+
+// sessionReloginCtxKey marks requests issued while re-establishing a session,
+// so that they are passed through without triggering another re-login.
+type sessionReloginCtxKey struct{}
+
+// SessionRetryRoundTripper re-establishes an expired vCenter session and
+// retries the failed request once, instead of surfacing the NotAuthenticated
+// fault to the caller.
+type SessionRetryRoundTripper struct {
+	host         string
+	roundTripper soap.RoundTripper
+	relogin      func(ctx context.Context) error
+	// mutex serializes re-login, so concurrent requests failing with an
+	// expired session trigger a single new login.
+	mutex sync.Mutex
+	// generation is incremented on every successful re-login.
+	generation uint64
+}
+
+// NewSessionRetryRoundTripper wraps the given round tripper. relogin is
+// invoked to establish a new session for the underlying client.
+func NewSessionRetryRoundTripper(host string, roundTripper soap.RoundTripper,
+	relogin func(ctx context.Context) error) *SessionRetryRoundTripper {
+	return &SessionRetryRoundTripper{
+		host:         host,
+		roundTripper: roundTripper,
+		relogin:      relogin,
+	}
+}
+
+// RoundTrip implements the soap.RoundTripper interface.
+func (srt *SessionRetryRoundTripper) RoundTrip(ctx context.Context, req, resp soap.HasFault) error {
+	return srt.Do(ctx, func(ctx context.Context) error {
+		return resetFaultedResponse(srt.roundTripper.RoundTrip(ctx, req, resp), resp)
+	})
+}
+
+// resetFaultedResponse clears resp if err is a NotAuthenticated fault, so that
+// the fault decoded into resp is not returned again when the request is retried
+// with the re-established session. It returns err.
+func resetFaultedResponse(err error, resp soap.HasFault) error {
+	if err == nil || !IsNotAuthenticatedError(err) {
+		return err
+	}
+	if v := reflect.ValueOf(resp); v.Kind() == reflect.Ptr && !v.IsNil() {
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+	}
+	return err
+}
+
+// Do invokes fn and, if it fails with a NotAuthenticated fault, re-establishes
+// the session and invokes fn once more. It is used for requests which are not
+// sent through this round tripper but authenticate with its session.
+func (srt *SessionRetryRoundTripper) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(sessionReloginCtxKey{}) != nil {
+		return fn(ctx)
+	}
+	srt.mutex.Lock()
+	generation := srt.generation
+	srt.mutex.Unlock()
+
+	err := fn(ctx)
+	if err == nil || !IsNotAuthenticatedError(err) {
+		return err
+	}
+	log := logger.GetLogger(ctx)
+	log.Infof("vCenter %q rejected the request as not authenticated. Re-establishing the session.", srt.host)
+	if reloginErr := srt.reestablishSession(ctx, generation); reloginErr != nil {
+		log.Errorf("failed to re-establish session with vCenter %q. Err: %v", srt.host, reloginErr)
+		return err
+	}
+	return fn(ctx)
+}
+
+// reestablishSession logs in again with exponential backoff. If another request
+// already re-established the session since generation was observed, it returns
+// immediately.
+func (srt *SessionRetryRoundTripper) reestablishSession(ctx context.Context, generation uint64) error {
+	log := logger.GetLogger(ctx)
+	srt.mutex.Lock()
+	defer srt.mutex.Unlock()
+	if srt.generation != generation {
+		return nil
+	}
+	reloginCtx := context.WithValue(ctx, sessionReloginCtxKey{}, true)
+	backoff := sessionReloginInitialBackoff
+	var err error
+	for attempt := 1; attempt <= sessionReloginMaxAttempts; attempt++ {
+		select {
+		case <-ctx.Done():
+			prometheus.VCenterSessionReloginCount.WithLabelValues(srt.host, prometheus.PrometheusFailStatus).Inc()
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if err = srt.relogin(reloginCtx); err == nil {
+			srt.generation++
+			log.Infof("Re-established session with vCenter %q after %d attempt(s)", srt.host, attempt)
+			prometheus.VCenterSessionReloginCount.WithLabelValues(srt.host, prometheus.PrometheusPassStatus).Inc()
+			return nil
+		}
+		log.Warnf("attempt %d/%d to re-login to vCenter %q failed. Err: %v",
+			attempt, sessionReloginMaxAttempts, srt.host, err)
+		backoff *= 2
+	}
+	prometheus.VCenterSessionReloginCount.WithLabelValues(srt.host, prometheus.PrometheusFailStatus).Inc()
+	return err
+}
+
+// WithSessionRetry invokes fn and retries it once after re-establishing the
+// session of the virtual center if it fails with a NotAuthenticated fault. It is
+// meant for clients, such as vslm, which send requests through their own
+// soap.Client but read the session cookie of vc.Client.
+func (vc *VirtualCenter) WithSessionRetry(ctx context.Context, fn func(ctx context.Context) error) error {
+	if vc.Client != nil {
+		if session := getSessionRetryRoundTripper(vc.Client.RoundTripper); session != nil {
+			return session.Do(ctx, fn)
+		}
+	}
+	return fn(ctx)
+}
+
+// getSessionRetryRoundTripper returns the SessionRetryRoundTripper in the
+// chain of round trippers starting at roundTripper, or nil if there is none.
+// The round trippers observing the requests, such as MetricRoundTripper, are
+// unwrapped.
+func getSessionRetryRoundTripper(roundTripper soap.RoundTripper) *SessionRetryRoundTripper {
+	for {
+		switch rt := roundTripper.(type) {
+		case *SessionRetryRoundTripper:
+			return rt
+		case *MetricRoundTripper:
+			roundTripper = rt.roundTripper
+		default:
+			return nil
+		}
+	}
+}
+
+// serviceSessionRetryRoundTripper retries requests of a service client, e.g.
+// CNS or PBM, which share the session of the vim25 client they were created
+// from. Service clients copy the session cookie when created, so the cookie is
+// refreshed from the vim25 client before every request.
+type serviceSessionRetryRoundTripper struct {
+	session      *SessionRetryRoundTripper
+	vimClient    *soap.Client
+	client       *soap.Client
+	roundTripper soap.RoundTripper
+}
+
+// newServiceSessionRetryRoundTripper wraps the round tripper of the service
+// client created from c, so that an expired session is re-established through
+// the SessionRetryRoundTripper of c. The round tripper is returned unchanged if
+// c does not retry expired sessions.
+func newServiceSessionRetryRoundTripper(c *vim25.Client, client *soap.Client,
+	roundTripper soap.RoundTripper) soap.RoundTripper {
+	session := getSessionRetryRoundTripper(c.RoundTripper)
+	if session == nil {
+		return roundTripper
+	}
+	return &serviceSessionRetryRoundTripper{
+		session:      session,
+		vimClient:    c.Client,
+		client:       client,
+		roundTripper: roundTripper,
+	}
+}
+
+// RoundTrip implements the soap.RoundTripper interface.
+func (s *serviceSessionRetryRoundTripper) RoundTrip(ctx context.Context, req, resp soap.HasFault) error {
+	return s.session.Do(ctx, func(ctx context.Context) error {
+		s.refreshSessionCookie()
+		return resetFaultedResponse(s.roundTripper.RoundTrip(ctx, req, resp), resp)
+	})
+}
+
+// refreshSessionCookie copies the session cookie of the vim25 client into the
+// service client if the vim25 client has logged in again since.
+func (s *serviceSessionRetryRoundTripper) refreshSessionCookie() {
+	current := s.vimClient.SessionCookie()
+	if current == nil {
+		return
+	}
+	if cookie := s.client.SessionCookie(); cookie != nil && cookie.Value == current.Value {
+		return
+	}
+	u := s.client.URL()
+	s.client.Jar.SetCookies(u, s.vimClient.Jar.Cookies(u))
+}
+
+// IsNotAuthenticatedError returns true if the error is a NotAuthenticated fault
+// returned by vCenter for an expired or invalidated session.
+func IsNotAuthenticatedError(err error) bool {
+	var fault interface{}
+	if soap.IsSoapFault(err) {
+		fault = soap.ToSoapFault(err).VimFault()
+	} else if soap.IsVimFault(err) {
+		fault = soap.ToVimFault(err)
+	} else {
+		return false
+	}
+	switch fault.(type) {
+	case types.NotAuthenticated, *types.NotAuthenticated:
+		return true
+	}
+	return false
+}
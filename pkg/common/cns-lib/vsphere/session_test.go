@@ -0,0 +1,212 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+
+	cnssim "github.com/vmware/govmomi/cns/simulator"
+)
+
+type fakeRoundTripper struct {
+	errs  []error
+	calls int
+}
+
+func (f *fakeRoundTripper) RoundTrip(ctx context.Context, req, resp soap.HasFault) error {
+	f.calls++
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+func TestSessionRetryRoundTripper(t *testing.T) {
+	sessionReloginInitialBackoff = time.Millisecond
+	ctx := context.Background()
+	notAuthenticated := soap.WrapVimFault(&types.NotAuthenticated{})
+
+	// Request succeeds after the session is re-established.
+	rt := &fakeRoundTripper{errs: []error{notAuthenticated}}
+	relogins := 0
+	srt := NewSessionRetryRoundTripper("vc", rt, func(ctx context.Context) error {
+		relogins++
+		return nil
+	})
+	if err := srt.RoundTrip(ctx, nil, nil); err != nil {
+		t.Fatalf("expected request to succeed after re-login, got %v", err)
+	}
+	if relogins != 1 || rt.calls != 2 {
+		t.Fatalf("expected 1 re-login and 2 calls, got %d re-logins and %d calls", relogins, rt.calls)
+	}
+
+	// Re-login failures are capped and the original fault is returned.
+	rt = &fakeRoundTripper{errs: []error{notAuthenticated}}
+	relogins = 0
+	srt = NewSessionRetryRoundTripper("vc", rt, func(ctx context.Context) error {
+		relogins++
+		return errors.New("vCenter unreachable")
+	})
+	if err := srt.RoundTrip(ctx, nil, nil); !IsNotAuthenticatedError(err) {
+		t.Fatalf("expected NotAuthenticated fault, got %v", err)
+	}
+	if relogins != sessionReloginMaxAttempts || rt.calls != 1 {
+		t.Fatalf("expected %d re-logins and 1 call, got %d re-logins and %d calls",
+			sessionReloginMaxAttempts, relogins, rt.calls)
+	}
+
+	// Other errors are returned without a re-login.
+	rt = &fakeRoundTripper{errs: []error{errors.New("some error")}}
+	relogins = 0
+	srt = NewSessionRetryRoundTripper("vc", rt, func(ctx context.Context) error {
+		relogins++
+		return nil
+	})
+	if err := srt.RoundTrip(ctx, nil, nil); err == nil || relogins != 0 {
+		t.Fatalf("expected error without re-login, got err %v and %d re-logins", err, relogins)
+	}
+}
+
+func TestServiceSessionRetryRoundTripper(t *testing.T) {
+	sessionReloginInitialBackoff = time.Millisecond
+	ctx := context.Background()
+	notAuthenticated := soap.WrapVimFault(&types.NotAuthenticated{})
+
+	u, err := url.Parse("https://vc.example.com/sdk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	setSessionCookie := func(c *soap.Client, value string) {
+		cookieURL := c.URL()
+		cookieURL.Path = "/"
+		c.Jar.SetCookies(cookieURL, []*http.Cookie{{Name: soap.SessionCookieName, Value: value, Path: "/"}})
+	}
+	vimSoapClient := soap.NewClient(u, true)
+	setSessionCookie(vimSoapClient, "session-1")
+	relogins := 0
+	vimClient := &vim25.Client{
+		Client: vimSoapClient,
+		RoundTripper: NewSessionRetryRoundTripper("vc", &fakeRoundTripper{}, func(ctx context.Context) error {
+			relogins++
+			setSessionCookie(vimSoapClient, "session-2")
+			return nil
+		}),
+	}
+	serviceClient := vimSoapClient.NewServiceClient("/vsanHealth", "vsan")
+
+	// The service request is retried with the session re-established by the
+	// vim25 client.
+	rt := &fakeRoundTripper{errs: []error{notAuthenticated}}
+	srt := newServiceSessionRetryRoundTripper(vimClient, serviceClient, rt)
+	if err := srt.RoundTrip(ctx, nil, nil); err != nil {
+		t.Fatalf("expected request to succeed after re-login, got %v", err)
+	}
+	if relogins != 1 || rt.calls != 2 {
+		t.Fatalf("expected 1 re-login and 2 calls, got %d re-logins and %d calls", relogins, rt.calls)
+	}
+	if cookie := serviceClient.SessionCookie(); cookie == nil || cookie.Value != "session-2" {
+		t.Fatalf("expected service client to use the new session, got %+v", cookie)
+	}
+
+	// Clients which do not retry expired sessions are left unchanged.
+	plainClient := &vim25.Client{Client: vimSoapClient, RoundTripper: vimSoapClient}
+	if got := newServiceSessionRetryRoundTripper(plainClient, serviceClient, rt); got != rt {
+		t.Fatalf("expected round tripper to be returned unchanged, got %T", got)
+	}
+}
+
+func TestSessionRetryThroughClientChain(t *testing.T) {
+	sessionReloginInitialBackoff = time.Millisecond
+	ctx := context.Background()
+
+	model := simulator.VPX()
+	defer model.Remove()
+	if err := model.Create(); err != nil {
+		t.Fatal(err)
+	}
+	model.Service.RegisterEndpoints = true
+	model.Service.TLS = new(tls.Config)
+	s := model.Service.NewServer()
+	defer s.Close()
+	model.Service.RegisterSDK(cnssim.New())
+
+	port, err := strconv.Atoi(s.URL.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, _ := s.URL.User.Password()
+	vc := &VirtualCenter{
+		Config: &VirtualCenterConfig{
+			Host:     s.URL.Hostname(),
+			Port:     port,
+			Username: s.URL.User.Username(),
+			Password: password,
+			Insecure: true,
+		},
+	}
+	vc.Client, vc.RestClient, err = vc.NewClient(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if getSessionRetryRoundTripper(vc.Client.RoundTripper) == nil {
+		t.Fatalf("expected the client to retry expired sessions, got round tripper %T", vc.Client.RoundTripper)
+	}
+	cnsClient, err := NewCnsClient(ctx, vc.Client.Client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Requests of the client, of the service clients created from it and of
+	// the clients using its session succeed after the session expired.
+	expireSession := func() {
+		if err := vc.Client.SessionManager.Logout(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expireSession()
+	if _, err := methods.GetCurrentTime(ctx, vc.Client); err != nil {
+		t.Fatalf("expected vim25 request to succeed after re-login, got %v", err)
+	}
+	expireSession()
+	if _, err := cnsClient.QueryVolume(ctx, cnstypes.CnsQueryFilter{}); err != nil {
+		t.Fatalf("expected CNS request to succeed after re-login, got %v", err)
+	}
+	expireSession()
+	err = vc.WithSessionRetry(ctx, func(ctx context.Context) error {
+		_, err := methods.GetCurrentTime(ctx, vc.Client.Client)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("expected request to succeed after re-login, got %v", err)
+	}
+}
@@ -104,6 +104,15 @@ func IsCnsSnapshotNotFoundError(err error) bool {
 	return isCnsSnapshotNotFoundError
 }
 
+// IsCnsVolumeNotFoundError checks if err is the CnsVolumeNotFoundFault fault returned by CNS QuerySnapshots API
+func IsCnsVolumeNotFoundError(err error) bool {
+	isCnsVolumeNotFoundError := false
+	if soap.IsVimFault(err) {
+		_, isCnsVolumeNotFoundError = soap.ToVimFault(err).(cnstypes.CnsVolumeNotFoundFault)
+	}
+	return isCnsVolumeNotFoundError
+}
+
 // GetCnsKubernetesEntityMetaData creates a CnsKubernetesEntityMetadataObject
 // object from given parameters.
 func GetCnsKubernetesEntityMetaData(entityName string, labels map[string]string,
@@ -183,6 +192,8 @@ func GetVirtualCenterConfig(ctx context.Context, cfg *config.Config) (*VirtualCe
 		Port:                        port,
 		CAFile:                      vcCAFile,
 		Thumbprint:                  vcThumbprint,
+		ClientCertFile:              cfg.VirtualCenter[host].ClientCertFile,
+		ClientKeyFile:               cfg.VirtualCenter[host].ClientKeyFile,
 		Username:                    cfg.VirtualCenter[host].User,
 		Password:                    cfg.VirtualCenter[host].Password,
 		Insecure:                    cfg.VirtualCenter[host].InsecureFlag,
@@ -230,6 +241,8 @@ func GetVirtualCenterConfigs(ctx context.Context, cfg *config.Config) ([]*Virtua
 			Port:                        port,
 			CAFile:                      cfg.VirtualCenter[vCenterIP].CAFile,
 			Thumbprint:                  cfg.VirtualCenter[vCenterIP].Thumbprint,
+			ClientCertFile:              cfg.VirtualCenter[vCenterIP].ClientCertFile,
+			ClientKeyFile:               cfg.VirtualCenter[vCenterIP].ClientKeyFile,
 			Username:                    cfg.VirtualCenter[vCenterIP].User,
 			Password:                    cfg.VirtualCenter[vCenterIP].Password,
 			Insecure:                    cfg.VirtualCenter[vCenterIP].InsecureFlag,
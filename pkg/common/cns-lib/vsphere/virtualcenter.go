@@ -19,6 +19,7 @@ package vsphere
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/pem"
 	"errors"
 	"fmt"
@@ -62,6 +63,11 @@ const (
 	statusSuccess = "success"
 	// failed request
 	statusFailUnknown = "fail-unknown"
+
+	// Results of the vCenter API calls.
+	apiCallResultSuccess = "success"
+	apiCallResultFault   = "fault"
+	apiCallResultError   = "error"
 )
 
 // VirtualCenter holds details of a virtual center instance.
@@ -133,6 +139,11 @@ type VirtualCenterConfig struct {
 	// Thumbprint specifies the certificate thumbprint to use. This has no effect
 	// if InsecureFlag is enabled.
 	Thumbprint string
+	// ClientCertFile and ClientKeyFile specify the paths to a client
+	// certificate and its private key in PEM format, to authenticate to
+	// vCenter with mutual TLS. Optional.
+	ClientCertFile string
+	ClientKeyFile  string
 	// RoundTripperCount is the SOAP round tripper count.
 	// retries = RoundTripperCount - 1
 	RoundTripperCount int
@@ -180,11 +191,26 @@ func (vc *VirtualCenter) NewClient(ctx context.Context, useragent string) (*govm
 		soapClient.SetThumbprint(url.Host, vc.Config.Thumbprint)
 		log.Debugf("using thumbprint %s for url %s ", vc.Config.Thumbprint, url.Host)
 	}
+	if vc.Config.ClientCertFile != "" && vc.Config.ClientKeyFile != "" {
+		// The clients of the other vCenter services share the transport of the
+		// SOAP client, and authenticate with the same certificate.
+		cert, err := tls.LoadX509KeyPair(vc.Config.ClientCertFile, vc.Config.ClientKeyFile)
+		if err != nil {
+			return nil, nil, logger.LogNewErrorf(log, "failed to load client certificate %q and key %q. Err: %v",
+				vc.Config.ClientCertFile, vc.Config.ClientKeyFile, err)
+		}
+		soapClient.SetCertificate(cert)
+		log.Debugf("using client certificate %s for url %s", vc.Config.ClientCertFile, url.Host)
+	}
 
 	soapClient.Timeout = 0 * time.Minute
 	log.Debugf("Setting vCenter soap client timeout to %v", soapClient.Timeout)
 	vimClient, err := vim25.NewClient(ctx, soapClient)
 	if err != nil {
+		if isCertificateVerificationError(err) && len(vc.Config.CAFile) > 0 && !vc.Config.Insecure {
+			return nil, nil, logger.LogNewErrorf(log, "the certificate of vCenter %q cannot be verified "+
+				"with the CA certificates in %q. Err: %v", vc.Config.Host, vc.Config.CAFile, err)
+		}
 		log.Errorf("failed to create new client with err: %v", err)
 		return nil, nil, err
 	}
@@ -195,6 +221,9 @@ func (vc *VirtualCenter) NewClient(ctx context.Context, useragent string) (*govm
 		return nil, nil, err
 	}
 	vimClient.UserAgent = useragent
+	// Count each call of the client sent to vCenter, including the session
+	// login and each retry of the calls.
+	vimClient.RoundTripper = &apiCallRoundTripper{"soap", vimClient.RoundTripper}
 	client := &govmomi.Client{
 		Client:         vimClient,
 		SessionManager: session.NewManager(vimClient),
@@ -225,7 +254,11 @@ func (vc *VirtualCenter) NewClient(ctx context.Context, useragent string) (*govm
 		vc.Config.RoundTripperCount = DefaultRoundTripperCount
 	}
 	rt := vim25.Retry(client.RoundTripper, vim25.TemporaryNetworkError(vc.Config.RoundTripperCount))
-	client.RoundTripper = &MetricRoundTripper{"soap", rt}
+	// Re-login transparently when vCenter expires the session of this client.
+	srt := NewSessionRetryRoundTripper(vc.Config.Host, rt, func(ctx context.Context) error {
+		return vc.login(ctx, client, restClient)
+	})
+	client.RoundTripper = &MetricRoundTripper{"soap", srt}
 	return client, restClient, nil
 }
 
@@ -241,7 +274,9 @@ func (vc *VirtualCenter) login(ctx context.Context, client *govmomi.Client, rest
 			log.Errorf("error logging soap client: %v", err)
 			return err
 		}
-		return restClient.Login(ctx, neturl.UserPassword(vc.Config.Username, vc.Config.Password))
+		err := restClient.Login(ctx, neturl.UserPassword(vc.Config.Username, vc.Config.Password))
+		observeAPICall("rest", "Login", err)
+		return err
 	}
 
 	cert, err := tls.X509KeyPair([]byte(vc.Config.Username), []byte(vc.Config.Password))
@@ -255,6 +290,7 @@ func (vc *VirtualCenter) login(ctx context.Context, client *govmomi.Client, rest
 		log.Errorf("failed to create STS client with err: %v", err)
 		return err
 	}
+	tokens.RoundTripper = &apiCallRoundTripper{"sts", tokens.RoundTripper}
 
 	req := sts.TokenRequest{
 		Certificate: &cert,
@@ -272,7 +308,9 @@ func (vc *VirtualCenter) login(ctx context.Context, client *govmomi.Client, rest
 		return err
 	}
 
-	return restClient.LoginByToken(restClient.WithSigner(ctx, signer))
+	err = restClient.LoginByToken(restClient.WithSigner(ctx, signer))
+	observeAPICall("rest", "LoginByToken", err)
+	return err
 }
 
 // Connect establishes a new connection with vSphere with updated credentials.
@@ -386,11 +424,10 @@ func (vc *VirtualCenter) connect(ctx context.Context) error {
 	}
 	// Recreate PbmClient if created using timed out VC Client.
 	if vc.PbmClient != nil {
-		if vc.PbmClient, err = pbm.NewClient(ctx, vc.Client.Client); err != nil {
+		if vc.PbmClient, err = NewPbmClient(ctx, vc.Client.Client); err != nil {
 			log.Errorf("failed to create pbm client with err: %v", err)
 			return err
 		}
-		vc.PbmClient.RoundTripper = &MetricRoundTripper{"pbm", vc.PbmClient.RoundTripper}
 	}
 	// Recreate CNSClient if created using timed out VC Client.
 	if vc.CnsClient != nil {
@@ -410,11 +447,10 @@ func (vc *VirtualCenter) connect(ctx context.Context) error {
 	}
 	// Recreate VSAN client if created using timed out VC Client.
 	if vc.VsanClient != nil {
-		if vc.VsanClient, err = vsan.NewClient(ctx, vc.Client.Client); err != nil {
+		if vc.VsanClient, err = NewVsanClient(ctx, vc.Client.Client); err != nil {
 			log.Errorf("failed to create vsan client with err: %v", err)
 			return err
 		}
-		vc.VsanClient.RoundTripper = &MetricRoundTripper{"vsan", vc.VsanClient.RoundTripper}
 	}
 
 	// Recreate the Tag Manager client if created using timed out Rest client
@@ -824,8 +860,7 @@ func (vc *VirtualCenter) GetAllVirtualMachines(ctx context.Context,
 }
 
 func (mrt *MetricRoundTripper) RoundTrip(ctx context.Context, req, resp soap.HasFault) error {
-	vreq := reflect.ValueOf(req).Elem().FieldByName("Req").Elem()
-	requestName := vreq.Type().Name()
+	requestName := getRequestName(req)
 	requestTime := time.Now()
 	err := mrt.roundTripper.RoundTrip(ctx, req, resp)
 	if err != nil {
@@ -838,3 +873,50 @@ func (mrt *MetricRoundTripper) RoundTrip(ctx context.Context, req, resp soap.Has
 	prometheus.RequestOpsMetric.WithLabelValues(requestName, mrt.clientName, statusSuccess).Observe(timeTaken)
 	return nil
 }
+
+// apiCallRoundTripper counts the calls sent to vCenter by the wrapped round
+// tripper. Unlike MetricRoundTripper, which observes the requests of the
+// client, it is placed below the retries of the client so that each attempt
+// is counted.
+type apiCallRoundTripper struct {
+	clientName   string
+	roundTripper soap.RoundTripper
+}
+
+func (art *apiCallRoundTripper) RoundTrip(ctx context.Context, req, resp soap.HasFault) error {
+	err := art.roundTripper.RoundTrip(ctx, req, resp)
+	observeAPICall(art.clientName, getRequestName(req), err)
+	return err
+}
+
+// getRequestName returns the name of the vCenter API method called by req.
+func getRequestName(req soap.HasFault) string {
+	if vreq := reflect.ValueOf(req).Elem().FieldByName("Req"); vreq.IsValid() && !vreq.IsNil() {
+		return vreq.Elem().Type().Name()
+	}
+	return "Unknown"
+}
+
+// observeAPICall counts a call to the vCenter API method of the given client
+// which completed with the given error.
+func observeAPICall(clientName string, method string, err error) {
+	result := apiCallResultSuccess
+	if err != nil {
+		result = apiCallResultError
+		if soap.IsSoapFault(err) || soap.IsVimFault(err) {
+			result = apiCallResultFault
+		}
+	}
+	prometheus.VCenterAPICallCount.WithLabelValues(clientName, method, result).Inc()
+}
+
+// isCertificateVerificationError returns true if the error is caused by the
+// failure to verify the certificate of the server.
+func isCertificateVerificationError(err error) bool {
+	var verificationErr *tls.CertificateVerificationError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	return errors.As(err, &verificationErr) || errors.As(err, &unknownAuthorityErr) ||
+		errors.As(err, &invalidErr) || errors.As(err, &hostnameErr)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/prometheus"
+)
+
+// getRequestOpsCount returns the number of requests observed by
+// RequestOpsMetric for the given request, client and status.
+func getRequestOpsCount(t *testing.T, request, client, status string) uint64 {
+	metric := &dto.Metric{}
+	observer := prometheus.RequestOpsMetric.WithLabelValues(request, client, status)
+	if err := observer.(prom.Metric).Write(metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestMetricRoundTripper(t *testing.T) {
+	ctx := context.Background()
+	clientName := "test-metric"
+	req := &methods.CurrentTimeBody{Req: &types.CurrentTime{}}
+
+	// A request retried once after a network error is observed once by
+	// RequestOpsMetric, and each of its attempts is counted as an API call.
+	rt := &fakeRoundTripper{errs: []error{errors.New("connection reset")}}
+	retry := vim25.Retry(&apiCallRoundTripper{clientName, rt}, func(err error) (bool, time.Duration) {
+		return true, 0
+	}, 2)
+	mrt := &MetricRoundTripper{clientName, retry}
+	if err := mrt.RoundTrip(ctx, req, req); err != nil {
+		t.Fatal(err)
+	}
+	if count := getRequestOpsCount(t, "CurrentTime", clientName, statusSuccess); count != 1 {
+		t.Errorf("expected 1 successful request, got %d", count)
+	}
+	if count := getRequestOpsCount(t, "CurrentTime", clientName, statusFailUnknown); count != 0 {
+		t.Errorf("expected no failed request, got %d", count)
+	}
+	for result, expected := range map[string]float64{apiCallResultError: 1, apiCallResultSuccess: 1} {
+		count := testutil.ToFloat64(prometheus.VCenterAPICallCount.WithLabelValues(clientName, "CurrentTime", result))
+		if count != expected {
+			t.Errorf("expected %v API calls with result %q, got %v", expected, result, count)
+		}
+	}
+
+	// A fault returned by vCenter fails the request.
+	rt.errs = []error{soap.WrapVimFault(&types.NotAuthenticated{})}
+	mrt = &MetricRoundTripper{clientName, &apiCallRoundTripper{clientName, rt}}
+	if err := mrt.RoundTrip(ctx, req, req); err == nil {
+		t.Fatal("expected the request to fail")
+	}
+	if count := getRequestOpsCount(t, "CurrentTime", clientName, statusFailUnknown); count != 1 {
+		t.Errorf("expected 1 failed request, got %d", count)
+	}
+	count := testutil.ToFloat64(prometheus.VCenterAPICallCount.WithLabelValues(clientName, "CurrentTime",
+		apiCallResultFault))
+	if count != 1 {
+		t.Errorf("expected 1 API call with result %q, got %v", apiCallResultFault, count)
+	}
+}
+
+func TestGetRequestName(t *testing.T) {
+	if name := getRequestName(&methods.CurrentTimeBody{Req: &types.CurrentTime{}}); name != "CurrentTime" {
+		t.Errorf("expected request name CurrentTime, got %q", name)
+	}
+	if name := getRequestName(&methods.CurrentTimeBody{}); name != "Unknown" {
+		t.Errorf("expected request name Unknown without a request, got %q", name)
+	}
+}
@@ -20,8 +20,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
+	"github.com/vmware/govmomi/property"
 	"github.com/vmware/govmomi/vapi/tags"
 	"github.com/vmware/govmomi/vim25/mo"
 
@@ -37,6 +39,9 @@ var (
 	// ErrNoSharedDatastoresFound is raised when no shared datastores are found among the given NodeVMs.
 	ErrNoSharedDatastoresFound = errors.New("no shared datastores found among given NodeVMs")
 	ErrInvalidVC               = errors.New("invalid VC Object")
+	// ErrSCSISlotUnavailable is returned when a disk cannot be attached to the
+	// requested SCSI controller slot of a virtual machine.
+	ErrSCSISlotUnavailable = errors.New("SCSI controller slot is unavailable")
 )
 
 // VirtualMachine holds details of a virtual machine instance.
@@ -150,9 +155,23 @@ func GetUUIDFromVMReference(ctx context.Context, vc *VirtualCenter, vmRef types.
 func GetVirtualMachineByUUID(ctx context.Context, uuid string, instanceUUID bool) (*VirtualMachine, error) {
 	log := logger.GetLogger(ctx)
 	log.Infof("Initiating asynchronous datacenter listing with uuid %s", uuid)
+	return getVirtualMachineByUUID(ctx, GetVirtualCenterManager(ctx).GetAllVirtualCenters(), uuid, instanceUUID)
+}
+
+// getVirtualMachineByUUID returns the VirtualMachine with the given UUID on the
+// given vCenters. If the VM is not found on the available vCenters while the
+// inventory of another vCenter is unavailable, ErrVCenterInventoryUnavailable
+// is returned instead of ErrVMNotFound.
+func getVirtualMachineByUUID(ctx context.Context, vcs []*VirtualCenter, uuid string,
+	instanceUUID bool) (*VirtualMachine, error) {
+	log := logger.GetLogger(ctx)
 	var nodeVM *VirtualMachine
+	// unavailableErr is set if the inventory of a vCenter is unavailable, in
+	// which case the VM may be on that vCenter and is not reported as not found.
+	var unavailableErr error
 
-	for _, vc := range GetVirtualCenterManager(ctx).GetAllVirtualCenters() {
+vcLoop:
+	for _, vc := range vcs {
 		dcs, err := vc.GetDatacenters(ctx)
 		if err != nil {
 			return nil, logger.LogNewErrorf(log, "failed to fetch datacenters for vc %v with err: %v", vc.Config.Host, err)
@@ -165,13 +184,21 @@ func GetVirtualMachineByUUID(ctx context.Context, uuid string, instanceUUID bool
 					log.Warnf("Couldn't find VM given uuid %s on DC %v with err: %v, continuing search", uuid, dc, err)
 					continue
 				}
+				if errors.Is(err, ErrVCenterInventoryUnavailable) {
+					// The VM can't be looked up on this vCenter while it is
+					// unavailable, continue searching on other vCenters.
+					log.Warnf("Couldn't search VM given uuid %s on vCenter %s with err: %v, continuing search",
+						uuid, vc.Config.Host, err)
+					unavailableErr = err
+					continue vcLoop
+				}
 				// Some serious error occurred, so stop the async function.
 				log.Errorf("Failed finding VM given uuid %s on DC %v with err: %v", uuid, dc, err)
 			} else {
 				// Virtual machine was found, so stop the async function.
 				log.Infof("Found VM %v given uuid %s on DC %v", vm, uuid, dc)
 				nodeVM = vm
-				break
+				break vcLoop
 			}
 		}
 	}
@@ -180,6 +207,10 @@ func GetVirtualMachineByUUID(ctx context.Context, uuid string, instanceUUID bool
 		log.Infof("Returning VM %v for UUID %s", nodeVM, uuid)
 		return nodeVM, nil
 	}
+	if unavailableErr != nil {
+		log.Errorf("VM with UUID %s not found on the available vCenters", uuid)
+		return nil, unavailableErr
+	}
 
 	log.Errorf("Returning VM not found err for UUID %s", uuid)
 	return nil, ErrVMNotFound
@@ -203,6 +234,252 @@ func (vm *VirtualMachine) GetHostSystem(ctx context.Context) (*object.HostSystem
 	return vmHost, nil
 }
 
+// GetDiskSCSISlot returns the bus number of the SCSI controller and the unit
+// number the first class disk is attached to. False is returned if the disk
+// is not attached to a SCSI controller of the virtual machine.
+func (vm *VirtualMachine) GetDiskSCSISlot(ctx context.Context, diskID string) (int32, int32, bool, error) {
+	log := logger.GetLogger(ctx)
+	vmDevices, err := vm.Device(ctx)
+	if err != nil {
+		log.Errorf("failed to get devices of vm: %v. err: %+v", vm, err)
+		return 0, 0, false, err
+	}
+	for _, device := range vmDevices.SelectByType((*types.VirtualDisk)(nil)) {
+		virtualDisk := device.(*types.VirtualDisk)
+		if virtualDisk.VDiskId == nil || virtualDisk.VDiskId.Id != diskID || virtualDisk.UnitNumber == nil {
+			continue
+		}
+		controller, ok := vmDevices.FindByKey(virtualDisk.ControllerKey).(types.BaseVirtualSCSIController)
+		if !ok {
+			return 0, 0, false, nil
+		}
+		return controller.GetVirtualSCSIController().BusNumber, *virtualDisk.UnitNumber, true, nil
+	}
+	return 0, 0, false, nil
+}
+
+// AttachMultiWriterDisk attaches the first class disk backed by the given
+// file to the virtual machine in multi-writer sharing mode, so that the disk
+// can be attached to other virtual machines concurrently. Attach in
+// multi-writer mode is not supported by the FCD attach API, hence the disk
+// is added by reconfiguring the virtual machine. The disk is attached to the
+// given unit of the SCSI controller with the given bus number if it is
+// available, or if unitNumber is negative, to the first available unit.
+func (vm *VirtualMachine) AttachMultiWriterDisk(ctx context.Context, diskID string, fileName string,
+	datastore *Datastore, busNumber int32, unitNumber int32) error {
+	log := logger.GetLogger(ctx)
+	vmDevices, err := vm.Device(ctx)
+	if err != nil {
+		log.Errorf("failed to get devices of vm: %v. err: %+v", vm, err)
+		return err
+	}
+	controllerKey, unit, found := findFreeSCSISlot(vmDevices, busNumber, unitNumber)
+	if !found {
+		return fmt.Errorf("%w: vm %v has no available SCSI controller unit", ErrSCSISlotUnavailable, vm)
+	}
+	datastoreRef := datastore.Reference()
+	disk := &types.VirtualDisk{
+		VirtualDevice: types.VirtualDevice{
+			Key:           -1,
+			ControllerKey: controllerKey,
+			UnitNumber:    &unit,
+			Backing: &types.VirtualDiskFlatVer2BackingInfo{
+				VirtualDeviceFileBackingInfo: types.VirtualDeviceFileBackingInfo{
+					FileName:  fileName,
+					Datastore: &datastoreRef,
+				},
+				DiskMode: string(types.VirtualDiskModePersistent),
+				Sharing:  string(types.VirtualDiskSharingSharingMultiWriter),
+			},
+		},
+	}
+	log.Infof("Attaching disk %q in multi-writer mode to unit %d of controller %d of vm %v", diskID, unit,
+		controllerKey, vm)
+	task, err := vm.Reconfigure(ctx, types.VirtualMachineConfigSpec{
+		DeviceChange: []types.BaseVirtualDeviceConfigSpec{
+			&types.VirtualDeviceConfigSpec{
+				Operation: types.VirtualDeviceConfigSpecOperationAdd,
+				Device:    disk,
+			},
+		},
+	})
+	if err != nil {
+		log.Errorf("failed to reconfigure vm: %v. err: %+v", vm, err)
+		return err
+	}
+	if err = task.Wait(ctx); err != nil {
+		log.Errorf("failed to attach disk %q in multi-writer mode to vm: %v. err: %+v", diskID, vm, err)
+		return err
+	}
+	return nil
+}
+
+// DetachMultiWriterDisk detaches the first class disk attached in multi-writer
+// sharing mode from the virtual machine, leaving it attached to the other
+// virtual machines sharing it. The disk file is kept. False is returned
+// without reconfiguring the virtual machine if the disk is not attached to it
+// in multi-writer mode. ErrVMNotFound is returned if the virtual machine does
+// not exist anymore, e.g. when its node died and was removed.
+func (vm *VirtualMachine) DetachMultiWriterDisk(ctx context.Context, diskID string) (bool, error) {
+	log := logger.GetLogger(ctx)
+	vmDevices, err := vm.Device(ctx)
+	if err != nil {
+		if IsManagedObjectNotFound(err, vm.Reference()) {
+			return false, ErrVMNotFound
+		}
+		log.Errorf("failed to get devices of vm: %v. err: %+v", vm, err)
+		return false, err
+	}
+	virtualDisk := findMultiWriterDisk(vmDevices, diskID)
+	if virtualDisk == nil {
+		return false, nil
+	}
+	task, err := vm.Reconfigure(ctx, types.VirtualMachineConfigSpec{
+		DeviceChange: []types.BaseVirtualDeviceConfigSpec{
+			&types.VirtualDeviceConfigSpec{
+				Operation: types.VirtualDeviceConfigSpecOperationRemove,
+				Device:    virtualDisk,
+			},
+		},
+	})
+	if err == nil {
+		err = task.Wait(ctx)
+	}
+	if err != nil {
+		if IsManagedObjectNotFound(err, vm.Reference()) {
+			return true, ErrVMNotFound
+		}
+		log.Errorf("failed to detach multi-writer disk %q from vm: %v. err: %+v", diskID, vm, err)
+		return true, err
+	}
+	log.Infof("Detached multi-writer disk %q from vm %v", diskID, vm)
+	return true, nil
+}
+
+// findMultiWriterDisk returns the virtual disk of the first class disk among
+// the devices of a virtual machine, if it is attached in multi-writer sharing
+// mode, or nil otherwise.
+func findMultiWriterDisk(vmDevices object.VirtualDeviceList, diskID string) *types.VirtualDisk {
+	for _, device := range vmDevices.SelectByType((*types.VirtualDisk)(nil)) {
+		virtualDisk := device.(*types.VirtualDisk)
+		if virtualDisk.VDiskId == nil || virtualDisk.VDiskId.Id != diskID {
+			continue
+		}
+		backing, ok := virtualDisk.Backing.(*types.VirtualDiskFlatVer2BackingInfo)
+		if !ok || backing.Sharing != string(types.VirtualDiskSharingSharingMultiWriter) {
+			return nil
+		}
+		return virtualDisk
+	}
+	return nil
+}
+
+// findFreeSCSISlot returns the key of the SCSI controller and the unit number
+// of the given slot if it is available, or if unitNumber is negative or the
+// slot is unavailable, of the first available SCSI controller unit.
+func findFreeSCSISlot(vmDevices object.VirtualDeviceList, busNumber int32, unitNumber int32) (int32, int32, bool) {
+	usedUnits := make(map[int32]map[int32]bool)
+	for _, device := range vmDevices {
+		virtualDevice := device.GetVirtualDevice()
+		if virtualDevice.UnitNumber == nil {
+			continue
+		}
+		if usedUnits[virtualDevice.ControllerKey] == nil {
+			usedUnits[virtualDevice.ControllerKey] = make(map[int32]bool)
+		}
+		usedUnits[virtualDevice.ControllerKey][*virtualDevice.UnitNumber] = true
+	}
+	type scsiController struct {
+		*types.VirtualSCSIController
+		maxUnitNumber int32
+	}
+	var controllers []scsiController
+	for _, device := range vmDevices.SelectByType((*types.VirtualSCSIController)(nil)) {
+		baseController, ok := device.(types.BaseVirtualSCSIController)
+		if !ok {
+			continue
+		}
+		// Paravirtual SCSI controllers support 64 targets, other SCSI
+		// controllers 16.
+		maxUnitNumber := int32(15)
+		if _, ok := device.(*types.ParaVirtualSCSIController); ok {
+			maxUnitNumber = 63
+		}
+		controllers = append(controllers, scsiController{baseController.GetVirtualSCSIController(), maxUnitNumber})
+	}
+	slices.SortFunc(controllers, func(a, b scsiController) int {
+		return int(a.BusNumber - b.BusNumber)
+	})
+	isFree := func(controller scsiController, unit int32) bool {
+		return unit <= controller.maxUnitNumber && unit != controller.ScsiCtlrUnitNumber &&
+			!usedUnits[controller.Key][unit]
+	}
+	if unitNumber >= 0 {
+		for _, controller := range controllers {
+			if controller.BusNumber == busNumber && isFree(controller, unitNumber) {
+				return controller.Key, unitNumber, true
+			}
+		}
+	}
+	for _, controller := range controllers {
+		for unit := int32(0); unit <= controller.maxUnitNumber; unit++ {
+			if isFree(controller, unit) {
+				return controller.Key, unit, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// SetDiskIOPSLimit sets the IOPS limit of the virtual disk backing the first
+// class disk, -1 removing the limit. False is returned without reconfiguring
+// the virtual machine if the disk is not attached to it.
+func (vm *VirtualMachine) SetDiskIOPSLimit(ctx context.Context, diskID string, iopsLimit int64) (bool, error) {
+	log := logger.GetLogger(ctx)
+	vmDevices, err := vm.Device(ctx)
+	if err != nil {
+		log.Errorf("failed to get devices of vm: %v. err: %+v", vm, err)
+		return false, err
+	}
+	for _, device := range vmDevices.SelectByType((*types.VirtualDisk)(nil)) {
+		virtualDisk := device.(*types.VirtualDisk)
+		if virtualDisk.VDiskId == nil || virtualDisk.VDiskId.Id != diskID {
+			continue
+		}
+		if virtualDisk.StorageIOAllocation == nil {
+			virtualDisk.StorageIOAllocation = &types.StorageIOAllocationInfo{}
+		}
+		currentLimit := int64(-1)
+		if virtualDisk.StorageIOAllocation.Limit != nil {
+			currentLimit = *virtualDisk.StorageIOAllocation.Limit
+		}
+		if currentLimit == iopsLimit {
+			log.Debugf("IOPS limit of disk %q on vm %v is already %d", diskID, vm, iopsLimit)
+			return true, nil
+		}
+		virtualDisk.StorageIOAllocation.Limit = &iopsLimit
+		task, err := vm.Reconfigure(ctx, types.VirtualMachineConfigSpec{
+			DeviceChange: []types.BaseVirtualDeviceConfigSpec{
+				&types.VirtualDeviceConfigSpec{
+					Operation: types.VirtualDeviceConfigSpecOperationEdit,
+					Device:    virtualDisk,
+				},
+			},
+		})
+		if err != nil {
+			log.Errorf("failed to reconfigure vm: %v. err: %+v", vm, err)
+			return true, err
+		}
+		if err = task.Wait(ctx); err != nil {
+			log.Errorf("failed to set IOPS limit of disk %q on vm: %v. err: %+v", diskID, vm, err)
+			return true, err
+		}
+		log.Infof("IOPS limit of disk %q on vm %v set to %d", diskID, vm, iopsLimit)
+		return true, nil
+	}
+	return false, nil
+}
+
 // GetTagManager returns tagManager using vm client.
 func (vm *VirtualMachine) GetTagManager(ctx context.Context) (*tags.Manager, error) {
 	log := logger.GetLogger(ctx)
@@ -358,6 +635,65 @@ func GetSharedDatastoresForVMs(ctx context.Context, nodeVMs []*VirtualMachine) (
 	return sharedDatastores, nil
 }
 
+// FilterDatastoresMountedOnVMHosts returns the datastores which are mounted
+// and accessible on the hosts of all the given nodeVMs. A datastore stays in
+// the datastore list of a host when its mount becomes inaccessible, and volumes
+// placed on such a datastore could never be attached to the nodeVMs.
+func FilterDatastoresMountedOnVMHosts(ctx context.Context, datastores []*DatastoreInfo,
+	nodeVMs []*VirtualMachine) ([]*DatastoreInfo, error) {
+	log := logger.GetLogger(ctx)
+	if len(datastores) == 0 || len(nodeVMs) == 0 {
+		return datastores, nil
+	}
+	hosts := make(map[types.ManagedObjectReference]struct{})
+	for _, nodeVM := range nodeVMs {
+		host, err := nodeVM.HostSystem(ctx)
+		if err != nil {
+			log.Errorf("failed to get host system for VM %v with err: %v", nodeVM.InventoryPath, err)
+			return nil, err
+		}
+		hosts[host.Reference()] = struct{}{}
+	}
+	var dsRefList []types.ManagedObjectReference
+	for _, ds := range datastores {
+		dsRefList = append(dsRefList, ds.Reference())
+	}
+	var dsMoList []mo.Datastore
+	pc := property.DefaultCollector(nodeVMs[0].Client())
+	err := pc.Retrieve(ctx, dsRefList, []string{"host"}, &dsMoList)
+	if err != nil {
+		log.Errorf("failed to get host mounts of datastores %v with err: %v", dsRefList, err)
+		return nil, err
+	}
+	accessibleHosts := make(map[string]map[types.ManagedObjectReference]struct{})
+	for _, dsMo := range dsMoList {
+		accessibleHosts[dsMo.Reference().Value] = make(map[types.ManagedObjectReference]struct{})
+		for _, mount := range dsMo.Host {
+			// Mounted and Accessible are unset by older hosts, treat them as accessible.
+			if (mount.MountInfo.Mounted == nil || *mount.MountInfo.Mounted) &&
+				(mount.MountInfo.Accessible == nil || *mount.MountInfo.Accessible) {
+				accessibleHosts[dsMo.Reference().Value][mount.Key] = struct{}{}
+			}
+		}
+	}
+	var filteredDatastores []*DatastoreInfo
+	for _, ds := range datastores {
+		accessible := true
+		for host := range hosts {
+			if _, exists := accessibleHosts[ds.Reference().Value][host]; !exists {
+				log.Infof("Datastore %q is not mounted or not accessible on host %q, skipping it",
+					ds.Info.Url, host.Value)
+				accessible = false
+				break
+			}
+		}
+		if accessible {
+			filteredDatastores = append(filteredDatastores, ds)
+		}
+	}
+	return filteredDatastores, nil
+}
+
 // GetTopologyLabels populates the topology labels of the nodeVM in topologyCategories
 // parameter given the category names.
 func (vm *VirtualMachine) GetTopologyLabels(ctx context.Context, tagManager *tags.Manager,
@@ -19,9 +19,14 @@ package vsphere
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/object"
@@ -29,6 +34,8 @@ import (
 	"github.com/vmware/govmomi/vapi/rest"
 	_ "github.com/vmware/govmomi/vapi/simulator"
 	"github.com/vmware/govmomi/vapi/tags"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/types"
 )
 
 var (
@@ -180,3 +187,199 @@ func TestIsInZoneRegion(t *testing.T) {
 		t.Fatalf("VM should belong to specified zone and region")
 	}
 }
+
+func TestFilterDatastoresMountedOnVMHosts(t *testing.T) {
+	model := simulator.VPX()
+	defer model.Remove()
+	err := model.Run(func(ctx context.Context, c *vim25.Client) error {
+		simVM := model.Map().Any("VirtualMachine").(*simulator.VirtualMachine)
+		simDatastore := model.Map().Get(simVM.Datastore[0]).(*simulator.Datastore)
+		nodeVMs := []*VirtualMachine{{VirtualMachine: object.NewVirtualMachine(c, simVM.Reference())}}
+		datastores := []*DatastoreInfo{{
+			Datastore: &Datastore{Datastore: object.NewDatastore(c, simDatastore.Reference())},
+			Info:      simDatastore.Info.GetDatastoreInfo(),
+		}}
+
+		filtered, err := FilterDatastoresMountedOnVMHosts(ctx, datastores, nodeVMs)
+		if err != nil {
+			return err
+		}
+		if len(filtered) != 1 {
+			return fmt.Errorf("expected datastore %q to be accessible, got %v", datastores[0].Info.Url, filtered)
+		}
+		for i, mount := range simDatastore.Host {
+			if mount.Key == *simVM.Runtime.Host {
+				simDatastore.Host[i].MountInfo.Accessible = types.NewBool(false)
+			}
+		}
+		filtered, err = FilterDatastoresMountedOnVMHosts(ctx, datastores, nodeVMs)
+		if err != nil {
+			return err
+		}
+		if len(filtered) != 0 {
+			return fmt.Errorf("expected datastore %q to be filtered out, got %v", datastores[0].Info.Url, filtered)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMultiWriterDiskDetachFromOneNode(t *testing.T) {
+	model := simulator.VPX()
+	defer model.Remove()
+	err := model.Run(func(ctx context.Context, c *vim25.Client) error {
+		const diskID = "fcd-multi-writer"
+		simVMs := model.Map().All("VirtualMachine")
+		if len(simVMs) < 2 {
+			return fmt.Errorf("expected at least 2 VMs, found %d", len(simVMs))
+		}
+		simVM1 := simVMs[0].(*simulator.VirtualMachine)
+		simVM2 := simVMs[1].(*simulator.VirtualMachine)
+		vm1 := &VirtualMachine{VirtualMachine: object.NewVirtualMachine(c, simVM1.Reference())}
+		vm2 := &VirtualMachine{VirtualMachine: object.NewVirtualMachine(c, simVM2.Reference())}
+
+		// Share the disk of the first VM with both VMs in multi-writer mode.
+		vm1Devices, err := vm1.Device(ctx)
+		if err != nil {
+			return err
+		}
+		disks := vm1Devices.SelectByType((*types.VirtualDisk)(nil))
+		if len(disks) == 0 {
+			return fmt.Errorf("expected VM %v to have a disk", vm1)
+		}
+		backing := disks[0].(*types.VirtualDisk).Backing.(*types.VirtualDiskFlatVer2BackingInfo)
+		datastore := &Datastore{Datastore: object.NewDatastore(c, *backing.Datastore)}
+		for _, vm := range []*VirtualMachine{vm1, vm2} {
+			if err := vm.AttachMultiWriterDisk(ctx, diskID, backing.FileName, datastore, -1, -1); err != nil {
+				return err
+			}
+		}
+		// The simulator does not report the id of first class disks.
+		for _, simVM := range []*simulator.VirtualMachine{simVM1, simVM2} {
+			for _, device := range simVM.Config.Hardware.Device {
+				disk, ok := device.(*types.VirtualDisk)
+				if !ok {
+					continue
+				}
+				diskBacking := disk.Backing.(*types.VirtualDiskFlatVer2BackingInfo)
+				if diskBacking.Sharing == string(types.VirtualDiskSharingSharingMultiWriter) {
+					disk.VDiskId = &types.ID{Id: diskID}
+				}
+			}
+		}
+
+		// Detaching from the first node leaves the disk attached to the second.
+		detached, err := vm1.DetachMultiWriterDisk(ctx, diskID)
+		if err != nil || !detached {
+			return fmt.Errorf("expected disk to be detached from %v, got detached: %t, err: %v", vm1, detached, err)
+		}
+		for vm, expectAttached := range map[*VirtualMachine]bool{vm1: false, vm2: true} {
+			devices, err := vm.Device(ctx)
+			if err != nil {
+				return err
+			}
+			if attached := findMultiWriterDisk(devices, diskID) != nil; attached != expectAttached {
+				return fmt.Errorf("expected disk attached to %v to be %t, got %t", vm, expectAttached, attached)
+			}
+		}
+		// Detaching again from the first node is a no-op.
+		detached, err = vm1.DetachMultiWriterDisk(ctx, diskID)
+		if err != nil || detached {
+			return fmt.Errorf("expected no detach from %v, got detached: %t, err: %v", vm1, detached, err)
+		}
+
+		// The VM of a dead node may be removed before its disks are detached.
+		task, err := vm2.PowerOff(ctx)
+		if err != nil {
+			return err
+		}
+		if err = task.Wait(ctx); err != nil {
+			return err
+		}
+		if err = vm2.Unregister(ctx); err != nil {
+			return err
+		}
+		if _, err = vm2.DetachMultiWriterDisk(ctx, diskID); err != ErrVMNotFound {
+			return fmt.Errorf("expected %v for removed vm, got %v", ErrVMNotFound, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetVirtualMachineByUUIDWithUnavailableVCenter(t *testing.T) {
+	ctx := context.Background()
+	newVCenter := func(host string) (*VirtualCenter, *simulator.Model) {
+		model := simulator.VPX()
+		if err := model.Create(); err != nil {
+			t.Fatal(err)
+		}
+		model.Service.RegisterEndpoints = true
+		model.Service.TLS = new(tls.Config)
+		s := model.Service.NewServer()
+		t.Cleanup(func() {
+			s.Close()
+			model.Remove()
+		})
+		port, err := strconv.Atoi(s.URL.Port())
+		if err != nil {
+			t.Fatal(err)
+		}
+		password, _ := s.URL.User.Password()
+		return &VirtualCenter{
+			Config: &VirtualCenterConfig{
+				Host:     host,
+				Port:     port,
+				Username: s.URL.User.Username(),
+				Password: password,
+				Insecure: true,
+			},
+			ClientMutex: &sync.Mutex{},
+		}, model
+	}
+	unavailableVC, _ := newVCenter("127.0.0.1")
+	availableVC, model := newVCenter("localhost")
+	// Connecting to vCenter reads the config for the session user agent.
+	confPath := filepath.Join(t.TempDir(), "vsphere.conf")
+	conf := fmt.Sprintf("[Global]\ninsecure-flag = \"true\"\ncluster-id = \"test-cluster\"\n"+
+		"[VirtualCenter \"%s\"]\nuser = \"user@vsphere.local\"\npassword = \"pass\"\nport = \"%d\"\n",
+		availableVC.Config.Host, availableVC.Config.Port)
+	if err := os.WriteFile(confPath, []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VSPHERE_CSI_CONFIG", confPath)
+	vmObj := model.Map().Any("VirtualMachine").(*simulator.VirtualMachine)
+	uuid := vmObj.Config.Uuid
+
+	// Open the circuit breaker of the unavailable vCenter.
+	defer inventoryBreakers.Delete(unavailableVC.Config.Host)
+	getInventoryCircuitBreaker(unavailableVC.Config.Host).openUntil = time.Now().Add(time.Hour)
+
+	// The VM is found on the available vCenter, whichever vCenter is searched
+	// first.
+	for _, vcs := range [][]*VirtualCenter{{unavailableVC, availableVC}, {availableVC, unavailableVC}} {
+		found, err := getVirtualMachineByUUID(ctx, vcs, uuid, false)
+		if err != nil {
+			t.Fatalf("failed to find VM %s: %v", uuid, err)
+		}
+		if found.VirtualCenterHost != availableVC.Config.Host || found.Reference() != vmObj.Reference() {
+			t.Errorf("expected VM %v on vCenter %s, got %v on vCenter %s", vmObj.Reference(),
+				availableVC.Config.Host, found.Reference(), found.VirtualCenterHost)
+		}
+	}
+	// A VM missing on the available vCenter may be on the unavailable one.
+	_, err := getVirtualMachineByUUID(ctx, []*VirtualCenter{unavailableVC, availableVC},
+		"00000000-0000-0000-0000-000000000000", false)
+	if !errors.Is(err, ErrVCenterInventoryUnavailable) {
+		t.Errorf("expected ErrVCenterInventoryUnavailable, got %v", err)
+	}
+	_, err = getVirtualMachineByUUID(ctx, []*VirtualCenter{availableVC},
+		"00000000-0000-0000-0000-000000000000", false)
+	if !errors.Is(err, ErrVMNotFound) {
+		t.Errorf("expected ErrVMNotFound, got %v", err)
+	}
+}
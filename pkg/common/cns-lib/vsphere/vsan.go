@@ -19,10 +19,22 @@ package vsphere
 import (
 	"context"
 
+	"github.com/vmware/govmomi/vim25"
 	"github.com/vmware/govmomi/vsan"
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
 )
 
+// NewVsanClient creates a new VSAN client.
+func NewVsanClient(ctx context.Context, c *vim25.Client) (*vsan.Client, error) {
+	vsanClient, err := vsan.NewClient(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	vsanClient.RoundTripper = newServiceSessionRetryRoundTripper(c, vsanClient.Client,
+		&MetricRoundTripper{"vsan", &apiCallRoundTripper{"vsan", vsanClient.RoundTripper}})
+	return vsanClient, nil
+}
+
 // ConnectVsan creates a VSAN client for the virtual center.
 func (vc *VirtualCenter) ConnectVsan(ctx context.Context) error {
 	log := logger.GetLogger(ctx)
@@ -32,7 +44,7 @@ func (vc *VirtualCenter) ConnectVsan(ctx context.Context) error {
 		return err
 	}
 	if vc.VsanClient == nil {
-		if vc.VsanClient, err = vsan.NewClient(ctx, vc.Client.Client); err != nil {
+		if vc.VsanClient, err = NewVsanClient(ctx, vc.Client.Client); err != nil {
 			log.Errorf("failed to create vsan client with err: %v", err)
 			return err
 		}
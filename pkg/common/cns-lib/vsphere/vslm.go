@@ -18,23 +18,41 @@ package vsphere
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/vmware/govmomi/vim25"
 	"github.com/vmware/govmomi/vslm"
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
 )
 
-// NewVslmClient creates a new Vslm client
+// NewVslmClient creates a new Vslm client. An error wrapping ErrNotSupported
+// is returned if the vCenter does not serve the vslm endpoint.
 func NewVslmClient(ctx context.Context, c *vim25.Client) (*vslm.Client, error) {
 	log := logger.GetLogger(ctx)
 	vslmClient, err := vslm.NewClient(ctx, c)
 	if err != nil {
 		log.Errorf("failed to create a new client for Vslm. err: %v", err)
+		if isNotFoundStatusError(err) {
+			return nil, fmt.Errorf("vslm endpoint is %w by vCenter: %v", ErrNotSupported, err)
+		}
 		return nil, err
 	}
 	return vslmClient, nil
 }
 
+// isNotFoundStatusError returns true if err is the HTTP 404 status returned
+// for an endpoint which is not served.
+func isNotFoundStatusError(err error) bool {
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && urlErr.Err != nil &&
+		strings.HasPrefix(urlErr.Err.Error(), strconv.Itoa(http.StatusNotFound)+" ")
+}
+
 // ConnectVslm creates a Vslm client for the virtual center.
 func (vc *VirtualCenter) ConnectVslm(ctx context.Context) error {
 	log := logger.GetLogger(ctx)
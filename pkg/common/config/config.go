@@ -18,6 +18,8 @@ package config
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
@@ -26,6 +28,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	cnstypes "github.com/vmware/govmomi/cns/types"
 	vsanfstypes "github.com/vmware/govmomi/vsan/vsanfs/types"
@@ -84,6 +87,28 @@ const (
 	DefaultCnsVolumeOperationRequestCleanupIntervalInMin = 1440
 	// DefaultGlobalMaxSnapshotsPerBlockVolume is the default maximum number of block volume snapshots per volume.
 	DefaultGlobalMaxSnapshotsPerBlockVolume = 3
+	// DefaultTaskPollInitialIntervalInMs is the default interval before the first poll of a vCenter task.
+	DefaultTaskPollInitialIntervalInMs = 500
+	// DefaultTaskPollMaxIntervalInMs is the default maximum interval between two polls of a vCenter task.
+	DefaultTaskPollMaxIntervalInMs = 10000
+	// DefaultTaskPollMultiplier is the default factor by which the task poll interval grows.
+	DefaultTaskPollMultiplier = 2.0
+	// DefaultStuckTaskTimeoutInMin is the default time in minutes after which a
+	// CNS task which has not completed is considered stuck.
+	DefaultStuckTaskTimeoutInMin = 30
+	// DefaultQueryVolumeCacheTTLInSec is the default time for which a CNS
+	// QueryVolume result is cached by the volume manager.
+	DefaultQueryVolumeCacheTTLInSec = 10
+	// DefaultMaxConcurrentAttachesPerHost is the default maximum number of
+	// concurrent volume attach operations on an ESXi host.
+	DefaultMaxConcurrentAttachesPerHost = 8
+	// DefaultVCInventoryCallTimeoutInSec is the default timeout of the vCenter
+	// inventory calls.
+	DefaultVCInventoryCallTimeoutInSec = 60
+	// DefaultVCInventoryCircuitBreakerThreshold is the default number of
+	// consecutive timeouts of the vCenter inventory calls opening the circuit
+	// breaker.
+	DefaultVCInventoryCircuitBreakerThreshold = 5
 	// MaxNumberOfTopologyCategories is the max number of topology domains/categories allowed.
 	MaxNumberOfTopologyCategories = 5
 	// TopologyLabelsDomain is the domain name used to identify user-defined
@@ -121,6 +146,11 @@ var (
 	// ErrPasswordMissing is returned when the provided password is empty.
 	ErrPasswordMissing = errors.New("password is missing")
 
+	// ErrIncompleteClientCertificate is returned when only one of the client
+	// certificate and the client key is provided for mutual TLS.
+	ErrIncompleteClientCertificate = errors.New("both client-cert-file and client-key-file must be " +
+		"provided to authenticate to vCenter with a client certificate")
+
 	// ErrInvalidVCenterIP is returned when the provided vCenter IP address is
 	// missing from the provided configuration.
 	ErrInvalidVCenterIP = errors.New("vsphere.conf does not have the VirtualCenter IP address specified")
@@ -340,6 +370,30 @@ func isValidvCenterUsernameWithDomain(username string) bool {
 	return match
 }
 
+// validateClientCertificate verifies that the client certificate and key
+// files, if any, hold a valid and unexpired certificate and its private key.
+func validateClientCertificate(certFile string, keyFile string) error {
+	if certFile == "" && keyFile == "" {
+		return nil
+	}
+	if certFile == "" || keyFile == "" {
+		return ErrIncompleteClientCertificate
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load the client certificate %q and key %q: %w", certFile, keyFile, err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse the client certificate %q: %w", certFile, err)
+	}
+	if now := time.Now(); now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+		return fmt.Errorf("client certificate %q is only valid from %v to %v", certFile,
+			leaf.NotBefore, leaf.NotAfter)
+	}
+	return nil
+}
+
 func validateConfig(ctx context.Context, cfg *Config) error {
 	log := logger.GetLogger(ctx)
 	// Fix default global values.
@@ -415,6 +469,14 @@ func validateConfig(ctx context.Context, cfg *Config) error {
 		if !insecure {
 			vcConfig.InsecureFlag = cfg.Global.InsecureFlag
 		}
+		if vcConfig.ClientCertFile == "" && vcConfig.ClientKeyFile == "" {
+			vcConfig.ClientCertFile = cfg.Global.ClientCertFile
+			vcConfig.ClientKeyFile = cfg.Global.ClientKeyFile
+		}
+		if err := validateClientCertificate(vcConfig.ClientCertFile, vcConfig.ClientKeyFile); err != nil {
+			log.Errorf("invalid client certificate for vc %s. Error: %v", vcServer, err)
+			return err
+		}
 		if setCfgGlobalvCenter && cfg.Global.VCenterIP == "" {
 			cfg.Global.VCenterIP = vcServer
 		}
@@ -467,6 +529,38 @@ func validateConfig(ctx context.Context, cfg *Config) error {
 	if cfg.Snapshot.GlobalMaxSnapshotsPerBlockVolume == 0 {
 		cfg.Snapshot.GlobalMaxSnapshotsPerBlockVolume = DefaultGlobalMaxSnapshotsPerBlockVolume
 	}
+	if cfg.Global.QueryVolumeCacheTTLInSec == 0 {
+		cfg.Global.QueryVolumeCacheTTLInSec = DefaultQueryVolumeCacheTTLInSec
+	}
+	if cfg.Global.MaxConcurrentAttachesPerHost == 0 {
+		cfg.Global.MaxConcurrentAttachesPerHost = DefaultMaxConcurrentAttachesPerHost
+	}
+	if cfg.Global.VCInventoryCallTimeoutInSec <= 0 {
+		cfg.Global.VCInventoryCallTimeoutInSec = DefaultVCInventoryCallTimeoutInSec
+	}
+	if cfg.Global.VCInventoryCircuitBreakerThreshold <= 0 {
+		cfg.Global.VCInventoryCircuitBreakerThreshold = DefaultVCInventoryCircuitBreakerThreshold
+	}
+	if cfg.TaskPolling.InitialIntervalInMs == 0 {
+		cfg.TaskPolling.InitialIntervalInMs = DefaultTaskPollInitialIntervalInMs
+	}
+	if cfg.TaskPolling.MaxIntervalInMs == 0 {
+		cfg.TaskPolling.MaxIntervalInMs = DefaultTaskPollMaxIntervalInMs
+	}
+	if cfg.TaskPolling.Multiplier == 0 {
+		cfg.TaskPolling.Multiplier = DefaultTaskPollMultiplier
+	}
+	if cfg.TaskPolling.StuckTaskTimeoutInMin == 0 {
+		cfg.TaskPolling.StuckTaskTimeoutInMin = DefaultStuckTaskTimeoutInMin
+	}
+	if cfg.TaskPolling.InitialIntervalInMs < 0 || cfg.TaskPolling.MaxIntervalInMs < cfg.TaskPolling.InitialIntervalInMs {
+		return logger.LogNewErrorf(log, "invalid task polling intervals: initial-interval-ms %d, max-interval-ms %d",
+			cfg.TaskPolling.InitialIntervalInMs, cfg.TaskPolling.MaxIntervalInMs)
+	}
+	if cfg.TaskPolling.Multiplier < 1 {
+		return logger.LogNewErrorf(log, "invalid task polling multiplier %v, it must not be less than 1",
+			cfg.TaskPolling.Multiplier)
+	}
 
 	// Labels section validation - the customer can either provide topology
 	// domain info using zone,region parameters or by using the topologyCategories
@@ -18,11 +18,21 @@ package config
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"math/big"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 var (
@@ -266,6 +276,42 @@ func TestSnapshotConfigWhenMaxSpecifiedAsEnv(t *testing.T) {
 	}
 }
 
+func TestTaskPollingConfig(t *testing.T) {
+	cfg := &Config{
+		VirtualCenter: idealVCConfig,
+	}
+	err := validateConfig(ctx, cfg)
+	if err != nil {
+		t.Errorf("Unexpected error during config validation - %+v", err)
+	}
+	if cfg.TaskPolling.InitialIntervalInMs != DefaultTaskPollInitialIntervalInMs ||
+		cfg.TaskPolling.MaxIntervalInMs != DefaultTaskPollMaxIntervalInMs ||
+		cfg.TaskPolling.Multiplier != DefaultTaskPollMultiplier {
+		t.Errorf("Default task polling config incorrect: %+v", cfg.TaskPolling)
+	}
+
+	cfg = &Config{
+		VirtualCenter: idealVCConfig,
+		TaskPolling: TaskPollingConfig{
+			InitialIntervalInMs: 2000,
+			MaxIntervalInMs:     1000,
+		},
+	}
+	if err = validateConfig(ctx, cfg); err == nil {
+		t.Errorf("Expected error when max-interval-ms is less than initial-interval-ms")
+	}
+
+	cfg = &Config{
+		VirtualCenter: idealVCConfig,
+		TaskPolling: TaskPollingConfig{
+			Multiplier: 0.5,
+		},
+	}
+	if err = validateConfig(ctx, cfg); err == nil {
+		t.Errorf("Expected error when multiplier is less than 1")
+	}
+}
+
 func isConfigEqual(actual *Config, expected *Config) bool {
 	// TODO: Compare Global struct
 	// Compare VC Config
@@ -278,3 +324,57 @@ func isConfigEqual(actual *Config, expected *Config) bool {
 	}
 	return true
 }
+
+// writeClientCertificate writes a self-signed client certificate valid until
+// notAfter and its private key to the given directory.
+func writeClientCertificate(t *testing.T, dir string, notAfter time.Time) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "vsphere-csi"},
+		NotBefore:    notAfter.Add(-48 * time.Hour),
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+		0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func TestValidateClientCertificate(t *testing.T) {
+	if err := validateClientCertificate("", ""); err != nil {
+		t.Errorf("expected no error without client certificate, got %v", err)
+	}
+	certFile, keyFile := writeClientCertificate(t, t.TempDir(), time.Now().Add(24*time.Hour))
+	if err := validateClientCertificate(certFile, keyFile); err != nil {
+		t.Errorf("expected valid client certificate, got %v", err)
+	}
+	if err := validateClientCertificate(certFile, ""); !errors.Is(err, ErrIncompleteClientCertificate) {
+		t.Errorf("expected %v, got %v", ErrIncompleteClientCertificate, err)
+	}
+	if err := validateClientCertificate(certFile, certFile); err == nil {
+		t.Errorf("expected error for mismatched client certificate and key")
+	}
+	certFile, keyFile = writeClientCertificate(t, t.TempDir(), time.Now().Add(-time.Hour))
+	if err := validateClientCertificate(certFile, keyFile); err == nil {
+		t.Errorf("expected error for expired client certificate")
+	}
+}
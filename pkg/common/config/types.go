@@ -46,6 +46,11 @@ type Config struct {
 		// Thumbprint specifies the certificate thumbprint to use
 		// This has no effect if InsecureFlag is enabled.
 		Thumbprint string `gcfg:"thumbprint"`
+		// ClientCertFile and ClientKeyFile specify the paths to a client
+		// certificate and its private key in PEM format, to authenticate to
+		// vCenter with mutual TLS. Optional; both must be set to enable it.
+		ClientCertFile string `gcfg:"client-cert-file"`
+		ClientKeyFile  string `gcfg:"client-key-file"`
 		// Datacenter in which Node VMs are located.
 		Datacenters string `gcfg:"datacenters"`
 		// CnsRegisterVolumesCleanupIntervalInMin specifies the interval after which
@@ -54,7 +59,10 @@ type Config struct {
 		// VolumeMigrationCRCleanupIntervalInMin specifies the interval after which
 		// stale CnsVSphereVolumeMigration CRs will be cleaned up.
 		VolumeMigrationCRCleanupIntervalInMin int `gcfg:"volumemigration-cr-cleanup-intervalinmin"`
-		// Cluster Distribution Name
+		// ClusterDistribution is the cluster distribution set in the CNS metadata
+		// of the volumes, e.g. for chargeback in shared vCenters. It overrides
+		// the distribution detected from the version of the API server. Volumes
+		// are created with the default distribution if CNS rejects it.
 		ClusterDistribution string `gcfg:"cluster-distribution"`
 
 		//CSIAuthCheckIntervalInMin specifies the interval that the auth check for datastores will be trigger
@@ -71,6 +79,115 @@ type Config struct {
 		// ListVolumeThreshold specifies the maximum number of differences in volume that can exist between CNS
 		// and kubernetes
 		ListVolumeThreshold int `gcfg:"list-volume-threshold"`
+		// FileVolumesDisabled disables provisioning of ReadWriteMany and ReadOnlyMany
+		// file volumes on vSAN file services, for clusters without file services.
+		FileVolumesDisabled bool `gcfg:"file-volumes-disabled"`
+		// QueryVolumeCacheTTLInSec specifies how long the result of a CNS QueryVolume
+		// call for a single volume is cached by the volume manager.
+		QueryVolumeCacheTTLInSec int `gcfg:"query-volume-cache-ttl-seconds"`
+		// QueryVolumeCacheDisabled disables caching of CNS QueryVolume results.
+		QueryVolumeCacheDisabled bool `gcfg:"query-volume-cache-disabled"`
+		// CnsAuditLogEnabled enables the audit log of the CNS operations changing
+		// volumes. Audit records are written as JSON independent of the log level.
+		CnsAuditLogEnabled bool `gcfg:"cns-audit-log-enabled"`
+		// MaxConcurrentAttachesPerHost is the maximum number of volume attach
+		// operations the controller runs concurrently on an ESXi host. Excess
+		// attach requests are queued. A negative value disables the limit.
+		MaxConcurrentAttachesPerHost int `gcfg:"max-concurrent-attaches-per-host"`
+		// MaxConcurrentDetachesPerHost is the maximum number of volume detach
+		// operations the controller runs concurrently on an ESXi host. Excess
+		// detach requests are queued. The limit is disabled by default, or if
+		// the value is not positive.
+		MaxConcurrentDetachesPerHost int `gcfg:"max-concurrent-detaches-per-host"`
+		// MaxConcurrentDetachesPerNode is the maximum number of volumes the
+		// controller detaches concurrently from a node VM, e.g. while the node
+		// is drained. Excess detach requests are queued. The limit is disabled
+		// by default, or if the value is not positive.
+		MaxConcurrentDetachesPerNode int `gcfg:"max-concurrent-detaches-per-node"`
+		// RelocateOnInaccessibleDatastoreAttach enables relocating a volume to a
+		// datastore accessible from the host of the node VM, compatible with the
+		// storage policy of the volume, when attaching the volume fails because
+		// its datastore is not accessible from the host.
+		RelocateOnInaccessibleDatastoreAttach bool `gcfg:"relocate-on-inaccessible-datastore-attach"`
+		// GroupSnapshotEnabled advertises the volume group snapshot capability.
+		// The member snapshots of a group are taken one after the other without
+		// quiescing I/O, so a group is not crash-consistent as a whole. Enable it
+		// only if the applications quiesce their I/O while a group is snapshotted.
+		GroupSnapshotEnabled bool `gcfg:"group-snapshot-enabled"`
+		// PlacementStrategy is the strategy to pick the datastore of a volume among
+		// several compatible datastores, for the storage classes which do not set
+		// the placementstrategy parameter: capacity-weighted, absolute-free,
+		// percent-free or round-robin. If empty, the datastore is chosen by CNS.
+		PlacementStrategy string `gcfg:"placement-strategy"`
+		// SyncedPVCLabelKeys is a comma separated list of the PVC label keys which
+		// the metadata syncer propagates to the CNS volume metadata. All PVC
+		// labels are propagated if it is not set.
+		SyncedPVCLabelKeys string `gcfg:"synced-pvc-label-keys"`
+		// VCInventoryCallTimeoutInSec is the timeout of the vCenter inventory
+		// calls, e.g. the lookup of node VMs.
+		VCInventoryCallTimeoutInSec int `gcfg:"vc-inventory-call-timeout-seconds"`
+		// VCInventoryCircuitBreakerThreshold is the number of consecutive timeouts
+		// of the vCenter inventory calls after which calls fail fast for a
+		// cooldown period.
+		VCInventoryCircuitBreakerThreshold int `gcfg:"vc-inventory-circuit-breaker-threshold"`
+		// MaxConcurrentCreateVolumeRequests is the maximum number of CreateVolume
+		// requests the controller serves concurrently. 0 disables the limit.
+		// The request limits below are read when the controller starts and are
+		// not reloaded with the rest of the config.
+		MaxConcurrentCreateVolumeRequests int `gcfg:"max-concurrent-create-volume-requests"`
+		// MaxConcurrentDeleteVolumeRequests is the maximum number of DeleteVolume
+		// requests the controller serves concurrently. 0 disables the limit.
+		MaxConcurrentDeleteVolumeRequests int `gcfg:"max-concurrent-delete-volume-requests"`
+		// MaxConcurrentAttachRequests is the maximum number of
+		// ControllerPublishVolume requests the controller serves concurrently.
+		// 0 disables the limit.
+		MaxConcurrentAttachRequests int `gcfg:"max-concurrent-attach-requests"`
+		// MaxConcurrentDetachRequests is the maximum number of
+		// ControllerUnpublishVolume requests the controller serves concurrently.
+		// 0 disables the limit.
+		MaxConcurrentDetachRequests int `gcfg:"max-concurrent-detach-requests"`
+		// MaxConcurrentSnapshotRequests is the maximum number of CreateSnapshot
+		// and DeleteSnapshot requests the controller serves concurrently.
+		// 0 disables the limit.
+		MaxConcurrentSnapshotRequests int `gcfg:"max-concurrent-snapshot-requests"`
+		// MaxSnapshotOpsPerSecond is the rate, in operations per second, at
+		// which the controller serves CreateSnapshot and DeleteSnapshot
+		// requests, e.g. to protect vCenter from scheduled backups. Requests
+		// exceeding the rate are rejected with Aborted, so that the snapshotter
+		// retries them with back-off. 0 disables the limit.
+		MaxSnapshotOpsPerSecond float64 `gcfg:"max-snapshot-ops-per-second"`
+		// SnapshotOpsBurst is the number of snapshot requests served at once
+		// above MaxSnapshotOpsPerSecond. Defaults to the rate rounded up if 0.
+		SnapshotOpsBurst int `gcfg:"snapshot-ops-burst"`
+		// RequestQueueTimeoutInSec is the time a request exceeding one of the
+		// concurrency limits waits for a slot before being rejected with
+		// ResourceExhausted, so that the sidecar retries it with back-off.
+		// Excess requests are rejected right away if it is 0.
+		RequestQueueTimeoutInSec int `gcfg:"request-queue-timeout-seconds"`
+		// MaxDatastoreOvercommitPercent is the maximum ratio, in percent, of
+		// the space provisioned on a datastore to its capacity. New block
+		// volumes are not placed on datastores this ratio would be exceeded
+		// on, e.g. 150 allows thin provisioning up to one and a half times the
+		// capacity of a datastore. 0 disables the policy.
+		MaxDatastoreOvercommitPercent int `gcfg:"max-datastore-overcommit-percent"`
+		// ReconcileAttachmentsOnStartup enables repairing, when a controller
+		// replica becomes the leader of the reconcilers, the attachments of
+		// block volumes which do not match their VolumeAttachments, e.g. after
+		// the controller crashed while attaching a volume.
+		ReconcileAttachmentsOnStartup bool `gcfg:"reconcile-attachments-on-startup"`
+		// OrphanedAttachmentConfirmationInMin is the time for which a volume
+		// must stay attached to a node VM with no VolumeAttachment before the
+		// startup reconciliation detaches it. Defaults to 10 minutes if 0.
+		OrphanedAttachmentConfirmationInMin int `gcfg:"orphaned-attachment-confirmation-minutes"`
+		// SnapshotDeletePolicy is the behavior of DeleteVolume for block
+		// volumes which still have snapshots and whose StorageClass does not
+		// set one, either "fail" or "cascade", which only deletes the orphaned
+		// CNS snapshots no VolumeSnapshotContent references. Defaults to "fail".
+		SnapshotDeletePolicy string `gcfg:"snapshot-delete-policy"`
+		// TopologyDebugPort is the port of the debug endpoint dumping the
+		// topology caches of the controller as JSON, served on localhost only.
+		// 0 disables the endpoint.
+		TopologyDebugPort int `gcfg:"topology-debug-port"`
 	}
 
 	// Multiple sets of Net Permissions applied to all file shares
@@ -80,9 +197,21 @@ type Config struct {
 	// Virtual Center configurations
 	VirtualCenter map[string]*VirtualCenterConfig
 
+	// Provisioning quotas of the namespaces, keyed by namespace name
+	NamespaceQuota map[string]*NamespaceQuotaConfig
+
+	// Attach limits of the ESXi hosts, keyed by host hardware model
+	HostAttachLimit map[string]*HostAttachLimitConfig
+
+	// Classification of the CNS faults, keyed by fault type
+	FaultClassification map[string]*FaultClassificationConfig
+
 	// Snapshot configurations.
 	Snapshot SnapshotConfig
 
+	// TaskPolling configurations.
+	TaskPolling TaskPollingConfig
+
 	// Guest Cluster configurations, only used by GC
 	GC GCConfig
 
@@ -98,6 +227,10 @@ type Config struct {
 		// create in the inventory using the UI.
 		// Maximum number of categories allowed is 5.
 		TopologyCategories string `gcfg:"topology-categories"`
+		// HostTopology adds the ESXi host of the node VMs to their topology
+		// labels, so that volumes provisioned on datastores local to a host are
+		// only accessible from the nodes on that host.
+		HostTopology bool `gcfg:"host-topology"`
 	}
 
 	TopologyCategory map[string]*TopologyCategoryInfo
@@ -130,6 +263,34 @@ type NetPermissionConfig struct {
 	RootSquash bool `gcfg:"rootsquash"`
 }
 
+// NamespaceQuotaConfig caps the storage provisioned for the PVCs of a
+// namespace, accounted from the capacity of their CNS volumes.
+type NamespaceQuotaConfig struct {
+	// MaxCapacityInMB is the maximum total capacity in MB of the block volumes
+	// provisioned for the namespace. The quota is disabled if it is 0.
+	MaxCapacityInMB int64 `gcfg:"max-capacity-in-mb"`
+}
+
+// HostAttachLimitConfig overrides the maximum number of concurrent volume
+// attach operations on the ESXi hosts of a hardware model, e.g. for hosts
+// with stricter HotAdd limits than the others.
+type HostAttachLimitConfig struct {
+	// MaxConcurrentAttaches is the maximum number of volume attach operations
+	// the controller runs concurrently on a host of the hardware model. The
+	// global max-concurrent-attaches-per-host applies if it is 0. A negative
+	// value disables the limit.
+	MaxConcurrentAttaches int `gcfg:"max-concurrent-attaches"`
+}
+
+// FaultClassificationConfig overrides the classification of a CNS fault type,
+// e.g. "vim.fault.FileLocked", as retryable or terminal.
+type FaultClassificationConfig struct {
+	// GRPCCode is the gRPC code returned for the requests failing with the
+	// fault type: Aborted or Unavailable if the fault is retryable,
+	// FailedPrecondition or Internal if it is terminal.
+	GRPCCode string `gcfg:"grpc-code"`
+}
+
 // VirtualCenterConfig contains information used to access a remote vCenter
 // endpoint.
 type VirtualCenterConfig struct {
@@ -148,6 +309,12 @@ type VirtualCenterConfig struct {
 	// Thumbprint specifies the certificate thumbprint to use
 	// This has no effect if InsecureFlag is enabled.
 	Thumbprint string `gcfg:"thumbprint"`
+	// ClientCertFile and ClientKeyFile specify the paths to a client
+	// certificate and its private key in PEM format, to authenticate to
+	// vCenter with mutual TLS. Optional; if not configured, the ones of the
+	// Global section will be used.
+	ClientCertFile string `gcfg:"client-cert-file"`
+	ClientKeyFile  string `gcfg:"client-key-file"`
 	// Datacenter in which VMs are located.
 	Datacenters string `gcfg:"datacenters"`
 	// TargetvSANFileShareClusters represents file service enabled vSAN clusters on which file volumes can be created.
@@ -190,5 +357,19 @@ type SnapshotConfig struct {
 	GranularMaxSnapshotsPerBlockVolumeInVVOL int `gcfg:"granular-max-snapshots-per-block-volume-vvol"`
 }
 
+// TaskPollingConfig contains the backoff used while polling vCenter tasks for completion.
+type TaskPollingConfig struct {
+	// InitialIntervalInMs is the interval in milliseconds before the first poll of a task.
+	InitialIntervalInMs int `gcfg:"initial-interval-ms"`
+	// MaxIntervalInMs is the maximum interval in milliseconds between two polls of a task.
+	MaxIntervalInMs int `gcfg:"max-interval-ms"`
+	// Multiplier is the factor by which the poll interval grows after every poll.
+	Multiplier float64 `gcfg:"multiplier"`
+	// StuckTaskTimeoutInMin is the time in minutes after which a CNS task which
+	// has not completed is considered stuck, and the operation is retried.
+	// A negative value disables the detection of stuck tasks.
+	StuckTaskTimeoutInMin int `gcfg:"stuck-task-timeout-minutes"`
+}
+
 // EnvClusterFlavor is the k8s cluster type on which CSI Driver is being deployed
 const EnvClusterFlavor = "CLUSTER_FLAVOR"
@@ -0,0 +1,130 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fault
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+)
+
+// defaultFaultCodes classifies the common CNS fault types. Retryable faults
+// map to codes.Aborted, if the operation conflicts with another one, or to
+// codes.Unavailable, if a component is temporarily unavailable, so that the
+// sidecars retry the request. Terminal faults map to codes.FailedPrecondition,
+// if the request cannot succeed until the state of the system is changed, or
+// to codes.Internal.
+var defaultFaultCodes = map[string]codes.Code{
+	VimFaultPrefix + "ResourceInUse":     codes.Aborted,
+	VimFaultPrefix + "TaskInProgress":    codes.Aborted,
+	VimFaultPrefix + "ConcurrentAccess":  codes.Aborted,
+	VimFaultPrefix + "FileLocked":        codes.Aborted,
+	VimFaultInvalidHostState:             codes.Unavailable,
+	VimFaultHostNotConnected:             codes.Unavailable,
+	VimFaultPrefix + "HostCommunication": codes.Unavailable,
+	VimFaultPrefix + "Timedout":          codes.Unavailable,
+	VimFaultPrefix + "NotFound":          codes.FailedPrecondition,
+	VimFaultPrefix + "InvalidDatastore":  codes.FailedPrecondition,
+	VimFaultPrefix + "NotSupported":      codes.FailedPrecondition,
+	VimFaultPrefix + "NoPermission":      codes.FailedPrecondition,
+	VimFaultPrefix + "InvalidArgument":   codes.FailedPrecondition,
+	VimFaultPrefix + "CnsFault":          codes.Internal,
+	VimFaultPrefix + "InsufficientSpace": codes.FailedPrecondition,
+}
+
+// classifiableCodes are the gRPC codes a fault type can be classified with,
+// mapped to whether they are retryable.
+var classifiableCodes = map[codes.Code]bool{
+	codes.Aborted:            true,
+	codes.Unavailable:        true,
+	codes.FailedPrecondition: false,
+	codes.Internal:           false,
+}
+
+var (
+	faultCodes    = defaultFaultCodes
+	faultCodesMux sync.RWMutex
+)
+
+// SetFaultCodeOverrides overrides the classification of the fault types with
+// the names of the gRPC codes they map to, e.g. "Unavailable". The overrides
+// with a gRPC code other than Aborted, Unavailable, FailedPrecondition and
+// Internal are ignored.
+func SetFaultCodeOverrides(ctx context.Context, overrides map[string]string) {
+	log := logger.GetLogger(ctx)
+	classified := make(map[string]codes.Code, len(defaultFaultCodes)+len(overrides))
+	for faultType, code := range defaultFaultCodes {
+		classified[faultType] = code
+	}
+	for faultType, codeName := range overrides {
+		code, ok := getClassifiableCode(codeName)
+		if !ok {
+			log.Warnf("Ignoring classification of fault %q with gRPC code %q. Expected one of Aborted, "+
+				"Unavailable, FailedPrecondition or Internal", faultType, codeName)
+			continue
+		}
+		log.Infof("Classifying fault %q with gRPC code %s", faultType, code)
+		classified[faultType] = code
+	}
+	faultCodesMux.Lock()
+	defer faultCodesMux.Unlock()
+	faultCodes = classified
+}
+
+// getClassifiableCode returns the classifiable gRPC code with the given name,
+// matched case-insensitively.
+func getClassifiableCode(codeName string) (codes.Code, bool) {
+	for code := range classifiableCodes {
+		if strings.EqualFold(code.String(), strings.TrimSpace(codeName)) {
+			return code, true
+		}
+	}
+	return codes.OK, false
+}
+
+// GetFaultCode returns the gRPC code the fault type is classified with, and
+// false if the fault type is not classified.
+func GetFaultCode(faultType string) (codes.Code, bool) {
+	faultCodesMux.RLock()
+	defer faultCodesMux.RUnlock()
+	code, ok := faultCodes[faultType]
+	return code, ok
+}
+
+// IsRetryableFault returns true if the fault type is classified as
+// retryable, i.e. with codes.Aborted or codes.Unavailable.
+func IsRetryableFault(faultType string) bool {
+	code, ok := GetFaultCode(faultType)
+	return ok && classifiableCodes[code]
+}
+
+// ClassifyFaultCode returns the gRPC code to return for a request failing
+// with the fault type. The code of the classification of the fault type
+// replaces code only if code is codes.Internal or codes.Unknown, so that the
+// codes chosen explicitly by the services are kept.
+func ClassifyFaultCode(faultType string, code codes.Code) codes.Code {
+	if code != codes.Internal && code != codes.Unknown {
+		return code
+	}
+	if classified, ok := GetFaultCode(faultType); ok {
+		return classified
+	}
+	return code
+}
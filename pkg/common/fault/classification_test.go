@@ -0,0 +1,90 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fault
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestClassifyFaultCode(t *testing.T) {
+	SetFaultCodeOverrides(context.Background(), nil)
+	tests := []struct {
+		faultType string
+		code      codes.Code
+		expected  codes.Code
+		retryable bool
+	}{
+		{VimFaultPrefix + "ResourceInUse", codes.Internal, codes.Aborted, true},
+		{VimFaultPrefix + "FileLocked", codes.Unknown, codes.Aborted, true},
+		{VimFaultHostNotConnected, codes.Internal, codes.Unavailable, true},
+		{VimFaultInvalidHostState, codes.Internal, codes.Unavailable, true},
+		{VimFaultPrefix + "NotFound", codes.Internal, codes.FailedPrecondition, false},
+		{VimFaultPrefix + "NoPermission", codes.Internal, codes.FailedPrecondition, false},
+		{VimFaultPrefix + "CnsFault", codes.Internal, codes.Internal, false},
+		// The codes chosen explicitly by the services are kept.
+		{VimFaultPrefix + "ResourceInUse", codes.NotFound, codes.NotFound, true},
+		// Unclassified faults keep the code of the service.
+		{VimFaultPrefix + "Unclassified", codes.Internal, codes.Internal, false},
+		{"", codes.Unknown, codes.Unknown, false},
+	}
+	for _, test := range tests {
+		if code := ClassifyFaultCode(test.faultType, test.code); code != test.expected {
+			t.Errorf("ClassifyFaultCode(%q, %v) = %v, expected %v", test.faultType, test.code, code,
+				test.expected)
+		}
+		if retryable := IsRetryableFault(test.faultType); retryable != test.retryable {
+			t.Errorf("IsRetryableFault(%q) = %v, expected %v", test.faultType, retryable, test.retryable)
+		}
+	}
+}
+
+func TestSetFaultCodeOverrides(t *testing.T) {
+	ctx := context.Background()
+	defer SetFaultCodeOverrides(ctx, nil)
+	SetFaultCodeOverrides(ctx, map[string]string{
+		VimFaultPrefix + "FileLocked":   "FailedPrecondition",
+		VimFaultPrefix + "NotFound":     "unavailable",
+		VimFaultPrefix + "CustomFault":  "Aborted",
+		VimFaultPrefix + "InvalidCode":  "NotFound",
+		VimFaultPrefix + "UnknownCode":  "Retry",
+		VimFaultPrefix + "NoPermission": "",
+	})
+	tests := map[string]codes.Code{
+		VimFaultPrefix + "FileLocked":    codes.FailedPrecondition,
+		VimFaultPrefix + "NotFound":      codes.Unavailable,
+		VimFaultPrefix + "CustomFault":   codes.Aborted,
+		VimFaultPrefix + "InvalidCode":   codes.Internal,
+		VimFaultPrefix + "UnknownCode":   codes.Internal,
+		VimFaultPrefix + "NoPermission":  codes.FailedPrecondition,
+		VimFaultPrefix + "ResourceInUse": codes.Aborted,
+	}
+	for faultType, expected := range tests {
+		if code := ClassifyFaultCode(faultType, codes.Internal); code != expected {
+			t.Errorf("ClassifyFaultCode(%q) = %v, expected %v", faultType, code, expected)
+		}
+	}
+	if IsRetryableFault(VimFaultPrefix + "FileLocked") {
+		t.Errorf("expected overridden fault %q to be terminal", VimFaultPrefix+"FileLocked")
+	}
+
+	SetFaultCodeOverrides(ctx, nil)
+	if code, _ := GetFaultCode(VimFaultPrefix + "FileLocked"); code != codes.Aborted {
+		t.Errorf("expected default classification of %q to be restored, got %v", VimFaultPrefix+"FileLocked", code)
+	}
+}
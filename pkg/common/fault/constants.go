@@ -66,6 +66,11 @@ const (
 	CSIInvalidArgumentFault = "csi.fault.InvalidArgument"
 	// CSIUnimplementedFault is the fault type returned when the function is unimplemented.
 	CSIUnimplementedFault = "csi.fault.Unimplemented"
+	// CSIFailedPreconditionFault is the fault type returned when the volume is not in a state allowing the
+	// operation.
+	CSIFailedPreconditionFault = "csi.fault.FailedPrecondition"
+	// CSIResourceExhaustedFault is the fault type returned when the datastore does not have enough free space.
+	CSIResourceExhaustedFault = "csi.fault.ResourceExhausted"
 	// CSIInvalidStoragePolicyConfigurationFault is the fault type returned when the user provides invalid storage policy.
 	CSIInvalidStoragePolicyConfigurationFault = "csi.fault.invalidconfig.InvalidStoragePolicyConfiguration"
 
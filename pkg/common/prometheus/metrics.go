@@ -41,6 +41,8 @@ const (
 	PrometheusDetachVolumeOpType = "detach-volume"
 	// PrometheusExpandVolumeOpType represents the ExpandVolume operation.
 	PrometheusExpandVolumeOpType = "expand-volume"
+	// PrometheusModifyVolumeOpType represents the ControllerModifyVolume operation.
+	PrometheusModifyVolumeOpType = "modify-volume"
 	// PrometheusCreateSnapshotOpType represents CreateSnapshot operation.
 	PrometheusCreateSnapshotOpType = "create-snapshot"
 	// PrometheusDeleteSnapshotOpType represents DeleteSnapshot operation.
@@ -49,6 +51,14 @@ const (
 	PrometheusListSnapshotsOpType = "list-snapshot"
 	// PrometheusListVolumeOpType represents the ListVolumes operation.
 	PrometheusListVolumeOpType = "list-volume"
+	// PrometheusGetVolumeOpType represents the ControllerGetVolume operation.
+	PrometheusGetVolumeOpType = "get-volume"
+	// PrometheusCreateGroupSnapshotOpType represents CreateVolumeGroupSnapshot operation.
+	PrometheusCreateGroupSnapshotOpType = "create-group-snapshot"
+	// PrometheusDeleteGroupSnapshotOpType represents DeleteVolumeGroupSnapshot operation.
+	PrometheusDeleteGroupSnapshotOpType = "delete-group-snapshot"
+	// PrometheusGetGroupSnapshotOpType represents GetVolumeGroupSnapshot operation.
+	PrometheusGetGroupSnapshotOpType = "get-group-snapshot"
 
 	// CNS operation types
 
@@ -91,6 +101,11 @@ const (
 	PrometheusPassStatus = "pass"
 	// PrometheusFailStatus represents an unsuccessful API run.
 	PrometheusFailStatus = "fail"
+
+	// PrometheusSuccessResult represents a CNS task which completed successfully.
+	PrometheusSuccessResult = "success"
+	// PrometheusErrorResult represents a CNS task which failed or timed out.
+	PrometheusErrorResult = "error"
 )
 
 var (
@@ -136,6 +151,19 @@ var (
 		// Possible status - "pass", "fail"
 		[]string{"optype", "status"})
 
+	// CnsTaskLatencyHistVec is a histogram vector metric to observe the time taken
+	// by individual CNS tasks on vCenter, as seen by the client waiting on the task.
+	CnsTaskLatencyHistVec = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "vsphere_cns_task_latency_seconds",
+		Help: "Histogram vector for latency of CNS tasks on vCenter.",
+		// CNS tasks may take several minutes on a busy vCenter, hence the buckets
+		// go up to the default volume operation timeout of 300 seconds.
+		Buckets: []float64{1, 2, 5, 10, 15, 20, 30, 60, 90, 120, 180, 240, 300},
+	},
+		// Possible operation - "create-volume", "delete-volume", "attach-volume", "detach-volume"
+		// Possible result - "success", "error"
+		[]string{"operation", "datastore", "storage_policy", "result"})
+
 	// VolumeHealthGaugeVec is a gauge metric to observe the number of accessible and inaccessible volumes.
 	VolumeHealthGaugeVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "vsphere_volume_health_gauge",
@@ -156,9 +184,105 @@ var (
 		// Possible status - "pass", "fail"
 		[]string{"status"})
 
+	// FullSyncDurationGauge is a gauge metric to observe the duration of the
+	// last CSI Full Sync of each vCenter, which may exceed the buckets of
+	// FullSyncOpsHistVec for clusters with many volumes.
+	FullSyncDurationGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vsphere_full_sync_duration_seconds",
+		Help: "Duration in seconds of the last CSI Full Sync",
+	},
+		[]string{"vcenter"})
+
+	// VCInventoryCircuitBreakerOpen is a gauge metric set to 1 while the circuit
+	// breaker of the vCenter inventory calls is open, and to 0 otherwise.
+	VCInventoryCircuitBreakerOpen = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vsphere_vc_inventory_circuit_breaker_open",
+		Help: "Whether the circuit breaker of the vCenter inventory calls is open",
+	},
+		[]string{"vcenter"})
+
 	RequestOpsMetric = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "vsphere_request_ops_seconds",
 		Help:    "Histogram vector for individual request to vCenter",
 		Buckets: []float64{2, 5, 10, 15, 20, 25, 30, 60, 120, 180},
 	}, []string{"request", "client", "status"})
+
+	// VCenterAPICallCount is a counter metric to observe the number of calls
+	// sent to the vCenter APIs, including the session logins and each retry of
+	// a request, by client and method. The latency of the requests is
+	// observed by RequestOpsMetric.
+	// Expected values for result are "success", "fault" for the faults
+	// returned by vCenter, and "error" for the calls which did not reach
+	// vCenter or whose response was not received.
+	VCenterAPICallCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vsphere_vcenter_api_calls_total",
+		Help: "Number of calls to the vCenter APIs",
+	}, []string{"client", "method", "result"})
+
+	// VCenterSessionReloginCount is a counter metric to observe the number of
+	// attempts to re-establish an expired vCenter session.
+	// Expected values for status are "pass" and "fail".
+	VCenterSessionReloginCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vsphere_vcenter_session_relogin_total",
+		Help: "Number of attempts to re-establish an expired vCenter session",
+	}, []string{"vcenter", "status"})
+
+	// NodeDetachBatchDurationHistVec is a histogram vector metric to observe
+	// the time taken to detach overlapping batches of volumes from a node,
+	// e.g. while it is drained, by the limit of concurrent detaches per node.
+	NodeDetachBatchDurationHistVec = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "vsphere_node_detach_batch_duration_seconds",
+		Help:    "Histogram vector for the time taken to detach batches of volumes from a node",
+		Buckets: []float64{1, 2, 5, 10, 15, 20, 30, 60, 90, 120, 180, 300, 600},
+	}, []string{"max_concurrent_detaches"})
+
+	// CnsStuckTaskCount is a counter metric to observe the number of CNS tasks
+	// which did not reach a terminal state within the stuck task timeout.
+	// Operation is the description ID of the task, e.g.
+	// "com.vmware.cns.tasks.createvolume".
+	CnsStuckTaskCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vsphere_cns_stuck_tasks_total",
+		Help: "Number of CNS tasks considered stuck",
+	}, []string{"operation"})
+
+	// CsiInFlightRequests is a gauge metric to observe the number of requests
+	// of each limited operation, i.e. "create-volume", "delete-volume",
+	// "attach", "detach" and "snapshot", which the controller is serving.
+	CsiInFlightRequests = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vsphere_csi_inflight_requests",
+		Help: "Number of requests being served by the controller, per limited operation",
+	}, []string{"operation"})
+
+	// CsiRejectedRequestCount is a counter metric to observe the number of
+	// requests rejected with ResourceExhausted as they exceeded the
+	// concurrency limit of their operation.
+	CsiRejectedRequestCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vsphere_csi_rejected_requests_total",
+		Help: "Number of requests rejected for exceeding the concurrency limit of their operation",
+	}, []string{"operation"})
+
+	// CsiSnapshotOpsRate is a gauge metric to observe the rate, in
+	// operations per second over the last minute, of the CreateSnapshot and
+	// DeleteSnapshot requests admitted by the controller. It is only observed
+	// if the rate of the snapshot requests is limited.
+	CsiSnapshotOpsRate = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "vsphere_csi_snapshot_ops_per_second",
+		Help: "Rate of the snapshot requests admitted by the controller over the last minute",
+	})
+
+	// MetadataDriftCorrectionCount is a counter metric to observe the number
+	// of volumes whose PVC metadata in CNS was corrected by the syncer as it
+	// did not match the PVC bound to their PV.
+	MetadataDriftCorrectionCount = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "vsphere_cns_metadata_drift_corrections_total",
+		Help: "Number of volumes whose PVC metadata in CNS was corrected",
+	})
+
+	// DatastoreOvercommitRatio is a gauge metric to observe the ratio of the
+	// space provisioned on a datastore to its capacity, as computed when
+	// placing block volumes with the overcommit policy enabled.
+	DatastoreOvercommitRatio = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vsphere_csi_datastore_overcommit_ratio",
+		Help: "Ratio of the space provisioned on the datastore to its capacity",
+	}, []string{"datastore_url"})
 )
@@ -356,6 +356,12 @@ func (c *FakeK8SOrchestrator) GetPVCNameFromCSIVolumeID(volumeID string) (string
 	return "", false
 }
 
+// GetPVCAnnotations returns the annotations of the PVC.
+func (c *FakeK8SOrchestrator) GetPVCAnnotations(ctx context.Context, name string,
+	namespace string) (map[string]string, error) {
+	return nil, nil
+}
+
 // InitializeCSINodes creates CSINode instances for each K8s node with the appropriate topology keys.
 func (c *FakeK8SOrchestrator) InitializeCSINodes(ctx context.Context) error {
 	return nil
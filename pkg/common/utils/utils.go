@@ -271,9 +271,51 @@ func QueryAllVolumesForCluster(ctx context.Context, m cnsvolume.Manager, cluster
 		return nil, logger.LogNewErrorCodef(log, codes.Internal,
 			"QueryAllVolume failed with err=%+v", err.Error())
 	}
+	FilterVolumesOfCluster(ctx, queryAllResult, clusterID)
 	return queryAllResult, nil
 }
 
+// IsVolumeOfCluster returns false if the container clusters of the volume are
+// returned by CNS and none of them has the given cluster ID. Volumes queried
+// without their metadata are assumed to belong to the cluster they were
+// queried for.
+func IsVolumeOfCluster(volume *cnstypes.CnsVolume, clusterID string) bool {
+	containerCluster := volume.Metadata.ContainerCluster
+	if containerCluster.ClusterId == "" && len(volume.Metadata.ContainerClusterArray) == 0 {
+		return true
+	}
+	if containerCluster.ClusterId == clusterID {
+		return true
+	}
+	for _, cluster := range volume.Metadata.ContainerClusterArray {
+		if cluster.ClusterId == clusterID {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterVolumesOfCluster removes from the query result the volumes which do
+// not belong to the given cluster, so that the volumes of other clusters
+// sharing the vCenter are never reconciled, even if CNS returns them.
+func FilterVolumesOfCluster(ctx context.Context, queryResult *cnstypes.CnsQueryResult, clusterID string) {
+	log := logger.GetLogger(ctx)
+	if queryResult == nil || clusterID == "" {
+		return
+	}
+	volumes := queryResult.Volumes[:0]
+	for i := range queryResult.Volumes {
+		if !IsVolumeOfCluster(&queryResult.Volumes[i], clusterID) {
+			log.Warnf("ignoring volume %q returned for cluster %q as it belongs to cluster %q",
+				queryResult.Volumes[i].VolumeId.Id, clusterID,
+				queryResult.Volumes[i].Metadata.ContainerCluster.ClusterId)
+			continue
+		}
+		volumes = append(volumes, queryResult.Volumes[i])
+	}
+	queryResult.Volumes = volumes
+}
+
 func GetVirtualMachineAllApiVersions(ctx context.Context, vmKey types.NamespacedName,
 	vmOperatorClient client.Client) (*vmoperatorv1alpha4.VirtualMachine, string, error) {
 	log := logger.GetLogger(ctx)
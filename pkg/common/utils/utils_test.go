@@ -176,3 +176,31 @@ func TestQuerySnapshotsUtil(t *testing.T) {
 		t.Log(entry)
 	}
 }
+
+func TestFilterVolumesOfCluster(t *testing.T) {
+	ctx := context.Background()
+	newVolume := func(id string, clusterID string, arrayClusterIDs ...string) types.CnsVolume {
+		volume := types.CnsVolume{VolumeId: types.CnsVolumeId{Id: id}}
+		volume.Metadata.ContainerCluster.ClusterId = clusterID
+		for _, arrayClusterID := range arrayClusterIDs {
+			volume.Metadata.ContainerClusterArray = append(volume.Metadata.ContainerClusterArray,
+				types.CnsContainerCluster{ClusterId: arrayClusterID})
+		}
+		return volume
+	}
+	queryResult := &types.CnsQueryResult{Volumes: []types.CnsVolume{
+		newVolume("vol-own", testClusterName),
+		newVolume("vol-other", "other-cluster"),
+		newVolume("vol-shared", "other-cluster", "other-cluster", testClusterName),
+		newVolume("vol-no-metadata", ""),
+	}}
+	FilterVolumesOfCluster(ctx, queryResult, testClusterName)
+	var volumeIDs []string
+	for _, volume := range queryResult.Volumes {
+		volumeIDs = append(volumeIDs, volume.VolumeId.Id)
+	}
+	expected := []string{"vol-own", "vol-shared", "vol-no-metadata"}
+	if fmt.Sprint(volumeIDs) != fmt.Sprint(expected) {
+		t.Errorf("Expected volumes %v after filtering, got %v", expected, volumeIDs)
+	}
+}
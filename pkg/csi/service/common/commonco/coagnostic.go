@@ -95,6 +95,9 @@ type COCommonInterface interface {
 	GetPVNameFromCSIVolumeID(volumeID string) (string, bool)
 	// GetPVCNameFromCSIVolumeID returns PV claim name for the volume ID
 	GetPVCNameFromCSIVolumeID(volumeID string) (string, bool)
+	// GetPVCAnnotations returns the annotations of the PV claim with the given
+	// name in the given namespace.
+	GetPVCAnnotations(ctx context.Context, name string, namespace string) (map[string]string, error)
 	// InitializeCSINodes creates CSINode instances for each K8s node with the appropriate topology keys.
 	InitializeCSINodes(ctx context.Context) error
 	// StartZonesInformer starts a dynamic informer which listens on Zones CR in
@@ -1798,3 +1798,14 @@ func (c *K8sOrchestrator) GetPVNameFromCSIVolumeID(volumeID string) (string, boo
 func (c *K8sOrchestrator) GetPVCNameFromCSIVolumeID(volumeID string) (string, bool) {
 	return c.volumeIDToPvcMap.get(volumeID)
 }
+
+// GetPVCAnnotations returns the annotations of the PVC with the given name in
+// the given namespace.
+func (c *K8sOrchestrator) GetPVCAnnotations(ctx context.Context, name string,
+	namespace string) (map[string]string, error) {
+	pvc, err := c.k8sClient.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return pvc.Annotations, nil
+}
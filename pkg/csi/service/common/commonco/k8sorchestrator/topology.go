@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -504,6 +505,56 @@ func (volTopology *controllerVolumeTopology) GetAZClustersMap(ctx context.Contex
 	return nil
 }
 
+// DumpTopologyCache returns the topology of the nodes from the informer cache
+// of the CSINodeTopology instances, along with the current content of the
+// domainNodeMap and preferredDatastoresMap caches.
+func (volTopology *controllerVolumeTopology) DumpTopologyCache(ctx context.Context) *commoncotypes.TopologyCacheDump {
+	log := logger.GetLogger(ctx)
+	dump := &commoncotypes.TopologyCacheDump{
+		Nodes:               make(map[string]commoncotypes.NodeTopologyDump),
+		DomainNodes:         make(map[string][]string),
+		PreferredDatastores: make(map[string][]string),
+	}
+	for _, obj := range volTopology.csiNodeTopologyInformer.GetStore().List() {
+		var nodeTopoObj csinodetopologyv1alpha1.CSINodeTopology
+		err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.(*unstructured.Unstructured).Object,
+			&nodeTopoObj)
+		if err != nil {
+			log.Errorf("failed to cast object %+v to %s. Error: %v", obj, csinodetopology.CRDSingular, err)
+			continue
+		}
+		nodeDump := commoncotypes.NodeTopologyDump{
+			Status:       string(nodeTopoObj.Status.Status),
+			ErrorMessage: nodeTopoObj.Status.ErrorMessage,
+		}
+		if len(nodeTopoObj.Status.TopologyLabels) != 0 {
+			nodeDump.TopologyLabels = make(map[string]string)
+			for _, label := range nodeTopoObj.Status.TopologyLabels {
+				nodeDump.TopologyLabels[label.Key] = label.Value
+			}
+		}
+		dump.Nodes[nodeTopoObj.Name] = nodeDump
+	}
+
+	domainNodeMapInstanceLock.RLock()
+	for domain, nodes := range domainNodeMap {
+		nodeNames := make([]string, 0, len(nodes))
+		for nodeName := range nodes {
+			nodeNames = append(nodeNames, nodeName)
+		}
+		slices.Sort(nodeNames)
+		dump.DomainNodes[domain] = nodeNames
+	}
+	domainNodeMapInstanceLock.RUnlock()
+
+	preferredDatastoresMapInstanceLock.RLock()
+	for domain, datastoreURLs := range preferredDatastoresMap {
+		dump.PreferredDatastores[domain] = slices.Clone(datastoreURLs)
+	}
+	preferredDatastoresMapInstanceLock.RUnlock()
+	return dump
+}
+
 // startTopologyCRInformer creates and starts an informer for CSINodeTopology custom resource.
 func startTopologyCRInformer(ctx context.Context, cfg *restclient.Config) (*cache.SharedIndexInformer, error) {
 	log := logger.GetLogger(ctx)
@@ -1116,6 +1167,20 @@ func (volTopology *controllerVolumeTopology) getSharedDatastoresInTopology(ctx c
 				matchingNodeVMs, segments, err)
 			return nil, err
 		}
+		// Skip the datastores which are not mounted and accessible on the hosts
+		// of the matching nodeVMs, as the volume could not be attached to them.
+		sharedDatastoresInTopology, err = cnsvsphere.FilterDatastoresMountedOnVMHosts(ctx,
+			sharedDatastoresInTopology, matchingNodeVMs)
+		if err != nil {
+			log.Errorf("failed to check accessibility of datastores from nodes: %+v in topology segment %+v. "+
+				"Error: %+v", matchingNodeVMs, segments, err)
+			return nil, err
+		}
+		if len(sharedDatastoresInTopology) == 0 {
+			log.Warnf("No shared datastore is accessible from the hosts of nodes in topology segment %+v",
+				segments)
+			continue
+		}
 
 		// If applicable, filter the shared datastores with the preferred datastores for that segment.
 		if volTopology.isTopologyPreferentialDatastoresFSSEnabled {
@@ -1419,6 +1484,9 @@ func (volTopology *controllerVolumeTopology) GetTopologyInfoFromNodes(ctx contex
 			topologySegments = append(topologySegments, topoLabels)
 		}
 	}
+	if params.SharedDatastore {
+		topologySegments = removeHostTopologyOfSharedDatastore(topologySegments)
+	}
 	log.Infof("Topology segments retrieved from nodes accessible to datastore %q are: %+v",
 		params.DatastoreURL, topologySegments)
 
@@ -1475,6 +1543,34 @@ func (volTopology *controllerVolumeTopology) GetTopologyInfoFromNodes(ctx contex
 	return accessibleTopology, nil
 }
 
+// removeHostTopologyOfSharedDatastore removes the host-level topology label
+// from the topology segments of the nodes accessible to a datastore mounted on
+// several hosts. Only the volumes on host-local datastores are pinned to the
+// topology of their host, while the volumes on shared datastores remain
+// accessible from the nodes on any host of the datastore, even if all the
+// nodes are currently on the same host.
+func removeHostTopologyOfSharedDatastore(topologySegments []map[string]string) []map[string]string {
+	var sharedTopologySegments []map[string]string
+	for _, segments := range topologySegments {
+		sharedSegments := make(map[string]string)
+		for key, value := range segments {
+			if key != common.HostTopologyLabel {
+				sharedSegments[key] = value
+			}
+		}
+		if len(sharedSegments) == 0 {
+			continue
+		}
+		alreadyExists := slices.ContainsFunc(sharedTopologySegments, func(s map[string]string) bool {
+			return reflect.DeepEqual(s, sharedSegments)
+		})
+		if !alreadyExists {
+			sharedTopologySegments = append(sharedTopologySegments, sharedSegments)
+		}
+	}
+	return sharedTopologySegments
+}
+
 func verifyAllNodesInTopologyAccessibleToDatastore(ctx context.Context, nodeNames []string,
 	datastoreURL string, topologySegments []map[string]string) ([]map[string]string, error) {
 	log := logger.GetLogger(ctx)
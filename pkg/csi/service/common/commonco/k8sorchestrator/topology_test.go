@@ -2,9 +2,11 @@ package k8sorchestrator
 
 import (
 	"encoding/json"
+	"reflect"
 	"testing"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
 	csinodetopologyv1alpha1 "sigs.k8s.io/vsphere-csi-driver/v3/pkg/internalapis/csinodetopology/v1alpha1"
 )
 
@@ -44,3 +46,30 @@ func TestPatchNodeTopology(t *testing.T) {
 		t.Errorf("ResourceVersion should be %s, got %s", csiNodeTopology.ResourceVersion, resourceVersion)
 	}
 }
+
+func TestRemoveHostTopologyOfSharedDatastore(t *testing.T) {
+	zoneLabel := common.TopologyLabelsDomain + "/k8s-zone"
+	shared := []map[string]string{
+		{zoneLabel: "zone-a", common.HostTopologyLabel: "host-1"},
+		{zoneLabel: "zone-a", common.HostTopologyLabel: "host-2"},
+		{zoneLabel: "zone-b", common.HostTopologyLabel: "host-3"},
+	}
+	expected := []map[string]string{
+		{zoneLabel: "zone-a"},
+		{zoneLabel: "zone-b"},
+	}
+	if got := removeHostTopologyOfSharedDatastore(shared); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected topology %+v for shared datastore, got %+v", expected, got)
+	}
+	// The volumes on a shared datastore are not pinned to a host, even if all
+	// the nodes are on the same host.
+	sameHost := []map[string]string{
+		{zoneLabel: "zone-a", common.HostTopologyLabel: "host-1"},
+	}
+	expected = []map[string]string{
+		{zoneLabel: "zone-a"},
+	}
+	if got := removeHostTopologyOfSharedDatastore(sameHost); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected topology %+v for shared datastore, got %+v", expected, got)
+	}
+}
@@ -74,6 +74,10 @@ type VanillaRetrieveTopologyInfoParams struct {
 	// TopologyRequirement represents the topology conditions
 	// which need to be satisfied during volume provisioning.
 	TopologyRequirement *csi.TopologyRequirement
+	// SharedDatastore is set if the selected datastore is mounted on
+	// more than one host, in which case the host-level topology is not
+	// part of the topology of the volume.
+	SharedDatastore bool
 }
 
 // WCPRetrieveTopologyInfoParams represents the params required to call
@@ -111,6 +115,32 @@ type ControllerTopologyService interface {
 	GetAZClustersMap(ctx context.Context) map[string][]string
 }
 
+// TopologyCacheDumper is implemented by the ControllerTopologyService of the
+// flavors whose topology caches can be dumped for debugging.
+type TopologyCacheDumper interface {
+	// DumpTopologyCache returns the current state of the topology caches.
+	DumpTopologyCache(ctx context.Context) *TopologyCacheDump
+}
+
+// TopologyCacheDump is the state of the topology caches of the controller.
+type TopologyCacheDump struct {
+	// Nodes maps the node names to the topology of their CSINodeTopology
+	// instance.
+	Nodes map[string]NodeTopologyDump `json:"nodes"`
+	// DomainNodes maps the topology domains to the names of the nodes in them.
+	DomainNodes map[string][]string `json:"domainNodes"`
+	// PreferredDatastores maps the topology domains to the URLs of the
+	// datastores preferred in them.
+	PreferredDatastores map[string][]string `json:"preferredDatastores,omitempty"`
+}
+
+// NodeTopologyDump is the topology of a node, as cached by the controller.
+type NodeTopologyDump struct {
+	Status         string            `json:"status"`
+	TopologyLabels map[string]string `json:"topologyLabels,omitempty"`
+	ErrorMessage   string            `json:"errorMessage,omitempty"`
+}
+
 // NodeTopologyService is an interface which exposes functionality related to
 // topology aware clusters in the nodes.
 type NodeTopologyService interface {
@@ -42,11 +42,44 @@ const (
 	// For Example: DatastoreURL: "ds:///vmfs/volumes/5c9bb20e-009c1e46-4b85-0200483b2a97/".
 	AttributeDatastoreURL = "datastoreurl"
 
+	// AttributeDatastoreURLs represents a comma separated allowlist of datastore
+	// URLs in the StorageClass. Volumes are provisioned only on datastores from
+	// this list.
+	AttributeDatastoreURLs = "datastoreurls"
+
+	// AttributeDatastoreTags represents a comma separated list of vSphere tags
+	// in the StorageClass, each of the form "<category>:<tag>" or "<tag>".
+	// Volumes are provisioned only on datastores carrying all the tags.
+	AttributeDatastoreTags = "datastoretags"
+
+	// AttributeStoragePod represents the name or inventory path of a Storage DRS
+	// enabled datastore cluster in the StorageClass. Volumes are provisioned on
+	// the member datastore of the datastore cluster recommended by Storage DRS.
+	// For Example: StoragePod: "DatastoreCluster1".
+	AttributeStoragePod = "storagepod"
+
+	// AttributeQualifiedDatastore represents the name of a datastore qualified
+	// by the name or inventory path of its datacenter in the StorageClass, of
+	// the form "<datacenter>/<datastore>". Volumes are provisioned on this
+	// datastore, which is resolved unambiguously when datastore names are not
+	// unique across the datacenters of the vCenter.
+	// For Example: QualifiedDatastore: "Datacenter1/vsanDatastore".
+	AttributeQualifiedDatastore = "qualifieddatastore"
+
 	// AttributeStoragePolicyName represents name of the Storage Policy in the
 	// Storage Class.
 	// For Example: StoragePolicy: "vSAN Default Storage Policy".
 	AttributeStoragePolicyName = "storagepolicyname"
 
+	// AttributeZoneStoragePolicyIDs represents a comma separated mapping of
+	// zones to the storage policy IDs implementing the tier of the Storage
+	// Class in each zone, each of the form "<zone>:<storage policy ID>". The
+	// storage policy is resolved from the topology segment selected for the
+	// volume, which lets one Storage Class span datacenters using different
+	// policies for the same tier.
+	// For Example: ZoneStoragePolicyIDs: "zone-a:251bce41-...,zone-b:aa6d5a82-...".
+	AttributeZoneStoragePolicyIDs = "zonestoragepolicyids"
+
 	// AttributeStoragePolicyID represents Storage Policy Id in the Storage Classs.
 	// For Example: StoragePolicyId: "251bce41-cb24-41df-b46b-7c75aed3c4ee".
 	AttributeStoragePolicyID = "storagepolicyid"
@@ -64,6 +97,174 @@ const (
 	// For Example: FsType: "ext4".
 	AttributeFsType = "fstype"
 
+	// AttributeXFSProjectQuota represents whether XFS project quota is enforced
+	// on the volume in the Storage Class and the PersistentVolume's attributes.
+	// For Example: XFSProjectQuota: "true".
+	AttributeXFSProjectQuota = "xfsprojectquota"
+
+	// AttributeReadOnlyClone represents whether a volume restored from a
+	// snapshot is a read-only clone in the Storage Class and the
+	// PersistentVolume's attributes. Read-only clones are mounted read-only
+	// and cannot be expanded.
+	// For Example: ReadOnlyClone: "true".
+	AttributeReadOnlyClone = "readonlyclone"
+
+	// AttributeSubPath represents the subdirectory of the volume which is
+	// published to the pod in the PersistentVolume's attributes, so that
+	// several PersistentVolumes can share distinct subdirectories of one
+	// volume. The subdirectory is created if missing.
+	// For Example: SubPath: "team-a/data".
+	AttributeSubPath = "subpath"
+
+	// ReadOnlyCloneMetadataKey is the key of the FCD metadata marking the
+	// volume as a read-only clone.
+	ReadOnlyCloneMetadataKey = "cns.vmware.com/readonly-clone"
+
+	// MultiWriterMetadataKey is the key of the FCD metadata marking the volume
+	// as attached in multi-writer sharing mode.
+	MultiWriterMetadataKey = "cns.vmware.com/multi-writer"
+
+	// AttributeIopsLimit represents the IOPS limit of the virtual disk of a
+	// block volume in the Storage Class or the VolumeAttributesClass. The
+	// value "unlimited" removes the limit.
+	// For Example: IopsLimit: "1000".
+	AttributeIopsLimit = "iopslimit"
+
+	// AttributeThroughputLimit represents the throughput limit in MB/s of the
+	// virtual disk of a block volume in the Storage Class or the
+	// VolumeAttributesClass. It is enforced as an IOPS limit, see
+	// ParseIopsLimit. The value "unlimited" removes the limit.
+	// For Example: ThroughputLimit: "100".
+	AttributeThroughputLimit = "throughputlimit"
+
+	// IopsLimitMetadataKey is the key of the FCD metadata holding the IOPS
+	// limit of the volume, which is applied to its virtual disk on attach.
+	IopsLimitMetadataKey = "cns.vmware.com/iops-limit"
+
+	// AttributeDeletionRetentionMinutes represents the time in minutes for
+	// which a deleted block volume is retained before its disk is destroyed.
+	// The volume can be reclaimed during this window by creating a PV which
+	// references it.
+	// For Example: DeletionRetentionMinutes: "1440".
+	AttributeDeletionRetentionMinutes = "deletionretentionminutes"
+
+	// DeletionRetentionMetadataKey is the key of the FCD metadata holding the
+	// deletion retention window of the volume in minutes.
+	DeletionRetentionMetadataKey = "cns.vmware.com/deletion-retention-minutes"
+
+	// AttributeRetainUntil represents the time in RFC 3339 format until which
+	// block volumes provisioned with the Storage Class are retention locked,
+	// i.e. cannot be deleted. For Example: RetainUntil: "2030-01-01T00:00:00Z".
+	AttributeRetainUntil = "retainuntil"
+
+	// RetainUntilMetadataKey is the key of the FCD metadata holding the time
+	// in RFC 3339 format until which the volume is retention locked.
+	RetainUntilMetadataKey = "cns.vmware.com/retain-until"
+
+	// AttributeSnapshotDeletePolicy represents the behavior of DeleteVolume
+	// for block volumes which still have snapshots, either "fail" to reject
+	// the deletion or "cascade" to delete the orphaned CNS snapshots, i.e. the
+	// ones no VolumeSnapshotContent references, before the volume.
+	// For Example: SnapshotDeletePolicy: "cascade".
+	AttributeSnapshotDeletePolicy = "snapshotdeletepolicy"
+
+	// SnapshotDeletePolicyMetadataKey is the key of the FCD metadata holding
+	// the snapshot delete policy of the volume.
+	SnapshotDeletePolicyMetadataKey = "cns.vmware.com/snapshot-delete-policy"
+
+	// SnapshotDeletePolicyFail rejects the deletion of volumes with snapshots.
+	SnapshotDeletePolicyFail = "fail"
+
+	// SnapshotDeletePolicyCascade deletes the orphaned CNS snapshots of volumes
+	// before the volumes. The deletion of volumes whose snapshots are still
+	// referenced by VolumeSnapshotContents is rejected as with the fail policy,
+	// as VolumeSnapshots are only deleted by their users.
+	SnapshotDeletePolicyCascade = "cascade"
+
+	// SoftDeletedLabel is the label set in the CNS metadata of a volume which
+	// has been deleted, and whose disk is destroyed once the time given by
+	// DeleteAfterLabel has passed.
+	SoftDeletedLabel = "cns.vmware.com/soft-deleted"
+
+	// DeleteAfterLabel is the label set in the CNS metadata of a soft deleted
+	// volume, holding the time in RFC 3339 format after which its disk is
+	// destroyed.
+	DeleteAfterLabel = "cns.vmware.com/delete-after"
+
+	// SoftDeletedPVUIDLabel is the label set in the CNS metadata of a soft
+	// deleted volume, holding the UID of the deleted PV.
+	SoftDeletedPVUIDLabel = "cns.vmware.com/soft-deleted-pv-uid"
+
+	// EphemeralVolumeNamePrefix is the prefix of the name of the CNS volumes
+	// backing CSI ephemeral inline volumes. These volumes have no PV and are
+	// deleted by the node plugin of the node they are attached to, or by the
+	// orphan volume cleanup of the syncer once their pod is gone.
+	EphemeralVolumeNamePrefix = "csi-ephemeral-"
+
+	// IopsLimitUnlimited is the IOPS limit of virtual disks without a limit.
+	IopsLimitUnlimited int64 = -1
+
+	// IopsPerThroughputMBps is the number of IOPS a throughput of 1 MB/s is
+	// enforced as. vSphere limits the IOs of virtual disks in units of 32 KB.
+	IopsPerThroughputMBps int64 = 1024 / 32
+
+	// AttributeVolumeNamePrefix represents the prefix prepended to the name of
+	// the CNS volume in the Storage Class.
+	// For Example: VolumeNamePrefix: "cluster1-".
+	AttributeVolumeNamePrefix = "volumenameprefix"
+
+	// AttributeDryRun represents whether CreateVolume should only validate that
+	// the volume can be placed, without creating it.
+	// For Example: "csi.vsphere.volume/dryrun": "true".
+	AttributeDryRun = "csi.vsphere.volume/dryrun"
+
+	// AttributeDryRunDatastoreURL represents the URL of the datastore the volume
+	// would be placed on, in the error details of a dry run CreateVolume request.
+	AttributeDryRunDatastoreURL = "csi.vsphere.volume/dryrun-datastoreurl"
+
+	// AttributeDryRunFreeSpace represents the free space in bytes of the datastore
+	// the volume would be placed on, in the error details of a dry run CreateVolume request.
+	AttributeDryRunFreeSpace = "csi.vsphere.volume/dryrun-freespace"
+
+	// DryRunErrorReason is the reason of the ErrorInfo details of the error
+	// returned by a dry run CreateVolume request which would have succeeded.
+	DryRunErrorReason = "DRY_RUN_SUCCEEDED"
+
+	// DryRunErrorDomain is the domain of the ErrorInfo details of the error
+	// returned by a dry run CreateVolume request.
+	DryRunErrorDomain = "csi.vsphere.vmware.com"
+
+	// AttributeStoragePodDatastoreURL represents the URL of the member datastore
+	// of the datastore cluster given in the StorageClass the volume is placed
+	// on, in the VolumeContext of the volume.
+	AttributeStoragePodDatastoreURL = "csi.vsphere.volume/storagepod-datastoreurl"
+
+	// AttributeRetainUntilVolumeContext represents the time until which the
+	// volume is retention locked, in the VolumeContext of the volume.
+	AttributeRetainUntilVolumeContext = "csi.vsphere.volume/retain-until"
+
+	// AttributeDiskFormat represents the provisioning type of the virtual disk
+	// backing the volume in the Storage Class, overriding the default of the
+	// storage policy. For Example: DiskFormat: "eagerzeroedthick".
+	AttributeDiskFormat = "diskformat"
+
+	// AttributeEffectiveDiskFormat represents the provisioning type of the
+	// virtual disk backing the volume, in the response of CreateVolume.
+	AttributeEffectiveDiskFormat = "csi.vsphere.volume/diskformat"
+
+	// AttributePlacementStrategy represents how the datastore of a volume is
+	// chosen in the Storage Class, when several datastores are compatible with
+	// the storage policy in the requested topology segment.
+	// For Example: PlacementStrategy: "capacity-weighted".
+	AttributePlacementStrategy = "placementstrategy"
+
+	// AttributeAntiAffinityGroup represents the anti-affinity group of the
+	// volumes in the Storage Class. Volumes of the same group are placed on
+	// distinct datastores when enough compatible datastores are available,
+	// e.g. for the replicas of a replicated database.
+	// For Example: AntiAffinityGroup: "db-replicas".
+	AttributeAntiAffinityGroup = "antiaffinitygroup"
+
 	// AttributeStoragePool represents name of the StoragePool on which to place
 	// the PVC. For example: StoragePool: "storagepool-vsandatastore".
 	AttributeStoragePool = "storagepool"
@@ -116,6 +317,17 @@ const (
 	// AttributeVmUUID is the vmUUID to which volume is attached to.
 	AttributeVmUUID = "vmUUID"
 
+	// AttributeSCSISlotHint is the optional volume context parameter hinting
+	// the SCSI controller slot, as "<bus number>:<unit number>", the volume is
+	// attached to. The hint is only honored for volumes attached in
+	// multi-writer mode, as the CNS attach API does not support selecting the
+	// slot. For Example: scsislot: "1:3".
+	AttributeSCSISlotHint = "scsislot"
+
+	// AttributeSCSISlot is the SCSI controller slot, as
+	// "<bus number>:<unit number>", the volume is attached to.
+	AttributeSCSISlot = "scsiSlot"
+
 	// AttributeFakeAttached is the flag that indicates if a volume is fake
 	// attached.
 	AttributeFakeAttached = "fake-attach"
@@ -205,6 +417,29 @@ const (
 	// for Volume provisioning.
 	DiskFormatMigrationParam = "diskformat-migrationparam"
 
+	// DiskFormatThin provisions the virtual disk as thin.
+	DiskFormatThin = "thin"
+	// DiskFormatThick provisions the virtual disk as lazy zeroed thick.
+	DiskFormatThick = "thick"
+	// DiskFormatEagerZeroedThick provisions the virtual disk as eager zeroed thick.
+	DiskFormatEagerZeroedThick = "eagerzeroedthick"
+
+	// PlacementStrategyCapacityWeighted picks the datastore of a volume at
+	// random, weighted by the free space of each candidate datastore.
+	PlacementStrategyCapacityWeighted = "capacity-weighted"
+
+	// PlacementStrategyAbsoluteFree picks the datastore of a volume with the
+	// most free space among the candidate datastores.
+	PlacementStrategyAbsoluteFree = "absolute-free"
+
+	// PlacementStrategyPercentFree picks the datastore of a volume with the
+	// highest ratio of free space to capacity among the candidate datastores.
+	PlacementStrategyPercentFree = "percent-free"
+
+	// PlacementStrategyRoundRobin picks the datastores of successive volumes in
+	// turn among the candidate datastores.
+	PlacementStrategyRoundRobin = "round-robin"
+
 	// HostFailuresToTolerateMigrationParam is raw vSAN Policy Parameter.
 	HostFailuresToTolerateMigrationParam = "hostfailurestotolerate-migrationparam"
 
@@ -262,6 +497,33 @@ const (
 	// AnnVolumeHealth is the key for HealthStatus annotation on volume claim.
 	AnnVolumeHealth = "volumehealth.storage.kubernetes.io/health"
 
+	// AnnGuestDiskHintPrefix is the prefix of the annotations on volume claims
+	// of VM service VMs carrying hints about the use of the disk in the guest.
+	// The valid hints are stored as labels of the PVC in the CNS metadata of
+	// the volume, under the same key.
+	AnnGuestDiskHintPrefix = "cns.vmware.com/guest-disk-"
+
+	// AnnGuestDiskType is the guest disk hint annotation on volume claim
+	// classifying the disk in the guest, either GuestDiskTypeOS or
+	// GuestDiskTypeData.
+	AnnGuestDiskType = AnnGuestDiskHintPrefix + "type"
+
+	// AnnAntiAffinityGroup is the annotation on volume claim declaring the
+	// anti-affinity group of its volume. It takes precedence over the
+	// antiaffinitygroup parameter of the Storage Class.
+	AnnAntiAffinityGroup = "cns.vmware.com/anti-affinity-group"
+
+	// AnnRetryNodeExpansion is the annotation an admin sets on a volume claim
+	// whose filesystem failed to be resized on the node, once the filesystem
+	// is fixed, to have only the node expansion of its volume retried.
+	AnnRetryNodeExpansion = "cns.vmware.com/retry-node-expansion"
+
+	// GuestDiskTypeOS is the guest disk type of a disk holding the guest OS.
+	GuestDiskTypeOS = "os"
+
+	// GuestDiskTypeData is the guest disk type of a data disk.
+	GuestDiskTypeData = "data"
+
 	// AnnFakeAttached is the key for fake attach annotation on volume claim.
 	AnnFakeAttached = "csi.vmware.com/fake-attached"
 
@@ -275,6 +537,10 @@ const (
 	// if inaccessible PV can be fake attached.
 	AnnIgnoreInaccessiblePV = "pv.attach.kubernetes.io/ignore-if-inaccessible"
 
+	// AnnMaxVolumesPerNode is the annotation on a node overriding the maximum
+	// number of block volumes reported for the node by NodeGetInfo.
+	AnnMaxVolumesPerNode = "csi.vsphere.vmware.com/max-volumes-per-node"
+
 	// TriggerCsiFullSyncCRName is the instance name of TriggerCsiFullSync
 	// All other names will be rejected by TriggerCsiFullSync controller.
 	TriggerCsiFullSyncCRName = "csifullsync"
@@ -290,6 +556,14 @@ const (
 	// topology labels applied on the node by vSphere CSI driver.
 	TopologyLabelsDomain = "topology.csi.vmware.com"
 
+	// AttributeCSIProvisionerIdentity is the volume attribute set by the
+	// external-provisioner on dynamically provisioned PVs.
+	AttributeCSIProvisionerIdentity = "storage.kubernetes.io/csiProvisionerIdentity"
+
+	// HostTopologyLabel is the topology label holding the hardware UUID of the
+	// ESXi host of the node VM, when host-level topology is enabled.
+	HostTopologyLabel = TopologyLabelsDomain + "/esxi-host"
+
 	// AnnGuestClusterRequestedTopology is the key for guest cluster requested topology
 	AnnGuestClusterRequestedTopology = "csi.vsphere.volume-requested-topology"
 
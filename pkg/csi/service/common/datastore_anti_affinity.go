@@ -0,0 +1,73 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"context"
+	"strings"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+)
+
+// filterDatastoresByAntiAffinity returns the datastores, among the ones
+// compatible with the storage policy of the volume, which do not hold a volume
+// of the anti-affinity group of the volume, as given by
+// spec.AntiAffinityDatastoreURLs. The anti-affinity is best-effort:
+// all the given datastores are returned if every compatible datastore already
+// holds a volume of the group.
+func filterDatastoresByAntiAffinity(ctx context.Context, vc *vsphere.VirtualCenter, spec *CreateVolumeSpec,
+	datastores []*vsphere.DatastoreInfo) []*vsphere.DatastoreInfo {
+	log := logger.GetLogger(ctx)
+	candidates := datastores
+	if spec.StoragePolicyID != "" && len(datastores) > 1 {
+		compatible, err := FilterDatastoresByStoragePolicy(ctx, vc, datastores, spec.StoragePolicyID)
+		if err != nil {
+			log.Warnf("failed to filter datastores by storage policy for anti-affinity group %q of volume %q, "+
+				"considering all the candidate datastores. Error: %v", spec.AntiAffinityGroup, spec.Name, err)
+		} else {
+			candidates = compatible
+		}
+	}
+	usedDatastoreURLs := make(map[string]bool, len(spec.AntiAffinityDatastoreURLs))
+	for _, datastoreURL := range spec.AntiAffinityDatastoreURLs {
+		usedDatastoreURLs[strings.TrimSpace(datastoreURL)] = true
+	}
+	selected := excludeAntiAffinityDatastores(candidates, usedDatastoreURLs)
+	if len(selected) == 0 {
+		log.Warnf("Anti-affinity of group %q cannot be satisfied for volume %q, all the %d candidate "+
+			"datastore(s) already hold a volume of the group", spec.AntiAffinityGroup, spec.Name, len(candidates))
+		return datastores
+	}
+	log.Infof("Placing volume %q of anti-affinity group %q on one of the %d datastore(s) holding no volume "+
+		"of the group", spec.Name, spec.AntiAffinityGroup, len(selected))
+	return selected
+}
+
+// excludeAntiAffinityDatastores returns the datastores whose URL is not in
+// usedDatastoreURLs.
+func excludeAntiAffinityDatastores(datastores []*vsphere.DatastoreInfo,
+	usedDatastoreURLs map[string]bool) []*vsphere.DatastoreInfo {
+	var selected []*vsphere.DatastoreInfo
+	for _, ds := range datastores {
+		if ds.Info != nil && usedDatastoreURLs[strings.TrimSpace(ds.Info.Url)] {
+			continue
+		}
+		selected = append(selected, ds)
+	}
+	return selected
+}
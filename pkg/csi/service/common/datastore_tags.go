@@ -0,0 +1,210 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vmware/govmomi/vapi/tags"
+	"github.com/vmware/govmomi/vim25/mo"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+)
+
+// datastoreTagsCacheTTL is the time for which the tags attached to a
+// datastore are cached before being queried again from the tagging service.
+const datastoreTagsCacheTTL = 5 * time.Minute
+
+// datastoreTagsCacheEntry holds the tags attached to a datastore, both as
+// "<category>:<tag>" and as "<tag>".
+type datastoreTagsCacheEntry struct {
+	tags      map[string]struct{}
+	fetchTime time.Time
+}
+
+// datastoreTagsCache caches the tags attached to datastores, keyed by vCenter
+// host and datastore managed object ID, and the names of the tag categories,
+// keyed by vCenter host and category ID.
+type datastoreTagsCache struct {
+	mu         sync.Mutex
+	datastores map[string]datastoreTagsCacheEntry
+	categories map[string]string
+}
+
+var dsTagsCache = &datastoreTagsCache{
+	datastores: make(map[string]datastoreTagsCacheEntry),
+	categories: make(map[string]string),
+}
+
+// parseDatastoreTags splits a comma separated list of datastore tags, each of
+// the form "<category>:<tag>" or "<tag>", ignoring empty entries.
+func parseDatastoreTags(value string) ([]string, error) {
+	var datastoreTags []string
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if category, name, found := strings.Cut(tag, ":"); found &&
+			(strings.TrimSpace(category) == "" || strings.TrimSpace(name) == "") {
+			return nil, fmt.Errorf("invalid tag %q in param %q, expected <category>:<tag> or <tag>",
+				tag, AttributeDatastoreTags)
+		}
+		datastoreTags = append(datastoreTags, tag)
+	}
+	return datastoreTags, nil
+}
+
+// newDatastoreTagSet returns the set of tags attached to a datastore, holding
+// each tag both with and without its category name.
+func newDatastoreTagSet(attachedTags []tags.Tag, categoryNames map[string]string) map[string]struct{} {
+	tagSet := make(map[string]struct{})
+	for _, tag := range attachedTags {
+		tagSet[tag.Name] = struct{}{}
+		if categoryName, ok := categoryNames[tag.CategoryID]; ok {
+			tagSet[categoryName+":"+tag.Name] = struct{}{}
+		}
+	}
+	return tagSet
+}
+
+// hasAllTags returns true if all the required tags are present in tagSet.
+func hasAllTags(tagSet map[string]struct{}, requiredTags []string) bool {
+	for _, tag := range requiredTags {
+		if _, ok := tagSet[tag]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterDatastoresByTags returns the datastores from the given list which
+// carry all the given vSphere tags. The tags attached to the datastores are
+// queried from the tagging service of the vCenter and cached for
+// datastoreTagsCacheTTL.
+func FilterDatastoresByTags(ctx context.Context, vc *vsphere.VirtualCenter,
+	datastores []*vsphere.DatastoreInfo, datastoreTags []string) ([]*vsphere.DatastoreInfo, error) {
+	log := logger.GetLogger(ctx)
+	tagSets, err := dsTagsCache.getDatastoreTags(ctx, vc, datastores)
+	if err != nil {
+		return nil, err
+	}
+	var filteredDatastores []*vsphere.DatastoreInfo
+	for _, ds := range datastores {
+		if hasAllTags(tagSets[ds.Reference().Value], datastoreTags) {
+			filteredDatastores = append(filteredDatastores, ds)
+		} else {
+			log.Debugf("filter out datastore %q not carrying all the tags %v", ds.Info.Url, datastoreTags)
+		}
+	}
+	return filteredDatastores, nil
+}
+
+// getDatastoreTags returns the tag sets of the given datastores, keyed by
+// their managed object ID. Tags of datastores missing from the cache, or
+// cached for longer than datastoreTagsCacheTTL, are queried in a single call
+// to the tagging service.
+func (c *datastoreTagsCache) getDatastoreTags(ctx context.Context, vc *vsphere.VirtualCenter,
+	datastores []*vsphere.DatastoreInfo) (map[string]map[string]struct{}, error) {
+	log := logger.GetLogger(ctx)
+	tagSets := make(map[string]map[string]struct{})
+	var staleRefs []mo.Reference
+	c.mu.Lock()
+	for _, ds := range datastores {
+		moID := ds.Reference().Value
+		entry, ok := c.datastores[vc.Config.Host+"/"+moID]
+		if ok && time.Since(entry.fetchTime) < datastoreTagsCacheTTL {
+			tagSets[moID] = entry.tags
+			continue
+		}
+		staleRefs = append(staleRefs, ds.Reference())
+	}
+	c.mu.Unlock()
+	if len(staleRefs) == 0 {
+		return tagSets, nil
+	}
+
+	tagManager, err := vc.GetTagManager(ctx)
+	if err != nil {
+		return nil, logger.LogNewErrorf(log, "failed to create tag manager for vCenter %q. Error: %+v",
+			vc.Config.Host, err)
+	}
+	attachedTags, err := tagManager.GetAttachedTagsOnObjects(ctx, staleRefs)
+	if err != nil {
+		return nil, logger.LogNewErrorf(log, "failed to retrieve tags attached to datastores %v in vCenter %q. "+
+			"Error: %+v", staleRefs, vc.Config.Host, err)
+	}
+	categoryNames, err := c.getCategoryNames(ctx, vc, tagManager, attachedTags)
+	if err != nil {
+		return nil, err
+	}
+	fetchTime := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Datastores without any tag are not returned by the tagging service.
+	for _, ref := range staleRefs {
+		tagSets[ref.Reference().Value] = map[string]struct{}{}
+	}
+	for _, attached := range attachedTags {
+		tagSets[attached.ObjectID.Reference().Value] = newDatastoreTagSet(attached.Tags, categoryNames)
+	}
+	for _, ref := range staleRefs {
+		moID := ref.Reference().Value
+		c.datastores[vc.Config.Host+"/"+moID] = datastoreTagsCacheEntry{
+			tags:      tagSets[moID],
+			fetchTime: fetchTime,
+		}
+	}
+	return tagSets, nil
+}
+
+// getCategoryNames returns the names of the categories of the given tags,
+// keyed by category ID.
+func (c *datastoreTagsCache) getCategoryNames(ctx context.Context, vc *vsphere.VirtualCenter,
+	tagManager *tags.Manager, attachedTags []tags.AttachedTags) (map[string]string, error) {
+	log := logger.GetLogger(ctx)
+	categoryNames := make(map[string]string)
+	for _, attached := range attachedTags {
+		for _, tag := range attached.Tags {
+			if _, ok := categoryNames[tag.CategoryID]; ok {
+				continue
+			}
+			key := vc.Config.Host + "/" + tag.CategoryID
+			c.mu.Lock()
+			name, ok := c.categories[key]
+			c.mu.Unlock()
+			if !ok {
+				category, err := tagManager.GetCategory(ctx, tag.CategoryID)
+				if err != nil {
+					return nil, logger.LogNewErrorf(log, "failed to retrieve tag category %q in vCenter %q. "+
+						"Error: %+v", tag.CategoryID, vc.Config.Host, err)
+				}
+				name = category.Name
+				c.mu.Lock()
+				c.categories[key] = name
+				c.mu.Unlock()
+			}
+			categoryNames[tag.CategoryID] = name
+		}
+	}
+	return categoryNames, nil
+}
@@ -18,6 +18,7 @@ package common
 
 import (
 	"errors"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/crypto"
@@ -36,6 +37,14 @@ var (
 		},
 	}
 
+	// MultiWriterBlockVolumeCaps represents how the raw block volumes shared by
+	// multiple nodes in multi-writer mode could be accessed.
+	MultiWriterBlockVolumeCaps = []csi.VolumeCapability_AccessMode{
+		{
+			Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+		},
+	}
+
 	// FileVolumeCaps represents how the file volume could be accessed.
 	// CNS file volumes supports MULTI_NODE_READER_ONLY, MULTI_NODE_SINGLE_WRITER
 	// and MULTI_NODE_MULTI_WRITER
@@ -90,14 +99,54 @@ type CreateVolumeSpec struct {
 	VsanDatastoreURL        string // Datastore URL used by host local volumes (vSAN Direct/vSAN SNA)
 	ContentSourceSnapshotID string // SnapshotID from VolumeContentSource in CreateVolumeRequest
 	CryptoKeyID             *CryptoKeyID
+	// PVCName and PVCNamespace identify the PVC the volume is created for.
+	PVCName      string
+	PVCNamespace string
+	// GuestDiskHints are the guest disk hints of the PVC, stored as labels of
+	// the PVC in the CNS metadata of the volume.
+	GuestDiskHints map[string]string
+	// AntiAffinityGroup is the anti-affinity group of the volume, empty if the
+	// volume is not placed away from other volumes.
+	AntiAffinityGroup string
+	// AntiAffinityDatastoreURLs are the URLs of the datastores holding the
+	// other volumes of the anti-affinity group.
+	AntiAffinityDatastoreURLs []string
 }
 
 // StorageClassParams represents the storage class parameterss
 type StorageClassParams struct {
 	DatastoreURL      string
+	DatastoreURLs     []string
+	DatastoreTags     []string
+	StoragePod        string
 	StoragePolicyName string
 	CSIMigration      string
 	Datastore         string
+	XFSProjectQuota   bool
+	ReadOnlyClone     bool
+	IopsLimit         int64
+	DryRun            bool
+	VolumeNamePrefix  string
+	DiskFormat        string
+	PlacementStrategy string
+	// ZoneStoragePolicyIDs maps zones to the storage policy ID of the volumes
+	// provisioned in the zone.
+	ZoneStoragePolicyIDs map[string]string
+	// DeletionRetentionMinutes is the deletion retention window of the volume,
+	// 0 if the volume is destroyed right away on deletion.
+	DeletionRetentionMinutes int64
+	// RetainUntil is the time until which the volume cannot be deleted, the
+	// zero time if the volume is not retention locked.
+	RetainUntil time.Time
+	// QualifiedDatastore is the datacenter-qualified name of the datastore
+	// the volume is provisioned on, of the form "<datacenter>/<datastore>".
+	QualifiedDatastore string
+	// SnapshotDeletePolicy is the behavior of DeleteVolume if the volume still
+	// has snapshots, empty for the default behavior.
+	SnapshotDeletePolicy string
+	// AntiAffinityGroup is the anti-affinity group of the volumes of the
+	// storage class, empty if not set.
+	AntiAffinityGroup string
 }
 
 type CryptoKeyID struct {
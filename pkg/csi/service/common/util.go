@@ -18,20 +18,28 @@ package common
 
 import (
 	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"maps"
+	"math"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	cnstypes "github.com/vmware/govmomi/cns/types"
 	pbmtypes "github.com/vmware/govmomi/pbm/types"
 	"github.com/vmware/govmomi/vim25/types"
+	"google.golang.org/grpc/codes"
 	apiMeta "k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/dynamic"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	cnsvolume "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/volume"
@@ -43,9 +51,15 @@ import (
 const (
 	defaultK8sCloudOperatorServicePort = 10000
 	MissingSnapshotAggregatedCapacity  = "csi.vsphere.missing-snapshot-aggregated-capacity"
+	// maxVolumeNamePrefixLength is the maximum length of the volume name prefix,
+	// so that the prefixed name of a "pvc-<uuid>" volume fits in the 80
+	// characters allowed for CNS volume names.
+	maxVolumeNamePrefixLength = 32
 )
 
-var ErrAvailabilityZoneCRNotRegistered = errors.New("AvailabilityZone custom resource not registered")
+var (
+	ErrAvailabilityZoneCRNotRegistered = errors.New("AvailabilityZone custom resource not registered")
+)
 
 // GetVCenter returns VirtualCenter object from specified Manager object.
 // Before returning VirtualCenter object, vcenter connection is established if
@@ -129,6 +143,46 @@ func RoundUpSize(volumeSizeBytes int64, allocationUnitBytes int64) int64 {
 	return roundedUp
 }
 
+// GetVolumeSizeFromCapacityRange returns the size in bytes requested by the
+// capacity range of a CreateVolume request, and the size in MB of the volume
+// to create for it. The requested size is required_bytes, or limit_bytes if
+// only the limit is set. The volume size is the required size rounded up to
+// MB, which must not exceed limit_bytes, or limit_bytes rounded down to MB if
+// only the limit is set. codes.InvalidArgument is returned if neither is set,
+// and codes.OutOfRange if no volume size satisfies the range.
+func GetVolumeSizeFromCapacityRange(ctx context.Context, capacityRange *csi.CapacityRange) (int64, int64, error) {
+	log := logger.GetLogger(ctx)
+	requiredBytes := capacityRange.GetRequiredBytes()
+	limitBytes := capacityRange.GetLimitBytes()
+	if requiredBytes < 0 || limitBytes < 0 {
+		return 0, 0, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"capacity range %+v must not be negative", capacityRange)
+	}
+	if requiredBytes == 0 && limitBytes == 0 {
+		return 0, 0, logger.LogNewErrorCode(log, codes.InvalidArgument,
+			"capacity range must set required_bytes or limit_bytes")
+	}
+	if limitBytes > 0 && requiredBytes > limitBytes {
+		return 0, 0, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"required_bytes %d exceeds limit_bytes %d", requiredBytes, limitBytes)
+	}
+	if requiredBytes == 0 {
+		volSizeMB := limitBytes / MbInBytes
+		if volSizeMB == 0 {
+			return 0, 0, logger.LogNewErrorCodef(log, codes.OutOfRange,
+				"limit_bytes %d is less than the minimum volume size of 1 MB", limitBytes)
+		}
+		return volSizeMB * MbInBytes, volSizeMB, nil
+	}
+	volSizeMB := RoundUpSize(requiredBytes, MbInBytes)
+	if limitBytes > 0 && volSizeMB*MbInBytes > limitBytes {
+		return 0, 0, logger.LogNewErrorCodef(log, codes.OutOfRange,
+			"required_bytes %d rounded up to %d MB exceeds limit_bytes %d", requiredBytes, volSizeMB,
+			limitBytes)
+	}
+	return requiredBytes, volSizeMB, nil
+}
+
 // GetLabelsMapFromKeyValue creates a  map object from given parameter.
 func GetLabelsMapFromKeyValue(labels []types.KeyValue) map[string]string {
 	labelsMap := make(map[string]string)
@@ -138,9 +192,45 @@ func GetLabelsMapFromKeyValue(labels []types.KeyValue) map[string]string {
 	return labelsMap
 }
 
+// guestDiskHintValues maps the guest disk hint annotations to their valid
+// values.
+var guestDiskHintValues = map[string][]string{
+	AnnGuestDiskType: {GuestDiskTypeOS, GuestDiskTypeData},
+}
+
+// GetGuestDiskHints returns the guest disk hints among the given PVC
+// annotations. Unknown hints and hints with an invalid value are ignored.
+func GetGuestDiskHints(ctx context.Context, annotations map[string]string) map[string]string {
+	log := logger.GetLogger(ctx)
+	var hints map[string]string
+	for key, value := range annotations {
+		if !strings.HasPrefix(key, AnnGuestDiskHintPrefix) {
+			continue
+		}
+		validValues, known := guestDiskHintValues[key]
+		if !known {
+			log.Debugf("Ignoring unknown guest disk hint %q", key)
+			continue
+		}
+		if !slices.Contains(validValues, value) {
+			log.Debugf("Ignoring guest disk hint %q with invalid value %q, valid values are %v",
+				key, value, validValues)
+			continue
+		}
+		if hints == nil {
+			hints = make(map[string]string)
+		}
+		hints[key] = value
+	}
+	return hints
+}
+
 // IsFileVolumeRequest checks whether the request is to create a CNS file volume.
 func IsFileVolumeRequest(ctx context.Context, capabilities []*csi.VolumeCapability) bool {
 	for _, capability := range capabilities {
+		if isMultiWriterBlockVolumeCapability(capability) {
+			continue
+		}
 		if capability.AccessMode.Mode == csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY ||
 			capability.AccessMode.Mode == csi.VolumeCapability_AccessMode_MULTI_NODE_SINGLE_WRITER ||
 			capability.AccessMode.Mode == csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER {
@@ -150,6 +240,17 @@ func IsFileVolumeRequest(ctx context.Context, capabilities []*csi.VolumeCapabili
 	return false
 }
 
+// IsMultiWriterBlockVolumeRequest checks whether the request is for a raw
+// block volume shared by multiple nodes in multi-writer mode.
+func IsMultiWriterBlockVolumeRequest(ctx context.Context, capabilities []*csi.VolumeCapability) bool {
+	return slices.ContainsFunc(capabilities, isMultiWriterBlockVolumeCapability)
+}
+
+func isMultiWriterBlockVolumeCapability(capability *csi.VolumeCapability) bool {
+	return capability.GetAccessMode().GetMode() == csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER &&
+		capability.GetBlock() != nil
+}
+
 // IsVolumeReadOnly checks the access mode in Volume Capability and decides
 // if volume is readonly or not.
 func IsVolumeReadOnly(capability *csi.VolumeCapability) bool {
@@ -162,6 +263,12 @@ func IsVolumeReadOnly(capability *csi.VolumeCapability) bool {
 	return ro
 }
 
+// IsReadOnlyCloneVolume returns true if the volume context or the publish
+// context of a volume marks it as a read-only clone.
+func IsReadOnlyCloneVolume(volumeContext map[string]string, publishContext map[string]string) bool {
+	return volumeContext[AttributeReadOnlyClone] == "true" || publishContext[AttributeReadOnlyClone] == "true"
+}
+
 // validateVolumeCapabilities validates the access mode in given volume
 // capabilities in validAccessModes.
 func validateVolumeCapabilities(volCaps []*csi.VolumeCapability,
@@ -189,6 +296,12 @@ func validateVolumeCapabilities(volCaps []*csi.VolumeCapability,
 				return fmt.Errorf("fstype %s not supported for ReadWriteOnce volume creation",
 					volCap.GetMount().FsType)
 			}
+		} else if volumeType == BlockVolumeType {
+			// Block volumes are shared by multiple nodes in multi-writer mode in raw
+			// block mode only, as no filesystem can be mounted on multiple nodes.
+			if volCap.GetBlock() == nil {
+				return fmt.Errorf("only block volume mode is supported for ReadWriteMany block volume creation")
+			}
 		} else if volCap.AccessMode.Mode == csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY ||
 			volCap.AccessMode.Mode == csi.VolumeCapability_AccessMode_MULTI_NODE_SINGLE_WRITER ||
 			volCap.AccessMode.Mode == csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER {
@@ -216,6 +329,9 @@ func IsValidVolumeCapabilities(ctx context.Context, volCaps []*csi.VolumeCapabil
 	if IsFileVolumeRequest(ctx, volCaps) {
 		return validateVolumeCapabilities(volCaps, FileVolumeCaps, FileVolumeType)
 	}
+	if IsMultiWriterBlockVolumeRequest(ctx, volCaps) {
+		return validateVolumeCapabilities(volCaps, MultiWriterBlockVolumeCaps, BlockVolumeType)
+	}
 	return validateVolumeCapabilities(volCaps, BlockVolumeCaps, BlockVolumeType)
 }
 
@@ -228,15 +344,104 @@ func ParseStorageClassParams(ctx context.Context, params map[string]string,
 		DatastoreURL:      "",
 		StoragePolicyName: "",
 	}
+	var iopsLimit, throughputLimit string
 	if !csiMigrationFeatureState {
 		for param, value := range params {
 			param = strings.ToLower(param)
 			if param == AttributeDatastoreURL {
 				scParams.DatastoreURL = value
+			} else if param == AttributeDatastoreURLs {
+				scParams.DatastoreURLs = parseDatastoreURLs(value)
+			} else if param == AttributeZoneStoragePolicyIDs {
+				zoneStoragePolicyIDs, err := parseZoneStoragePolicyIDs(value)
+				if err != nil {
+					return nil, err
+				}
+				scParams.ZoneStoragePolicyIDs = zoneStoragePolicyIDs
+			} else if param == AttributeDatastoreTags {
+				datastoreTags, err := parseDatastoreTags(value)
+				if err != nil {
+					return nil, err
+				}
+				scParams.DatastoreTags = datastoreTags
+			} else if param == AttributeStoragePod {
+				scParams.StoragePod = value
+			} else if param == AttributeSnapshotDeletePolicy {
+				snapshotDeletePolicy, err := ParseSnapshotDeletePolicy(value)
+				if err != nil {
+					return nil, err
+				}
+				scParams.SnapshotDeletePolicy = snapshotDeletePolicy
+			} else if param == AttributeQualifiedDatastore {
+				if _, _, err := SplitQualifiedDatastore(value); err != nil {
+					return nil, err
+				}
+				scParams.QualifiedDatastore = value
 			} else if param == AttributeStoragePolicyName {
 				scParams.StoragePolicyName = value
 			} else if param == AttributeFsType {
 				log.Warnf("param 'fstype' is deprecated, please use 'csi.storage.k8s.io/fstype' instead")
+			} else if param == AttributeXFSProjectQuota {
+				xfsProjectQuota, err := strconv.ParseBool(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value %q for param %q", value, AttributeXFSProjectQuota)
+				}
+				scParams.XFSProjectQuota = xfsProjectQuota
+			} else if param == AttributeReadOnlyClone {
+				readOnlyClone, err := strconv.ParseBool(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value %q for param %q", value, AttributeReadOnlyClone)
+				}
+				scParams.ReadOnlyClone = readOnlyClone
+			} else if param == AttributeIopsLimit {
+				iopsLimit = value
+			} else if param == AttributeThroughputLimit {
+				throughputLimit = value
+			} else if param == AttributeDryRun {
+				dryRun, err := strconv.ParseBool(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value %q for param %q", value, AttributeDryRun)
+				}
+				scParams.DryRun = dryRun
+			} else if param == AttributeVolumeNamePrefix {
+				if err := validateVolumeNamePrefix(value); err != nil {
+					return nil, err
+				}
+				scParams.VolumeNamePrefix = value
+			} else if param == AttributeDiskFormat {
+				diskFormat := strings.ToLower(value)
+				if !slices.Contains([]string{DiskFormatThin, DiskFormatThick, DiskFormatEagerZeroedThick},
+					diskFormat) {
+					return nil, fmt.Errorf("invalid value %q for param %q, supported values are %q, %q and %q",
+						value, AttributeDiskFormat, DiskFormatThin, DiskFormatThick, DiskFormatEagerZeroedThick)
+				}
+				scParams.DiskFormat = diskFormat
+			} else if param == AttributePlacementStrategy {
+				placementStrategy, err := ParsePlacementStrategy(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value %q for param %q, supported values are %q",
+						value, AttributePlacementStrategy, placementStrategies)
+				}
+				scParams.PlacementStrategy = placementStrategy
+			} else if param == AttributeAntiAffinityGroup {
+				scParams.AntiAffinityGroup = strings.TrimSpace(value)
+			} else if param == AttributeDeletionRetentionMinutes {
+				retentionMinutes, err := strconv.ParseInt(value, 10, 64)
+				if err != nil || retentionMinutes < 0 {
+					return nil, fmt.Errorf("invalid value %q for param %q, expecting a non-negative number "+
+						"of minutes", value, AttributeDeletionRetentionMinutes)
+				}
+				scParams.DeletionRetentionMinutes = retentionMinutes
+			} else if param == AttributePvcName || param == AttributePvcNamespace || param == AttributePvName {
+				// Passed by the external-provisioner with --extra-create-metadata.
+				continue
+			} else if param == AttributeRetainUntil {
+				retainUntil, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value %q for param %q, expecting a time in RFC 3339 format",
+						value, AttributeRetainUntil)
+				}
+				scParams.RetainUntil = retainUntil.UTC()
 			} else {
 				return nil, fmt.Errorf("invalid param: %q and value: %q", param, value)
 			}
@@ -247,10 +452,98 @@ func ParseStorageClassParams(ctx context.Context, params map[string]string,
 			param = strings.ToLower(param)
 			if param == AttributeDatastoreURL {
 				scParams.DatastoreURL = value
+			} else if param == AttributeDatastoreURLs {
+				scParams.DatastoreURLs = parseDatastoreURLs(value)
+			} else if param == AttributeZoneStoragePolicyIDs {
+				zoneStoragePolicyIDs, err := parseZoneStoragePolicyIDs(value)
+				if err != nil {
+					return nil, err
+				}
+				scParams.ZoneStoragePolicyIDs = zoneStoragePolicyIDs
+			} else if param == AttributeDatastoreTags {
+				datastoreTags, err := parseDatastoreTags(value)
+				if err != nil {
+					return nil, err
+				}
+				scParams.DatastoreTags = datastoreTags
+			} else if param == AttributeStoragePod {
+				scParams.StoragePod = value
+			} else if param == AttributeSnapshotDeletePolicy {
+				snapshotDeletePolicy, err := ParseSnapshotDeletePolicy(value)
+				if err != nil {
+					return nil, err
+				}
+				scParams.SnapshotDeletePolicy = snapshotDeletePolicy
+			} else if param == AttributeQualifiedDatastore {
+				if _, _, err := SplitQualifiedDatastore(value); err != nil {
+					return nil, err
+				}
+				scParams.QualifiedDatastore = value
 			} else if param == AttributeStoragePolicyName {
 				scParams.StoragePolicyName = value
 			} else if param == AttributeFsType {
 				log.Warnf("param 'fstype' is deprecated, please use 'csi.storage.k8s.io/fstype' instead")
+			} else if param == AttributeXFSProjectQuota {
+				xfsProjectQuota, err := strconv.ParseBool(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value %q for param %q", value, AttributeXFSProjectQuota)
+				}
+				scParams.XFSProjectQuota = xfsProjectQuota
+			} else if param == AttributeReadOnlyClone {
+				readOnlyClone, err := strconv.ParseBool(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value %q for param %q", value, AttributeReadOnlyClone)
+				}
+				scParams.ReadOnlyClone = readOnlyClone
+			} else if param == AttributeIopsLimit {
+				iopsLimit = value
+			} else if param == AttributeThroughputLimit {
+				throughputLimit = value
+			} else if param == AttributeDryRun {
+				dryRun, err := strconv.ParseBool(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value %q for param %q", value, AttributeDryRun)
+				}
+				scParams.DryRun = dryRun
+			} else if param == AttributeVolumeNamePrefix {
+				if err := validateVolumeNamePrefix(value); err != nil {
+					return nil, err
+				}
+				scParams.VolumeNamePrefix = value
+			} else if param == AttributeDiskFormat {
+				diskFormat := strings.ToLower(value)
+				if !slices.Contains([]string{DiskFormatThin, DiskFormatThick, DiskFormatEagerZeroedThick},
+					diskFormat) {
+					return nil, fmt.Errorf("invalid value %q for param %q, supported values are %q, %q and %q",
+						value, AttributeDiskFormat, DiskFormatThin, DiskFormatThick, DiskFormatEagerZeroedThick)
+				}
+				scParams.DiskFormat = diskFormat
+			} else if param == AttributePlacementStrategy {
+				placementStrategy, err := ParsePlacementStrategy(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value %q for param %q, supported values are %q",
+						value, AttributePlacementStrategy, placementStrategies)
+				}
+				scParams.PlacementStrategy = placementStrategy
+			} else if param == AttributeAntiAffinityGroup {
+				scParams.AntiAffinityGroup = strings.TrimSpace(value)
+			} else if param == AttributeDeletionRetentionMinutes {
+				retentionMinutes, err := strconv.ParseInt(value, 10, 64)
+				if err != nil || retentionMinutes < 0 {
+					return nil, fmt.Errorf("invalid value %q for param %q, expecting a non-negative number "+
+						"of minutes", value, AttributeDeletionRetentionMinutes)
+				}
+				scParams.DeletionRetentionMinutes = retentionMinutes
+			} else if param == AttributePvcName || param == AttributePvcNamespace || param == AttributePvName {
+				// Passed by the external-provisioner with --extra-create-metadata.
+				continue
+			} else if param == AttributeRetainUntil {
+				retainUntil, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value %q for param %q, expecting a time in RFC 3339 format",
+						value, AttributeRetainUntil)
+				}
+				scParams.RetainUntil = retainUntil.UTC()
 			} else if param == CSIMigrationParams {
 				scParams.CSIMigration = value
 			} else {
@@ -281,9 +574,246 @@ func ParseStorageClassParams(ctx context.Context, params map[string]string,
 			}
 		}
 	}
+	if scParams.DatastoreURL != "" && len(scParams.DatastoreURLs) != 0 &&
+		!slices.Contains(scParams.DatastoreURLs, scParams.DatastoreURL) {
+		return nil, fmt.Errorf("datastore URL %q is not present in %s: %v", scParams.DatastoreURL,
+			AttributeDatastoreURLs, scParams.DatastoreURLs)
+	}
+	if scParams.StoragePod != "" && scParams.DatastoreURL != "" {
+		return nil, fmt.Errorf("params %q and %q are mutually exclusive", AttributeStoragePod,
+			AttributeDatastoreURL)
+	}
+	if scParams.QualifiedDatastore != "" && (scParams.DatastoreURL != "" || scParams.StoragePod != "") {
+		return nil, fmt.Errorf("param %q is mutually exclusive with params %q and %q",
+			AttributeQualifiedDatastore, AttributeDatastoreURL, AttributeStoragePod)
+	}
+	if len(scParams.ZoneStoragePolicyIDs) != 0 && scParams.StoragePolicyName != "" {
+		return nil, fmt.Errorf("params %q and %q are mutually exclusive", AttributeZoneStoragePolicyIDs,
+			AttributeStoragePolicyName)
+	}
+	if iopsLimit != "" || throughputLimit != "" {
+		limit, err := ParseIopsLimit(iopsLimit, throughputLimit)
+		if err != nil {
+			return nil, err
+		}
+		if limit != IopsLimitUnlimited {
+			scParams.IopsLimit = limit
+		}
+	}
 	return scParams, nil
 }
 
+// ParseIopsLimit returns the IOPS limit of the virtual disk of a volume given
+// by the iopsLimit and throughputLimit parameters, either of which may be
+// empty. The throughput limit in MB/s is enforced as an IOPS limit of
+// IopsPerThroughputMBps IOPS per MB/s, and the lower of the two limits is
+// returned. IopsLimitUnlimited is returned if both are "unlimited".
+func ParseIopsLimit(iopsLimit string, throughputLimit string) (int64, error) {
+	limit := IopsLimitUnlimited
+	for _, param := range []struct {
+		name       string
+		value      string
+		multiplier int64
+	}{
+		{AttributeIopsLimit, iopsLimit, 1},
+		{AttributeThroughputLimit, throughputLimit, IopsPerThroughputMBps},
+	} {
+		if param.value == "" || strings.EqualFold(param.value, "unlimited") {
+			continue
+		}
+		value, err := strconv.ParseInt(param.value, 10, 64)
+		if err != nil || value <= 0 || value > math.MaxInt32/param.multiplier {
+			return 0, fmt.Errorf("invalid value %q for param %q, it must be \"unlimited\" or an integer "+
+				"between 1 and %d", param.value, param.name, math.MaxInt32/param.multiplier)
+		}
+		if value*param.multiplier < limit || limit == IopsLimitUnlimited {
+			limit = value * param.multiplier
+		}
+	}
+	return limit, nil
+}
+
+// validateVolumeNamePrefix validates the volume name prefix given in the
+// Storage Class against the length allowed in CNS volume names. The prefixed
+// names are also used as names of CnsVolumeOperationRequest instances, so the
+// prefix must keep them valid DNS-1123 subdomains.
+func validateVolumeNamePrefix(prefix string) error {
+	if prefix == "" {
+		return fmt.Errorf("value for param %q must not be empty", AttributeVolumeNamePrefix)
+	}
+	if len(prefix) > maxVolumeNamePrefixLength {
+		return fmt.Errorf("value %q for param %q exceeds the maximum length of %d characters",
+			prefix, AttributeVolumeNamePrefix, maxVolumeNamePrefixLength)
+	}
+	if errs := validation.IsDNS1123Subdomain(prefix + "pvc"); len(errs) > 0 {
+		return fmt.Errorf("invalid value %q for param %q, it must start with a lowercase alphanumeric "+
+			"character and contain only lowercase alphanumeric characters, '.' or '-': %s", prefix,
+			AttributeVolumeNamePrefix, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// GetCnsVolumeName returns the name of the CNS volume for the given volume
+// name, prefixed with the volume name prefix given in the Storage Class.
+func GetCnsVolumeName(scParams *StorageClassParams, name string) string {
+	return scParams.VolumeNamePrefix + name
+}
+
+// ValidateXFSProjectQuotaRequest validates that all the given volume
+// capabilities request a mount volume with the XFS filesystem, which is
+// required to enforce XFS project quota on the volume.
+func ValidateXFSProjectQuotaRequest(volCaps []*csi.VolumeCapability) error {
+	for _, volCap := range volCaps {
+		if volCap.GetMount() == nil || !strings.EqualFold(volCap.GetMount().GetFsType(), XFSType) {
+			return fmt.Errorf("param %q is only supported for volumes with %q filesystem",
+				AttributeXFSProjectQuota, XFSType)
+		}
+	}
+	return nil
+}
+
+// ParseSnapshotDeletePolicy returns the snapshot delete policy given by value,
+// in lower case, or an error if it is not a supported policy.
+func ParseSnapshotDeletePolicy(value string) (string, error) {
+	policy := strings.ToLower(strings.TrimSpace(value))
+	if policy != SnapshotDeletePolicyFail && policy != SnapshotDeletePolicyCascade {
+		return "", fmt.Errorf("invalid value %q for param %q, supported values are %q and %q", value,
+			AttributeSnapshotDeletePolicy, SnapshotDeletePolicyFail, SnapshotDeletePolicyCascade)
+	}
+	return policy, nil
+}
+
+// SplitQualifiedDatastore splits the datacenter-qualified name of a datastore,
+// of the form "<datacenter>/<datastore>", into the name or inventory path of
+// the datacenter and the name of the datastore.
+func SplitQualifiedDatastore(qualifiedDatastore string) (string, string, error) {
+	qualifiedDatastore = strings.Trim(strings.TrimSpace(qualifiedDatastore), "/")
+	i := strings.LastIndex(qualifiedDatastore, "/")
+	if i <= 0 || i == len(qualifiedDatastore)-1 {
+		return "", "", fmt.Errorf("invalid value %q for param %q, expecting a datastore name of the form "+
+			"<datacenter>/<datastore>", qualifiedDatastore, AttributeQualifiedDatastore)
+	}
+	return qualifiedDatastore[:i], qualifiedDatastore[i+1:], nil
+}
+
+// parseDatastoreURLs splits a comma separated list of datastore URLs,
+// ignoring empty entries.
+func parseDatastoreURLs(value string) []string {
+	var datastoreURLs []string
+	for _, url := range strings.Split(value, ",") {
+		url = strings.TrimSpace(url)
+		if url != "" {
+			datastoreURLs = append(datastoreURLs, url)
+		}
+	}
+	return datastoreURLs
+}
+
+// parseZoneStoragePolicyIDs parses a comma separated list of
+// "<zone>:<storage policy ID>" pairs, ignoring empty entries.
+func parseZoneStoragePolicyIDs(value string) (map[string]string, error) {
+	zoneStoragePolicyIDs := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		zone, policyID, found := strings.Cut(entry, ":")
+		zone, policyID = strings.TrimSpace(zone), strings.TrimSpace(policyID)
+		if !found || zone == "" || policyID == "" {
+			return nil, fmt.Errorf("invalid entry %q in param %q, expected <zone>:<storage policy ID>",
+				entry, AttributeZoneStoragePolicyIDs)
+		}
+		if _, exists := zoneStoragePolicyIDs[zone]; exists {
+			return nil, fmt.Errorf("zone %q is mapped more than once in param %q", zone,
+				AttributeZoneStoragePolicyIDs)
+		}
+		zoneStoragePolicyIDs[zone] = policyID
+	}
+	return zoneStoragePolicyIDs, nil
+}
+
+// ResolveZoneStoragePolicyID returns the storage policy ID mapped to the zone
+// of the topology segment selected for the volume, i.e. the first preferred
+// segment, or the first requisite segment if none is preferred. The zone is
+// matched against the values of the segment. The selected segment is returned
+// as well, so that the volume is provisioned in the zone of the policy.
+func ResolveZoneStoragePolicyID(topologyRequirement *csi.TopologyRequirement,
+	zoneStoragePolicyIDs map[string]string) (string, map[string]string, error) {
+	var segments map[string]string
+	if preferred := topologyRequirement.GetPreferred(); len(preferred) != 0 {
+		segments = preferred[0].GetSegments()
+	} else if requisite := topologyRequirement.GetRequisite(); len(requisite) != 0 {
+		segments = requisite[0].GetSegments()
+	}
+	if len(segments) == 0 {
+		return "", nil, fmt.Errorf("param %q requires a topology requirement for the volume",
+			AttributeZoneStoragePolicyIDs)
+	}
+	keys := slices.Sorted(maps.Keys(segments))
+	for _, key := range keys {
+		if policyID, ok := zoneStoragePolicyIDs[segments[key]]; ok {
+			return policyID, segments, nil
+		}
+	}
+	return "", nil, fmt.Errorf("no storage policy is mapped in param %q to the zone of topology segment %v",
+		AttributeZoneStoragePolicyIDs, segments)
+}
+
+// GetSoftDeletedEntityMetadata returns the PV entity metadata of the given
+// cluster carrying the SoftDeletedLabel in the metadata of the volume, or nil
+// if the volume is not soft deleted.
+func GetSoftDeletedEntityMetadata(volume *cnstypes.CnsVolume,
+	clusterID string) *cnstypes.CnsKubernetesEntityMetadata {
+	for _, metadata := range volume.Metadata.EntityMetadata {
+		k8sMetadata, ok := metadata.(*cnstypes.CnsKubernetesEntityMetadata)
+		if !ok || k8sMetadata.ClusterID != clusterID ||
+			k8sMetadata.EntityType != string(cnstypes.CnsKubernetesEntityTypePV) {
+			continue
+		}
+		for _, label := range k8sMetadata.Labels {
+			if label.Key == SoftDeletedLabel && label.Value == "true" {
+				return k8sMetadata
+			}
+		}
+	}
+	return nil
+}
+
+// IsEphemeralVolume returns true if the CNS volume backs a CSI ephemeral
+// inline volume, which has no PV.
+func IsEphemeralVolume(volume *cnstypes.CnsVolume) bool {
+	return strings.HasPrefix(volume.Name, EphemeralVolumeNamePrefix)
+}
+
+// GetEphemeralVolumeHandle returns the volume handle kubelet generates for the
+// CSI ephemeral inline volume podVolumeName of the pod with the given UID.
+func GetEphemeralVolumeHandle(podUID string, podVolumeName string) string {
+	return fmt.Sprintf("csi-%x", sha256.Sum256([]byte(podUID+podVolumeName)))
+}
+
+// GetEphemeralVolumeName returns the name of the CNS volume backing the CSI
+// ephemeral inline volume with the given handle.
+func GetEphemeralVolumeName(volumeHandle string) string {
+	return EphemeralVolumeNamePrefix + strings.TrimPrefix(volumeHandle, "csi-")
+}
+
+// FilterDatastoresByURLs returns the datastores from the given list whose URL
+// is present in the datastoreURLs allowlist.
+func FilterDatastoresByURLs(ctx context.Context, datastores []*cnsvsphere.DatastoreInfo,
+	datastoreURLs []string) []*cnsvsphere.DatastoreInfo {
+	log := logger.GetLogger(ctx)
+	var filteredDatastores []*cnsvsphere.DatastoreInfo
+	for _, ds := range datastores {
+		if slices.Contains(datastoreURLs, strings.TrimSpace(ds.Info.Url)) {
+			filteredDatastores = append(filteredDatastores, ds)
+		} else {
+			log.Debugf("filter out datastore %q not present in %s allowlist", ds.Info.Url, AttributeDatastoreURLs)
+		}
+	}
+	return filteredDatastores
+}
+
 // GetK8sCloudOperatorServicePort return the port to connect the
 // K8sCloudOperator gRPC service.
 // If environment variable POD_LISTENER_SERVICE_PORT is set and valid,
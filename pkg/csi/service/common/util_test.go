@@ -20,12 +20,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	"github.com/vmware/govmomi/vapi/tags"
+	"github.com/vmware/govmomi/vim25/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/vsphere"
 )
 
 var (
@@ -326,23 +336,71 @@ func TestInvalidVolumeCapabilitiesForFile(t *testing.T) {
 		t.Errorf("Invalid file VolCap = %+v passed validation!", volCap)
 	}
 
-	// Invalid case: volumeMode=block and accessMode=MULTI_NODE_MULTI_WRITER
+	// Invalid case: volumeMode=block and accessMode=MULTI_NODE_READER_ONLY
 	volCap = []*csi.VolumeCapability{
 		{
 			AccessType: &csi.VolumeCapability_Block{
 				Block: &csi.VolumeCapability_BlockVolume{},
 			},
 			AccessMode: &csi.VolumeCapability_AccessMode{
-				Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+				Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY,
 			},
 		},
 	}
 	if err := IsValidVolumeCapabilities(ctx, volCap); err == nil {
 		t.Errorf("Invalid file VolCap = %+v passed validation!", volCap)
 	}
+}
+
+func TestVolumeCapabilitiesForMultiWriterBlock(t *testing.T) {
+	// Valid case: volumeMode=block and accessMode=MULTI_NODE_MULTI_WRITER
+	volCap := []*csi.VolumeCapability{
+		{
+			AccessType: &csi.VolumeCapability_Block{
+				Block: &csi.VolumeCapability_BlockVolume{},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+			},
+		},
+	}
+	if IsFileVolumeRequest(ctx, volCap) {
+		t.Errorf("VolCap = %+v reported as a FILE volume!", volCap)
+	}
+	if !IsMultiWriterBlockVolumeRequest(ctx, volCap) {
+		t.Errorf("VolCap = %+v not reported as a multi-writer BLOCK volume!", volCap)
+	}
+	if err := IsValidVolumeCapabilities(ctx, volCap); err != nil {
+		t.Errorf("Multi-writer block VolCap = %+v failed validation!", volCap)
+	}
+
+	// Invalid case: volumeMode=block and accessMode=MULTI_NODE_MULTI_WRITER
+	// requested along with fstype=ext4 and mode=MULTI_NODE_MULTI_WRITER.
+	volCap = append(volCap, &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{
+			Mount: &csi.VolumeCapability_MountVolume{
+				FsType: "ext4",
+			},
+		},
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+		},
+	})
+	if err := IsValidVolumeCapabilities(ctx, volCap); err == nil {
+		t.Errorf("Invalid VolCap = %+v passed validation!", volCap)
+	}
 
 	// Invalid case: volumeMode=block and accessMode=MULTI_NODE_READER_ONLY
+	// requested along with accessMode=MULTI_NODE_MULTI_WRITER.
 	volCap = []*csi.VolumeCapability{
+		{
+			AccessType: &csi.VolumeCapability_Block{
+				Block: &csi.VolumeCapability_BlockVolume{},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+			},
+		},
 		{
 			AccessType: &csi.VolumeCapability_Block{
 				Block: &csi.VolumeCapability_BlockVolume{},
@@ -353,7 +411,31 @@ func TestInvalidVolumeCapabilitiesForFile(t *testing.T) {
 		},
 	}
 	if err := IsValidVolumeCapabilities(ctx, volCap); err == nil {
-		t.Errorf("Invalid file VolCap = %+v passed validation!", volCap)
+		t.Errorf("Invalid VolCap = %+v passed validation!", volCap)
+	}
+}
+
+func TestValidateMultiWriterDisk(t *testing.T) {
+	tests := []struct {
+		datastoreType    string
+		provisioningType string
+		valid            bool
+	}{
+		{"vsan", "thin", true},
+		{"VVOL", "thin", true},
+		{"VMFS", "eagerZeroedThick", true},
+		{"VMFS", "thin", false},
+		{"VMFS", "lazyZeroedThick", false},
+		{"NFS41", "thin", false},
+	}
+	for _, test := range tests {
+		err := ValidateMultiWriterDisk(test.datastoreType, test.provisioningType)
+		if test.valid && err != nil {
+			t.Errorf("%s disk on %s datastore failed validation: %v", test.provisioningType,
+				test.datastoreType, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("%s disk on %s datastore passed validation", test.provisioningType, test.datastoreType)
+		}
 	}
 }
 
@@ -536,3 +618,479 @@ func TestParseCSISnapshotID(t *testing.T) {
 		})
 	}
 }
+
+func TestParseStorageClassParamsWithDatastoreURLs(t *testing.T) {
+	params := map[string]string{
+		AttributeDatastoreURLs: "ds:///vmfs/volumes/ds1/, ds:///vmfs/volumes/ds2/,",
+	}
+	scParams, err := ParseStorageClassParams(ctx, params, false)
+	if err != nil {
+		t.Fatalf("failed to parse params: %+v, err: %v", params, err)
+	}
+	expected := []string{"ds:///vmfs/volumes/ds1/", "ds:///vmfs/volumes/ds2/"}
+	if !reflect.DeepEqual(scParams.DatastoreURLs, expected) {
+		t.Errorf("Expected: %v\n Actual: %v", expected, scParams.DatastoreURLs)
+	}
+	datastores := []*cnsvsphere.DatastoreInfo{
+		{Info: &types.DatastoreInfo{Url: "ds:///vmfs/volumes/ds1/"}},
+		{Info: &types.DatastoreInfo{Url: "ds:///vmfs/volumes/ds3/"}},
+	}
+	filtered := FilterDatastoresByURLs(ctx, datastores, scParams.DatastoreURLs)
+	if len(filtered) != 1 || filtered[0].Info.Url != "ds:///vmfs/volumes/ds1/" {
+		t.Errorf("unexpected datastores after filtering: %+v", filtered)
+	}
+
+	// datastoreurl not present in datastoreurls allowlist is invalid.
+	params[AttributeDatastoreURL] = "ds:///vmfs/volumes/ds3/"
+	if _, err = ParseStorageClassParams(ctx, params, false); err == nil {
+		t.Errorf("error expected but not received for params: %+v", params)
+	}
+}
+
+func TestParseStorageClassParamsWithVolumeNamePrefix(t *testing.T) {
+	params := map[string]string{
+		AttributeVolumeNamePrefix: "cluster-1.",
+	}
+	scParams, err := ParseStorageClassParams(ctx, params, false)
+	if err != nil {
+		t.Fatalf("failed to parse params: %+v, err: %v", params, err)
+	}
+	if name := GetCnsVolumeName(scParams, "pvc-1"); name != "cluster-1.pvc-1" {
+		t.Errorf("unexpected CNS volume name %q for params: %+v", name, params)
+	}
+	params[AttributeVolumeNamePrefix] = "cluster-1-"
+	if _, err = ParseStorageClassParams(ctx, params, false); err != nil {
+		t.Errorf("failed to parse params: %+v, err: %v", params, err)
+	}
+	// The prefixed names must be valid names of CnsVolumeOperationRequest instances.
+	for _, prefix := range []string{"", "-cluster1", "cluster 1", "cluster/1", "Cluster1-", "cluster_1-",
+		"cluster1..", strings.Repeat("a", 33)} {
+		params[AttributeVolumeNamePrefix] = prefix
+		if _, err = ParseStorageClassParams(ctx, params, false); err == nil {
+			t.Errorf("error expected but not received for params: %+v", params)
+		}
+	}
+}
+
+func TestParseStorageClassParamsWithDiskFormat(t *testing.T) {
+	params := map[string]string{
+		AttributeDiskFormat: "EagerZeroedThick",
+	}
+	for _, csiMigrationEnabled := range []bool{false, true} {
+		scParams, err := ParseStorageClassParams(ctx, params, csiMigrationEnabled)
+		if err != nil {
+			t.Fatalf("failed to parse params: %+v, err: %v", params, err)
+		}
+		if scParams.DiskFormat != DiskFormatEagerZeroedThick {
+			t.Errorf("unexpected disk format %q for params: %+v", scParams.DiskFormat, params)
+		}
+	}
+	params[AttributeDiskFormat] = "zeroedthick"
+	if _, err := ParseStorageClassParams(ctx, params, false); err == nil {
+		t.Errorf("error expected but not received for params: %+v", params)
+	}
+}
+
+func TestParseStorageClassParamsWithReadOnlyClone(t *testing.T) {
+	params := map[string]string{
+		AttributeReadOnlyClone: "true",
+	}
+	for _, csiMigrationEnabled := range []bool{false, true} {
+		scParams, err := ParseStorageClassParams(ctx, params, csiMigrationEnabled)
+		if err != nil {
+			t.Fatalf("failed to parse params: %+v, err: %v", params, err)
+		}
+		if !scParams.ReadOnlyClone {
+			t.Errorf("Expected ReadOnlyClone to be set for params: %+v", params)
+		}
+	}
+	params[AttributeReadOnlyClone] = "invalid"
+	if _, err := ParseStorageClassParams(ctx, params, false); err == nil {
+		t.Errorf("error expected but not received for params: %+v", params)
+	}
+}
+
+func TestIsReadOnlyCloneVolume(t *testing.T) {
+	readOnlyClone := map[string]string{AttributeReadOnlyClone: "true"}
+	if !IsReadOnlyCloneVolume(readOnlyClone, nil) {
+		t.Errorf("expected volume context %+v to mark a read-only clone", readOnlyClone)
+	}
+	// Statically provisioned PVs of read-only clones carry the marker in the
+	// publish context only.
+	if !IsReadOnlyCloneVolume(map[string]string{}, readOnlyClone) {
+		t.Errorf("expected publish context %+v to mark a read-only clone", readOnlyClone)
+	}
+	if IsReadOnlyCloneVolume(map[string]string{AttributeReadOnlyClone: "false"}, nil) {
+		t.Errorf("expected a volume which is not a read-only clone")
+	}
+}
+
+func TestParseStorageClassParamsWithDatastoreTags(t *testing.T) {
+	params := map[string]string{
+		AttributeDatastoreTags: "tier:gold, ssd,",
+	}
+	for _, csiMigrationEnabled := range []bool{false, true} {
+		scParams, err := ParseStorageClassParams(ctx, params, csiMigrationEnabled)
+		if err != nil {
+			t.Fatalf("failed to parse params: %+v, err: %v", params, err)
+		}
+		if !reflect.DeepEqual(scParams.DatastoreTags, []string{"tier:gold", "ssd"}) {
+			t.Errorf("unexpected datastore tags %v for params: %+v", scParams.DatastoreTags, params)
+		}
+	}
+	params[AttributeDatastoreTags] = "tier:"
+	if _, err := ParseStorageClassParams(ctx, params, false); err == nil {
+		t.Errorf("error expected but not received for params: %+v", params)
+	}
+}
+
+func TestParseStorageClassParamsWithStoragePod(t *testing.T) {
+	params := map[string]string{
+		AttributeStoragePod: "DatastoreCluster1",
+	}
+	for _, csiMigrationEnabled := range []bool{false, true} {
+		scParams, err := ParseStorageClassParams(ctx, params, csiMigrationEnabled)
+		if err != nil {
+			t.Fatalf("failed to parse params: %+v, err: %v", params, err)
+		}
+		if scParams.StoragePod != "DatastoreCluster1" {
+			t.Errorf("unexpected storage pod %q for params: %+v", scParams.StoragePod, params)
+		}
+	}
+	params[AttributeDatastoreURL] = "ds:///vmfs/volumes/vsan:52cd/"
+	if _, err := ParseStorageClassParams(ctx, params, false); err == nil {
+		t.Errorf("error expected but not received for params: %+v", params)
+	}
+}
+
+func TestParseStorageClassParamsWithQualifiedDatastore(t *testing.T) {
+	params := map[string]string{
+		AttributeQualifiedDatastore: "Folder1/Datacenter1/vsanDatastore",
+	}
+	for _, csiMigrationEnabled := range []bool{false, true} {
+		scParams, err := ParseStorageClassParams(ctx, params, csiMigrationEnabled)
+		if err != nil {
+			t.Fatalf("failed to parse params: %+v, err: %v", params, err)
+		}
+		if scParams.QualifiedDatastore != "Folder1/Datacenter1/vsanDatastore" {
+			t.Errorf("unexpected qualified datastore %q for params: %+v", scParams.QualifiedDatastore, params)
+		}
+	}
+	dcPath, dsName, err := SplitQualifiedDatastore(params[AttributeQualifiedDatastore])
+	if err != nil || dcPath != "Folder1/Datacenter1" || dsName != "vsanDatastore" {
+		t.Errorf("unexpected split %q, %q, %v of %q", dcPath, dsName, err, params[AttributeQualifiedDatastore])
+	}
+	for _, value := range []string{"vsanDatastore", "Datacenter1/", "/vsanDatastore"} {
+		if _, err := ParseStorageClassParams(ctx, map[string]string{AttributeQualifiedDatastore: value},
+			false); err == nil {
+			t.Errorf("error expected but not received for value %q", value)
+		}
+	}
+	params[AttributeDatastoreURL] = "ds:///vmfs/volumes/vsan:52cd/"
+	if _, err := ParseStorageClassParams(ctx, params, false); err == nil {
+		t.Errorf("error expected but not received for params: %+v", params)
+	}
+}
+
+func TestParseStorageClassParamsWithSnapshotDeletePolicy(t *testing.T) {
+	params := map[string]string{
+		AttributeSnapshotDeletePolicy: "Cascade",
+	}
+	for _, csiMigrationEnabled := range []bool{false, true} {
+		scParams, err := ParseStorageClassParams(ctx, params, csiMigrationEnabled)
+		if err != nil {
+			t.Fatalf("failed to parse params: %+v, err: %v", params, err)
+		}
+		if scParams.SnapshotDeletePolicy != SnapshotDeletePolicyCascade {
+			t.Errorf("unexpected snapshot delete policy %q for params: %+v", scParams.SnapshotDeletePolicy,
+				params)
+		}
+	}
+	params[AttributeSnapshotDeletePolicy] = "retain"
+	if _, err := ParseStorageClassParams(ctx, params, false); err == nil {
+		t.Errorf("error expected but not received for params: %+v", params)
+	}
+}
+
+func TestHasAllTags(t *testing.T) {
+	tagSet := newDatastoreTagSet([]tags.Tag{
+		{Name: "gold", CategoryID: "category-1"},
+		{Name: "ssd", CategoryID: "category-2"},
+	}, map[string]string{"category-1": "tier"})
+	for _, tc := range []struct {
+		requiredTags []string
+		expected     bool
+	}{
+		{[]string{"gold"}, true},
+		{[]string{"tier:gold", "ssd"}, true},
+		{[]string{"tier:ssd"}, false},
+		{[]string{"gold", "nvme"}, false},
+	} {
+		if actual := hasAllTags(tagSet, tc.requiredTags); actual != tc.expected {
+			t.Errorf("hasAllTags(%v) = %v, expected %v", tc.requiredTags, actual, tc.expected)
+		}
+	}
+}
+
+func TestParseStorageClassParamsWithDeletionRetention(t *testing.T) {
+	params := map[string]string{
+		AttributeDeletionRetentionMinutes: "1440",
+	}
+	for _, csiMigrationEnabled := range []bool{false, true} {
+		scParams, err := ParseStorageClassParams(ctx, params, csiMigrationEnabled)
+		if err != nil {
+			t.Fatalf("failed to parse params: %+v, err: %v", params, err)
+		}
+		if scParams.DeletionRetentionMinutes != 1440 {
+			t.Errorf("unexpected deletion retention %d for params: %+v", scParams.DeletionRetentionMinutes, params)
+		}
+	}
+	for _, value := range []string{"-1", "1d"} {
+		params[AttributeDeletionRetentionMinutes] = value
+		if _, err := ParseStorageClassParams(ctx, params, false); err == nil {
+			t.Errorf("error expected but not received for params: %+v", params)
+		}
+	}
+}
+
+func TestParseStorageClassParamsWithRetainUntil(t *testing.T) {
+	params := map[string]string{
+		AttributeRetainUntil: "2030-01-01T08:00:00+08:00",
+	}
+	expected := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, csiMigrationEnabled := range []bool{false, true} {
+		scParams, err := ParseStorageClassParams(ctx, params, csiMigrationEnabled)
+		if err != nil {
+			t.Fatalf("failed to parse params: %+v, err: %v", params, err)
+		}
+		if !scParams.RetainUntil.Equal(expected) || scParams.RetainUntil.Location() != time.UTC {
+			t.Errorf("unexpected retention time %v for params: %+v", scParams.RetainUntil, params)
+		}
+	}
+	for _, value := range []string{"2030-01-01", "1y"} {
+		params[AttributeRetainUntil] = value
+		if _, err := ParseStorageClassParams(ctx, params, false); err == nil {
+			t.Errorf("error expected but not received for params: %+v", params)
+		}
+	}
+}
+
+func TestParseStorageClassParamsWithExtraCreateMetadata(t *testing.T) {
+	params := map[string]string{
+		AttributeStoragePolicyName: "gold",
+		AttributePvcName:           "pvc-1",
+		AttributePvcNamespace:      "ns-1",
+		AttributePvName:            "pv-1",
+	}
+	for _, csiMigrationEnabled := range []bool{false, true} {
+		scParams, err := ParseStorageClassParams(ctx, params, csiMigrationEnabled)
+		if err != nil {
+			t.Fatalf("failed to parse params: %+v, err: %v", params, err)
+		}
+		if scParams.StoragePolicyName != "gold" {
+			t.Errorf("unexpected storage policy %q for params: %+v", scParams.StoragePolicyName, params)
+		}
+	}
+}
+
+func TestGetSoftDeletedEntityMetadata(t *testing.T) {
+	pvMetadata := &cnstypes.CnsKubernetesEntityMetadata{
+		CnsEntityMetadata: cnstypes.CnsEntityMetadata{
+			EntityName: "pv-1",
+			Labels:     []types.KeyValue{{Key: SoftDeletedLabel, Value: "true"}},
+			ClusterID:  "cluster-1",
+		},
+		EntityType: string(cnstypes.CnsKubernetesEntityTypePV),
+	}
+	volume := &cnstypes.CnsVolume{
+		Metadata: cnstypes.CnsVolumeMetadata{
+			EntityMetadata: []cnstypes.BaseCnsEntityMetadata{pvMetadata},
+		},
+	}
+	if metadata := GetSoftDeletedEntityMetadata(volume, "cluster-1"); metadata != pvMetadata {
+		t.Errorf("expected soft deleted metadata %+v, got %+v", pvMetadata, metadata)
+	}
+	if metadata := GetSoftDeletedEntityMetadata(volume, "cluster-2"); metadata != nil {
+		t.Errorf("expected no soft deleted metadata for another cluster, got %+v", metadata)
+	}
+	pvMetadata.Labels = nil
+	if metadata := GetSoftDeletedEntityMetadata(volume, "cluster-1"); metadata != nil {
+		t.Errorf("expected no soft deleted metadata without label, got %+v", metadata)
+	}
+}
+
+func TestParseStorageClassParamsWithZoneStoragePolicyIDs(t *testing.T) {
+	params := map[string]string{
+		AttributeZoneStoragePolicyIDs: "zone-a:policy-1, zone-b:policy-2",
+	}
+	for _, csiMigrationEnabled := range []bool{false, true} {
+		scParams, err := ParseStorageClassParams(ctx, params, csiMigrationEnabled)
+		if err != nil {
+			t.Fatalf("failed to parse params: %+v, err: %v", params, err)
+		}
+		expected := map[string]string{"zone-a": "policy-1", "zone-b": "policy-2"}
+		if !reflect.DeepEqual(scParams.ZoneStoragePolicyIDs, expected) {
+			t.Errorf("unexpected zone storage policy IDs %v for params: %+v", scParams.ZoneStoragePolicyIDs, params)
+		}
+	}
+	params[AttributeStoragePolicyName] = "gold"
+	if _, err := ParseStorageClassParams(ctx, params, false); err == nil {
+		t.Errorf("error expected but not received for params: %+v", params)
+	}
+	for _, value := range []string{"zone-a", "zone-a:policy-1,zone-a:policy-2", ":policy-1"} {
+		params = map[string]string{AttributeZoneStoragePolicyIDs: value}
+		if _, err := ParseStorageClassParams(ctx, params, false); err == nil {
+			t.Errorf("error expected but not received for params: %+v", params)
+		}
+	}
+}
+
+func TestResolveZoneStoragePolicyID(t *testing.T) {
+	zoneStoragePolicyIDs := map[string]string{"zone-a": "policy-1", "zone-b": "policy-2"}
+	segmentsA := map[string]string{"topology.kubernetes.io/region": "region-1", "topology.kubernetes.io/zone": "zone-a"}
+	segmentsB := map[string]string{"topology.kubernetes.io/region": "region-1", "topology.kubernetes.io/zone": "zone-b"}
+	segmentsC := map[string]string{"topology.kubernetes.io/region": "region-1", "topology.kubernetes.io/zone": "zone-c"}
+	topologyRequirement := &csi.TopologyRequirement{
+		Requisite: []*csi.Topology{{Segments: segmentsA}, {Segments: segmentsB}},
+		Preferred: []*csi.Topology{{Segments: segmentsB}, {Segments: segmentsA}},
+	}
+	policyID, segments, err := ResolveZoneStoragePolicyID(topologyRequirement, zoneStoragePolicyIDs)
+	if err != nil {
+		t.Fatalf("failed to resolve storage policy, err: %v", err)
+	}
+	if policyID != "policy-2" || !reflect.DeepEqual(segments, segmentsB) {
+		t.Errorf("unexpected storage policy %q for segment %v", policyID, segments)
+	}
+	topologyRequirement = &csi.TopologyRequirement{Requisite: []*csi.Topology{{Segments: segmentsA}}}
+	if policyID, _, err = ResolveZoneStoragePolicyID(topologyRequirement, zoneStoragePolicyIDs); err != nil ||
+		policyID != "policy-1" {
+		t.Errorf("expected storage policy %q, got %q, err: %v", "policy-1", policyID, err)
+	}
+	topologyRequirement = &csi.TopologyRequirement{Preferred: []*csi.Topology{{Segments: segmentsC}}}
+	if _, _, err = ResolveZoneStoragePolicyID(topologyRequirement, zoneStoragePolicyIDs); err == nil {
+		t.Errorf("error expected but not received for unmapped zone")
+	}
+	if _, _, err = ResolveZoneStoragePolicyID(nil, zoneStoragePolicyIDs); err == nil {
+		t.Errorf("error expected but not received without topology requirement")
+	}
+}
+
+func TestParseIopsLimit(t *testing.T) {
+	tests := []struct {
+		iopsLimit       string
+		throughputLimit string
+		expected        int64
+		expectErr       bool
+	}{
+		{iopsLimit: "1000", expected: 1000},
+		{throughputLimit: "10", expected: 10 * IopsPerThroughputMBps},
+		{iopsLimit: "100", throughputLimit: "10", expected: 100},
+		{iopsLimit: "unlimited", throughputLimit: "10", expected: 10 * IopsPerThroughputMBps},
+		{iopsLimit: "Unlimited", expected: IopsLimitUnlimited},
+		{iopsLimit: "0", expectErr: true},
+		{iopsLimit: "-5", expectErr: true},
+		{throughputLimit: "fast", expectErr: true},
+		{throughputLimit: "1000000000", expectErr: true},
+	}
+	for _, test := range tests {
+		limit, err := ParseIopsLimit(test.iopsLimit, test.throughputLimit)
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("error expected for iopsLimit %q and throughputLimit %q", test.iopsLimit,
+					test.throughputLimit)
+			}
+			continue
+		}
+		if err != nil || limit != test.expected {
+			t.Errorf("Expected IOPS limit %d for iopsLimit %q and throughputLimit %q, got %d, err: %v",
+				test.expected, test.iopsLimit, test.throughputLimit, limit, err)
+		}
+	}
+	scParams, err := ParseStorageClassParams(ctx, map[string]string{AttributeIopsLimit: "500"}, false)
+	if err != nil || scParams.IopsLimit != 500 {
+		t.Errorf("Expected IopsLimit 500 in StorageClass params, got %+v, err: %v", scParams, err)
+	}
+}
+
+func TestGetGuestDiskHints(t *testing.T) {
+	hints := GetGuestDiskHints(ctx, map[string]string{
+		AnnGuestDiskType:                           GuestDiskTypeData,
+		AnnGuestDiskHintPrefix + "unknown":         "value",
+		"volume.kubernetes.io/storage-provisioner": "csi.vsphere.vmware.com",
+	})
+	if !reflect.DeepEqual(hints, map[string]string{AnnGuestDiskType: GuestDiskTypeData}) {
+		t.Errorf("Expected only the guest disk type hint, got %v", hints)
+	}
+	if hints := GetGuestDiskHints(ctx, map[string]string{AnnGuestDiskType: "boot"}); len(hints) != 0 {
+		t.Errorf("Expected invalid guest disk type to be ignored, got %v", hints)
+	}
+}
+
+func TestParseStorageClassParamsWithXFSProjectQuota(t *testing.T) {
+	params := map[string]string{
+		AttributeXFSProjectQuota: "true",
+	}
+	scParams, err := ParseStorageClassParams(ctx, params, false)
+	if err != nil {
+		t.Fatalf("failed to parse params: %+v, err: %v", params, err)
+	}
+	if !scParams.XFSProjectQuota {
+		t.Errorf("Expected XFSProjectQuota to be set for params: %+v", params)
+	}
+	params[AttributeXFSProjectQuota] = "invalid"
+	if _, err = ParseStorageClassParams(ctx, params, false); err == nil {
+		t.Errorf("error expected but not received for params: %+v", params)
+	}
+
+	xfsVolCaps := []*csi.VolumeCapability{
+		{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{FsType: "xfs"}},
+		},
+	}
+	if err := ValidateXFSProjectQuotaRequest(xfsVolCaps); err != nil {
+		t.Errorf("unexpected error for xfs volume capabilities: %v", err)
+	}
+	for _, volCap := range []*csi.VolumeCapability{
+		{AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{FsType: "ext4"}}},
+		{AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}}},
+		{AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}}},
+	} {
+		if err := ValidateXFSProjectQuotaRequest([]*csi.VolumeCapability{volCap}); err == nil {
+			t.Errorf("error expected but not received for volume capability: %+v", volCap)
+		}
+	}
+}
+
+func TestGetVolumeSizeFromCapacityRange(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name          string
+		capacityRange *csi.CapacityRange
+		sizeBytes     int64
+		sizeMB        int64
+		code          codes.Code
+	}{
+		{"missing", nil, 0, 0, codes.InvalidArgument},
+		{"zero", &csi.CapacityRange{}, 0, 0, codes.InvalidArgument},
+		{"required", &csi.CapacityRange{RequiredBytes: GbInBytes}, GbInBytes, 1024, codes.OK},
+		{"required rounded up", &csi.CapacityRange{RequiredBytes: MbInBytes + 1}, MbInBytes + 1, 2, codes.OK},
+		{"limit only", &csi.CapacityRange{LimitBytes: 2*MbInBytes + 1}, 2 * MbInBytes, 2, codes.OK},
+		{"limit below minimum", &csi.CapacityRange{LimitBytes: MbInBytes - 1}, 0, 0, codes.OutOfRange},
+		{"rounding exceeds limit", &csi.CapacityRange{RequiredBytes: MbInBytes + 1, LimitBytes: MbInBytes + 2},
+			0, 0, codes.OutOfRange},
+		{"required above limit", &csi.CapacityRange{RequiredBytes: 2 * MbInBytes, LimitBytes: MbInBytes},
+			0, 0, codes.InvalidArgument},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sizeBytes, sizeMB, err := GetVolumeSizeFromCapacityRange(ctx, test.capacityRange)
+			if status.Code(err) != test.code {
+				t.Fatalf("expected code %v, got error %v", test.code, err)
+			}
+			if sizeBytes != test.sizeBytes || sizeMB != test.sizeMB {
+				t.Errorf("expected size %d bytes and %d MB, got %d bytes and %d MB", test.sizeBytes,
+					test.sizeMB, sizeBytes, sizeMB)
+			}
+		})
+	}
+}
@@ -18,14 +18,21 @@ package common
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/davecgh/go-spew/spew"
 	cnstypes "github.com/vmware/govmomi/cns/types"
 	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
 	"github.com/vmware/govmomi/vim25/mo"
 	vim25types "github.com/vmware/govmomi/vim25/types"
 	vsanfstypes "github.com/vmware/govmomi/vsan/vsanfs/types"
@@ -59,6 +66,13 @@ type CreateBlockVolumeOptions struct {
 	UseSupervisorId,
 	IsVdppOnStretchedSvFssEnabled bool
 	IsByokEnabled bool
+	// AllowCrossPolicyRestore allows restoring a snapshot when the datastore of
+	// the snapshot is not compatible with the storage policy of the new volume,
+	// or not among the datastores selected for the new volume, as long as it is
+	// shared by all the nodes of the requested topology. The volume is then
+	// restored on the datastore of the snapshot without the storage policy, and
+	// must be relocated by the caller.
+	AllowCrossPolicyRestore bool
 }
 
 // CreateBlockVolumeUtil is the helper function to create CNS block volume.
@@ -211,6 +225,21 @@ func CreateBlockVolumeUtil(
 			return nil, fault, err
 		}
 	}
+	if spec.AntiAffinityGroup != "" && spec.ContentSourceSnapshotID == "" {
+		datastoreInfoList = filterDatastoresByAntiAffinity(ctx, vc, spec, datastoreInfoList)
+		datastores = getDatastoreMoRefs(datastoreInfoList)
+	}
+	if placementStrategy := getPlacementStrategy(spec.ScParams); placementStrategy != "" &&
+		spec.ContentSourceSnapshotID == "" && len(datastoreInfoList) > 1 {
+		selected, err := selectDatastoreByPlacementStrategy(ctx, vc, placementStrategy, spec.StoragePolicyID,
+			spec.CapacityMB, datastoreInfoList)
+		if err != nil {
+			return nil, csifault.CSIInternalFault, err
+		}
+		if selected != nil {
+			datastores = []vim25types.ManagedObjectReference{selected.Reference()}
+		}
+	}
 
 	var containerClusterArray []cnstypes.CnsContainerCluster
 	clusterID := manager.CnsConfig.Global.ClusterID
@@ -235,6 +264,13 @@ func CreateBlockVolumeUtil(
 			ContainerClusterArray: containerClusterArray,
 		},
 	}
+	if len(spec.GuestDiskHints) > 0 && spec.PVCName != "" {
+		// The PV does not exist yet; the syncer adds its reference along with
+		// the labels of the PVC once the PV is bound.
+		createSpec.Metadata.EntityMetadata = append(createSpec.Metadata.EntityMetadata,
+			vsphere.GetCnsKubernetesEntityMetaData(spec.PVCName, spec.GuestDiskHints, false,
+				string(cnstypes.CnsKubernetesEntityTypePVC), spec.PVCNamespace, clusterID, nil))
+	}
 	if spec.StoragePolicyID != "" {
 		profileSpec := &vim25types.VirtualMachineDefinedProfileSpec{
 			ProfileId: spec.StoragePolicyID,
@@ -300,6 +336,37 @@ func CreateBlockVolumeUtil(
 				break
 			}
 		}
+		if opts.AllowCrossPolicyRestore {
+			restoreWithoutProfile := false
+			if !foundCompatibleDatastore {
+				// The volume can only be restored on the datastore of the snapshot
+				// if it is accessible from all the nodes of the requested topology.
+				snapshotDatastore := findDatastoreInfoByURL(sharedDatastores, cnsVolume.DatastoreUrl)
+				if snapshotDatastore != nil {
+					compatibleDatastore = snapshotDatastore.Datastore.Reference()
+					foundCompatibleDatastore = true
+					restoreWithoutProfile = true
+				} else {
+					log.Infof("Datastore %q of snapshot %s is not shared by all the nodes of the requested "+
+						"topology", cnsVolume.DatastoreUrl, spec.ContentSourceSnapshotID)
+				}
+			} else if spec.StoragePolicyID != "" {
+				compat, err := vc.PbmCheckCompatibility(ctx,
+					[]vim25types.ManagedObjectReference{compatibleDatastore}, spec.StoragePolicyID)
+				if err != nil {
+					return nil, csifault.CSIInternalFault, logger.LogNewErrorf(log,
+						"failed to find datastore compatibility with storage policy ID %q. Error: %+v",
+						spec.StoragePolicyID, err)
+				}
+				restoreWithoutProfile = len(compat.CompatibleDatastores()) == 0
+			}
+			if restoreWithoutProfile {
+				log.Infof("Datastore %q of snapshot %s is not a compatible datastore for the new volume, "+
+					"restoring the volume without storage policy ID %q", cnsVolume.DatastoreUrl,
+					spec.ContentSourceSnapshotID, spec.StoragePolicyID)
+				createSpec.Profile = nil
+			}
+		}
 		if !foundCompatibleDatastore {
 			return nil, csifault.CSIInternalFault, logger.LogNewErrorf(log,
 				"failed to get the compatible datastore for create volume from snapshot %s with error: %+v",
@@ -348,6 +415,355 @@ func CreateBlockVolumeUtil(
 	return volumeInfo, "", nil
 }
 
+// findDatastoreInfoByURL returns the datastore with the given URL among the
+// given datastores, or nil if there is none.
+func findDatastoreInfoByURL(datastores []*vsphere.DatastoreInfo, dsURL string) *vsphere.DatastoreInfo {
+	for _, dsInfo := range datastores {
+		if dsInfo.Info.Url == dsURL {
+			return dsInfo
+		}
+	}
+	return nil
+}
+
+// SelectDatastoreForBlockVolumeUtil runs the datastore selection of
+// CreateBlockVolumeUtil for a dry run of CreateVolume, without creating the
+// volume on CNS. It returns the storage policy compatible datastore with the
+// most free space among the given shared datastores, or codes.ResourceExhausted
+// if none of them has enough free space for the requested capacity.
+func SelectDatastoreForBlockVolumeUtil(ctx context.Context, manager *Manager, spec *CreateVolumeSpec,
+	sharedDatastores []*vsphere.DatastoreInfo, opts CreateBlockVolumeOptions) (
+	*vsphere.DatastoreInfo, string, error) {
+	log := logger.GetLogger(ctx)
+	vc, err := GetVCenter(ctx, manager)
+	if err != nil {
+		log.Errorf("failed to get vCenter from Manager, err: %+v", err)
+		return nil, csifault.CSIInternalFault, err
+	}
+	if spec.ScParams.StoragePolicyName != "" {
+		spec.StoragePolicyID, err = vc.GetStoragePolicyIDByName(ctx, spec.ScParams.StoragePolicyName)
+		if err != nil {
+			return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+				"failed to get storage policy ID for storage policy name %q. Error: %+v",
+				spec.ScParams.StoragePolicyName, err)
+		}
+	}
+	if opts.FilterSuspendedDatastores {
+		sharedDatastores, err = vsphere.FilterSuspendedDatastores(ctx, sharedDatastores)
+		if err != nil {
+			log.Errorf("Error occurred while filter suspended datastores, err: %+v", err)
+			return nil, csifault.CSIInternalFault, err
+		}
+	}
+
+	// Restrict the candidates to the datastore given in the StorageClass, or to
+	// the datastore of the source snapshot.
+	requiredDatastoreURL := strings.TrimSpace(spec.ScParams.DatastoreURL)
+	if spec.ContentSourceSnapshotID != "" {
+		cnsVolumeID, _, err := ParseCSISnapshotID(spec.ContentSourceSnapshotID)
+		if err != nil {
+			return nil, csifault.CSIInvalidArgumentFault, err
+		}
+		querySelection := cnstypes.CnsQuerySelection{
+			Names: []string{string(cnstypes.QuerySelectionNameTypeDataStoreUrl)},
+		}
+		cnsVolume, err := QueryVolumeByID(ctx, manager.VolumeManager, cnsVolumeID, &querySelection)
+		if err != nil {
+			return nil, csifault.CSIInternalFault, logger.LogNewErrorf(log,
+				"failed to query datastore for the snapshot %s with error %+v",
+				spec.ContentSourceSnapshotID, err)
+		}
+		requiredDatastoreURL = cnsVolume.DatastoreUrl
+	}
+	candidates := sharedDatastores
+	if requiredDatastoreURL != "" {
+		candidates = nil
+		for _, ds := range sharedDatastores {
+			if strings.TrimSpace(ds.Info.Url) == requiredDatastoreURL {
+				candidates = append(candidates, ds)
+			}
+		}
+		if len(candidates) == 0 {
+			return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+				"datastore %q is not accessible to all nodes", requiredDatastoreURL)
+		}
+	}
+
+	if spec.StoragePolicyID != "" {
+		compat, err := vc.PbmCheckCompatibility(ctx, getDatastoreMoRefs(candidates), spec.StoragePolicyID)
+		if err != nil {
+			return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to find datastore compatibility with storage policy ID %q. Error: %+v",
+				spec.StoragePolicyID, err)
+		}
+		compatibleDsMoids := make(map[string]struct{})
+		for _, ds := range compat.CompatibleDatastores() {
+			compatibleDsMoids[ds.HubId] = struct{}{}
+		}
+		var compatibleDatastores []*vsphere.DatastoreInfo
+		for _, ds := range candidates {
+			if _, exists := compatibleDsMoids[ds.Reference().Value]; exists {
+				compatibleDatastores = append(compatibleDatastores, ds)
+			}
+		}
+		if len(compatibleDatastores) == 0 {
+			return nil, csifault.CSIInvalidStoragePolicyConfigurationFault, logger.LogNewErrorCodef(log,
+				codes.InvalidArgument, "none of compatible datastores for given storage policy ID %q, is in the "+
+					"list of shared datastore accessible to all nodes", spec.StoragePolicyID)
+		}
+		candidates = compatibleDatastores
+	}
+
+	var selected *vsphere.DatastoreInfo
+	for _, ds := range candidates {
+		if selected == nil || ds.Info.FreeSpace > selected.Info.FreeSpace {
+			selected = ds
+		}
+	}
+	if selected.Info.FreeSpace < spec.CapacityMB*MbInBytes {
+		return nil, csifault.CSIResourceExhaustedFault, logger.LogNewErrorCodef(log, codes.ResourceExhausted,
+			"none of the candidate datastores has %d MB free space for volume %q, the largest free space "+
+				"is %d MB on datastore %q", spec.CapacityMB, spec.Name, selected.Info.FreeSpace/MbInBytes,
+			selected.Info.Url)
+	}
+	log.Infof("Volume %q of %d MB can be placed on datastore %q with %d MB free space",
+		spec.Name, spec.CapacityMB, selected.Info.Url, selected.Info.FreeSpace/MbInBytes)
+	return selected, "", nil
+}
+
+// placementStrategies are the supported strategies to pick the datastore of
+// a volume among several compatible datastores.
+var placementStrategies = []string{PlacementStrategyCapacityWeighted, PlacementStrategyAbsoluteFree,
+	PlacementStrategyPercentFree, PlacementStrategyRoundRobin}
+
+var (
+	// defaultPlacementStrategy is the placement strategy of the storage classes
+	// which do not set one. If empty, the datastore is chosen by CNS.
+	defaultPlacementStrategy string
+	// defaultPlacementStrategyLock is used to serialize access to
+	// defaultPlacementStrategy.
+	defaultPlacementStrategyLock sync.RWMutex
+	// roundRobinPlacementCounter is the number of volumes placed using the
+	// round-robin placement strategy.
+	roundRobinPlacementCounter atomic.Uint64
+)
+
+// ParsePlacementStrategy validates the given placement strategy and returns it
+// in lower case.
+func ParsePlacementStrategy(value string) (string, error) {
+	placementStrategy := strings.ToLower(strings.TrimSpace(value))
+	if !slices.Contains(placementStrategies, placementStrategy) {
+		return "", fmt.Errorf("unsupported placement strategy %q, supported values are %q",
+			value, placementStrategies)
+	}
+	return placementStrategy, nil
+}
+
+// SetDefaultPlacementStrategy sets the placement strategy of the storage
+// classes which do not set the placementstrategy parameter. An empty strategy
+// leaves the choice of datastore to CNS.
+func SetDefaultPlacementStrategy(ctx context.Context, value string) {
+	log := logger.GetLogger(ctx)
+	placementStrategy := ""
+	if value != "" {
+		var err error
+		placementStrategy, err = ParsePlacementStrategy(value)
+		if err != nil {
+			log.Errorf("ignoring the default placement strategy. Err: %v", err)
+		}
+	}
+	defaultPlacementStrategyLock.Lock()
+	defer defaultPlacementStrategyLock.Unlock()
+	defaultPlacementStrategy = placementStrategy
+	log.Infof("Default datastore placement strategy set to %q", defaultPlacementStrategy)
+}
+
+// getPlacementStrategy returns the placement strategy of the storage class,
+// or the default one if the storage class does not set one.
+func getPlacementStrategy(scParams *StorageClassParams) string {
+	if scParams != nil && scParams.PlacementStrategy != "" {
+		return scParams.PlacementStrategy
+	}
+	defaultPlacementStrategyLock.RLock()
+	defer defaultPlacementStrategyLock.RUnlock()
+	return defaultPlacementStrategy
+}
+
+// selectDatastoreByPlacementStrategy picks one of the given datastores which
+// is compatible with the storage policy and has enough free space for the
+// volume, using the given placement strategy. It returns nil if the free space
+// of the datastores is not known, in which case the choice of datastore is
+// left to CNS.
+func selectDatastoreByPlacementStrategy(ctx context.Context, vc *vsphere.VirtualCenter,
+	placementStrategy string, storagePolicyID string, capacityMB int64,
+	datastores []*vsphere.DatastoreInfo) (*vsphere.DatastoreInfo, error) {
+	log := logger.GetLogger(ctx)
+	candidates := datastores
+	if storagePolicyID != "" {
+		var err error
+		candidates, err = FilterDatastoresByStoragePolicy(ctx, vc, datastores, storagePolicyID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var selected *vsphere.DatastoreInfo
+	switch placementStrategy {
+	case PlacementStrategyAbsoluteFree:
+		selected = pickDatastoreByAbsoluteFreeSpace(candidates, capacityMB)
+	case PlacementStrategyPercentFree:
+		capacities, err := getDatastoreCapacities(ctx, vc, candidates)
+		if err != nil {
+			return nil, err
+		}
+		selected = pickDatastoreByPercentFreeSpace(candidates, capacities, capacityMB)
+	case PlacementStrategyRoundRobin:
+		selected = pickDatastoreRoundRobin(candidates, capacityMB)
+	default:
+		selected = pickDatastoreByFreeSpace(candidates, capacityMB)
+	}
+	if selected == nil {
+		log.Infof("None of the datastores compatible with storage policy ID %q reports %d MB free space, "+
+			"falling back to the default placement", storagePolicyID, capacityMB)
+		return nil, nil
+	}
+	log.Infof("Selected datastore %q with %d MB free space for %s placement of %d MB volume",
+		selected.Info.Url, selected.Info.FreeSpace/MbInBytes, placementStrategy, capacityMB)
+	return selected, nil
+}
+
+// FilterDatastoresByStoragePolicy returns the datastores from the given list
+// which are compatible with the storage policy.
+func FilterDatastoresByStoragePolicy(ctx context.Context, vc *vsphere.VirtualCenter,
+	datastores []*vsphere.DatastoreInfo, storagePolicyID string) ([]*vsphere.DatastoreInfo, error) {
+	log := logger.GetLogger(ctx)
+	compat, err := vc.PbmCheckCompatibility(ctx, getDatastoreMoRefs(datastores), storagePolicyID)
+	if err != nil {
+		return nil, logger.LogNewErrorf(log,
+			"failed to find datastore compatibility with storage policy ID %q. Error: %+v",
+			storagePolicyID, err)
+	}
+	compatibleDsMoids := make(map[string]struct{})
+	for _, ds := range compat.CompatibleDatastores() {
+		compatibleDsMoids[ds.HubId] = struct{}{}
+	}
+	var compatibleDatastores []*vsphere.DatastoreInfo
+	for _, ds := range datastores {
+		if _, exists := compatibleDsMoids[ds.Reference().Value]; exists {
+			compatibleDatastores = append(compatibleDatastores, ds)
+		}
+	}
+	return compatibleDatastores, nil
+}
+
+// getDatastoreCapacities returns the capacity in bytes of the given
+// datastores, keyed by their managed object ID.
+func getDatastoreCapacities(ctx context.Context, vc *vsphere.VirtualCenter,
+	datastores []*vsphere.DatastoreInfo) (map[string]int64, error) {
+	log := logger.GetLogger(ctx)
+	capacities := make(map[string]int64)
+	if len(datastores) == 0 {
+		return capacities, nil
+	}
+	var dsMoList []mo.Datastore
+	pc := property.DefaultCollector(vc.Client.Client)
+	err := pc.Retrieve(ctx, getDatastoreMoRefs(datastores), []string{"summary"}, &dsMoList)
+	if err != nil {
+		return nil, logger.LogNewErrorf(log, "failed to get the capacity of datastores. Error: %+v", err)
+	}
+	for _, dsMo := range dsMoList {
+		capacities[dsMo.Reference().Value] = dsMo.Summary.Capacity
+	}
+	return capacities, nil
+}
+
+// hasFreeSpaceForVolume returns true if the free space of the datastore is
+// known and enough for a volume of capacityMB.
+func hasFreeSpaceForVolume(ds *vsphere.DatastoreInfo, capacityMB int64) bool {
+	return ds.Info != nil && ds.Info.FreeSpace > 0 && ds.Info.FreeSpace >= capacityMB*MbInBytes
+}
+
+// pickDatastoreByAbsoluteFreeSpace picks the datastore with the most free
+// space. It returns nil if none of the datastores has enough free space.
+func pickDatastoreByAbsoluteFreeSpace(datastores []*vsphere.DatastoreInfo,
+	capacityMB int64) *vsphere.DatastoreInfo {
+	var selected *vsphere.DatastoreInfo
+	for _, ds := range datastores {
+		if hasFreeSpaceForVolume(ds, capacityMB) &&
+			(selected == nil || ds.Info.FreeSpace > selected.Info.FreeSpace) {
+			selected = ds
+		}
+	}
+	return selected
+}
+
+// pickDatastoreByPercentFreeSpace picks the datastore with the highest ratio
+// of free space to capacity, given the capacities keyed by the managed object
+// ID of the datastores. It returns nil if none of the datastores has enough
+// free space.
+func pickDatastoreByPercentFreeSpace(datastores []*vsphere.DatastoreInfo, capacities map[string]int64,
+	capacityMB int64) *vsphere.DatastoreInfo {
+	var selected *vsphere.DatastoreInfo
+	var selectedRatio float64
+	for _, ds := range datastores {
+		capacity := capacities[ds.Reference().Value]
+		if !hasFreeSpaceForVolume(ds, capacityMB) || capacity <= 0 {
+			continue
+		}
+		ratio := float64(ds.Info.FreeSpace) / float64(capacity)
+		if selected == nil || ratio > selectedRatio {
+			selected = ds
+			selectedRatio = ratio
+		}
+	}
+	return selected
+}
+
+// pickDatastoreRoundRobin picks the datastores with enough free space in turn,
+// ordered by URL. It returns nil if none of the datastores has enough free
+// space.
+func pickDatastoreRoundRobin(datastores []*vsphere.DatastoreInfo, capacityMB int64) *vsphere.DatastoreInfo {
+	var candidates []*vsphere.DatastoreInfo
+	for _, ds := range datastores {
+		if hasFreeSpaceForVolume(ds, capacityMB) {
+			candidates = append(candidates, ds)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	slices.SortFunc(candidates, func(a, b *vsphere.DatastoreInfo) int {
+		return strings.Compare(a.Info.Url, b.Info.Url)
+	})
+	next := roundRobinPlacementCounter.Add(1) - 1
+	return candidates[next%uint64(len(candidates))]
+}
+
+// pickDatastoreByFreeSpace picks one of the datastores with at least
+// capacityMB free space at random, weighted by its free space. It returns nil
+// if none of the datastores has enough free space.
+func pickDatastoreByFreeSpace(datastores []*vsphere.DatastoreInfo, capacityMB int64) *vsphere.DatastoreInfo {
+	var candidates []*vsphere.DatastoreInfo
+	var totalFreeSpace int64
+	for _, ds := range datastores {
+		if !hasFreeSpaceForVolume(ds, capacityMB) {
+			continue
+		}
+		candidates = append(candidates, ds)
+		totalFreeSpace += ds.Info.FreeSpace
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	pick := rand.Int63n(totalFreeSpace)
+	for _, ds := range candidates {
+		if pick < ds.Info.FreeSpace {
+			return ds
+		}
+		pick -= ds.Info.FreeSpace
+	}
+	return candidates[len(candidates)-1]
+}
+
 // CreateBlockVolumeUtilForMultiVC is the helper function to create CNS block volume when multi-VC FSS is enabled.
 func CreateBlockVolumeUtilForMultiVC(ctx context.Context, reqParams interface{}) (
 	*cnsvolume.CnsVolumeInfo, string, error) {
@@ -400,6 +816,17 @@ func CreateBlockVolumeUtilForMultiVC(ctx context.Context, reqParams interface{})
 	for _, ds := range params.SharedDatastores {
 		datastores = append(datastores, ds.Reference())
 	}
+	if placementStrategy := getPlacementStrategy(params.Spec.ScParams); placementStrategy != "" &&
+		params.Spec.ContentSourceSnapshotID == "" && len(params.SharedDatastores) > 1 {
+		selected, err := selectDatastoreByPlacementStrategy(ctx, params.Vcenter, placementStrategy,
+			params.StoragePolicyID, params.Spec.CapacityMB, params.SharedDatastores)
+		if err != nil {
+			return nil, csifault.CSIInternalFault, err
+		}
+		if selected != nil {
+			datastores = []vim25types.ManagedObjectReference{selected.Reference()}
+		}
+	}
 
 	var containerClusterArray []cnstypes.CnsContainerCluster
 	clusterID := params.CNSConfig.Global.ClusterID
@@ -639,6 +1066,122 @@ func AttachVolumeUtil(ctx context.Context, volumeManager cnsvolume.Manager,
 	return diskUUID, "", err
 }
 
+// maxSCSIBusNumber and maxSCSIUnitNumber are the highest bus and unit numbers
+// of the SCSI controllers of a VM.
+const (
+	maxSCSIBusNumber  = 3
+	maxSCSIUnitNumber = 63
+)
+
+// ParseSCSISlot parses the SCSI controller slot given as
+// "<bus number>:<unit number>".
+func ParseSCSISlot(slot string) (int32, int32, error) {
+	busStr, unitStr, found := strings.Cut(slot, ":")
+	if !found {
+		return 0, 0, fmt.Errorf("SCSI slot %q is not of the form <bus number>:<unit number>", slot)
+	}
+	bus, err := strconv.ParseInt(strings.TrimSpace(busStr), 10, 32)
+	if err != nil || bus < 0 || bus > maxSCSIBusNumber {
+		return 0, 0, fmt.Errorf("invalid bus number %q in SCSI slot %q, must be between 0 and %d",
+			busStr, slot, maxSCSIBusNumber)
+	}
+	unit, err := strconv.ParseInt(strings.TrimSpace(unitStr), 10, 32)
+	if err != nil || unit < 0 || unit > maxSCSIUnitNumber {
+		return 0, 0, fmt.Errorf("invalid unit number %q in SCSI slot %q, must be between 0 and %d",
+			unitStr, slot, maxSCSIUnitNumber)
+	}
+	return int32(bus), int32(unit), nil
+}
+
+// FormatSCSISlot formats the SCSI controller slot as "<bus number>:<unit number>".
+func FormatSCSISlot(bus int32, unit int32) string {
+	return fmt.Sprintf("%d:%d", bus, unit)
+}
+
+// ValidateMultiWriterDisk returns an error if a virtual disk of the given
+// provisioning type on a datastore of the given type cannot be shared by
+// multiple VMs in multi-writer mode. Multi-writer disks are supported on vSAN
+// and vVol datastores, and on VMFS datastores if they are eager zeroed thick.
+func ValidateMultiWriterDisk(datastoreType string, provisioningType string) error {
+	switch datastoreType {
+	case string(vim25types.HostFileSystemVolumeFileSystemTypeVsan),
+		string(vim25types.HostFileSystemVolumeFileSystemTypeVVOL):
+		return nil
+	case string(vim25types.HostFileSystemVolumeFileSystemTypeVMFS):
+		if provisioningType != string(vim25types.BaseConfigInfoDiskFileBackingInfoProvisioningTypeEagerZeroedThick) {
+			return fmt.Errorf("%s disks on VMFS datastores must be %s, got %q, set the %q StorageClass "+
+				"param to %q", vim25types.VirtualDiskSharingSharingMultiWriter,
+				vim25types.BaseConfigInfoDiskFileBackingInfoProvisioningTypeEagerZeroedThick, provisioningType,
+				AttributeDiskFormat, DiskFormatEagerZeroedThick)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%s disks are not supported on %s datastores",
+			vim25types.VirtualDiskSharingSharingMultiWriter, datastoreType)
+	}
+}
+
+// AttachMultiWriterVolumeUtil attaches the block volume to the vm in
+// multi-writer sharing mode, so that it can be attached to multiple VMs
+// concurrently. The volume is attached to the given SCSI controller slot if
+// it is available, or if unit is negative, to the first available slot.
+// codes.FailedPrecondition is returned if the disk of the volume does not
+// support multi-writer mode.
+func AttachMultiWriterVolumeUtil(ctx context.Context, volumeManager cnsvolume.Manager,
+	vm *vsphere.VirtualMachine, volumeID string, bus int32, unit int32) (string, string, error) {
+	log := logger.GetLogger(ctx)
+	diskUUID, err := cnsvolume.IsDiskAttached(ctx, vm, volumeID, false)
+	if err != nil {
+		return "", csifault.CSIInternalFault, err
+	}
+	if diskUUID != "" {
+		log.Infof("Volume %q is already attached to vm %q", volumeID, vm.String())
+		return diskUUID, "", nil
+	}
+	vStorageObject, err := volumeManager.RetrieveVStorageObject(ctx, volumeID)
+	if err != nil {
+		return "", csifault.CSIInternalFault, err
+	}
+	backing, ok := vStorageObject.Config.Backing.(*vim25types.BaseConfigInfoDiskFileBackingInfo)
+	if !ok {
+		return "", csifault.CSIInternalFault, fmt.Errorf("failed to retrieve backing info of volume %q", volumeID)
+	}
+	datastore := &vsphere.Datastore{
+		Datastore:  object.NewDatastore(vm.Client(), backing.Datastore),
+		Datacenter: vm.Datacenter,
+	}
+	_, datastoreType, err := datastore.GetDatastoreURLAndType(ctx)
+	if err != nil {
+		return "", csifault.CSIInternalFault, err
+	}
+	if err := ValidateMultiWriterDisk(datastoreType, backing.ProvisioningType); err != nil {
+		return "", csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.FailedPrecondition,
+			"volume %q cannot be attached in multi-writer mode. Error: %v", volumeID, err)
+	}
+	// The disk is not attached through CNS, as the CNS attach spec has no
+	// sharing mode. It is attached by reconfiguring the VM through the volume
+	// manager, which audits it, and the callers apply the attach limits. Mark
+	// the volume so that it is detached the same way.
+	err = volumeManager.UpdateVStorageObjectMetadata(ctx, volumeID,
+		[]vim25types.KeyValue{{Key: MultiWriterMetadataKey, Value: "true"}})
+	if err != nil {
+		return "", csifault.CSIInternalFault, fmt.Errorf("failed to mark volume %q as a multi-writer volume. "+
+			"Error: %v", volumeID, err)
+	}
+	if err := volumeManager.AttachMultiWriterDisk(ctx, vm, volumeID, backing.FilePath, datastore, bus, unit); err != nil {
+		return "", csifault.CSIInternalFault, err
+	}
+	diskUUID, err = cnsvolume.IsDiskAttached(ctx, vm, volumeID, false)
+	if err != nil {
+		return "", csifault.CSIInternalFault, err
+	}
+	if diskUUID == "" {
+		return "", csifault.CSIInternalFault, fmt.Errorf("volume is not attached to vm %q after the attach "+
+			"completed", vm.String())
+	}
+	return diskUUID, "", nil
+}
+
 // DetachVolumeUtil is the helper function to detach CNS volume from specified
 // vm.
 func DetachVolumeUtil(ctx context.Context, volumeManager cnsvolume.Manager,
@@ -672,6 +1215,32 @@ func DeleteVolumeUtil(ctx context.Context, volManager cnsvolume.Manager, volumeI
 	return "", nil
 }
 
+// GetVolumeRetainUntil returns the time until which the block volume is
+// retention locked, as recorded in its FCD metadata, or the zero time if the
+// volume is not locked. Volumes whose disk is gone, and volumes of a vCenter
+// which does not serve the vslm endpoint, on which no lock can be recorded,
+// are not locked. Callers must consider the volume locked on any error.
+func GetVolumeRetainUntil(ctx context.Context, volManager cnsvolume.Manager, volumeID string) (time.Time, error) {
+	metadata, err := volManager.RetrieveVStorageObjectMetadata(ctx, volumeID, RetainUntilMetadataKey)
+	if err != nil {
+		if vsphere.IsNotFoundError(err) || errors.Is(err, vsphere.ErrNotSupported) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	for _, kv := range metadata {
+		if kv.Key != RetainUntilMetadataKey {
+			continue
+		}
+		retainUntil, err := time.Parse(time.RFC3339, kv.Value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid retention time %q recorded for volume %q", kv.Value, volumeID)
+		}
+		return retainUntil, nil
+	}
+	return time.Time{}, nil
+}
+
 // ExpandVolumeUtil is the helper function to extend CNS volume for given
 // volumeId.
 func ExpandVolumeUtil(ctx context.Context, vCenterManager vsphere.VirtualCenterManager,
@@ -850,9 +1419,9 @@ func QueryAllVolumeSnapshots(ctx context.Context, volManager cnsvolume.Manager,
 	}
 	if token != "" {
 		offset, err = strconv.ParseInt(token, 10, 64)
-		if err != nil {
-			log.Errorf("failed to parse the token: %s err: %v", token, err)
-			return nil, "", err
+		if err != nil || offset < 0 {
+			return nil, "", logger.LogNewErrorCodef(log, codes.Aborted,
+				"ListSnapshots StartingToken: %s cannot be parsed", token)
 		}
 	}
 	queryFilter := cnstypes.CnsSnapshotQueryFilter{
@@ -866,6 +1435,13 @@ func QueryAllVolumeSnapshots(ctx context.Context, volManager cnsvolume.Manager,
 		log.Errorf("failed to retrieve all the volume snapshots in inventory err: %+v", err)
 		return nil, "", err
 	}
+	// Tokens are only returned while snapshots remain, so a token at or beyond
+	// the end of the snapshots can not be resumed from, e.g. as snapshots were
+	// deleted since it was returned.
+	if offset > 0 && len(queryResultEntries) == 0 {
+		return nil, "", logger.LogNewErrorCodef(log, codes.Aborted,
+			"ListSnapshots StartingToken: %d is out of range of the snapshots", offset)
+	}
 	//populate list of volume-ids to retrieve the volume size.
 	var volumeIds []cnstypes.CnsVolumeId
 	for _, queryResult := range queryResultEntries {
@@ -1087,6 +1663,45 @@ func CreateSnapshotUtil(ctx context.Context, volumeManager cnsvolume.Manager, vo
 	return csiSnapshotID, cnsSnapshotInfo, nil
 }
 
+// QueryVolumeSnapshotByName returns the CNS snapshot of the given volume created for the given CSI snapshot
+// name, or nil if there is none. As the volume manager derives the description of the CNS snapshot from the CSI
+// CreateSnapshotRequest Name and the volume ID, this finds a snapshot created by an earlier CreateSnapshot call
+// whose response was lost.
+func QueryVolumeSnapshotByName(ctx context.Context, volumeManager cnsvolume.Manager, volumeID string,
+	snapshotName string) (*cnstypes.CnsSnapshot, error) {
+	log := logger.GetLogger(ctx)
+	description := cnsvolume.GetCnsSnapshotDescription(snapshotName, volumeID)
+	querySpec := cnstypes.CnsSnapshotQuerySpec{
+		VolumeId: cnstypes.CnsVolumeId{
+			Id: volumeID,
+		},
+	}
+	queryFilter := cnstypes.CnsSnapshotQueryFilter{
+		SnapshotQuerySpecs: []cnstypes.CnsSnapshotQuerySpec{querySpec},
+		Cursor: &cnstypes.CnsCursor{
+			Offset: 0,
+			Limit:  QuerySnapshotLimit,
+		},
+	}
+	queryResultEntries, _, err := utils.QuerySnapshotsUtil(ctx, volumeManager, queryFilter, QuerySnapshotLimit)
+	if err != nil {
+		return nil, logger.LogNewErrorf(log, "failed to query snapshots of volume %q with error %+v",
+			volumeID, err)
+	}
+	for _, queryResult := range queryResultEntries {
+		if queryResult.Error != nil {
+			continue
+		}
+		if queryResult.Snapshot.Description == description {
+			log.Infof("Found snapshot %q with description %q on volume %q",
+				queryResult.Snapshot.SnapshotId.Id, description, volumeID)
+			snapshot := queryResult.Snapshot
+			return &snapshot, nil
+		}
+	}
+	return nil, nil
+}
+
 // DeleteSnapshotUtil is the helper function to delete CNS snapshot for given snapshotId
 func DeleteSnapshotUtil(ctx context.Context, volumeManager cnsvolume.Manager, csiSnapshotID string,
 	extraParams interface{}) (*cnsvolume.CnsSnapshotInfo, error) {
@@ -1099,6 +1714,9 @@ func DeleteSnapshotUtil(ctx context.Context, volumeManager cnsvolume.Manager, cs
 
 	log.Debugf("vSphere CSI driver is deleting snapshot %q on volume: %q", cnsSnapshotID, cnsVolumeID)
 	cnsSnapshotInfo, err := volumeManager.DeleteSnapshot(ctx, cnsVolumeID, cnsSnapshotID, extraParams)
+	if errors.Is(err, cnsvolume.ErrSnapshotVolumeNotFound) {
+		return nil, err
+	}
 	if err != nil {
 		return nil, logger.LogNewErrorf(log, "failed to delete snapshot %q on volume %q with error %+v",
 			cnsSnapshotID, cnsVolumeID, err)
@@ -1136,6 +1754,30 @@ func GetCnsVolumeType(ctx context.Context, volumeManager cnsvolume.Manager, volu
 	return volumeType, nil
 }
 
+// IsDatastoreSharedAcrossHosts returns true if the datastore with the given
+// URL is mounted on more than one host.
+func IsDatastoreSharedAcrossHosts(ctx context.Context, vc *vsphere.VirtualCenter, dsURL string) (bool, error) {
+	log := logger.GetLogger(ctx)
+	dsInfoObjList, err := getDatastoreInfoObjList(ctx, vc, dsURL)
+	if err != nil {
+		return false, logger.LogNewErrorf(log, "failed to retrieve datastore object using datastore "+
+			"URL %q. Error: %+v", dsURL, err)
+	}
+	hosts := make(map[vim25types.ManagedObjectReference]struct{})
+	for _, dsInfoObj := range dsInfoObjList {
+		var ds mo.Datastore
+		err = dsInfoObj.Properties(ctx, dsInfoObj.Reference(), []string{"host"}, &ds)
+		if err != nil {
+			return false, logger.LogNewErrorf(log, "failed to get host mounts from datastore %q. Error: %+v",
+				dsURL, err)
+		}
+		for _, host := range ds.Host {
+			hosts[host.Key] = struct{}{}
+		}
+	}
+	return len(hosts) > 1, nil
+}
+
 // GetNodeVMsWithAccessToDatastore finds out NodeVMs which have access to the given
 // datastore URL by using the moref approach.
 func GetNodeVMsWithAccessToDatastore(ctx context.Context, vc *vsphere.VirtualCenter, dsURL string,
@@ -1294,3 +1936,110 @@ func createCryptoSpec(oldKeyID, newKeyID *vim25types.CryptoKeyId) vim25types.Bas
 
 	return &vim25types.CryptoSpecShallowRecrypt{NewKeyId: *newKeyID}
 }
+
+// DiskFormatToProvisioningType maps the values of the diskformat StorageClass
+// param to the provisioning type of the virtual disk backing the volume.
+var DiskFormatToProvisioningType = map[string]vim25types.BaseConfigInfoDiskFileBackingInfoProvisioningType{
+	DiskFormatThin:             vim25types.BaseConfigInfoDiskFileBackingInfoProvisioningTypeThin,
+	DiskFormatThick:            vim25types.BaseConfigInfoDiskFileBackingInfoProvisioningTypeLazyZeroedThick,
+	DiskFormatEagerZeroedThick: vim25types.BaseConfigInfoDiskFileBackingInfoProvisioningTypeEagerZeroedThick,
+}
+
+// ValidateDiskFormatForDatastore returns an InvalidArgument error if the disk
+// format can not be honored on the datastore of the given type. The space
+// reservation of vSAN and vVol datastores is governed by the storage policy, so
+// only thin disks can be requested on them.
+func ValidateDiskFormatForDatastore(ctx context.Context, diskFormat string,
+	datastore *vsphere.DatastoreInfo) (string, error) {
+	log := logger.GetLogger(ctx)
+	if diskFormat == DiskFormatThin {
+		return "", nil
+	}
+	_, datastoreType, err := datastore.GetDatastoreURLAndType(ctx)
+	if err != nil {
+		return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to get type of datastore %q. Error: %+v", datastore.Info.Url, err)
+	}
+	if strings.EqualFold(datastoreType, VsanDatastoreType) || strings.EqualFold(datastoreType, "VVOL") {
+		return csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q with value %q is not supported on datastore %q of type %s, the provisioning type "+
+				"of volumes on this datastore is governed by the storage policy",
+			AttributeDiskFormat, diskFormat, datastore.Info.Url, datastoreType)
+	}
+	return "", nil
+}
+
+// CreateBlockVolumeWithDiskFormatUtil creates the virtual disk backing the
+// block volume with the provisioning type of spec.ScParams.DiskFormat and
+// registers it with CNS, as CNS does not accept a provisioning type on create.
+func CreateBlockVolumeWithDiskFormatUtil(ctx context.Context, clusterFlavor cnstypes.CnsClusterFlavor,
+	manager *Manager, spec *CreateVolumeSpec, sharedDatastores []*vsphere.DatastoreInfo,
+	opts CreateBlockVolumeOptions) (*cnsvolume.CnsVolumeInfo, string, error) {
+	log := logger.GetLogger(ctx)
+	vc, err := GetVCenter(ctx, manager)
+	if err != nil {
+		log.Errorf("failed to get vCenter from Manager, err: %+v", err)
+		return nil, csifault.CSIInternalFault, err
+	}
+	datastore, faultType, err := SelectDatastoreForBlockVolumeUtil(ctx, manager, spec, sharedDatastores, opts)
+	if err != nil {
+		return nil, faultType, err
+	}
+	faultType, err = ValidateDiskFormatForDatastore(ctx, spec.ScParams.DiskFormat, datastore)
+	if err != nil {
+		return nil, faultType, err
+	}
+	keepAfterDeleteVm := true
+	createSpec := vim25types.VslmCreateSpec{
+		Name:              spec.Name,
+		KeepAfterDeleteVm: &keepAfterDeleteVm,
+		CapacityInMB:      spec.CapacityMB,
+		BackingSpec: &vim25types.VslmCreateSpecDiskFileBackingSpec{
+			VslmCreateSpecBackingSpec: vim25types.VslmCreateSpecBackingSpec{
+				Datastore: datastore.Reference(),
+			},
+			ProvisioningType: string(DiskFormatToProvisioningType[spec.ScParams.DiskFormat]),
+		},
+	}
+	if spec.StoragePolicyID != "" {
+		createSpec.Profile = []vim25types.BaseVirtualMachineProfileSpec{
+			&vim25types.VirtualMachineDefinedProfileSpec{ProfileId: spec.StoragePolicyID},
+		}
+	}
+	log.Infof("Creating disk %q of %d MB with disk format %q on datastore %q", spec.Name, spec.CapacityMB,
+		spec.ScParams.DiskFormat, datastore.Info.Url)
+	diskID, err := manager.VolumeManager.CreateVStorageObject(ctx, createSpec)
+	if err != nil {
+		return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to create disk %q with disk format %q. Error: %+v", spec.Name, spec.ScParams.DiskFormat, err)
+	}
+
+	// Register the disk with CNS.
+	containerCluster := vsphere.GetContainerCluster(manager.CnsConfig.Global.ClusterID,
+		manager.CnsConfig.VirtualCenter[vc.Config.Host].User, clusterFlavor,
+		manager.CnsConfig.Global.ClusterDistribution)
+	cnsCreateSpec := &cnstypes.CnsVolumeCreateSpec{
+		Name:       spec.Name,
+		VolumeType: BlockVolumeType,
+		Metadata: cnstypes.CnsVolumeMetadata{
+			ContainerCluster:      containerCluster,
+			ContainerClusterArray: []cnstypes.CnsContainerCluster{containerCluster},
+		},
+		BackingObjectDetails: &cnstypes.CnsBlockBackingDetails{
+			BackingDiskId: diskID,
+		},
+	}
+	volumeInfo, faultType, err := manager.VolumeManager.CreateVolume(ctx, cnsCreateSpec, nil)
+	if err != nil {
+		// Delete the disk, so that it does not leak if the volume is never
+		// requested again.
+		if deleteErr := manager.VolumeManager.DeleteVStorageObject(ctx, diskID); deleteErr != nil {
+			log.Errorf("failed to delete disk %q which failed to be registered with CNS. Error: %+v",
+				diskID, deleteErr)
+		}
+		return nil, faultType, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to register disk %q with CNS. Error: %+v", diskID, err)
+	}
+	volumeInfo.DatastoreURL = datastore.Info.Url
+	return volumeInfo, "", nil
+}
@@ -2,13 +2,20 @@ package common
 
 import (
 	"context"
+	"errors"
+	"reflect"
 	"testing"
 
 	"github.com/agiledragon/gomonkey/v2"
 	"github.com/stretchr/testify/assert"
 	cnstypes "github.com/vmware/govmomi/cns/types"
+	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/vim25/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	cnsvolume "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/volume"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/vsphere"
+	cnsconfig "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/config"
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/utils"
 )
 
@@ -151,3 +158,314 @@ func TestQueryAllVolumeSnapshotsWithQuerySnapshotsUnexpectedFault(t *testing.T)
 	_, _, err := QueryAllVolumeSnapshots(context.TODO(), nil, "", 100)
 	assert.Error(t, err)
 }
+
+func TestQueryAllVolumeSnapshotsWithInvalidToken(t *testing.T) {
+	patches := gomonkey.ApplyFunc(utils.QuerySnapshotsUtil, func(_ context.Context, _ cnsvolume.Manager,
+		filter cnstypes.CnsSnapshotQueryFilter, _ int64) ([]cnstypes.CnsSnapshotQueryResultEntry, string, error) {
+		// The inventory has 3 snapshots.
+		var entries []cnstypes.CnsSnapshotQueryResultEntry
+		for i := filter.Cursor.Offset; i < 3; i++ {
+			entries = append(entries, cnstypes.CnsSnapshotQueryResultEntry{})
+		}
+		return entries, "", nil
+	})
+	defer patches.Reset()
+	patches.ApplyFunc(utils.QueryVolumeDetailsUtil, func(_ context.Context, _ cnsvolume.Manager,
+		_ []cnstypes.CnsVolumeId) (
+		map[string]*utils.CnsVolumeDetails, error) {
+		return map[string]*utils.CnsVolumeDetails{"": {}}, nil
+	})
+	for _, token := range []string{"abc", "-1", "3", "5"} {
+		_, _, err := QueryAllVolumeSnapshots(context.TODO(), nil, token, 100)
+		assert.Equal(t, codes.Aborted, status.Code(err), "token %q", token)
+	}
+	snapshots, _, err := QueryAllVolumeSnapshots(context.TODO(), nil, "1", 100)
+	assert.NoError(t, err)
+	assert.Len(t, snapshots, 2)
+}
+
+func TestPickDatastoreByFreeSpace(t *testing.T) {
+	newDatastore := func(url string, freeSpaceMB int64) *vsphere.DatastoreInfo {
+		return &vsphere.DatastoreInfo{Info: &types.DatastoreInfo{Url: url, FreeSpace: freeSpaceMB * MbInBytes}}
+	}
+	// Datastores without enough free space are never picked.
+	datastores := []*vsphere.DatastoreInfo{newDatastore("ds-1", 10), newDatastore("ds-2", 1000)}
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, "ds-2", pickDatastoreByFreeSpace(datastores, 100).Info.Url)
+	}
+	// Every datastore with enough free space is eventually picked.
+	datastores = append(datastores, newDatastore("ds-3", 1000))
+	picked := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		picked[pickDatastoreByFreeSpace(datastores, 1).Info.Url] = true
+	}
+	assert.Len(t, picked, 3)
+	// Unknown free space falls back to the default placement.
+	assert.Nil(t, pickDatastoreByFreeSpace([]*vsphere.DatastoreInfo{newDatastore("ds-1", 0)}, 1))
+}
+
+func TestParseSCSISlot(t *testing.T) {
+	bus, unit, err := ParseSCSISlot("1:3")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), bus)
+	assert.Equal(t, int32(3), unit)
+	assert.Equal(t, "1:3", FormatSCSISlot(bus, unit))
+
+	for _, slot := range []string{"", "1", "a:3", "1:b", "4:0", "0:64", "-1:2"} {
+		_, _, err := ParseSCSISlot(slot)
+		assert.Error(t, err, "expected an error for SCSI slot %q", slot)
+	}
+}
+
+func TestPlacementStrategies(t *testing.T) {
+	newDatastore := func(moid string, freeSpaceMB int64) *vsphere.DatastoreInfo {
+		return &vsphere.DatastoreInfo{
+			Datastore: &vsphere.Datastore{Datastore: object.NewDatastore(nil,
+				types.ManagedObjectReference{Type: "Datastore", Value: moid})},
+			Info: &types.DatastoreInfo{Url: "ds:///" + moid, FreeSpace: freeSpaceMB * MbInBytes},
+		}
+	}
+	// A large datastore with the most free space, and a small one with the
+	// highest ratio of free space to capacity.
+	datastores := []*vsphere.DatastoreInfo{newDatastore("ds-1", 4000), newDatastore("ds-2", 900),
+		newDatastore("ds-3", 10)}
+	capacities := map[string]int64{"ds-1": 10000 * MbInBytes, "ds-2": 1000 * MbInBytes, "ds-3": 10 * MbInBytes}
+
+	assert.Equal(t, "ds-1", pickDatastoreByAbsoluteFreeSpace(datastores, 100).Reference().Value)
+	// ds-3 has the highest ratio but not enough free space.
+	assert.Equal(t, "ds-2", pickDatastoreByPercentFreeSpace(datastores, capacities, 100).Reference().Value)
+	assert.Nil(t, pickDatastoreByAbsoluteFreeSpace(datastores, 5000))
+	assert.Nil(t, pickDatastoreByPercentFreeSpace(datastores, capacities, 5000))
+
+	picked := make(map[string]int)
+	for i := 0; i < 10; i++ {
+		picked[pickDatastoreRoundRobin(datastores, 100).Reference().Value]++
+	}
+	assert.Equal(t, map[string]int{"ds-1": 5, "ds-2": 5}, picked)
+
+	strategy, err := ParsePlacementStrategy("Percent-Free")
+	assert.NoError(t, err)
+	assert.Equal(t, PlacementStrategyPercentFree, strategy)
+	_, err = ParsePlacementStrategy("fullest-first")
+	assert.Error(t, err)
+
+	SetDefaultPlacementStrategy(context.TODO(), PlacementStrategyRoundRobin)
+	defer SetDefaultPlacementStrategy(context.TODO(), "")
+	assert.Equal(t, PlacementStrategyRoundRobin, getPlacementStrategy(&StorageClassParams{}))
+	assert.Equal(t, PlacementStrategyAbsoluteFree,
+		getPlacementStrategy(&StorageClassParams{PlacementStrategy: PlacementStrategyAbsoluteFree}))
+}
+
+func TestFilterDatastoresByAntiAffinity(t *testing.T) {
+	ctx := context.TODO()
+	newDatastore := func(url string) *vsphere.DatastoreInfo {
+		return &vsphere.DatastoreInfo{Info: &types.DatastoreInfo{Url: url}}
+	}
+	getURLs := func(datastores []*vsphere.DatastoreInfo) []string {
+		var urls []string
+		for _, ds := range datastores {
+			urls = append(urls, ds.Info.Url)
+		}
+		return urls
+	}
+	datastores := []*vsphere.DatastoreInfo{newDatastore("ds-1"), newDatastore("ds-2"), newDatastore("ds-3")}
+	spec := &CreateVolumeSpec{Name: "replica-2", AntiAffinityGroup: "ns-1/db"}
+
+	// No volume of the group is placed yet.
+	assert.Equal(t, []string{"ds-1", "ds-2", "ds-3"}, getURLs(filterDatastoresByAntiAffinity(ctx, nil, spec,
+		datastores)))
+
+	spec.AntiAffinityDatastoreURLs = []string{"ds-1"}
+	assert.Equal(t, []string{"ds-2", "ds-3"}, getURLs(filterDatastoresByAntiAffinity(ctx, nil, spec,
+		datastores)))
+
+	// All the datastores are candidates again if none is free of the group.
+	spec.AntiAffinityDatastoreURLs = []string{"ds-1", " ds-2 "}
+	assert.Equal(t, []string{"ds-3"}, getURLs(filterDatastoresByAntiAffinity(ctx, nil, spec, datastores)))
+	assert.Equal(t, []string{"ds-1", "ds-2"}, getURLs(filterDatastoresByAntiAffinity(ctx, nil, spec,
+		datastores[:2])))
+}
+
+// diskFormatVolumeManager records the disks created and deleted through the
+// Vslm endpoint, and fails the registration of the disks with CNS if
+// registerErr is set.
+type diskFormatVolumeManager struct {
+	cnsvolume.Manager
+	createSpecs  []types.VslmCreateSpec
+	deletedDisks []string
+	registerErr  error
+}
+
+func (m *diskFormatVolumeManager) CreateVStorageObject(_ context.Context,
+	spec types.VslmCreateSpec) (string, error) {
+	m.createSpecs = append(m.createSpecs, spec)
+	return "disk-1", nil
+}
+
+func (m *diskFormatVolumeManager) CreateVolume(_ context.Context, spec *cnstypes.CnsVolumeCreateSpec,
+	_ interface{}) (*cnsvolume.CnsVolumeInfo, string, error) {
+	if m.registerErr != nil {
+		return nil, "", m.registerErr
+	}
+	backing := spec.BackingObjectDetails.(*cnstypes.CnsBlockBackingDetails)
+	return &cnsvolume.CnsVolumeInfo{VolumeID: cnstypes.CnsVolumeId{Id: backing.BackingDiskId}}, "", nil
+}
+
+func (m *diskFormatVolumeManager) DeleteVStorageObject(_ context.Context, volumeID string) error {
+	m.deletedDisks = append(m.deletedDisks, volumeID)
+	return nil
+}
+
+// patchDatastoreTypes makes GetDatastoreURLAndType return the type of the
+// datastore with the given moref value, or an error for unknown datastores.
+func patchDatastoreTypes(datastoreTypes map[string]string) *gomonkey.Patches {
+	return gomonkey.ApplyMethod(reflect.TypeOf(&vsphere.Datastore{}), "GetDatastoreURLAndType",
+		func(ds *vsphere.Datastore, _ context.Context) (string, string, error) {
+			datastoreType, ok := datastoreTypes[ds.Reference().Value]
+			if !ok {
+				return "", "", errors.New("datastore not found")
+			}
+			return "ds:///" + ds.Reference().Value, datastoreType, nil
+		})
+}
+
+func newTypedDatastore(moref string) *vsphere.DatastoreInfo {
+	return &vsphere.DatastoreInfo{
+		Datastore: &vsphere.Datastore{
+			Datastore: object.NewDatastore(nil, types.ManagedObjectReference{Type: "Datastore", Value: moref}),
+		},
+		Info: &types.DatastoreInfo{Url: "ds:///" + moref},
+	}
+}
+
+func TestValidateDiskFormatForDatastore(t *testing.T) {
+	patches := patchDatastoreTypes(map[string]string{
+		"vsan-ds": VsanDatastoreType,
+		"vvol-ds": "VVOL",
+		"vmfs-ds": "VMFS",
+	})
+	defer patches.Reset()
+
+	tests := []struct {
+		name       string
+		diskFormat string
+		datastore  string
+		code       codes.Code
+	}{
+		{name: "thin on vSAN", diskFormat: DiskFormatThin, datastore: "vsan-ds", code: codes.OK},
+		{name: "thin with unknown type", diskFormat: DiskFormatThin, datastore: "unknown-ds", code: codes.OK},
+		{name: "thick on VMFS", diskFormat: DiskFormatThick, datastore: "vmfs-ds", code: codes.OK},
+		{name: "eagerzeroedthick on VMFS", diskFormat: DiskFormatEagerZeroedThick, datastore: "vmfs-ds",
+			code: codes.OK},
+		{name: "thick on vSAN", diskFormat: DiskFormatThick, datastore: "vsan-ds", code: codes.InvalidArgument},
+		{name: "eagerzeroedthick on vVol", diskFormat: DiskFormatEagerZeroedThick, datastore: "vvol-ds",
+			code: codes.InvalidArgument},
+		{name: "thick with unknown type", diskFormat: DiskFormatThick, datastore: "unknown-ds",
+			code: codes.Internal},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			faultType, err := ValidateDiskFormatForDatastore(context.TODO(), test.diskFormat,
+				newTypedDatastore(test.datastore))
+			assert.Equal(t, test.code, status.Code(err))
+			if test.code == codes.OK {
+				assert.Empty(t, faultType)
+			} else {
+				assert.NotEmpty(t, faultType)
+			}
+		})
+	}
+}
+
+func TestCreateBlockVolumeWithDiskFormatUtil(t *testing.T) {
+	patches := patchDatastoreTypes(map[string]string{
+		"vsan-ds": VsanDatastoreType,
+		"vmfs-ds": "VMFS",
+	})
+	defer patches.Reset()
+	vc := &vsphere.VirtualCenter{Config: &vsphere.VirtualCenterConfig{Host: "vc-1"}}
+	patches.ApplyFunc(GetVCenter, func(_ context.Context, _ *Manager) (*vsphere.VirtualCenter, error) {
+		return vc, nil
+	})
+	var selectedDatastore *vsphere.DatastoreInfo
+	patches.ApplyFunc(SelectDatastoreForBlockVolumeUtil, func(_ context.Context, _ *Manager,
+		_ *CreateVolumeSpec, _ []*vsphere.DatastoreInfo, _ CreateBlockVolumeOptions) (
+		*vsphere.DatastoreInfo, string, error) {
+		return selectedDatastore, "", nil
+	})
+
+	tests := []struct {
+		name             string
+		diskFormat       string
+		datastore        string
+		registerErr      error
+		code             codes.Code
+		provisioningType types.BaseConfigInfoDiskFileBackingInfoProvisioningType
+		deletedDisks     []string
+	}{
+		{
+			name:             "thick on VMFS",
+			diskFormat:       DiskFormatThick,
+			datastore:        "vmfs-ds",
+			code:             codes.OK,
+			provisioningType: types.BaseConfigInfoDiskFileBackingInfoProvisioningTypeLazyZeroedThick,
+		},
+		{
+			name:             "eagerzeroedthick on VMFS",
+			diskFormat:       DiskFormatEagerZeroedThick,
+			datastore:        "vmfs-ds",
+			code:             codes.OK,
+			provisioningType: types.BaseConfigInfoDiskFileBackingInfoProvisioningTypeEagerZeroedThick,
+		},
+		{
+			name:       "thick on vSAN",
+			diskFormat: DiskFormatThick,
+			datastore:  "vsan-ds",
+			code:       codes.InvalidArgument,
+		},
+		{
+			name:             "registration failure",
+			diskFormat:       DiskFormatThick,
+			datastore:        "vmfs-ds",
+			registerErr:      errors.New("registration failed"),
+			code:             codes.Internal,
+			provisioningType: types.BaseConfigInfoDiskFileBackingInfoProvisioningTypeLazyZeroedThick,
+			deletedDisks:     []string{"disk-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			volumeManager := &diskFormatVolumeManager{registerErr: test.registerErr}
+			manager := &Manager{
+				VolumeManager: volumeManager,
+				CnsConfig: &cnsconfig.Config{
+					VirtualCenter: map[string]*cnsconfig.VirtualCenterConfig{"vc-1": {User: "user"}},
+				},
+			}
+			selectedDatastore = newTypedDatastore(test.datastore)
+			spec := &CreateVolumeSpec{
+				Name:       "pvc-1",
+				CapacityMB: 1024,
+				ScParams:   &StorageClassParams{DiskFormat: test.diskFormat},
+			}
+			volumeInfo, _, err := CreateBlockVolumeWithDiskFormatUtil(context.TODO(),
+				cnstypes.CnsClusterFlavorVanilla, manager, spec, nil, CreateBlockVolumeOptions{})
+			assert.Equal(t, test.code, status.Code(err))
+			assert.Equal(t, test.deletedDisks, volumeManager.deletedDisks)
+			if test.provisioningType == "" {
+				// The disk format is rejected before any disk is created.
+				assert.Empty(t, volumeManager.createSpecs)
+				return
+			}
+			if assert.Len(t, volumeManager.createSpecs, 1) {
+				backing := volumeManager.createSpecs[0].BackingSpec.(*types.VslmCreateSpecDiskFileBackingSpec)
+				assert.Equal(t, string(test.provisioningType), backing.ProvisioningType)
+				assert.Equal(t, test.datastore, backing.Datastore.Value)
+			}
+			if test.code == codes.OK {
+				assert.Equal(t, "disk-1", volumeInfo.VolumeID.Id)
+				assert.Equal(t, "ds:///"+test.datastore, volumeInfo.DatastoreURL)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/types"
+	k8s "sigs.k8s.io/vsphere-csi-driver/v3/pkg/kubernetes"
+)
+
+const (
+	// envCSINodeRepairIntervalSeconds is the name of the env variable which
+	// sets the interval in seconds between two checks of the registration of
+	// the driver in the CSINode object of the node. 0 disables the checks.
+	envCSINodeRepairIntervalSeconds = "CSINODE_REPAIR_INTERVAL_SECONDS"
+	// defaultCSINodeRepairInterval is the default interval between two checks
+	// of the registration of the driver in the CSINode object.
+	defaultCSINodeRepairInterval = 2 * time.Minute
+	// envKubeletRegistrationDir is the name of the env variable which sets the
+	// directory watched by kubelet for the registration sockets of plugins.
+	envKubeletRegistrationDir = "KUBELET_REGISTRATION_DIR"
+	// defaultKubeletRegistrationDir is the default directory watched by
+	// kubelet for the registration sockets of plugins.
+	defaultKubeletRegistrationDir = "/var/lib/kubelet/plugins_registry"
+)
+
+// repairCSINodeRegistration starts a background loop which verifies that the
+// driver is registered in the CSINode object of the node, as kubelet may drop
+// the registration when it restarts concurrently with the node plugin. When
+// the driver is missing from the CSINode object in two consecutive checks,
+// kubelet is made to register the driver again. The loop stops when the
+// driver shuts down.
+func (driver *vsphereCSIDriver) repairCSINodeRegistration(ctx context.Context) {
+	log := logger.GetLogger(ctx)
+	if !pluginRegistrationRetriggerSupported {
+		log.Infof("Repair of the CSINode registration is not supported on this OS")
+		return
+	}
+	interval := getCSINodeRepairInterval(ctx)
+	if interval == 0 {
+		log.Infof("Repair of the CSINode registration is disabled")
+		return
+	}
+	nodeName := os.Getenv("NODE_NAME")
+	if nodeName == "" {
+		log.Warnf("Repair of the CSINode registration is disabled as ENV NODE_NAME is not set")
+		return
+	}
+	registrationDir := os.Getenv(envKubeletRegistrationDir)
+	if registrationDir == "" {
+		registrationDir = defaultKubeletRegistrationDir
+	}
+	socketPath := filepath.Join(registrationDir, csitypes.Name+"-reg.sock")
+	go func() {
+		k8sClient, err := k8s.NewClient(ctx)
+		if err != nil {
+			log.Errorf("Repair of the CSINode registration is disabled. Failed to create k8s client. Err: %v", err)
+			return
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		missing := false
+		for {
+			select {
+			case <-driver.shutdownCh:
+				return
+			case <-ticker.C:
+				missing = checkCSINodeRegistration(ctx, k8sClient, nodeName, socketPath, missing)
+			}
+		}
+	}()
+}
+
+// checkCSINodeRegistration checks that the driver is registered in the
+// CSINode object of the node and returns true if it is missing. If it was
+// already missing in the previous check, kubelet is made to register the
+// driver again.
+func checkCSINodeRegistration(ctx context.Context, k8sClient clientset.Interface, nodeName string,
+	socketPath string, wasMissing bool) bool {
+	log := logger.GetLogger(ctx)
+	csiNode, err := k8sClient.StorageV1().CSINodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Warnf("failed to get CSINode %q to check the registration of the driver. Err: %v", nodeName, err)
+		return wasMissing
+	}
+	if err == nil {
+		for _, csiDriver := range csiNode.Spec.Drivers {
+			if csiDriver.Name == csitypes.Name {
+				return false
+			}
+		}
+	}
+	if !wasMissing {
+		// The driver may be in the middle of being registered, e.g. after the
+		// node-driver-registrar restarted. Wait for the next check.
+		log.Infof("Driver %q is not registered in CSINode %q, checking again later", csitypes.Name, nodeName)
+		return true
+	}
+	if err := retriggerPluginRegistration(ctx, socketPath); err != nil {
+		log.Warnf("Driver %q is not registered in CSINode %q and could not be registered again. Err: %v",
+			csitypes.Name, nodeName, err)
+		return true
+	}
+	log.Infof("Driver %q was not registered in CSINode %q, made kubelet register it again",
+		csitypes.Name, nodeName)
+	return true
+}
+
+// getCSINodeRepairInterval returns the interval between two checks of the
+// registration of the driver in the CSINode object, as set by the
+// CSINODE_REPAIR_INTERVAL_SECONDS env variable.
+func getCSINodeRepairInterval(ctx context.Context) time.Duration {
+	log := logger.GetLogger(ctx)
+	if v := os.Getenv(envCSINodeRepairIntervalSeconds); v != "" {
+		if value, err := strconv.Atoi(v); err == nil && value >= 0 {
+			return time.Duration(value) * time.Second
+		}
+		log.Warnf("Invalid value %q for %s, using the default CSINode repair interval of %v",
+			v, envCSINodeRepairIntervalSeconds, defaultCSINodeRepairInterval)
+	}
+	return defaultCSINodeRepairInterval
+}
@@ -0,0 +1,68 @@
+//go:build linux
+// +build linux
+
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+)
+
+const (
+	// pluginRegistrationRetriggerSupported is true as kubelet's plugin
+	// watcher on Linux sees the rename of the registration socket.
+	pluginRegistrationRetriggerSupported = true
+	// registrationSocketDialTimeout bounds the time to check that the
+	// node-driver-registrar serves its registration socket.
+	registrationSocketDialTimeout = 5 * time.Second
+)
+
+// retriggerPluginRegistration makes kubelet register the driver again using
+// the registration socket served by the node-driver-registrar sidecar. The
+// sidecar owns the socket, so the registration is left to the sidecar while
+// it is not serving the socket, e.g. when it is restarting. Otherwise the
+// socket is renamed away and back, which kubelet's plugin watcher sees as
+// the plugin being removed and created again, without disturbing the sidecar
+// which keeps serving the socket.
+func retriggerPluginRegistration(ctx context.Context, socketPath string) error {
+	log := logger.GetLogger(ctx)
+	dialer := net.Dialer{Timeout: registrationSocketDialTimeout}
+	conn, err := dialer.DialContext(ctx, "unix", socketPath)
+	if err != nil {
+		return logger.LogNewErrorf(log, "registration socket %q is not served by the node-driver-registrar. "+
+			"Err: %v", socketPath, err)
+	}
+	_ = conn.Close()
+	tmpPath := filepath.Join(filepath.Dir(socketPath), "."+strconv.FormatInt(time.Now().UnixNano(), 10)+
+		"-"+filepath.Base(socketPath))
+	if err := os.Rename(socketPath, tmpPath); err != nil {
+		return logger.LogNewErrorf(log, "failed to rename registration socket %q. Err: %v", socketPath, err)
+	}
+	if err := os.Rename(tmpPath, socketPath); err != nil {
+		return logger.LogNewErrorf(log, "failed to restore registration socket %q from %q. Err: %v",
+			socketPath, tmpPath, err)
+	}
+	return nil
+}
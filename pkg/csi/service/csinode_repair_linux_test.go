@@ -0,0 +1,71 @@
+//go:build linux
+// +build linux
+
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRetriggerPluginRegistration(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	socketPath := filepath.Join(dir, "csi.vsphere.vmware.com-reg.sock")
+
+	// The node-driver-registrar is not serving the socket.
+	if err := retriggerPluginRegistration(ctx, socketPath); err == nil {
+		t.Errorf("expected an error for a registration socket which is not served")
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+	if err := retriggerPluginRegistration(ctx, socketPath); err != nil {
+		t.Fatalf("failed to retrigger the plugin registration: %v", err)
+	}
+
+	// The socket is back in place and still served, without leftovers.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != filepath.Base(socketPath) {
+		t.Errorf("expected only the registration socket in %s, got %v", dir, entries)
+	}
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatalf("expected the registration socket to still be served: %v", err)
+	}
+	_ = conn.Close()
+}
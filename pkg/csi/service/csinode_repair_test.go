@@ -0,0 +1,85 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	csitypes "sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/types"
+)
+
+func TestCheckCSINodeRegistration(t *testing.T) {
+	ctx := context.Background()
+	socketPath := filepath.Join(t.TempDir(), csitypes.Name+"-reg.sock")
+	registeredNode := &storagev1.CSINode{
+		ObjectMeta: metav1.ObjectMeta{Name: "registered-node"},
+		Spec:       storagev1.CSINodeSpec{Drivers: []storagev1.CSINodeDriver{{Name: csitypes.Name}}},
+	}
+	unregisteredNode := &storagev1.CSINode{
+		ObjectMeta: metav1.ObjectMeta{Name: "unregistered-node"},
+		Spec:       storagev1.CSINodeSpec{Drivers: []storagev1.CSINodeDriver{{Name: "other.csi.driver"}}},
+	}
+	k8sClient := k8sfake.NewSimpleClientset(registeredNode, unregisteredNode)
+
+	tests := []struct {
+		name        string
+		nodeName    string
+		wasMissing  bool
+		wantMissing bool
+	}{
+		{name: "driver registered", nodeName: "registered-node", wasMissing: true, wantMissing: false},
+		{name: "driver missing once", nodeName: "unregistered-node", wasMissing: false, wantMissing: true},
+		// The registration socket is not served, the driver remains missing.
+		{name: "driver missing twice", nodeName: "unregistered-node", wasMissing: true, wantMissing: true},
+		{name: "CSINode missing", nodeName: "new-node", wasMissing: false, wantMissing: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			missing := checkCSINodeRegistration(ctx, k8sClient, test.nodeName, socketPath, test.wasMissing)
+			if missing != test.wantMissing {
+				t.Errorf("expected missing %t, got %t", test.wantMissing, missing)
+			}
+		})
+	}
+}
+
+func TestGetCSINodeRepairInterval(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{value: "", expected: defaultCSINodeRepairInterval},
+		{value: "30", expected: 30 * time.Second},
+		{value: "0", expected: 0},
+		{value: "-1", expected: defaultCSINodeRepairInterval},
+		{value: "invalid", expected: defaultCSINodeRepairInterval},
+	}
+	for _, test := range tests {
+		t.Setenv(envCSINodeRepairIntervalSeconds, test.value)
+		if interval := getCSINodeRepairInterval(ctx); interval != test.expected {
+			t.Errorf("expected interval %v for %q, got %v", test.expected, test.value, interval)
+		}
+	}
+}
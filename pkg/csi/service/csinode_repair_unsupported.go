@@ -0,0 +1,38 @@
+//go:build !linux
+// +build !linux
+
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+)
+
+// pluginRegistrationRetriggerSupported is false as the registration socket
+// can only be renamed under a running node-driver-registrar on Linux. On
+// Windows, the socket cannot be renamed while it is open.
+const pluginRegistrationRetriggerSupported = false
+
+// retriggerPluginRegistration is not supported on this OS.
+func retriggerPluginRegistration(ctx context.Context, socketPath string) error {
+	log := logger.GetLogger(ctx)
+	return logger.LogNewErrorf(log, "re-registration of the driver using socket %q is not supported on this OS",
+		socketPath)
+}
@@ -19,13 +19,17 @@ package service
 import (
 	"context"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/google/uuid"
 	cnstypes "github.com/vmware/govmomi/cns/types"
 
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/node"
+	cnsvolume "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/volume"
 	cnsconfig "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/config"
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common/commonco"
@@ -42,6 +46,28 @@ const (
 
 	// UnixSocketPrefix is the prefix before the path on disk.
 	UnixSocketPrefix = "unix://"
+
+	// envShutdownGracePeriodSeconds is the name of the env variable which sets
+	// the time in seconds to wait for in-flight requests on driver shutdown.
+	envShutdownGracePeriodSeconds = "SHUTDOWN_GRACE_PERIOD_SECONDS"
+
+	// defaultShutdownGracePeriod is the default time to wait for in-flight
+	// requests on driver shutdown. It fits in the default termination grace
+	// period of a pod.
+	defaultShutdownGracePeriod = 25 * time.Second
+
+	// envVolumeStatsCacheTTLSeconds is the env variable to set how long the
+	// node plugin reuses the stats computed for a volume. 0 disables caching.
+	envVolumeStatsCacheTTLSeconds = "VOLUME_STATS_CACHE_TTL_SECONDS"
+
+	// defaultVolumeStatsCacheTTL is the default time for which volume stats
+	// are reused by NodeGetVolumeStats.
+	defaultVolumeStatsCacheTTL = 30 * time.Second
+
+	// staleMountFailureThreshold is the number of consecutive checks in which
+	// the mount of a volume must fail with a stale mount error for the volume
+	// condition to be reported abnormal by NodeGetVolumeStats.
+	staleMountFailureThreshold = 2
 )
 
 var (
@@ -58,6 +84,7 @@ type Driver interface {
 	GetController() csi.ControllerServer
 	BeforeServe(context.Context) error
 	Run(ctx context.Context, endpoint string)
+	Shutdown(ctx context.Context)
 }
 
 type vsphereCSIDriver struct {
@@ -67,6 +94,23 @@ type vsphereCSIDriver struct {
 	// A map storing all volumes with ongoing operations so that additional operations
 	// for that same volume (as defined by VolumeID) return an Aborted error
 	volumeLocks *node.VolumeLocks
+	// volumeStatsCache stores the volume stats computed by NodeGetVolumeStats.
+	volumeStatsCache *node.VolumeStatsCache
+	// volumeHealth tracks the failed checks of the mounts of volumes by
+	// NodeGetVolumeStats.
+	volumeHealth *node.VolumeHealthTracker
+	// ephemeralVolumes provisions CSI ephemeral inline volumes. It is nil if
+	// they are not supported on the node.
+	ephemeralVolumes *ephemeralVolumes
+	// nodeTopology caches the accessible topology of the node and refreshes
+	// it when the topology labels of the node change.
+	nodeTopology *nodeTopologyWatch
+	grpcServer   NonBlockingGRPCServer
+	// shutdownCh is closed when the driver starts shutting down and
+	// shutdownDoneCh is closed once the shutdown is complete.
+	shutdownCh     chan struct{}
+	shutdownDoneCh chan struct{}
+	shutdownOnce   sync.Once
 }
 
 // If k8s node died unexpectedly in an earlier run, the unix socket is left
@@ -82,7 +126,13 @@ func init() {
 // NewDriver returns a new Driver.
 func NewDriver() Driver {
 	return &vsphereCSIDriver{
-		volumeLocks: node.NewVolumeLocks(),
+		volumeLocks:      node.NewVolumeLocks(),
+		volumeStatsCache: node.NewVolumeStatsCache(defaultVolumeStatsCacheTTL),
+		volumeHealth:     node.NewVolumeHealthTracker(staleMountFailureThreshold),
+		nodeTopology:     &nodeTopologyWatch{},
+		grpcServer:       NewNonBlockingGRPCServer(),
+		shutdownCh:       make(chan struct{}),
+		shutdownDoneCh:   make(chan struct{}),
 	}
 }
 
@@ -129,6 +179,7 @@ func (driver *vsphereCSIDriver) BeforeServe(ctx context.Context) error {
 
 	// Get the SP's operating mode.
 	driver.mode = os.Getenv(csitypes.EnvVarMode)
+	cnsvolume.SetSlowOperationThreshold(ctx, cnsvolume.GetSlowOperationThresholdFromEnv(ctx))
 	// Create OsUtils for node driver
 	driver.osUtils, err = osutils.NewOsUtils(ctx)
 	if err != nil {
@@ -137,6 +188,9 @@ func (driver *vsphereCSIDriver) BeforeServe(ctx context.Context) error {
 	}
 
 	if strings.EqualFold(driver.mode, "node") {
+		driver.volumeStatsCache = node.NewVolumeStatsCache(getVolumeStatsCacheTTL(ctx))
+		driver.initEphemeralVolumes(ctx)
+		driver.repairCSINodeRegistration(ctx)
 		return nil
 	}
 
@@ -192,6 +246,7 @@ func (driver *vsphereCSIDriver) BeforeServe(ctx context.Context) error {
 			}
 		}
 	}
+	configureRequestLimiters(ctx, cfg)
 	if err := driver.cnscs.Init(cfg, Version); err != nil {
 		log.Errorf("failed to init controller. Error: %+v", err)
 		return err
@@ -211,7 +266,91 @@ func (driver *vsphereCSIDriver) Run(ctx context.Context, endpoint string) {
 		os.Exit(1)
 	}
 
+	select {
+	case <-driver.shutdownCh:
+		log.Info("Driver is shutting down, not starting the gRPC server")
+		<-driver.shutdownDoneCh
+		return
+	default:
+	}
+
+	// Report the driver SERVING on the gRPC health service once initialized.
+	driver.monitorHealth(ctx)
+
 	//Start the nonblocking GRPC
-	grpc := NewNonBlockingGRPCServer()
-	grpc.Start(endpoint, driver, controllerServer, driver)
+	driver.grpcServer.Start(endpoint, driver, controllerServer, driver)
+
+	// The gRPC server returns as soon as a shutdown stops it from accepting
+	// new requests, wait for the in-flight requests to be drained.
+	select {
+	case <-driver.shutdownCh:
+		<-driver.shutdownDoneCh
+	default:
+	}
+}
+
+// Shutdown stops the gRPC server from accepting new requests and waits for
+// the in-flight requests, along with the CNS tasks they are waiting on, to
+// complete. Requests still in flight after the shutdown grace period are
+// cancelled, and the CNS tasks they were waiting on are logged so that they
+// can be reconciled after restart.
+func (driver *vsphereCSIDriver) Shutdown(ctx context.Context) {
+	log := logger.GetLogger(ctx)
+	driver.shutdownOnce.Do(func() {
+		defer close(driver.shutdownDoneCh)
+		close(driver.shutdownCh)
+		gracePeriod := getShutdownGracePeriod(ctx)
+		log.Infof("Shutting down the driver, waiting up to %v for in-flight requests to complete", gracePeriod)
+
+		stoppedCh := make(chan struct{})
+		go func() {
+			driver.grpcServer.GracefulStop()
+			close(stoppedCh)
+		}()
+		timer := time.NewTimer(gracePeriod)
+		defer timer.Stop()
+		select {
+		case <-stoppedCh:
+			log.Info("All in-flight requests completed")
+			return
+		case <-timer.C:
+		}
+		for vcHost, tasks := range cnsvolume.GetPendingTasks() {
+			for _, task := range tasks {
+				log.Warnf("CNS task %q on vCenter %q did not complete within the shutdown grace period of %v",
+					task.Value, vcHost, gracePeriod)
+			}
+		}
+		log.Warnf("In-flight requests did not complete within the shutdown grace period of %v, "+
+			"stopping the driver", gracePeriod)
+		driver.grpcServer.Stop()
+	})
+}
+
+// getShutdownGracePeriod returns the time to wait for in-flight requests on
+// driver shutdown, as set by the SHUTDOWN_GRACE_PERIOD_SECONDS env variable.
+func getShutdownGracePeriod(ctx context.Context) time.Duration {
+	log := logger.GetLogger(ctx)
+	if v := os.Getenv(envShutdownGracePeriodSeconds); v != "" {
+		if value, err := strconv.Atoi(v); err == nil && value >= 0 {
+			return time.Duration(value) * time.Second
+		}
+		log.Warnf("Invalid value %q for %s, using the default shutdown grace period of %v",
+			v, envShutdownGracePeriodSeconds, defaultShutdownGracePeriod)
+	}
+	return defaultShutdownGracePeriod
+}
+
+// getVolumeStatsCacheTTL returns the time for which volume stats are reused,
+// as set by the VOLUME_STATS_CACHE_TTL_SECONDS env variable.
+func getVolumeStatsCacheTTL(ctx context.Context) time.Duration {
+	log := logger.GetLogger(ctx)
+	if v := os.Getenv(envVolumeStatsCacheTTLSeconds); v != "" {
+		if value, err := strconv.Atoi(v); err == nil && value >= 0 {
+			return time.Duration(value) * time.Second
+		}
+		log.Warnf("Invalid value %q for %s, using the default volume stats cache TTL of %v",
+			v, envVolumeStatsCacheTTLSeconds, defaultVolumeStatsCacheTTL)
+	}
+	return defaultVolumeStatsCacheTTL
 }
@@ -0,0 +1,447 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	"google.golang.org/grpc/codes"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	cnsvolume "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/volume"
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/vsphere"
+	cnsconfig "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/config"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common/commonco"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/osutils"
+)
+
+const (
+	// ephemeralVolumeContextKey is set to "true" by kubelet in the volume
+	// context of CSI ephemeral inline volumes.
+	ephemeralVolumeContextKey = "csi.storage.k8s.io/ephemeral"
+	// ephemeralAttributeSize is the volume attribute in the pod spec with the
+	// requested size of an ephemeral inline volume, e.g. "10Gi".
+	ephemeralAttributeSize = "size"
+	// ephemeralAttributeStoragePolicyName is the volume attribute in the pod
+	// spec with the storage policy of an ephemeral inline volume.
+	ephemeralAttributeStoragePolicyName = "storagepolicyname"
+	// defaultEphemeralVolumeSize is the size of ephemeral inline volumes which
+	// do not request a size.
+	defaultEphemeralVolumeSize = common.GbInBytes
+	// ephemeralVolumeStateFile is the name of the file, in the state directory
+	// of an ephemeral inline volume, recording the volume.
+	ephemeralVolumeStateFile = "volume.json"
+	// ephemeralVolumeStagingDir is the name of the directory, in the state
+	// directory of an ephemeral inline volume, where the volume is mounted
+	// before it is bind mounted to the pod.
+	ephemeralVolumeStagingDir = "staging"
+)
+
+// ephemeralVolumeStateDir is the directory on the node where the state of the
+// ephemeral inline volumes is kept, so that volumes are cleaned up after a
+// restart of the node plugin.
+var ephemeralVolumeStateDir = "/var/lib/kubelet/plugins/csi.vsphere.vmware.com/ephemeral"
+
+// ephemeralVolumeState is the state of an ephemeral inline volume on the node.
+type ephemeralVolumeState struct {
+	// VolumeHandle is the volume ID generated by kubelet for the volume.
+	VolumeHandle string `json:"volumeHandle"`
+	// CnsVolumeID is the ID of the CNS volume backing the volume.
+	CnsVolumeID string `json:"cnsVolumeID"`
+	// TargetPath is the path the volume is published at.
+	TargetPath string `json:"targetPath"`
+}
+
+// ephemeralVolumes provisions the CNS volumes backing the CSI ephemeral inline
+// volumes of the pods on the node. CSI ephemeral inline volumes are opt-in:
+// they are enabled only if the vSphere config secret is mounted in the node
+// plugin, which is not the case in the default manifest.
+type ephemeralVolumes struct {
+	manager  *common.Manager
+	stateDir string
+	// nodeVM is the VM of the node, looked up on first use.
+	nodeVM     *cnsvsphere.VirtualMachine
+	nodeVMLock sync.Mutex
+}
+
+// initEphemeralVolumes enables CSI ephemeral inline volumes on the node if
+// the vSphere config is available to the node plugin, and cleans up the
+// ephemeral inline volumes orphaned while the node plugin was not running.
+func (driver *vsphereCSIDriver) initEphemeralVolumes(ctx context.Context) {
+	log := logger.GetLogger(ctx)
+	if clusterFlavor != cnstypes.CnsClusterFlavorVanilla {
+		return
+	}
+	cfg, err := cnsconfig.GetConfig(ctx)
+	if err != nil {
+		log.Infof("CSI ephemeral inline volumes are disabled as the vSphere config is not available "+
+			"on the node. Err: %v", err)
+		return
+	}
+	if cfg.Global.ClusterID == "" {
+		cmData, err := commonco.ContainerOrchestratorUtility.GetConfigMap(ctx,
+			cnsconfig.ClusterIDConfigMapName, common.GetCSINamespace())
+		if err == nil {
+			cfg.Global.ClusterID = cmData["clusterID"]
+		}
+	}
+	vc, err := cnsvsphere.GetVirtualCenterInstance(ctx, &cnsconfig.ConfigurationInfo{Cfg: cfg}, false)
+	if err != nil {
+		log.Errorf("CSI ephemeral inline volumes are disabled. Failed to get vCenter instance. Err: %v", err)
+		return
+	}
+	vcenterConfig, err := cnsvsphere.GetVirtualCenterConfig(ctx, cfg)
+	if err != nil {
+		log.Errorf("CSI ephemeral inline volumes are disabled. Failed to get vCenter config. Err: %v", err)
+		return
+	}
+	// The volumes are looked up in CNS by their name instead of being recorded
+	// in CnsVolumeOperationRequests, which the node plugin has no access to.
+	volumeManager, err := cnsvolume.GetManager(ctx, vc, nil, false, false, false,
+		cnstypes.CnsClusterFlavorVanilla)
+	if err != nil {
+		log.Errorf("CSI ephemeral inline volumes are disabled. Failed to create volume manager. Err: %v", err)
+		return
+	}
+	driver.ephemeralVolumes = &ephemeralVolumes{
+		manager: &common.Manager{
+			VcenterConfig:  vcenterConfig,
+			CnsConfig:      cfg,
+			VolumeManager:  volumeManager,
+			VcenterManager: cnsvsphere.GetVirtualCenterManager(ctx),
+		},
+		stateDir: ephemeralVolumeStateDir,
+	}
+	log.Infof("CSI ephemeral inline volumes are enabled")
+	go driver.reconcileEphemeralVolumes(ctx)
+}
+
+// isEphemeralVolumeRequest returns true if the volume context is the one of a
+// CSI ephemeral inline volume.
+func isEphemeralVolumeRequest(volumeContext map[string]string) bool {
+	return volumeContext[ephemeralVolumeContextKey] == "true"
+}
+
+// getEphemeralVolumeSizeMB returns the size in MB requested for an ephemeral
+// inline volume in the volume attributes of the pod spec.
+func getEphemeralVolumeSizeMB(volumeContext map[string]string) (int64, error) {
+	sizeBytes := defaultEphemeralVolumeSize
+	if size, ok := volumeContext[ephemeralAttributeSize]; ok {
+		quantity, err := resource.ParseQuantity(size)
+		if err != nil {
+			return 0, err
+		}
+		if quantity.Sign() <= 0 {
+			return 0, errors.New("size must be greater than 0")
+		}
+		sizeBytes = quantity.Value()
+	}
+	return common.RoundUpSize(sizeBytes, common.MbInBytes), nil
+}
+
+// getCreatedVolumeID returns the ID of the CNS volume with the given name
+// created by an earlier attempt, e.g. before a restart of the node plugin, or
+// an empty string if there is none.
+func (e *ephemeralVolumes) getCreatedVolumeID(ctx context.Context, name string) (string, error) {
+	queryFilter := cnstypes.CnsQueryFilter{
+		Names:               []string{name},
+		ContainerClusterIds: []string{e.manager.CnsConfig.Global.ClusterID},
+	}
+	queryResult, err := e.manager.VolumeManager.QueryVolume(ctx, queryFilter)
+	if err != nil {
+		return "", err
+	}
+	for _, volume := range queryResult.Volumes {
+		if volume.Name == name {
+			return volume.VolumeId.Id, nil
+		}
+	}
+	return "", nil
+}
+
+func (e *ephemeralVolumes) volumeDir(volumeHandle string) string {
+	return filepath.Join(e.stateDir, volumeHandle)
+}
+
+// loadState returns the state of the ephemeral inline volume, or nil if the
+// volume is not an ephemeral inline volume provisioned on the node.
+func (e *ephemeralVolumes) loadState(volumeHandle string) (*ephemeralVolumeState, error) {
+	data, err := os.ReadFile(filepath.Join(e.volumeDir(volumeHandle), ephemeralVolumeStateFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	state := &ephemeralVolumeState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func (e *ephemeralVolumes) saveState(state *ephemeralVolumeState) error {
+	dir := e.volumeDir(state.VolumeHandle)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, ephemeralVolumeStateFile), data, 0640)
+}
+
+// getNodeVM returns the VM of the node the node plugin runs on.
+func (e *ephemeralVolumes) getNodeVM(ctx context.Context, osUtils *osutils.OsUtils) (
+	*cnsvsphere.VirtualMachine, error) {
+	e.nodeVMLock.Lock()
+	defer e.nodeVMLock.Unlock()
+	if e.nodeVM != nil {
+		return e.nodeVM, nil
+	}
+	uuid, err := osUtils.GetSystemUUID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nodeVM, err := cnsvsphere.GetVirtualMachineByUUID(ctx, uuid, false)
+	if err != nil {
+		return nil, err
+	}
+	e.nodeVM = nodeVM
+	return nodeVM, nil
+}
+
+// publishEphemeralVolume creates the CNS volume backing a CSI ephemeral inline
+// volume, attaches it to the node VM and mounts it at the target path.
+func (driver *vsphereCSIDriver) publishEphemeralVolume(ctx context.Context,
+	req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+	log := logger.GetLogger(ctx)
+	volumeHandle := req.GetVolumeId()
+	e := driver.ephemeralVolumes
+	if e == nil {
+		return nil, logger.LogNewErrorCodef(log, codes.FailedPrecondition,
+			"NodePublishVolume failed for ephemeral volume %q: CSI ephemeral inline volumes "+
+				"require the vSphere config secret to be mounted in the node plugin", volumeHandle)
+	}
+	if req.GetTargetPath() == "" {
+		return nil, logger.LogNewErrorCodef(log, codes.FailedPrecondition,
+			"target path %q not set", req.GetTargetPath())
+	}
+	volCap := req.GetVolumeCapability()
+	if volCap == nil {
+		return nil, logger.LogNewErrorCode(log, codes.InvalidArgument,
+			"NodePublishVolume failed: volume capability not provided")
+	}
+	caps := []*csi.VolumeCapability{volCap}
+	if err := common.IsValidVolumeCapabilities(ctx, caps); err != nil || common.IsFileVolumeRequest(ctx, caps) {
+		return nil, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"NodePublishVolume failed: volume capability not supported for ephemeral volume %q", volumeHandle)
+	}
+	if acquired := driver.volumeLocks.TryAcquire(volumeHandle); !acquired {
+		return nil, logger.LogNewErrorCodef(log, codes.Aborted,
+			"NodePublishVolume failed: An operation with the given Volume ID %s already exists", volumeHandle)
+	}
+	defer driver.volumeLocks.Release(volumeHandle)
+
+	nodeVM, err := e.getNodeVM(ctx, driver.osUtils)
+	if err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to get the VM of the node. Err: %v", err)
+	}
+	state, err := e.loadState(volumeHandle)
+	if err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to read the state of ephemeral volume %q. Err: %v", volumeHandle, err)
+	}
+	if state == nil {
+		capacityMB, err := getEphemeralVolumeSizeMB(req.GetVolumeContext())
+		if err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+				"invalid %s %q for ephemeral volume %q. Err: %v", ephemeralAttributeSize,
+				req.GetVolumeContext()[ephemeralAttributeSize], volumeHandle, err)
+		}
+		name := common.GetEphemeralVolumeName(volumeHandle)
+		cnsVolumeID, err := e.getCreatedVolumeID(ctx, name)
+		if err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to get the CreateVolume details of ephemeral volume %q. Err: %v", volumeHandle, err)
+		}
+		if cnsVolumeID == "" {
+			datastores, err := nodeVM.GetAllAccessibleDatastores(ctx)
+			if err != nil {
+				return nil, logger.LogNewErrorCodef(log, codes.Internal,
+					"failed to get the datastores accessible to the node VM. Err: %v", err)
+			}
+			// Scratch space is thin provisioned, unless the storage policy
+			// governs the provisioning type of the datastore.
+			spec := &common.CreateVolumeSpec{
+				Name:       name,
+				CapacityMB: capacityMB,
+				VolumeType: common.BlockVolumeType,
+				ScParams: &common.StorageClassParams{
+					StoragePolicyName: req.GetVolumeContext()[ephemeralAttributeStoragePolicyName],
+					DiskFormat:        common.DiskFormatThin,
+				},
+			}
+			volumeInfo, _, err := common.CreateBlockVolumeWithDiskFormatUtil(ctx,
+				cnstypes.CnsClusterFlavorVanilla, e.manager, spec, datastores,
+				common.CreateBlockVolumeOptions{FilterSuspendedDatastores: true})
+			if err != nil {
+				return nil, logger.LogNewErrorCodef(log, codes.Internal,
+					"failed to create ephemeral volume %q. Err: %v", volumeHandle, err)
+			}
+			cnsVolumeID = volumeInfo.VolumeID.Id
+		}
+		state = &ephemeralVolumeState{
+			VolumeHandle: volumeHandle,
+			CnsVolumeID:  cnsVolumeID,
+			TargetPath:   req.GetTargetPath(),
+		}
+		if err := e.saveState(state); err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to save the state of ephemeral volume %q. Err: %v", volumeHandle, err)
+		}
+		log.Infof("Created CNS volume %q for ephemeral volume %q", state.CnsVolumeID, volumeHandle)
+	}
+
+	diskUUID, _, err := common.AttachVolumeUtil(ctx, e.manager.VolumeManager, nodeVM, state.CnsVolumeID, false)
+	if err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to attach ephemeral volume %q. Err: %v", volumeHandle, err)
+	}
+	publishContext := map[string]string{common.AttributeFirstClassDiskUUID: common.FormatDiskUUID(diskUUID)}
+
+	stageParams := osutils.NodeStageParams{
+		VolID:         state.CnsVolumeID,
+		StagingTarget: filepath.Join(e.volumeDir(volumeHandle), ephemeralVolumeStagingDir),
+	}
+	if _, ok := volCap.GetAccessType().(*csi.VolumeCapability_Mount); ok {
+		stageParams.FsType, stageParams.MntFlags, err = driver.osUtils.EnsureMountVol(ctx, volCap)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(stageParams.StagingTarget, 0750); err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"unable to create staging dir: %q, err: %v", stageParams.StagingTarget, err)
+		}
+	}
+	_, err = driver.osUtils.NodeStageBlockVolume(ctx, &csi.NodeStageVolumeRequest{
+		VolumeId:          state.CnsVolumeID,
+		PublishContext:    publishContext,
+		StagingTargetPath: stageParams.StagingTarget,
+		VolumeCapability:  volCap,
+	}, stageParams)
+	if err != nil {
+		return nil, err
+	}
+
+	params := osutils.NodePublishParams{
+		VolID:         state.CnsVolumeID,
+		Target:        req.GetTargetPath(),
+		StagingTarget: stageParams.StagingTarget,
+		Ro:            req.GetReadonly(),
+	}
+	var dev *osutils.Device
+	if err = driver.osUtils.VerifyVolumeAttachedAndFillParams(ctx, publishContext, &params, &dev); err != nil {
+		return nil, err
+	}
+	if _, ok := volCap.GetAccessType().(*csi.VolumeCapability_Block); ok {
+		return driver.osUtils.PublishBlockVol(ctx, req, dev, params)
+	}
+	return driver.osUtils.PublishMountVol(ctx, req, dev, params)
+}
+
+// deleteEphemeralVolume unmounts, detaches and deletes the CNS volume backing
+// the ephemeral inline volume. It is a no-op if the volume is not an
+// ephemeral inline volume provisioned on the node. The caller must hold the
+// volume lock and must have unmounted the volume from the target path.
+func (driver *vsphereCSIDriver) deleteEphemeralVolume(ctx context.Context, volumeHandle string) error {
+	log := logger.GetLogger(ctx)
+	e := driver.ephemeralVolumes
+	if e == nil {
+		return nil
+	}
+	state, err := e.loadState(volumeHandle)
+	if err != nil || state == nil {
+		return err
+	}
+	stagingTarget := filepath.Join(e.volumeDir(volumeHandle), ephemeralVolumeStagingDir)
+	if err := driver.osUtils.CleanupStagePath(ctx, stagingTarget, state.CnsVolumeID); err != nil {
+		return err
+	}
+	nodeVM, err := e.getNodeVM(ctx, driver.osUtils)
+	if err != nil {
+		return err
+	}
+	if _, err := common.DetachVolumeUtil(ctx, e.manager.VolumeManager, nodeVM, state.CnsVolumeID); err != nil {
+		return err
+	}
+	if _, err := common.DeleteVolumeUtil(ctx, e.manager.VolumeManager, state.CnsVolumeID, true); err != nil &&
+		!cnsvsphere.IsNotFoundError(err) {
+		return err
+	}
+	if err := os.RemoveAll(e.volumeDir(volumeHandle)); err != nil {
+		return err
+	}
+	log.Infof("Deleted CNS volume %q of ephemeral volume %q", state.CnsVolumeID, volumeHandle)
+	return nil
+}
+
+// reconcileEphemeralVolumes deletes the ephemeral inline volumes which are no
+// longer published, e.g. because their pod was force deleted while the node
+// plugin was not running.
+func (driver *vsphereCSIDriver) reconcileEphemeralVolumes(ctx context.Context) {
+	log := logger.GetLogger(ctx)
+	entries, err := os.ReadDir(driver.ephemeralVolumes.stateDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("failed to list the ephemeral volumes on the node. Err: %v", err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		volumeHandle := entry.Name()
+		if !entry.IsDir() || !driver.volumeLocks.TryAcquire(volumeHandle) {
+			continue
+		}
+		func() {
+			defer driver.volumeLocks.Release(volumeHandle)
+			state, err := driver.ephemeralVolumes.loadState(volumeHandle)
+			if err != nil || state == nil {
+				log.Warnf("skipping ephemeral volume %q with unreadable state. Err: %v", volumeHandle, err)
+				return
+			}
+			if published, err := driver.osUtils.IsTargetInMounts(ctx, state.TargetPath); err != nil || published {
+				return
+			}
+			log.Infof("Deleting orphaned ephemeral volume %q", volumeHandle)
+			if err := driver.deleteEphemeralVolume(ctx, volumeHandle); err != nil {
+				log.Errorf("failed to delete orphaned ephemeral volume %q. Err: %v", volumeHandle, err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+
+	cnsvolume "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/volume"
+	cnsconfig "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/config"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
+)
+
+func TestIsEphemeralVolumeRequest(t *testing.T) {
+	if !isEphemeralVolumeRequest(map[string]string{ephemeralVolumeContextKey: "true"}) {
+		t.Errorf("expected a volume context with %q set to be an ephemeral volume request",
+			ephemeralVolumeContextKey)
+	}
+	if isEphemeralVolumeRequest(map[string]string{common.AttributeStoragePolicyName: "gold"}) {
+		t.Errorf("expected a volume context without %q not to be an ephemeral volume request",
+			ephemeralVolumeContextKey)
+	}
+}
+
+func TestGetEphemeralVolumeSizeMB(t *testing.T) {
+	tests := []struct {
+		size      string
+		expected  int64
+		expectErr bool
+	}{
+		{size: "", expected: 1024},
+		{size: "10Gi", expected: 10 * 1024},
+		{size: "1500k", expected: 2},
+		{size: "0", expectErr: true},
+		{size: "-1Gi", expectErr: true},
+		{size: "ten", expectErr: true},
+	}
+	for _, test := range tests {
+		volumeContext := map[string]string{ephemeralVolumeContextKey: "true"}
+		if test.size != "" {
+			volumeContext[ephemeralAttributeSize] = test.size
+		}
+		sizeMB, err := getEphemeralVolumeSizeMB(volumeContext)
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("expected an error for size %q, got %d MB", test.size, sizeMB)
+			}
+			continue
+		}
+		if err != nil || sizeMB != test.expected {
+			t.Errorf("expected %d MB for size %q, got %d MB, err %v", test.expected, test.size, sizeMB, err)
+		}
+	}
+}
+
+func TestGetEphemeralVolumeName(t *testing.T) {
+	// The handle is the one kubelet generates for the volume "scratch" of the pod.
+	handle := common.GetEphemeralVolumeHandle("6d3b8e3a-1f2c-4c5e-9a7b-2f4e8d1c0b9a", "scratch")
+	if handle != "csi-628d95e24fd4e99583d38458d7e3ba7229541057151675062a14ccc496af45a7" {
+		t.Errorf("unexpected handle %q of the ephemeral volume", handle)
+	}
+	name := common.GetEphemeralVolumeName(handle)
+	if name != common.EphemeralVolumeNamePrefix+"628d95e24fd4e99583d38458d7e3ba7229541057151675062a14ccc496af45a7" {
+		t.Errorf("unexpected name %q of the CNS volume of ephemeral volume %q", name, handle)
+	}
+	// Full sync and the orphan volume cleanup must recognize the volume.
+	if !common.IsEphemeralVolume(&cnstypes.CnsVolume{Name: name}) {
+		t.Errorf("expected CNS volume %q to be recognized as an ephemeral volume", name)
+	}
+	if common.IsEphemeralVolume(&cnstypes.CnsVolume{Name: "pvc-1"}) {
+		t.Errorf("expected CNS volume %q not to be recognized as an ephemeral volume", "pvc-1")
+	}
+}
+
+func TestEphemeralVolumeState(t *testing.T) {
+	e := &ephemeralVolumes{stateDir: t.TempDir()}
+	state, err := e.loadState("csi-1")
+	if err != nil || state != nil {
+		t.Fatalf("expected no state for an unknown ephemeral volume, got %+v, err %v", state, err)
+	}
+	expected := &ephemeralVolumeState{VolumeHandle: "csi-1", CnsVolumeID: "vol-1", TargetPath: "/mnt/target"}
+	if err := e.saveState(expected); err != nil {
+		t.Fatal(err)
+	}
+	state, err = e.loadState("csi-1")
+	if err != nil || !reflect.DeepEqual(state, expected) {
+		t.Errorf("expected state %+v, got %+v, err %v", expected, state, err)
+	}
+}
+
+// queryVolumeManager serves QueryVolume from the given CNS volumes.
+type queryVolumeManager struct {
+	cnsvolume.Manager
+	volumes []cnstypes.CnsVolume
+	filters []cnstypes.CnsQueryFilter
+}
+
+func (m *queryVolumeManager) QueryVolume(ctx context.Context,
+	queryFilter cnstypes.CnsQueryFilter) (*cnstypes.CnsQueryResult, error) {
+	m.filters = append(m.filters, queryFilter)
+	result := &cnstypes.CnsQueryResult{}
+	for _, volume := range m.volumes {
+		if slices.Contains(queryFilter.Names, volume.Name) {
+			result.Volumes = append(result.Volumes, volume)
+		}
+	}
+	return result, nil
+}
+
+func TestGetCreatedVolumeID(t *testing.T) {
+	ctx := context.Background()
+	cfg := &cnsconfig.Config{}
+	cfg.Global.ClusterID = "cluster-1"
+	volumeManager := &queryVolumeManager{
+		volumes: []cnstypes.CnsVolume{
+			{VolumeId: cnstypes.CnsVolumeId{Id: "vol-1"}, Name: "csi-ephemeral-1"},
+		},
+	}
+	e := &ephemeralVolumes{manager: &common.Manager{CnsConfig: cfg, VolumeManager: volumeManager}}
+
+	// A volume created before a restart of the node plugin is reused.
+	if volumeID, err := e.getCreatedVolumeID(ctx, "csi-ephemeral-1"); err != nil || volumeID != "vol-1" {
+		t.Errorf("expected volume %q, got %q, err %v", "vol-1", volumeID, err)
+	}
+	if volumeID, err := e.getCreatedVolumeID(ctx, "csi-ephemeral-2"); err != nil || volumeID != "" {
+		t.Errorf("expected no volume for an ephemeral volume not created yet, got %q, err %v", volumeID, err)
+	}
+	for _, filter := range volumeManager.filters {
+		if !reflect.DeepEqual(filter.ContainerClusterIds, []string{"cluster-1"}) {
+			t.Errorf("expected the volumes of cluster %q to be queried, got %v", "cluster-1",
+				filter.ContainerClusterIds)
+		}
+	}
+}
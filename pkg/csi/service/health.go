@@ -0,0 +1,88 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+)
+
+const (
+	// vCenterHealthCheckInterval is the interval between two checks of the
+	// vCenter connections of the controller.
+	vCenterHealthCheckInterval = 30 * time.Second
+	// vCenterHealthCheckTimeout bounds the time a check of the vCenter
+	// connections may take.
+	vCenterHealthCheckTimeout = 20 * time.Second
+)
+
+// monitorHealth sets the status reported by the gRPC health service once the
+// driver is initialized. The node plugin does not depend on vCenter and is
+// reported SERVING right away. The controller of the vanilla and workload
+// flavors is reported SERVING only while the sessions with all the vCenters
+// are established, and NOT_SERVING during vCenter outages. The monitoring
+// stops when the driver shuts down.
+func (driver *vsphereCSIDriver) monitorHealth(ctx context.Context) {
+	if strings.EqualFold(driver.mode, "node") || clusterFlavor == cnstypes.CnsClusterFlavorGuest {
+		driver.grpcServer.SetServing(true)
+		return
+	}
+	go func() {
+		serving := driver.checkVCenterConnections(ctx)
+		driver.grpcServer.SetServing(serving)
+		ticker := time.NewTicker(vCenterHealthCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-driver.shutdownCh:
+				return
+			case <-ticker.C:
+				if healthy := driver.checkVCenterConnections(ctx); healthy != serving {
+					serving = healthy
+					driver.grpcServer.SetServing(serving)
+				}
+			}
+		}
+	}()
+}
+
+// checkVCenterConnections returns true if the sessions with all the vCenters
+// registered with the controller are established. Expired sessions are
+// re-established.
+func (driver *vsphereCSIDriver) checkVCenterConnections(ctx context.Context) bool {
+	log := logger.GetLogger(ctx)
+	ctx, cancel := context.WithTimeout(ctx, vCenterHealthCheckTimeout)
+	defer cancel()
+	vCenters := cnsvsphere.GetVirtualCenterManager(ctx).GetAllVirtualCenters()
+	if len(vCenters) == 0 {
+		log.Warn("No vCenter is registered with the controller, reporting NOT_SERVING")
+		return false
+	}
+	for _, vc := range vCenters {
+		if err := vc.Connect(ctx); err != nil {
+			log.Errorf("vCenter %q is not reachable, reporting NOT_SERVING. Err: %v", vc.Config.Host, err)
+			return false
+		}
+	}
+	return true
+}
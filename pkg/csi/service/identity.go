@@ -68,5 +68,14 @@ func (driver *vsphereCSIDriver) GetPluginCapabilities(
 			},
 		},
 	}
+	if _, ok := driver.cnscs.(csi.GroupControllerServer); ok {
+		rep.Capabilities = append(rep.Capabilities, &csi.PluginCapability{
+			Type: &csi.PluginCapability_Service_{
+				Service: &csi.PluginCapability_Service{
+					Type: csi.PluginCapability_Service_GROUP_CONTROLLER_SERVICE,
+				},
+			},
+		})
+	}
 	return rep, nil
 }
@@ -18,20 +18,34 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
+	"sync"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	cnstypes "github.com/vmware/govmomi/cns/types"
 	"github.com/vmware/govmomi/units"
 	"google.golang.org/grpc/codes"
-
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/node"
 	cnsconfig "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/config"
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common/commonco"
 	commoncotypes "sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common/commonco/types"
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/osutils"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/types"
+	k8s "sigs.k8s.io/vsphere-csi-driver/v3/pkg/kubernetes"
 )
 
 const (
@@ -42,6 +56,14 @@ const (
 	// If Customer is using vSphere 8.0, they are allowed to set MAX_VOLUMES_PER_NODE to 255
 	// when CSI is released with feature-gate - max-pvscsi-targets-per-vm enabled
 	maxAllowedBlockVolumesPerNodeInvSphere8 = 255
+	// pvscsiDriverName is the name of the driver of VMware Paravirtual SCSI controllers.
+	pvscsiDriverName = "vmw_pvscsi"
+	// pvscsiTargetsPerController is the number of disks which can be attached to
+	// a PVSCSI controller.
+	pvscsiTargetsPerController = 15
+	// pvscsiTargetsPerControllerInvSphere8 is the number of disks which can be
+	// attached to a PVSCSI controller on vSphere 8.0.
+	pvscsiTargetsPerControllerInvSphere8 = 64
 )
 
 var topologyService commoncotypes.NodeTopologyService
@@ -97,14 +119,32 @@ func (driver *vsphereCSIDriver) NodeStageVolume(
 		if err != nil {
 			return nil, err
 		}
+		// The mount flags of the volume may request a read-only mount.
+		params.Ro = params.Ro || common.Contains(params.MntFlags, "ro")
+		// Read-only clones are always mounted read-only.
+		params.Ro = params.Ro || common.IsReadOnlyCloneVolume(req.GetVolumeContext(), req.GetPublishContext())
+		if req.GetVolumeContext()[common.AttributeXFSProjectQuota] == "true" {
+			params.XFSProjectQuota = true
+			params.MntFlags = append(params.MntFlags, osutils.XFSProjectQuotaMountOption)
+		}
 
-		// Check that staging path is created by CO and is a directory.
+		// Clean up a corrupted mount left at the staging path before verifying it.
 		params.StagingTarget = req.GetStagingTargetPath()
+		if err = driver.osUtils.CleanupCorruptedMount(ctx, params.StagingTarget); err != nil {
+			return nil, err
+		}
+		// Check that staging path is created by CO and is a directory.
 		if _, err = driver.osUtils.VerifyTargetDir(ctx, params.StagingTarget, true); err != nil {
 			return nil, err
 		}
 	}
-	return driver.osUtils.NodeStageBlockVolume(ctx, req, params)
+	resp, err := driver.osUtils.NodeStageBlockVolume(ctx, req, params)
+	var sigErr *osutils.DeviceSignatureError
+	if errors.As(err, &sigErr) {
+		generateEventOnPVC(ctx, req.GetStagingTargetPath(), volumeID, v1.EventTypeWarning,
+			"VolumeSignatureMismatch", sigErr.Error())
+	}
+	return resp, err
 }
 
 func (driver *vsphereCSIDriver) NodeUnstageVolume(
@@ -139,6 +179,15 @@ func (driver *vsphereCSIDriver) NodeUnstageVolume(
 	}
 	defer driver.volumeLocks.Release(volumeID)
 
+	// The symlink to the device of a raw block volume is shared by all its
+	// publishes on the node, the volume is unstaged once none of them is left.
+	// The staging path of raw block volumes is not mounted, so the symlink is
+	// removed before checking the mounts.
+	if err := driver.osUtils.RemoveBlockDeviceLink(ctx, volumeID); err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"NodeUnstageVolume failed to remove the device symlink of volume %q. Err: %v", volumeID, err)
+	}
+
 	// Figure out if the target path is present in mounts or not - Unstage is
 	// not required for file volumes.
 	targetFound, err := driver.osUtils.IsTargetInMounts(ctx, stagingTarget)
@@ -188,11 +237,16 @@ func (driver *vsphereCSIDriver) NodePublishVolume(
 	params := osutils.NodePublishParams{
 		VolID:  volumeID,
 		Target: req.GetTargetPath(),
-		Ro:     req.GetReadonly(),
+		// Read-only clones are always published read-only.
+		Ro: req.GetReadonly() || common.IsReadOnlyCloneVolume(req.GetVolumeContext(), req.GetPublishContext()),
 	}
 	// TODO: Verify if volume exists and return a NotFound error in negative
 	// scenario.
 
+	if isEphemeralVolumeRequest(req.GetVolumeContext()) {
+		return driver.publishEphemeralVolume(ctx, req)
+	}
+
 	params.StagingTarget = req.GetStagingTargetPath()
 	if params.StagingTarget == "" {
 		return nil, logger.LogNewErrorCodef(log, codes.FailedPrecondition,
@@ -208,6 +262,17 @@ func (driver *vsphereCSIDriver) NodePublishVolume(
 		return nil, logger.LogNewErrorCode(log, codes.InvalidArgument,
 			"NodePublishVolume failed: volume capability not provided")
 	}
+	if subPath := req.GetVolumeContext()[common.AttributeSubPath]; subPath != "" {
+		if _, ok := volCap.GetAccessType().(*csi.VolumeCapability_Block); ok {
+			return nil, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+				"NodePublishVolume failed: %s is not supported for raw block volumes", common.AttributeSubPath)
+		}
+		if err := osutils.ValidateSubPath(subPath); err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+				"NodePublishVolume failed: %v", err)
+		}
+		params.SubPath = subPath
+	}
 	if acquired := driver.volumeLocks.TryAcquire(volumeID); !acquired {
 		return nil, logger.LogNewErrorCodef(log, codes.Aborted,
 			"NodePublishVolume failed: An operation with the given Volume ID %s already exists", volumeID)
@@ -218,6 +283,9 @@ func (driver *vsphereCSIDriver) NodePublishVolume(
 		return nil, logger.LogNewErrorCodef(log, codes.InvalidArgument,
 			"NodePublishVolume failed: volume capability not supported. Err: %+v", err)
 	}
+	// The first stats request after mount must compute fresh stats.
+	driver.volumeStatsCache.Invalidate(volumeID)
+	driver.volumeHealth.Reset(volumeID)
 
 	// Check if this is a MountVolume or BlockVolume.
 	if !common.IsFileVolumeRequest(ctx, caps) {
@@ -265,6 +333,12 @@ func (driver *vsphereCSIDriver) NodeUnpublishVolume(
 		return nil, logger.LogNewErrorCodef(log, codes.Internal,
 			"NodeUnpublishVolume failed: %v\nUnmounting arguments: %s\n", err, target)
 	}
+	if err := driver.deleteEphemeralVolume(ctx, volID); err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"NodeUnpublishVolume failed to delete ephemeral volume %q. Err: %v", volID, err)
+	}
+	driver.volumeStatsCache.Invalidate(volID)
+	driver.volumeHealth.Reset(volID)
 
 	log.Infof("NodeUnpublishVolume successful for volume %q", volID)
 	return &csi.NodeUnpublishVolumeResponse{}, nil
@@ -279,16 +353,79 @@ func (driver *vsphereCSIDriver) NodeGetVolumeStats(
 	log.Infof("NodeGetVolumeStats: called with args %+v", *req)
 
 	var err error
+	volumeID := req.GetVolumeId()
 	targetPath := req.GetVolumePath()
 	if targetPath == "" {
 		return nil, logger.LogNewErrorCodef(log, codes.InvalidArgument,
 			"received empty targetpath %q", targetPath)
 	}
 
+	// The cached stats are returned before checking the volume path, so that
+	// requests within the TTL do not touch the mount at all. The cached stats
+	// are invalidated when the volume is unpublished or unstaged.
+	if stats, ok := driver.volumeStatsCache.Get(volumeID); ok {
+		log.Debugf("Returning cached stats for volume %q", volumeID)
+		return stats, nil
+	}
+	if _, err := os.Stat(targetPath); err != nil {
+		if os.IsNotExist(err) {
+			return nil, logger.LogNewErrorCodef(log, codes.NotFound,
+				"volume path %q does not exist", targetPath)
+		}
+		if stats := driver.getStaleMountStats(ctx, volumeID, targetPath, err); stats != nil {
+			return stats, nil
+		}
+		return nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to stat volume path %q. err: %v", targetPath, err)
+	}
+	mounted, err := driver.osUtils.IsTargetInMounts(ctx, targetPath)
+	if err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to check if volume path %q is mounted. err: %v", targetPath, err)
+	}
+	if !mounted {
+		return nil, logger.LogNewErrorCodef(log, codes.NotFound,
+			"volume path %q is not mounted", targetPath)
+	}
+	// For raw block volumes, only the capacity of the block device is reported.
+	isBlock, err := driver.osUtils.IsBlockDevice(ctx, targetPath)
+	if err != nil {
+		return nil, logger.LogNewErrorCode(log, codes.Internal, err.Error())
+	}
+	if isBlock {
+		dev, err := driver.osUtils.GetDevFromMount(ctx, targetPath)
+		if err != nil || dev == nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to get block device for volume path %q. err: %v", targetPath, err)
+		}
+		capacity, err := driver.osUtils.GetBlockSizeBytes(ctx, dev.RealDev)
+		if err != nil {
+			return nil, logger.LogNewErrorCode(log, codes.Internal, err.Error())
+		}
+		stats := &csi.NodeGetVolumeStatsResponse{
+			Usage: []*csi.VolumeUsage{
+				{
+					Total: capacity,
+					Unit:  csi.VolumeUsage_BYTES,
+				},
+			},
+			VolumeCondition: &csi.VolumeCondition{
+				Abnormal: false,
+				Message:  "volume is attached and accessible",
+			},
+		}
+		driver.volumeStatsCache.Set(volumeID, stats)
+		return stats, nil
+	}
+
 	volMetrics, err := driver.osUtils.GetMetrics(ctx, targetPath)
 	if err != nil {
+		if stats := driver.getStaleMountStats(ctx, volumeID, targetPath, err); stats != nil {
+			return stats, nil
+		}
 		return nil, logger.LogNewErrorCode(log, codes.Internal, err.Error())
 	}
+	driver.volumeHealth.Reset(volumeID)
 
 	available, ok := (*(volMetrics.Available)).AsInt64()
 	if !ok {
@@ -314,7 +451,7 @@ func (driver *vsphereCSIDriver) NodeGetVolumeStats(
 	if !ok {
 		log.Warn("failed to fetch used inodes")
 	}
-	return &csi.NodeGetVolumeStatsResponse{
+	stats := &csi.NodeGetVolumeStatsResponse{
 		Usage: []*csi.VolumeUsage{
 			{
 				Available: available,
@@ -329,7 +466,40 @@ func (driver *vsphereCSIDriver) NodeGetVolumeStats(
 				Unit:      csi.VolumeUsage_INODES,
 			},
 		},
-	}, nil
+		VolumeCondition: &csi.VolumeCondition{
+			Abnormal: false,
+			Message:  "volume is mounted and accessible",
+		},
+	}
+	driver.volumeStatsCache.Set(volumeID, stats)
+	return stats, nil
+}
+
+// getStaleMountStats returns the stats of the volume reporting an abnormal
+// volume condition if err, returned when checking its mount at targetPath,
+// shows that the mount is stale, e.g. because the datastore of the volume is
+// inaccessible, and the mount failed the previous checks as well. nil is
+// returned otherwise, so that transient errors are returned as such.
+func (driver *vsphereCSIDriver) getStaleMountStats(ctx context.Context, volumeID string, targetPath string,
+	err error) *csi.NodeGetVolumeStatsResponse {
+	log := logger.GetLogger(ctx)
+	if !node.IsStaleMountError(err) {
+		return nil
+	}
+	if !driver.volumeHealth.RecordFailure(volumeID) {
+		log.Warnf("Mount of volume %q at %q may be stale. err: %v", volumeID, targetPath, err)
+		return nil
+	}
+	log.Errorf("Mount of volume %q at %q is stale, reporting the volume as abnormal. err: %v",
+		volumeID, targetPath, err)
+	driver.volumeStatsCache.Invalidate(volumeID)
+	return &csi.NodeGetVolumeStatsResponse{
+		VolumeCondition: &csi.VolumeCondition{
+			Abnormal: true,
+			Message: fmt.Sprintf("mount of the volume at %s is stale or its backing storage is not "+
+				"accessible: %v", targetPath, err),
+		},
+	}
 }
 
 func (driver *vsphereCSIDriver) NodeGetCapabilities(
@@ -360,6 +530,20 @@ func (driver *vsphereCSIDriver) NodeGetCapabilities(
 					},
 				},
 			},
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_VOLUME_MOUNT_GROUP,
+					},
+				},
+			},
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_VOLUME_CONDITION,
+					},
+				},
+			},
 		},
 	}, nil
 }
@@ -409,30 +593,9 @@ func (driver *vsphereCSIDriver) NodeGetInfo(
 		}
 	}
 
-	var maxVolumesPerNode int64
-	var maxAllowedVolumesPerNode int64
-	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.MaxPVSCSITargetsPerVM) {
-		maxAllowedVolumesPerNode = maxAllowedBlockVolumesPerNodeInvSphere8
-	} else {
-		maxAllowedVolumesPerNode = maxAllowedBlockVolumesPerNode
-	}
-	if v := os.Getenv("MAX_VOLUMES_PER_NODE"); v != "" {
-		if value, err := strconv.ParseInt(v, 10, 64); err == nil {
-			if value < 0 {
-				return nil, logger.LogNewErrorCodef(log, codes.Internal,
-					"NodeGetInfo: MAX_VOLUMES_PER_NODE set in env variable %v is less than 0", v)
-			} else if value > maxAllowedVolumesPerNode {
-				return nil, logger.LogNewErrorCodef(log, codes.Internal,
-					"NodeGetInfo: MAX_VOLUMES_PER_NODE set in env variable %v is more than %v",
-					v, maxAllowedVolumesPerNode)
-			} else {
-				maxVolumesPerNode = value
-				log.Infof("NodeGetInfo: MAX_VOLUMES_PER_NODE is set to %v", maxVolumesPerNode)
-			}
-		} else {
-			return nil, logger.LogNewErrorCodef(log, codes.Internal,
-				"NodeGetInfo: MAX_VOLUMES_PER_NODE set in env variable %v is invalid", v)
-		}
+	maxVolumesPerNode, err := driver.getMaxVolumesPerNode(ctx, clusterFlavor, nodeName)
+	if err != nil {
+		return nil, err
 	}
 
 	var (
@@ -470,7 +633,7 @@ func (driver *vsphereCSIDriver) NodeGetInfo(
 			NodeName: nodeName,
 			NodeID:   nodeID,
 		}
-		accessibleTopology, err = topologyService.GetNodeTopologyLabels(ctx, &nodeInfo)
+		accessibleTopology, err = driver.getNodeAccessibleTopology(ctx, nodeInfo)
 	}
 
 	if err != nil {
@@ -490,6 +653,186 @@ func (driver *vsphereCSIDriver) NodeGetInfo(
 	return nodeInfoResponse, nil
 }
 
+// getMaxVolumesPerNode returns the maximum number of block volumes which can
+// be attached to the node. The limit is taken from the AnnMaxVolumesPerNode
+// annotation on the node, then from the MAX_VOLUMES_PER_NODE env variable.
+// If neither is set, 0 is returned, which leaves the limit to the CO, unless
+// DETECT_MAX_VOLUMES_PER_NODE is set to true on vanilla nodes. In that case
+// the limit is computed from the detected PVSCSI controllers, defaulting to
+// maxAllowedBlockVolumesPerNode when the controllers cannot be determined.
+func (driver *vsphereCSIDriver) getMaxVolumesPerNode(ctx context.Context,
+	clusterFlavor cnstypes.CnsClusterFlavor, nodeName string) (int64, error) {
+	log := logger.GetLogger(ctx)
+	var maxAllowedVolumesPerNode, targetsPerController int64
+	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.MaxPVSCSITargetsPerVM) {
+		maxAllowedVolumesPerNode = maxAllowedBlockVolumesPerNodeInvSphere8
+		targetsPerController = pvscsiTargetsPerControllerInvSphere8
+	} else {
+		maxAllowedVolumesPerNode = maxAllowedBlockVolumesPerNode
+		targetsPerController = pvscsiTargetsPerController
+	}
+
+	if v := getNodeAnnotation(ctx, nodeName, common.AnnMaxVolumesPerNode); v != "" {
+		value, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || value < 0 || value > maxAllowedVolumesPerNode {
+			return 0, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+				"NodeGetInfo: %s annotation value %q on node %q must be an integer between 0 and %v",
+				common.AnnMaxVolumesPerNode, v, nodeName, maxAllowedVolumesPerNode)
+		}
+		log.Infof("NodeGetInfo: max volumes per node is set to %v by annotation %s",
+			value, common.AnnMaxVolumesPerNode)
+		return value, nil
+	}
+
+	if v := os.Getenv("MAX_VOLUMES_PER_NODE"); v != "" {
+		if value, err := strconv.ParseInt(v, 10, 64); err == nil {
+			if value < 0 {
+				return 0, logger.LogNewErrorCodef(log, codes.Internal,
+					"NodeGetInfo: MAX_VOLUMES_PER_NODE set in env variable %v is less than 0", v)
+			} else if value > maxAllowedVolumesPerNode {
+				return 0, logger.LogNewErrorCodef(log, codes.Internal,
+					"NodeGetInfo: MAX_VOLUMES_PER_NODE set in env variable %v is more than %v",
+					v, maxAllowedVolumesPerNode)
+			}
+			log.Infof("NodeGetInfo: MAX_VOLUMES_PER_NODE is set to %v", value)
+			return value, nil
+		}
+		return 0, logger.LogNewErrorCodef(log, codes.Internal,
+			"NodeGetInfo: MAX_VOLUMES_PER_NODE set in env variable %v is invalid", v)
+	}
+
+	if clusterFlavor != cnstypes.CnsClusterFlavorVanilla {
+		return 0, nil
+	}
+	if detect, err := strconv.ParseBool(os.Getenv("DETECT_MAX_VOLUMES_PER_NODE")); err != nil || !detect {
+		return 0, nil
+	}
+	drivers, err := driver.osUtils.GetSCSIControllerDrivers(ctx)
+	if err != nil {
+		log.Warnf("NodeGetInfo: failed to detect SCSI controllers, reporting max volumes per node as %v. Err: %v",
+			maxAllowedBlockVolumesPerNode, err)
+		return maxAllowedBlockVolumesPerNode, nil
+	}
+	maxVolumesPerNode := maxVolumesForSCSIControllers(drivers, targetsPerController, maxAllowedVolumesPerNode)
+	log.Infof("NodeGetInfo: max volumes per node computed as %v from SCSI controllers %v",
+		maxVolumesPerNode, drivers)
+	return maxVolumesPerNode, nil
+}
+
+// maxVolumesForSCSIControllers returns the number of volumes which can be
+// attached to the PVSCSI controllers among the given SCSI controller drivers.
+// One target is reserved for the boot disk of the node VM. If no PVSCSI
+// controller is present, maxAllowedBlockVolumesPerNode is returned.
+func maxVolumesForSCSIControllers(drivers []string, targetsPerController int64,
+	maxAllowedVolumesPerNode int64) int64 {
+	var pvscsiControllers int64
+	for _, driverName := range drivers {
+		if driverName == pvscsiDriverName {
+			pvscsiControllers++
+		}
+	}
+	if pvscsiControllers == 0 {
+		return maxAllowedBlockVolumesPerNode
+	}
+	return min(pvscsiControllers*targetsPerController-1, maxAllowedVolumesPerNode)
+}
+
+// getNodeAnnotation returns the value of the given annotation on the node.
+// An empty string is returned if the node cannot be retrieved.
+func getNodeAnnotation(ctx context.Context, nodeName string, annotation string) string {
+	log := logger.GetLogger(ctx)
+	k8sClient, err := k8s.NewClient(ctx)
+	if err != nil {
+		log.Warnf("failed to create k8s client to read annotations of node %q. Err: %v", nodeName, err)
+		return ""
+	}
+	node, err := k8sClient.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		log.Warnf("failed to get node %q to read its annotations. Err: %v", nodeName, err)
+		return ""
+	}
+	return node.Annotations[annotation]
+}
+
+var (
+	// eventRecorderLock guards the event recorder of the node plugin, which
+	// is created on first use and shared by all events.
+	eventRecorderLock sync.Mutex
+	eventK8sClient    clientset.Interface
+	eventRecorder     record.EventRecorder
+)
+
+// getEventRecorder returns the event recorder of the node plugin and the
+// client it records events with.
+func getEventRecorder(ctx context.Context) (clientset.Interface, record.EventRecorder, error) {
+	eventRecorderLock.Lock()
+	defer eventRecorderLock.Unlock()
+	if eventRecorder != nil {
+		return eventK8sClient, eventRecorder, nil
+	}
+	k8sClient, err := k8s.NewClient(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: k8sClient.CoreV1().Events("")})
+	eventK8sClient = k8sClient
+	eventRecorder = eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: csitypes.Name})
+	return eventK8sClient, eventRecorder, nil
+}
+
+// getPVNameFromTargetPath returns the name of the PV staged or published at
+// the given path. kubelet records the PV name as specVolID in the
+// vol_data.json file next to the staging and publish paths of CSI volumes.
+// An empty string is returned if the file cannot be read.
+func getPVNameFromTargetPath(targetPath string) string {
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(targetPath), "vol_data.json"))
+	if err != nil {
+		return ""
+	}
+	var volData struct {
+		SpecVolID string `json:"specVolID"`
+	}
+	if err = json.Unmarshal(data, &volData); err != nil {
+		return ""
+	}
+	return volData.SpecVolID
+}
+
+// generateEventOnPVC records an event on the PVC bound to the PV of the given
+// volume staged or published at targetPath, if any.
+func generateEventOnPVC(ctx context.Context, targetPath string, volumeID string, eventType string, reason string,
+	message string) {
+	log := logger.GetLogger(ctx)
+	pvName := getPVNameFromTargetPath(targetPath)
+	if pvName == "" {
+		log.Debugf("no PV found for volume %q at path %s, skipping event %q", volumeID, targetPath, reason)
+		return
+	}
+	k8sClient, recorder, err := getEventRecorder(ctx)
+	if err != nil {
+		log.Errorf("failed to create k8s client to record event for volume %q. Err: %v", volumeID, err)
+		return
+	}
+	pv, err := k8sClient.CoreV1().PersistentVolumes().Get(ctx, pvName, metav1.GetOptions{})
+	if err != nil {
+		log.Errorf("failed to get PV %q to record event for volume %q. Err: %v", pvName, volumeID, err)
+		return
+	}
+	if pv.Spec.CSI == nil || pv.Spec.CSI.VolumeHandle != volumeID || pv.Spec.ClaimRef == nil {
+		log.Debugf("no PVC bound to volume %q, skipping event %q", volumeID, reason)
+		return
+	}
+	pvc, err := k8sClient.CoreV1().PersistentVolumeClaims(pv.Spec.ClaimRef.Namespace).Get(ctx,
+		pv.Spec.ClaimRef.Name, metav1.GetOptions{})
+	if err != nil {
+		log.Errorf("failed to get PVC %s/%s to record event. Err: %v", pv.Spec.ClaimRef.Namespace,
+			pv.Spec.ClaimRef.Name, err)
+		return
+	}
+	recorder.Event(pvc, eventType, reason, message)
+}
+
 // initVolumeTopologyService is a helper method to initialize
 // TopologyService in node.
 func initVolumeTopologyService(ctx context.Context) error {
@@ -525,15 +868,18 @@ func (driver *vsphereCSIDriver) NodeExpandVolume(
 		return nil, logger.LogNewErrorCode(log, codes.InvalidArgument, "capacity ranges values cannot be negative")
 	}
 
+	// Stats computed before the resize would report the old capacity.
+	defer driver.volumeStatsCache.Invalidate(volumeID)
+
 	reqVolSizeBytes := int64(req.GetCapacityRange().GetRequiredBytes())
 	reqVolSizeMB := int64(common.RoundUpSize(reqVolSizeBytes, common.MbInBytes))
 
-	// TODO(xyang): In CSI spec 1.2, NodeExpandVolume will be
-	// passing in a staging_target_path which is more precise
-	// than volume_path. Use the new staging_target_path
-	// instead of the volume_path when it is supported by Kubernetes.
-
+	// NOTE: volume_path is used to look up the mounted device. Fall back to
+	// staging_target_path when volume_path is not provided by the CO.
 	volumePath := req.GetVolumePath()
+	if len(volumePath) == 0 {
+		volumePath = req.GetStagingTargetPath()
+	}
 	if len(volumePath) == 0 {
 		return nil, logger.LogNewErrorCode(log, codes.InvalidArgument,
 			"volume path must be provided to expand volume on node")
@@ -552,6 +898,32 @@ func (driver *vsphereCSIDriver) NodeExpandVolume(
 	}
 	log.Debugf("NodeExpandVolume: staging target path %s, getDevFromMount %+v", volumePath, *dev)
 
+	// Check the volume capability and handle accordingly.
+	// NOTE: VolumeCapability is optional field, if specified, use it for validation.
+	//       Otherwise, use volume_path to determine access_type and handle accordingly.
+	var isBlock bool
+	volCap := req.GetVolumeCapability()
+	if volCap != nil {
+		caps := []*csi.VolumeCapability{volCap}
+		if err := common.IsValidVolumeCapabilities(ctx, caps); err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+				"volume capability not supported. Err: %+v", err)
+		}
+		isBlock = volCap.GetBlock() != nil
+	} else {
+		isBlock, err = driver.osUtils.IsBlockDevice(ctx, volumePath)
+		if err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to determine device path for volpath [%v]: %v", volumePath, err)
+		}
+	}
+	// No need to expand file system for raw block volumes, only the device
+	// needs to be rescanned.
+	if isBlock {
+		log.Infof("NodeExpandVolume: called for raw block volume %s at volumePath %s", volumeID, volumePath)
+		return driver.nodeExpandRawBlockVolume(ctx, volumeID, dev, reqVolSizeBytes)
+	}
+
 	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.OnlineVolumeExtend) {
 		// Fetch the current block size.
 		currentBlockSizeBytes, err := driver.osUtils.GetBlockSizeBytes(ctx, dev.RealDev)
@@ -572,47 +944,90 @@ func (driver *vsphereCSIDriver) NodeExpandVolume(
 		}
 	}
 
-	// Check the volume capability and handle accordingly.
-	// NOTE: VolumeCapability is optional field, if specified, use it for validation.
-	//       Otherwise, use volume_path to determine access_type and handle accordingly.
-	volCap := req.GetVolumeCapability()
-	if volCap != nil {
-		caps := []*csi.VolumeCapability{volCap}
-		if err := common.IsValidVolumeCapabilities(ctx, caps); err != nil {
-			return nil, logger.LogNewErrorCodef(log, codes.InvalidArgument,
-				"volume capability not supported. Err: %+v", err)
-		}
-		// No need to expand file system for raw block volumes, hence return.
-		if volCap.GetBlock() != nil {
-			log.Infof("NodeExpandVolume: called for raw block volume %s, ignoring..", volumeID)
-			return &csi.NodeExpandVolumeResponse{
-				CapacityBytes: int64(units.FileSize(reqVolSizeMB * common.MbInBytes)),
-			}, nil
-		}
-	} else {
-		isBlock, err := driver.osUtils.IsBlockDevice(ctx, volumePath)
-		if err != nil {
-			return nil, logger.LogNewErrorCodef(log, codes.Internal,
-				"failed to determine device path for volpath [%v]: %v", volumePath, err)
-		}
-		if isBlock {
-			log.Infof("NodeExpandVolume: called for raw block volume %s at volumePath %s, ignoring..", volumeID, volumePath)
-			return &csi.NodeExpandVolumeResponse{
-				CapacityBytes: int64(units.FileSize(reqVolSizeMB * common.MbInBytes)),
-			}, nil
-		}
+	// A filesystem mounted read-only cannot be grown online.
+	readOnly, err := driver.osUtils.IsMountReadOnly(ctx, volumePath)
+	if err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to check mount options for volume %q at path %s: %v", volumeID, volumePath, err)
+	}
+	if readOnly {
+		return nil, logger.LogNewErrorCodef(log, codes.FailedPrecondition,
+			"volume %q is mounted read-only at path %s, filesystem cannot be expanded online",
+			volumeID, volumePath)
 	}
 
 	// Resize file system.
 	if err = driver.osUtils.ResizeVolume(ctx, dev.RealDev, volumePath, reqVolSizeBytes); err != nil {
+		// The block device stays expanded, report why the filesystem could
+		// not be grown so that the admin can fix it and retry.
+		var resizeErr *osutils.FilesystemResizeError
+		if errors.As(err, &resizeErr) {
+			generateEventOnPVC(ctx, volumePath, volumeID, v1.EventTypeWarning, resizeErr.Reason, resizeErr.Error())
+			return nil, logger.LogNewErrorCodef(log, resizeErr.GRPCStatus().Code(),
+				"error when resizing filesystem on volume %q on node: %v", volumeID, err)
+		}
 		return nil, logger.LogNewErrorCodef(log, codes.Internal,
 			"error when resizing filesystem on volume %q on node: %v", volumeID, err)
 	}
 	log.Debugf("NodeExpandVolume: Resized filesystem with devicePath %s volumePath %s", dev.RealDev, volumePath)
 
+	// The XFS project quota set at staging limits the volume to its
+	// previous size until it is raised to the new size.
+	if err = driver.osUtils.UpdateXFSProjectQuota(ctx, volumeID, dev.RealDev, volumePath); err != nil {
+		return nil, err
+	}
+
+	// Report the size of the block device after resize, as the volume size
+	// could have been rounded up and be bigger than the requested size.
+	capacityBytes := int64(units.FileSize(reqVolSizeMB * common.MbInBytes))
+	if currentBlockSizeBytes, err := driver.osUtils.GetBlockSizeBytes(ctx, dev.RealDev); err != nil {
+		log.Warnf("NodeExpandVolume: failed to get size of block device %s after resize, err: %v",
+			dev.RealDev, err)
+	} else if currentBlockSizeBytes > capacityBytes {
+		capacityBytes = currentBlockSizeBytes
+	}
+
 	log.Infof("NodeExpandVolume: expanded volume successfully. devicePath %s volumePath %s size %d",
-		dev.RealDev, volumePath, int64(units.FileSize(reqVolSizeMB*common.MbInBytes)))
+		dev.RealDev, volumePath, capacityBytes)
+	return &csi.NodeExpandVolumeResponse{
+		CapacityBytes: capacityBytes,
+	}, nil
+}
+
+// nodeExpandRawBlockVolume rescans the device of an expanded raw block volume
+// so that the guest OS sees the new size, and verifies that the device
+// reflects the requested capacity before reporting it.
+func (driver *vsphereCSIDriver) nodeExpandRawBlockVolume(ctx context.Context, volumeID string,
+	dev *osutils.Device, reqVolSizeBytes int64) (*csi.NodeExpandVolumeResponse, error) {
+	log := logger.GetLogger(ctx)
+	currentBlockSizeBytes, err := driver.osUtils.GetBlockSizeBytes(ctx, dev.RealDev)
+	if err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"error when getting size of block volume at path %s: %v", dev.RealDev, err)
+	}
+	if currentBlockSizeBytes < reqVolSizeBytes {
+		// The guest OS does not see the new size of a device expanded while it
+		// is attached to the VM until the device is rescanned.
+		// Refer to https://kb.vmware.com/s/article/1006371
+		log.Infof("NodeExpandVolume: rescanning device %s of volume %q, its size %d is less than requested size %d",
+			dev.RealDev, volumeID, currentBlockSizeBytes, reqVolSizeBytes)
+		if err = driver.osUtils.RescanDevice(ctx, dev); err != nil {
+			return nil, logger.LogNewErrorCode(log, codes.Internal, err.Error())
+		}
+		currentBlockSizeBytes, err = driver.osUtils.GetBlockSizeBytes(ctx, dev.RealDev)
+		if err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"error when getting size of block volume at path %s after rescan: %v", dev.RealDev, err)
+		}
+		if currentBlockSizeBytes < reqVolSizeBytes {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"device %s of volume %q reports size %d after rescan, less than requested size %d",
+				dev.RealDev, volumeID, currentBlockSizeBytes, reqVolSizeBytes)
+		}
+	}
+	log.Infof("NodeExpandVolume: expanded raw block volume %q successfully. devicePath %s size %d",
+		volumeID, dev.RealDev, currentBlockSizeBytes)
 	return &csi.NodeExpandVolumeResponse{
-		CapacityBytes: int64(units.FileSize(reqVolSizeMB * common.MbInBytes)),
+		CapacityBytes: currentBlockSizeBytes,
 	}, nil
 }
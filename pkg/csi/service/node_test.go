@@ -0,0 +1,117 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGetPVNameFromTargetPath(t *testing.T) {
+	dir := t.TempDir()
+	volData := `{"driverName":"csi.vsphere.vmware.com","specVolID":"pvc-1","volumeHandle":"fcd-1"}`
+	if err := os.WriteFile(filepath.Join(dir, "vol_data.json"), []byte(volData), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if pvName := getPVNameFromTargetPath(filepath.Join(dir, "globalmount")); pvName != "pvc-1" {
+		t.Errorf("expected PV name %q, got %q", "pvc-1", pvName)
+	}
+	if pvName := getPVNameFromTargetPath(filepath.Join(t.TempDir(), "mount")); pvName != "" {
+		t.Errorf("expected no PV name without vol_data.json, got %q", pvName)
+	}
+}
+
+func TestGetStaleMountStats(t *testing.T) {
+	ctx := context.Background()
+	driver := NewDriver().(*vsphereCSIDriver)
+	volumeID := "fcd-1"
+	targetPath := "/var/lib/kubelet/pods/pod-1/volumes/kubernetes.io~csi/pvc-1/mount"
+	driver.volumeStatsCache.Set(volumeID, &csi.NodeGetVolumeStatsResponse{
+		VolumeCondition: &csi.VolumeCondition{Abnormal: false},
+	})
+
+	if stats := driver.getStaleMountStats(ctx, volumeID, targetPath, syscall.ENOENT); stats != nil {
+		t.Errorf("expected no stats for an error which is not a stale mount, got %v", stats)
+	}
+	// The volume is reported abnormal once the mount failed
+	// staleMountFailureThreshold consecutive checks.
+	for i := 1; i < staleMountFailureThreshold; i++ {
+		if stats := driver.getStaleMountStats(ctx, volumeID, targetPath, syscall.EIO); stats != nil {
+			t.Errorf("expected no stats after %d failed checks, got %v", i, stats)
+		}
+	}
+	stats := driver.getStaleMountStats(ctx, volumeID, targetPath, syscall.EIO)
+	if stats == nil || stats.VolumeCondition == nil || !stats.VolumeCondition.Abnormal {
+		t.Fatalf("expected an abnormal volume condition, got %v", stats)
+	}
+	if _, found := driver.volumeStatsCache.Get(volumeID); found {
+		t.Errorf("expected the cached stats of the abnormal volume to be invalidated")
+	}
+
+	// A successful check resets the count of failed checks.
+	driver.volumeHealth.Reset(volumeID)
+	if stats := driver.getStaleMountStats(ctx, volumeID, targetPath, syscall.ESTALE); stats != nil {
+		t.Errorf("expected no stats after the reset of the failed checks, got %v", stats)
+	}
+}
+
+func TestNodeGetVolumeStatsFromCache(t *testing.T) {
+	ctx := context.Background()
+	driver := NewDriver().(*vsphereCSIDriver)
+	volumeID := "fcd-1"
+	targetPath := filepath.Join(t.TempDir(), "mount")
+	cachedStats := &csi.NodeGetVolumeStatsResponse{
+		VolumeCondition: &csi.VolumeCondition{Abnormal: false},
+	}
+	driver.volumeStatsCache.Set(volumeID, cachedStats)
+
+	// The cached stats are returned without checking the volume path, which
+	// does not exist.
+	req := &csi.NodeGetVolumeStatsRequest{VolumeId: volumeID, VolumePath: targetPath}
+	stats, err := driver.NodeGetVolumeStats(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != cachedStats {
+		t.Errorf("expected the cached stats, got %v", stats)
+	}
+	driver.volumeStatsCache.Invalidate(volumeID)
+	if _, err := driver.NodeGetVolumeStats(ctx, req); status.Code(err) != codes.NotFound {
+		t.Errorf("expected codes.NotFound once the cached stats are invalidated, got: %v", err)
+	}
+}
+
+func TestNodeGetCapabilitiesVolumeCondition(t *testing.T) {
+	driver := &vsphereCSIDriver{}
+	resp, err := driver.NodeGetCapabilities(context.Background(), &csi.NodeGetCapabilitiesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, capability := range resp.Capabilities {
+		if capability.GetRpc().GetType() == csi.NodeServiceCapability_RPC_VOLUME_CONDITION {
+			return
+		}
+	}
+	t.Errorf("expected the VOLUME_CONDITION capability, got %v", resp.Capabilities)
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
+	commoncotypes "sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common/commonco/types"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+	k8s "sigs.k8s.io/vsphere-csi-driver/v3/pkg/kubernetes"
+)
+
+const (
+	// nodeTopologyRefreshDebounce is the time to wait after the last change of
+	// the topology labels of the node before its accessible topology is
+	// refreshed, so that a batch of label updates triggers a single refresh.
+	nodeTopologyRefreshDebounce = 30 * time.Second
+	// nodeTopologyRefreshTimeout bounds the time a refresh waits for the
+	// CSINodeTopology instance of the node to be synced.
+	nodeTopologyRefreshTimeout = 5 * time.Minute
+)
+
+// nodeTopologyWatch caches the accessible topology of the node and refreshes
+// it when the topology labels of the node change, e.g. when an admin corrects
+// the zone of the node after its host was moved across clusters. The refresh
+// has the CSINodeTopology instance of the node synced again, so that the
+// controller provisions volumes in the corrected zone without restarting the
+// node plugin, and NodeGetInfo returns the cached topology, so that the
+// corrected topology is reported when the driver is registered again.
+type nodeTopologyWatch struct {
+	mu                 sync.Mutex
+	nodeInfo           commoncotypes.NodeInfo
+	accessibleTopology map[string]string
+	refreshTimer       *time.Timer
+	startOnce          sync.Once
+}
+
+// getNodeAccessibleTopology returns the accessible topology of the node. The
+// cached topology is returned if any, otherwise the topology is computed and
+// cached, and the topology labels of the node are watched from then on.
+func (driver *vsphereCSIDriver) getNodeAccessibleTopology(ctx context.Context,
+	nodeInfo commoncotypes.NodeInfo) (map[string]string, error) {
+	log := logger.GetLogger(ctx)
+	if accessibleTopology, found := driver.nodeTopology.get(nodeInfo); found {
+		log.Infof("Using cached accessible topology of node %q: %v", nodeInfo.NodeName, accessibleTopology)
+		return accessibleTopology, nil
+	}
+	accessibleTopology, err := topologyService.GetNodeTopologyLabels(ctx, &nodeInfo)
+	if err != nil {
+		return nil, err
+	}
+	driver.watchNodeTopology(ctx, nodeInfo, accessibleTopology)
+	return accessibleTopology, nil
+}
+
+// get returns the cached accessible topology of the given node, if any.
+func (watch *nodeTopologyWatch) get(nodeInfo commoncotypes.NodeInfo) (map[string]string, bool) {
+	watch.mu.Lock()
+	defer watch.mu.Unlock()
+	if watch.accessibleTopology == nil || watch.nodeInfo != nodeInfo {
+		return nil, false
+	}
+	return maps.Clone(watch.accessibleTopology), true
+}
+
+// watchNodeTopology caches the accessible topology computed by NodeGetInfo
+// and starts watching the topology labels of the node, once.
+func (driver *vsphereCSIDriver) watchNodeTopology(ctx context.Context, nodeInfo commoncotypes.NodeInfo,
+	accessibleTopology map[string]string) {
+	watch := driver.nodeTopology
+	watch.mu.Lock()
+	watch.nodeInfo = nodeInfo
+	watch.accessibleTopology = accessibleTopology
+	watch.mu.Unlock()
+	watch.startOnce.Do(func() {
+		if err := driver.startNodeTopologyInformer(ctx, nodeInfo.NodeName); err != nil {
+			log := logger.GetLogger(ctx)
+			log.Errorf("failed to watch topology labels of node %q. Topology corrections require a restart "+
+				"of the node plugin. Err: %v", nodeInfo.NodeName, err)
+		}
+	})
+}
+
+// startNodeTopologyInformer starts an informer on the node object, which
+// schedules a refresh of the accessible topology whenever the topology labels
+// of the node change. The informer is stopped when the driver shuts down.
+func (driver *vsphereCSIDriver) startNodeTopologyInformer(ctx context.Context, nodeName string) error {
+	log := logger.GetLogger(ctx)
+	k8sClient, err := k8s.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	informerFactory := informers.NewSharedInformerFactoryWithOptions(k8sClient, 0,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", nodeName).String()
+		}))
+	_, err = informerFactory.Core().V1().Nodes().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNode, ok := oldObj.(*v1.Node)
+			if !ok {
+				return
+			}
+			newNode, ok := newObj.(*v1.Node)
+			if !ok {
+				return
+			}
+			oldLabels, newLabels := getTopologyLabels(oldNode), getTopologyLabels(newNode)
+			if maps.Equal(oldLabels, newLabels) {
+				return
+			}
+			log.Infof("Topology labels of node %q changed from %v to %v, refreshing its accessible topology "+
+				"in %v", nodeName, oldLabels, newLabels, nodeTopologyRefreshDebounce)
+			driver.scheduleNodeTopologyRefresh()
+		},
+	})
+	if err != nil {
+		return err
+	}
+	informerFactory.Start(driver.shutdownCh)
+	log.Infof("Watching topology labels of node %q", nodeName)
+	return nil
+}
+
+// scheduleNodeTopologyRefresh refreshes the accessible topology of the node
+// once its topology labels have not changed for nodeTopologyRefreshDebounce.
+func (driver *vsphereCSIDriver) scheduleNodeTopologyRefresh() {
+	watch := driver.nodeTopology
+	watch.mu.Lock()
+	defer watch.mu.Unlock()
+	if watch.refreshTimer != nil {
+		watch.refreshTimer.Stop()
+	}
+	watch.refreshTimer = time.AfterFunc(nodeTopologyRefreshDebounce, driver.refreshNodeTopology)
+}
+
+// refreshNodeTopology has the topology of the node computed again and updates
+// the cached accessible topology.
+func (driver *vsphereCSIDriver) refreshNodeTopology() {
+	ctx, cancel := context.WithTimeout(logger.NewContextWithLogger(context.Background()),
+		nodeTopologyRefreshTimeout)
+	defer cancel()
+	log := logger.GetLogger(ctx)
+	watch := driver.nodeTopology
+	watch.mu.Lock()
+	nodeInfo := watch.nodeInfo
+	oldTopology := watch.accessibleTopology
+	watch.mu.Unlock()
+	if err := initVolumeTopologyService(ctx); err != nil {
+		log.Errorf("failed to refresh accessible topology of node %q. Err: %v", nodeInfo.NodeName, err)
+		return
+	}
+	accessibleTopology, err := topologyService.GetNodeTopologyLabels(ctx, &nodeInfo)
+	if err != nil {
+		log.Errorf("failed to refresh accessible topology of node %q. Err: %v", nodeInfo.NodeName, err)
+		return
+	}
+	watch.mu.Lock()
+	watch.accessibleTopology = accessibleTopology
+	watch.mu.Unlock()
+	if maps.Equal(oldTopology, accessibleTopology) {
+		log.Infof("Accessible topology of node %q is unchanged: %v", nodeInfo.NodeName, accessibleTopology)
+		return
+	}
+	log.Infof("Accessible topology of node %q refreshed from %v to %v", nodeInfo.NodeName, oldTopology,
+		accessibleTopology)
+}
+
+// getTopologyLabels returns the labels of the node which are relevant to its
+// topology, i.e. the well-known zone and region labels and the labels in the
+// topology domain of the driver.
+func getTopologyLabels(node *v1.Node) map[string]string {
+	labels := make(map[string]string)
+	for key, value := range node.Labels {
+		if key == v1.LabelTopologyZone || key == v1.LabelTopologyRegion ||
+			strings.HasPrefix(key, common.TopologyLabelsDomain+"/") {
+			labels[key] = value
+		}
+	}
+	return labels
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"maps"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
+	commoncotypes "sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common/commonco/types"
+)
+
+// fakeNodeTopologyService returns the configured topology labels and counts
+// the lookups.
+type fakeNodeTopologyService struct {
+	labels  map[string]string
+	lookups int
+}
+
+func (s *fakeNodeTopologyService) GetNodeTopologyLabels(ctx context.Context,
+	info *commoncotypes.NodeInfo) (map[string]string, error) {
+	s.lookups++
+	return maps.Clone(s.labels), nil
+}
+
+func TestNodeAccessibleTopologyCache(t *testing.T) {
+	fakeService := &fakeNodeTopologyService{labels: map[string]string{v1.LabelTopologyZone: "zone-a"}}
+	defaultService := topologyService
+	topologyService = fakeService
+	defer func() { topologyService = defaultService }()
+
+	driver := &vsphereCSIDriver{nodeTopology: &nodeTopologyWatch{}, shutdownCh: make(chan struct{})}
+	// The topology labels of the node are not watched in the test.
+	driver.nodeTopology.startOnce.Do(func() {})
+	nodeInfo := commoncotypes.NodeInfo{NodeName: "node-1", NodeID: "uuid-1"}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		topology, err := driver.getNodeAccessibleTopology(ctx, nodeInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if topology[v1.LabelTopologyZone] != "zone-a" {
+			t.Errorf("expected zone-a, got %v", topology)
+		}
+	}
+	if fakeService.lookups != 1 {
+		t.Errorf("expected the topology to be looked up once, got %d lookups", fakeService.lookups)
+	}
+	if _, found := driver.nodeTopology.get(commoncotypes.NodeInfo{NodeName: "node-2", NodeID: "uuid-2"}); found {
+		t.Errorf("expected no cached topology for another node")
+	}
+
+	// A refresh after a correction of the zone of the node is returned by
+	// NodeGetInfo from then on.
+	fakeService.labels = map[string]string{v1.LabelTopologyZone: "zone-b"}
+	driver.refreshNodeTopology()
+	topology, err := driver.getNodeAccessibleTopology(ctx, nodeInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if topology[v1.LabelTopologyZone] != "zone-b" {
+		t.Errorf("expected the refreshed zone-b, got %v", topology)
+	}
+	if fakeService.lookups != 2 {
+		t.Errorf("expected the topology to be looked up twice, got %d lookups", fakeService.lookups)
+	}
+}
+
+func TestGetTopologyLabels(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+		v1.LabelTopologyZone:                      "zone-a",
+		v1.LabelTopologyRegion:                    "region-a",
+		common.TopologyLabelsDomain + "/k8s-rack": "rack-1",
+		v1.LabelHostname:                          "node-1",
+	}}}
+	expected := map[string]string{
+		v1.LabelTopologyZone:                      "zone-a",
+		v1.LabelTopologyRegion:                    "region-a",
+		common.TopologyLabelsDomain + "/k8s-rack": "rack-1",
+	}
+	if labels := getTopologyLabels(node); !maps.Equal(labels, expected) {
+		t.Errorf("expected topology labels %v, got %v", expected, labels)
+	}
+}
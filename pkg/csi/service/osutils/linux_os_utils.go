@@ -20,12 +20,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"math"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/akutz/gofsutil"
 	"github.com/container-storage-interface/spec/lib/go/csi"
@@ -44,12 +50,49 @@ import (
 )
 
 const (
-	devDiskID   = "/dev/disk/by-id"
 	blockPrefix = "wwn-0x"
 	dmiDir      = "/sys/class/dmi"
 	UUIDPrefix  = "VMware-"
 )
 
+const (
+	// fsGroupFilePermMask is the permission mask applied to files when applying the volume mount group.
+	fsGroupFilePermMask os.FileMode = 0660
+	// fsGroupDirPermMask is the permission mask applied to directories when applying the volume mount group.
+	fsGroupDirPermMask os.FileMode = 0770
+)
+
+// linuxBlockFsTypes are the filesystems supported for block volumes on Linux.
+var linuxBlockFsTypes = []string{common.Ext4FsType, common.Ext3FsType, common.XFSType}
+
+const (
+	// envMountTimeoutSeconds is the env variable to configure the time in seconds
+	// NodeStageVolume waits for the volume to be formatted and mounted.
+	envMountTimeoutSeconds = "MOUNT_TIMEOUT_SECONDS"
+	// defaultMountTimeout is the default time NodeStageVolume waits for the volume
+	// to be formatted and mounted. It is lower than the timeout kubelet applies on
+	// NodeStageVolume so that a hung mount is reported back to kubelet.
+	defaultMountTimeout = 90 * time.Second
+)
+
+var (
+	// devDiskID is the directory with the links to the disks of the node by ID.
+	devDiskID = "/dev/disk/by-id"
+	// scsiHostDir is the sysfs directory listing the SCSI host adapters of the node.
+	scsiHostDir = "/sys/class/scsi_host"
+	// sysBlockDir is the sysfs directory listing the block devices of the node.
+	sysBlockDir = "/sys/block"
+)
+
+const (
+	// diskRescanTimeout is the time a disk missing on the node is waited for
+	// after rescanning the SCSI hosts.
+	diskRescanTimeout = 5 * time.Second
+	// diskRescanPollInterval is the interval at which the disk is looked up
+	// after rescanning the SCSI hosts.
+	diskRescanPollInterval = 500 * time.Millisecond
+)
+
 // defaultFileMountOptions are the mount flag options used by default while publishing a file volume.
 var defaultFileMountOptions = []string{"hard", "sec=sys", "vers=4", "minorversion=1"}
 
@@ -62,10 +105,29 @@ func NewOsUtils(ctx context.Context) (*OsUtils, error) {
 		return nil, err
 	}
 	return &OsUtils{
-		Mounter: mounter,
+		Mounter:       mounter,
+		MountTimeout:  getMountTimeout(ctx),
+		DefaultFsType: getDefaultFsType(ctx, common.Ext4FsType, linuxBlockFsTypes),
 	}, nil
 }
 
+// getMountTimeout returns the mount timeout set in env variable
+// MOUNT_TIMEOUT_SECONDS if it is valid, or the default mount timeout otherwise.
+func getMountTimeout(ctx context.Context) time.Duration {
+	log := logger.GetLogger(ctx)
+	mountTimeout := defaultMountTimeout
+	if v := os.Getenv(envMountTimeoutSeconds); v != "" {
+		if value, err := strconv.Atoi(v); err == nil && value > 0 {
+			mountTimeout = time.Duration(value) * time.Second
+			log.Infof("Mount timeout is set to %v", mountTimeout)
+		} else {
+			log.Warnf("%s set in env variable %q is invalid, will use the default mount timeout %v",
+				envMountTimeoutSeconds, v, defaultMountTimeout)
+		}
+	}
+	return mountTimeout
+}
+
 // getKernelVersion gets the current kernel and major version.
 func getKernelVersion(ctx context.Context) (int, int, error) {
 	log := logger.GetLogger(ctx)
@@ -143,12 +205,58 @@ func (osUtils *OsUtils) getDiskFormat(ctx context.Context, disk string) (string,
 		log.Infof("getDiskFormat: disk %s detected partition table type: %s", disk, pttype)
 		// Returns a special non-empty string as filesystem type, then kubelet
 		// will not format it.
-		return "unknown data, probably partitions", nil
+		return partitionedDiskFormat, nil
 	}
 
 	return fstype, nil
 }
 
+// partitionedDiskFormat is the format returned by getDiskFormat for a disk
+// holding a partition table.
+const partitionedDiskFormat = "unknown data, probably partitions"
+
+// isFsTypeCompatible returns true if a device formatted with existingFsType
+// can be mounted as fsType. The ext4 driver mounts ext2 and ext3 filesystems
+// too.
+func isFsTypeCompatible(existingFsType, fsType string) bool {
+	extFsTypes := []string{"ext2", common.Ext3FsType, common.Ext4FsType}
+	if slices.Contains(extFsTypes, existingFsType) && slices.Contains(extFsTypes, fsType) {
+		return true
+	}
+	return existingFsType == fsType
+}
+
+// validateDeviceSignature verifies that the block device holds a filesystem
+// matching fsType before it is mounted, and returns a DeviceSignatureError
+// otherwise. A device without any signature is valid unless it is to be
+// mounted read-only, in which case it cannot be formatted.
+func (osUtils *OsUtils) validateDeviceSignature(ctx context.Context, devicePath string, fsType string,
+	ro bool) error {
+	log := logger.GetLogger(ctx)
+	existingFormat, err := osUtils.getDiskFormat(ctx, devicePath)
+	if err != nil {
+		return &DeviceSignatureError{Device: devicePath, FsType: fsType,
+			Reason: fmt.Sprintf("its signature cannot be probed, it may be corrupted or carry conflicting "+
+				"signatures (%v)", err)}
+	}
+	switch {
+	case existingFormat == "" && ro:
+		return &DeviceSignatureError{Device: devicePath, FsType: fsType,
+			Reason: "no filesystem signature found and the volume is to be mounted read-only"}
+	case existingFormat == "":
+		log.Infof("validateDeviceSignature: device %q is not formatted, it will be formatted with %s",
+			devicePath, fsType)
+		return nil
+	case existingFormat == partitionedDiskFormat:
+		return &DeviceSignatureError{Device: devicePath, FsType: fsType,
+			Reason: "a partition table was found instead of a filesystem"}
+	case !isFsTypeCompatible(existingFormat, fsType):
+		return &DeviceSignatureError{Device: devicePath, FsType: fsType,
+			Reason: fmt.Sprintf("a %s filesystem signature was found", existingFormat)}
+	}
+	return nil
+}
+
 // xfsFormatAndMount mounts volume to the staging path for xfs fstype
 func (osUtils *OsUtils) xfsFormatAndMount(ctx context.Context, source string, target string,
 	fstype string, opts ...string) error {
@@ -264,36 +372,52 @@ func (osUtils *OsUtils) NodeStageBlockVolume(
 	}
 
 	if len(mnts) == 0 {
-		// Device isn't mounted anywhere, stage the volume.
+		// Device isn't mounted anywhere. Clean up any stale mount left behind at
+		// the staging target, for example by an ungraceful node reboot, before
+		// staging the volume.
+		if err := osUtils.cleanupStaleStagingMount(ctx, params.StagingTarget, dev.FullPath); err != nil {
+			return nil, err
+		}
+		// Verify the signature of the device before mounting it, so that a
+		// corrupted volume is reported instead of being formatted.
+		if err := osUtils.validateDeviceSignature(ctx, dev.FullPath, params.FsType, params.Ro); err != nil {
+			log.Errorf("nodeStageBlockVolume: %v", err)
+			return nil, err
+		}
 		// If access mode is read-only, we don't allow formatting.
 		if params.Ro {
-			log.Debugf("nodeStageBlockVolume: Mounting %q at %q in read-only mode with mount flags %v",
-				dev.FullPath, params.StagingTarget, params.MntFlags)
-			params.MntFlags = append(params.MntFlags, "ro")
-			err := gofsutil.Mount(ctx, dev.FullPath, params.StagingTarget, params.FsType, params.MntFlags...)
+			params.MntFlags = mergeMountFlags(params.MntFlags, []string{"ro"})
+			err := osUtils.mountWithTimeout(ctx, "mounting", dev.FullPath, params, func() error {
+				return gofsutil.Mount(ctx, dev.FullPath, params.StagingTarget, params.FsType, params.MntFlags...)
+			})
 			if err != nil {
-				return nil, logger.LogNewErrorCodef(log, codes.Internal,
-					"error mounting volume. Parameters: %v err: %v", params, err)
+				return nil, err
 			}
 			log.Infof("nodeStageBlockVolume: Device mounted successfully at %q", params.StagingTarget)
 			return &csi.NodeStageVolumeResponse{}, nil
 		}
 		// Format and mount the device.
-		log.Debugf("nodeStageBlockVolume: Format and mount the device %q at %q with mount flags %v",
-			dev.FullPath, params.StagingTarget, params.MntFlags)
-		if params.FsType == "xfs" {
-			// use internal function for XFS mount, as we want to provide few parameters for mkfs command
-			// which are specific to XFS filesystem
-			err := osUtils.xfsFormatAndMount(ctx, dev.FullPath, params.StagingTarget, params.FsType, params.MntFlags...)
-			if err != nil {
-				return nil, logger.LogNewErrorCodef(log, codes.Internal,
-					"error in formating and mounting volume. Parameters: %v err: %v", params, err)
+		err := osUtils.mountWithTimeout(ctx, "formating and mounting", dev.FullPath, params, func() error {
+			if params.FsType == "xfs" {
+				// use internal function for XFS mount, as we want to provide few parameters for mkfs command
+				// which are specific to XFS filesystem
+				return osUtils.xfsFormatAndMount(ctx, dev.FullPath, params.StagingTarget, params.FsType,
+					params.MntFlags...)
 			}
-		} else {
-			err := gofsutil.FormatAndMount(ctx, dev.FullPath, params.StagingTarget, params.FsType, params.MntFlags...)
-			if err != nil {
-				return nil, logger.LogNewErrorCodef(log, codes.Internal,
-					"error in formating and mounting volume. Parameters: %v err: %v", params, err)
+			return gofsutil.FormatAndMount(ctx, dev.FullPath, params.StagingTarget, params.FsType, params.MntFlags...)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if params.XFSProjectQuota {
+			if err := osUtils.setXFSProjectQuota(ctx, dev.FullPath, params); err != nil {
+				// Unmount the device so that the retry sets the quota again,
+				// instead of finding the device staged without a quota.
+				if unmountErr := gofsutil.Unmount(ctx, params.StagingTarget); unmountErr != nil {
+					log.Errorf("nodeStageBlockVolume: failed to unmount staging target %q. err: %v",
+						params.StagingTarget, unmountErr)
+				}
+				return nil, err
 			}
 		}
 	} else {
@@ -326,9 +450,245 @@ func (osUtils *OsUtils) NodeStageBlockVolume(
 	return &csi.NodeStageVolumeResponse{}, nil
 }
 
+// CleanupCorruptedMount unmounts the given target if it is a corrupted mount
+// point, which can be left behind by an ungraceful node reboot.
+func (osUtils *OsUtils) CleanupCorruptedMount(ctx context.Context, target string) error {
+	log := logger.GetLogger(ctx)
+	_, err := os.Stat(target)
+	if err == nil || !mount.IsCorruptedMnt(err) {
+		return nil
+	}
+	log.Infof("Target %q is a corrupted mount point. Cleaning up the stale mount. Err: %v", target, err)
+	if err := osUtils.Mounter.Unmount(target); err != nil {
+		return logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to unmount corrupted mount at %q: %v", target, err)
+	}
+	log.Infof("Unmounted corrupted mount at %q", target)
+	return nil
+}
+
+// cleanupStaleStagingMount unmounts the staging target if a device other than
+// the one being staged is still mounted at it.
+func (osUtils *OsUtils) cleanupStaleStagingMount(ctx context.Context, stagingTarget string,
+	devicePath string) error {
+	log := logger.GetLogger(ctx)
+	targetFound, err := osUtils.IsTargetInMounts(ctx, stagingTarget)
+	if err != nil {
+		return logger.LogNewErrorCodef(log, codes.Internal,
+			"could not retrieve existing mount points for %q: %v", stagingTarget, err)
+	}
+	if !targetFound {
+		return nil
+	}
+	log.Infof("nodeStageBlockVolume: Staging target %q is mounted from a device other than %q. "+
+		"Cleaning up the stale mount.", stagingTarget, devicePath)
+	if err := osUtils.Mounter.Unmount(stagingTarget); err != nil {
+		return logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to unmount stale mount at staging target %q: %v", stagingTarget, err)
+	}
+	log.Infof("nodeStageBlockVolume: Unmounted stale mount at staging target %q", stagingTarget)
+	return nil
+}
+
+// pendingMounts holds the staging targets with a mount which timed out and is
+// still running, so that the volume is not mounted again at the staging target
+// until it completes.
+var pendingMounts sync.Map
+
+// mountWithTimeout runs the given mount of the device at the staging target and
+// waits at most MountTimeout for it to complete. A mount which does not
+// complete in time is reported with codes.DeadlineExceeded instead of blocking
+// the caller indefinitely. As the mount cannot be cancelled, it keeps running
+// and is unmounted if it completes later, so that the staging target is left
+// as the caller expects. Until then, mounts at the staging target are rejected
+// with codes.Aborted.
+func (osUtils *OsUtils) mountWithTimeout(ctx context.Context, operation string, devicePath string,
+	params NodeStageParams, mountFunc func() error) error {
+	log := logger.GetLogger(ctx)
+	mountTimeout := osUtils.MountTimeout
+	if mountTimeout <= 0 {
+		mountTimeout = defaultMountTimeout
+	}
+	if _, pending := pendingMounts.LoadOrStore(params.StagingTarget, struct{}{}); pending {
+		return logger.LogNewErrorCodef(log, codes.Aborted,
+			"a previous mount at staging target %q is still in progress", params.StagingTarget)
+	}
+	log.Infof("nodeStageBlockVolume: %s device %q at %q with fstype %q and mount options %v, timeout %v",
+		operation, devicePath, params.StagingTarget, params.FsType, params.MntFlags, mountTimeout)
+	var (
+		mux       sync.Mutex
+		abandoned bool
+		mountErr  error
+	)
+	done := make(chan struct{})
+	go func() {
+		err := mountFunc()
+		mux.Lock()
+		if !abandoned {
+			mountErr = err
+			close(done)
+			mux.Unlock()
+			pendingMounts.Delete(params.StagingTarget)
+			return
+		}
+		mux.Unlock()
+		osUtils.cleanupLateMount(ctx, operation, devicePath, params.StagingTarget, err)
+		pendingMounts.Delete(params.StagingTarget)
+	}()
+	timer := time.NewTimer(mountTimeout)
+	defer timer.Stop()
+	var timeoutErr error
+	select {
+	case <-done:
+	case <-timer.C:
+		timeoutErr = fmt.Errorf("timed out after %v", mountTimeout)
+	case <-ctx.Done():
+		timeoutErr = ctx.Err()
+	}
+	mux.Lock()
+	defer mux.Unlock()
+	if timeoutErr != nil {
+		select {
+		case <-done:
+			// The mount completed while the timeout was handled.
+		default:
+			abandoned = true
+			return logger.LogNewErrorCodef(log, codes.DeadlineExceeded,
+				"%s volume did not complete. Device: %q Parameters: %v err: %v",
+				operation, devicePath, params, timeoutErr)
+		}
+	}
+	if mountErr != nil {
+		return logger.LogNewErrorCodef(log, codes.Internal,
+			"error %s volume. Device: %q Parameters: %v err: %v", operation, devicePath, params, mountErr)
+	}
+	return nil
+}
+
+// cleanupLateMount unmounts the staging target mounted by a mount which
+// completed after mountWithTimeout stopped waiting for it.
+func (osUtils *OsUtils) cleanupLateMount(ctx context.Context, operation string, devicePath string,
+	stagingTarget string, mountErr error) {
+	log := logger.GetLogger(ctx)
+	if mountErr != nil {
+		log.Infof("nodeStageBlockVolume: %s device %q at %q failed after timing out. Err: %v",
+			operation, devicePath, stagingTarget, mountErr)
+		return
+	}
+	log.Infof("nodeStageBlockVolume: %s device %q at %q completed after timing out, unmounting it",
+		operation, devicePath, stagingTarget)
+	if err := osUtils.Mounter.Unmount(stagingTarget); err != nil {
+		log.Errorf("nodeStageBlockVolume: failed to unmount %q mounted after timing out. Err: %v",
+			stagingTarget, err)
+	}
+}
+
+// xfsProjectID returns the XFS project ID of the given volume. The project ID
+// is derived from the volume ID so that it is stable across restages.
+func xfsProjectID(volID string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(volID))
+	// Project ID 0 is the default project of the filesystem.
+	projectID := h.Sum32() & math.MaxInt32
+	if projectID == 0 {
+		projectID = 1
+	}
+	return projectID
+}
+
+// setXFSProjectQuota assigns the project ID of the volume to the root directory
+// of the filesystem mounted at the staging target and sets the hard block
+// limit of the project to the capacity of the device.
+func (osUtils *OsUtils) setXFSProjectQuota(ctx context.Context, devicePath string, params NodeStageParams) error {
+	log := logger.GetLogger(ctx)
+	capacity, err := osUtils.GetBlockSizeBytes(ctx, devicePath)
+	if err != nil {
+		return logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to get capacity of device %q for volume %q: %v", devicePath, params.VolID, err)
+	}
+	projectID := xfsProjectID(params.VolID)
+	err = osUtils.runXFSQuotaCommand(ctx, params.VolID, params.StagingTarget,
+		fmt.Sprintf("project -s -p %s %d", params.StagingTarget, projectID))
+	if err != nil {
+		return err
+	}
+	err = osUtils.runXFSQuotaCommand(ctx, params.VolID, params.StagingTarget,
+		fmt.Sprintf("limit -p bhard=%d %d", capacity, projectID))
+	if err != nil {
+		return err
+	}
+	log.Infof("nodeStageBlockVolume: Set XFS project quota of %d bytes with project ID %d for volume %q",
+		capacity, projectID, params.VolID)
+	return nil
+}
+
+// UpdateXFSProjectQuota sets the hard block limit of the XFS project of the
+// volume to the capacity of the device after the filesystem mounted at
+// volumePath was grown. It does nothing if the volume is not mounted with
+// project quota enforced.
+func (osUtils *OsUtils) UpdateXFSProjectQuota(ctx context.Context, volID, devicePath, volumePath string) error {
+	log := logger.GetLogger(ctx)
+	mnts, err := gofsutil.GetMounts(ctx)
+	if err != nil {
+		return logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to get mounts to check XFS project quota of volume %q: %v", volID, err)
+	}
+	if !hasMountOption(ctx, volumePath, mnts, XFSProjectQuotaMountOption) {
+		return nil
+	}
+	capacity, err := osUtils.GetBlockSizeBytes(ctx, devicePath)
+	if err != nil {
+		return logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to get capacity of device %q for volume %q: %v", devicePath, volID, err)
+	}
+	return osUtils.updateXFSProjectQuotaLimit(ctx, volID, volumePath, capacity)
+}
+
+// updateXFSProjectQuotaLimit sets the hard block limit of the XFS project of
+// the volume mounted at volumePath to capacity bytes.
+func (osUtils *OsUtils) updateXFSProjectQuotaLimit(ctx context.Context, volID, volumePath string,
+	capacity int64) error {
+	log := logger.GetLogger(ctx)
+	projectID := xfsProjectID(volID)
+	err := osUtils.runXFSQuotaCommand(ctx, volID, volumePath,
+		fmt.Sprintf("limit -p bhard=%d %d", capacity, projectID))
+	if err != nil {
+		return err
+	}
+	log.Infof("Updated XFS project quota of volume %q with project ID %d to %d bytes",
+		volID, projectID, capacity)
+	return nil
+}
+
+// runXFSQuotaCommand runs the given xfs_quota expert command on the XFS
+// filesystem mounted at path.
+func (osUtils *OsUtils) runXFSQuotaCommand(ctx context.Context, volID, path, command string) error {
+	log := logger.GetLogger(ctx)
+	log.Infof("Running xfs_quota %q on %q for volume %q", command, path, volID)
+	output, err := osUtils.Mounter.Exec.Command("xfs_quota", "-x", "-c", command, path).CombinedOutput()
+	if err != nil {
+		return logger.LogNewErrorCodef(log, codes.Internal,
+			"xfs_quota %q failed for volume %q at %q: %v output: %s", command, volID, path, err, string(output))
+	}
+	return nil
+}
+
 // CleanupStagePath will unmount the volume from node and remove the stage directory
 func (osUtils *OsUtils) CleanupStagePath(ctx context.Context, stagingTarget string, volID string) error {
 	log := logger.GetLogger(ctx)
+	// File volume, mounted at the staging target path to publish its
+	// subdirectories.
+	mnts, err := gofsutil.GetMounts(ctx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve existing mount points: %v", err)
+	}
+	if isFileMount, _ := isFileVolumeMount(ctx, stagingTarget, mnts); isFileMount {
+		log.Infof("Attempting to unmount file volume %q from staging target %q", volID, stagingTarget)
+		if err := gofsutil.Unmount(ctx, stagingTarget); err != nil {
+			return fmt.Errorf("error unmounting stagingTarget: %v", err)
+		}
+		return nil
+	}
 	// / Block volume.
 	isMounted, err := osUtils.IsBlockVolumeMounted(ctx, volID, stagingTarget)
 	if err != nil {
@@ -337,15 +697,120 @@ func (osUtils *OsUtils) CleanupStagePath(ctx context.Context, stagingTarget stri
 
 	// Volume is still mounted. Unstage the volume.
 	if isMounted {
+		dev, err := osUtils.GetDevFromMount(ctx, stagingTarget)
+		if err != nil {
+			log.Warnf("failed to get the device mounted at %q for volume %q. Err: %v", stagingTarget, volID, err)
+		}
 		log.Infof("Attempting to unmount target %q for volume %q", stagingTarget, volID)
 		if err := gofsutil.Unmount(ctx, stagingTarget); err != nil {
 			return fmt.Errorf(
 				"error unmounting stagingTarget: %v", err)
 		}
+		if dev != nil {
+			// The device is removed so that it does not linger in the SCSI
+			// subsystem once the volume is detached.
+			if err := osUtils.removeSCSIDevice(ctx, volID, dev); err != nil {
+				log.Warnf("failed to remove the SCSI device %q of volume %q. Err: %v", dev.RealDev, volID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// getDiskUUIDOfDevice returns the UUID of the vSphere virtual disk backing the
+// block device, or "" if the device is not a vSphere virtual disk.
+func getDiskUUIDOfDevice(realDev string) (string, error) {
+	links, err := os.ReadDir(devDiskID)
+	if err != nil {
+		return "", err
+	}
+	for _, link := range links {
+		if !strings.HasPrefix(link.Name(), blockPrefix) || strings.Contains(link.Name(), "-part") {
+			continue
+		}
+		target, err := filepath.EvalSymlinks(filepath.Join(devDiskID, link.Name()))
+		if err == nil && target == realDev {
+			return strings.TrimPrefix(link.Name(), blockPrefix), nil
+		}
+	}
+	return "", nil
+}
+
+// removeSCSIDevice flushes and deletes the SCSI device of the unstaged
+// volume. The device is left untouched unless it is the vSphere virtual disk
+// of the volume and it is not in use, i.e. it is not mounted and has no
+// partitions or holders such as device mapper devices.
+func (osUtils *OsUtils) removeSCSIDevice(ctx context.Context, volID string, dev *Device) error {
+	log := logger.GetLogger(ctx)
+	diskUUID, err := getDiskUUIDOfDevice(dev.RealDev)
+	if err != nil {
+		return err
+	}
+	if diskUUID == "" {
+		log.Infof("Device %q of volume %q is not a vSphere virtual disk, not removing it", dev.RealDev, volID)
+		return nil
+	}
+	devMnts, err := osUtils.GetDevMounts(ctx, dev)
+	if err != nil {
+		return err
+	}
+	if len(devMnts) > 0 {
+		log.Infof("Device %q of volume %q is still mounted, not removing it", dev.RealDev, volID)
+		return nil
+	}
+	devName := filepath.Base(dev.RealDev)
+	holders, err := os.ReadDir(filepath.Join(sysBlockDir, devName, "holders"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(holders) > 0 {
+		log.Infof("Device %q of volume %q is held by %d devices, not removing it", dev.RealDev, volID,
+			len(holders))
+		return nil
+	}
+	entries, err := os.ReadDir(filepath.Join(sysBlockDir, devName))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), devName) {
+			log.Infof("Device %q of volume %q has partition %q, not removing it", dev.RealDev, volID,
+				entry.Name())
+			return nil
+		}
+	}
+
+	devFile, err := os.Open(dev.RealDev)
+	if err != nil {
+		return err
+	}
+	err = devFile.Sync()
+	devFile.Close()
+	if err != nil {
+		return fmt.Errorf("failed to flush device %q: %v", dev.RealDev, err)
 	}
+	if err := os.WriteFile(filepath.Join(sysBlockDir, devName, "device", "delete"), []byte{'1'}, 0200); err != nil {
+		return err
+	}
+	log.Infof("Removed SCSI device %q of disk %q for volume %q", dev.RealDev, diskUUID, volID)
 	return nil
 }
 
+// rescanSCSIHosts scans all the SCSI hosts of the node for new devices.
+func rescanSCSIHosts(ctx context.Context) {
+	log := logger.GetLogger(ctx)
+	hosts, err := os.ReadDir(scsiHostDir)
+	if err != nil {
+		log.Warnf("failed to list SCSI hosts. Err: %v", err)
+		return
+	}
+	for _, host := range hosts {
+		if err := os.WriteFile(filepath.Join(scsiHostDir, host.Name(), "scan"), []byte("- - -"), 0200); err != nil {
+			log.Debugf("failed to rescan SCSI host %q. Err: %v", host.Name(), err)
+		}
+	}
+}
+
 // IsBlockVolumeMounted checks if the block volume is properly mounted or not.
 // If yes, then the calling function proceeds to unmount the volume.
 func (osUtils *OsUtils) IsBlockVolumeMounted(
@@ -553,6 +1018,8 @@ func (osUtils *OsUtils) PublishMountVol(
 	if err != nil {
 		return nil, err
 	}
+	// The mount flags of the volume may request a read-only mount.
+	params.Ro = params.Ro || common.Contains(mntFlags, "ro")
 
 	// We are responsible for creating target dir, per spec, if not already
 	// present.
@@ -604,14 +1071,34 @@ func (osUtils *OsUtils) PublishMountVol(
 			"volume ID: %q does not appear staged to %q", req.GetVolumeId(), params.StagingTarget)
 	}
 
+	// Only the subdirectory of the volume is published if a subpath is set.
+	source := params.StagingTarget
+	if params.SubPath != "" {
+		source, err = prepareSubPath(ctx, params.StagingTarget, params.SubPath)
+		if err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to prepare subpath %q of volume %q. err: %v", params.SubPath, req.GetVolumeId(), err)
+		}
+	}
+
+	// Apply the volume mount group (fsGroup) on the staged volume before the bind
+	// mount.
+	if volumeMountGroup := getVolumeMountGroup(req.GetVolumeCapability(), params.Ro); volumeMountGroup != "" {
+		if err := osUtils.ApplyVolumeMountGroup(ctx, source, volumeMountGroup); err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to apply volume mount group %q to volume %q. err: %v",
+				volumeMountGroup, req.GetVolumeId(), err)
+		}
+	}
+
 	// Do the bind mount to publish the volume.
-	mntFlags = append(mntFlags, "bind")
+	mntFlags = mergeMountFlags(mntFlags, []string{"bind"})
 	if params.Ro {
-		mntFlags = append(mntFlags, "ro")
+		mntFlags = mergeMountFlags(mntFlags, []string{"ro"})
 	}
 	log.Debugf("PublishMountVolume: Attempting to bind mount %q to %q with mount flags %v",
-		params.StagingTarget, params.Target, mntFlags)
-	if err := osUtils.Mounter.Mount(params.StagingTarget, params.Target, "", mntFlags); err != nil {
+		source, params.Target, mntFlags)
+	if err := osUtils.Mounter.Mount(source, params.Target, "", mntFlags); err != nil {
 		return nil, logger.LogNewErrorCodef(log, codes.Internal,
 			"error mounting volume. Parameters: %v err: %v", params, err)
 	}
@@ -619,6 +1106,122 @@ func (osUtils *OsUtils) PublishMountVol(
 	return &csi.NodePublishVolumeResponse{}, nil
 }
 
+// getVolumeMountGroup returns the volume mount group (fsGroup) to apply to a
+// volume published with the given capability, or an empty string if the
+// ownership of the volume is to be left untouched, as for volumes published
+// read-only, which cannot be written to.
+func getVolumeMountGroup(volCap *csi.VolumeCapability, readOnly bool) string {
+	if readOnly {
+		return ""
+	}
+	switch volCap.GetAccessMode().GetMode() {
+	case csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY,
+		csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY:
+		return ""
+	}
+	return volCap.GetMount().GetVolumeMountGroup()
+}
+
+// ApplyVolumeMountGroup recursively changes the group ownership of the volume
+// mounted at the given path to the given group and makes it group
+// read-writable. Ownership is changed only when the group of the root
+// directory of the volume does not match (OnRootMismatch), and symlinks are
+// not followed.
+func (osUtils *OsUtils) ApplyVolumeMountGroup(ctx context.Context, path string, volumeMountGroup string) error {
+	log := logger.GetLogger(ctx)
+	gid, err := strconv.Atoi(volumeMountGroup)
+	if err != nil || gid < 0 {
+		return fmt.Errorf("invalid volume mount group %q", volumeMountGroup)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Gid) == gid &&
+		info.Mode()&os.ModeSetgid != 0 && info.Mode().Perm()&fsGroupDirPermMask == fsGroupDirPermMask {
+		log.Debugf("Skipping group ownership change for %q, root directory already owned by group %d", path, gid)
+		return nil
+	}
+	log.Infof("Changing group ownership of %q to %d", path, gid)
+	return filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Lchown changes the ownership of the symlink itself and does not
+		// follow it.
+		if err := os.Lchown(p, -1, gid); err != nil {
+			return err
+		}
+		if d.Type()&os.ModeSymlink != 0 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		mode := info.Mode() | fsGroupFilePermMask
+		if d.IsDir() {
+			mode |= fsGroupDirPermMask | os.ModeSetgid
+		}
+		return os.Chmod(p, mode)
+	})
+}
+
+// blockDeviceLinkDir is the directory holding stable symlinks to the devices
+// of the raw block volumes published on the node, named after their volume
+// ID. The path is the same on the node and in the node plugin container.
+const blockDeviceLinkDir = "/var/lib/kubelet/plugins/csi.vsphere.vmware.com/block-devices"
+
+// getBlockDeviceLinkPath returns the path of the stable symlink to the device
+// of the given volume. Volume IDs of migrated volumes hold a VMDK path, so the
+// volume ID is escaped.
+func getBlockDeviceLinkPath(volID string) string {
+	return filepath.Join(blockDeviceLinkDir, url.PathEscape(volID))
+}
+
+// ensureBlockDeviceLink creates the stable symlink to the device of the given
+// volume, or updates it if the volume is now attached at another device node,
+// e.g. after a reboot of the node. It returns the path of the symlink.
+func ensureBlockDeviceLink(ctx context.Context, volID string, devicePath string) (string, error) {
+	log := logger.GetLogger(ctx)
+	linkPath := getBlockDeviceLinkPath(volID)
+	if current, err := os.Readlink(linkPath); err == nil && current == devicePath {
+		return linkPath, nil
+	}
+	if err := os.MkdirAll(blockDeviceLinkDir, 0750); err != nil {
+		return "", fmt.Errorf("failed to create directory %q. Err: %v", blockDeviceLinkDir, err)
+	}
+	// Replace the symlink atomically, so that it always points to a device.
+	tmpLinkPath := linkPath + ".tmp"
+	if err := os.Remove(tmpLinkPath); err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to remove stale symlink %q. Err: %v", tmpLinkPath, err)
+	}
+	if err := os.Symlink(devicePath, tmpLinkPath); err != nil {
+		return "", fmt.Errorf("failed to create symlink %q to %q. Err: %v", tmpLinkPath, devicePath, err)
+	}
+	if err := os.Rename(tmpLinkPath, linkPath); err != nil {
+		return "", fmt.Errorf("failed to rename symlink %q to %q. Err: %v", tmpLinkPath, linkPath, err)
+	}
+	log.Infof("Symlink %q to device %q of volume %q is up to date", linkPath, devicePath, volID)
+	return linkPath, nil
+}
+
+// RemoveBlockDeviceLink removes the stable symlink to the device of the given
+// volume, if any. It must only be called once the volume is unstaged, as the
+// symlink is shared by all the publishes of the volume on the node.
+func (osUtils *OsUtils) RemoveBlockDeviceLink(ctx context.Context, volID string) error {
+	log := logger.GetLogger(ctx)
+	linkPath := getBlockDeviceLinkPath(volID)
+	if err := os.Remove(linkPath); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to remove symlink %q. Err: %v", linkPath, err)
+	}
+	log.Infof("Removed symlink %q to the device of volume %q", linkPath, volID)
+	return nil
+}
+
 // PublishBlockVol mounts raw block device to publish target
 func (osUtils *OsUtils) PublishBlockVol(
 	ctx context.Context,
@@ -656,13 +1259,20 @@ func (osUtils *OsUtils) PublishBlockVol(
 	}
 	log.Debugf("publishBlockVol: device %+v, device mounts %q", *dev, devMnts)
 
+	// Point the stable symlink of the volume to the current device node.
+	linkPath, err := ensureBlockDeviceLink(ctx, params.VolID, dev.RealDev)
+	if err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to create symlink to the device of volume %q. Err: %v", params.VolID, err)
+	}
+
 	// Check if device is already mounted.
 	if len(devMnts) == 0 {
-		// Do the bind mount.
+		// Do the bind mount of the device through its stable symlink.
 		mntFlags := make([]string, 0)
 		log.Debugf("PublishBlockVolume: Attempting to bind mount %q to %q with mount flags %v",
-			dev.FullPath, params.Target, mntFlags)
-		if err := gofsutil.BindMount(ctx, dev.FullPath, params.Target, mntFlags...); err != nil {
+			linkPath, params.Target, mntFlags)
+		if err := gofsutil.BindMount(ctx, linkPath, params.Target, mntFlags...); err != nil {
 			return nil, logger.LogNewErrorCodef(log, codes.Internal,
 				"error mounting volume. Parameters: %v err: %v", params, err)
 		}
@@ -697,6 +1307,8 @@ func (osUtils *OsUtils) PublishFileVol(
 	if err != nil {
 		return nil, err
 	}
+	// The mount flags of the volume may request a read-only mount.
+	params.Ro = params.Ro || common.Contains(mntFlags, "ro")
 
 	// We are responsible for creating target dir, per spec, if not already
 	// present.
@@ -734,18 +1346,22 @@ func (osUtils *OsUtils) PublishFileVol(
 		}
 	}
 
-	// Check for read-only flag on Pod pvc spec.
-	if params.Ro {
-		mntFlags = append(mntFlags, "ro")
-	}
-	// Add defaultFileMountOptions to the mntFlags.
-	mntFlags = append(mntFlags, defaultFileMountOptions...)
 	// Retrieve the file share access point from publish context.
 	mntSrc, ok := req.GetPublishContext()[common.Nfsv4AccessPoint]
 	if !ok {
 		return nil, logger.LogNewErrorCode(log, codes.Internal,
 			"nfs v4 accesspoint not set in publish context")
 	}
+	if params.SubPath != "" {
+		return osUtils.publishFileVolSubPath(ctx, req, params, fsType,
+			mergeMountFlags(mntFlags, defaultFileMountOptions), mntSrc)
+	}
+	// Check for read-only flag on Pod pvc spec.
+	if params.Ro {
+		mntFlags = mergeMountFlags(mntFlags, []string{"ro"})
+	}
+	// Add defaultFileMountOptions to the mntFlags.
+	mntFlags = mergeMountFlags(mntFlags, defaultFileMountOptions)
 	// Directly mount the file share volume to the pod. No bind mount required.
 	log.Debugf("PublishFileVolume: Attempting to mount %q to %q with fstype %q and mountflags %v",
 		mntSrc, params.Target, fsType, mntFlags)
@@ -753,10 +1369,116 @@ func (osUtils *OsUtils) PublishFileVol(
 		return nil, logger.LogNewErrorCodef(log, codes.Internal,
 			"error publish volume to target path: %v", err)
 	}
+	// The file share is mounted straight at the target path, so the volume
+	// mount group is applied once it is mounted.
+	if volumeMountGroup := getVolumeMountGroup(req.GetVolumeCapability(), params.Ro); volumeMountGroup != "" {
+		if err := osUtils.ApplyVolumeMountGroup(ctx, params.Target, volumeMountGroup); err != nil {
+			if unmountErr := gofsutil.Unmount(ctx, params.Target); unmountErr != nil {
+				log.Errorf("failed to unmount target path %q. err: %v", params.Target, unmountErr)
+			}
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to apply volume mount group %q to volume %q. err: %v",
+				volumeMountGroup, req.GetVolumeId(), err)
+		}
+	}
 	log.Infof("NodePublishVolume successful to path %q", params.Target)
 	return &csi.NodePublishVolumeResponse{}, nil
 }
 
+// publishFileVolSubPath mounts the file share at the staging target path,
+// where it is shared by the pods publishing subdirectories of the volume on
+// the node, and bind mounts the subdirectory to the target path. The file
+// share remains mounted at the staging target path until the volume is
+// unstaged.
+func (osUtils *OsUtils) publishFileVolSubPath(
+	ctx context.Context,
+	req *csi.NodePublishVolumeRequest,
+	params NodePublishParams,
+	fsType string,
+	mntFlags []string,
+	mntSrc string) (
+	*csi.NodePublishVolumeResponse, error) {
+	log := logger.GetLogger(ctx)
+	if _, err := osUtils.Mkdir(ctx, params.StagingTarget); err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"unable to create staging target dir: %q, err: %v", params.StagingTarget, err)
+	}
+	staged, err := osUtils.IsTargetInMounts(ctx, params.StagingTarget)
+	if err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"could not retrieve existing mount points: %v", err)
+	}
+	if !staged {
+		// The file share is staged read-write, as it is shared by the pods
+		// publishing the volume on the node.
+		mntFlags = slices.DeleteFunc(slices.Clone(mntFlags), func(flag string) bool { return flag == "ro" })
+		log.Debugf("PublishFileVolume: Attempting to mount %q to %q with fstype %q and mountflags %v",
+			mntSrc, params.StagingTarget, fsType, mntFlags)
+		if err := gofsutil.Mount(ctx, mntSrc, params.StagingTarget, fsType, mntFlags...); err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"error mounting volume to staging target path: %v", err)
+		}
+	}
+	source, err := prepareSubPath(ctx, params.StagingTarget, params.SubPath)
+	if err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to prepare subpath %q of volume %q. err: %v", params.SubPath, req.GetVolumeId(), err)
+	}
+	if volumeMountGroup := getVolumeMountGroup(req.GetVolumeCapability(), params.Ro); volumeMountGroup != "" {
+		if err := osUtils.ApplyVolumeMountGroup(ctx, source, volumeMountGroup); err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to apply volume mount group %q to volume %q. err: %v",
+				volumeMountGroup, req.GetVolumeId(), err)
+		}
+	}
+	bindFlags := []string{"bind"}
+	if params.Ro {
+		bindFlags = append(bindFlags, "ro")
+	}
+	log.Debugf("PublishFileVolume: Attempting to bind mount %q to %q with mount flags %v",
+		source, params.Target, bindFlags)
+	if err := osUtils.Mounter.Mount(source, params.Target, "", bindFlags); err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"error publish volume to target path: %v", err)
+	}
+	log.Infof("NodePublishVolume successful to path %q", params.Target)
+	return &csi.NodePublishVolumeResponse{}, nil
+}
+
+// prepareSubPath creates the subdirectory subPath of the volume mounted at
+// root, including missing parent directories, and returns its path. Symbolic
+// links are rejected so that the subdirectory cannot point outside the
+// volume.
+func prepareSubPath(ctx context.Context, root string, subPath string) (string, error) {
+	log := logger.GetLogger(ctx)
+	path := root
+	for _, element := range strings.Split(filepath.Clean(subPath), string(filepath.Separator)) {
+		if element == "" || element == "." {
+			continue
+		}
+		path = filepath.Join(path, element)
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			log.Infof("Creating subpath directory %q", path)
+			if err := os.Mkdir(path, 0750); err != nil && !os.IsExist(err) {
+				return "", err
+			}
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("subpath %q must not contain symbolic links, %q is a symbolic link",
+				subPath, path)
+		}
+		if !info.IsDir() {
+			return "", fmt.Errorf("subpath %q is not a directory, %q is not a directory", subPath, path)
+		}
+	}
+	return path, nil
+}
+
 // GetDevice returns a Device struct with info about the given device, or
 // an error if it doesn't exist or is not a block device.
 func (osUtils *OsUtils) GetDevice(ctx context.Context, path string) (*Device, error) {
@@ -866,6 +1588,20 @@ func (osUtils *OsUtils) VerifyVolumeAttached(ctx context.Context, diskID string)
 		return "", logger.LogNewErrorCodef(log, codes.Internal,
 			"error trying to read attached disks: %v", err)
 	}
+	if volPath == "" {
+		// The SCSI device of the disk may have been removed when the volume was
+		// unstaged while the disk stayed attached, rescan for it.
+		log.Infof("disk: %s not found on node, rescanning SCSI hosts", diskID)
+		rescanSCSIHosts(ctx)
+		deadline := time.Now().Add(diskRescanTimeout)
+		for volPath == "" && time.Now().Before(deadline) {
+			time.Sleep(diskRescanPollInterval)
+			if volPath, err = osUtils.GetDiskPath(diskID); err != nil {
+				return "", logger.LogNewErrorCodef(log, codes.Internal,
+					"error trying to read attached disks: %v", err)
+			}
+		}
+	}
 	if volPath == "" {
 		return "", logger.LogNewErrorCodef(log, codes.NotFound,
 			"disk: %s not attached to node", diskID)
@@ -1027,6 +1763,27 @@ func (osUtils *OsUtils) GetSystemUUID(ctx context.Context) (string, error) {
 	return uuid, nil
 }
 
+// GetSCSIControllerDrivers returns the name of the driver, e.g. "vmw_pvscsi",
+// of each SCSI host adapter present on the node.
+func (osUtils *OsUtils) GetSCSIControllerDrivers(ctx context.Context) ([]string, error) {
+	log := logger.GetLogger(ctx)
+	hosts, err := os.ReadDir(scsiHostDir)
+	if err != nil {
+		return nil, err
+	}
+	var drivers []string
+	for _, host := range hosts {
+		procName, err := os.ReadFile(filepath.Join(scsiHostDir, host.Name(), "proc_name"))
+		if err != nil {
+			log.Debugf("failed to read driver name of SCSI host %q. Err: %v", host.Name(), err)
+			continue
+		}
+		drivers = append(drivers, strings.TrimSpace(string(procName)))
+	}
+	log.Debugf("SCSI controller drivers on node: %v", drivers)
+	return drivers, nil
+}
+
 // convertUUID helps convert UUID to vSphere format, for example,
 // Input uuid:    6B8C2042-0DD1-D037-156F-435F999D94C1
 // Returned uuid: 42208c6b-d10d-37d0-156f-435f999d94c1
@@ -1117,6 +1874,15 @@ func (osUtils *OsUtils) IsTargetInMounts(ctx context.Context, path string) (bool
 	return isTargetInMounts(ctx, path, mnts), nil
 }
 
+// IsMountReadOnly checks if the given target path is mounted with the "ro" option.
+func (osUtils *OsUtils) IsMountReadOnly(ctx context.Context, target string) (bool, error) {
+	mnts, err := gofsutil.GetMounts(ctx)
+	if err != nil {
+		return false, err
+	}
+	return isReadOnlyMount(ctx, target, mnts), nil
+}
+
 // GetVolumeCapabilityFsType retrieves fstype from VolumeCapability.
 // Defaults to nfs4 for file volume and ext4 for block volume when empty string
 // is observed. This function also ignores default ext4 fstype supplied by
@@ -1142,10 +1908,13 @@ func (osUtils *OsUtils) GetVolumeCapabilityFsType(ctx context.Context,
 		// For Block volumes we only support following filesystems:
 		// ext3, ext4 and xfs for Linux.
 		if fsType == "" {
-			log.Infof("empty string fstype observed for block volume. Defaulting to: %s",
-				common.Ext4FsType)
-			fsType = common.Ext4FsType
-		} else if !(fsType == common.Ext4FsType || fsType == common.Ext3FsType || fsType == common.XFSType) {
+			defaultFsType := osUtils.DefaultFsType
+			if defaultFsType == "" {
+				defaultFsType = common.Ext4FsType
+			}
+			log.Infof("empty string fstype observed for block volume. Defaulting to: %s", defaultFsType)
+			fsType = defaultFsType
+		} else if !slices.Contains(linuxBlockFsTypes, fsType) {
 			return "", logger.LogNewErrorCodef(log, codes.FailedPrecondition,
 				"unsupported fsType %q observed for block volume", fsType)
 		}
@@ -1159,8 +1928,8 @@ func (osUtils *OsUtils) ResizeVolume(ctx context.Context, devicePath, volumePath
 	resizer := mount.NewResizeFs(osUtils.Mounter.Exec)
 	_, err := resizer.Resize(devicePath, volumePath)
 	if err != nil {
-		return fmt.Errorf(
-			"error when resizing filesystem on devicePath %s and volumePath %s, err: %v ", devicePath, volumePath, err)
+		return &FilesystemResizeError{Device: devicePath, VolumePath: volumePath,
+			Reason: getFsResizeFailureReason(err), Err: err}
 	}
 	// Check the block size.
 	currentBlockSizeBytes, err := osUtils.GetBlockSizeBytes(ctx, devicePath)
@@ -1240,6 +2009,24 @@ func isTargetInMounts(ctx context.Context, target string, mnts []gofsutil.Info)
 	return false
 }
 
+// isReadOnlyMount returns true if the mount point for the given target path
+// has the "ro" mount option set.
+func isReadOnlyMount(ctx context.Context, target string, mnts []gofsutil.Info) bool {
+	return hasMountOption(ctx, target, mnts, "ro")
+}
+
+// hasMountOption returns true if the mount point for the given target path
+// has the given mount option set.
+func hasMountOption(ctx context.Context, target string, mnts []gofsutil.Info, option string) bool {
+	for _, m := range mnts {
+		if unescape(ctx, m.Path) != target {
+			continue
+		}
+		return slices.Contains(m.Opts, option)
+	}
+	return false
+}
+
 // decides if node should continue
 func (osUtils *OsUtils) ShouldContinue(ctx context.Context) {
 	// no op for linux
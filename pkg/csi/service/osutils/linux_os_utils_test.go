@@ -5,8 +5,23 @@ package osutils
 
 import (
 	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
 	"testing"
+	"time"
+
+	"github.com/akutz/gofsutil"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/mount-utils"
+	utilexec "k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
 )
 
 func TestUnescape(t *testing.T) {
@@ -52,3 +67,648 @@ func TestUnescape(t *testing.T) {
 		})
 	}
 }
+
+func TestIsReadOnlyMount(t *testing.T) {
+	ctx := context.Background()
+	mnts := []gofsutil.Info{
+		{
+			Device: "/dev/sdb",
+			Path:   "/var/lib/kubelet/plugins/kubernetes.io/csi/pv/pvc-1/globalmount",
+			Type:   "ext4",
+			Opts:   []string{"rw", "relatime"},
+		},
+		{
+			Device: "/dev/sdc",
+			Path:   "/var/lib/kubelet/plugins/kubernetes.io/csi/pv/pvc-2/globalmount",
+			Type:   "xfs",
+			Opts:   []string{"ro", "relatime"},
+		},
+	}
+	tests := []struct {
+		target   string
+		readOnly bool
+	}{
+		{target: "/var/lib/kubelet/plugins/kubernetes.io/csi/pv/pvc-1/globalmount", readOnly: false},
+		{target: "/var/lib/kubelet/plugins/kubernetes.io/csi/pv/pvc-2/globalmount", readOnly: true},
+		{target: "/var/lib/kubelet/plugins/kubernetes.io/csi/pv/pvc-3/globalmount", readOnly: false},
+	}
+	for _, test := range tests {
+		if got := isReadOnlyMount(ctx, test.target, mnts); got != test.readOnly {
+			t.Errorf("Expected isReadOnlyMount(%q) to be %v, got %v", test.target, test.readOnly, got)
+		}
+	}
+}
+
+func TestApplyVolumeMountGroup(t *testing.T) {
+	ctx := context.Background()
+	osUtils := &OsUtils{}
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "subdir"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "subdir", "file")
+	if err := os.WriteFile(file, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/nonexistent", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	gid := os.Getgid()
+	if err := osUtils.ApplyVolumeMountGroup(ctx, dir, strconv.Itoa(gid)); err != nil {
+		t.Fatalf("ApplyVolumeMountGroup failed: %v", err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0660 {
+		t.Errorf("expected file mode 0660, got %v", info.Mode().Perm())
+	}
+	info, err = os.Stat(filepath.Join(dir, "subdir"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSetgid == 0 || info.Mode().Perm() != 0770 {
+		t.Errorf("expected setgid directory with mode 0770, got %v", info.Mode())
+	}
+	if err := osUtils.ApplyVolumeMountGroup(ctx, dir, "invalid"); err == nil {
+		t.Errorf("expected error for invalid volume mount group")
+	}
+}
+
+func TestGetVolumeMountGroup(t *testing.T) {
+	newCapability := func(mode csi.VolumeCapability_AccessMode_Mode) *csi.VolumeCapability {
+		return &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{VolumeMountGroup: "2000"},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: mode},
+		}
+	}
+	tests := []struct {
+		name     string
+		volCap   *csi.VolumeCapability
+		readOnly bool
+		expected string
+	}{
+		{name: "read-write", volCap: newCapability(csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER),
+			expected: "2000"},
+		{name: "read-write many", volCap: newCapability(csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER),
+			expected: "2000"},
+		{name: "read-only publish", volCap: newCapability(csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER),
+			readOnly: true},
+		{name: "read-only once", volCap: newCapability(csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY)},
+		{name: "read-only many", volCap: newCapability(csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY)},
+		{name: "raw block", volCap: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}},
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+		}},
+	}
+	for _, test := range tests {
+		if group := getVolumeMountGroup(test.volCap, test.readOnly); group != test.expected {
+			t.Errorf("%s: expected volume mount group %q, got %q", test.name, test.expected, group)
+		}
+	}
+}
+
+func TestMountWithTimeout(t *testing.T) {
+	ctx := context.Background()
+	fakeMounter := mount.NewFakeMounter(nil)
+	osUtils := &OsUtils{
+		Mounter:      &mount.SafeFormatAndMount{Interface: fakeMounter},
+		MountTimeout: 10 * time.Millisecond,
+	}
+	params := NodeStageParams{VolID: "vol-1", StagingTarget: "/staging", FsType: "ext4"}
+	mountFunc := func() error {
+		return fakeMounter.Mount("/dev/sdb", params.StagingTarget, params.FsType, nil)
+	}
+
+	err := osUtils.mountWithTimeout(ctx, "mounting", "/dev/sdb", params, mountFunc)
+	if err != nil {
+		t.Fatalf("Expected mount to succeed, got %v", err)
+	}
+	if err := fakeMounter.Unmount(params.StagingTarget); err != nil {
+		t.Fatal(err)
+	}
+
+	hung := make(chan struct{})
+	err = osUtils.mountWithTimeout(ctx, "mounting", "/dev/sdb", params, func() error {
+		<-hung
+		return mountFunc()
+	})
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("Expected DeadlineExceeded for a hung mount, got %v", err)
+	}
+	// The staging target is not mounted again while the hung mount runs.
+	err = osUtils.mountWithTimeout(ctx, "mounting", "/dev/sdb", params, mountFunc)
+	if status.Code(err) != codes.Aborted {
+		t.Fatalf("Expected Aborted while the previous mount is in progress, got %v", err)
+	}
+
+	// The hung mount is unmounted once it completes.
+	close(hung)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, pending := pendingMounts.Load(params.StagingTarget); !pending {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the hung mount to complete")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if len(fakeMounter.MountPoints) != 0 {
+		t.Errorf("Expected the mount completed after the timeout to be unmounted, got %v",
+			fakeMounter.MountPoints)
+	}
+	err = osUtils.mountWithTimeout(ctx, "mounting", "/dev/sdb", params, mountFunc)
+	if err != nil {
+		t.Fatalf("Expected mount to succeed after the hung mount completed, got %v", err)
+	}
+}
+
+func TestGetMountTimeout(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		env      string
+		expected time.Duration
+	}{
+		{env: "", expected: defaultMountTimeout},
+		{env: "30", expected: 30 * time.Second},
+		{env: "0", expected: defaultMountTimeout},
+		{env: "invalid", expected: defaultMountTimeout},
+	}
+	for _, test := range tests {
+		t.Setenv(envMountTimeoutSeconds, test.env)
+		if got := getMountTimeout(ctx); got != test.expected {
+			t.Errorf("Expected mount timeout %v for %s=%q, got %v", test.expected, envMountTimeoutSeconds,
+				test.env, got)
+		}
+	}
+}
+
+func TestGetDefaultFsType(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		env      string
+		expected string
+	}{
+		{env: "", expected: common.Ext4FsType},
+		{env: "XFS", expected: common.XFSType},
+		{env: "ntfs", expected: common.Ext4FsType},
+	}
+	for _, test := range tests {
+		t.Setenv(envDefaultFsType, test.env)
+		osUtils := &OsUtils{DefaultFsType: getDefaultFsType(ctx, common.Ext4FsType, linuxBlockFsTypes)}
+		if osUtils.DefaultFsType != test.expected {
+			t.Errorf("Expected default fsType %q for %s=%q, got %q", test.expected, envDefaultFsType,
+				test.env, osUtils.DefaultFsType)
+		}
+		volCap := &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+		}
+		fsType, err := osUtils.GetVolumeCapabilityFsType(ctx, volCap)
+		if err != nil || fsType != test.expected {
+			t.Errorf("Expected fsType %q for an empty volume capability fsType, got %q, err: %v",
+				test.expected, fsType, err)
+		}
+	}
+}
+
+func TestIsFsTypeCompatible(t *testing.T) {
+	tests := []struct {
+		existingFsType, fsType string
+		expected               bool
+	}{
+		{existingFsType: "ext4", fsType: "ext4", expected: true},
+		{existingFsType: "ext3", fsType: "ext4", expected: true},
+		{existingFsType: "ext2", fsType: "ext3", expected: true},
+		{existingFsType: "xfs", fsType: "xfs", expected: true},
+		{existingFsType: "xfs", fsType: "ext4", expected: false},
+		{existingFsType: "ext4", fsType: "xfs", expected: false},
+		{existingFsType: partitionedDiskFormat, fsType: "ext4", expected: false},
+	}
+	for _, test := range tests {
+		if got := isFsTypeCompatible(test.existingFsType, test.fsType); got != test.expected {
+			t.Errorf("Expected isFsTypeCompatible(%q, %q) to be %v, got %v", test.existingFsType, test.fsType,
+				test.expected, got)
+		}
+	}
+}
+
+func TestDeviceSignatureErrorCode(t *testing.T) {
+	var err error = &DeviceSignatureError{Device: "/dev/sdb", FsType: "ext4", Reason: "a xfs filesystem signature"}
+	if code := status.Code(err); code != codes.Internal {
+		t.Errorf("Expected code %v for a device signature error, got %v", codes.Internal, code)
+	}
+}
+
+func TestFilesystemResizeErrorCode(t *testing.T) {
+	tests := []struct {
+		resizeErr string
+		reason    string
+		code      codes.Code
+	}{
+		{
+			resizeErr: "resize2fs: Please run 'e2fsck -f /dev/sdb' first.",
+			reason:    FsResizeReasonFsckRequired,
+			code:      codes.FailedPrecondition,
+		},
+		{
+			resizeErr: "xfs_growfs: XFS_IOC_FSGROWFSDATA xfsctl failed: Structure needs cleaning",
+			reason:    FsResizeReasonFsckRequired,
+			code:      codes.FailedPrecondition,
+		},
+		{
+			resizeErr: "ResizeFS.Resize - resize of format vfat is not supported for device /dev/sdb mounted at /mnt",
+			reason:    FsResizeReasonUnsupportedFs,
+			code:      codes.InvalidArgument,
+		},
+		{
+			resizeErr: "resize2fs: No space left on device",
+			reason:    FsResizeReasonFailed,
+			code:      codes.Internal,
+		},
+	}
+	for _, test := range tests {
+		resizeErr := errors.New(test.resizeErr)
+		var err error = &FilesystemResizeError{Device: "/dev/sdb", VolumePath: "/mnt",
+			Reason: getFsResizeFailureReason(resizeErr), Err: resizeErr}
+		var fsErr *FilesystemResizeError
+		if !errors.As(err, &fsErr) || fsErr.Reason != test.reason {
+			t.Errorf("Expected reason %q for resize error %q, got %+v", test.reason, test.resizeErr, err)
+		}
+		if code := status.Code(err); code != test.code {
+			t.Errorf("Expected code %v for resize error %q, got %v", test.code, test.resizeErr, code)
+		}
+	}
+}
+
+func TestHasMountOption(t *testing.T) {
+	ctx := context.Background()
+	mnts := []gofsutil.Info{
+		{
+			Device: "/dev/sdb",
+			Path:   "/var/lib/kubelet/plugins/kubernetes.io/csi/pv/pvc-1/globalmount",
+			Type:   "xfs",
+			Opts:   []string{"rw", "relatime", XFSProjectQuotaMountOption},
+		},
+		{
+			Device: "/dev/sdc",
+			Path:   "/var/lib/kubelet/plugins/kubernetes.io/csi/pv/pvc-2/globalmount",
+			Type:   "xfs",
+			Opts:   []string{"rw", "relatime"},
+		},
+	}
+	tests := []struct {
+		target   string
+		expected bool
+	}{
+		{target: "/var/lib/kubelet/plugins/kubernetes.io/csi/pv/pvc-1/globalmount", expected: true},
+		{target: "/var/lib/kubelet/plugins/kubernetes.io/csi/pv/pvc-2/globalmount", expected: false},
+		{target: "/var/lib/kubelet/plugins/kubernetes.io/csi/pv/pvc-3/globalmount", expected: false},
+	}
+	for _, test := range tests {
+		if got := hasMountOption(ctx, test.target, mnts, XFSProjectQuotaMountOption); got != test.expected {
+			t.Errorf("Expected hasMountOption(%q) to be %v, got %v", test.target, test.expected, got)
+		}
+	}
+}
+
+func TestUpdateXFSProjectQuotaLimit(t *testing.T) {
+	ctx := context.Background()
+	volID := "2d8b3a30-6b6d-4b1f-8d0e-5f1e6c2b9a11"
+	volumePath := "/var/lib/kubelet/plugins/kubernetes.io/csi/pv/pvc-1/globalmount"
+	capacity := int64(2 * 1024 * 1024 * 1024)
+	var ranArgs [][]string
+	newCmd := func(err error) testingexec.FakeCommandAction {
+		return func(cmd string, args ...string) utilexec.Cmd {
+			ranArgs = append(ranArgs, append([]string{cmd}, args...))
+			return testingexec.InitFakeCmd(&testingexec.FakeCmd{
+				CombinedOutputScript: []testingexec.FakeAction{
+					func() ([]byte, []byte, error) { return nil, nil, err },
+				},
+			}, cmd, args...)
+		}
+	}
+	fakeExec := &testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{
+		newCmd(nil),
+		newCmd(&testingexec.FakeExitError{Status: 1}),
+	}}
+	osUtils := &OsUtils{Mounter: &mount.SafeFormatAndMount{Exec: fakeExec}}
+
+	if err := osUtils.updateXFSProjectQuotaLimit(ctx, volID, volumePath, capacity); err != nil {
+		t.Fatalf("Unexpected error updating the XFS project quota: %v", err)
+	}
+	expected := []string{"xfs_quota", "-x", "-c",
+		"limit -p bhard=" + strconv.FormatInt(capacity, 10) + " " + strconv.FormatUint(uint64(xfsProjectID(volID)), 10),
+		volumePath}
+	if len(ranArgs) != 1 || !reflect.DeepEqual(ranArgs[0], expected) {
+		t.Errorf("Expected command %v, got %v", expected, ranArgs)
+	}
+	err := osUtils.updateXFSProjectQuotaLimit(ctx, volID, volumePath, capacity)
+	if status.Code(err) != codes.Internal {
+		t.Errorf("Expected Internal error when xfs_quota fails, got %v", err)
+	}
+}
+
+func TestGetFsResizeFailureReason(t *testing.T) {
+	// Output of the resize tools, as returned through mount-utils.
+	tests := []struct {
+		name   string
+		fsType string
+		output string
+		reason string
+	}{
+		{
+			name:   "resize2fs asks for e2fsck",
+			fsType: "ext4",
+			output: "resize2fs 1.46.5 (30-Dec-2021)\nPlease run 'e2fsck -f /dev/sdb' first.\n\n",
+			reason: FsResizeReasonFsckRequired,
+		},
+		{
+			name:   "resize2fs finds a corrupt superblock",
+			fsType: "ext4",
+			output: "resize2fs 1.46.5 (30-Dec-2021)\nresize2fs: The ext2 superblock is corrupt while trying to " +
+				"open /dev/sdb\nCouldn't find valid filesystem superblock.\n",
+			reason: FsResizeReasonFsckRequired,
+		},
+		{
+			name:   "resize2fs online resize denied",
+			fsType: "ext4",
+			output: "resize2fs 1.46.5 (30-Dec-2021)\nFilesystem at /dev/sdb is mounted on /mnt; on-line resizing " +
+				"required\nold_desc_blocks = 1, new_desc_blocks = 2\nresize2fs: Permission denied to resize " +
+				"filesystem\n",
+			reason: FsResizeReasonFailed,
+		},
+		{
+			name:   "resize2fs unsupported feature",
+			fsType: "ext3",
+			output: "resize2fs 1.46.5 (30-Dec-2021)\nresize2fs: Filesystem has unsupported read-only feature(s) " +
+				"while trying to open /dev/sdb\nCouldn't find valid filesystem superblock.\n",
+			reason: FsResizeReasonFailed,
+		},
+		{
+			name:   "xfs_growfs on a corrupted filesystem",
+			fsType: "xfs",
+			output: "meta-data=/dev/sdb               isize=512    agcount=4, agsize=65536 blks\n" +
+				"data     =                       bsize=4096   blocks=262144, imaxpct=25\n" +
+				"xfs_growfs: XFS_IOC_FSGROWFSDATA xfsctl failed: Structure needs cleaning\n",
+			reason: FsResizeReasonFsckRequired,
+		},
+		{
+			name:   "xfs_growfs on an unmounted path",
+			fsType: "xfs",
+			output: "xfs_growfs: /mnt is not a mounted XFS filesystem\n",
+			reason: FsResizeReasonFailed,
+		},
+		{
+			name:   "unsupported filesystem",
+			fsType: "vfat",
+			reason: FsResizeReasonUnsupportedFs,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newCmd := func(output string, err error) testingexec.FakeCommandAction {
+				return func(cmd string, args ...string) utilexec.Cmd {
+					return testingexec.InitFakeCmd(&testingexec.FakeCmd{
+						CombinedOutputScript: []testingexec.FakeAction{
+							func() ([]byte, []byte, error) { return []byte(output), nil, err },
+						},
+					}, cmd, args...)
+				}
+			}
+			fakeExec := &testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{
+				newCmd("DEVNAME=/dev/sdb\nTYPE="+test.fsType+"\n", nil),
+				newCmd(test.output, &testingexec.FakeExitError{Status: 1}),
+			}}
+			_, err := mount.NewResizeFs(fakeExec).Resize("/dev/sdb", "/mnt")
+			if err == nil {
+				t.Fatal("Expected resize to fail")
+			}
+			if reason := getFsResizeFailureReason(err); reason != test.reason {
+				t.Errorf("Expected reason %q, got %q for resize error %q", test.reason, reason, err)
+			}
+		})
+	}
+}
+
+func TestGetBlockDeviceLinkPath(t *testing.T) {
+	tests := []struct {
+		volID, expected string
+	}{
+		{
+			volID:    "5e6f4f8a-1b2c-4d3e-8f9a-0b1c2d3e4f5a",
+			expected: filepath.Join(blockDeviceLinkDir, "5e6f4f8a-1b2c-4d3e-8f9a-0b1c2d3e4f5a"),
+		},
+		{
+			// Volume IDs of migrated volumes hold a VMDK path.
+			volID:    "[vsanDatastore] kubevols/disk-1.vmdk",
+			expected: filepath.Join(blockDeviceLinkDir, "%5BvsanDatastore%5D%20kubevols%2Fdisk-1.vmdk"),
+		},
+	}
+	for _, test := range tests {
+		if got := getBlockDeviceLinkPath(test.volID); got != test.expected {
+			t.Errorf("Expected symlink path %q for volume %q, got %q", test.expected, test.volID, got)
+		}
+	}
+}
+
+func TestGetMountFlags(t *testing.T) {
+	tests := []struct {
+		mode     csi.VolumeCapability_AccessMode_Mode
+		fs       string
+		flags    []string
+		expected []string
+	}{
+		{
+			mode:     csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			fs:       "ext4",
+			flags:    []string{"noatime"},
+			expected: []string{"noatime"},
+		},
+		{
+			// Read-only XFS mounts get "ro" and "nouuid" ahead of the requested flags.
+			mode:     csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY,
+			fs:       "xfs",
+			flags:    []string{"noatime", "nouuid"},
+			expected: []string{"ro", "nouuid", "noatime"},
+		},
+		{
+			// Conflicting "ro" and "rw" resolve to "ro".
+			mode:     csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			fs:       "ext4",
+			flags:    []string{"rw", "ro"},
+			expected: []string{"ro"},
+		},
+		{
+			mode:     csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY,
+			fs:       "ext4",
+			flags:    []string{"rw"},
+			expected: []string{"ro"},
+		},
+	}
+	for i, test := range tests {
+		volCap := &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{FsType: test.fs, MountFlags: test.flags},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: test.mode},
+		}
+		if flags := getMountFlags(volCap, test.fs); !reflect.DeepEqual(flags, test.expected) {
+			t.Errorf("test %d: expected mount flags %v, got %v", i, test.expected, flags)
+		}
+	}
+}
+
+func TestGetSCSIControllerDrivers(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	origScsiHostDir := scsiHostDir
+	scsiHostDir = dir
+	defer func() { scsiHostDir = origScsiHostDir }()
+
+	hosts := map[string]string{
+		"host0": "ata_piix\n",
+		"host1": "vmw_pvscsi\n",
+		"host2": "vmw_pvscsi\n",
+	}
+	for host, procName := range hosts {
+		if err := os.MkdirAll(filepath.Join(dir, host), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, host, "proc_name"), []byte(procName), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A host without proc_name is skipped.
+	if err := os.MkdirAll(filepath.Join(dir, "host3"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	osUtils := &OsUtils{}
+	drivers, err := osUtils.GetSCSIControllerDrivers(ctx)
+	if err != nil {
+		t.Fatalf("GetSCSIControllerDrivers failed: %v", err)
+	}
+	expected := []string{"ata_piix", "vmw_pvscsi", "vmw_pvscsi"}
+	if !reflect.DeepEqual(drivers, expected) {
+		t.Errorf("expected drivers %v, got %v", expected, drivers)
+	}
+}
+
+func TestRemoveSCSIDevice(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	origDevDiskID, origSysBlockDir := devDiskID, sysBlockDir
+	devDiskID = filepath.Join(dir, "by-id")
+	sysBlockDir = filepath.Join(dir, "block")
+	defer func() { devDiskID, sysBlockDir = origDevDiskID, origSysBlockDir }()
+
+	// newStaleDevice simulates the device node, the by-id link and the sysfs
+	// entry of a device, and returns the path of its delete file.
+	newStaleDevice := func(name string, diskUUID string) (*Device, string) {
+		devPath := filepath.Join(dir, name)
+		if err := os.WriteFile(devPath, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(devDiskID, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if diskUUID != "" {
+			if err := os.Symlink(devPath, filepath.Join(devDiskID, blockPrefix+diskUUID)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.MkdirAll(filepath.Join(sysBlockDir, name, "holders"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Join(sysBlockDir, name, "device"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		deleteFile := filepath.Join(sysBlockDir, name, "device", "delete")
+		if err := os.WriteFile(deleteFile, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return &Device{Name: name, FullPath: devPath, RealDev: devPath}, deleteFile
+	}
+	assertDeleteFile := func(deleteFile string, expected string) {
+		content, err := os.ReadFile(deleteFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != expected {
+			t.Errorf("expected %q in %s, got %q", expected, deleteFile, string(content))
+		}
+	}
+
+	osUtils := &OsUtils{}
+	// A stale device of a vSphere virtual disk is removed.
+	dev, deleteFile := newStaleDevice("sdy", "6000c29a1b2c3d4e5f6a7b8c9d0e1f2a")
+	if err := osUtils.removeSCSIDevice(ctx, "vol-1", dev); err != nil {
+		t.Fatalf("removeSCSIDevice failed: %v", err)
+	}
+	assertDeleteFile(deleteFile, "1")
+
+	// A device held by another device, e.g. a device mapper device, is not removed.
+	dev, deleteFile = newStaleDevice("sdz", "6000c29a1b2c3d4e5f6a7b8c9d0e1f2b")
+	if err := os.WriteFile(filepath.Join(sysBlockDir, "sdz", "holders", "dm-0"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := osUtils.removeSCSIDevice(ctx, "vol-2", dev); err != nil {
+		t.Fatalf("removeSCSIDevice failed: %v", err)
+	}
+	assertDeleteFile(deleteFile, "")
+
+	// A device with partitions is not removed.
+	dev, deleteFile = newStaleDevice("sdx", "6000c29a1b2c3d4e5f6a7b8c9d0e1f2c")
+	if err := os.MkdirAll(filepath.Join(sysBlockDir, "sdx", "sdx1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := osUtils.removeSCSIDevice(ctx, "vol-3", dev); err != nil {
+		t.Fatalf("removeSCSIDevice failed: %v", err)
+	}
+	assertDeleteFile(deleteFile, "")
+
+	// A device which is not a vSphere virtual disk is not removed.
+	dev, deleteFile = newStaleDevice("sdw", "")
+	if err := osUtils.removeSCSIDevice(ctx, "vol-4", dev); err != nil {
+		t.Fatalf("removeSCSIDevice failed: %v", err)
+	}
+	assertDeleteFile(deleteFile, "")
+}
+
+func TestPrepareSubPath(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	for _, subPath := range []string{"../escape", "a/../../b", "/abs", "."} {
+		if err := ValidateSubPath(subPath); err == nil {
+			t.Errorf("expected error for subpath %q", subPath)
+		}
+	}
+	if err := ValidateSubPath("team-a/data"); err != nil {
+		t.Fatalf("unexpected error for valid subpath: %v", err)
+	}
+	path, err := prepareSubPath(ctx, root, "team-a/data")
+	if err != nil {
+		t.Fatalf("prepareSubPath failed: %v", err)
+	}
+	if path != filepath.Join(root, "team-a", "data") {
+		t.Errorf("unexpected subpath %q", path)
+	}
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		t.Errorf("expected subpath directory to be created, err: %v", err)
+	}
+	// Existing subdirectories are reused.
+	if _, err := prepareSubPath(ctx, root, "team-a/data"); err != nil {
+		t.Errorf("prepareSubPath failed for existing subpath: %v", err)
+	}
+	if err := os.Symlink(t.TempDir(), filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := prepareSubPath(ctx, root, "link/data"); err == nil {
+		t.Errorf("expected error for subpath through a symbolic link")
+	}
+}
@@ -16,17 +16,61 @@ package osutils
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"k8s.io/mount-utils"
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
 )
 
+// envDefaultFsType is the env variable to set the filesystem a block volume
+// is formatted with when its StorageClass does not specify one. It must be
+// supported by the OS of the node.
+//
+// It only applies when the volume capability arrives without an fsType. The
+// csi-provisioner sets the fsType of volumes whose StorageClass has none to
+// its --default-fstype flag, which the shipped manifests set to ext4, so the
+// flag must be removed from the csi-provisioner for this to take effect.
+const envDefaultFsType = "DEFAULT_FSTYPE"
+
+// XFSProjectQuotaMountOption is the mount option enabling XFS project quota accounting.
+const XFSProjectQuotaMountOption = "prjquota"
+
 type OsUtils struct {
 	Mounter *mount.SafeFormatAndMount
+	// MountTimeout bounds the time spent formatting and mounting a volume
+	// at the staging target during NodeStageVolume.
+	MountTimeout time.Duration
+	// DefaultFsType is the filesystem block volumes are formatted with when
+	// the volume capability does not specify one. The default filesystem of
+	// the OS of the node is used if it is empty.
+	DefaultFsType string
+}
+
+// getDefaultFsType returns the filesystem set in env variable DEFAULT_FSTYPE
+// if it is one of supportedFsTypes, or osDefaultFsType otherwise.
+func getDefaultFsType(ctx context.Context, osDefaultFsType string, supportedFsTypes []string) string {
+	log := logger.GetLogger(ctx)
+	v := strings.ToLower(os.Getenv(envDefaultFsType))
+	if v == "" {
+		return osDefaultFsType
+	}
+	if !slices.Contains(supportedFsTypes, v) {
+		log.Warnf("%s set in env variable %q is not supported on this node, supported filesystems are %v. "+
+			"Will use the default filesystem %q", envDefaultFsType, v, supportedFsTypes, osDefaultFsType)
+		return osDefaultFsType
+	}
+	log.Infof("Default filesystem of block volumes is set to %q", v)
+	return v
 }
 
 // struct to hold params required for NodeStage operation
@@ -41,6 +85,8 @@ type NodeStageParams struct {
 	MntFlags []string
 	// Read-only flag.
 	Ro bool
+	// XFSProjectQuota indicates whether XFS project quota is enforced on the volume.
+	XFSProjectQuota bool
 }
 
 // struct to hold params required for NodePublish operation
@@ -59,6 +105,124 @@ type NodePublishParams struct {
 	Device string
 	// Read-only flag.
 	Ro bool
+	// SubPath is the subdirectory of the volume to publish, relative to the
+	// root of the volume. The whole volume is published if empty.
+	SubPath string
+}
+
+// ValidateSubPath returns an error if the subpath is not a relative path
+// within the volume, e.g. if it contains "..".
+func ValidateSubPath(subPath string) error {
+	if filepath.IsAbs(subPath) || strings.HasPrefix(subPath, "/") || strings.HasPrefix(subPath, "\\") {
+		return fmt.Errorf("subpath %q must be a relative path", subPath)
+	}
+	for _, element := range strings.FieldsFunc(subPath, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if element == ".." {
+			return fmt.Errorf("subpath %q must not contain \"..\"", subPath)
+		}
+	}
+	if cleaned := filepath.Clean(subPath); cleaned == "." {
+		return fmt.Errorf("subpath %q does not denote a subdirectory of the volume", subPath)
+	}
+	return nil
+}
+
+// DeviceSignatureError is returned by NodeStageBlockVolume when the block
+// device of a volume does not carry a signature matching the filesystem the
+// volume is expected to be mounted with, e.g. when its VMDK descriptor or
+// filesystem is corrupted. Such devices are never formatted, to avoid losing
+// the data they may hold.
+type DeviceSignatureError struct {
+	// Device is the path of the block device.
+	Device string
+	// FsType is the filesystem the volume is expected to be mounted with.
+	FsType string
+	// Reason describes the signature found on the device.
+	Reason string
+}
+
+func (e *DeviceSignatureError) Error() string {
+	return fmt.Sprintf("block device %q does not hold a valid %s filesystem: %s. The volume is not formatted "+
+		"to avoid losing its data, check the VMDK backing the volume for corruption", e.Device, e.FsType, e.Reason)
+}
+
+// GRPCStatus returns the gRPC status of the error, so that it is returned as
+// codes.Internal to the CO.
+func (e *DeviceSignatureError) GRPCStatus() *status.Status {
+	return status.New(codes.Internal, e.Error())
+}
+
+// Reasons of a FilesystemResizeError.
+const (
+	// FsResizeReasonFsckRequired is the reason of a resize failing because the
+	// filesystem must be checked first.
+	FsResizeReasonFsckRequired = "FilesystemCheckRequired"
+	// FsResizeReasonUnsupportedFs is the reason of a resize failing because
+	// the filesystem cannot be grown online.
+	FsResizeReasonUnsupportedFs = "UnsupportedFilesystem"
+	// FsResizeReasonFailed is the reason of any other resize failure.
+	FsResizeReasonFailed = "FilesystemResizeFailed"
+)
+
+// FilesystemResizeError is returned by ResizeVolume when the filesystem of a
+// volume could not be grown on the node, while its block device was already
+// expanded by ControllerExpandVolume. Its message, which tells the reason of
+// the failure, is reported by kubelet in the NodeResizeError condition of the
+// volume claim.
+type FilesystemResizeError struct {
+	// Device is the path of the block device.
+	Device string
+	// VolumePath is the path the filesystem is mounted at.
+	VolumePath string
+	// Reason is one of the FsResizeReason constants.
+	Reason string
+	// Err is the error of the resize.
+	Err error
+}
+
+func (e *FilesystemResizeError) Error() string {
+	msg := fmt.Sprintf("%s: failed to resize filesystem on device %s mounted at %s: %v",
+		e.Reason, e.Device, e.VolumePath, e.Err)
+	if e.Reason == FsResizeReasonFsckRequired {
+		msg += fmt.Sprintf(". Check the filesystem with fsck, then annotate the volume claim with %q "+
+			"to retry the expansion", common.AnnRetryNodeExpansion)
+	}
+	return msg
+}
+
+func (e *FilesystemResizeError) Unwrap() error {
+	return e.Err
+}
+
+// GRPCStatus returns the gRPC status of the error. A filesystem which cannot
+// be grown is reported as codes.InvalidArgument, so that kubelet marks the
+// node expansion infeasible instead of retrying it. A filesystem needing a
+// check is reported as codes.FailedPrecondition and retried with backoff.
+func (e *FilesystemResizeError) GRPCStatus() *status.Status {
+	switch e.Reason {
+	case FsResizeReasonFsckRequired:
+		return status.New(codes.FailedPrecondition, e.Error())
+	case FsResizeReasonUnsupportedFs:
+		return status.New(codes.InvalidArgument, e.Error())
+	}
+	return status.New(codes.Internal, e.Error())
+}
+
+// getFsResizeFailureReason returns the reason of the resize error, based on
+// the output of the resize tools. resize2fs asks for e2fsck or reports a
+// corrupt superblock, and xfs_growfs fails with EFSCORRUPTED ("Structure needs
+// cleaning") on a filesystem needing a check. mount-utils reports filesystems
+// it cannot grow as "resize of format <fstype> is not supported".
+func getFsResizeFailureReason(err error) string {
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "fsck") || strings.Contains(msg, "structure needs cleaning") ||
+		strings.Contains(msg, "corrupt"):
+		return FsResizeReasonFsckRequired
+	case strings.Contains(msg, "resize of format") && strings.Contains(msg, "is not supported"):
+		return FsResizeReasonUnsupportedFs
+	}
+	return FsResizeReasonFailed
 }
 
 // Device is a struct for holding details about a block device.
@@ -94,12 +258,51 @@ func (osUtils *OsUtils) EnsureMountVol(ctx context.Context, volCap *csi.VolumeCa
 		return "", nil, err
 	}
 
-	mntFlags := mountVol.GetMountFlags()
+	return fs, getMountFlags(volCap, fs), nil
+}
+
+// getMountFlags returns the mount flags for the given mount volume capability.
+// The flags are resolved in the following order, and each flag is added once:
+//  1. Flags derived from the capability: "ro" for read-only access modes, and
+//     "nouuid" for XFS.
+//  2. Mount options of the StorageClass.
+//  3. Mount options of the PV spec.
+//
+// The mount options of the StorageClass are copied to the PV at provisioning,
+// and the mount options of the PV are passed as the mount flags of the
+// capability, so 2 and 3 are taken together from the capability mount flags.
+// If both "ro" and "rw" are requested, the more restrictive "ro" is kept.
+func getMountFlags(volCap *csi.VolumeCapability, fs string) []string {
+	var capabilityFlags []string
+	if common.IsVolumeReadOnly(volCap) {
+		capabilityFlags = append(capabilityFlags, "ro")
+	}
 	// By default, xfs does not allow mounting of two volumes with the same filesystem uuid.
 	// Force ignore this uuid to be able to mount volume + its clone / restored snapshot on the same node.
 	if fs == common.XFSType {
-		mntFlags = append(mntFlags, "nouuid")
+		capabilityFlags = append(capabilityFlags, "nouuid")
 	}
+	return mergeMountFlags(capabilityFlags, volCap.GetMount().GetMountFlags())
+}
 
-	return fs, mntFlags, nil
+// mergeMountFlags merges the given lists of mount flags in order, skipping
+// duplicates. "rw" is dropped if "ro" is present in any of the lists.
+func mergeMountFlags(flagLists ...[]string) []string {
+	readOnly := false
+	for _, flags := range flagLists {
+		if common.Contains(flags, "ro") {
+			readOnly = true
+			break
+		}
+	}
+	mergedFlags := make([]string, 0)
+	for _, flags := range flagLists {
+		for _, flag := range flags {
+			if (readOnly && flag == "rw") || common.Contains(mergedFlags, flag) {
+				continue
+			}
+			mergedFlags = append(mergedFlags, flag)
+		}
+	}
+	return mergedFlags
 }
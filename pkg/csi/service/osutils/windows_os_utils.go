@@ -22,6 +22,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"unicode"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"google.golang.org/grpc/codes"
@@ -48,7 +49,8 @@ func NewOsUtils(ctx context.Context) (*OsUtils, error) {
 		return nil, err
 	}
 	return &OsUtils{
-		Mounter: mounter,
+		Mounter:       mounter,
+		DefaultFsType: getDefaultFsType(ctx, common.NTFSFsType, []string{common.NTFSFsType}),
 	}, nil
 }
 
@@ -106,6 +108,11 @@ func (osUtils *OsUtils) NodeStageBlockVolume(
 			"failed to get Disk Number, err: %v", err)
 	}
 	log.Infof("nodeStageBlockVolume diskNumber %s, diskId %s,stagingTargetPath %s", diskNumber, diskID, stagingTargetPath)
+	if isDriveLetterPath(stagingTargetPath) {
+		return nil, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"staging target %q is a drive letter, volumes are mounted at a mount point directory on "+
+				"Windows nodes", stagingTargetPath)
+	}
 	mounted, err := osUtils.haveMountPoint(ctx, stagingTargetPath)
 	if err != nil {
 		return nil, err
@@ -125,6 +132,15 @@ func (osUtils *OsUtils) NodeStageBlockVolume(
 	return &csi.NodeStageVolumeResponse{}, nil
 }
 
+// isDriveLetterPath returns true if path is a drive letter, e.g. "D:" or
+// "D:\", rather than a directory a volume can be mounted at. CSI proxy mounts
+// volumes by linking the target directory to the volume, which cannot be done
+// for the root of a drive.
+func isDriveLetterPath(path string) bool {
+	trimmed := strings.TrimRight(path, `\/`)
+	return len(trimmed) == 2 && trimmed[1] == ':' && unicode.IsLetter(rune(trimmed[0]))
+}
+
 func (osUtils *OsUtils) haveMountPoint(ctx context.Context, target string) (bool, error) {
 	log := logger.GetLogger(ctx)
 	mounter, err := GetMounter(ctx, osUtils)
@@ -154,6 +170,12 @@ func (osUtils *OsUtils) haveMountPoint(ctx context.Context, target string) (bool
 	return true, nil
 }
 
+// CleanupCorruptedMount is a no-op on Windows as the staging target is a
+// symlink managed by CSI proxy.
+func (osUtils *OsUtils) CleanupCorruptedMount(ctx context.Context, target string) error {
+	return nil
+}
+
 // CleanupStagePath will unmount the volume from node and remove the stage directory
 func (osUtils *OsUtils) CleanupStagePath(ctx context.Context, stagingTarget string, volID string) error {
 	log := logger.GetLogger(ctx)
@@ -203,8 +225,17 @@ func (osUtils *OsUtils) PublishMountVol(
 	log.Infof("PublishMountVolume called with args: %+v", params)
 
 	source := req.GetStagingTargetPath()
+	if params.SubPath != "" {
+		return nil, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"subpath %q is not supported on Windows nodes", params.SubPath)
+	}
 
 	target := req.GetTargetPath()
+	if isDriveLetterPath(target) {
+		return nil, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"target %q is a drive letter, volumes are published at a mount point directory on "+
+				"Windows nodes", target)
+	}
 
 	err := osUtils.PreparePublishPath(ctx, target)
 	if err != nil {
@@ -221,6 +252,12 @@ func (osUtils *OsUtils) PublishMountVol(
 	return &csi.NodePublishVolumeResponse{}, nil
 }
 
+// RemoveBlockDeviceLink is a no-op on Windows nodes, which do not support raw
+// block volumes.
+func (osUtils *OsUtils) RemoveBlockDeviceLink(ctx context.Context, volID string) error {
+	return nil
+}
+
 // PublishBlockVol mounts raw block device to publish target
 func (osUtils *OsUtils) PublishBlockVol(
 	ctx context.Context,
@@ -358,6 +395,12 @@ func (osUtils *OsUtils) IsTargetInMounts(ctx context.Context, path string) (bool
 	return true, nil
 }
 
+// IsMountReadOnly checks if the given target path is mounted read-only
+// this check is no op for windows
+func (osUtils *OsUtils) IsMountReadOnly(ctx context.Context, target string) (bool, error) {
+	return false, nil
+}
+
 // GetVolumeCapabilityFsType retrieves fstype from VolumeCapability.
 // Defaults to nfs4 for file volume and ntfs for block volume when empty string
 // is observed. This function also ignores default ext4 fstype supplied by
@@ -388,6 +431,11 @@ func (osUtils *OsUtils) GetVolumeCapabilityFsType(ctx context.Context,
 	}
 }
 
+// UpdateXFSProjectQuota does nothing on Windows, where XFS is not supported.
+func (osUtils *OsUtils) UpdateXFSProjectQuota(ctx context.Context, volID, devicePath, volumePath string) error {
+	return nil
+}
+
 // ResizeVolume resizes the volume
 func (osUtils *OsUtils) ResizeVolume(ctx context.Context, devicePath, volumePath string, reqVolSizeBytes int64) error {
 	log := logger.GetLogger(ctx)
@@ -454,6 +502,11 @@ func (osUtils *OsUtils) PreparePublishPath(ctx context.Context, path string) err
 	return nil
 }
 
+// GetSCSIControllerDrivers is not supported on Windows nodes.
+func (osUtils *OsUtils) GetSCSIControllerDrivers(ctx context.Context) ([]string, error) {
+	return nil, fmt.Errorf("detecting SCSI controllers is not supported on windows nodes")
+}
+
 // GetSystemUUID returns the UUID used to identify node vm
 func (osUtils *OsUtils) GetSystemUUID(ctx context.Context) (string, error) {
 	log := logger.GetLogger(ctx)
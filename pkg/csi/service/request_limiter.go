@@ -0,0 +1,240 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/client-go/util/flowcontrol"
+
+	cnsconfig "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/config"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/prometheus"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+)
+
+// requestLimiter bounds the number of requests of an operation served
+// concurrently. Excess requests wait for a slot up to the queue timeout.
+type requestLimiter struct {
+	operation string
+	slots     chan struct{}
+}
+
+var (
+	// requestLimiters holds the limiters of the limited operations, keyed by
+	// the full gRPC method name of their requests.
+	requestLimiters map[string]*requestLimiter
+	// requestQueueTimeout is the time an excess request waits for a slot.
+	requestQueueTimeout time.Duration
+	// snapshotRateLimiter is the token bucket bounding the rate of the
+	// snapshot requests, nil if their rate is not limited.
+	snapshotRateLimiter flowcontrol.RateLimiter
+	// snapshotOpsPerSecond is the rate of snapshotRateLimiter.
+	snapshotOpsPerSecond float64
+	// requestLimitersLock is used to serialize access to requestLimiters,
+	// requestQueueTimeout, snapshotRateLimiter and snapshotOpsPerSecond.
+	requestLimitersLock sync.RWMutex
+
+	// snapshotMethods are the full gRPC method names of the snapshot requests.
+	snapshotMethods = []string{"/csi.v1.Controller/CreateSnapshot", "/csi.v1.Controller/DeleteSnapshot"}
+	// snapshotOpsRate measures the rate of the admitted snapshot requests
+	// while their rate is limited.
+	snapshotOpsRate = &opsRateTracker{window: time.Minute}
+	// snapshotOpsRateReporterOnce starts the periodic report of
+	// snapshotOpsRate once, when the rate of the snapshot requests is first
+	// limited.
+	snapshotOpsRateReporterOnce sync.Once
+)
+
+// opsRateTracker measures the rate of operations over a sliding window.
+type opsRateTracker struct {
+	window time.Duration
+	mux    sync.Mutex
+	times  []time.Time
+}
+
+// record records an operation at the given time and returns the rate of the
+// operations per second over the window.
+func (t *opsRateTracker) record(now time.Time) float64 {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.times = append(t.times, now)
+	return t.rateLocked(now)
+}
+
+// rate returns the rate of the operations per second over the window ending
+// at the given time.
+func (t *opsRateTracker) rate(now time.Time) float64 {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	return t.rateLocked(now)
+}
+
+func (t *opsRateTracker) rateLocked(now time.Time) float64 {
+	start := now.Add(-t.window)
+	i := 0
+	for i < len(t.times) && !t.times[i].After(start) {
+		i++
+	}
+	t.times = t.times[i:]
+	return float64(len(t.times)) / t.window.Seconds()
+}
+
+// configureRequestLimiters sets the concurrency limits of the controller
+// operations from the config. Operations whose limit is not set are not
+// limited. It is only called when the driver starts, so changes of the limits
+// in the config take effect once the controller is restarted.
+func configureRequestLimiters(ctx context.Context, cfg *cnsconfig.Config) {
+	log := logger.GetLogger(ctx)
+	limiters := make(map[string]*requestLimiter)
+	addLimiter := func(operation string, limit int, methods ...string) {
+		if limit <= 0 {
+			return
+		}
+		limiter := &requestLimiter{operation: operation, slots: make(chan struct{}, limit)}
+		for _, method := range methods {
+			limiters[method] = limiter
+		}
+		log.Infof("At most %d %s requests are served concurrently", limit, operation)
+	}
+	addLimiter("create-volume", cfg.Global.MaxConcurrentCreateVolumeRequests, "/csi.v1.Controller/CreateVolume")
+	addLimiter("delete-volume", cfg.Global.MaxConcurrentDeleteVolumeRequests, "/csi.v1.Controller/DeleteVolume")
+	addLimiter("attach", cfg.Global.MaxConcurrentAttachRequests, "/csi.v1.Controller/ControllerPublishVolume")
+	addLimiter("detach", cfg.Global.MaxConcurrentDetachRequests, "/csi.v1.Controller/ControllerUnpublishVolume")
+	addLimiter("snapshot", cfg.Global.MaxConcurrentSnapshotRequests, snapshotMethods...)
+
+	var rateLimiter flowcontrol.RateLimiter
+	opsPerSecond := cfg.Global.MaxSnapshotOpsPerSecond
+	if opsPerSecond > 0 {
+		burst := cfg.Global.SnapshotOpsBurst
+		if burst <= 0 {
+			burst = int(math.Ceil(opsPerSecond))
+		}
+		rateLimiter = flowcontrol.NewTokenBucketRateLimiter(float32(opsPerSecond), burst)
+		log.Infof("Snapshot requests are served at most at %g per second with a burst of %d", opsPerSecond, burst)
+		snapshotOpsRateReporterOnce.Do(func() {
+			go reportSnapshotOpsRate()
+		})
+	}
+
+	requestLimitersLock.Lock()
+	defer requestLimitersLock.Unlock()
+	requestLimiters = limiters
+	requestQueueTimeout = time.Duration(max(cfg.Global.RequestQueueTimeoutInSec, 0)) * time.Second
+	snapshotRateLimiter = rateLimiter
+	snapshotOpsPerSecond = opsPerSecond
+}
+
+// reportSnapshotOpsRate periodically reports the rate of the admitted
+// snapshot requests, so that the metric decays once the requests stop.
+func reportSnapshotOpsRate() {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		prometheus.CsiSnapshotOpsRate.Set(snapshotOpsRate.rate(now))
+	}
+}
+
+// admitSnapshotRequest takes a token from the bucket of the snapshot requests
+// and records the request in their rate, if their rate is limited.
+// codes.Aborted is returned if the bucket is empty, so that the snapshotter
+// retries the request with back-off.
+func admitSnapshotRequest() error {
+	requestLimitersLock.RLock()
+	limiter, opsPerSecond := snapshotRateLimiter, snapshotOpsPerSecond
+	requestLimitersLock.RUnlock()
+	if limiter == nil {
+		return nil
+	}
+	if !limiter.TryAccept() {
+		return status.Errorf(codes.Aborted, "snapshot requests exceed the rate limit of %g per second, "+
+			"retry later", opsPerSecond)
+	}
+	prometheus.CsiSnapshotOpsRate.Set(snapshotOpsRate.record(time.Now()))
+	return nil
+}
+
+// getRequestLimiter returns the limiter of the given gRPC method and the
+// queue timeout, or nil if the method is not limited.
+func getRequestLimiter(method string) (*requestLimiter, time.Duration) {
+	requestLimitersLock.RLock()
+	defer requestLimitersLock.RUnlock()
+	return requestLimiters[method], requestQueueTimeout
+}
+
+// acquire waits up to queueTimeout for a slot and returns the function
+// releasing it. codes.ResourceExhausted is returned if no slot is free in
+// time, so that the sidecar retries the request with back-off.
+func (l *requestLimiter) acquire(ctx context.Context, queueTimeout time.Duration) (func(), error) {
+	release := func() {
+		<-l.slots
+		prometheus.CsiInFlightRequests.WithLabelValues(l.operation).Dec()
+	}
+	select {
+	case l.slots <- struct{}{}:
+		prometheus.CsiInFlightRequests.WithLabelValues(l.operation).Inc()
+		return release, nil
+	default:
+	}
+	if queueTimeout > 0 {
+		timer := time.NewTimer(queueTimeout)
+		defer timer.Stop()
+		select {
+		case l.slots <- struct{}{}:
+			prometheus.CsiInFlightRequests.WithLabelValues(l.operation).Inc()
+			return release, nil
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		case <-timer.C:
+		}
+	}
+	prometheus.CsiRejectedRequestCount.WithLabelValues(l.operation).Inc()
+	return nil, status.Errorf(codes.ResourceExhausted, "too many concurrent %s requests, at most %d are served "+
+		"concurrently, retry later", l.operation, cap(l.slots))
+}
+
+// requestLimitInterceptor bounds the rate of the snapshot requests and the
+// number of requests of the limited operations served concurrently, to
+// protect vCenter from request stampedes.
+func requestLimitInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	log := logger.GetLogger(ctx)
+	// Acquire the concurrency slot first, so that requests rejected for
+	// exceeding the concurrency limit do not use up the rate of the snapshot
+	// requests.
+	if limiter, queueTimeout := getRequestLimiter(info.FullMethod); limiter != nil {
+		release, err := limiter.acquire(ctx, queueTimeout)
+		if err != nil {
+			log.Warnf("%s: %v", info.FullMethod, err)
+			return nil, err
+		}
+		defer release()
+	}
+	if slices.Contains(snapshotMethods, info.FullMethod) {
+		if err := admitSnapshotRequest(); err != nil {
+			log.Warnf("%s: %v", info.FullMethod, err)
+			return nil, err
+		}
+	}
+	return handler(ctx, req)
+}
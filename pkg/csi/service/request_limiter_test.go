@@ -0,0 +1,130 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	cnsconfig "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/config"
+)
+
+func TestAdmitSnapshotRequest(t *testing.T) {
+	ctx := context.Background()
+	defer configureRequestLimiters(ctx, &cnsconfig.Config{})
+
+	// Snapshot requests are not limited by default.
+	configureRequestLimiters(ctx, &cnsconfig.Config{})
+	for i := 0; i < 10; i++ {
+		if err := admitSnapshotRequest(); err != nil {
+			t.Fatalf("expected snapshot request %d to be admitted without a rate limit, got %v", i, err)
+		}
+	}
+
+	// A burst of 2 requests is admitted at a rate too low to refill the
+	// bucket during the test, the next request is aborted.
+	cfg := &cnsconfig.Config{}
+	cfg.Global.MaxSnapshotOpsPerSecond = 0.001
+	cfg.Global.SnapshotOpsBurst = 2
+	configureRequestLimiters(ctx, cfg)
+	for i := 0; i < cfg.Global.SnapshotOpsBurst; i++ {
+		if err := admitSnapshotRequest(); err != nil {
+			t.Fatalf("expected snapshot request %d of the burst to be admitted, got %v", i, err)
+		}
+	}
+	err := admitSnapshotRequest()
+	if status.Code(err) != codes.Aborted {
+		t.Errorf("expected the snapshot request above the rate limit to be aborted, got %v", err)
+	}
+}
+
+func TestOpsRateTracker(t *testing.T) {
+	tracker := &opsRateTracker{window: 10 * time.Second}
+	start := time.Now()
+	tracker.record(start)
+	tracker.record(start.Add(time.Second))
+	if rate := tracker.record(start.Add(5 * time.Second)); rate != 0.3 {
+		t.Errorf("expected a rate of 0.3 operations per second, got %v", rate)
+	}
+	// The operations older than the window slide out of the rate.
+	if rate := tracker.rate(start.Add(10 * time.Second)); rate != 0.2 {
+		t.Errorf("expected a rate of 0.2 operations per second, got %v", rate)
+	}
+	if rate := tracker.rate(start.Add(15 * time.Second)); rate != 0 {
+		t.Errorf("expected a rate of 0 operations per second, got %v", rate)
+	}
+	if len(tracker.times) != 0 {
+		t.Errorf("expected the operations out of the window to be dropped, got %d", len(tracker.times))
+	}
+}
+
+func TestRequestLimiterAcquire(t *testing.T) {
+	ctx := context.Background()
+	limiter := &requestLimiter{operation: "test", slots: make(chan struct{}, 1)}
+	release, err := limiter.acquire(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := limiter.acquire(ctx, 10*time.Millisecond); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected the request above the limit to be rejected, got %v", err)
+	}
+	release()
+	release, err = limiter.acquire(ctx, 0)
+	if err != nil {
+		t.Fatalf("expected the released slot to be acquired, got %v", err)
+	}
+	release()
+}
+
+func TestRequestLimitInterceptorChecksConcurrencyFirst(t *testing.T) {
+	ctx := context.Background()
+	defer configureRequestLimiters(ctx, &cnsconfig.Config{})
+	cfg := &cnsconfig.Config{}
+	cfg.Global.MaxConcurrentSnapshotRequests = 1
+	cfg.Global.MaxSnapshotOpsPerSecond = 0.001
+	cfg.Global.SnapshotOpsBurst = 1
+	configureRequestLimiters(ctx, cfg)
+	info := &grpc.UnaryServerInfo{FullMethod: "/csi.v1.Controller/CreateSnapshot"}
+
+	// The only slot is held by a request in flight.
+	limiter, _ := getRequestLimiter(info.FullMethod)
+	release, err := limiter.acquire(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	if _, err := requestLimitInterceptor(ctx, nil, info, handler); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected the request above the concurrency limit to be rejected, got %v", err)
+	}
+	release()
+
+	// The rejected request did not take the only token of the bucket.
+	resp, err := requestLimitInterceptor(ctx, nil, info, handler)
+	if err != nil || resp != "ok" {
+		t.Fatalf("expected the request to be served, got %v, %v", resp, err)
+	}
+	if _, err := requestLimitInterceptor(ctx, nil, info, handler); status.Code(err) != codes.Aborted {
+		t.Errorf("expected the request above the rate limit to be aborted, got %v", err)
+	}
+}
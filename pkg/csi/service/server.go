@@ -17,20 +17,33 @@ limitations under the License.
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net"
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
 
+	cnsvolume "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/volume"
+	csifault "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/fault"
 	csitypes "sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/types"
 )
 
 var (
-	stopOnce sync.Once
+	gracefulStopOnce sync.Once
+	stopOnce         sync.Once
 )
 
 // NonBlockingGRPCServer defines non-blocking GRPC server interfaces.
@@ -46,18 +59,29 @@ type NonBlockingGRPCServer interface {
 
 	// GracefulStop stops the gRPC server gracefully. It stops the server
 	// from accepting new connections and RPCs and blocks until all the
-	// pending RPCs are finished.
+	// pending RPCs are finished. A subsequent Stop cancels the pending RPCs.
 	GracefulStop()
+
+	// SetServing sets the status reported by the gRPC health service to
+	// SERVING or NOT_SERVING.
+	SetServing(serving bool)
 }
 
 // NewNonBlockingGRPCServer returns an instance of nonBlockingGRPCServer.
+// The gRPC health service reports NOT_SERVING until SetServing is called.
 func NewNonBlockingGRPCServer() NonBlockingGRPCServer {
-	return &nonBlockingGRPCServer{}
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	return &nonBlockingGRPCServer{health: healthServer}
 }
 
 // nonBlockingGRPCServer implements the interface NonBlockingGRPCServer.
 type nonBlockingGRPCServer struct {
+	// mutex guards server, which is set by serve while Stop and GracefulStop
+	// may be called concurrently, e.g. on a signal.
+	mutex  sync.Mutex
 	server *grpc.Server
+	health *health.Server
 }
 
 func (s *nonBlockingGRPCServer) Start(endpoint string, ids csi.IdentityServer,
@@ -70,24 +94,40 @@ func (s *nonBlockingGRPCServer) Start(endpoint string, ids csi.IdentityServer,
 
 func (s *nonBlockingGRPCServer) GracefulStop() {
 	log := logger.GetLoggerWithNoContext()
-	stopOnce.Do(func() {
-		if s.server != nil {
-			s.server.GracefulStop()
+	gracefulStopOnce.Do(func() {
+		s.health.Shutdown()
+		if server := s.getServer(); server != nil {
+			server.GracefulStop()
 		}
 		log.Info("gracefully stopped")
 	})
 }
 
+func (s *nonBlockingGRPCServer) SetServing(serving bool) {
+	servingStatus := healthpb.HealthCheckResponse_NOT_SERVING
+	if serving {
+		servingStatus = healthpb.HealthCheckResponse_SERVING
+	}
+	s.health.SetServingStatus("", servingStatus)
+}
+
 func (s *nonBlockingGRPCServer) Stop() {
 	log := logger.GetLoggerWithNoContext()
 	stopOnce.Do(func() {
-		if s.server != nil {
-			s.server.Stop()
+		if server := s.getServer(); server != nil {
+			server.Stop()
 		}
 		log.Info("stopped")
 	})
 }
 
+// getServer returns the gRPC server, or nil if it is not created yet.
+func (s *nonBlockingGRPCServer) getServer() *grpc.Server {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.server
+}
+
 func (s *nonBlockingGRPCServer) serve(endpoint string, ids csi.IdentityServer,
 	cs csi.ControllerServer, ns csi.NodeServer) error {
 	log := logger.GetLoggerWithNoContext()
@@ -113,8 +153,11 @@ func (s *nonBlockingGRPCServer) serve(endpoint string, ids csi.IdentityServer,
 		return logger.LogNewErrorf(log, "failed to listen: %v", err)
 	}
 
-	server := grpc.NewServer()
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(slowOperationInterceptor, requestLimitInterceptor,
+		cnsTaskErrorInterceptor, contextErrorInterceptor))
+	s.mutex.Lock()
 	s.server = server
+	s.mutex.Unlock()
 
 	// Register the CSI services.
 	// Always require the identity service.
@@ -127,7 +170,7 @@ func (s *nonBlockingGRPCServer) serve(endpoint string, ids csi.IdentityServer,
 	}
 
 	// Always register the identity service.
-	csi.RegisterIdentityServer(s.server, ids)
+	csi.RegisterIdentityServer(server, ids)
 	log.Info("identity service registered")
 
 	// Determine which of the controller/node services to register.
@@ -136,19 +179,29 @@ func (s *nonBlockingGRPCServer) serve(endpoint string, ids csi.IdentityServer,
 		if cs == nil {
 			return logger.LogNewError(log, "controller service required when running in controller mode")
 		}
-		csi.RegisterControllerServer(s.server, cs)
+		csi.RegisterControllerServer(server, cs)
 		log.Info("controller service registered")
+		if gcs, ok := cs.(csi.GroupControllerServer); ok {
+			csi.RegisterGroupControllerServer(server, gcs)
+			log.Info("group controller service registered")
+		}
 	} else if strings.EqualFold(mode, "node") {
 		if ns == nil {
 			return logger.LogNewError(log, "node service required when running in node mode")
 		}
-		csi.RegisterNodeServer(s.server, ns)
+		csi.RegisterNodeServer(server, ns)
 		log.Info("node service registered")
 	} else {
 		return logger.LogNewErrorf(log, "invalid value %q specified for %s, expecting 'node' or 'controller'",
 			mode, csitypes.EnvVarMode)
 	}
 
+	// Register the health and reflection services, for liveness probes and
+	// for debugging with grpcurl.
+	healthpb.RegisterHealthServer(server, s.health)
+	reflection.Register(server)
+	log.Info("health and reflection services registered")
+
 	log.Infof("Listening for connections on address: %s", listener.Addr())
 	if err := server.Serve(listener); err != nil {
 		log.Errorf("failed to serve: %v", err)
@@ -156,3 +209,145 @@ func (s *nonBlockingGRPCServer) serve(endpoint string, ids csi.IdentityServer,
 	}
 	return nil
 }
+
+// contextErrorInterceptor returns codes.DeadlineExceeded or codes.Canceled for
+// the requests failing because the deadline of the caller, e.g. the sidecar,
+// has expired or the caller has cancelled the request. The deadline of the
+// caller is propagated by gRPC into the context of the request, which is
+// passed down to the CNS calls, so that the driver stops waiting on vCenter
+// tasks once the caller has given up on the request. The requests failing for
+// another reason, e.g. a terminal CNS task fault, keep their code even if the
+// failure is reported after the deadline.
+func contextErrorInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if err == nil {
+		return resp, nil
+	}
+	switch status.Code(err) {
+	case codes.DeadlineExceeded, codes.Canceled:
+		return resp, err
+	}
+	if taskErr := cnsvolume.LastCnsTaskError(ctx); taskErr != nil && !errors.Is(taskErr, cnsvolume.ErrCnsTaskStuck) {
+		return resp, err
+	}
+	if isContextError(ctx, err, context.DeadlineExceeded) {
+		return resp, status.Error(codes.DeadlineExceeded, errorMessage(err))
+	}
+	if isContextError(ctx, err, context.Canceled) {
+		return resp, status.Error(codes.Canceled, errorMessage(err))
+	}
+	return resp, err
+}
+
+// isContextError returns true if err was caused by ctxErr, either wrapping it
+// or, once converted into a gRPC status, carrying its message while ctx has
+// failed with it.
+func isContextError(ctx context.Context, err error, ctxErr error) bool {
+	if errors.Is(err, ctxErr) {
+		return true
+	}
+	return errors.Is(ctx.Err(), ctxErr) && strings.Contains(errorMessage(err), ctxErr.Error())
+}
+
+// cnsTaskErrorDomain is the domain of the ErrorInfo details attached to the
+// errors of the requests failing because of a CNS task.
+const cnsTaskErrorDomain = "cns.vmware.com"
+
+// cnsTaskErrorInterceptor attaches the references of the CNS task which made
+// the request fail, i.e. the task ID and the fault type, to the gRPC status
+// returned for the request, both in its message and as ErrorInfo details, so
+// that operators can look the task up in vCenter. The code of the status is
+// replaced with the classification of the fault type if the service returned
+// a generic codes.Internal or codes.Unknown.
+func cnsTaskErrorInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	ctx = cnsvolume.ContextWithCnsTaskErrorRecorder(ctx)
+	resp, err := handler(ctx, req)
+	if err == nil {
+		return resp, nil
+	}
+	taskErr := cnsvolume.LastCnsTaskError(ctx)
+	if taskErr == nil {
+		return resp, err
+	}
+	st := status.Convert(err)
+	msg := st.Message()
+	if !strings.Contains(msg, taskErr.TaskID) {
+		msg = fmt.Sprintf("%s [CNS task: %s, fault: %s]", msg, taskErr.TaskID, taskErr.FaultType)
+	}
+	code, reason := csifault.ClassifyFaultCode(taskErr.FaultType, st.Code()), "CNS_TASK_FAILED"
+	if errors.Is(taskErr, cnsvolume.ErrCnsTaskStuck) {
+		// The operation is retried by the sidecar, and handled idempotently.
+		code, reason = codes.Unavailable, "CNS_TASK_STUCK"
+	}
+	st = status.New(code, msg)
+	metadata := map[string]string{"taskID": taskErr.TaskID}
+	if taskErr.OpID != "" {
+		metadata["opID"] = taskErr.OpID
+	}
+	if taskErr.VolumeID != "" {
+		metadata["volumeID"] = taskErr.VolumeID
+	}
+	if taskErr.FaultType != "" {
+		metadata["faultType"] = taskErr.FaultType
+	}
+	stWithDetails, detailsErr := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   cnsTaskErrorDomain,
+		Metadata: metadata,
+	})
+	if detailsErr != nil {
+		return resp, st.Err()
+	}
+	return resp, stWithDetails.Err()
+}
+
+// slowOperationInterceptor logs the requests taking longer than the slow
+// operation threshold at warning level, independent of the log level of the
+// driver, with the volume and the IDs of the CNS tasks of the request, so that
+// the slowness of vCenter can be spotted without enabling debug logs.
+func slowOperationInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	threshold := cnsvolume.GetSlowOperationThreshold()
+	if threshold == 0 {
+		return handler(ctx, req)
+	}
+	ctx = cnsvolume.ContextWithCnsTaskIDs(ctx)
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	elapsed := time.Since(start)
+	if elapsed >= threshold {
+		log := logger.GetLogger(ctx)
+		log.Warnf("Slow operation: %s for volume %q took %v, above the threshold of %v. CNS tasks: %v, "+
+			"status: %s", info.FullMethod, getRequestVolumeID(req, resp), elapsed.Round(time.Millisecond),
+			threshold, cnsvolume.GetCnsTaskIDs(ctx), status.Code(err))
+	}
+	return resp, err
+}
+
+// getRequestVolumeID returns the ID of the volume of the CSI request, or the
+// name of the volume to be created if its ID is not known.
+func getRequestVolumeID(req interface{}, resp interface{}) string {
+	switch r := req.(type) {
+	case *csi.CreateVolumeRequest:
+		if createResp, ok := resp.(*csi.CreateVolumeResponse); ok && createResp.GetVolume() != nil {
+			return createResp.GetVolume().GetVolumeId()
+		}
+		return r.GetName()
+	case interface{ GetVolumeId() string }:
+		return r.GetVolumeId()
+	case interface{ GetSourceVolumeId() string }:
+		return r.GetSourceVolumeId()
+	}
+	return ""
+}
+
+// errorMessage returns the message of the gRPC status of the error, or the
+// error string if the error does not carry a gRPC status.
+func errorMessage(err error) string {
+	if st, ok := status.FromError(err); ok {
+		return st.Message()
+	}
+	return err.Error()
+}
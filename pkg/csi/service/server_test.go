@@ -0,0 +1,82 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestContextErrorInterceptor(t *testing.T) {
+	expiredCtx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	<-expiredCtx.Done()
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		err      error
+		expected codes.Code
+	}{
+		{
+			name:     "wrapped deadline error",
+			ctx:      context.Background(),
+			err:      fmt.Errorf("failed to wait for task: %w", context.DeadlineExceeded),
+			expected: codes.DeadlineExceeded,
+		},
+		{
+			name:     "converted deadline error after the deadline",
+			ctx:      expiredCtx,
+			err:      status.Error(codes.Internal, "failed to create volume: context deadline exceeded"),
+			expected: codes.DeadlineExceeded,
+		},
+		{
+			name:     "converted cancellation error after cancellation",
+			ctx:      cancelledCtx,
+			err:      status.Error(codes.Internal, "failed to create volume: context canceled"),
+			expected: codes.Canceled,
+		},
+		{
+			name:     "terminal error after the deadline",
+			ctx:      expiredCtx,
+			err:      status.Error(codes.NotFound, "volume not found"),
+			expected: codes.NotFound,
+		},
+		{
+			name:     "internal error after the deadline",
+			ctx:      expiredCtx,
+			err:      status.Error(codes.Internal, "failed to create volume: vim.fault.NotEnoughLicenses"),
+			expected: codes.Internal,
+		},
+	}
+	for _, test := range tests {
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, test.err
+		}
+		_, err := contextErrorInterceptor(test.ctx, nil, &grpc.UnaryServerInfo{}, handler)
+		if code := status.Code(err); code != test.expected {
+			t.Errorf("%s: expected code %v, got %v", test.name, test.expected, code)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vanilla
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/utils"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/types"
+	k8s "sigs.k8s.io/vsphere-csi-driver/v3/pkg/kubernetes"
+)
+
+// defaultOrphanedAttachmentConfirmationWindow is the time for which a volume
+// must stay attached to a node VM with no VolumeAttachment before it is
+// detached, if no window is configured.
+const defaultOrphanedAttachmentConfirmationWindow = 10 * time.Minute
+
+// volumeAttachmentKey identifies the attachment of a volume to a node VM.
+type volumeAttachmentKey struct {
+	volumeID   string
+	nodeVMUUID string
+}
+
+// attachmentDrift holds the differences between the attachments of block
+// volumes reported by VolumeAttachments and the disks of the node VMs.
+type attachmentDrift struct {
+	// missing are the attachments of VolumeAttachments reported attached,
+	// whose volume is not attached to the node VM.
+	missing []volumeAttachmentKey
+	// orphaned are the attachments of volumes of the cluster to node VMs
+	// with no VolumeAttachment.
+	orphaned map[volumeAttachmentKey]bool
+}
+
+// getAttachmentDrift compares the attachments of VolumeAttachments, mapped to
+// whether they are reported attached, with the attachments of the disks of
+// the node VMs. Disks which are not volumes of the cluster, volumes with no
+// PV, e.g. CSI ephemeral inline volumes attached by the node plugin, and
+// volumes with a VolumeAttachment whose node VM is not known, are never
+// reported orphaned.
+func getAttachmentDrift(vaAttachments map[volumeAttachmentKey]bool, unresolvedVolumes map[string]bool,
+	vmAttachments map[volumeAttachmentKey]bool, clusterVolumes map[string]bool,
+	pvVolumes map[string]bool) attachmentDrift {
+	drift := attachmentDrift{orphaned: make(map[volumeAttachmentKey]bool)}
+	for key, attached := range vaAttachments {
+		if attached && !vmAttachments[key] {
+			drift.missing = append(drift.missing, key)
+		}
+	}
+	for key := range vmAttachments {
+		if _, ok := vaAttachments[key]; ok || !clusterVolumes[key.volumeID] || !pvVolumes[key.volumeID] ||
+			unresolvedVolumes[key.volumeID] {
+			continue
+		}
+		drift.orphaned[key] = true
+	}
+	return drift
+}
+
+// reconcileAttachments repairs, once the replica becomes the leader, the
+// attachments left inconsistent by a controller which crashed between
+// attaching or detaching a volume in CNS and the VolumeAttachment being
+// updated. Volumes whose VolumeAttachment is reported attached are attached
+// again right away. Volumes attached with no VolumeAttachment are detached
+// only if they are still orphaned after the confirmation window, so that a
+// VolumeAttachment created in the meantime is not raced.
+func (c *controller) reconcileAttachments(ctx context.Context, confirmationWindow time.Duration) {
+	log := logger.GetLogger(ctx)
+	orphaned := c.reconcileAttachmentsOnce(ctx, nil)
+	if len(orphaned) == 0 {
+		return
+	}
+	log.Infof("Found %d attachment(s) of volumes with no VolumeAttachment, detaching the ones still orphaned "+
+		"in %v", len(orphaned), confirmationWindow)
+	select {
+	case <-ctx.Done():
+		log.Infof("Stopped reconciling attachments before detaching the orphaned attachments")
+		return
+	case <-time.After(confirmationWindow):
+	}
+	c.reconcileAttachmentsOnce(ctx, orphaned)
+}
+
+// reconcileAttachmentsOnce attaches the volumes whose VolumeAttachment is
+// reported attached but which are not attached to the node VM, and detaches
+// the orphaned attachments which were also orphaned in confirmed. The
+// orphaned attachments found are returned.
+func (c *controller) reconcileAttachmentsOnce(ctx context.Context,
+	confirmed map[volumeAttachmentKey]bool) map[volumeAttachmentKey]bool {
+	log := logger.GetLogger(ctx)
+	k8sClient, err := k8s.NewClient(ctx)
+	if err != nil {
+		log.Errorf("failed to create k8s client to reconcile attachments. Error: %+v", err)
+		return nil
+	}
+	pvList, err := k8sClient.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		log.Errorf("failed to list PVs to reconcile attachments. Error: %+v", err)
+		return nil
+	}
+	pvs := make(map[string]*v1.PersistentVolume)
+	pvVolumes := make(map[string]bool)
+	for i := range pvList.Items {
+		pv := &pvList.Items[i]
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == csitypes.Name {
+			pvs[pv.Name] = pv
+			pvVolumes[pv.Spec.CSI.VolumeHandle] = true
+		}
+	}
+	vaList, err := k8sClient.StorageV1().VolumeAttachments().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		log.Errorf("failed to list VolumeAttachments to reconcile attachments. Error: %+v", err)
+		return nil
+	}
+	nodeVMs, err := c.nodeMgr.GetAllNodes(ctx)
+	if err != nil {
+		log.Errorf("failed to get node VMs to reconcile attachments. Error: %+v", err)
+		return nil
+	}
+	nodeVMsByUUID := make(map[string]*cnsvsphere.VirtualMachine, len(nodeVMs))
+	for _, nodeVM := range nodeVMs {
+		nodeVMsByUUID[nodeVM.UUID] = nodeVM
+	}
+	vmAttachments, err := c.getNodeVMAttachments(ctx, nodeVMs)
+	if err != nil {
+		log.Errorf("failed to get volumes attached to node VMs to reconcile attachments. Error: %+v", err)
+		return nil
+	}
+	queryResult, err := utils.QueryAllVolumesForCluster(ctx, c.manager.VolumeManager,
+		c.manager.CnsConfig.Global.ClusterID, cnstypes.CnsQuerySelection{})
+	if err != nil {
+		log.Errorf("failed to query volumes to reconcile attachments. Error: %+v", err)
+		return nil
+	}
+	clusterVolumes := make(map[string]bool, len(queryResult.Volumes))
+	for _, volume := range queryResult.Volumes {
+		if volume.VolumeType == common.BlockVolumeType {
+			clusterVolumes[volume.VolumeId.Id] = true
+		}
+	}
+
+	vaAttachments := make(map[volumeAttachmentKey]bool)
+	unresolvedVolumes := make(map[string]bool)
+	volumePVs := make(map[string]*v1.PersistentVolume)
+	for _, va := range vaList.Items {
+		if va.Spec.Attacher != csitypes.Name || va.Spec.Source.PersistentVolumeName == nil {
+			continue
+		}
+		pv, ok := pvs[*va.Spec.Source.PersistentVolumeName]
+		if !ok || !clusterVolumes[pv.Spec.CSI.VolumeHandle] {
+			continue
+		}
+		volumeID := pv.Spec.CSI.VolumeHandle
+		volumePVs[volumeID] = pv
+		nodeVM, err := c.nodeMgr.GetNodeVMByNameOrUUID(ctx, va.Spec.NodeName)
+		if err != nil {
+			log.Warnf("failed to find VM of node %q of VolumeAttachment %q, skipping the attachments of "+
+				"volume %q. Error: %+v", va.Spec.NodeName, va.Name, volumeID, err)
+			unresolvedVolumes[volumeID] = true
+			continue
+		}
+		key := volumeAttachmentKey{volumeID: volumeID, nodeVMUUID: nodeVM.UUID}
+		vaAttachments[key] = va.Status.Attached && va.DeletionTimestamp == nil
+		nodeVMsByUUID[nodeVM.UUID] = nodeVM
+	}
+
+	drift := getAttachmentDrift(vaAttachments, unresolvedVolumes, vmAttachments, clusterVolumes, pvVolumes)
+	for _, key := range drift.missing {
+		nodeVM := nodeVMsByUUID[key.nodeVMUUID]
+		log.Infof("Volume %q is reported attached to node VM %v by its VolumeAttachment but is not attached "+
+			"to it, attaching it", key.volumeID, nodeVM)
+		releaseAttachSlot, err := acquireAttachSlot(ctx, nodeVM)
+		if err != nil {
+			log.Errorf("failed to attach volume %q to node VM %v. Error: %+v", key.volumeID, nodeVM, err)
+			continue
+		}
+		if pv := volumePVs[key.volumeID]; isMultiWriterBlockPV(pv) {
+			_, _, err = common.AttachMultiWriterVolumeUtil(ctx, c.manager.VolumeManager, nodeVM, key.volumeID,
+				0, -1)
+		} else {
+			_, _, err = common.AttachVolumeUtil(ctx, c.manager.VolumeManager, nodeVM, key.volumeID, false)
+		}
+		releaseAttachSlot()
+		if err != nil {
+			log.Errorf("failed to attach volume %q to node VM %v. Error: %+v", key.volumeID, nodeVM, err)
+			continue
+		}
+		log.Infof("Attached volume %q to node VM %v as reported by its VolumeAttachment", key.volumeID, nodeVM)
+	}
+	for key := range drift.orphaned {
+		nodeVM := nodeVMsByUUID[key.nodeVMUUID]
+		if !confirmed[key] {
+			log.Warnf("Volume %q is attached to node VM %v with no VolumeAttachment", key.volumeID, nodeVM)
+			continue
+		}
+		log.Infof("Volume %q is still attached to node VM %v with no VolumeAttachment, detaching it",
+			key.volumeID, nodeVM)
+		releaseDetachSlots, err := acquireDetachSlots(ctx, nodeVM)
+		if err != nil {
+			log.Errorf("failed to detach volume %q from node VM %v. Error: %+v", key.volumeID, nodeVM, err)
+			continue
+		}
+		detached, err := c.manager.VolumeManager.DetachMultiWriterDisk(ctx, nodeVM, key.volumeID)
+		if err == nil && !detached {
+			_, err = common.DetachVolumeUtil(ctx, c.manager.VolumeManager, nodeVM, key.volumeID)
+		}
+		releaseDetachSlots()
+		if err != nil {
+			log.Errorf("failed to detach volume %q from node VM %v. Error: %+v", key.volumeID, nodeVM, err)
+			continue
+		}
+		log.Infof("Detached orphaned attachment of volume %q from node VM %v", key.volumeID, nodeVM)
+	}
+	return drift.orphaned
+}
+
+// getNodeVMAttachments returns the attachments of the volumes attached to
+// the given node VMs.
+func (c *controller) getNodeVMAttachments(ctx context.Context,
+	nodeVMs []*cnsvsphere.VirtualMachine) (map[volumeAttachmentKey]bool, error) {
+	attachments := make(map[volumeAttachmentKey]bool)
+	if len(nodeVMs) == 0 {
+		return attachments, nil
+	}
+	vc, err := common.GetVCenter(ctx, c.manager)
+	if err != nil {
+		return nil, err
+	}
+	var vmRefs []types.ManagedObjectReference
+	for _, nodeVM := range nodeVMs {
+		vmRefs = append(vmRefs, nodeVM.Reference())
+	}
+	var vmMoList []mo.VirtualMachine
+	pc := property.DefaultCollector(vc.Client.Client)
+	err = pc.Retrieve(ctx, vmRefs, []string{"config.hardware", "config.uuid"}, &vmMoList)
+	if err != nil {
+		return nil, err
+	}
+	for _, vmMo := range vmMoList {
+		if vmMo.Config == nil {
+			continue
+		}
+		for _, device := range object.VirtualDeviceList(vmMo.Config.Hardware.Device) {
+			if virtualDisk, ok := device.(*types.VirtualDisk); ok && virtualDisk.VDiskId != nil {
+				attachments[volumeAttachmentKey{volumeID: virtualDisk.VDiskId.Id,
+					nodeVMUUID: vmMo.Config.Uuid}] = true
+			}
+		}
+	}
+	return attachments, nil
+}
+
+// isMultiWriterBlockPV returns true if the PV is a block volume shared in
+// multi-writer mode.
+func isMultiWriterBlockPV(pv *v1.PersistentVolume) bool {
+	return pv != nil && pv.Spec.VolumeMode != nil && *pv.Spec.VolumeMode == v1.PersistentVolumeBlock &&
+		slices.Contains(pv.Spec.AccessModes, v1.ReadWriteMany)
+}
@@ -0,0 +1,354 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vanilla
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/vmware/govmomi/vim25/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common/commonco"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common/placementengine"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+)
+
+// capacityCacheTTL is the time for which the capacity computed for a storage
+// class and topology segment is reused, so that the periodic GetCapacity
+// polls of the external-provisioner do not all go to vCenter.
+const capacityCacheTTL = 30 * time.Second
+
+type capacityCacheEntry struct {
+	response  *csi.GetCapacityResponse
+	timestamp time.Time
+}
+
+// capacityCache caches GetCapacity responses keyed by the storage class
+// parameters and topology segment of the request.
+type capacityCache struct {
+	mu      sync.Mutex
+	entries map[string]capacityCacheEntry
+}
+
+var getCapacityCache = &capacityCache{entries: make(map[string]capacityCacheEntry)}
+
+// capacityCacheKey returns the key of the GetCapacity request in the cache.
+func capacityCacheKey(req *csi.GetCapacityRequest, isFileVolume bool) string {
+	fields := []string{"file:" + strconv.FormatBool(isFileVolume)}
+	for key, value := range req.GetParameters() {
+		fields = append(fields, "param:"+key+"="+value)
+	}
+	for key, value := range req.GetAccessibleTopology().GetSegments() {
+		fields = append(fields, "segment:"+key+"="+value)
+	}
+	slices.Sort(fields)
+	return strings.Join(fields, "\x00")
+}
+
+func (c *capacityCache) get(key string) (*csi.GetCapacityResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Since(entry.timestamp) > capacityCacheTTL {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.response, true
+}
+
+func (c *capacityCache) set(key string, response *csi.GetCapacityResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = capacityCacheEntry{response: response, timestamp: time.Now()}
+}
+
+// getCapacity returns the sum of the free space of the datastores on which a
+// volume of the storage class can be created in the topology segment of the
+// request, with the free space of the largest of them as the maximum volume
+// size. These are the datastores accessible from the nodes in the segment and
+// compatible with the storage policy of the storage class, restricted to the
+// vSAN datastores with file service enabled for file volumes. The capacity of
+// all the vCenters serving the segment is reported in multi vCenter
+// deployments.
+func (c *controller) getCapacity(ctx context.Context, req *csi.GetCapacityRequest) (
+	*csi.GetCapacityResponse, error) {
+	log := logger.GetLogger(ctx)
+	isFileVolume := common.IsFileVolumeRequest(ctx, req.GetVolumeCapabilities())
+	cacheKey := capacityCacheKey(req, isFileVolume)
+	if response, ok := getCapacityCache.get(cacheKey); ok {
+		log.Debugf("GetCapacity: returning cached capacity %d", response.AvailableCapacity)
+		return response, nil
+	}
+
+	scParams, err := common.ParseStorageClassParams(ctx, req.GetParameters(),
+		commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.CSIMigration))
+	if err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"parsing storage class parameters failed with error: %+v", err)
+	}
+	var datastores []*cnsvsphere.DatastoreInfo
+	if multivCenterCSITopologyEnabled {
+		datastores, err = c.getCapacityDatastoresForMultiVC(ctx, req, scParams, isFileVolume)
+	} else {
+		datastores, err = c.getCapacityDatastores(ctx, req, scParams, isFileVolume)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if scParams.DatastoreURL != "" {
+		datastores = common.FilterDatastoresByURLs(ctx, datastores, []string{scParams.DatastoreURL})
+	}
+	datastores = slices.DeleteFunc(slices.Clone(datastores), func(dsInfo *cnsvsphere.DatastoreInfo) bool {
+		return cnsvsphere.IsVolumeCreationSuspended(ctx, dsInfo)
+	})
+
+	var availableCapacity, maximumVolumeSize int64
+	for _, dsInfo := range datastores {
+		availableCapacity += dsInfo.Info.FreeSpace
+		maximumVolumeSize = max(maximumVolumeSize, dsInfo.Info.FreeSpace)
+	}
+	log.Infof("GetCapacity: %d bytes available on %d datastores, maximum volume size %d bytes",
+		availableCapacity, len(datastores), maximumVolumeSize)
+	response := &csi.GetCapacityResponse{
+		AvailableCapacity: availableCapacity,
+		MaximumVolumeSize: &wrapperspb.Int64Value{Value: maximumVolumeSize},
+	}
+	getCapacityCache.set(cacheKey, response)
+	return response, nil
+}
+
+// getCapacityDatastores returns the datastores counted in the capacity of the
+// GetCapacity request in single vCenter deployments.
+func (c *controller) getCapacityDatastores(ctx context.Context, req *csi.GetCapacityRequest,
+	scParams *common.StorageClassParams, isFileVolume bool) ([]*cnsvsphere.DatastoreInfo, error) {
+	log := logger.GetLogger(ctx)
+	vcenter, err := c.manager.VcenterManager.GetVirtualCenter(ctx, c.manager.VcenterConfig.Host)
+	if err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.Internal, "failed to get vCenter. Err: %v", err)
+	}
+	var storagePolicyID string
+	if scParams.StoragePolicyName != "" {
+		storagePolicyID, err = vcenter.GetStoragePolicyIDByName(ctx, scParams.StoragePolicyName)
+		if err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+				"failed to get storage policy ID for storage policy %q. Error: %+v", scParams.StoragePolicyName, err)
+		}
+	}
+	var datastores []*cnsvsphere.DatastoreInfo
+	if isFileVolume {
+		var topologySegmentsList []map[string]string
+		if segments := req.GetAccessibleTopology().GetSegments(); len(segments) != 0 {
+			topologySegmentsList = append(topologySegmentsList, segments)
+		}
+		datastores, err = getFileCapacityDatastores(ctx, vcenter, topologySegmentsList,
+			c.authMgr.GetFsEnabledClusterToDsMap(ctx))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var topologyRequirement *csi.TopologyRequirement
+		if req.GetAccessibleTopology() != nil {
+			topology := []*csi.Topology{req.GetAccessibleTopology()}
+			topologyRequirement = &csi.TopologyRequirement{Requisite: topology, Preferred: topology}
+		}
+		datastores, _, err = c.getSharedDatastoresForBlockVolume(ctx, topologyRequirement, vcenter, scParams)
+		if err != nil {
+			if status.Code(err) != codes.ResourceExhausted {
+				return nil, err
+			}
+			// No datastore is accessible from the nodes in the segment.
+			datastores = nil
+		}
+		if len(datastores) > 0 {
+			datastores, err = c.filterDatastores(ctx, datastores, c.manager.VcenterConfig.Host)
+			if err != nil {
+				if err != errAllDSFilteredOut {
+					return nil, logger.LogNewErrorCodef(log, codes.Internal,
+						"failed to filter datastores. Error: %+v", err)
+				}
+				datastores = nil
+			}
+		}
+	}
+	if storagePolicyID != "" && len(datastores) > 0 {
+		datastores, err = filterPolicyCompatibleDatastores(ctx, vcenter, datastores, storagePolicyID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return datastores, nil
+}
+
+// getCapacityDatastoresForMultiVC returns the datastores counted in the
+// capacity of the GetCapacity request, across the vCenters serving the
+// topology segment of the request. vCenters without the storage policy of the
+// storage class have no capacity for it.
+func (c *controller) getCapacityDatastoresForMultiVC(ctx context.Context, req *csi.GetCapacityRequest,
+	scParams *common.StorageClassParams, isFileVolume bool) ([]*cnsvsphere.DatastoreInfo, error) {
+	log := logger.GetLogger(ctx)
+	vcTopologySegmentsMap := make(map[string][]map[string]string)
+	segments := req.GetAccessibleTopology().GetSegments()
+	if len(c.managers.VcenterConfigs) > 1 {
+		if len(segments) == 0 {
+			return nil, logger.LogNewErrorCode(log, codes.InvalidArgument,
+				"accessible topology cannot be empty for a multi-VC environment")
+		}
+		var err error
+		vcTopologySegmentsMap, err = common.GetAccessibilityRequirementsByVC(ctx, &csi.TopologyRequirement{
+			Preferred: []*csi.Topology{req.GetAccessibleTopology()},
+		})
+		if err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to get the vCenter of topology segment %+v. Error: %+v", segments, err)
+		}
+	} else {
+		vcHost := c.managers.CnsConfig.Global.VCenterIP
+		vcTopologySegmentsMap[vcHost] = nil
+		if len(segments) != 0 {
+			vcTopologySegmentsMap[vcHost] = []map[string]string{segments}
+		}
+	}
+
+	var datastores []*cnsvsphere.DatastoreInfo
+	for vcHost, topologySegmentsList := range vcTopologySegmentsMap {
+		vcenter, err := common.GetVCenterFromVCHost(ctx, c.managers.VcenterManager, vcHost)
+		if err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to get vCenter instance for host %q. Error: %+v", vcHost, err)
+		}
+		var storagePolicyID string
+		if scParams.StoragePolicyName != "" {
+			storagePolicyID, err = vcenter.GetStoragePolicyIDByName(ctx, scParams.StoragePolicyName)
+			if err != nil {
+				if err.Error() == fmt.Sprintf("no pbm profile found with name: %q", scParams.StoragePolicyName) {
+					log.Infof("Storage policy %q not found in vCenter %q, no capacity available in it",
+						scParams.StoragePolicyName, vcHost)
+					continue
+				}
+				return nil, logger.LogNewErrorCodef(log, codes.Internal,
+					"failed to get policy ID for storage policy name %q in vCenter %q. Error: %+v",
+					scParams.StoragePolicyName, vcHost, err)
+			}
+		}
+		var vcDatastores []*cnsvsphere.DatastoreInfo
+		if isFileVolume {
+			vcDatastores, err = getFileCapacityDatastores(ctx, vcenter, topologySegmentsList,
+				c.authMgrs[vcHost].GetFsEnabledClusterToDsMap(ctx))
+		} else if len(topologySegmentsList) != 0 {
+			// The placement engine only returns the datastores compatible with
+			// the storage policy.
+			vcDatastores, err = placementengine.GetSharedDatastores(ctx,
+				placementengine.VanillaSharedDatastoresParams{
+					Vcenter:              vcenter,
+					TopologySegmentsList: topologySegmentsList,
+					StoragePolicyID:      storagePolicyID,
+				})
+			storagePolicyID = ""
+		} else {
+			vcDatastores, err = c.nodeMgr.GetSharedDatastoresInK8SCluster(ctx)
+		}
+		if err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to get datastores for topology segments %+v in vCenter %q. Error: %+v",
+				topologySegmentsList, vcHost, err)
+		}
+		if !isFileVolume && len(vcDatastores) > 0 {
+			vcDatastores, err = c.filterDatastores(ctx, vcDatastores, vcHost)
+			if err != nil {
+				if err != errAllDSFilteredOut {
+					return nil, logger.LogNewErrorCodef(log, codes.Internal,
+						"failed to filter datastores of vCenter %q. Error: %+v", vcHost, err)
+				}
+				vcDatastores = nil
+			}
+		}
+		if storagePolicyID != "" && len(vcDatastores) > 0 {
+			vcDatastores, err = filterPolicyCompatibleDatastores(ctx, vcenter, vcDatastores, storagePolicyID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		datastores = append(datastores, vcDatastores...)
+	}
+	return datastores, nil
+}
+
+// getFileCapacityDatastores returns the vSAN datastores with file service
+// enabled, among fsEnabledClusterToDsMap, which are accessible from the hosts
+// in the given topology segments, if any.
+func getFileCapacityDatastores(ctx context.Context, vcenter *cnsvsphere.VirtualCenter,
+	topologySegmentsList []map[string]string,
+	fsEnabledClusterToDsMap map[string][]*cnsvsphere.DatastoreInfo) ([]*cnsvsphere.DatastoreInfo, error) {
+	log := logger.GetLogger(ctx)
+	var fsEnabledDatastores []*cnsvsphere.DatastoreInfo
+	for _, datastores := range fsEnabledClusterToDsMap {
+		fsEnabledDatastores = append(fsEnabledDatastores, datastores...)
+	}
+	if len(topologySegmentsList) == 0 || len(fsEnabledDatastores) == 0 {
+		return fsEnabledDatastores, nil
+	}
+	accessibleDatastores, err := placementengine.GetAllAccessibleDSInTopology(ctx, topologySegmentsList, vcenter)
+	if err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to get datastores accessible in topology %+v. Error: %+v", topologySegmentsList, err)
+	}
+	accessible := make(map[string]bool)
+	for _, dsInfo := range accessibleDatastores {
+		accessible[dsInfo.Info.Url] = true
+	}
+	return slices.DeleteFunc(fsEnabledDatastores, func(dsInfo *cnsvsphere.DatastoreInfo) bool {
+		return !accessible[dsInfo.Info.Url]
+	}), nil
+}
+
+// filterPolicyCompatibleDatastores returns the datastores compatible with the
+// storage policy with the given ID.
+func filterPolicyCompatibleDatastores(ctx context.Context, vcenter *cnsvsphere.VirtualCenter,
+	datastores []*cnsvsphere.DatastoreInfo, storagePolicyID string) ([]*cnsvsphere.DatastoreInfo, error) {
+	log := logger.GetLogger(ctx)
+	var dsRefs []types.ManagedObjectReference
+	for _, dsInfo := range datastores {
+		dsRefs = append(dsRefs, dsInfo.Reference())
+	}
+	compat, err := vcenter.PbmCheckCompatibility(ctx, dsRefs, storagePolicyID)
+	if err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to check compatibility of datastores with storage policy %q. Error: %+v",
+			storagePolicyID, err)
+	}
+	compatible := make(map[string]bool)
+	for _, hub := range compat.CompatibleDatastores() {
+		compatible[hub.HubId] = true
+	}
+	return slices.DeleteFunc(datastores, func(dsInfo *cnsvsphere.DatastoreInfo) bool {
+		return !compatible[dsInfo.Reference().Value]
+	}), nil
+}
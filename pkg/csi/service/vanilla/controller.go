@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -32,9 +33,12 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	cnstypes "github.com/vmware/govmomi/cns/types"
 	"github.com/vmware/govmomi/object"
+	pbmtypes "github.com/vmware/govmomi/pbm/types"
 	"github.com/vmware/govmomi/units"
 	"github.com/vmware/govmomi/vim25/types"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 
@@ -136,6 +140,32 @@ func (c *controller) Init(config *cnsconfig.Config, version string) error {
 		common.CnsMgrSuspendCreateVolume)
 	isTopologyAwareFileVolumeEnabled = commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx,
 		common.TopologyAwareFileVolume)
+	cnsvolume.SetTaskPollBackoff(ctx, cnsvolume.TaskPollBackoff{
+		InitialInterval: time.Duration(config.TaskPolling.InitialIntervalInMs) * time.Millisecond,
+		MaxInterval:     time.Duration(config.TaskPolling.MaxIntervalInMs) * time.Millisecond,
+		Multiplier:      config.TaskPolling.Multiplier,
+	})
+	cnsvolume.SetStuckTaskTimeout(ctx, time.Duration(config.TaskPolling.StuckTaskTimeoutInMin)*time.Minute)
+	cnsvolume.SetQueryVolumeCacheConfig(ctx, config.Global.QueryVolumeCacheTTLInSec,
+		config.Global.QueryVolumeCacheDisabled)
+	cnsvolume.SetAuditLogEnabled(ctx, config.Global.CnsAuditLogEnabled)
+	attachLimiter.setLimit(config.Global.MaxConcurrentAttachesPerHost)
+	attachLimiter.setClassLimits(getHostAttachLimits(config.HostAttachLimit))
+	detachLimiter.setLimit(config.Global.MaxConcurrentDetachesPerHost)
+	nodeDetachLimiter.setLimit(config.Global.MaxConcurrentDetachesPerNode)
+	namespaceQuotas.setLimits(config.NamespaceQuota)
+	csifault.SetFaultCodeOverrides(ctx, getFaultCodeOverrides(config.FaultClassification))
+	if multivCenterCSITopologyEnabled && len(config.NamespaceQuota) != 0 {
+		log.Warnf("Namespace provisioning quotas are not enforced in multi vCenter deployments")
+	}
+	relocateOnInaccessibleDatastoreAttach = config.Global.RelocateOnInaccessibleDatastoreAttach
+	groupSnapshotEnabled = config.Global.GroupSnapshotEnabled
+	maxDatastoreOvercommitPercent = config.Global.MaxDatastoreOvercommitPercent
+	setDefaultSnapshotDeletePolicy(ctx, config.Global.SnapshotDeletePolicy)
+	common.SetDefaultPlacementStrategy(ctx, config.Global.PlacementStrategy)
+	cnsvsphere.SetInventoryCallLimits(ctx,
+		time.Duration(config.Global.VCInventoryCallTimeoutInSec)*time.Second,
+		config.Global.VCInventoryCircuitBreakerThreshold)
 
 	vcManager := cnsvsphere.GetVirtualCenterManager(ctx)
 	if !multivCenterCSITopologyEnabled {
@@ -288,6 +318,26 @@ func (c *controller) Init(config *cnsconfig.Config, version string) error {
 	}
 
 	go cnsvolume.ClearInvalidTasksFromListView(multivCenterCSITopologyEnabled)
+	var leaderReconcilers []func(ctx context.Context)
+	if !multivCenterCSITopologyEnabled {
+		leaderReconcilers = append(leaderReconcilers, c.reconcileSoftDeletedVolumes,
+			c.reconcileStoragePolicyMigrations)
+	}
+	if !multivCenterCSITopologyEnabled && config.Global.ReconcileAttachmentsOnStartup {
+		confirmationWindow := defaultOrphanedAttachmentConfirmationWindow
+		if config.Global.OrphanedAttachmentConfirmationInMin > 0 {
+			confirmationWindow = time.Duration(config.Global.OrphanedAttachmentConfirmationInMin) * time.Minute
+		}
+		leaderReconcilers = append(leaderReconcilers, func(ctx context.Context) {
+			c.reconcileAttachments(ctx, confirmationWindow)
+		})
+	}
+	if len(leaderReconcilers) != 0 {
+		go runOnLeader(ctx, leaderReconcilers...)
+	}
+	if multivCenterCSITopologyEnabled && config.Global.ReconcileAttachmentsOnStartup {
+		log.Warnf("Attachments are not reconciled on startup in multi vCenter deployments")
+	}
 	cfgPath := cnsconfig.GetConfigPath(ctx)
 
 	watcher, err := fsnotify.NewWatcher()
@@ -358,6 +408,9 @@ func (c *controller) Init(config *cnsconfig.Config, version string) error {
 		log.Errorf("failed to initialize topology service. Error: %+v", err)
 		return err
 	}
+	if config.Global.TopologyDebugPort != 0 {
+		c.startTopologyDebugServer(ctx, config.Global.TopologyDebugPort)
+	}
 
 	// Go module to keep the metrics http server running all the time.
 	go func() {
@@ -510,16 +563,215 @@ func (c *controller) filterDatastores(ctx context.Context, sharedDatastores []*c
 	return filteredDatastores, nil
 }
 
+// dryRunCreateBlockVolume validates that a block volume can be provisioned
+// for the CreateVolumeRequest without creating it. As no volume is created, a
+// dry run never succeeds: when the volume could be placed, it fails with
+// codes.FailedPrecondition, whose ErrorInfo details carry the URL and the free
+// space of the datastore the volume would be placed on.
+func (c *controller) dryRunCreateBlockVolume(ctx context.Context, req *csi.CreateVolumeRequest,
+	scParams *common.StorageClassParams, volSizeMB int64, contentSourceSnapshotID string) (
+	*csi.CreateVolumeResponse, string, error) {
+	log := logger.GetLogger(ctx)
+	if req.GetVolumeContentSource().GetVolume() != nil {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is not supported for cloning a volume", common.AttributeDryRun)
+	}
+	vcenter, err := c.manager.VcenterManager.GetVirtualCenter(ctx, c.manager.VcenterConfig.Host)
+	if err != nil {
+		return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to get vCenter. Err: %v", err)
+	}
+	sharedDatastores, faultType, err := c.getSharedDatastoresForBlockVolume(ctx,
+		req.GetAccessibilityRequirements(), vcenter, scParams)
+	if err != nil {
+		return nil, faultType, err
+	}
+	if maxDatastoreOvercommitPercent > 0 {
+		sharedDatastores, faultType, err = filterDatastoresByOvercommit(ctx, vcenter,
+			maxDatastoreOvercommitPercent, volSizeMB, sharedDatastores)
+		if err != nil {
+			return nil, faultType, err
+		}
+	}
+	createVolumeSpec := common.CreateVolumeSpec{
+		CapacityMB:              volSizeMB,
+		Name:                    common.GetCnsVolumeName(scParams, req.Name),
+		ScParams:                scParams,
+		VolumeType:              common.BlockVolumeType,
+		ContentSourceSnapshotID: contentSourceSnapshotID,
+	}
+	datastore, faultType, err := common.SelectDatastoreForBlockVolumeUtil(ctx, c.manager, &createVolumeSpec,
+		sharedDatastores, common.CreateBlockVolumeOptions{
+			FilterSuspendedDatastores: filterSuspendedDatastores,
+		})
+	if err != nil {
+		return nil, faultType, err
+	}
+	details := map[string]string{
+		common.AttributeDryRunDatastoreURL: datastore.Info.Url,
+		common.AttributeDryRunFreeSpace:    strconv.FormatInt(datastore.Info.FreeSpace, 10),
+	}
+	if scParams.DiskFormat != "" {
+		faultType, err = common.ValidateDiskFormatForDatastore(ctx, scParams.DiskFormat, datastore)
+		if err != nil {
+			return nil, faultType, err
+		}
+		details[common.AttributeEffectiveDiskFormat] = scParams.DiskFormat
+	}
+	msg := fmt.Sprintf("dry run: volume %q of %d MB can be placed on datastore %q with %d bytes free, "+
+		"it is not created", req.Name, volSizeMB, datastore.Info.Url, datastore.Info.FreeSpace)
+	log.Info(msg)
+	st, detailsErr := status.New(codes.FailedPrecondition, msg).WithDetails(&errdetails.ErrorInfo{
+		Reason:   common.DryRunErrorReason,
+		Domain:   common.DryRunErrorDomain,
+		Metadata: details,
+	})
+	if detailsErr != nil {
+		return nil, csifault.CSIFailedPreconditionFault, status.Error(codes.FailedPrecondition, msg)
+	}
+	return nil, csifault.CSIFailedPreconditionFault, st.Err()
+}
+
+// getSharedDatastoresForBlockVolume returns the datastores accessible to all
+// the nodes matching the topology requirement, or to all the nodes in the
+// cluster if no topology requirement is given, that are allowed for block
+// volume provisioning with the given storage class parameters.
+func (c *controller) getSharedDatastoresForBlockVolume(ctx context.Context,
+	topologyRequirement *csi.TopologyRequirement, vcenter *cnsvsphere.VirtualCenter,
+	scParams *common.StorageClassParams) ([]*cnsvsphere.DatastoreInfo, string, error) {
+	log := logger.GetLogger(ctx)
+	var (
+		sharedDatastores []*cnsvsphere.DatastoreInfo
+		err              error
+	)
+	if topologyRequirement != nil {
+		// Check if topology domains have been provided in the vSphere CSI config secret.
+		// NOTE: We do not support kubernetes.io/hostname as a topology label.
+		if c.manager.CnsConfig.Labels.TopologyCategories == "" && c.manager.CnsConfig.Labels.Zone == "" &&
+			c.manager.CnsConfig.Labels.Region == "" {
+			return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCode(log, codes.InvalidArgument,
+				"topology category names not specified in the vsphere config secret")
+		}
+
+		// Get shared accessible datastores for matching topology requirement.
+		if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.TopologyPreferentialDatastores) {
+			sharedDatastores, err = c.topologyMgr.GetSharedDatastoresInTopology(ctx,
+				commoncotypes.VanillaTopologyFetchDSParams{
+					TopologyRequirement: topologyRequirement,
+					Vc:                  vcenter,
+					StoragePolicyName:   scParams.StoragePolicyName,
+				})
+			if err != nil {
+				return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+					"failed to get shared datastores for topology requirement: %+v. Error: %+v",
+					topologyRequirement, err)
+			}
+		} else {
+			sharedDatastores, err = c.topologyMgr.GetSharedDatastoresInTopology(ctx,
+				commoncotypes.VanillaTopologyFetchDSParams{TopologyRequirement: topologyRequirement})
+			if err != nil {
+				return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+					"failed to get shared datastores for topology requirement: %+v. Error: %+v",
+					topologyRequirement, err)
+			}
+		}
+		if len(sharedDatastores) == 0 {
+			return nil, csifault.CSIResourceExhaustedFault, logger.LogNewErrorCodef(log, codes.ResourceExhausted,
+				"no shared datastore is accessible from the hosts of the nodes in topology requirement: %+v",
+				topologyRequirement)
+		}
+		log.Debugf("Shared datastores [%+v] retrieved for topologyRequirement [%+v]", sharedDatastores,
+			topologyRequirement)
+	} else {
+		sharedDatastores, err = c.nodeMgr.GetSharedDatastoresInK8SCluster(ctx)
+		if err != nil || len(sharedDatastores) == 0 {
+			return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to get shared datastores in kubernetes cluster. Error: %+v", err)
+		}
+		if len(sharedDatastores) == 0 {
+			return nil, csifault.CSIInternalFault, logger.LogNewErrorCode(log, codes.Internal,
+				"No datastore found for volume provisioning.")
+		}
+	}
+
+	// Filter datastores which in datastoreMap from sharedDatastores.
+	sharedDatastores, err = c.filterDatastores(ctx, sharedDatastores, c.manager.VcenterConfig.Host)
+	if err != nil {
+		return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to create volume. Error: %+v", err)
+	}
+
+	// Restrict datastores to the allowlist given in the StorageClass.
+	if len(scParams.DatastoreURLs) != 0 {
+		sharedDatastores = common.FilterDatastoresByURLs(ctx, sharedDatastores, scParams.DatastoreURLs)
+		if len(sharedDatastores) == 0 {
+			return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+				"none of the compatible datastores are present in %s: %v",
+				common.AttributeDatastoreURLs, scParams.DatastoreURLs)
+		}
+	}
+
+	// Restrict datastores to the members of the datastore cluster given in the
+	// StorageClass.
+	if scParams.StoragePod != "" {
+		var faultType string
+		sharedDatastores, faultType, err = filterDatastoresByStoragePod(ctx, vcenter, sharedDatastores,
+			scParams.StoragePod)
+		if err != nil {
+			return nil, faultType, err
+		}
+	}
+
+	// Restrict datastores to the datacenter-qualified datastore given in the
+	// StorageClass.
+	if scParams.QualifiedDatastore != "" {
+		var faultType string
+		sharedDatastores, faultType, err = filterDatastoresByQualifiedName(ctx, vcenter, sharedDatastores,
+			scParams.QualifiedDatastore)
+		if err != nil {
+			return nil, faultType, err
+		}
+	}
+
+	// Restrict datastores to the ones carrying the tags given in the StorageClass,
+	// which are also compatible with the storage policy.
+	if len(scParams.DatastoreTags) != 0 {
+		sharedDatastores, err = common.FilterDatastoresByTags(ctx, vcenter, sharedDatastores, scParams.DatastoreTags)
+		if err != nil {
+			return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to filter datastores by %s: %v. Error: %+v", common.AttributeDatastoreTags,
+				scParams.DatastoreTags, err)
+		}
+		if len(sharedDatastores) != 0 && scParams.StoragePolicyName != "" {
+			storagePolicyID, err := vcenter.GetStoragePolicyIDByName(ctx, scParams.StoragePolicyName)
+			if err != nil {
+				return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+					"failed to get storage policy ID for storage policy %q. Error: %+v",
+					scParams.StoragePolicyName, err)
+			}
+			sharedDatastores, err = common.FilterDatastoresByStoragePolicy(ctx, vcenter, sharedDatastores,
+				storagePolicyID)
+			if err != nil {
+				return nil, csifault.CSIInternalFault, logger.LogNewErrorCode(log, codes.Internal, err.Error())
+			}
+		}
+		if len(sharedDatastores) == 0 {
+			return nil, csifault.CSIResourceExhaustedFault, logger.LogNewErrorCodef(log, codes.ResourceExhausted,
+				"no datastore compatible with storage policy %q carries all the tags in %s: %v",
+				scParams.StoragePolicyName, common.AttributeDatastoreTags, scParams.DatastoreTags)
+		}
+	}
+	return sharedDatastores, "", nil
+}
+
 // createBlockVolume creates a block volume based on the CreateVolumeRequest.
 func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolumeRequest) (
 	*csi.CreateVolumeResponse, string, error) {
 	log := logger.GetLogger(ctx)
-	// Volume Size - Default is 10 GiB.
-	volSizeBytes := int64(common.DefaultGbDiskSize * common.GbInBytes)
-	if req.GetCapacityRange() != nil && req.GetCapacityRange().RequiredBytes != 0 {
-		volSizeBytes = int64(req.GetCapacityRange().GetRequiredBytes())
+	volSizeBytes, volSizeMB, err := common.GetVolumeSizeFromCapacityRange(ctx, req.GetCapacityRange())
+	if err != nil {
+		return nil, csifault.CSIInvalidArgumentFault, err
 	}
-	volSizeMB := int64(common.RoundUpSize(volSizeBytes, common.MbInBytes))
 
 	// Check if the feature states are enabled.
 	isBlockVolumeSnapshotEnabled := commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.BlockVolumeSnapshot)
@@ -528,7 +780,7 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 	// Check if requested volume size and source snapshot size matches
 	volumeSource := req.GetVolumeContentSource()
 	var contentSourceSnapshotID string
-	if isBlockVolumeSnapshotEnabled && volumeSource != nil {
+	if isBlockVolumeSnapshotEnabled && volumeSource != nil && volumeSource.GetVolume() == nil {
 		isCnsSnapshotSupported, err := c.manager.VcenterManager.IsCnsSnapshotSupported(ctx,
 			c.manager.VcenterConfig.Host)
 		if err != nil {
@@ -580,6 +832,12 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 		return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
 			"parsing storage class parameters failed with error: %+v", err)
 	}
+	if scParams.XFSProjectQuota {
+		if err := common.ValidateXFSProjectQuotaRequest(req.GetVolumeCapabilities()); err != nil {
+			return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCode(log, codes.InvalidArgument,
+				err.Error())
+		}
+	}
 
 	if csiMigrationFeatureState && scParams.CSIMigration == "true" {
 		if len(scParams.Datastore) != 0 {
@@ -629,12 +887,45 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 		}
 	}
 
+	if scParams.DiskFormat != "" && volumeSource != nil {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is not supported for volumes created from a snapshot or a volume", common.AttributeDiskFormat)
+	}
+	if scParams.ReadOnlyClone && contentSourceSnapshotID == "" {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is only supported for volumes created from a snapshot", common.AttributeReadOnlyClone)
+	}
+
+	if len(scParams.ZoneStoragePolicyIDs) != 0 && (scParams.DryRun || volumeSource.GetVolume() != nil) {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is not supported for dry runs and for cloning a volume", common.AttributeZoneStoragePolicyIDs)
+	}
+
+	if scParams.StoragePod != "" && volumeSource.GetVolume() != nil {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is not supported for cloning a volume", common.AttributeStoragePod)
+	}
+
+	if scParams.DryRun {
+		return c.dryRunCreateBlockVolume(ctx, req, scParams, volSizeMB, contentSourceSnapshotID)
+	}
+
+	// Clone the source volume if the VolumeContentSource is of type Volume.
+	if sourceVolume := volumeSource.GetVolume(); sourceVolume != nil {
+		return c.createClonedBlockVolume(ctx, req, scParams, sourceVolume.GetVolumeId(), volSizeMB)
+	}
+
 	var createVolumeSpec = common.CreateVolumeSpec{
 		CapacityMB:              volSizeMB,
-		Name:                    req.Name,
+		Name:                    common.GetCnsVolumeName(scParams, req.Name),
 		ScParams:                scParams,
 		VolumeType:              common.BlockVolumeType,
 		ContentSourceSnapshotID: contentSourceSnapshotID,
+		AntiAffinityGroup:       getAntiAffinityGroup(ctx, req.Parameters, scParams),
+	}
+	if createVolumeSpec.AntiAffinityGroup != "" && contentSourceSnapshotID == "" {
+		createVolumeSpec.AntiAffinityDatastoreURLs = c.getAntiAffinityDatastoreURLs(ctx,
+			createVolumeSpec.AntiAffinityGroup)
 	}
 
 	// Check if vCenter task for this volume is already registered as part of
@@ -652,6 +943,18 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 		return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
 			"failed to get vCenter. Err: %v", err)
 	}
+	if contentSourceSnapshotID != "" && scParams.StoragePolicyName != "" {
+		snapshotVolumeID, _, err := common.ParseCSISnapshotID(contentSourceSnapshotID)
+		if err != nil {
+			return nil, csifault.CSIInvalidArgumentFault,
+				logger.LogNewErrorCode(log, codes.InvalidArgument, err.Error())
+		}
+		faultType, err := validateSnapshotRestoreEncryption(ctx, vcenter, c.manager.VolumeManager,
+			snapshotVolumeID, scParams.StoragePolicyName)
+		if err != nil {
+			return nil, faultType, err
+		}
+	}
 	// Get operation store
 	operationStore := c.manager.VolumeManager.GetOperationStore()
 	if operationStore == nil {
@@ -659,7 +962,7 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 			"Operation store cannot be nil")
 	}
 
-	volumeOperationDetails, err := operationStore.GetRequestDetails(ctx, req.Name)
+	volumeOperationDetails, err := operationStore.GetRequestDetails(ctx, common.GetCnsVolumeName(scParams, req.Name))
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			log.Debugf("CreateVolume task details for block volume %s are not found.", req.Name)
@@ -711,7 +1014,7 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 			}()
 
 			volumeInfo, faultType, err = c.manager.VolumeManager.MonitorCreateVolumeTask(ctx,
-				&volumeOperationDetails, task, req.Name, c.manager.CnsConfig.Global.ClusterID)
+				&volumeOperationDetails, task, common.GetCnsVolumeName(scParams, req.Name), c.manager.CnsConfig.Global.ClusterID)
 			if err != nil {
 				return nil, faultType, logger.LogNewErrorCodef(log, codes.Internal,
 					"failed to monitor task for volume %s. Error: %+v", req.Name, err)
@@ -726,73 +1029,150 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 	)
 	// Get accessibility.
 	topologyRequirement = req.GetAccessibilityRequirements()
+	if len(scParams.ZoneStoragePolicyIDs) != 0 {
+		// Resolve the storage policy of the zone selected for the volume, and
+		// restrict the volume to this zone.
+		storagePolicyID, segments, err := common.ResolveZoneStoragePolicyID(topologyRequirement,
+			scParams.ZoneStoragePolicyIDs)
+		if err != nil {
+			return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCode(log, codes.InvalidArgument,
+				err.Error())
+		}
+		log.Infof("Using storage policy ID %q mapped to topology segment %v for volume %q", storagePolicyID,
+			segments, req.Name)
+		createVolumeSpec.StoragePolicyID = storagePolicyID
+		topology := []*csi.Topology{{Segments: segments}}
+		topologyRequirement = &csi.TopologyRequirement{Requisite: topology, Preferred: topology}
+	}
 	if !volTaskAlreadyRegistered {
-		if topologyRequirement != nil {
-			// Check if topology domains have been provided in the vSphere CSI config secret.
-			// NOTE: We do not support kubernetes.io/hostname as a topology label.
-			if c.manager.CnsConfig.Labels.TopologyCategories == "" && c.manager.CnsConfig.Labels.Zone == "" &&
-				c.manager.CnsConfig.Labels.Region == "" {
-				return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCode(log, codes.InvalidArgument,
-					"topology category names not specified in the vsphere config secret")
+		sharedDatastores, faultType, err = c.getSharedDatastoresForBlockVolume(ctx, topologyRequirement,
+			vcenter, scParams)
+		if err != nil {
+			return nil, faultType, err
+		}
+		if maxDatastoreOvercommitPercent > 0 {
+			sharedDatastores, faultType, err = filterDatastoresByOvercommit(ctx, vcenter,
+				maxDatastoreOvercommitPercent, createVolumeSpec.CapacityMB, sharedDatastores)
+			if err != nil {
+				return nil, faultType, err
+			}
+		}
+		// Let Storage DRS pick the member of the datastore cluster given in the
+		// StorageClass.
+		if scParams.StoragePod != "" {
+			sharedDatastores, faultType, err = recommendStoragePodDatastore(ctx, vcenter, sharedDatastores,
+				scParams.StoragePod, createVolumeSpec.CapacityMB)
+			if err != nil {
+				return nil, faultType, err
 			}
+		}
 
-			// Get shared accessible datastores for matching topology requirement.
-			if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.TopologyPreferentialDatastores) {
-				sharedDatastores, err = c.topologyMgr.GetSharedDatastoresInTopology(ctx,
-					commoncotypes.VanillaTopologyFetchDSParams{
-						TopologyRequirement: topologyRequirement,
-						Vc:                  vcenter,
-						StoragePolicyName:   scParams.StoragePolicyName,
-					})
-				if err != nil || len(sharedDatastores) == 0 {
-					return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
-						"failed to get shared datastores for topology requirement: %+v. Error: %+v",
-						topologyRequirement, err)
-				}
-			} else {
-				sharedDatastores, err = c.topologyMgr.GetSharedDatastoresInTopology(ctx,
-					commoncotypes.VanillaTopologyFetchDSParams{TopologyRequirement: topologyRequirement})
-				if err != nil || len(sharedDatastores) == 0 {
-					return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
-						"failed to get shared datastores for topology requirement: %+v. Error: %+v",
-						topologyRequirement, err)
-				}
+		if scParams.DiskFormat != "" {
+			volumeInfo, faultType, err = common.CreateBlockVolumeWithDiskFormatUtil(ctx,
+				cnstypes.CnsClusterFlavorVanilla, c.manager, &createVolumeSpec, sharedDatastores,
+				common.CreateBlockVolumeOptions{FilterSuspendedDatastores: filterSuspendedDatastores})
+			if err != nil {
+				return nil, faultType, err
 			}
-			log.Debugf("Shared datastores [%+v] retrieved for topologyRequirement [%+v]", sharedDatastores,
-				topologyRequirement)
 		} else {
-			sharedDatastores, err = c.nodeMgr.GetSharedDatastoresInK8SCluster(ctx)
-			if err != nil || len(sharedDatastores) == 0 {
-				return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
-					"failed to get shared datastores in kubernetes cluster. Error: %+v", err)
-			}
-			if len(sharedDatastores) == 0 {
-				return nil, csifault.CSIInternalFault, logger.LogNewErrorCode(log, codes.Internal,
-					"No datastore found for volume provisioning.")
+			volumeInfo, faultType, err = common.CreateBlockVolumeUtil(ctx, cnstypes.CnsClusterFlavorVanilla,
+				c.manager, &createVolumeSpec, sharedDatastores,
+				common.CreateBlockVolumeOptions{
+					FilterSuspendedDatastores: filterSuspendedDatastores,
+					AllowCrossPolicyRestore:   true,
+				},
+				nil)
+			if err != nil {
+				return nil, faultType, logger.LogNewErrorCodef(log, codes.Internal,
+					"failed to create volume. Error: %+v", err)
 			}
 		}
+	}
 
-		// Filter datastores which in datastoreMap from sharedDatastores.
-		sharedDatastores, err = c.filterDatastores(ctx, sharedDatastores, c.manager.VcenterConfig.Host)
-		if err != nil {
-			return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
-				"failed to create volume. Error: %+v", err)
+	// A volume restored from a snapshot lands on the datastore of the snapshot,
+	// relocate it if that datastore does not match the StorageClass of the volume.
+	if contentSourceSnapshotID != "" && scParams.StoragePolicyName != "" {
+		if sharedDatastores == nil {
+			sharedDatastores, faultType, err = c.getSharedDatastoresForBlockVolume(ctx, topologyRequirement,
+				vcenter, scParams)
+			if err != nil {
+				return nil, faultType, err
+			}
 		}
-
-		volumeInfo, faultType, err = common.CreateBlockVolumeUtil(ctx, cnstypes.CnsClusterFlavorVanilla,
-			c.manager, &createVolumeSpec, sharedDatastores,
-			common.CreateBlockVolumeOptions{
-				FilterSuspendedDatastores: filterSuspendedDatastores,
-			},
-			nil)
+		volumeInfo.DatastoreURL, faultType, err = c.relocateRestoredVolume(ctx, vcenter, volumeInfo.VolumeID.Id,
+			createVolumeSpec, sharedDatastores)
 		if err != nil {
-			return nil, faultType, logger.LogNewErrorCodef(log, codes.Internal,
-				"failed to create volume. Error: %+v", err)
+			return nil, faultType, err
 		}
 	}
 
 	attributes := make(map[string]string)
 	attributes[common.AttributeDiskType] = common.DiskTypeBlockVolume
+	if scParams.XFSProjectQuota {
+		attributes[common.AttributeXFSProjectQuota] = "true"
+	}
+	if scParams.ReadOnlyClone {
+		// CNS restores the snapshot as a full copy, there is no linked clone
+		// API. Mark the FCD so that the clone is not modified by the driver.
+		err = c.manager.VolumeManager.UpdateVStorageObjectMetadata(ctx, volumeInfo.VolumeID.Id,
+			[]types.KeyValue{{Key: common.ReadOnlyCloneMetadataKey, Value: "true"}})
+		if err != nil {
+			return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to mark volume %q as a read-only clone. Error: %+v", volumeInfo.VolumeID.Id, err)
+		}
+		attributes[common.AttributeReadOnlyClone] = "true"
+	}
+	if scParams.DeletionRetentionMinutes > 0 {
+		err = c.manager.VolumeManager.UpdateVStorageObjectMetadata(ctx, volumeInfo.VolumeID.Id,
+			[]types.KeyValue{{Key: common.DeletionRetentionMetadataKey,
+				Value: strconv.FormatInt(scParams.DeletionRetentionMinutes, 10)}})
+		if err != nil {
+			return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to record deletion retention of volume %q. Error: %+v", volumeInfo.VolumeID.Id, err)
+		}
+	}
+	if scParams.SnapshotDeletePolicy != "" {
+		err = c.manager.VolumeManager.UpdateVStorageObjectMetadata(ctx, volumeInfo.VolumeID.Id,
+			[]types.KeyValue{{Key: common.SnapshotDeletePolicyMetadataKey, Value: scParams.SnapshotDeletePolicy}})
+		if err != nil {
+			return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to record snapshot delete policy of volume %q. Error: %+v", volumeInfo.VolumeID.Id, err)
+		}
+	}
+	if !scParams.RetainUntil.IsZero() {
+		// The lock is held in the FCD metadata, so that it is honored across
+		// restarts of the driver and by the syncer.
+		retainUntil := scParams.RetainUntil.Format(time.RFC3339)
+		err = c.manager.VolumeManager.UpdateVStorageObjectMetadata(ctx, volumeInfo.VolumeID.Id,
+			[]types.KeyValue{{Key: common.RetainUntilMetadataKey, Value: retainUntil}})
+		if err != nil {
+			return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to record retention lock of volume %q. Error: %+v", volumeInfo.VolumeID.Id, err)
+		}
+		attributes[common.AttributeRetainUntilVolumeContext] = retainUntil
+	}
+	if scParams.IopsLimit > 0 {
+		faultType, err = setVolumeIopsLimit(ctx, vcenter, c.manager.VolumeManager, volumeInfo.VolumeID.Id,
+			volumeInfo.DatastoreURL, scParams.IopsLimit)
+		if err != nil {
+			return nil, faultType, err
+		}
+	}
+	if scParams.StoragePod != "" {
+		datastoreURL := getVolumeDatastoreURL(ctx, c.manager.VolumeManager, volumeInfo)
+		if datastoreURL != "" {
+			attributes[common.AttributeStoragePodDatastoreURL] = datastoreURL
+		}
+	}
+	if scParams.DiskFormat != "" {
+		diskFormat, err := c.getEffectiveDiskFormat(ctx, volumeInfo.VolumeID.Id)
+		if err != nil {
+			// The disk format is only reported for debugging, do not fail the request.
+			log.Warnf("failed to get disk format of volume %q. Error: %+v", volumeInfo.VolumeID.Id, err)
+		} else {
+			attributes[common.AttributeEffectiveDiskFormat] = diskFormat
+		}
+	}
 	if csiMigrationFeatureState && scParams.CSIMigration == "true" {
 		// In case if feature state switch is enabled after controller is
 		// deployed, we need to initialize the volumeMigrationService.
@@ -893,6 +1273,188 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 	return resp, "", nil
 }
 
+// createClonedBlockVolume creates a block volume as a full copy of the given
+// source volume. The clone is placed on the datastore of the source volume with
+// the storage policy from the StorageClass, and is registered with CNS under
+// the requested volume name. Encrypted source volumes are cloned with the source
+// encryption key so that the cloned volume is never silently decrypted.
+func (c *controller) createClonedBlockVolume(ctx context.Context, req *csi.CreateVolumeRequest,
+	scParams *common.StorageClassParams, sourceVolumeID string, volSizeMB int64) (
+	*csi.CreateVolumeResponse, string, error) {
+	log := logger.GetLogger(ctx)
+	cnsVolumeDetailsMap, err := utils.QueryVolumeDetailsUtil(ctx, c.manager.VolumeManager,
+		[]cnstypes.CnsVolumeId{{Id: sourceVolumeID}})
+	if err != nil {
+		log.Errorf("failed to retrieve the volume: %s details. err: %+v", sourceVolumeID, err)
+		return nil, csifault.CSIInternalFault, err
+	}
+	sourceVolume, ok := cnsVolumeDetailsMap[sourceVolumeID]
+	if !ok {
+		return nil, csifault.CSINotFoundFault, logger.LogNewErrorCodef(log, codes.NotFound,
+			"source volume: %s not found", sourceVolumeID)
+	}
+	if sourceVolume.VolumeType != common.BlockVolumeType {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"source volume: %s is of type %s, only block volumes can be cloned",
+			sourceVolumeID, sourceVolume.VolumeType)
+	}
+	if volSizeMB < sourceVolume.SizeInMB {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"requested volume size %d MB is smaller than source volume: %s size %d MB",
+			volSizeMB, sourceVolumeID, sourceVolume.SizeInMB)
+	}
+	// The clone is created on the datastore of the source volume, so the
+	// datastores requested in the StorageClass must include it.
+	if (scParams.DatastoreURL != "" && scParams.DatastoreURL != sourceVolume.DatastoreUrl) ||
+		(len(scParams.DatastoreURLs) != 0 && !slices.Contains(scParams.DatastoreURLs, sourceVolume.DatastoreUrl)) {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"source volume: %s on datastore %q is not in the datastore scope of the StorageClass",
+			sourceVolumeID, sourceVolume.DatastoreUrl)
+	}
+
+	vcenter, err := c.manager.VcenterManager.GetVirtualCenter(ctx, c.manager.VcenterConfig.Host)
+	if err != nil {
+		return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to get vCenter. Err: %v", err)
+	}
+	vStorageObject, err := c.manager.VolumeManager.RetrieveVStorageObject(ctx, sourceVolumeID)
+	if err != nil {
+		return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to retrieve source volume: %s. Error: %+v", sourceVolumeID, err)
+	}
+	backingInfo, ok := vStorageObject.Config.Backing.(*types.BaseConfigInfoDiskFileBackingInfo)
+	if !ok {
+		return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to retrieve backing info of source volume: %s", sourceVolumeID)
+	}
+	cloneSpec := types.VslmCloneSpec{
+		Name: common.GetCnsVolumeName(scParams, req.Name),
+		VslmMigrateSpec: types.VslmMigrateSpec{
+			BackingSpec: &types.VslmCreateSpecDiskFileBackingSpec{
+				VslmCreateSpecBackingSpec: types.VslmCreateSpecBackingSpec{
+					Datastore: backingInfo.Datastore,
+				},
+			},
+		},
+	}
+	var storagePolicyID string
+	if scParams.StoragePolicyName != "" {
+		storagePolicyID, err = vcenter.GetStoragePolicyIDByName(ctx, scParams.StoragePolicyName)
+		if err != nil {
+			return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to get storage policy ID for storage policy %q. Error: %+v",
+				scParams.StoragePolicyName, err)
+		}
+		compat, err := vcenter.PbmCheckCompatibility(ctx,
+			[]types.ManagedObjectReference{backingInfo.Datastore}, storagePolicyID)
+		if err != nil {
+			return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to find datastore compatibility with storage policy ID %q. Error: %+v",
+				storagePolicyID, err)
+		}
+		if len(compat.CompatibleDatastores()) == 0 {
+			return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+				"storage policy %q is not compatible with datastore %q of source volume: %s",
+				scParams.StoragePolicyName, sourceVolume.DatastoreUrl, sourceVolumeID)
+		}
+		cloneSpec.Profile = []types.BaseVirtualMachineProfileSpec{
+			&types.VirtualMachineDefinedProfileSpec{ProfileId: storagePolicyID},
+		}
+	}
+	if backingInfo.KeyId != nil {
+		// Without an explicit crypto spec, vslm decrypts the clone when the
+		// target profile is not an encryption policy. Keep the source key instead.
+		log.Infof("source volume: %s is encrypted with key %q, cloned volume will inherit the key",
+			sourceVolumeID, backingInfo.KeyId.KeyId)
+		cloneSpec.DisksCrypto = &types.DiskCryptoSpec{Crypto: &types.CryptoSpecNoOp{}}
+	}
+
+	log.Infof("Cloning source volume: %s to volume %q on datastore %q", sourceVolumeID, req.Name,
+		sourceVolume.DatastoreUrl)
+	clonedDiskID, err := c.manager.VolumeManager.CloneVStorageObject(ctx, sourceVolumeID, cloneSpec)
+	if err != nil {
+		return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to clone source volume: %s. Error: %+v", sourceVolumeID, err)
+	}
+
+	// Register the cloned disk with CNS.
+	containerCluster := cnsvsphere.GetContainerCluster(c.manager.CnsConfig.Global.ClusterID,
+		c.manager.CnsConfig.VirtualCenter[vcenter.Config.Host].User, cnstypes.CnsClusterFlavorVanilla,
+		c.manager.CnsConfig.Global.ClusterDistribution)
+	createSpec := &cnstypes.CnsVolumeCreateSpec{
+		Name:       common.GetCnsVolumeName(scParams, req.Name),
+		VolumeType: common.BlockVolumeType,
+		Metadata: cnstypes.CnsVolumeMetadata{
+			ContainerCluster:      containerCluster,
+			ContainerClusterArray: []cnstypes.CnsContainerCluster{containerCluster},
+		},
+		BackingObjectDetails: &cnstypes.CnsBlockBackingDetails{
+			BackingDiskId: clonedDiskID,
+		},
+	}
+	volumeInfo, faultType, err := c.manager.VolumeManager.CreateVolume(ctx, createSpec, nil)
+	if err != nil {
+		return nil, faultType, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to register cloned volume %q with CNS. Error: %+v", clonedDiskID, err)
+	}
+	volumeID := volumeInfo.VolumeID.Id
+
+	// The clone may have been created by a previous request with the same name,
+	// in which case it is only returned if it is compatible with this request.
+	cloneSizeMB, faultType, err := validateClonedVolume(ctx, c.manager.VolumeManager, volumeID,
+		sourceVolume.DatastoreUrl, storagePolicyID, volSizeMB)
+	if err != nil {
+		return nil, faultType, err
+	}
+	if volSizeMB > cloneSizeMB {
+		log.Infof("Expanding cloned volume: %s from %d MB to %d MB", volumeID, cloneSizeMB, volSizeMB)
+		faultType, err = common.ExpandVolumeUtil(ctx, c.manager.VcenterManager, c.manager.VcenterConfig.Host,
+			c.manager.VolumeManager, volumeID, volSizeMB,
+			commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.AsyncQueryVolume), nil)
+		if err != nil {
+			return nil, faultType, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to expand cloned volume: %q to size: %d with error: %+v", volumeID, volSizeMB, err)
+		}
+	}
+
+	attributes := map[string]string{common.AttributeDiskType: common.DiskTypeBlockVolume}
+	if scParams.XFSProjectQuota {
+		attributes[common.AttributeXFSProjectQuota] = "true"
+	}
+	resp := &csi.CreateVolumeResponse{
+		Volume: &csi.Volume{
+			VolumeId:      volumeID,
+			CapacityBytes: int64(units.FileSize(volSizeMB * common.MbInBytes)),
+			VolumeContext: attributes,
+			ContentSource: &csi.VolumeContentSource{
+				Type: &csi.VolumeContentSource_Volume{
+					Volume: &csi.VolumeContentSource_VolumeSource{
+						VolumeId: sourceVolumeID,
+					},
+				},
+			},
+		},
+	}
+	if topologyRequirement := req.GetAccessibilityRequirements(); topologyRequirement != nil {
+		allNodeVMs, err := c.nodeMgr.GetAllNodes(ctx)
+		if err != nil {
+			return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to find VirtualMachines for the registered nodes in the cluster. Error: %v", err)
+		}
+		datastoreAccessibleTopology, err := c.getAccessibleTopologiesForDatastore(ctx, vcenter,
+			topologyRequirement, allNodeVMs, sourceVolume.DatastoreUrl)
+		if err != nil {
+			return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to calculate accessible topologies for the datastore %q", sourceVolume.DatastoreUrl)
+		}
+		for _, topoSegments := range datastoreAccessibleTopology {
+			resp.Volume.AccessibleTopology = append(resp.Volume.AccessibleTopology,
+				&csi.Topology{Segments: topoSegments})
+		}
+	}
+	return resp, "", nil
+}
+
 // getAccessibleTopologiesForDatastore figures out the list of topologies from
 // which the given datastore is accessible.
 func (c *controller) getAccessibleTopologiesForDatastore(ctx context.Context, vcenter *cnsvsphere.VirtualCenter,
@@ -923,14 +1485,23 @@ func (c *controller) getAccessibleTopologiesForDatastore(ctx context.Context, vc
 			return nil, logger.LogNewErrorCode(log, codes.Internal,
 				err.Error())
 		}
-		accessibleNodeNames = append(accessibleNodeNames, nodeName)
+		accessibleNodeNames = append(accessibleNodeNames, nodeName)
+	}
+
+	sharedDatastore := false
+	if c.manager.CnsConfig.Labels.HostTopology {
+		sharedDatastore, err = common.IsDatastoreSharedAcrossHosts(ctx, vcenter, datastoreURL)
+		if err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to find the hosts of datastore %q. Error: %+v", datastoreURL, err)
+		}
 	}
-
 	datastoreAccessibleTopology, err = c.topologyMgr.GetTopologyInfoFromNodes(ctx,
 		commoncotypes.VanillaRetrieveTopologyInfoParams{
 			NodeNames:           accessibleNodeNames,
 			DatastoreURL:        datastoreURL,
 			TopologyRequirement: topologyRequirement,
+			SharedDatastore:     sharedDatastore,
 		})
 	if err != nil {
 		return nil, logger.LogNewErrorCodef(log, codes.Internal,
@@ -945,12 +1516,10 @@ func (c *controller) getAccessibleTopologiesForDatastore(ctx context.Context, vc
 func (c *controller) createBlockVolumeWithPlacementEngineForMultiVC(ctx context.Context, req *csi.CreateVolumeRequest) (
 	*csi.CreateVolumeResponse, string, error) {
 	log := logger.GetLogger(ctx)
-	// Volume Size - Default is 10 GiB.
-	volSizeBytes := int64(common.DefaultGbDiskSize * common.GbInBytes)
-	if req.GetCapacityRange() != nil && req.GetCapacityRange().RequiredBytes != 0 {
-		volSizeBytes = int64(req.GetCapacityRange().GetRequiredBytes())
+	volSizeBytes, volSizeMB, err := common.GetVolumeSizeFromCapacityRange(ctx, req.GetCapacityRange())
+	if err != nil {
+		return nil, csifault.CSIInvalidArgumentFault, err
 	}
-	volSizeMB := int64(common.RoundUpSize(volSizeBytes, common.MbInBytes))
 
 	scParams, err := common.ParseStorageClassParams(ctx, req.Parameters, csiMigrationEnabled)
 	// TODO: Need to figure out the fault returned by ParseStorageClassParams.
@@ -959,6 +1528,57 @@ func (c *controller) createBlockVolumeWithPlacementEngineForMultiVC(ctx context.
 		return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
 			"parsing storage class parameters failed with error: %+v", err)
 	}
+	if scParams.XFSProjectQuota {
+		if err := common.ValidateXFSProjectQuotaRequest(req.GetVolumeCapabilities()); err != nil {
+			return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCode(log, codes.InvalidArgument,
+				err.Error())
+		}
+	}
+	if scParams.ReadOnlyClone {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is not supported in multi vCenter deployments", common.AttributeReadOnlyClone)
+	}
+	if scParams.IopsLimit > 0 {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"params %q and %q are not supported in multi vCenter deployments", common.AttributeIopsLimit,
+			common.AttributeThroughputLimit)
+	}
+	if len(scParams.DatastoreTags) != 0 {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is not supported in multi vCenter deployments", common.AttributeDatastoreTags)
+	}
+	if scParams.DeletionRetentionMinutes > 0 {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is not supported in multi vCenter deployments", common.AttributeDeletionRetentionMinutes)
+	}
+	if len(scParams.ZoneStoragePolicyIDs) != 0 {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is not supported in multi vCenter deployments", common.AttributeZoneStoragePolicyIDs)
+	}
+	if scParams.StoragePod != "" {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is not supported in multi vCenter deployments", common.AttributeStoragePod)
+	}
+	if scParams.QualifiedDatastore != "" {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is not supported in multi vCenter deployments", common.AttributeQualifiedDatastore)
+	}
+	if !scParams.RetainUntil.IsZero() {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is not supported in multi vCenter deployments", common.AttributeRetainUntil)
+	}
+	if scParams.SnapshotDeletePolicy != "" {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is not supported in multi vCenter deployments", common.AttributeSnapshotDeletePolicy)
+	}
+	if scParams.DryRun {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is not supported with the multi vCenter topology feature", common.AttributeDryRun)
+	}
+	if scParams.DiskFormat != "" {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is not supported with the multi vCenter topology feature", common.AttributeDiskFormat)
+	}
 
 	if scParams.CSIMigration == "true" {
 		if len(c.managers.VcenterConfigs) > 1 {
@@ -1017,6 +1637,10 @@ func (c *controller) createBlockVolumeWithPlacementEngineForMultiVC(ctx context.
 	volumeSource := req.GetVolumeContentSource()
 	var contentSourceSnapshotID, snapshotDatastoreURL string
 	if volumeSource != nil {
+		if volumeSource.GetVolume() != nil {
+			return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCode(log, codes.InvalidArgument,
+				"cloning from a volume is not supported in multi vCenter deployments")
+		}
 		sourceSnapshot := volumeSource.GetSnapshot()
 		if sourceSnapshot == nil {
 			return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCode(log, codes.InvalidArgument,
@@ -1078,7 +1702,7 @@ func (c *controller) createBlockVolumeWithPlacementEngineForMultiVC(ctx context.
 
 	var createVolumeSpec = common.CreateVolumeSpec{
 		CapacityMB:              volSizeMB,
-		Name:                    req.Name,
+		Name:                    common.GetCnsVolumeName(scParams, req.Name),
 		ScParams:                scParams,
 		VolumeType:              common.BlockVolumeType,
 		ContentSourceSnapshotID: contentSourceSnapshotID,
@@ -1107,7 +1731,7 @@ func (c *controller) createBlockVolumeWithPlacementEngineForMultiVC(ctx context.
 		break
 	}
 
-	volumeOperationDetails, err := operationStore.GetRequestDetails(ctx, req.Name)
+	volumeOperationDetails, err := operationStore.GetRequestDetails(ctx, common.GetCnsVolumeName(scParams, req.Name))
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			log.Debugf("CreateVolume task details for block volume %s are not found.", req.Name)
@@ -1189,7 +1813,7 @@ func (c *controller) createBlockVolumeWithPlacementEngineForMultiVC(ctx context.
 				return nil, csifault.CSIInternalFault, logger.LogNewErrorCode(log, codes.Internal, err.Error())
 			}
 			volumeInfo, faultType, err = volumeMgr.MonitorCreateVolumeTask(ctx,
-				&volumeOperationDetails, task, req.Name, c.managers.CnsConfig.Global.ClusterID)
+				&volumeOperationDetails, task, common.GetCnsVolumeName(scParams, req.Name), c.managers.CnsConfig.Global.ClusterID)
 			if err != nil {
 				return nil, faultType, logger.LogNewErrorCodef(log, codes.Internal,
 					"failed to monitor task for volume %s on VC %q. Error: %+v", req.Name, vcHost, err)
@@ -1318,6 +1942,19 @@ func (c *controller) createBlockVolumeWithPlacementEngineForMultiVC(ctx context.
 						"failed to filter datastores based on authorisation check in vCenter %q. Error: %+v",
 						vcHost, err)
 				}
+				// Restrict datastores to the allowlist given in the StorageClass.
+				if len(scParams.DatastoreURLs) != 0 {
+					sharedDatastores = common.FilterDatastoresByURLs(ctx, sharedDatastores, scParams.DatastoreURLs)
+					if len(sharedDatastores) == 0 {
+						errMsg := fmt.Sprintf("none of the compatible datastores found for accessibility "+
+							"requirements %+v associated with vCenter %q are present in %s: %v",
+							topologySegmentsList, vcHost, common.AttributeDatastoreURLs, scParams.DatastoreURLs)
+						log.Warn(errMsg)
+						combinedErrMssgs = append(combinedErrMssgs, errMsg)
+						faultType = csifault.CSIInvalidArgumentFault
+						continue
+					}
+				}
 				volumeMgr, err = GetVolumeManagerFromVCHost(ctx, c.managers, vcHost)
 				if err != nil {
 					return nil, csifault.CSIInternalFault, logger.LogNewErrorCode(log, codes.Internal, err.Error())
@@ -1389,6 +2026,16 @@ func (c *controller) createBlockVolumeWithPlacementEngineForMultiVC(ctx context.
 					"failed to create volume. Error: %+v", err)
 			}
 
+			// Restrict datastores to the allowlist given in the StorageClass.
+			if len(scParams.DatastoreURLs) != 0 {
+				sharedDatastores = common.FilterDatastoresByURLs(ctx, sharedDatastores, scParams.DatastoreURLs)
+				if len(sharedDatastores) == 0 {
+					return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+						"none of the compatible datastores are present in %s: %v",
+						common.AttributeDatastoreURLs, scParams.DatastoreURLs)
+				}
+			}
+
 			volumeInfo, faultType, err = common.CreateBlockVolumeUtilForMultiVC(ctx,
 				common.VanillaCreateBlockVolParamsForMultiVC{
 					Vcenter:              vcenter,
@@ -1411,12 +2058,19 @@ func (c *controller) createBlockVolumeWithPlacementEngineForMultiVC(ctx context.
 		if faultType == "" {
 			faultType = csifault.CSIInternalFault
 		}
-		return nil, faultType, logger.LogNewErrorCodef(log, codes.Internal,
+		errCode := codes.Internal
+		if faultType == csifault.CSIInvalidArgumentFault {
+			errCode = codes.InvalidArgument
+		}
+		return nil, faultType, logger.LogNewErrorCodef(log, errCode,
 			"failed to create volume. Errors encountered: %+v", combinedErrMssgs)
 	}
 
 	attributes := make(map[string]string)
 	attributes[common.AttributeDiskType] = common.DiskTypeBlockVolume
+	if scParams.XFSProjectQuota {
+		attributes[common.AttributeXFSProjectQuota] = "true"
+	}
 
 	if scParams.CSIMigration == "true" {
 		volumePath, err := volumeMigrationService.GetVolumePath(ctx, volumeInfo.VolumeID.Id)
@@ -1578,12 +2232,10 @@ func (c *controller) createFileVolume(ctx context.Context, req *csi.CreateVolume
 	*csi.CreateVolumeResponse, string, error) {
 	log := logger.GetLogger(ctx)
 
-	// Volume Size - Default is 10 GiB.
-	volSizeBytes := int64(common.DefaultGbDiskSize * common.GbInBytes)
-	if req.GetCapacityRange() != nil && req.GetCapacityRange().RequiredBytes != 0 {
-		volSizeBytes = int64(req.GetCapacityRange().GetRequiredBytes())
+	_, volSizeMB, err := common.GetVolumeSizeFromCapacityRange(ctx, req.GetCapacityRange())
+	if err != nil {
+		return nil, csifault.CSIInvalidArgumentFault, err
 	}
-	volSizeMB := int64(common.RoundUpSize(volSizeBytes, common.MbInBytes))
 
 	// Fetching the feature state for csi-migration before parsing storage class
 	// params.
@@ -1595,6 +2247,55 @@ func (c *controller) createFileVolume(ctx context.Context, req *csi.CreateVolume
 		return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
 			"parsing storage class parameters failed with error: %+v", err)
 	}
+	if scParams.XFSProjectQuota {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is not supported for file volumes", common.AttributeXFSProjectQuota)
+	}
+	if scParams.ReadOnlyClone {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is not supported for file volumes", common.AttributeReadOnlyClone)
+	}
+	if scParams.IopsLimit > 0 {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"params %q and %q are not supported for file volumes", common.AttributeIopsLimit,
+			common.AttributeThroughputLimit)
+	}
+	if len(scParams.DatastoreTags) != 0 {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is not supported for file volumes", common.AttributeDatastoreTags)
+	}
+	if scParams.DeletionRetentionMinutes > 0 {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is not supported for file volumes", common.AttributeDeletionRetentionMinutes)
+	}
+	if len(scParams.ZoneStoragePolicyIDs) != 0 {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is not supported for file volumes", common.AttributeZoneStoragePolicyIDs)
+	}
+	if scParams.StoragePod != "" {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is not supported for file volumes", common.AttributeStoragePod)
+	}
+	if scParams.QualifiedDatastore != "" {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is not supported for file volumes", common.AttributeQualifiedDatastore)
+	}
+	if !scParams.RetainUntil.IsZero() {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is not supported for file volumes", common.AttributeRetainUntil)
+	}
+	if scParams.SnapshotDeletePolicy != "" {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is not supported for file volumes", common.AttributeSnapshotDeletePolicy)
+	}
+	if scParams.DryRun {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is not supported for file volumes", common.AttributeDryRun)
+	}
+	if scParams.DiskFormat != "" {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"param %q is not supported for file volumes", common.AttributeDiskFormat)
+	}
 
 	var (
 		volTaskAlreadyRegistered bool
@@ -1628,7 +2329,7 @@ func (c *controller) createFileVolume(ctx context.Context, req *csi.CreateVolume
 	// Check if vCenter task for this volume is already registered as part of
 	// improved idempotency CR
 	log.Debugf("Checking if vCenter task for file volume %s is already registered.", req.Name)
-	volumeOperationDetails, err := operationStore.GetRequestDetails(ctx, req.Name)
+	volumeOperationDetails, err := operationStore.GetRequestDetails(ctx, common.GetCnsVolumeName(scParams, req.Name))
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			log.Debugf("CreateVolume task details for file volume %s are not found.", req.Name)
@@ -1685,10 +2386,10 @@ func (c *controller) createFileVolume(ctx context.Context, req *csi.CreateVolume
 			if multivCenterCSITopologyEnabled {
 				volumeManager := c.managers.VolumeManagers[vcHost]
 				volumeInfo, faultType, err = volumeManager.MonitorCreateVolumeTask(ctx,
-					&volumeOperationDetails, task, req.Name, c.managers.CnsConfig.Global.ClusterID)
+					&volumeOperationDetails, task, common.GetCnsVolumeName(scParams, req.Name), c.managers.CnsConfig.Global.ClusterID)
 			} else {
 				volumeInfo, faultType, err = c.manager.VolumeManager.MonitorCreateVolumeTask(ctx,
-					&volumeOperationDetails, task, req.Name, c.manager.CnsConfig.Global.ClusterID)
+					&volumeOperationDetails, task, common.GetCnsVolumeName(scParams, req.Name), c.manager.CnsConfig.Global.ClusterID)
 			}
 			if err != nil {
 				return nil, faultType, logger.LogNewErrorCodef(log, codes.Internal,
@@ -1729,7 +2430,7 @@ func (c *controller) createFileVolume(ctx context.Context, req *csi.CreateVolume
 		}
 		var createVolumeSpec = common.CreateVolumeSpec{
 			CapacityMB: volSizeMB,
-			Name:       req.Name,
+			Name:       common.GetCnsVolumeName(scParams, req.Name),
 			ScParams:   scParams,
 			VolumeType: common.FileVolumeType,
 		}
@@ -1742,6 +2443,9 @@ func (c *controller) createFileVolume(ctx context.Context, req *csi.CreateVolume
 					"volume topology feature for file volumes is not supported.")
 			}
 			var topologySegmentsList []map[string]string
+			// fileServiceEnabled is set if vSAN file service is enabled on a vSAN
+			// cluster of any of the vCenters in the topology requirement.
+			fileServiceEnabled := false
 			for vcHost, topologySegmentsList = range vcTopologySegmentsMap {
 				// Get VC instance.
 				vcenter, err = common.GetVCenterFromVCHost(ctx, c.managers.VcenterManager, vcHost)
@@ -1793,6 +2497,9 @@ func (c *controller) createFileVolume(ctx context.Context, req *csi.CreateVolume
 				// Filter File service enabled DS from candidate datastores.
 				var fsEnabledCandidateDatastores []*cnsvsphere.DatastoreInfo
 				fsEnabledClusterToDsInfoMap := c.authMgrs[vcHost].GetFsEnabledClusterToDsMap(ctx)
+				if len(fsEnabledClusterToDsInfoMap) != 0 {
+					fileServiceEnabled = true
+				}
 				for _, datastores := range fsEnabledClusterToDsInfoMap {
 					for _, fsEnabledDatastore := range datastores {
 						for _, ds := range candidateDatastores {
@@ -1875,6 +2582,11 @@ func (c *controller) createFileVolume(ctx context.Context, req *csi.CreateVolume
 			}
 			// After iterating over all VCs, if volumeID is still empty, we error out.
 			if volumeID == "" {
+				if !fileServiceEnabled && len(vcTopologySegmentsMap) != 0 {
+					return nil, csifault.CSIVSanFileServiceDisabledFault, logger.LogNewErrorCodef(log,
+						codes.Unimplemented, "failed to create file volume, vSAN file service is not enabled "+
+							"on any vSAN cluster. Errors encountered: %+v", combinedErrMssgs)
+				}
 				if faultType == "" {
 					faultType = csifault.CSIInternalFault
 				}
@@ -1897,8 +2609,8 @@ func (c *controller) createFileVolume(ctx context.Context, req *csi.CreateVolume
 			}
 			if len(filteredDatastores) == 0 {
 				// when len(filteredDatastore)==0, it means vsan file service is not enabled on any vsan cluster
-				return nil, csifault.CSIVSanFileServiceDisabledFault, logger.LogNewErrorCode(log, codes.FailedPrecondition,
-					"no datastores found to create file volume, vSAN file service may be disabled")
+				return nil, csifault.CSIVSanFileServiceDisabledFault, logger.LogNewErrorCode(log, codes.Unimplemented,
+					"no datastores found to create file volume, vSAN file service is not enabled on any vSAN cluster")
 			}
 
 			if multivCenterCSITopologyEnabled {
@@ -1953,6 +2665,8 @@ func (c *controller) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequ
 	*csi.CreateVolumeResponse, error) {
 	start := time.Now()
 	ctx = logger.NewContextWithLogger(ctx)
+	ctx = cnsvolume.ContextWithAuditRequester(ctx, req.Parameters[common.AttributePvcNamespace],
+		req.Parameters[common.AttributePvcName])
 	log := logger.GetLogger(ctx)
 
 	volumeType := prometheus.PrometheusUnknownVolumeType
@@ -1980,6 +2694,16 @@ func (c *controller) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequ
 				}
 			}
 			volumeType = prometheus.PrometheusFileVolumeType
+			var cnsConfig *cnsconfig.Config
+			if multivCenterCSITopologyEnabled {
+				cnsConfig = c.managers.CnsConfig
+			} else {
+				cnsConfig = c.manager.CnsConfig
+			}
+			if cnsConfig.Global.FileVolumesDisabled {
+				return nil, csifault.CSIUnimplementedFault, logger.LogNewErrorCode(log, codes.Unimplemented,
+					"file volume provisioning is disabled by \"file-volumes-disabled\" in the vSphere CSI config")
+			}
 			if multivCenterCSITopologyEnabled && len(c.managers.VcenterConfigs) > 1 {
 				isvSANFileServicesDisabledInAllVCs := true
 				for _, vcconfig := range c.managers.VcenterConfigs {
@@ -1996,7 +2720,7 @@ func (c *controller) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequ
 				}
 
 				if isvSANFileServicesDisabledInAllVCs {
-					return nil, csifault.CSIInternalFault, logger.LogNewErrorCode(log, codes.FailedPrecondition,
+					return nil, csifault.CSIUnimplementedFault, logger.LogNewErrorCode(log, codes.Unimplemented,
 						"fileshare volume creation is not supported on vSAN 67u3 release")
 				}
 				return c.createFileVolume(ctx, req)
@@ -2008,7 +2732,7 @@ func (c *controller) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequ
 						"failed to verify if vSAN file services is supported or not. Error:%+v", err)
 				}
 				if !isvSANFileServicesSupported {
-					return nil, csifault.CSIInternalFault, logger.LogNewErrorCode(log, codes.FailedPrecondition,
+					return nil, csifault.CSIUnimplementedFault, logger.LogNewErrorCode(log, codes.Unimplemented,
 						"fileshare volume creation is not supported on vSAN 67u3 release")
 				}
 				return c.createFileVolume(ctx, req)
@@ -2018,7 +2742,7 @@ func (c *controller) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequ
 		if multivCenterCSITopologyEnabled {
 			return c.createBlockVolumeWithPlacementEngineForMultiVC(ctx, req)
 		} else {
-			return c.createBlockVolume(ctx, req)
+			return c.createBlockVolumeWithinQuota(ctx, req)
 		}
 	}
 	resp, faultType, err := createVolumeInternal()
@@ -2133,11 +2857,53 @@ func (c *controller) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequ
 				if len(snapshots) == 0 {
 					log.Infof("no CNS snapshots found for volume: %s, the volume can be safely deleted",
 						req.VolumeId)
+				} else if getSnapshotDeletePolicy(ctx, volumeManager, req.VolumeId) ==
+					common.SnapshotDeletePolicyCascade {
+					faultType, err = deleteVolumeSnapshots(ctx, volumeManager, req.VolumeId, snapshots)
+					if err != nil {
+						return nil, faultType, err
+					}
 				} else {
 					return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.FailedPrecondition,
-						"volume: %s with existing snapshots %v cannot be deleted, "+
-							"please delete snapshots before deleting the volume", req.VolumeId, snapshots)
+						"volume %q cannot be deleted as it has snapshots %s, please delete them before deleting "+
+							"the volume", req.VolumeId, describeVolumeSnapshots(ctx, snapshots))
+				}
+			}
+		}
+		// Block volumes cannot be deleted before their retention lock expires.
+		// The lock is checked before the volume is soft deleted, so that its
+		// disk is not destroyed by the soft delete reconciler either.
+		if cnsVolumeType == common.BlockVolumeType && volumePath == "" && !multivCenterCSITopologyEnabled {
+			// The deletion is retried if the lock cannot be checked, so that a
+			// locked volume is never deleted because vCenter failed to serve its
+			// metadata.
+			retainUntil, err := common.GetVolumeRetainUntil(ctx, volumeManager, req.VolumeId)
+			if err != nil {
+				return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Unavailable,
+					"failed to retrieve the retention lock of volume %q, retry the deletion. Error: %+v",
+					req.VolumeId, err)
+			}
+			if time.Now().Before(retainUntil) {
+				return nil, csifault.CSIFailedPreconditionFault, logger.LogNewErrorCodef(log,
+					codes.FailedPrecondition, "volume %q is retention locked until %s and cannot be deleted",
+					req.VolumeId, retainUntil.Format(time.RFC3339))
+			}
+		}
+		// Block volumes provisioned with a deletion retention window are soft
+		// deleted, their disk is destroyed by the soft delete reconciler.
+		if cnsVolumeType == common.BlockVolumeType && volumePath == "" && !multivCenterCSITopologyEnabled {
+			retention, err := getDeletionRetention(ctx, volumeManager, req.VolumeId)
+			if err != nil {
+				return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Unavailable,
+					"failed to retrieve the deletion retention of volume %q, retry the deletion. Error: %+v",
+					req.VolumeId, err)
+			}
+			if retention > 0 {
+				faultType, err = c.softDeleteVolume(ctx, volumeManager, vCenterHost, req.VolumeId, retention)
+				if err != nil {
+					return nil, faultType, err
 				}
+				return &csi.DeleteVolumeResponse{}, "", nil
 			}
 		}
 		faultType, err = common.DeleteVolumeUtil(ctx, volumeManager, req.VolumeId, true)
@@ -2177,6 +2943,7 @@ func (c *controller) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequ
 			prometheus.PrometheusFailStatus, faultType).Observe(time.Since(start).Seconds())
 	} else {
 		log.Infof("Volume %q deleted successfully.", req.VolumeId)
+		namespaceQuotas.removeVolume(req.VolumeId)
 		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusDeleteVolumeOpType,
 			prometheus.PrometheusPassStatus, faultType).Observe(time.Since(start).Seconds())
 	}
@@ -2208,7 +2975,8 @@ func (c *controller) ControllerPublishVolume(ctx context.Context, req *csi.Contr
 				"validation for PublishVolume Request: %+v has failed. Error: %v", *req, err)
 		}
 		publishInfo := make(map[string]string)
-		_, volumeManager, err := getVCenterAndVolumeManagerForVolumeID(ctx, c, req.VolumeId, volumeInfoService)
+		volumeVCHost, volumeManager, err := getVCenterAndVolumeManagerForVolumeID(ctx, c, req.VolumeId,
+			volumeInfoService)
 		if err != nil {
 			return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
 				"failed to get volume manager for volume Id: %q. Error: %v", req.VolumeId, err)
@@ -2282,6 +3050,12 @@ func (c *controller) ControllerPublishVolume(ctx context.Context, req *csi.Contr
 					return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
 						"failed to set keepAfterDeleteVm control flag for VolumeID %q", req.VolumeId)
 				}
+			} else {
+				faultType, err := validateStaticVolumeForAttach(ctx, volumeManager, req.VolumeId,
+					req.VolumeContext, c.getClusterID())
+				if err != nil {
+					return nil, faultType, err
+				}
 			}
 			var nodevm *cnsvsphere.VirtualMachine
 			// if node is not yet updated to run the release of the driver publishing Node VM UUID as Node ID
@@ -2292,19 +3066,111 @@ func (c *controller) ControllerPublishVolume(ctx context.Context, req *csi.Contr
 				nodevm, err = c.nodeMgr.GetNodeVMByUuid(ctx, req.NodeId)
 			}
 			if err != nil {
-				return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, nodeVMLookupErrorCode(err),
 					"failed to find VirtualMachine for node:%q. Error: %v", req.NodeId, err)
 			}
 			log.Debugf("Found VirtualMachine for node:%q.", req.NodeId)
+			// In a multi vCenter deployment, volume can only be attached to a node VM
+			// belonging to the same vCenter as the volume.
+			if multivCenterCSITopologyEnabled && len(c.managers.VcenterConfigs) > 1 &&
+				nodevm.VirtualCenterHost != volumeVCHost {
+				return nil, csifault.CSIFailedPreconditionFault, logger.LogNewErrorCodef(log, codes.FailedPrecondition,
+					"volume %q belongs to vCenter %q, but node %q belongs to vCenter %q. "+
+						"Cross vCenter attach is not supported", req.VolumeId, volumeVCHost, req.NodeId,
+					nodevm.VirtualCenterHost)
+			}
+			scsiSlotHint := req.VolumeContext[common.AttributeSCSISlotHint]
+			var scsiBus, scsiUnit int32
+			if scsiSlotHint != "" {
+				scsiBus, scsiUnit, err = common.ParseSCSISlot(scsiSlotHint)
+				if err != nil {
+					return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log,
+						codes.InvalidArgument, "invalid %s volume context parameter for volume %q. Error: %v",
+						common.AttributeSCSISlotHint, req.VolumeId, err)
+				}
+			}
+			multiWriter := common.IsMultiWriterBlockVolumeRequest(ctx,
+				[]*csi.VolumeCapability{req.GetVolumeCapability()})
+			// The FCD metadata is checked as well as the volume context, so that
+			// statically provisioned PVs of read-only clones are published
+			// read-only too.
+			readOnlyClone := req.VolumeContext[common.AttributeReadOnlyClone] == "true" ||
+				isReadOnlyCloneVolume(ctx, volumeManager, req.VolumeId)
+			if readOnlyClone && multiWriter {
+				return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+					"volume %q is a read-only clone and cannot be published with access mode %q", req.VolumeId,
+					req.GetVolumeCapability().GetAccessMode().GetMode())
+			}
+			attachVolume := func() (string, string, error) {
+				if multiWriter {
+					unit := int32(-1)
+					if scsiSlotHint != "" {
+						unit = scsiUnit
+					}
+					return common.AttachMultiWriterVolumeUtil(ctx, volumeManager, nodevm, req.VolumeId,
+						scsiBus, unit)
+				}
+				// The CNS attach API does not support selecting the SCSI controller
+				// slot, the volume is attached to the slot chosen by vCenter.
+				return common.AttachVolumeUtil(ctx, volumeManager, nodevm, req.VolumeId, false)
+			}
+			releaseAttachSlot, err := acquireAttachSlot(ctx, nodevm)
+			if err != nil {
+				return nil, csifault.CSIInternalFault, err
+			}
 			// faultType is returned from manager.AttachVolume.
-			diskUUID, faultType, err := common.AttachVolumeUtil(ctx, volumeManager, nodevm, req.VolumeId,
-				false)
+			diskUUID, faultType, err := attachVolume()
+			releaseAttachSlot()
+			if err != nil && isInaccessibleDatastoreAttachFault(faultType) &&
+				c.relocateVolumeForAttach(ctx, volumeManager, nodevm, req.VolumeId) {
+				releaseAttachSlot, slotErr := acquireAttachSlot(ctx, nodevm)
+				if slotErr != nil {
+					return nil, csifault.CSIInternalFault, slotErr
+				}
+				diskUUID, faultType, err = attachVolume()
+				releaseAttachSlot()
+			}
+			if err != nil && isVolumeInUseAttachFault(faultType) &&
+				c.detachVolumeFromStaleNodeVMs(ctx, volumeManager, nodevm, req.VolumeId) {
+				releaseAttachSlot, slotErr := acquireAttachSlot(ctx, nodevm)
+				if slotErr != nil {
+					return nil, csifault.CSIInternalFault, slotErr
+				}
+				diskUUID, faultType, err = attachVolume()
+				releaseAttachSlot()
+			}
 			if err != nil {
+				if status.Code(err) == codes.FailedPrecondition {
+					return nil, faultType, err
+				}
 				return nil, faultType, logger.LogNewErrorCodef(log, codes.Internal,
 					"failed to attach disk: %+q with node: %q err %+v", req.VolumeId, req.NodeId, err)
 			}
+			faultType, err = applyVolumeIopsLimit(ctx, volumeManager, nodevm, req.VolumeId)
+			if err != nil {
+				return nil, faultType, err
+			}
 			publishInfo[common.AttributeDiskType] = common.DiskTypeBlockVolume
 			publishInfo[common.AttributeFirstClassDiskUUID] = common.FormatDiskUUID(diskUUID)
+			if readOnlyClone {
+				// The node plugin mounts the volume read-only.
+				publishInfo[common.AttributeReadOnlyClone] = "true"
+			}
+			if scsiSlotHint != "" {
+				// Record the slot the volume landed on, which differs from the hint
+				// if the hinted slot was taken or could not be selected.
+				bus, unit, found, err := nodevm.GetDiskSCSISlot(ctx, req.VolumeId)
+				if err != nil {
+					log.Warnf("failed to get the SCSI slot of volume %q on node %q. Err: %v",
+						req.VolumeId, req.NodeId, err)
+				} else if found {
+					publishInfo[common.AttributeSCSISlot] = common.FormatSCSISlot(bus, unit)
+					if bus != scsiBus || unit != scsiUnit {
+						log.Infof("Volume %q is attached to SCSI slot %s of node %q instead of the hinted slot %s",
+							req.VolumeId, common.FormatSCSISlot(bus, unit), req.NodeId, scsiSlotHint)
+					}
+				}
+			}
 		}
 		log.Infof("ControllerPublishVolume successful with publish context: %v", publishInfo)
 		return &csi.ControllerPublishVolumeResponse{
@@ -2436,11 +3302,42 @@ func (c *controller) ControllerUnpublishVolume(ctx context.Context, req *csi.Con
 					"Marking ControllerUnpublishVolume for Volume: %q as successful.", req.NodeId, req.VolumeId)
 				return &csi.ControllerUnpublishVolumeResponse{}, "", nil
 			} else {
-				return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, nodeVMLookupErrorCode(err),
 					"failed to find VirtualMachine for node:%q. Error: %v", req.NodeId, err)
 			}
 		}
-		faultType, err = common.DetachVolumeUtil(ctx, volumeManager, nodevm, req.VolumeId)
+		// The volumes of a node are detached in parallel up to the limits per
+		// node and per host.
+		detachTracker.begin(req.NodeId)
+		release, err := acquireDetachSlots(ctx, nodevm)
+		if err != nil {
+			detachTracker.end(ctx, req.NodeId, err)
+			return nil, csifault.CSIInternalFault, err
+		}
+		// Volumes shared in multi-writer mode are attached by reconfiguring the
+		// node VM, and are detached the same way so that the disk is removed
+		// from this node VM only, leaving the attachments to the other nodes.
+		// The devices of the node VM are only scanned for volumes marked as
+		// multi-writer volumes.
+		var detached bool
+		multiWriter, err := isMultiWriterVolume(ctx, volumeManager, req.VolumeId)
+		if err == nil && multiWriter {
+			detached, err = volumeManager.DetachMultiWriterDisk(ctx, nodevm, req.VolumeId)
+		}
+		if err == nil && !detached {
+			faultType, err = common.DetachVolumeUtil(ctx, volumeManager, nodevm, req.VolumeId)
+		} else if err != nil {
+			faultType = csifault.CSIInternalFault
+		}
+		release()
+		if errors.Is(err, cnsvsphere.ErrVMNotFound) {
+			// The node VM was removed while detaching, e.g. as its node died,
+			// which leaves the volume detached from it.
+			err = nil
+			log.Infof("Virtual Machine for Node ID: %v was removed from the VC Inventory. "+
+				"Marking ControllerUnpublishVolume for Volume: %q as successful.", req.NodeId, req.VolumeId)
+		}
+		detachTracker.end(ctx, req.NodeId, err)
 		if err != nil {
 			return nil, faultType, logger.LogNewErrorCodef(log, codes.Internal,
 				"failed to detach disk: %+q from node: %q err %+v", req.VolumeId, req.NodeId, err)
@@ -2556,11 +3453,30 @@ func (c *controller) ControllerExpandVolume(ctx context.Context, req *csi.Contro
 			}
 		}
 
+		// Preflight checks to reject the expansion upfront instead of failing in the CNS task.
+		if snapshotOperations.inProgress(volumeID) {
+			return nil, csifault.CSIFailedPreconditionFault, logger.LogNewErrorCodef(log, codes.Aborted,
+				"volume: %s cannot be expanded while a snapshot operation is in progress on it", volumeID)
+		}
+		faultType, err = checkReadOnlyCloneForExpansion(ctx, volumeManager, volumeID)
+		if err != nil {
+			return nil, faultType, err
+		}
+		vCenter, err := common.GetVCenterFromVCHost(ctx, vCenterManager, vCenterHost)
+		if err != nil {
+			return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to get vCenter instance for host %q. Error: %+v", vCenterHost, err)
+		}
+		faultType, err = checkDatastoreCapacityForExpansion(ctx, vCenter, volumeManager, volumeID, volSizeMB)
+		if err != nil {
+			return nil, faultType, err
+		}
+
 		faultType, err = common.ExpandVolumeUtil(ctx, vCenterManager, vCenterHost, volumeManager, volumeID,
 			volSizeMB, commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.AsyncQueryVolume), nil)
 		if err != nil {
 			return nil, faultType, logger.LogNewErrorCodef(log, codes.Internal,
-				"failed to expand volume: %q to size: %d with error: %+v", "df", volSizeMB, err)
+				"failed to expand volume: %q to size: %d with error: %+v", volumeID, volSizeMB, err)
 		}
 
 		// Always set nodeExpansionRequired to true, even if requested size is equal
@@ -2569,11 +3485,11 @@ func (c *controller) ControllerExpandVolume(ctx context.Context, req *csi.Contro
 		// nodeExpandsionRequired to false marks PVC resize as finished which
 		// prevents kubelet from expanding the filesystem.
 		// Ref: https://github.com/kubernetes-csi/external-resizer/blob/master/pkg/controller/controller.go#L335
+		// Node expansion is also required for raw block volumes, as the device
+		// needs to be rescanned on the node for the guest OS to see the new size.
+		// The expansion of the PVC is thus only complete once the filesystem is
+		// grown by NodeExpandVolume, which reports why it failed, if it does.
 		nodeExpansionRequired := true
-		// Node expansion is not required for raw block volumes.
-		if _, ok := req.GetVolumeCapability().GetAccessType().(*csi.VolumeCapability_Block); ok {
-			nodeExpansionRequired = false
-		}
 		log.Debugf("ControllerExpandVolumeInternal: returns %v as capacity and %v as NodeExpansionRequired",
 			int64(units.FileSize(volSizeMB*common.MbInBytes)), nodeExpansionRequired)
 		resp := &csi.ControllerExpandVolumeResponse{
@@ -2872,7 +3788,7 @@ func (c *controller) GetCapacity(ctx context.Context, req *csi.GetCapacityReques
 	ctx = logger.NewContextWithLogger(ctx)
 	log := logger.GetLogger(ctx)
 	log.Infof("GetCapacity: called with args %+v", *req)
-	return nil, logger.LogNewErrorCode(log, codes.Unimplemented, "getCapacity")
+	return c.getCapacity(ctx, req)
 }
 
 // initVolumeMigrationService is a helper method to initialize
@@ -2923,6 +3839,14 @@ func (c *controller) ControllerGetCapabilities(ctx context.Context, req *csi.Con
 		csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
 		csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
 		csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
+		csi.ControllerServiceCapability_RPC_GET_VOLUME,
+		csi.ControllerServiceCapability_RPC_VOLUME_CONDITION,
+		csi.ControllerServiceCapability_RPC_MODIFY_VOLUME,
+		csi.ControllerServiceCapability_RPC_GET_CAPACITY,
+	}
+	// Cloning from a volume is not supported in multi vCenter deployments.
+	if !multivCenterCSITopologyEnabled {
+		controllerCaps = append(controllerCaps, csi.ControllerServiceCapability_RPC_CLONE_VOLUME)
 	}
 
 	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.ListVolumes) {
@@ -2943,19 +3867,116 @@ func (c *controller) ControllerGetCapabilities(ctx context.Context, req *csi.Con
 	return &csi.ControllerGetCapabilitiesResponse{Capabilities: caps}, nil
 }
 
-func (c *controller) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequest) (
-	*csi.CreateSnapshotResponse, error) {
-	ctx = logger.NewContextWithLogger(ctx)
+// queryUntrackedVolumeSnapshot returns the CNS snapshot of the volume created
+// for the CSI snapshot snapshotName if the operation store has no details of
+// its creation, or nil if there is no such snapshot.
+func (c *controller) queryUntrackedVolumeSnapshot(ctx context.Context, volumeManager cnsvolume.Manager,
+	volumeID string, snapshotName string) (*cnstypes.CnsSnapshot, error) {
+	log := logger.GetLogger(ctx)
+	operationStore := volumeManager.GetOperationStore()
+	if operationStore != nil {
+		instanceName := cnsvolume.GetCnsSnapshotDescription(snapshotName, volumeID)
+		_, err := operationStore.GetRequestDetails(ctx, instanceName)
+		if err == nil {
+			return nil, nil
+		}
+		if !apierrors.IsNotFound(err) {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"error occurred while getting CreateSnapshot task details for snapshot %s, err: %+v",
+				instanceName, err)
+		}
+	}
+	existingSnapshot, err := common.QueryVolumeSnapshotByName(ctx, volumeManager, volumeID, snapshotName)
+	if err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to check existing snapshots on volume %q with error: %v", volumeID, err)
+	}
+	return existingSnapshot, nil
+}
+
+// checkSnapshotQuota returns codes.ResourceExhausted if the volume already has
+// the maximum number of snapshots allowed on its datastore, so that the
+// snapshot is rejected upfront instead of failing in CNS.
+func (c *controller) checkSnapshotQuota(ctx context.Context, volumeManager cnsvolume.Manager,
+	volumeID string, datastoreURL string) error {
+	log := logger.GetLogger(ctx)
+	// The limit is the granular one on VSAN/VVOL if configured, the global one otherwise.
+	maxSnapshotsPerBlockVolume := c.getMaxSnapshotsPerBlockVolume(ctx, datastoreURL)
+	snapshotList, _, err := common.QueryVolumeSnapshotsByVolumeID(ctx, volumeManager, volumeID,
+		common.QuerySnapshotLimit)
+	if err != nil {
+		return logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to query snapshots of volume %s for the limit check. Error: %v", volumeID, err)
+	}
+	if len(snapshotList) >= maxSnapshotsPerBlockVolume {
+		return logger.LogNewErrorCodef(log, codes.ResourceExhausted,
+			"the number of snapshots on the source volume %s reaches the configured maximum (%d of %d). "+
+				"Delete existing snapshots of the volume, or raise the maximum in the [Snapshot] section of "+
+				"the vSphere config secret up to the limit of the vSphere version in use",
+			volumeID, len(snapshotList), maxSnapshotsPerBlockVolume)
+	}
+	return nil
+}
+
+// getMaxSnapshotsPerBlockVolume returns the maximum number of snapshots allowed
+// per block volume on the datastore with the given url.
+func (c *controller) getMaxSnapshotsPerBlockVolume(ctx context.Context, datastoreUrl string) int {
 	log := logger.GetLogger(ctx)
 	var (
-		vCenterHost                              string
-		vCenterManager                           cnsvsphere.VirtualCenterManager
-		volumeManager                            cnsvolume.Manager
-		err                                      error
 		maxSnapshotsPerBlockVolume               int
 		granularMaxSnapshotsPerBlockVolumeInVSAN int
 		granularMaxSnapshotsPerBlockVolumeInVVOL int
 	)
+	if multivCenterCSITopologyEnabled {
+		maxSnapshotsPerBlockVolume = c.managers.CnsConfig.Snapshot.GlobalMaxSnapshotsPerBlockVolume
+		granularMaxSnapshotsPerBlockVolumeInVSAN =
+			c.managers.CnsConfig.Snapshot.GranularMaxSnapshotsPerBlockVolumeInVSAN
+		granularMaxSnapshotsPerBlockVolumeInVVOL =
+			c.managers.CnsConfig.Snapshot.GranularMaxSnapshotsPerBlockVolumeInVVOL
+	} else {
+		maxSnapshotsPerBlockVolume = c.manager.CnsConfig.Snapshot.GlobalMaxSnapshotsPerBlockVolume
+		granularMaxSnapshotsPerBlockVolumeInVSAN =
+			c.manager.CnsConfig.Snapshot.GranularMaxSnapshotsPerBlockVolumeInVSAN
+		granularMaxSnapshotsPerBlockVolumeInVVOL =
+			c.manager.CnsConfig.Snapshot.GranularMaxSnapshotsPerBlockVolumeInVVOL
+	}
+	log.Infof("The limit of the maximum number of snapshots per block volume is "+
+		"set to the global maximum (%v) by default.", maxSnapshotsPerBlockVolume)
+
+	if granularMaxSnapshotsPerBlockVolumeInVSAN > 0 || granularMaxSnapshotsPerBlockVolumeInVVOL > 0 {
+		var isGranularMaxEnabled bool
+		if strings.Contains(datastoreUrl, strings.ToLower(string(types.HostFileSystemVolumeFileSystemTypeVsan))) {
+			if granularMaxSnapshotsPerBlockVolumeInVSAN > 0 {
+				maxSnapshotsPerBlockVolume = granularMaxSnapshotsPerBlockVolumeInVSAN
+				isGranularMaxEnabled = true
+			}
+		} else if strings.Contains(datastoreUrl, strings.ToLower(string(types.HostFileSystemVolumeFileSystemTypeVVOL))) {
+			if granularMaxSnapshotsPerBlockVolumeInVVOL > 0 {
+				maxSnapshotsPerBlockVolume = granularMaxSnapshotsPerBlockVolumeInVVOL
+				isGranularMaxEnabled = true
+			}
+		}
+
+		if isGranularMaxEnabled {
+			log.Infof("The limit of the maximum number of snapshots per block volume on datastore %q is "+
+				"overridden by the granular maximum (%v).", datastoreUrl, maxSnapshotsPerBlockVolume)
+		}
+	}
+	return maxSnapshotsPerBlockVolume
+}
+
+func (c *controller) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequest) (
+	*csi.CreateSnapshotResponse, error) {
+	ctx = logger.NewContextWithLogger(ctx)
+	ctx = cnsvolume.ContextWithAuditRequester(ctx, req.Parameters[common.VolumeSnapshotNamespaceKey],
+		req.Parameters[common.VolumeSnapshotNameKey])
+	log := logger.GetLogger(ctx)
+	var (
+		vCenterHost    string
+		vCenterManager cnsvsphere.VirtualCenterManager
+		volumeManager  cnsvolume.Manager
+		err            error
+	)
 	log.Infof("CreateSnapshot: called with args %+v", *req)
 
 	isBlockVolumeSnapshotEnabled := commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.BlockVolumeSnapshot)
@@ -2983,6 +4004,8 @@ func (c *controller) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshot
 	}
 	volumeType := prometheus.PrometheusUnknownVolumeType
 	createSnapshotInternal := func() (*csi.CreateSnapshotResponse, error) {
+		snapshotOperations.start(volumeID)
+		defer snapshotOperations.done(volumeID)
 		// Validate CreateSnapshotRequest
 		if err := validateVanillaCreateSnapshotRequestRequest(ctx, req); err != nil {
 			return nil, logger.LogNewErrorCodef(log, codes.Internal,
@@ -3012,55 +4035,30 @@ func (c *controller) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshot
 				"queried volume doesn't have the expected volume type. Expected VolumeType: %v. "+
 					"Queried VolumeType: %v", volumeType, cnsVolumeDetailsMap[volumeID].VolumeType)
 		}
-		// Check if snapshots number of this volume reaches the granular limit on VSAN/VVOL
-		if multivCenterCSITopologyEnabled {
-			maxSnapshotsPerBlockVolume = c.managers.CnsConfig.Snapshot.GlobalMaxSnapshotsPerBlockVolume
-			granularMaxSnapshotsPerBlockVolumeInVSAN =
-				c.managers.CnsConfig.Snapshot.GranularMaxSnapshotsPerBlockVolumeInVSAN
-			granularMaxSnapshotsPerBlockVolumeInVVOL =
-				c.managers.CnsConfig.Snapshot.GranularMaxSnapshotsPerBlockVolumeInVVOL
-		} else {
-			maxSnapshotsPerBlockVolume = c.manager.CnsConfig.Snapshot.GlobalMaxSnapshotsPerBlockVolume
-			granularMaxSnapshotsPerBlockVolumeInVSAN =
-				c.manager.CnsConfig.Snapshot.GranularMaxSnapshotsPerBlockVolumeInVSAN
-			granularMaxSnapshotsPerBlockVolumeInVVOL =
-				c.manager.CnsConfig.Snapshot.GranularMaxSnapshotsPerBlockVolumeInVVOL
-		}
-		log.Infof("The limit of the maximum number of snapshots per block volume is "+
-			"set to the global maximum (%v) by default.", maxSnapshotsPerBlockVolume)
-
-		if granularMaxSnapshotsPerBlockVolumeInVSAN > 0 || granularMaxSnapshotsPerBlockVolumeInVVOL > 0 {
-			var isGranularMaxEnabled bool
-			if strings.Contains(datastoreUrl, strings.ToLower(string(types.HostFileSystemVolumeFileSystemTypeVsan))) {
-				if granularMaxSnapshotsPerBlockVolumeInVSAN > 0 {
-					maxSnapshotsPerBlockVolume = granularMaxSnapshotsPerBlockVolumeInVSAN
-					isGranularMaxEnabled = true
-				}
-			} else if strings.Contains(datastoreUrl, strings.ToLower(string(types.HostFileSystemVolumeFileSystemTypeVVOL))) {
-				if granularMaxSnapshotsPerBlockVolumeInVVOL > 0 {
-					maxSnapshotsPerBlockVolume = granularMaxSnapshotsPerBlockVolumeInVVOL
-					isGranularMaxEnabled = true
-				}
-			}
-
-			if isGranularMaxEnabled {
-				log.Infof("The limit of the maximum number of snapshots per block volume on datastore %q is "+
-					"overridden by the granular maximum (%v).", datastoreUrl, maxSnapshotsPerBlockVolume)
-			}
-		}
-
-		// Check if snapshots number of this volume reaches the limit
-		snapshotList, _, err := common.QueryVolumeSnapshotsByVolumeID(ctx, volumeManager, volumeID,
-			common.QuerySnapshotLimit)
+		// The snapshot may have been created by a previous call whose response was lost, e.g. on a timeout,
+		// without its operation details being persisted. Return the existing snapshot instead of creating a
+		// duplicate one. Snapshots with persisted operation details are handled by the volume manager.
+		existingSnapshot, err := c.queryUntrackedVolumeSnapshot(ctx, volumeManager, volumeID, req.Name)
 		if err != nil {
-			return nil, logger.LogNewErrorCodef(log, codes.Internal,
-				"failed to query snapshots of volume %s for the limit check. Error: %v", volumeID, err)
+			return nil, err
 		}
-
-		if len(snapshotList) >= maxSnapshotsPerBlockVolume {
-			return nil, logger.LogNewErrorCodef(log, codes.FailedPrecondition,
-				"the number of snapshots on the source volume %s reaches the configured maximum (%v)",
-				volumeID, maxSnapshotsPerBlockVolume)
+		if existingSnapshot != nil {
+			snapshotID := volumeID + common.VSphereCSISnapshotIdDelimiter + existingSnapshot.SnapshotId.Id
+			log.Infof("CreateSnapshot: snapshot %q with name %q already exists on volume %q",
+				snapshotID, req.Name, volumeID)
+			return &csi.CreateSnapshotResponse{
+				Snapshot: &csi.Snapshot{
+					SizeBytes:      snapshotSizeInMB * common.MbInBytes,
+					SnapshotId:     snapshotID,
+					SourceVolumeId: volumeID,
+					CreationTime:   timestamppb.New(existingSnapshot.CreateTime),
+					ReadyToUse:     true,
+				},
+			}, nil
+		}
+		// Check if snapshots number of this volume reaches the limit.
+		if err := c.checkSnapshotQuota(ctx, volumeManager, volumeID, datastoreUrl); err != nil {
+			return nil, err
 		}
 
 		// the returned snapshotID below is a combination of CNS VolumeID and CNS SnapshotID concatenated by the "+"
@@ -3129,6 +4127,35 @@ func (c *controller) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshot
 	if err != nil {
 		return nil, logger.LogNewErrorCode(log, codes.InvalidArgument, err.Error())
 	}
+	if multivCenterCSITopologyEnabled && len(c.managers.VcenterConfigs) > 1 {
+		// The CnsVolumeInfo CR mapping the volume to its vCenter is deleted
+		// along with the volume. The snapshot is only gone as well if no
+		// vCenter has the volume.
+		volumeInfoExists, err := volumeInfoService.VolumeInfoCrExistsForVolume(ctx, volumeID)
+		if err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to find the vCenter of snapshot %q. Error: %v", req.SnapshotId, err)
+		}
+		if !volumeInfoExists {
+			volumeManagers := make([]cnsvolume.Manager, 0, len(c.managers.VolumeManagers))
+			for _, volumeManager := range c.managers.VolumeManagers {
+				volumeManagers = append(volumeManagers, volumeManager)
+			}
+			deleted, err := isVolumeDeleted(ctx, volumeID, volumeManagers...)
+			if err != nil {
+				return nil, logger.LogNewErrorCodef(log, codes.Internal,
+					"failed to find the vCenter of snapshot %q. Error: %v", req.SnapshotId, err)
+			}
+			if !deleted {
+				return nil, logger.LogNewErrorCodef(log, codes.Internal,
+					"failed to find the vCenter of snapshot %q, volume %q has no CnsVolumeInfo CR",
+					req.SnapshotId, volumeID)
+			}
+			log.Infof("DeleteSnapshot: volume %q of snapshot %q is deleted, assuming the snapshot is deleted",
+				volumeID, req.SnapshotId)
+			return &csi.DeleteSnapshotResponse{}, nil
+		}
+	}
 	// Fetch vCenterHost, vCenterManager & volumeManager for given snapshot, based on VC configuration
 	vCenterManager = getVCenterManagerForVCenter(ctx, c)
 	vCenterHost, volumeManager, err = getVCenterAndVolumeManagerForVolumeID(ctx, c, volumeID, volumeInfoService)
@@ -3148,8 +4175,24 @@ func (c *controller) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshot
 	}
 
 	deleteSnapshotInternal := func() (*csi.DeleteSnapshotResponse, error) {
+		snapshotOperations.start(volumeID)
+		defer snapshotOperations.done(volumeID)
 		csiSnapshotID := req.GetSnapshotId()
 		_, err := common.DeleteSnapshotUtil(ctx, volumeManager, csiSnapshotID, nil)
+		if errors.Is(err, cnsvolume.ErrSnapshotVolumeNotFound) {
+			// The snapshot is gone along with its volume if the volume was
+			// deleted, e.g. out of band. Otherwise the snapshot may still exist.
+			deleted, queryErr := isVolumeDeleted(ctx, volumeID, volumeManager)
+			if queryErr != nil {
+				return nil, logger.LogNewErrorCodef(log, codes.Internal,
+					"Failed to delete snapshot %q. Error: %+v", csiSnapshotID, queryErr)
+			}
+			if deleted {
+				log.Infof("DeleteSnapshot: volume %q of snapshot %q is deleted, assuming the snapshot is deleted",
+					volumeID, csiSnapshotID)
+				return &csi.DeleteSnapshotResponse{}, nil
+			}
+		}
 		if err != nil {
 			return nil, logger.LogNewErrorCodef(log, codes.Internal,
 				"Failed to delete snapshot %q. Error: %+v",
@@ -3260,6 +4303,9 @@ func (c *controller) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsRe
 		} else {
 			snapshots, nextToken, err = queryAllVolumeSnapshotsForMultiVC(ctx, c, req.StartingToken, maxEntries)
 			if err != nil {
+				if status.Code(err) == codes.Aborted {
+					return nil, err
+				}
 				return nil, logger.LogNewErrorCodef(log, codes.Internal, " failed to retrieve the snapshots, err: %+v", err)
 			}
 		}
@@ -3414,8 +4460,7 @@ func queryAllVolumeSnapshotsForMultiVC(ctx context.Context, c *controller, token
 	finalSnapEntries, nextToken, err = processQueryResultsListSnapshots(ctx, startingToken,
 		maxEntries, CNSSnapshotsForListSnapshots)
 	if err != nil {
-		return nil, csifault.CSIInternalFault, fmt.Errorf("error while processing query results for list "+
-			" snapshots, err: %v", err)
+		return nil, "", err
 	}
 	for _, queryResult := range finalSnapEntries {
 		snapshotCreateTimeInProto := timestamppb.New(queryResult.Snapshot.CreateTime)
@@ -3448,8 +4493,15 @@ func processQueryResultsListSnapshots(ctx context.Context, startingToken int,
 	maxEntries int64,
 	snapshotQueryResultEntries []cnstypes.CnsSnapshotQueryResultEntry) ([]cnstypes.CnsSnapshotQueryResultEntry,
 	string, error) {
+	log := logger.GetLogger(ctx)
 	nextToken := ""
 	nextTokenCounter := 0
+	// A token beyond the available entries can not be resumed from.
+	if startingToken < 0 || startingToken > len(snapshotQueryResultEntries) {
+		return nil, "", logger.LogNewErrorCodef(log, codes.Aborted,
+			"ListSnapshots StartingToken: %d is out of range of total %d entries",
+			startingToken, len(snapshotQueryResultEntries))
+	}
 	var snapEntries = make([]cnstypes.CnsSnapshotQueryResultEntry, 0)
 	for i := startingToken; i < len(snapshotQueryResultEntries); i++ {
 		if len(snapEntries) == int(maxEntries) {
@@ -3464,18 +4516,165 @@ func processQueryResultsListSnapshots(ctx context.Context, startingToken int,
 	return snapEntries, nextToken, nil
 }
 
+// ControllerGetVolume returns the volume condition of the given volume based on
+// the health status reported by CNS. It is used by the external-health-monitor
+// sidecar to report abnormal volumes.
 func (c *controller) ControllerGetVolume(ctx context.Context, req *csi.ControllerGetVolumeRequest) (
 	*csi.ControllerGetVolumeResponse, error) {
+	start := time.Now()
 	ctx = logger.NewContextWithLogger(ctx)
 	log := logger.GetLogger(ctx)
-	log.Infof("ControllerGetVolume: called with args %+v", *req)
-	return nil, logger.LogNewErrorCode(log, codes.Unimplemented, "controllerGetVolume")
+	volumeType := prometheus.PrometheusUnknownVolumeType
+
+	controllerGetVolumeInternal := func() (*csi.ControllerGetVolumeResponse, error) {
+		log.Infof("ControllerGetVolume: called with args %+v", *req)
+		volumeID := req.GetVolumeId()
+		if volumeID == "" {
+			return nil, logger.LogNewErrorCode(log, codes.InvalidArgument,
+				"volume ID is a required parameter")
+		}
+		vcHost, volumeManager, err := getVCenterAndVolumeManagerForVolumeID(ctx, c, volumeID, volumeInfoService)
+		if err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to get vCenter/volume manager for volume Id: %q. Error: %v", volumeID, err)
+		}
+		queryFilter := cnstypes.CnsQueryFilter{
+			VolumeIds: []cnstypes.CnsVolumeId{{Id: volumeID}},
+		}
+		querySelection := cnstypes.CnsQuerySelection{
+			Names: []string{
+				string(cnstypes.QuerySelectionNameTypeVolumeType),
+				string(cnstypes.QuerySelectionNameTypeHealthStatus),
+			},
+		}
+		// NOTE: Failure to query CNS is returned as an error instead of an abnormal
+		// volume condition, so that the volume condition does not flap on transient
+		// failures while talking to vCenter.
+		queryResult, err := utils.QueryVolumeUtil(ctx, volumeManager, queryFilter, &querySelection, true)
+		if err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to query volume %q in vCenter %q. Error: %+v", volumeID, vcHost, err)
+		}
+		if len(queryResult.Volumes) == 0 {
+			return nil, logger.LogNewErrorCodef(log, codes.NotFound,
+				"volume %q not found in vCenter %q", volumeID, vcHost)
+		}
+		cnsVolume := queryResult.Volumes[0]
+		if cnsVolume.VolumeType == common.FileVolumeType {
+			volumeType = prometheus.PrometheusFileVolumeType
+		} else {
+			volumeType = prometheus.PrometheusBlockVolumeType
+		}
+		volumeCondition := &csi.VolumeCondition{
+			Abnormal: false,
+			Message:  "volume is accessible",
+		}
+		switch cnsVolume.HealthStatus {
+		case string(pbmtypes.PbmHealthStatusForEntityUnknown), "":
+			volumeCondition.Message = "volume health status is unknown"
+		default:
+			volHealthStatus, _ := common.ConvertVolumeHealthStatus(ctx, volumeID, cnsVolume.HealthStatus)
+			if volHealthStatus == common.VolHealthStatusInaccessible {
+				volumeCondition.Abnormal = true
+				volumeCondition.Message = fmt.Sprintf("volume is inaccessible, CNS health status: %q",
+					cnsVolume.HealthStatus)
+			}
+		}
+		log.Debugf("ControllerGetVolume: volume %q condition: %+v", volumeID, volumeCondition)
+		return &csi.ControllerGetVolumeResponse{
+			Volume: &csi.Volume{
+				VolumeId: volumeID,
+			},
+			Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+				VolumeCondition: volumeCondition,
+			},
+		}, nil
+	}
+	resp, err := controllerGetVolumeInternal()
+	if err != nil {
+		log.Errorf("Operation failed, reporting failure status to Prometheus."+
+			" Operation Type: %q, Volume Type: %q, Fault Type: %q",
+			prometheus.PrometheusGetVolumeOpType, volumeType, "NotComputed")
+		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusGetVolumeOpType,
+			prometheus.PrometheusFailStatus, "NotComputed").Observe(time.Since(start).Seconds())
+	} else {
+		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusGetVolumeOpType,
+			prometheus.PrometheusPassStatus, "").Observe(time.Since(start).Seconds())
+	}
+	return resp, err
 }
 
+// ControllerModifyVolume changes the storage policy and the IOPS limit of a
+// block volume to the ones given in the mutable parameters of its
+// VolumeAttributesClass.
 func (c *controller) ControllerModifyVolume(ctx context.Context, req *csi.ControllerModifyVolumeRequest) (
 	*csi.ControllerModifyVolumeResponse, error) {
+	start := time.Now()
 	ctx = logger.NewContextWithLogger(ctx)
 	log := logger.GetLogger(ctx)
-	log.Infof("ControllerModifyVolume: called with args %+v", *req)
-	return nil, logger.LogNewErrorCode(log, codes.Unimplemented, "ControllerModifyVolume")
+	volumeType := prometheus.PrometheusUnknownVolumeType
+	controllerModifyVolumeInternal := func() (*csi.ControllerModifyVolumeResponse, string, error) {
+		log.Infof("ControllerModifyVolume: called with args %+v", *req)
+		volumeID := req.GetVolumeId()
+		if volumeID == "" {
+			return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCode(log, codes.InvalidArgument,
+				"volume ID is a required parameter")
+		}
+		if strings.HasPrefix(volumeID, "file:") {
+			volumeType = prometheus.PrometheusFileVolumeType
+			return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+				"volume: %s is a file volume, only block volumes can be modified", volumeID)
+		}
+		volumeType = prometheus.PrometheusBlockVolumeType
+		vCenterHost, volumeManager, err := getVCenterAndVolumeManagerForVolumeID(ctx, c, volumeID,
+			volumeInfoService)
+		if err != nil {
+			return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to get vCenter/volume manager for volume Id: %q. Error: %v", volumeID, err)
+		}
+		vCenter, err := common.GetVCenterFromVCHost(ctx, getVCenterManagerForVCenter(ctx, c), vCenterHost)
+		if err != nil {
+			return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to get vCenter instance for host %q. Error: %+v", vCenterHost, err)
+		}
+		iopsLimit, modifyIopsLimit, otherParams, faultType, err := getModifyVolumeIopsLimit(ctx,
+			req.GetMutableParameters())
+		if err != nil {
+			return nil, faultType, err
+		}
+		if !modifyIopsLimit || len(otherParams) > 0 {
+			storagePolicyID, faultType, err := getModifyVolumeStoragePolicy(ctx, vCenter, otherParams)
+			if err != nil {
+				return nil, faultType, err
+			}
+			faultType, err = c.modifyVolumeStoragePolicy(ctx, vCenter, volumeManager, volumeID, storagePolicyID)
+			if err != nil {
+				return nil, faultType, err
+			}
+		}
+		if modifyIopsLimit {
+			faultType, err = setVolumeIopsLimit(ctx, vCenter, volumeManager, volumeID, "", iopsLimit)
+			if err != nil {
+				return nil, faultType, err
+			}
+		}
+		return &csi.ControllerModifyVolumeResponse{}, "", nil
+	}
+
+	resp, faultType, err := controllerModifyVolumeInternal()
+	if err != nil {
+		if csifault.IsNonStorageFault(faultType) {
+			faultType = csifault.AddCsiNonStoragePrefix(ctx, faultType)
+		}
+		log.Errorf("Operation failed, reporting failure status to Prometheus."+
+			" Operation Type: %q, Volume Type: %q, Fault Type: %q",
+			prometheus.PrometheusModifyVolumeOpType, volumeType, faultType)
+		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusModifyVolumeOpType,
+			prometheus.PrometheusFailStatus, faultType).Observe(time.Since(start).Seconds())
+	} else {
+		log.Infof("Volume %q modified successfully.", req.VolumeId)
+		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusModifyVolumeOpType,
+			prometheus.PrometheusPassStatus, faultType).Observe(time.Since(start).Seconds())
+	}
+	return resp, err
 }
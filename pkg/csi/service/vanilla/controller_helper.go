@@ -17,26 +17,52 @@ limitations under the License.
 package vanilla
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"path"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v8/apis/volumesnapshot/v1"
+	snapshotinformers "github.com/kubernetes-csi/external-snapshotter/client/v8/informers/externalversions"
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/property"
 	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/progress"
 	"github.com/vmware/govmomi/vim25/types"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	corev1helpers "k8s.io/component-helpers/scheduling/corev1"
 
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/node"
 	cnsvolume "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/volume"
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/vsphere"
+	cnsconfig "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/config"
+	csifault "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/fault"
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/prometheus"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/utils"
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common/commonco"
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/types"
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/internalapis/cnsvolumeinfo"
+	k8s "sigs.k8s.io/vsphere-csi-driver/v3/pkg/kubernetes"
 )
 
 // validateVanillaDeleteVolumeRequest is the helper function to validate
@@ -114,11 +140,12 @@ func validateVanillaListSnapshotRequest(ctx context.Context, req *csi.ListSnapsh
 		return logger.LogNewErrorCodef(log, codes.InvalidArgument,
 			"ListSnapshots MaxEntries: %d cannot be negative", maxEntries)
 	}
-	// validate the starting token by verifying that it can be converted to a int
+	// validate the starting token by verifying that it can be converted to a non-negative int.
+	// As per CSI spec, an invalid starting token must be reported with codes.Aborted.
 	if req.StartingToken != "" {
-		_, err := strconv.Atoi(req.StartingToken)
-		if err != nil {
-			return logger.LogNewErrorCodef(log, codes.InvalidArgument,
+		token, err := strconv.Atoi(req.StartingToken)
+		if err != nil || token < 0 {
+			return logger.LogNewErrorCodef(log, codes.Aborted,
 				"ListSnapshots StartingToken: %s cannot be parsed", req.StartingToken)
 		}
 	}
@@ -295,3 +322,1951 @@ func GetVolumeManagerFromVCHost(ctx context.Context, managers *common.Managers,
 	}
 	return volumeMgr, nil
 }
+
+// volumeSnapshotOperations tracks the volumes with a snapshot operation in
+// progress. Multiple snapshot operations may be in progress for a volume.
+type volumeSnapshotOperations struct {
+	mux    sync.Mutex
+	counts map[string]int
+}
+
+// snapshotOperations holds the volumes with a snapshot operation in progress
+// on this controller.
+var snapshotOperations = &volumeSnapshotOperations{counts: make(map[string]int)}
+
+// start records the start of a snapshot operation on the given volumes.
+func (ops *volumeSnapshotOperations) start(volumeIDs ...string) {
+	ops.mux.Lock()
+	defer ops.mux.Unlock()
+	for _, volumeID := range volumeIDs {
+		ops.counts[volumeID]++
+	}
+}
+
+// done records the completion of a snapshot operation on the given volumes.
+func (ops *volumeSnapshotOperations) done(volumeIDs ...string) {
+	ops.mux.Lock()
+	defer ops.mux.Unlock()
+	for _, volumeID := range volumeIDs {
+		ops.counts[volumeID]--
+		if ops.counts[volumeID] <= 0 {
+			delete(ops.counts, volumeID)
+		}
+	}
+}
+
+// inProgress returns true if a snapshot operation is in progress on the given volume.
+func (ops *volumeSnapshotOperations) inProgress(volumeID string) bool {
+	ops.mux.Lock()
+	defer ops.mux.Unlock()
+	return ops.counts[volumeID] > 0
+}
+
+// operationLimiter limits the number of operations which are in progress
+// concurrently for each key, e.g. on each ESXi host. Requests exceeding the
+// limit wait for a slot.
+type operationLimiter struct {
+	mux   sync.Mutex
+	limit int
+	// classLimits overrides limit for the keys of some classes, e.g. for the
+	// ESXi hosts of a hardware model.
+	classLimits map[string]int
+	slots       map[string]chan struct{}
+}
+
+var (
+	// attachLimiter holds the attach slots of the ESXi hosts on this
+	// controller, so that a node restarting with many volumes does not flood
+	// vCenter and the host with attach tasks.
+	attachLimiter = &operationLimiter{slots: make(map[string]chan struct{})}
+	// detachLimiter holds the detach slots of the ESXi hosts on this
+	// controller. Detaches have their own slots, so that they are not held up
+	// behind pending attaches.
+	detachLimiter = &operationLimiter{slots: make(map[string]chan struct{})}
+	// nodeDetachLimiter holds the detach slots of the node VMs, so that the
+	// volumes of a drained node are detached in parallel up to the limit.
+	nodeDetachLimiter = &operationLimiter{slots: make(map[string]chan struct{})}
+	// hostHardwareModels caches the hardware model of the ESXi hosts, keyed
+	// by vCenter host and host MoRef, to look up their attach limit.
+	hostHardwareModels sync.Map
+	// nodeVMHosts caches the ESXi host of the node VMs, keyed by vCenter host
+	// and node VM UUID, so that the host is not looked up for every attach
+	// and detach.
+	nodeVMHosts sync.Map
+)
+
+// nodeVMHostCacheTTL is the time for which the ESXi host of a node VM is
+// cached. A node VM migrated to another host is limited on its previous host
+// until the entry expires.
+const nodeVMHostCacheTTL = 5 * time.Minute
+
+// cachedNodeVMHost is the ESXi host of a node VM cached in nodeVMHosts.
+type cachedNodeVMHost struct {
+	host   types.ManagedObjectReference
+	expiry time.Time
+}
+
+// getNodeVMHost returns the ESXi host of the given node VM, from nodeVMHosts
+// if it is cached there.
+func getNodeVMHost(ctx context.Context, nodeVM *vsphere.VirtualMachine) (*object.HostSystem, error) {
+	nodeKey := nodeVM.VirtualCenterHost + "/" + nodeVM.UUID
+	if cached, ok := nodeVMHosts.Load(nodeKey); ok && time.Now().Before(cached.(cachedNodeVMHost).expiry) {
+		return object.NewHostSystem(nodeVM.Client(), cached.(cachedNodeVMHost).host), nil
+	}
+	host, err := nodeVM.VirtualMachine.HostSystem(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nodeVMHosts.Store(nodeKey, cachedNodeVMHost{host: host.Reference(), expiry: time.Now().Add(nodeVMHostCacheTTL)})
+	return host, nil
+}
+
+// setLimit sets the maximum number of concurrent operations per key. A limit
+// less than or equal to 0 disables the limiter.
+func (l *operationLimiter) setLimit(limit int) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.limit != limit {
+		// Attaches holding slots of the previous limit release them into
+		// the previous channels, which are no longer handed out.
+		l.slots = make(map[string]chan struct{})
+	}
+	l.limit = limit
+}
+
+// setClassLimits sets the maximum number of concurrent operations of the keys
+// of the given classes, overriding the limit of the limiter. A class limit
+// less than or equal to 0 disables the limiter for the keys of the class.
+func (l *operationLimiter) setClassLimits(classLimits map[string]int) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if !maps.Equal(l.classLimits, classLimits) {
+		l.slots = make(map[string]chan struct{})
+	}
+	l.classLimits = classLimits
+}
+
+// hasClassLimits returns true if the limit is overridden for some classes.
+func (l *operationLimiter) hasClassLimits() bool {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	return len(l.classLimits) != 0
+}
+
+// getLimit returns the maximum number of concurrent operations per key.
+func (l *operationLimiter) getLimit() int {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	return l.limit
+}
+
+// acquire waits for a slot of the given key and returns the function
+// releasing it. An error is returned if ctx is done before a slot is free.
+func (l *operationLimiter) acquire(ctx context.Context, key string) (func(), error) {
+	return l.acquireForClass(ctx, key, "")
+}
+
+// acquireForClass waits for a slot of the given key, limited by the limit of
+// its class if the class has one, and returns the function releasing it.
+func (l *operationLimiter) acquireForClass(ctx context.Context, key string, class string) (func(), error) {
+	l.mux.Lock()
+	limit := l.limit
+	if classLimit, ok := l.classLimits[class]; ok && class != "" {
+		limit = classLimit
+	}
+	if limit <= 0 {
+		l.mux.Unlock()
+		return func() {}, nil
+	}
+	slots, ok := l.slots[key]
+	if !ok {
+		slots = make(chan struct{}, limit)
+		l.slots[key] = slots
+	}
+	l.mux.Unlock()
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// acquireAttachSlot waits for an attach slot on the ESXi host of the given
+// node VM. The host is only looked up if attaches are limited, and its
+// hardware model only if some hardware models have their own limit. If the
+// host cannot be determined, the attach is not limited.
+func acquireAttachSlot(ctx context.Context, nodeVM *vsphere.VirtualMachine) (func(), error) {
+	log := logger.GetLogger(ctx)
+	if attachLimiter.getLimit() <= 0 && !attachLimiter.hasClassLimits() {
+		return func() {}, nil
+	}
+	host, err := getNodeVMHost(ctx, nodeVM)
+	if err != nil {
+		log.Warnf("failed to get host of node VM %v, attach is not limited per host. Err: %v", nodeVM, err)
+		return func() {}, nil
+	}
+	hostKey := nodeVM.VirtualCenterHost + "/" + host.Reference().Value
+	var hardwareModel string
+	if attachLimiter.hasClassLimits() {
+		hardwareModel = getHostHardwareModel(ctx, host, hostKey)
+	}
+	start := time.Now()
+	release, err := attachLimiter.acquireForClass(ctx, hostKey, hardwareModel)
+	if err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.Aborted,
+			"timed out waiting for a free attach slot on host %q for node VM %v. Err: %v", hostKey, nodeVM, err)
+	}
+	if waited := time.Since(start); waited > time.Second {
+		log.Infof("waited %v for a free attach slot on host %q", waited, hostKey)
+	}
+	return release, nil
+}
+
+// getHostAttachLimits returns the attach limits of the ESXi host hardware
+// models given in the config. Models with no limit use the global limit.
+func getHostAttachLimits(hostAttachLimits map[string]*cnsconfig.HostAttachLimitConfig) map[string]int {
+	limits := make(map[string]int)
+	for model, hostAttachLimit := range hostAttachLimits {
+		if hostAttachLimit != nil && hostAttachLimit.MaxConcurrentAttaches != 0 {
+			limits[model] = hostAttachLimit.MaxConcurrentAttaches
+		}
+	}
+	return limits
+}
+
+// getFaultCodeOverrides returns the names of the gRPC codes of the CNS fault
+// types classified in the config.
+func getFaultCodeOverrides(faultClassification map[string]*cnsconfig.FaultClassificationConfig) map[string]string {
+	overrides := make(map[string]string)
+	for faultType, classification := range faultClassification {
+		if classification != nil && classification.GRPCCode != "" {
+			overrides[faultType] = classification.GRPCCode
+		}
+	}
+	return overrides
+}
+
+// getHostHardwareModel returns the hardware model of the ESXi host, or an
+// empty string if it cannot be retrieved, in which case the global attach
+// limit applies to the host.
+func getHostHardwareModel(ctx context.Context, host *object.HostSystem, hostKey string) string {
+	log := logger.GetLogger(ctx)
+	if model, ok := hostHardwareModels.Load(hostKey); ok {
+		return model.(string)
+	}
+	var hostMo mo.HostSystem
+	err := host.Properties(ctx, host.Reference(), []string{"summary.hardware"}, &hostMo)
+	if err != nil || hostMo.Summary.Hardware == nil {
+		log.Warnf("failed to get hardware model of host %q, the global attach limit applies. Err: %v",
+			hostKey, err)
+		return ""
+	}
+	hostHardwareModels.Store(hostKey, hostMo.Summary.Hardware.Model)
+	return hostMo.Summary.Hardware.Model
+}
+
+// acquireDetachSlots waits for a detach slot of the given node VM, and then
+// for a detach slot on its ESXi host, and returns the function releasing
+// both. The host is only looked up if detaches are limited per host. If it
+// cannot be determined, the detach is only limited per node.
+func acquireDetachSlots(ctx context.Context, nodeVM *vsphere.VirtualMachine) (func(), error) {
+	log := logger.GetLogger(ctx)
+	start := time.Now()
+	nodeKey := nodeVM.VirtualCenterHost + "/" + nodeVM.UUID
+	releaseNode, err := nodeDetachLimiter.acquire(ctx, nodeKey)
+	if err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.Aborted,
+			"timed out waiting for a free detach slot of node VM %v. Err: %v", nodeVM, err)
+	}
+	releaseHost := func() {}
+	if detachLimiter.getLimit() > 0 {
+		host, err := getNodeVMHost(ctx, nodeVM)
+		if err != nil {
+			log.Warnf("failed to get host of node VM %v, detach is not limited per host. Err: %v", nodeVM, err)
+		} else {
+			hostKey := nodeVM.VirtualCenterHost + "/" + host.Reference().Value
+			releaseHost, err = detachLimiter.acquire(ctx, hostKey)
+			if err != nil {
+				releaseNode()
+				return nil, logger.LogNewErrorCodef(log, codes.Aborted,
+					"timed out waiting for a free detach slot on host %q for node VM %v. Err: %v",
+					hostKey, nodeVM, err)
+			}
+		}
+	}
+	if waited := time.Since(start); waited > time.Second {
+		log.Infof("waited %v for a free detach slot of node VM %v", waited, nodeVM)
+	}
+	return func() {
+		releaseHost()
+		releaseNode()
+	}, nil
+}
+
+// nodeDetachTracker measures the time taken to detach the volumes of the
+// nodes, e.g. while they are drained. The detaches of a node which overlap in
+// time form a batch, whose duration is observed once its last detach is done.
+type nodeDetachTracker struct {
+	mux     sync.Mutex
+	batches map[string]*nodeDetachBatch
+}
+
+// nodeDetachBatch is a batch of overlapping detaches of a node.
+type nodeDetachBatch struct {
+	start    time.Time
+	inFlight int
+	detached int
+	failed   int
+}
+
+// detachTracker tracks the detaches of the nodes on this controller.
+var detachTracker = &nodeDetachTracker{batches: make(map[string]*nodeDetachBatch)}
+
+// begin records the start of a detach from the node.
+func (t *nodeDetachTracker) begin(node string) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	batch, ok := t.batches[node]
+	if !ok {
+		batch = &nodeDetachBatch{start: time.Now()}
+		t.batches[node] = batch
+	}
+	batch.inFlight++
+}
+
+// end records the end of a detach from the node. Once no detach of the node
+// is in progress, the duration of the batch is observed.
+func (t *nodeDetachTracker) end(ctx context.Context, node string, err error) {
+	log := logger.GetLogger(ctx)
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	batch, ok := t.batches[node]
+	if !ok {
+		return
+	}
+	batch.inFlight--
+	if err != nil {
+		batch.failed++
+	} else {
+		batch.detached++
+	}
+	if batch.inFlight > 0 {
+		return
+	}
+	delete(t.batches, node)
+	duration := time.Since(batch.start)
+	prometheus.NodeDetachBatchDurationHistVec.WithLabelValues(
+		strconv.Itoa(nodeDetachLimiter.getLimit())).Observe(duration.Seconds())
+	if batch.detached+batch.failed > 1 {
+		log.Infof("Detached %d volumes from node %q in %v, %d detaches failed", batch.detached, node,
+			duration, batch.failed)
+	}
+}
+
+// relocateOnInaccessibleDatastoreAttach enables relocating volumes whose
+// attach fails because their datastore is not accessible from the host of
+// the node VM.
+var relocateOnInaccessibleDatastoreAttach bool
+
+// isInaccessibleDatastoreAttachFault returns true if the fault of a failed
+// attach indicates the datastore of the volume is not accessible from the
+// host of the node VM.
+func isInaccessibleDatastoreAttachFault(faultType string) bool {
+	switch faultType {
+	case csifault.VimFaultPrefix + "InaccessibleDatastore",
+		csifault.VimFaultPrefix + "DatastoreNotWritableOnHost",
+		csifault.VimFaultPrefix + "CannotAccessFile":
+		return true
+	}
+	return false
+}
+
+// relocateVolumeForAttach relocates the volume to the datastore with the most
+// free space among the datastores accessible from the host of the node VM and
+// from every other node the PV can be used on, and compatible with the storage
+// policy of the volume. It returns true if the volume was relocated, so that
+// the attach can be retried, and false if relocation is disabled, not needed
+// or not possible.
+func (c *controller) relocateVolumeForAttach(ctx context.Context, volumeManager cnsvolume.Manager,
+	nodeVM *vsphere.VirtualMachine, volumeID string) bool {
+	log := logger.GetLogger(ctx)
+	if !relocateOnInaccessibleDatastoreAttach {
+		log.Infof("Attach of volume %q to node VM %v failed as its datastore is not accessible from the host. "+
+			"Relocation on attach is disabled", volumeID, nodeVM)
+		return false
+	}
+	queryResult, err := volumeManager.QueryVolume(ctx, cnstypes.CnsQueryFilter{
+		VolumeIds: []cnstypes.CnsVolumeId{{Id: volumeID}},
+	})
+	if err != nil || len(queryResult.Volumes) == 0 {
+		log.Errorf("failed to query volume %q for relocation. Err: %v", volumeID, err)
+		return false
+	}
+	cnsVolume := queryResult.Volumes[0]
+	accessibleDatastores, err := nodeVM.GetAllAccessibleDatastores(ctx)
+	if err != nil {
+		log.Errorf("failed to get datastores accessible from node VM %v. Err: %v", nodeVM, err)
+		return false
+	}
+	var candidates []*vsphere.DatastoreInfo
+	for _, dsInfo := range accessibleDatastores {
+		if dsInfo.Info.Url == cnsVolume.DatastoreUrl {
+			log.Infof("Datastore %q of volume %q is accessible from node VM %v, not relocating the volume",
+				cnsVolume.DatastoreUrl, volumeID, nodeVM)
+			return false
+		}
+		if !vsphere.IsVolumeCreationSuspended(ctx, dsInfo) {
+			candidates = append(candidates, dsInfo)
+		}
+	}
+	candidates, err = c.filterDatastoresAccessibleFromPVNodes(ctx, volumeID, candidates)
+	if err != nil {
+		log.Errorf("failed to filter datastores accessible from the nodes of volume %q. Err: %v", volumeID, err)
+		return false
+	}
+	var profileSpecs []types.BaseVirtualMachineProfileSpec
+	if cnsVolume.StoragePolicyId != "" && len(candidates) > 0 {
+		vc, err := vsphere.GetVirtualCenterInstanceForVCenterHost(ctx, nodeVM.VirtualCenterHost, true)
+		if err != nil {
+			log.Errorf("failed to get vCenter %q. Err: %v", nodeVM.VirtualCenterHost, err)
+			return false
+		}
+		var dsRefs []types.ManagedObjectReference
+		for _, dsInfo := range candidates {
+			dsRefs = append(dsRefs, dsInfo.Reference())
+		}
+		compat, err := vc.PbmCheckCompatibility(ctx, dsRefs, cnsVolume.StoragePolicyId)
+		if err != nil {
+			log.Errorf("failed to check compatibility of datastores with storage policy %q of volume %q. Err: %v",
+				cnsVolume.StoragePolicyId, volumeID, err)
+			return false
+		}
+		compatible := make(map[string]bool)
+		for _, hub := range compat.CompatibleDatastores() {
+			compatible[hub.HubId] = true
+		}
+		candidates = slices.DeleteFunc(candidates, func(dsInfo *vsphere.DatastoreInfo) bool {
+			return !compatible[dsInfo.Reference().Value]
+		})
+		profileSpecs = append(profileSpecs,
+			&types.VirtualMachineDefinedProfileSpec{ProfileId: cnsVolume.StoragePolicyId})
+	}
+	if len(candidates) == 0 {
+		log.Errorf("no datastore accessible from node VM %v and the nodes of volume %q is compatible with "+
+			"the storage policy %q of the volume, not relocating the volume", nodeVM, volumeID,
+			cnsVolume.StoragePolicyId)
+		return false
+	}
+	target := slices.MaxFunc(candidates, func(a, b *vsphere.DatastoreInfo) int {
+		return cmp.Compare(a.Info.FreeSpace, b.Info.FreeSpace)
+	})
+	log.Infof("Relocating volume %q from datastore %q to datastore %q accessible from node VM %v",
+		volumeID, cnsVolume.DatastoreUrl, target.Info.Url, nodeVM)
+	relocateSpec := cnstypes.NewCnsBlockVolumeRelocateSpec(volumeID, target.Reference(), profileSpecs...)
+	task, err := volumeManager.RelocateVolume(ctx, relocateSpec)
+	if err != nil {
+		log.Errorf("failed to relocate volume %q to datastore %q. Err: %v", volumeID, target.Info.Url, err)
+		return false
+	}
+	taskInfo, err := task.WaitForResult(ctx)
+	if err != nil {
+		log.Errorf("failed to relocate volume %q to datastore %q. Err: %v", volumeID, target.Info.Url, err)
+		return false
+	}
+	if results, ok := taskInfo.Result.(cnstypes.CnsVolumeOperationBatchResult); ok {
+		for _, result := range results.VolumeResults {
+			if fault := result.GetCnsVolumeOperationResult().Fault; fault != nil {
+				log.Errorf("failed to relocate volume %q to datastore %q. Fault: %s", volumeID,
+					target.Info.Url, fault.LocalizedMessage)
+				return false
+			}
+		}
+	}
+	log.Infof("Relocated volume %q to datastore %q, retrying the attach", volumeID, target.Info.Url)
+	return true
+}
+
+// isVolumeInUseAttachFault returns true if the fault of a failed attach
+// indicates the volume is still attached to another VM.
+func isVolumeInUseAttachFault(faultType string) bool {
+	switch faultType {
+	case csifault.VimFaultPrefix + "ResourceInUse",
+		csifault.VimFaultPrefix + "FileLocked":
+		return true
+	}
+	return false
+}
+
+// detachVolumeFromStaleNodeVMs force detaches the volume from the VMs it is
+// still attached to which are stale node VMs, i.e. VMs orphaned in the vCenter
+// inventory after their host was lost and whose Kubernetes node no longer
+// exists, e.g. after the node was replaced. The volume is also detached from
+// VMs which no longer exist in vCenter, clearing the attachment CNS still
+// records for them. VMs which are still connected, including the ones whose
+// host is merely not responding, and VMs of nodes still registered in the
+// cluster are never detached from. It returns true if the volume was detached
+// from a stale node VM, so that the attach can be retried, and false otherwise.
+func (c *controller) detachVolumeFromStaleNodeVMs(ctx context.Context, volumeManager cnsvolume.Manager,
+	nodeVM *vsphere.VirtualMachine, volumeID string) bool {
+	log := logger.GetLogger(ctx)
+	associations, err := volumeManager.RetrieveVStorageObjectAssociations(ctx, volumeID)
+	if err != nil {
+		log.Errorf("failed to find the VMs volume %q is attached to. Err: %v", volumeID, err)
+		return false
+	}
+	var staleVMs []*vsphere.VirtualMachine
+	for _, association := range associations {
+		if association.VmId == nodeVM.Reference().Value {
+			continue
+		}
+		vmRef := types.ManagedObjectReference{Type: "VirtualMachine", Value: association.VmId}
+		vm := object.NewVirtualMachine(nodeVM.Client(), vmRef)
+		var vmMo mo.VirtualMachine
+		err := vm.Properties(ctx, vmRef, []string{"runtime.connectionState", "config.uuid"}, &vmMo)
+		if err != nil {
+			if vsphere.IsManagedObjectNotFound(err, vmRef) {
+				log.Infof("VM %q holding volume %q no longer exists in vCenter %q", vmRef.Value, volumeID,
+					nodeVM.VirtualCenterHost)
+				staleVMs = append(staleVMs, &vsphere.VirtualMachine{
+					VirtualCenterHost: nodeVM.VirtualCenterHost,
+					VirtualMachine:    vm,
+					Datacenter:        nodeVM.Datacenter,
+				})
+				continue
+			}
+			log.Errorf("failed to get the state of VM %q holding volume %q. Err: %v", vmRef.Value, volumeID, err)
+			return false
+		}
+		if vmMo.Runtime.ConnectionState != types.VirtualMachineConnectionStateOrphaned {
+			log.Infof("VM %q holding volume %q is %s in vCenter %q, not force detaching the volume",
+				vmRef.Value, volumeID, vmMo.Runtime.ConnectionState, nodeVM.VirtualCenterHost)
+			return false
+		}
+		var vmUUID string
+		if vmMo.Config != nil {
+			vmUUID = vmMo.Config.Uuid
+		}
+		if vmUUID == "" {
+			log.Infof("UUID of orphaned VM %q holding volume %q is unknown, not force detaching the volume",
+				vmRef.Value, volumeID)
+			return false
+		}
+		if nodeName, err := c.nodeMgr.GetNodeNameByUUID(ctx, vmUUID); err == nil {
+			log.Infof("Orphaned VM %q holding volume %q belongs to node %q which still exists, "+
+				"not force detaching the volume", vmRef.Value, volumeID, nodeName)
+			return false
+		}
+		staleVMs = append(staleVMs, &vsphere.VirtualMachine{
+			VirtualCenterHost: nodeVM.VirtualCenterHost,
+			UUID:              vmUUID,
+			VirtualMachine:    vm,
+			Datacenter:        nodeVM.Datacenter,
+		})
+	}
+	if len(staleVMs) == 0 {
+		return false
+	}
+	nodeName, err := c.nodeMgr.GetNodeNameByUUID(ctx, nodeVM.UUID)
+	if err != nil {
+		log.Warnf("failed to find the node of node VM %v. Err: %v", nodeVM, err)
+	}
+	for _, staleVM := range staleVMs {
+		log.Infof("Force detaching volume %q from stale node VM %v before attaching it to node VM %v",
+			volumeID, staleVM, nodeVM)
+		if _, err := common.DetachVolumeUtil(ctx, volumeManager, staleVM, volumeID); err != nil {
+			log.Errorf("failed to force detach volume %q from stale node VM %v. Err: %v", volumeID, staleVM, err)
+			return false
+		}
+		if nodeName != "" {
+			message := fmt.Sprintf("Volume %q was force detached from VM %q (UUID %q) of a node which no "+
+				"longer exists before attaching it to this node", volumeID, staleVM.Reference().Value, staleVM.UUID)
+			if staleVM.UUID == "" {
+				message = fmt.Sprintf("Volume %q was force detached from VM %q which no longer exists before "+
+					"attaching it to this node", volumeID, staleVM.Reference().Value)
+			}
+			generateEventOnNode(ctx, nodeName, v1.EventTypeWarning, "VolumeForceDetached", message)
+		}
+	}
+	log.Infof("Force detached volume %q from %d stale node VM(s), retrying the attach", volumeID, len(staleVMs))
+	return true
+}
+
+var (
+	// eventRecorderLock guards the event recorder of the controller, which is
+	// created on first use and shared by all events.
+	eventRecorderLock sync.Mutex
+	eventK8sClient    clientset.Interface
+	eventRecorder     record.EventRecorder
+)
+
+// getEventRecorder returns the event recorder of the controller and the
+// client it records events with.
+func getEventRecorder(ctx context.Context) (clientset.Interface, record.EventRecorder, error) {
+	eventRecorderLock.Lock()
+	defer eventRecorderLock.Unlock()
+	if eventRecorder != nil {
+		return eventK8sClient, eventRecorder, nil
+	}
+	k8sClient, err := k8s.NewClient(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: k8sClient.CoreV1().Events("")})
+	eventK8sClient = k8sClient
+	eventRecorder = eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: csitypes.Name})
+	return eventK8sClient, eventRecorder, nil
+}
+
+// generateEventOnNode records an event on the given Kubernetes node.
+func generateEventOnNode(ctx context.Context, nodeName string, eventType string, reason string, message string) {
+	log := logger.GetLogger(ctx)
+	k8sClient, recorder, err := getEventRecorder(ctx)
+	if err != nil {
+		log.Errorf("failed to create k8s client to record event on node %q. Err: %v", nodeName, err)
+		return
+	}
+	node, err := k8sClient.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		log.Errorf("failed to get node %q to record event. Err: %v", nodeName, err)
+		return
+	}
+	recorder.Event(node, eventType, reason, message)
+}
+
+// generateEventOnPV records an event on the PV of the given volume, if any.
+func generateEventOnPV(ctx context.Context, volumeID string, eventType string, reason string, message string) {
+	log := logger.GetLogger(ctx)
+	pvName, found := commonco.ContainerOrchestratorUtility.GetPVNameFromCSIVolumeID(volumeID)
+	if !found {
+		log.Debugf("no PV found for volume %q, skipping event %q", volumeID, reason)
+		return
+	}
+	k8sClient, recorder, err := getEventRecorder(ctx)
+	if err != nil {
+		log.Errorf("failed to create k8s client to record event on PV %q. Err: %v", pvName, err)
+		return
+	}
+	pv, err := k8sClient.CoreV1().PersistentVolumes().Get(ctx, pvName, metav1.GetOptions{})
+	if err != nil {
+		log.Errorf("failed to get PV %q to record event. Err: %v", pvName, err)
+		return
+	}
+	recorder.Event(pv, eventType, reason, message)
+}
+
+// validateStaticVolumeForAttach returns codes.NotFound if the volume handle
+// of a statically provisioned PV does not reference a CNS volume of the
+// cluster, e.g. because the handle is mistyped, so that a wrong disk is never
+// attached. Dynamically provisioned volumes are not validated.
+func validateStaticVolumeForAttach(ctx context.Context, volumeManager cnsvolume.Manager, volumeID string,
+	volumeContext map[string]string, clusterID string) (string, error) {
+	log := logger.GetLogger(ctx)
+	if _, ok := volumeContext[common.AttributeCSIProvisionerIdentity]; ok {
+		return "", nil
+	}
+	queryResult, err := volumeManager.QueryVolume(ctx, cnstypes.CnsQueryFilter{
+		VolumeIds: []cnstypes.CnsVolumeId{{Id: volumeID}},
+	})
+	if err != nil {
+		return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to query volume %q of static PV. Error: %v", volumeID, err)
+	}
+	var msg string
+	if len(queryResult.Volumes) == 0 {
+		msg = fmt.Sprintf("volume %q is not registered with CNS. Verify the volume handle of the static PV",
+			volumeID)
+	} else if clusters := queryResult.Volumes[0].Metadata.ContainerClusterArray; len(clusters) > 0 &&
+		!slices.ContainsFunc(clusters, func(cluster cnstypes.CnsContainerCluster) bool {
+			return cluster.ClusterId == clusterID
+		}) {
+		msg = fmt.Sprintf("volume %q belongs to another cluster. Verify the volume handle of the static PV",
+			volumeID)
+	} else {
+		return "", nil
+	}
+	generateEventOnPV(ctx, volumeID, v1.EventTypeWarning, "StaticVolumeValidationFailed", msg)
+	return csifault.CSINotFoundFault, logger.LogNewErrorCode(log, codes.NotFound, msg)
+}
+
+// getClusterID returns the ID of the cluster the volumes are provisioned for.
+func (c *controller) getClusterID() string {
+	if c.manager != nil {
+		return c.manager.CnsConfig.Global.ClusterID
+	}
+	return c.managers.CnsConfig.Global.ClusterID
+}
+
+// isReadOnlyCloneVolume returns true if the FCD metadata of the given volume
+// marks it as a read-only clone. The volume is not treated as a read-only
+// clone if the metadata of the volume cannot be retrieved, e.g. when the
+// vCenter does not serve the vslm endpoint, as read-only clones cannot be
+// created on such a vCenter either.
+func isReadOnlyCloneVolume(ctx context.Context, volumeManager cnsvolume.Manager, volumeID string) bool {
+	log := logger.GetLogger(ctx)
+	metadata, err := volumeManager.RetrieveVStorageObjectMetadata(ctx, volumeID, common.ReadOnlyCloneMetadataKey)
+	if err != nil {
+		log.Warnf("failed to retrieve metadata of volume %q, skipping the read-only clone check. Error: %+v",
+			volumeID, err)
+		return false
+	}
+	for _, kv := range metadata {
+		if kv.Key == common.ReadOnlyCloneMetadataKey && kv.Value == "true" {
+			return true
+		}
+	}
+	return false
+}
+
+// isMultiWriterVolume returns true if the FCD metadata of the given volume
+// marks it as attached in multi-writer sharing mode. An error is returned if
+// the metadata cannot be retrieved, so that the volume is not detached the
+// wrong way, unless the vCenter does not serve the vslm endpoint, which
+// multi-writer attach needs.
+func isMultiWriterVolume(ctx context.Context, volumeManager cnsvolume.Manager, volumeID string) (bool, error) {
+	log := logger.GetLogger(ctx)
+	metadata, err := volumeManager.RetrieveVStorageObjectMetadata(ctx, volumeID, common.MultiWriterMetadataKey)
+	if err != nil {
+		if errors.Is(err, vsphere.ErrNotSupported) {
+			return false, nil
+		}
+		return false, logger.LogNewErrorf(log, "failed to retrieve metadata of volume %q. Error: %+v",
+			volumeID, err)
+	}
+	for _, kv := range metadata {
+		if kv.Key == common.MultiWriterMetadataKey && kv.Value == "true" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// validateClonedVolume returns codes.AlreadyExists if the given cloned volume
+// is not compatible with the clone request: it must be on the datastore of the
+// source volume, have the requested storage policy, if any, and must not be
+// larger than the requested size. It returns the size of the cloned volume,
+// which is smaller than the requested size until the clone is expanded.
+func validateClonedVolume(ctx context.Context, volumeManager cnsvolume.Manager, volumeID string,
+	datastoreURL string, storagePolicyID string, volSizeMB int64) (int64, string, error) {
+	log := logger.GetLogger(ctx)
+	volume, err := common.QueryVolumeByID(ctx, volumeManager, volumeID, nil)
+	if err != nil {
+		return 0, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to query cloned volume: %s. Error: %+v", volumeID, err)
+	}
+	if volume.DatastoreUrl != datastoreURL {
+		return 0, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.AlreadyExists,
+			"volume: %s with the requested name is on datastore %q and not on datastore %q of the source volume",
+			volumeID, volume.DatastoreUrl, datastoreURL)
+	}
+	if storagePolicyID != "" && volume.StoragePolicyId != storagePolicyID {
+		return 0, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.AlreadyExists,
+			"volume: %s with the requested name has storage policy %q and not the requested policy %q",
+			volumeID, volume.StoragePolicyId, storagePolicyID)
+	}
+	var cloneSizeMB int64
+	if volume.BackingObjectDetails != nil {
+		cloneSizeMB = volume.BackingObjectDetails.GetCnsBackingObjectDetails().CapacityInMb
+	}
+	if cloneSizeMB > volSizeMB {
+		return 0, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.AlreadyExists,
+			"volume: %s with the requested name has size %d MB, larger than the requested size %d MB",
+			volumeID, cloneSizeMB, volSizeMB)
+	}
+	return cloneSizeMB, "", nil
+}
+
+// checkReadOnlyCloneForExpansion returns codes.FailedPrecondition if the given
+// volume is a read-only clone, which cannot be expanded.
+func checkReadOnlyCloneForExpansion(ctx context.Context, volumeManager cnsvolume.Manager,
+	volumeID string) (string, error) {
+	log := logger.GetLogger(ctx)
+	if isReadOnlyCloneVolume(ctx, volumeManager, volumeID) {
+		return csifault.CSIFailedPreconditionFault, logger.LogNewErrorCodef(log, codes.FailedPrecondition,
+			"volume: %s is a read-only clone and cannot be expanded", volumeID)
+	}
+	return "", nil
+}
+
+// getNodeAccessibleDatastoreURLs returns the URLs of the datastores accessible
+// from the node VM of the given node.
+var getNodeAccessibleDatastoreURLs = func(ctx context.Context, nodeMgr NodeManagerInterface,
+	nodeName string) ([]string, error) {
+	nodeVM, err := nodeMgr.GetNodeVMByNameAndUpdateCache(ctx, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	datastores, err := nodeVM.GetAllAccessibleDatastores(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var urls []string
+	for _, dsInfo := range datastores {
+		urls = append(urls, dsInfo.Info.Url)
+	}
+	return urls, nil
+}
+
+// filterDatastoresAccessibleFromPVNodes returns the datastores accessible from
+// every node the PV of the volume can be used on, i.e. the nodes matching the
+// node affinity of the PV, or all nodes if the PV has no node affinity. This
+// keeps a relocated volume within the topology of the PV, so that pods using
+// it can still be scheduled on and attach it to any of those nodes.
+func (c *controller) filterDatastoresAccessibleFromPVNodes(ctx context.Context, volumeID string,
+	datastores []*vsphere.DatastoreInfo) ([]*vsphere.DatastoreInfo, error) {
+	pvName, found := commonco.ContainerOrchestratorUtility.GetPVNameFromCSIVolumeID(volumeID)
+	if !found {
+		return nil, fmt.Errorf("failed to find the PV of volume %q", volumeID)
+	}
+	k8sClient, err := k8s.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pv, err := k8sClient.CoreV1().PersistentVolumes().Get(ctx, pvName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get PV %q. Err: %v", pvName, err)
+	}
+	return filterDatastoresAccessibleFromNodes(ctx, k8sClient, c.nodeMgr, pv, datastores)
+}
+
+func filterDatastoresAccessibleFromNodes(ctx context.Context, k8sClient clientset.Interface,
+	nodeMgr NodeManagerInterface, pv *v1.PersistentVolume,
+	datastores []*vsphere.DatastoreInfo) ([]*vsphere.DatastoreInfo, error) {
+	nodes, err := k8sClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes. Err: %v", err)
+	}
+	for i := range nodes.Items {
+		n := &nodes.Items[i]
+		if pv.Spec.NodeAffinity != nil && pv.Spec.NodeAffinity.Required != nil {
+			match, err := corev1helpers.MatchNodeSelectorTerms(n, pv.Spec.NodeAffinity.Required)
+			if err != nil {
+				return nil, fmt.Errorf("failed to match node affinity of PV %q with node %q. Err: %v",
+					pv.Name, n.Name, err)
+			}
+			if !match {
+				continue
+			}
+		}
+		urls, err := getNodeAccessibleDatastoreURLs(ctx, nodeMgr, n.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get datastores accessible from node %q. Err: %v", n.Name, err)
+		}
+		datastores = slices.DeleteFunc(datastores, func(dsInfo *vsphere.DatastoreInfo) bool {
+			return !slices.Contains(urls, dsInfo.Info.Url)
+		})
+	}
+	return datastores, nil
+}
+
+// checkDatastoreCapacityForExpansion verifies that the datastore backing the
+// given volume has enough free space to grow the volume to volSizeMB. It
+// returns codes.ResourceExhausted if the datastore does not have enough free
+// space, so that the expansion is rejected upfront instead of failing in the
+// CNS task.
+func checkDatastoreCapacityForExpansion(ctx context.Context, vc *vsphere.VirtualCenter,
+	volumeManager cnsvolume.Manager, volumeID string, volSizeMB int64) (string, error) {
+	log := logger.GetLogger(ctx)
+	volumeDetailsMap, err := utils.QueryVolumeDetailsUtil(ctx, volumeManager,
+		[]cnstypes.CnsVolumeId{{Id: volumeID}})
+	if err != nil {
+		return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to query details of volume %q. Error: %+v", volumeID, err)
+	}
+	volumeDetails, ok := volumeDetailsMap[volumeID]
+	if !ok {
+		return csifault.CSINotFoundFault, logger.LogNewErrorCodef(log, codes.NotFound,
+			"volume %q not found", volumeID)
+	}
+	requiredMB := volSizeMB - volumeDetails.SizeInMB
+	if requiredMB <= 0 || volumeDetails.DatastoreUrl == "" {
+		return "", nil
+	}
+	datacenters, err := vc.GetDatacenters(ctx)
+	if err != nil {
+		return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to get datacenters. Error: %+v", err)
+	}
+	for _, dc := range datacenters {
+		dsInfo, err := dc.GetDatastoreInfoByURL(ctx, volumeDetails.DatastoreUrl)
+		if err != nil {
+			log.Debugf("datastore %q not found in datacenter %q. Error: %+v",
+				volumeDetails.DatastoreUrl, dc.InventoryPath, err)
+			continue
+		}
+		freeSpaceMB := dsInfo.Info.FreeSpace / common.MbInBytes
+		log.Infof("Datastore %q of volume %q has %d MB free space, expansion from %d MB to %d MB requires %d MB",
+			volumeDetails.DatastoreUrl, volumeID, freeSpaceMB, volumeDetails.SizeInMB, volSizeMB, requiredMB)
+		if freeSpaceMB < requiredMB {
+			return csifault.CSIResourceExhaustedFault, logger.LogNewErrorCodef(log, codes.ResourceExhausted,
+				"datastore %q of volume %q has %d MB free space which is not enough to expand the volume "+
+					"from %d MB to %d MB", volumeDetails.DatastoreUrl, volumeID, freeSpaceMB,
+				volumeDetails.SizeInMB, volSizeMB)
+		}
+		return "", nil
+	}
+	log.Warnf("datastore %q of volume %q not found, skipping the free space check for expansion",
+		volumeDetails.DatastoreUrl, volumeID)
+	return "", nil
+}
+
+// validateSnapshotRestoreEncryption rejects restoring a snapshot of an
+// encrypted volume into a storage policy which does not enable encryption.
+func validateSnapshotRestoreEncryption(ctx context.Context, vc *vsphere.VirtualCenter,
+	volumeManager cnsvolume.Manager, snapshotVolumeID string, storagePolicyName string) (string, error) {
+	log := logger.GetLogger(ctx)
+	vStorageObject, err := volumeManager.RetrieveVStorageObject(ctx, snapshotVolumeID)
+	if err != nil {
+		return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to retrieve source volume: %s. Error: %+v", snapshotVolumeID, err)
+	}
+	backingInfo, ok := vStorageObject.Config.Backing.(*types.BaseConfigInfoDiskFileBackingInfo)
+	if !ok || backingInfo.KeyId == nil {
+		return "", nil
+	}
+	storagePolicyID, err := vc.GetStoragePolicyIDByName(ctx, storagePolicyName)
+	if err != nil {
+		return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to get storage policy ID for storage policy %q. Error: %+v", storagePolicyName, err)
+	}
+	isEncryptionPolicy, err := vc.IsEncryptionPolicy(ctx, storagePolicyID)
+	if err != nil {
+		return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to check if storage policy %q enables encryption. Error: %+v", storagePolicyName, err)
+	}
+	if !isEncryptionPolicy {
+		return csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"source volume: %s of the snapshot is encrypted, it cannot be restored into storage policy %q "+
+				"which does not enable encryption", snapshotVolumeID, storagePolicyName)
+	}
+	return "", nil
+}
+
+// relocateRestoredVolume relocates a volume restored from a snapshot to a
+// datastore compatible with the storage policy of the new volume, when the
+// volume has been restored on the datastore of the snapshot which is not
+// compatible with the policy or not accessible to all nodes. It returns the
+// URL of the datastore of the volume.
+func (c *controller) relocateRestoredVolume(ctx context.Context, vc *vsphere.VirtualCenter, volumeID string,
+	spec common.CreateVolumeSpec, sharedDatastores []*vsphere.DatastoreInfo) (string, string, error) {
+	log := logger.GetLogger(ctx)
+	volumeDetailsMap, err := utils.QueryVolumeDetailsUtil(ctx, c.manager.VolumeManager,
+		[]cnstypes.CnsVolumeId{{Id: volumeID}})
+	if err != nil {
+		return "", csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to query details of volume %q. Error: %+v", volumeID, err)
+	}
+	volumeDetails, ok := volumeDetailsMap[volumeID]
+	if !ok {
+		return "", csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"cns query volume did not return the volume: %s", volumeID)
+	}
+	storagePolicyID, err := vc.GetStoragePolicyIDByName(ctx, spec.ScParams.StoragePolicyName)
+	if err != nil {
+		return "", csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to get storage policy ID for storage policy %q. Error: %+v",
+			spec.ScParams.StoragePolicyName, err)
+	}
+	datastoreURL := strings.TrimSpace(volumeDetails.DatastoreUrl)
+	if spec.ScParams.DatastoreURL == "" || strings.TrimSpace(spec.ScParams.DatastoreURL) == datastoreURL {
+		for _, ds := range sharedDatastores {
+			if strings.TrimSpace(ds.Info.Url) != datastoreURL {
+				continue
+			}
+			compat, err := vc.PbmCheckCompatibility(ctx, []types.ManagedObjectReference{ds.Reference()},
+				storagePolicyID)
+			if err != nil {
+				return "", csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+					"failed to find datastore compatibility with storage policy ID %q. Error: %+v",
+					storagePolicyID, err)
+			}
+			if len(compat.CompatibleDatastores()) != 0 {
+				return volumeDetails.DatastoreUrl, "", nil
+			}
+			break
+		}
+	}
+
+	// Select the target datastore among all the compatible datastores instead
+	// of the datastore of the snapshot.
+	spec.ContentSourceSnapshotID = ""
+	target, faultType, err := common.SelectDatastoreForBlockVolumeUtil(ctx, c.manager, &spec, sharedDatastores,
+		common.CreateBlockVolumeOptions{FilterSuspendedDatastores: filterSuspendedDatastores})
+	if err != nil {
+		return "", faultType, err
+	}
+	log.Infof("Relocating volume %q restored from snapshot from datastore %q to datastore %q "+
+		"compatible with storage policy %q", volumeID, volumeDetails.DatastoreUrl, target.Info.Url,
+		spec.ScParams.StoragePolicyName)
+	relocateSpec := cnstypes.NewCnsBlockVolumeRelocateSpec(volumeID, target.Reference(),
+		&types.VirtualMachineDefinedProfileSpec{ProfileId: storagePolicyID})
+	task, err := c.manager.VolumeManager.RelocateVolume(ctx, relocateSpec)
+	if err != nil {
+		return "", csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to relocate volume %q to datastore %q. Error: %+v", volumeID, target.Info.Url, err)
+	}
+	taskInfo, err := task.WaitForResultEx(ctx)
+	if err != nil {
+		return "", csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to relocate volume %q to datastore %q. Error: %+v", volumeID, target.Info.Url, err)
+	}
+	if results, ok := taskInfo.Result.(cnstypes.CnsVolumeOperationBatchResult); ok {
+		for _, result := range results.VolumeResults {
+			if fault := result.GetCnsVolumeOperationResult().Fault; fault != nil {
+				return "", csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+					"failed to relocate volume %q to datastore %q. Fault: %+v", volumeID, target.Info.Url,
+					fault.LocalizedMessage)
+			}
+		}
+	}
+	return target.Info.Url, "", nil
+}
+
+// volumeRelocations tracks the CNS relocate tasks started by
+// ControllerModifyVolume, so that a retried request waits for the relocation
+// in progress instead of starting another one.
+type volumeRelocations struct {
+	mux   sync.Mutex
+	tasks map[string]*volumeRelocation
+}
+
+// volumeRelocation is a relocate task in progress and the storage policy the
+// volume is relocated to.
+type volumeRelocation struct {
+	task            *object.Task
+	storagePolicyID string
+}
+
+// modifyVolumeRelocations holds the relocate tasks in progress on this controller.
+var modifyVolumeRelocations = &volumeRelocations{tasks: make(map[string]*volumeRelocation)}
+
+func (r *volumeRelocations) get(volumeID string) *volumeRelocation {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.tasks[volumeID]
+}
+
+func (r *volumeRelocations) add(volumeID string, storagePolicyID string, task *object.Task) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.tasks[volumeID] = &volumeRelocation{task: task, storagePolicyID: storagePolicyID}
+}
+
+func (r *volumeRelocations) remove(volumeID string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	delete(r.tasks, volumeID)
+}
+
+// getModifyVolumeStoragePolicy returns the storage policy ID requested in the
+// mutable parameters of ControllerModifyVolume. The policy may be given by name
+// or by ID, and no other parameter can be modified.
+func getModifyVolumeStoragePolicy(ctx context.Context, vc *vsphere.VirtualCenter,
+	mutableParams map[string]string) (string, string, error) {
+	log := logger.GetLogger(ctx)
+	var storagePolicyName, storagePolicyID string
+	for param, value := range mutableParams {
+		switch strings.ToLower(param) {
+		case common.AttributeStoragePolicyName:
+			storagePolicyName = value
+		case common.AttributeStoragePolicyID:
+			storagePolicyID = value
+		default:
+			return "", csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+				"parameter %q cannot be modified, only %q, %q, %q or %q are supported", param,
+				common.AttributeStoragePolicyName, common.AttributeStoragePolicyID, common.AttributeIopsLimit,
+				common.AttributeThroughputLimit)
+		}
+	}
+	if storagePolicyName == "" && storagePolicyID == "" {
+		return "", csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"one of %q or %q must be given in the mutable parameters", common.AttributeStoragePolicyName,
+			common.AttributeStoragePolicyID)
+	}
+	if storagePolicyName != "" && storagePolicyID != "" {
+		return "", csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"only one of %q or %q can be given in the mutable parameters", common.AttributeStoragePolicyName,
+			common.AttributeStoragePolicyID)
+	}
+	// Only a missing storage policy is a bad parameter, other errors e.g. of
+	// the connection to PBM are transient and can be retried.
+	storagePolicyIDs, err := vc.GetStoragePolicyIDsByName(ctx)
+	if err != nil {
+		return "", csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to get storage policies. Error: %+v", err)
+	}
+	if storagePolicyName != "" {
+		var ok bool
+		if storagePolicyID, ok = storagePolicyIDs[storagePolicyName]; !ok {
+			return "", csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+				"storage policy %q not found", storagePolicyName)
+		}
+		return storagePolicyID, "", nil
+	}
+	for _, id := range storagePolicyIDs {
+		if id == storagePolicyID {
+			return storagePolicyID, "", nil
+		}
+	}
+	return "", csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+		"storage policy with ID %q not found", storagePolicyID)
+}
+
+// modifyVolumeStoragePolicy changes the storage policy of the block volume to
+// the given policy. The policy is applied in place if the datastore of the
+// volume is compatible with it, otherwise the volume is relocated to a
+// compatible datastore accessible to all nodes. Changes which require the
+// volume to be encrypted or decrypted are rejected.
+func (c *controller) modifyVolumeStoragePolicy(ctx context.Context, vc *vsphere.VirtualCenter,
+	volumeManager cnsvolume.Manager, volumeID string, storagePolicyID string) (string, error) {
+	log := logger.GetLogger(ctx)
+	if relocation := modifyVolumeRelocations.get(volumeID); relocation != nil {
+		if relocation.storagePolicyID != storagePolicyID {
+			return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Aborted,
+				"relocation of volume %q to storage policy %q is in progress", volumeID,
+				relocation.storagePolicyID)
+		}
+		log.Infof("Relocation of volume %q to storage policy %q is in progress, waiting for it to complete",
+			volumeID, storagePolicyID)
+		return waitForVolumeRelocation(ctx, volumeID, relocation.task)
+	}
+	querySelection := &cnstypes.CnsQuerySelection{
+		Names: []string{
+			string(cnstypes.QuerySelectionNameTypeVolumeType),
+			string(cnstypes.QuerySelectionNameTypePolicyId),
+			string(cnstypes.QuerySelectionNameTypeBackingObjectDetails),
+		},
+	}
+	cnsVolume, err := common.QueryVolumeByID(ctx, volumeManager, volumeID, querySelection)
+	if err != nil {
+		if err == common.ErrNotFound {
+			return csifault.CSINotFoundFault, logger.LogNewErrorCodef(log, codes.NotFound,
+				"volume: %s not found", volumeID)
+		}
+		return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to query volume: %s. Error: %+v", volumeID, err)
+	}
+	if cnsVolume.VolumeType != common.BlockVolumeType {
+		return csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"storage policy of volume: %s of type %s cannot be modified", volumeID, cnsVolume.VolumeType)
+	}
+	if cnsVolume.StoragePolicyId == storagePolicyID {
+		log.Infof("Volume %q already has storage policy %q", volumeID, storagePolicyID)
+		return "", nil
+	}
+
+	vStorageObject, err := volumeManager.RetrieveVStorageObject(ctx, volumeID)
+	if err != nil {
+		return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to retrieve volume: %s. Error: %+v", volumeID, err)
+	}
+	backingInfo, ok := vStorageObject.Config.Backing.(*types.BaseConfigInfoDiskFileBackingInfo)
+	isEncrypted := ok && backingInfo.KeyId != nil
+	isEncryptionPolicy, err := vc.IsEncryptionPolicy(ctx, storagePolicyID)
+	if err != nil {
+		return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to check if storage policy %q enables encryption. Error: %+v", storagePolicyID, err)
+	}
+	if isEncrypted != isEncryptionPolicy {
+		return csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"changing storage policy of volume: %s to %q requires re-encrypting the volume, which is not "+
+				"supported", volumeID, storagePolicyID)
+	}
+
+	datastore := vStorageObject.Config.Backing.GetBaseConfigInfoBackingInfo().Datastore
+	compat, err := vc.PbmCheckCompatibility(ctx, []types.ManagedObjectReference{datastore}, storagePolicyID)
+	if err != nil {
+		return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to find datastore compatibility with storage policy ID %q. Error: %+v", storagePolicyID, err)
+	}
+	if len(compat.CompatibleDatastores()) != 0 {
+		log.Infof("Datastore %v of volume %q is compatible with storage policy %q, updating the policy in place",
+			datastore, volumeID, storagePolicyID)
+		err = volumeManager.UpdateVStorageObjectPolicy(ctx, volumeID, storagePolicyID)
+		if err != nil {
+			return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to update storage policy of volume: %s to %q. Error: %+v", volumeID, storagePolicyID, err)
+		}
+		return "", nil
+	}
+
+	if multivCenterCSITopologyEnabled {
+		return csifault.CSIFailedPreconditionFault, logger.LogNewErrorCodef(log, codes.FailedPrecondition,
+			"storage policy %q requires relocating volume: %s to another datastore, which is not supported "+
+				"with multiple vCenter servers", storagePolicyID, volumeID)
+	}
+	sharedDatastores, faultType, err := c.getSharedDatastoresForBlockVolume(ctx, nil, vc,
+		&common.StorageClassParams{})
+	if err != nil {
+		return faultType, err
+	}
+	spec := common.CreateVolumeSpec{
+		Name:            volumeID,
+		ScParams:        &common.StorageClassParams{},
+		StoragePolicyID: storagePolicyID,
+		CapacityMB:      cnsVolume.BackingObjectDetails.GetCnsBackingObjectDetails().CapacityInMb,
+	}
+	target, faultType, err := common.SelectDatastoreForBlockVolumeUtil(ctx, c.manager, &spec, sharedDatastores,
+		common.CreateBlockVolumeOptions{FilterSuspendedDatastores: filterSuspendedDatastores})
+	if err != nil {
+		return faultType, err
+	}
+	log.Infof("Relocating volume %q to datastore %q compatible with storage policy %q", volumeID,
+		target.Info.Url, storagePolicyID)
+	relocateSpec := cnstypes.NewCnsBlockVolumeRelocateSpec(volumeID, target.Reference(),
+		&types.VirtualMachineDefinedProfileSpec{ProfileId: storagePolicyID})
+	task, err := volumeManager.RelocateVolume(ctx, relocateSpec)
+	if err != nil {
+		return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to relocate volume %q to datastore %q. Error: %+v", volumeID, target.Info.Url, err)
+	}
+	modifyVolumeRelocations.add(volumeID, storagePolicyID, task)
+	return waitForVolumeRelocation(ctx, volumeID, task)
+}
+
+// waitForVolumeRelocation waits for the relocate task of the volume to
+// complete and logs its progress. If the request times out before the task
+// completes, codes.Aborted is returned and the task is left for a retried
+// request to wait on.
+func waitForVolumeRelocation(ctx context.Context, volumeID string, task *object.Task) (string, error) {
+	log := logger.GetLogger(ctx)
+	progressSinker := progress.SinkFunc(func() chan<- progress.Report {
+		reports := make(chan progress.Report)
+		go func() {
+			for report := range reports {
+				log.Infof("Relocation of volume %q is %.0f%% complete", volumeID, report.Percentage())
+			}
+		}()
+		return reports
+	})
+	taskInfo, err := task.WaitForResultEx(ctx, progressSinker)
+	if err != nil {
+		if ctx.Err() != nil {
+			return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Aborted,
+				"relocation of volume %q is still in progress", volumeID)
+		}
+		modifyVolumeRelocations.remove(volumeID)
+		return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to relocate volume %q. Error: %+v", volumeID, err)
+	}
+	modifyVolumeRelocations.remove(volumeID)
+	if results, ok := taskInfo.Result.(cnstypes.CnsVolumeOperationBatchResult); ok {
+		for _, result := range results.VolumeResults {
+			if fault := result.GetCnsVolumeOperationResult().Fault; fault != nil {
+				return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+					"failed to relocate volume %q. Fault: %+v", volumeID, fault.LocalizedMessage)
+			}
+		}
+	}
+	log.Infof("Volume %q relocated successfully", volumeID)
+	return "", nil
+}
+
+// maxDatastoreOvercommitPercent is the maximum ratio, in percent, of the space
+// provisioned on a datastore to its capacity for new block volumes to be
+// placed on it. The overcommit policy is disabled if it is 0.
+var maxDatastoreOvercommitPercent int
+
+// getDatastoreOvercommitRatio returns the ratio of the space provisioned on
+// the datastore to its capacity once a volume of additionalBytes is placed on
+// it. The provisioned space includes the space committed on the datastore and
+// the space thin provisioned files may still grow by.
+func getDatastoreOvercommitRatio(summary types.DatastoreSummary, additionalBytes int64) float64 {
+	if summary.Capacity <= 0 {
+		return 0
+	}
+	provisioned := summary.Capacity - summary.FreeSpace + summary.Uncommitted + additionalBytes
+	return float64(provisioned) / float64(summary.Capacity)
+}
+
+// filterDatastoresByOvercommit returns the datastores on which placing a
+// volume of capacityMB keeps the ratio of provisioned space to capacity within
+// maxOvercommitPercent, and records the current ratio of each datastore in
+// the DatastoreOvercommitRatio metric. A ResourceExhausted error is returned
+// if no datastore qualifies.
+func filterDatastoresByOvercommit(ctx context.Context, vc *vsphere.VirtualCenter, maxOvercommitPercent int,
+	capacityMB int64, datastores []*vsphere.DatastoreInfo) ([]*vsphere.DatastoreInfo, string, error) {
+	log := logger.GetLogger(ctx)
+	if len(datastores) == 0 {
+		return datastores, "", nil
+	}
+	var refs []types.ManagedObjectReference
+	for _, datastore := range datastores {
+		refs = append(refs, datastore.Reference())
+	}
+	var dsMoList []mo.Datastore
+	pc := property.DefaultCollector(vc.Client.Client)
+	err := pc.Retrieve(ctx, refs, []string{"summary"}, &dsMoList)
+	if err != nil {
+		return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to retrieve the summary of datastores %v. Error: %+v", datastores, err)
+	}
+	summaries := make(map[types.ManagedObjectReference]types.DatastoreSummary, len(dsMoList))
+	for _, dsMo := range dsMoList {
+		summaries[dsMo.Reference()] = dsMo.Summary
+	}
+	maxRatio := float64(maxOvercommitPercent) / 100
+	var filteredDatastores []*vsphere.DatastoreInfo
+	for _, datastore := range datastores {
+		summary, ok := summaries[datastore.Reference()]
+		if !ok || summary.Capacity <= 0 {
+			log.Warnf("failed to get the capacity of datastore %q, skipping the overcommit check for it",
+				datastore.Info.Url)
+			filteredDatastores = append(filteredDatastores, datastore)
+			continue
+		}
+		prometheus.DatastoreOvercommitRatio.WithLabelValues(datastore.Info.Url).Set(
+			getDatastoreOvercommitRatio(summary, 0))
+		ratio := getDatastoreOvercommitRatio(summary, capacityMB*common.MbInBytes)
+		if ratio > maxRatio {
+			log.Infof("Skipping datastore %q as placing the volume on it would overcommit it to %.0f%%, "+
+				"above the maximum of %d%%", datastore.Info.Url, ratio*100, maxOvercommitPercent)
+			continue
+		}
+		filteredDatastores = append(filteredDatastores, datastore)
+	}
+	if len(filteredDatastores) == 0 {
+		return nil, csifault.CSIResourceExhaustedFault, logger.LogNewErrorCodef(log, codes.ResourceExhausted,
+			"placing a volume of %d MB would overcommit all of the datastores %v beyond %d%% of their capacity",
+			capacityMB, datastores, maxOvercommitPercent)
+	}
+	return filteredDatastores, "", nil
+}
+
+// getEffectiveDiskFormat returns the disk format of the virtual disk backing
+// the given volume, in terms of the values of the diskformat StorageClass param.
+func (c *controller) getEffectiveDiskFormat(ctx context.Context, volumeID string) (string, error) {
+	vStorageObject, err := c.manager.VolumeManager.RetrieveVStorageObject(ctx, volumeID)
+	if err != nil {
+		return "", err
+	}
+	backingInfo, ok := vStorageObject.Config.Backing.(*types.BaseConfigInfoDiskFileBackingInfo)
+	if !ok {
+		return "", fmt.Errorf("failed to retrieve backing info of volume: %s", volumeID)
+	}
+	for diskFormat, provisioningType := range common.DiskFormatToProvisioningType {
+		if backingInfo.ProvisioningType == string(provisioningType) {
+			return diskFormat, nil
+		}
+	}
+	return backingInfo.ProvisioningType, nil
+}
+
+// nodeVMLookupErrorCode returns codes.Unavailable if the node VM could not be
+// looked up because the vCenter inventory is unavailable, so that the request
+// is retried once vCenter recovers, and codes.Internal otherwise.
+func nodeVMLookupErrorCode(err error) codes.Code {
+	if errors.Is(err, vsphere.ErrVCenterInventoryUnavailable) {
+		return codes.Unavailable
+	}
+	return codes.Internal
+}
+
+// getModifyVolumeIopsLimit returns the IOPS limit requested by the iopsLimit
+// and throughputLimit mutable parameters of ControllerModifyVolume, and the
+// remaining mutable parameters. False is returned if neither is given.
+func getModifyVolumeIopsLimit(ctx context.Context, mutableParams map[string]string) (int64, bool,
+	map[string]string, string, error) {
+	log := logger.GetLogger(ctx)
+	var iopsLimit, throughputLimit string
+	otherParams := make(map[string]string)
+	for param, value := range mutableParams {
+		switch strings.ToLower(param) {
+		case common.AttributeIopsLimit:
+			iopsLimit = value
+		case common.AttributeThroughputLimit:
+			throughputLimit = value
+		default:
+			otherParams[param] = value
+		}
+	}
+	if iopsLimit == "" && throughputLimit == "" {
+		return 0, false, otherParams, "", nil
+	}
+	limit, err := common.ParseIopsLimit(iopsLimit, throughputLimit)
+	if err != nil {
+		return 0, false, nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCode(log,
+			codes.InvalidArgument, err.Error())
+	}
+	return limit, true, otherParams, "", nil
+}
+
+// validateIopsLimitForDatastore returns an InvalidArgument error if IOPS
+// limits of virtual disks cannot be set on the datastore with the given URL.
+// The IO limits of vSAN and vVol datastores are governed by the storage
+// policy.
+func validateIopsLimitForDatastore(ctx context.Context, vc *vsphere.VirtualCenter, datastoreURL string) (
+	string, error) {
+	log := logger.GetLogger(ctx)
+	datacenters, err := vc.GetDatacenters(ctx)
+	if err != nil {
+		return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to get datacenters. Error: %+v", err)
+	}
+	for _, dc := range datacenters {
+		dsInfo, err := dc.GetDatastoreInfoByURL(ctx, datastoreURL)
+		if err != nil {
+			log.Debugf("datastore %q not found in datacenter %q. Error: %+v", datastoreURL,
+				dc.InventoryPath, err)
+			continue
+		}
+		_, datastoreType, err := dsInfo.GetDatastoreURLAndType(ctx)
+		if err != nil {
+			return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to get type of datastore %q. Error: %+v", datastoreURL, err)
+		}
+		if strings.EqualFold(datastoreType, common.VsanDatastoreType) || strings.EqualFold(datastoreType, "VVOL") {
+			return csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+				"IOPS limits are not supported on datastore %q of type %s, the IO limits of volumes on this "+
+					"datastore are governed by the storage policy", datastoreURL, datastoreType)
+		}
+		return "", nil
+	}
+	log.Warnf("datastore %q not found, skipping the IOPS limit check", datastoreURL)
+	return "", nil
+}
+
+// setVolumeIopsLimit records the IOPS limit in the FCD metadata of the block
+// volume, so that it is applied whenever the volume is attached, and applies
+// it to the virtual disks of the VMs the volume is attached to.
+func setVolumeIopsLimit(ctx context.Context, vc *vsphere.VirtualCenter, volumeManager cnsvolume.Manager,
+	volumeID string, datastoreURL string, iopsLimit int64) (string, error) {
+	log := logger.GetLogger(ctx)
+	if datastoreURL == "" {
+		volumeDetailsMap, err := utils.QueryVolumeDetailsUtil(ctx, volumeManager,
+			[]cnstypes.CnsVolumeId{{Id: volumeID}})
+		if err != nil {
+			return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to query details of volume %q. Error: %+v", volumeID, err)
+		}
+		volumeDetails, ok := volumeDetailsMap[volumeID]
+		if !ok {
+			return csifault.CSINotFoundFault, logger.LogNewErrorCodef(log, codes.NotFound,
+				"volume %q not found", volumeID)
+		}
+		datastoreURL = volumeDetails.DatastoreUrl
+	}
+	if iopsLimit != common.IopsLimitUnlimited && datastoreURL != "" {
+		faultType, err := validateIopsLimitForDatastore(ctx, vc, datastoreURL)
+		if err != nil {
+			return faultType, err
+		}
+	}
+	err := volumeManager.UpdateVStorageObjectMetadata(ctx, volumeID,
+		[]types.KeyValue{{Key: common.IopsLimitMetadataKey, Value: strconv.FormatInt(iopsLimit, 10)}})
+	if err != nil {
+		return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to record IOPS limit of volume %q. Error: %+v", volumeID, err)
+	}
+	associations, err := volumeManager.RetrieveVStorageObjectAssociations(ctx, volumeID)
+	if err != nil {
+		return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to find the VMs volume %q is attached to. Error: %+v", volumeID, err)
+	}
+	for _, association := range associations {
+		vmRef := types.ManagedObjectReference{Type: "VirtualMachine", Value: association.VmId}
+		vm := &vsphere.VirtualMachine{
+			VirtualCenterHost: vc.Config.Host,
+			VirtualMachine:    object.NewVirtualMachine(vc.Client.Client, vmRef),
+		}
+		if _, err := volumeManager.SetDiskIOPSLimit(ctx, vm, volumeID, iopsLimit); err != nil {
+			return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to set IOPS limit of volume %q on VM %q. Error: %+v", volumeID, vmRef.Value, err)
+		}
+	}
+	log.Infof("IOPS limit of volume %q set to %d", volumeID, iopsLimit)
+	return "", nil
+}
+
+// applyVolumeIopsLimit applies the IOPS limit recorded in the FCD metadata of
+// the block volume to its virtual disk on the given node VM. Volumes whose
+// metadata cannot be retrieved, e.g. when the vCenter does not serve the vslm
+// endpoint, are left without a limit, as no limit can be recorded for them.
+func applyVolumeIopsLimit(ctx context.Context, volumeManager cnsvolume.Manager, nodeVM *vsphere.VirtualMachine,
+	volumeID string) (string, error) {
+	log := logger.GetLogger(ctx)
+	metadata, err := volumeManager.RetrieveVStorageObjectMetadata(ctx, volumeID, common.IopsLimitMetadataKey)
+	if err != nil {
+		log.Warnf("failed to retrieve metadata of volume %q, skipping its IOPS limit. Error: %+v", volumeID, err)
+		return "", nil
+	}
+	for _, kv := range metadata {
+		if kv.Key != common.IopsLimitMetadataKey {
+			continue
+		}
+		iopsLimit, err := strconv.ParseInt(kv.Value, 10, 64)
+		if err != nil {
+			log.Warnf("invalid IOPS limit %q recorded for volume %q, skipping it", kv.Value, volumeID)
+			return "", nil
+		}
+		if _, err := volumeManager.SetDiskIOPSLimit(ctx, nodeVM, volumeID, iopsLimit); err != nil {
+			return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to set IOPS limit of volume %q on node VM %v. Error: %+v", volumeID, nodeVM, err)
+		}
+	}
+	return "", nil
+}
+
+// getStoragePod returns the datastore cluster with the given name and the
+// datacenter it is in. codes.InvalidArgument is returned if the datastore
+// cluster does not exist or does not have Storage DRS enabled.
+func getStoragePod(ctx context.Context, vc *vsphere.VirtualCenter,
+	storagePodName string) (*mo.StoragePod, *vsphere.Datacenter, string, error) {
+	log := logger.GetLogger(ctx)
+	datacenters, err := vc.GetDatacenters(ctx)
+	if err != nil {
+		return nil, nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to get datacenters of vCenter %q. Error: %+v", vc.Config.Host, err)
+	}
+	for _, dc := range datacenters {
+		storagePod, err := dc.GetStoragePodByName(ctx, storagePodName)
+		if err != nil {
+			var notFoundErr *find.NotFoundError
+			if errors.As(err, &notFoundErr) {
+				continue
+			}
+			return nil, nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to get datastore cluster %q in datacenter %q. Error: %+v", storagePodName,
+				dc.InventoryPath, err)
+		}
+		if storagePod.PodStorageDrsEntry == nil || !storagePod.PodStorageDrsEntry.StorageDrsConfig.PodConfig.Enabled {
+			return nil, nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+				"Storage DRS is not enabled on datastore cluster %q given in param %q", storagePodName,
+				common.AttributeStoragePod)
+		}
+		return storagePod, dc, "", nil
+	}
+	return nil, nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+		"datastore cluster %q given in param %q is not found in vCenter %q", storagePodName,
+		common.AttributeStoragePod, vc.Config.Host)
+}
+
+// filterDatastoresByStoragePod returns the datastores from the given list
+// which are members of the given datastore cluster. codes.InvalidArgument is
+// returned if the datastore cluster does not exist, does not have Storage DRS
+// enabled or has no member compatible with the volume.
+func filterDatastoresByStoragePod(ctx context.Context, vc *vsphere.VirtualCenter,
+	datastores []*vsphere.DatastoreInfo, storagePodName string) ([]*vsphere.DatastoreInfo, string, error) {
+	log := logger.GetLogger(ctx)
+	storagePod, _, faultType, err := getStoragePod(ctx, vc, storagePodName)
+	if err != nil {
+		return nil, faultType, err
+	}
+	members := make(map[string]bool)
+	for _, child := range storagePod.ChildEntity {
+		members[child.Value] = true
+	}
+	var filteredDatastores []*vsphere.DatastoreInfo
+	for _, ds := range datastores {
+		if members[ds.Reference().Value] {
+			filteredDatastores = append(filteredDatastores, ds)
+		}
+	}
+	if len(filteredDatastores) == 0 {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"none of the compatible datastores is a member of datastore cluster %q given in param %q",
+			storagePodName, common.AttributeStoragePod)
+	}
+	log.Debugf("Datastores %v are members of datastore cluster %q", filteredDatastores, storagePodName)
+	return filteredDatastores, "", nil
+}
+
+// recommendStoragePodDatastore asks Storage DRS for the placement of a disk of
+// the given capacity in the given datastore cluster, and returns the datastore
+// from the given list it recommends. CNS places a volume on one of the
+// datastores it is given, so the volume is created on the recommended member
+// only. The recommendations are ordered by Storage DRS, the first one on a
+// datastore compatible with the volume is used. codes.FailedPrecondition is
+// returned if Storage DRS recommends no such datastore.
+func recommendStoragePodDatastore(ctx context.Context, vc *vsphere.VirtualCenter,
+	datastores []*vsphere.DatastoreInfo, storagePodName string,
+	capacityMB int64) ([]*vsphere.DatastoreInfo, string, error) {
+	log := logger.GetLogger(ctx)
+	storagePod, dc, faultType, err := getStoragePod(ctx, vc, storagePodName)
+	if err != nil {
+		return nil, faultType, err
+	}
+	finder := find.NewFinder(dc.Client(), false)
+	finder.SetDatacenter(dc.Datacenter)
+	resourcePools, err := finder.ResourcePoolList(ctx, "*/Resources")
+	if err != nil {
+		return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to get resource pools of datacenter %q. Error: %+v", dc.InventoryPath, err)
+	}
+	folders, err := dc.Folders(ctx)
+	if err != nil {
+		return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to get folders of datacenter %q. Error: %+v", dc.InventoryPath, err)
+	}
+	// Storage DRS places disks of virtual machines, describe the volume as the
+	// only disk of a virtual machine to be created.
+	const diskKey = -1
+	resourcePool := resourcePools[0].Reference()
+	vmFolder := folders.VmFolder.Reference()
+	placementSpec := types.StoragePlacementSpec{
+		Type:         string(types.StoragePlacementSpecPlacementTypeCreate),
+		ResourcePool: &resourcePool,
+		Folder:       &vmFolder,
+		PodSelectionSpec: types.StorageDrsPodSelectionSpec{
+			StoragePod: &storagePod.Self,
+			InitialVmConfig: []types.VmPodConfigForPlacement{{
+				StoragePod: storagePod.Self,
+				Disk:       []types.PodDiskLocator{{DiskId: diskKey}},
+			}},
+		},
+		ConfigSpec: &types.VirtualMachineConfigSpec{
+			Name: "csi-placement-" + storagePod.Name,
+			DeviceChange: []types.BaseVirtualDeviceConfigSpec{
+				&types.VirtualDeviceConfigSpec{
+					Operation:     types.VirtualDeviceConfigSpecOperationAdd,
+					FileOperation: types.VirtualDeviceConfigSpecFileOperationCreate,
+					Device: &types.VirtualDisk{
+						VirtualDevice: types.VirtualDevice{
+							Key: diskKey,
+							Backing: &types.VirtualDiskFlatVer2BackingInfo{
+								DiskMode: string(types.VirtualDiskModePersistent),
+							},
+						},
+						CapacityInKB: capacityMB * 1024,
+					},
+				},
+			},
+		},
+	}
+	result, err := object.NewStorageResourceManager(vc.Client.Client).RecommendDatastores(ctx, placementSpec)
+	if err != nil {
+		return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to get Storage DRS recommendations for datastore cluster %q. Error: %+v", storagePodName, err)
+	}
+	for _, recommendation := range result.Recommendations {
+		for _, action := range recommendation.Action {
+			placementAction, ok := action.(*types.StoragePlacementAction)
+			if !ok {
+				continue
+			}
+			for _, ds := range datastores {
+				if ds.Reference() == placementAction.Destination {
+					log.Infof("Storage DRS recommends datastore %q of datastore cluster %q", ds.Info.Url,
+						storagePodName)
+					return []*vsphere.DatastoreInfo{ds}, "", nil
+				}
+			}
+		}
+	}
+	return nil, csifault.CSIFailedPreconditionFault, logger.LogNewErrorCodef(log, codes.FailedPrecondition,
+		"Storage DRS recommends no datastore of datastore cluster %q compatible with the volume",
+		storagePodName)
+}
+
+// filterDatastoresByQualifiedName returns the datastore from the given list
+// with the given datacenter-qualified name. The datastore is looked up in the
+// datacenter it is qualified with, so that datastores with the same name in
+// other datacenters are not mistaken for it. codes.InvalidArgument is returned
+// if the name does not resolve to exactly one datastore, or if the datastore
+// is not compatible with the volume.
+func filterDatastoresByQualifiedName(ctx context.Context, vc *vsphere.VirtualCenter,
+	datastores []*vsphere.DatastoreInfo, qualifiedName string) ([]*vsphere.DatastoreInfo, string, error) {
+	log := logger.GetLogger(ctx)
+	dcPath, dsName, err := common.SplitQualifiedDatastore(qualifiedName)
+	if err != nil {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCode(log, codes.InvalidArgument,
+			err.Error())
+	}
+	datacenters, err := vc.GetDatacenters(ctx)
+	if err != nil {
+		return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to get datacenters of vCenter %q. Error: %+v", vc.Config.Host, err)
+	}
+	var matchingDatacenters []*vsphere.Datacenter
+	for _, dc := range datacenters {
+		inventoryPath := strings.Trim(dc.InventoryPath, "/")
+		if inventoryPath == dcPath || path.Base(inventoryPath) == dcPath {
+			matchingDatacenters = append(matchingDatacenters, dc)
+		}
+	}
+	if len(matchingDatacenters) != 1 {
+		return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"datacenter %q given in param %q matches %d datacenters of vCenter %q, expecting exactly one",
+			dcPath, common.AttributeQualifiedDatastore, len(matchingDatacenters), vc.Config.Host)
+	}
+	dc := matchingDatacenters[0]
+	datastore, err := dc.GetDatastoreInfoByName(ctx, dsName)
+	if err != nil {
+		var notFoundErr *find.NotFoundError
+		var multipleFoundErr *find.MultipleFoundError
+		if errors.As(err, &notFoundErr) || errors.As(err, &multipleFoundErr) {
+			return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+				"datastore %q given in param %q does not resolve to exactly one datastore in datacenter %q. "+
+					"Error: %+v", qualifiedName, common.AttributeQualifiedDatastore, dc.InventoryPath, err)
+		}
+		return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to get datastore %q in datacenter %q. Error: %+v", dsName, dc.InventoryPath, err)
+	}
+	for _, ds := range datastores {
+		if ds.Reference().Value == datastore.Reference().Value {
+			log.Debugf("Datastore %q given in param %q resolved to %v with URL %q", qualifiedName,
+				common.AttributeQualifiedDatastore, ds.Reference(), ds.Info.Url)
+			return []*vsphere.DatastoreInfo{ds}, "", nil
+		}
+	}
+	return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+		"datastore %q given in param %q with URL %q is not one of the compatible datastores accessible "+
+			"from all nodes", qualifiedName, common.AttributeQualifiedDatastore, datastore.Info.Url)
+}
+
+// defaultSnapshotDeletePolicy is the behavior of DeleteVolume for block
+// volumes which still have snapshots and were not provisioned with a snapshot
+// delete policy.
+var defaultSnapshotDeletePolicy = common.SnapshotDeletePolicyFail
+
+// setDefaultSnapshotDeletePolicy sets the behavior of DeleteVolume for block
+// volumes which still have snapshots and were not provisioned with a snapshot
+// delete policy. The fail policy is used if policy is empty or invalid.
+func setDefaultSnapshotDeletePolicy(ctx context.Context, policy string) {
+	log := logger.GetLogger(ctx)
+	defaultSnapshotDeletePolicy = common.SnapshotDeletePolicyFail
+	if policy == "" {
+		return
+	}
+	parsedPolicy, err := common.ParseSnapshotDeletePolicy(policy)
+	if err != nil {
+		log.Warnf("invalid snapshot delete policy %q in the config, using the %q policy", policy,
+			common.SnapshotDeletePolicyFail)
+		return
+	}
+	defaultSnapshotDeletePolicy = parsedPolicy
+	log.Infof("Default snapshot delete policy is set to %q", defaultSnapshotDeletePolicy)
+}
+
+// getSnapshotDeletePolicy returns the snapshot delete policy recorded in the
+// FCD metadata of the block volume, or the default policy if none was
+// recorded. The default policy is returned for volumes whose metadata cannot
+// be retrieved, e.g. when the vCenter does not serve the vslm endpoint.
+func getSnapshotDeletePolicy(ctx context.Context, volumeManager cnsvolume.Manager, volumeID string) string {
+	log := logger.GetLogger(ctx)
+	metadata, err := volumeManager.RetrieveVStorageObjectMetadata(ctx, volumeID,
+		common.SnapshotDeletePolicyMetadataKey)
+	if err != nil {
+		log.Warnf("failed to retrieve metadata of volume %q, using the default snapshot delete policy %q. "+
+			"Error: %+v", volumeID, defaultSnapshotDeletePolicy, err)
+		return defaultSnapshotDeletePolicy
+	}
+	for _, kv := range metadata {
+		if kv.Key != common.SnapshotDeletePolicyMetadataKey {
+			continue
+		}
+		policy, err := common.ParseSnapshotDeletePolicy(kv.Value)
+		if err != nil {
+			log.Warnf("invalid snapshot delete policy %q recorded for volume %q, using the default policy %q",
+				kv.Value, volumeID, defaultSnapshotDeletePolicy)
+			return defaultSnapshotDeletePolicy
+		}
+		return policy
+	}
+	return defaultSnapshotDeletePolicy
+}
+
+// isVolumeDeleted returns true if CNS does not find the given volume through
+// any of the given volume managers, which confirms that the volume and its
+// snapshots are deleted.
+func isVolumeDeleted(ctx context.Context, volumeID string, volumeManagers ...cnsvolume.Manager) (bool, error) {
+	for _, volumeManager := range volumeManagers {
+		_, err := common.QueryVolumeByID(ctx, volumeManager, volumeID, nil)
+		if err == common.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// deleteVolumeSnapshots deletes all the snapshots of the block volume, starting
+// with the given ones, so that the volume can be deleted. Only orphaned CNS
+// snapshots are deleted: codes.FailedPrecondition is returned without deleting
+// any snapshot while VolumeSnapshotContents reference them, so that the
+// snapshots of the cluster are only deleted by the external-snapshotter.
+func deleteVolumeSnapshots(ctx context.Context, volumeManager cnsvolume.Manager, volumeID string,
+	snapshots []*csi.Snapshot) (string, error) {
+	log := logger.GetLogger(ctx)
+	deleted := make(map[string]bool)
+	for len(snapshots) != 0 {
+		volumeSnapshots, err := getVolumeSnapshotsOfSnapshots(ctx, snapshots)
+		if err != nil {
+			return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Unavailable,
+				"failed to check the VolumeSnapshotContents of the snapshots of volume %q, retry the deletion. "+
+					"Error: %+v", volumeID, err)
+		}
+		if len(volumeSnapshots) != 0 {
+			return csifault.CSIFailedPreconditionFault, logger.LogNewErrorCodef(log, codes.FailedPrecondition,
+				"volume %q cannot be deleted as its snapshots %s are referenced by VolumeSnapshotContents, "+
+					"please delete them before deleting the volume", volumeID,
+				formatVolumeSnapshots(snapshots, volumeSnapshots))
+		}
+		for _, snapshot := range snapshots {
+			if deleted[snapshot.SnapshotId] {
+				return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+					"snapshot %q of volume %q is still present after being deleted", snapshot.SnapshotId,
+					volumeID)
+			}
+			deleted[snapshot.SnapshotId] = true
+			log.Infof("Deleting snapshot %q of volume %q as its snapshot delete policy is %q",
+				snapshot.SnapshotId, volumeID, common.SnapshotDeletePolicyCascade)
+			_, err := common.DeleteSnapshotUtil(ctx, volumeManager, snapshot.SnapshotId, nil)
+			if err != nil && !errors.Is(err, cnsvolume.ErrSnapshotVolumeNotFound) {
+				return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+					"failed to delete snapshot %q of volume %q. Error: %+v", snapshot.SnapshotId, volumeID, err)
+			}
+		}
+		snapshots, _, err = common.QueryVolumeSnapshotsByVolumeID(ctx, volumeManager, volumeID,
+			common.QuerySnapshotLimit)
+		if err != nil {
+			return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to retrieve snapshots for volume: %s. Error: %+v", volumeID, err)
+		}
+	}
+	return "", nil
+}
+
+// describeVolumeSnapshots returns the IDs of the given snapshots, along with
+// the namespaced names of the VolumeSnapshots bound to them, if any.
+func describeVolumeSnapshots(ctx context.Context, snapshots []*csi.Snapshot) string {
+	log := logger.GetLogger(ctx)
+	volumeSnapshots, err := getVolumeSnapshotsOfSnapshots(ctx, snapshots)
+	if err != nil {
+		log.Warnf("failed to find the VolumeSnapshots of snapshots %v. Error: %+v", snapshots, err)
+	}
+	return formatVolumeSnapshots(snapshots, volumeSnapshots)
+}
+
+const (
+	// snapshotHandleIndex is the index of the VolumeSnapshotContents by the
+	// CSI ID of their snapshot.
+	snapshotHandleIndex = "snapshotHandle"
+	// volumeSnapshotContentSyncTimeout is the time to wait for the cache of
+	// the VolumeSnapshotContents to be filled.
+	volumeSnapshotContentSyncTimeout = 30 * time.Second
+)
+
+var (
+	// volumeSnapshotContentIndexer caches the VolumeSnapshotContents of the
+	// cluster, indexed by snapshotHandleIndex. It is started on first use.
+	volumeSnapshotContentIndexer     cache.Indexer
+	volumeSnapshotContentIndexerLock sync.Mutex
+)
+
+// getVolumeSnapshotsOfSnapshots returns the namespaced names of the
+// VolumeSnapshots of the VolumeSnapshotContents referencing the given
+// snapshots, by snapshot ID. The name of the VolumeSnapshotContent is given
+// for those which are not bound to a VolumeSnapshot. It is a variable so that
+// unit tests can stub the lookup of the VolumeSnapshotContents.
+var getVolumeSnapshotsOfSnapshots = func(ctx context.Context, snapshots []*csi.Snapshot) (
+	map[string]string, error) {
+	indexer, err := getVolumeSnapshotContentIndexer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	volumeSnapshots := make(map[string]string)
+	for _, snapshot := range snapshots {
+		contents, err := indexer.ByIndex(snapshotHandleIndex, snapshot.SnapshotId)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range contents {
+			content, ok := obj.(*snapshotv1.VolumeSnapshotContent)
+			if !ok {
+				continue
+			}
+			volumeSnapshots[snapshot.SnapshotId] = "VolumeSnapshotContent " + content.Name
+			if content.Spec.VolumeSnapshotRef.Name != "" {
+				volumeSnapshots[snapshot.SnapshotId] = "VolumeSnapshot " +
+					content.Spec.VolumeSnapshotRef.Namespace + "/" + content.Spec.VolumeSnapshotRef.Name
+			}
+		}
+	}
+	return volumeSnapshots, nil
+}
+
+// getVolumeSnapshotContentIndexer returns the cache of the
+// VolumeSnapshotContents of the cluster, starting it if needed.
+func getVolumeSnapshotContentIndexer(ctx context.Context) (cache.Indexer, error) {
+	volumeSnapshotContentIndexerLock.Lock()
+	defer volumeSnapshotContentIndexerLock.Unlock()
+	if volumeSnapshotContentIndexer != nil {
+		return volumeSnapshotContentIndexer, nil
+	}
+	snapshotterClient, err := k8s.NewSnapshotterClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	informer := snapshotinformers.NewSharedInformerFactory(snapshotterClient, 0).Snapshot().V1().
+		VolumeSnapshotContents().Informer()
+	err = informer.AddIndexers(cache.Indexers{snapshotHandleIndex: getVolumeSnapshotContentSnapshotHandles})
+	if err != nil {
+		return nil, err
+	}
+	stopCh := make(chan struct{})
+	go informer.Run(stopCh)
+	syncCtx, cancel := context.WithTimeout(ctx, volumeSnapshotContentSyncTimeout)
+	defer cancel()
+	if !cache.WaitForCacheSync(syncCtx.Done(), informer.HasSynced) {
+		close(stopCh)
+		return nil, errors.New("timed out waiting for the cache of the VolumeSnapshotContents to sync")
+	}
+	volumeSnapshotContentIndexer = informer.GetIndexer()
+	return volumeSnapshotContentIndexer, nil
+}
+
+// getVolumeSnapshotContentSnapshotHandles returns the CSI ID of the snapshot
+// of the VolumeSnapshotContent, given by its status once the snapshot is
+// created, or by its source if the snapshot is pre-provisioned.
+func getVolumeSnapshotContentSnapshotHandles(obj interface{}) ([]string, error) {
+	content, ok := obj.(*snapshotv1.VolumeSnapshotContent)
+	if !ok {
+		return nil, nil
+	}
+	if content.Status != nil && content.Status.SnapshotHandle != nil {
+		return []string{*content.Status.SnapshotHandle}, nil
+	}
+	if content.Spec.Source.SnapshotHandle != nil {
+		return []string{*content.Spec.Source.SnapshotHandle}, nil
+	}
+	return nil, nil
+}
+
+// formatVolumeSnapshots returns the IDs of the given snapshots, along with the
+// VolumeSnapshots mapped to them in volumeSnapshots.
+func formatVolumeSnapshots(snapshots []*csi.Snapshot, volumeSnapshots map[string]string) string {
+	var descriptions []string
+	for _, snapshot := range snapshots {
+		if volumeSnapshot, ok := volumeSnapshots[snapshot.SnapshotId]; ok {
+			descriptions = append(descriptions, fmt.Sprintf("%q (%s)", snapshot.SnapshotId, volumeSnapshot))
+		} else {
+			descriptions = append(descriptions, strconv.Quote(snapshot.SnapshotId))
+		}
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// getVolumeDatastoreURL returns the URL of the datastore the given volume is
+// placed on. CNS is queried if the URL is not known from the CreateVolume
+// task, e.g. when the volume was created by an earlier attempt. An empty URL
+// is returned if the volume cannot be queried.
+func getVolumeDatastoreURL(ctx context.Context, volumeManager cnsvolume.Manager,
+	volumeInfo *cnsvolume.CnsVolumeInfo) string {
+	log := logger.GetLogger(ctx)
+	if volumeInfo.DatastoreURL != "" {
+		return volumeInfo.DatastoreURL
+	}
+	queryResult, err := volumeManager.QueryVolume(ctx, cnstypes.CnsQueryFilter{
+		VolumeIds: []cnstypes.CnsVolumeId{volumeInfo.VolumeID},
+	})
+	if err != nil || len(queryResult.Volumes) == 0 {
+		log.Warnf("failed to query datastore of volume %q. Error: %+v", volumeInfo.VolumeID.Id, err)
+		return ""
+	}
+	return queryResult.Volumes[0].DatastoreUrl
+}
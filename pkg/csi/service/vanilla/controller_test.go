@@ -18,25 +18,38 @@ package vanilla
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v8/apis/volumesnapshot/v1"
 	"github.com/vmware/govmomi/cns"
 	cnstypes "github.com/vmware/govmomi/cns/types"
 	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/pbm"
 	"github.com/vmware/govmomi/pbm/types"
+	"github.com/vmware/govmomi/simulator"
 	"github.com/vmware/govmomi/vim25"
+	vimtypes "github.com/vmware/govmomi/vim25/types"
+	vslmtypes "github.com/vmware/govmomi/vslm/types"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	clientset "k8s.io/client-go/kubernetes"
 	testclient "k8s.io/client-go/kubernetes/fake"
 
@@ -46,10 +59,13 @@ import (
 	cnsvolume "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/volume"
 	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/vsphere"
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/config"
+	csifault "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/fault"
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/unittestcommon"
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common/commonco"
+	commoncotypes "sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common/commonco/types"
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/internalapis/cnsvolumeoperationrequest"
+	csinodetopologyv1alpha1 "sigs.k8s.io/vsphere-csi-driver/v3/pkg/internalapis/csinodetopology/v1alpha1"
 	k8s "sigs.k8s.io/vsphere-csi-driver/v3/pkg/kubernetes"
 )
 
@@ -697,6 +713,111 @@ func TestCreateVolumeWithNoSharedDatastores(t *testing.T) {
 	}
 }
 
+func TestCreateVolumeWithVolumeNamePrefix(t *testing.T) {
+	ct := getControllerTest(t)
+
+	params := map[string]string{
+		common.AttributeVolumeNamePrefix: "cluster1-",
+	}
+	capabilities := []*csi.VolumeCapability{
+		{
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			},
+		},
+	}
+	reqCreate := &csi.CreateVolumeRequest{
+		Name: testVolumeName + "-" + uuid.New().String(),
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: 1 * common.GbInBytes,
+		},
+		Parameters:         params,
+		VolumeCapabilities: capabilities,
+	}
+	respCreate, err := ct.controller.CreateVolume(ctx, reqCreate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volID := respCreate.Volume.VolumeId
+	defer func() {
+		if _, err := ct.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: volID}); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	queryResult, err := ct.vcenter.CnsClient.QueryVolume(ctx, cnstypes.CnsQueryFilter{
+		VolumeIds: []cnstypes.CnsVolumeId{{Id: volID}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queryResult.Volumes) != 1 {
+		t.Fatalf("failed to find the newly created volume with ID: %s", volID)
+	}
+	if expected := "cluster1-" + reqCreate.Name; queryResult.Volumes[0].Name != expected {
+		t.Fatalf("expected CNS volume name %q, got %q", expected, queryResult.Volumes[0].Name)
+	}
+
+	// Invalid prefixes are rejected.
+	reqCreate.Name = testVolumeName + "-" + uuid.New().String()
+	params[common.AttributeVolumeNamePrefix] = "cluster 1"
+	_, err = ct.controller.CreateVolume(ctx, reqCreate)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument error for invalid volume name prefix, got: %v", err)
+	}
+}
+
+func TestCreateVolumeDryRun(t *testing.T) {
+	ct := getControllerTest(t)
+
+	params := map[string]string{
+		common.AttributeDryRun: "true",
+	}
+	capabilities := []*csi.VolumeCapability{
+		{
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			},
+		},
+	}
+	reqCreate := &csi.CreateVolumeRequest{
+		Name: testVolumeName + "-" + uuid.New().String(),
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: 1 * common.GbInBytes,
+		},
+		Parameters:         params,
+		VolumeCapabilities: capabilities,
+	}
+	respCreate, err := ct.controller.CreateVolume(ctx, reqCreate)
+	if respCreate != nil {
+		t.Fatalf("expected no volume to be created by dry run, got: %+v", respCreate)
+	}
+	st, _ := status.FromError(err)
+	if st.Code() != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition error for dry run, got: %v", err)
+	}
+	var dryRunInfo *errdetails.ErrorInfo
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Reason == common.DryRunErrorReason {
+			dryRunInfo = info
+		}
+	}
+	if dryRunInfo == nil || dryRunInfo.Metadata[common.AttributeDryRunDatastoreURL] == "" {
+		t.Fatalf("expected datastore URL in the dry run error details, got: %+v", st.Details())
+	}
+	freeSpace, err := strconv.ParseInt(dryRunInfo.Metadata[common.AttributeDryRunFreeSpace], 10, 64)
+	if err != nil || freeSpace < 1*common.GbInBytes {
+		t.Fatalf("unexpected free space in the dry run error details: %+v", dryRunInfo.Metadata)
+	}
+
+	// Dry run for a volume larger than the free space of any datastore fails.
+	reqCreate.CapacityRange.RequiredBytes = 1024 * 1024 * common.GbInBytes
+	_, err = ct.controller.CreateVolume(ctx, reqCreate)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected ResourceExhausted error for dry run beyond datastore free space, got: %v", err)
+	}
+}
+
 func TestExtendVolume(t *testing.T) {
 	ct := getControllerTest(t)
 
@@ -839,6 +960,62 @@ func TestMigratedExtendVolume(t *testing.T) {
 	}
 }
 
+func TestExtendVolumePreflightChecks(t *testing.T) {
+	ct := getControllerTest(t)
+
+	params := make(map[string]string)
+	if v := os.Getenv("VSPHERE_DATASTORE_URL"); v != "" {
+		params[common.AttributeDatastoreURL] = v
+	}
+	capabilities := []*csi.VolumeCapability{
+		{
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			},
+		},
+	}
+	reqCreate := &csi.CreateVolumeRequest{
+		Name: testVolumeName + "-" + uuid.New().String(),
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: 1 * common.GbInBytes,
+		},
+		Parameters:         params,
+		VolumeCapabilities: capabilities,
+	}
+	respCreate, err := ct.controller.CreateVolume(ctx, reqCreate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volID := respCreate.Volume.VolumeId
+	defer func() {
+		if _, err := ct.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: volID}); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// Expansion is aborted while a snapshot operation is in progress.
+	reqExpand := &csi.ControllerExpandVolumeRequest{
+		VolumeId: volID,
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: 2 * common.GbInBytes,
+		},
+		VolumeCapability: capabilities[0],
+	}
+	snapshotOperations.start(volID)
+	_, err = ct.controller.ControllerExpandVolume(ctx, reqExpand)
+	snapshotOperations.done(volID)
+	if status.Code(err) != codes.Aborted {
+		t.Fatalf("expected Aborted error with snapshot operation in progress, got: %v", err)
+	}
+
+	// Expansion beyond the free space of the datastore is rejected.
+	reqExpand.CapacityRange.RequiredBytes = 1024 * 1024 * common.GbInBytes
+	_, err = ct.controller.ControllerExpandVolume(ctx, reqExpand)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected ResourceExhausted error for expansion beyond datastore free space, got: %v", err)
+	}
+}
+
 func TestCompleteControllerFlow(t *testing.T) {
 	ct := getControllerTest(t)
 
@@ -963,6 +1140,230 @@ func TestCompleteControllerFlow(t *testing.T) {
 	}
 }
 
+func TestControllerPublishVolumeReadOnlyClone(t *testing.T) {
+	ct := getControllerTest(t)
+	if os.Getenv("VSPHERE_K8S_NODE") != "" {
+		t.Skip("requires the VMs of the simulator")
+	}
+	capability := &csi.VolumeCapability{
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		},
+	}
+	respCreate, err := ct.controller.CreateVolume(ctx, &csi.CreateVolumeRequest{
+		Name: testVolumeName + "-" + uuid.New().String(),
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: 1 * common.GbInBytes,
+		},
+		VolumeCapabilities: []*csi.VolumeCapability{capability},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	volID := respCreate.Volume.VolumeId
+	defer func() {
+		if _, err := ct.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: volID}); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	vms, err := find.NewFinder(ct.vcenter.Client.Client).VirtualMachineList(ctx, "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeID := vms[0].UUID(ctx)
+	volumeContext := map[string]string{common.AttributeReadOnlyClone: "true"}
+
+	_, err = ct.controller.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{
+		VolumeId: volID,
+		NodeId:   nodeID,
+		VolumeCapability: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+			},
+		},
+		VolumeContext: volumeContext,
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected multi-writer publish of a read-only clone to fail with %v, got: %v",
+			codes.InvalidArgument, err)
+	}
+
+	respPublish, err := ct.controller.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{
+		VolumeId:         volID,
+		NodeId:           nodeID,
+		VolumeCapability: capability,
+		VolumeContext:    volumeContext,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !common.IsReadOnlyCloneVolume(nil, respPublish.PublishContext) {
+		t.Errorf("expected the publish context %v to mark the volume as a read-only clone",
+			respPublish.PublishContext)
+	}
+	_, err = ct.controller.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{
+		VolumeId: volID,
+		NodeId:   nodeID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Volumes which are not read-only clones are published read-write.
+	respPublish, err = ct.controller.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{
+		VolumeId:         volID,
+		NodeId:           nodeID,
+		VolumeCapability: capability,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if common.IsReadOnlyCloneVolume(nil, respPublish.PublishContext) {
+		t.Errorf("expected the publish context %v not to mark the volume as a read-only clone",
+			respPublish.PublishContext)
+	}
+	_, err = ct.controller.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{
+		VolumeId: volID,
+		NodeId:   nodeID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestControllerPublishVolumeWithSCSISlotHint(t *testing.T) {
+	ct := getControllerTest(t)
+	if os.Getenv("VSPHERE_K8S_NODE") != "" {
+		t.Skip("requires the VMs of the simulator")
+	}
+	capability := &csi.VolumeCapability{
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		},
+	}
+	respCreate, err := ct.controller.CreateVolume(ctx, &csi.CreateVolumeRequest{
+		Name: testVolumeName + "-" + uuid.New().String(),
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: 1 * common.GbInBytes,
+		},
+		VolumeCapabilities: []*csi.VolumeCapability{capability},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	volID := respCreate.Volume.VolumeId
+	defer func() {
+		if _, err := ct.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: volID}); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	vms, err := find.NewFinder(ct.vcenter.Client.Client).VirtualMachineList(ctx, "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeID := vms[0].UUID(ctx)
+
+	_, err = ct.controller.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{
+		VolumeId:         volID,
+		NodeId:           nodeID,
+		VolumeCapability: capability,
+		VolumeContext:    map[string]string{common.AttributeSCSISlotHint: "0:64"},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected publish with an invalid SCSI slot hint to fail with %v, got: %v",
+			codes.InvalidArgument, err)
+	}
+
+	respPublish, err := ct.controller.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{
+		VolumeId:         volID,
+		NodeId:           nodeID,
+		VolumeCapability: capability,
+		VolumeContext:    map[string]string{common.AttributeSCSISlotHint: "0:15"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The disks attached by the CNS simulator are not added to the devices of
+	// the VM, in which case no slot is recorded.
+	if slot, ok := respPublish.PublishContext[common.AttributeSCSISlot]; ok {
+		if _, _, err := common.ParseSCSISlot(slot); err != nil {
+			t.Errorf("expected the publish context %v to record the SCSI slot of the volume. Error: %v",
+				respPublish.PublishContext, err)
+		}
+	}
+	_, err = ct.controller.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{
+		VolumeId: volID,
+		NodeId:   nodeID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestControllerUnpublishVolumeFromRemovedNode(t *testing.T) {
+	ct := getControllerTest(t)
+	if os.Getenv("VSPHERE_K8S_NODE") != "" {
+		t.Skip("requires the VMs of the simulator")
+	}
+	params := make(map[string]string)
+	if v := os.Getenv("VSPHERE_DATASTORE_URL"); v != "" {
+		params[common.AttributeDatastoreURL] = v
+	}
+	capability := &csi.VolumeCapability{
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		},
+	}
+	respCreate, err := ct.controller.CreateVolume(ctx, &csi.CreateVolumeRequest{
+		Name: testVolumeName + "-" + uuid.New().String(),
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: 1 * common.GbInBytes,
+		},
+		Parameters:         params,
+		VolumeCapabilities: []*csi.VolumeCapability{capability},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	volID := respCreate.Volume.VolumeId
+	defer func() {
+		if _, err := ct.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: volID}); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	vms, err := find.NewFinder(ct.vcenter.Client.Client).VirtualMachineList(ctx, "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeID := vms[0].UUID(ctx)
+	_, err = ct.controller.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{
+		VolumeId:         volID,
+		NodeId:           nodeID,
+		VolumeCapability: capability,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The VM of the removed node is not in the inventory anymore.
+	_, err = ct.controller.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{
+		VolumeId: volID,
+		NodeId:   uuid.New().String(),
+	})
+	if err != nil {
+		t.Fatalf("expected detach from removed node to succeed, got: %v", err)
+	}
+
+	_, err = ct.controller.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{
+		VolumeId: volID,
+		NodeId:   nodeID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestDeleteVolumeWithSnapshots(t *testing.T) {
 	ct := getControllerTest(t)
 
@@ -1227,20 +1628,106 @@ func TestCreateBlockVolumeSnapshotWithIdempotency(t *testing.T) {
 	}
 }
 
-func TestCreateBlockVolumeSnapshot(t *testing.T) {
+func TestCreateBlockVolumeSnapshotRetryAfterUnacknowledgedCreate(t *testing.T) {
 	ct := getControllerTest(t)
 
-	// Create.
 	params := make(map[string]string)
 	if v := os.Getenv("VSPHERE_DATASTORE_URL"); v != "" {
 		params[common.AttributeDatastoreURL] = v
 	}
-	capabilities := []*csi.VolumeCapability{
-		{
-			AccessMode: &csi.VolumeCapability_AccessMode{
-				Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
-			},
-		},
+	reqCreate := &csi.CreateVolumeRequest{
+		Name: testVolumeName + "-" + uuid.New().String(),
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: 1 * common.GbInBytes,
+		},
+		Parameters: params,
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+	}
+	respCreate, err := ct.controller.CreateVolume(ctx, reqCreate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volID := respCreate.Volume.VolumeId
+	defer func() {
+		_, err = ct.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: volID})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// Simulate a CreateSnapshot call which created the snapshot on CNS, but
+	// whose response never reached the sidecar and whose operation request
+	// was lost, by creating the snapshot through the volume manager and
+	// deleting its operation request.
+	snapshotName := "snapshot-" + uuid.New().String()
+	cnsSnapshotInfo, err := ct.controller.manager.VolumeManager.CreateSnapshot(ctx, volID, snapshotName, nil)
+	if err != nil {
+		t.Fatalf("failed to create snapshot for volume %s: %v", volID, err)
+	}
+	err = ct.operationStore.DeleteRequestDetails(ctx, cnsvolume.GetCnsSnapshotDescription(snapshotName, volID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedSnapID := volID + common.VSphereCSISnapshotIdDelimiter + cnsSnapshotInfo.SnapshotID
+
+	existingSnapshot, err := common.QueryVolumeSnapshotByName(ctx, ct.controller.manager.VolumeManager, volID,
+		snapshotName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if existingSnapshot == nil || existingSnapshot.SnapshotId.Id != cnsSnapshotInfo.SnapshotID {
+		t.Fatalf("expected snapshot %q to be found by name %q, got %v", cnsSnapshotInfo.SnapshotID,
+			snapshotName, existingSnapshot)
+	}
+
+	// The retry of the sidecar is expected to return the existing snapshot.
+	respCreateSnapshot, err := ct.controller.CreateSnapshot(ctx, &csi.CreateSnapshotRequest{
+		SourceVolumeId: volID,
+		Name:           snapshotName,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapID := respCreateSnapshot.Snapshot.SnapshotId
+	defer func() {
+		_, err = ct.controller.DeleteSnapshot(ctx, &csi.DeleteSnapshotRequest{SnapshotId: snapID})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	if snapID != expectedSnapID {
+		t.Fatalf("expected the existing snapshot %q to be returned, got %q", expectedSnapID, snapID)
+	}
+
+	respListSnapshots, err := ct.controller.ListSnapshots(ctx, &csi.ListSnapshotsRequest{SourceVolumeId: volID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(respListSnapshots.Entries) != 1 {
+		t.Fatalf("expected a single snapshot on volume %q, found %d", volID, len(respListSnapshots.Entries))
+	}
+}
+
+func TestCreateBlockVolumeSnapshot(t *testing.T) {
+	ct := getControllerTest(t)
+
+	// Create.
+	params := make(map[string]string)
+	if v := os.Getenv("VSPHERE_DATASTORE_URL"); v != "" {
+		params[common.AttributeDatastoreURL] = v
+	}
+	capabilities := []*csi.VolumeCapability{
+		{
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			},
+		},
 	}
 
 	reqCreate := &csi.CreateVolumeRequest{
@@ -1347,7 +1834,9 @@ func TestCreateBlockVolumeSnapshot(t *testing.T) {
 		Name:           "snapshot-" + uuid.New().String(),
 	}
 	expectedErr := fmt.Errorf("the number of snapshots on the source volume %s reaches "+
-		"the configured maximum (%v)", volID, configured_max_snapshot_num)
+		"the configured maximum (%d of %d). Delete existing snapshots of the volume, or raise the maximum in "+
+		"the [Snapshot] section of the vSphere config secret up to the limit of the vSphere version in use",
+		volID, configured_max_snapshot_num, configured_max_snapshot_num)
 
 	_, err = ct.controller.CreateSnapshot(ctx, reqCreateSnapshot)
 	if err != nil {
@@ -1355,7 +1844,7 @@ func TestCreateBlockVolumeSnapshot(t *testing.T) {
 		if !ok {
 			t.Fatalf("unable to convert the error: %+v into a grpc status error type.", err)
 		}
-		if delErr.Code() == codes.FailedPrecondition && delErr.Message() == expectedErr.Error() {
+		if delErr.Code() == codes.ResourceExhausted && delErr.Message() == expectedErr.Error() {
 			t.Logf("received error as expected when attempting to create snapshot on volume "+
 				"when existing number of snapshots reaches the configured maximum, error: %+v.", err)
 		} else {
@@ -2294,6 +2783,93 @@ func TestDeleteBlockVolumeSnapshotWithManagedObjectNotFound(t *testing.T) {
 	}
 }
 
+func TestDeleteSnapshotIsIdempotent(t *testing.T) {
+	ct := getControllerTest(t)
+
+	params := make(map[string]string)
+	if v := os.Getenv("VSPHERE_DATASTORE_URL"); v != "" {
+		params[common.AttributeDatastoreURL] = v
+	}
+	reqCreate := &csi.CreateVolumeRequest{
+		Name: testVolumeName + "-" + uuid.New().String(),
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: 1 * common.GbInBytes,
+		},
+		Parameters: params,
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+	}
+	respCreate, err := ct.controller.CreateVolume(ctx, reqCreate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volID := respCreate.Volume.VolumeId
+	defer func() {
+		_, err = ct.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: volID})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	respCreateSnapshot, err := ct.controller.CreateSnapshot(ctx, &csi.CreateSnapshotRequest{
+		SourceVolumeId: volID,
+		Name:           "snapshot-" + uuid.New().String(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapID := respCreateSnapshot.Snapshot.SnapshotId
+	_, cnsSnapshotID, err := common.ParseCSISnapshotID(snapID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reqDeleteSnapshot := &csi.DeleteSnapshotRequest{SnapshotId: snapID}
+	if _, err = ct.controller.DeleteSnapshot(ctx, reqDeleteSnapshot); err != nil {
+		t.Fatalf("failed to delete snapshot %q: %v", snapID, err)
+	}
+	// Drop the persisted result of the first deletion so that the second
+	// deletion goes to CNS, which no longer has the snapshot.
+	err = ct.operationStore.DeleteRequestDetails(ctx, "deletesnapshot-"+volID+"-"+cnsSnapshotID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ct.controller.DeleteSnapshot(ctx, reqDeleteSnapshot); err != nil {
+		t.Fatalf("expected deleting already deleted snapshot %q to succeed, got: %v", snapID, err)
+	}
+
+	// Deleting a snapshot of a volume which does not exist succeeds, as the
+	// snapshot is gone along with its volume.
+	reqDeleteSnapshot = &csi.DeleteSnapshotRequest{
+		SnapshotId: uuid.New().String() + common.VSphereCSISnapshotIdDelimiter + uuid.New().String(),
+	}
+	if _, err = ct.controller.DeleteSnapshot(ctx, reqDeleteSnapshot); err != nil {
+		t.Fatalf("expected deleting snapshot of non-existent volume to succeed, got: %v", err)
+	}
+
+	// The snapshot is only assumed deleted along with its volume once CNS
+	// confirms the volume is deleted.
+	deleted, err := isVolumeDeleted(ctx, volID, ct.controller.manager.VolumeManager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted {
+		t.Errorf("expected volume %q not to be reported deleted", volID)
+	}
+	deleted, err = isVolumeDeleted(ctx, uuid.New().String(), ct.controller.manager.VolumeManager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !deleted {
+		t.Errorf("expected non-existent volume to be reported deleted")
+	}
+}
+
 func TestCreateSnapshotWithManagedObjectNotFound(t *testing.T) {
 	ct := getControllerTest(t)
 
@@ -2563,3 +3139,1701 @@ func TestCreateSnapshotWithCnsSnapshotCreatedFault(t *testing.T) {
 		t.Fatal("expected error was not received for create snapshot operation.")
 	}
 }
+
+func TestListSnapshotsWithInvalidToken(t *testing.T) {
+	ctx := context.Background()
+	for _, token := range []string{"abc", "-1"} {
+		err := validateVanillaListSnapshotRequest(ctx, &csi.ListSnapshotsRequest{StartingToken: token})
+		if status.Code(err) != codes.Aborted {
+			t.Fatalf("expected codes.Aborted for starting token %q, got: %v", token, err)
+		}
+	}
+	entries := make([]cnstypes.CnsSnapshotQueryResultEntry, 3)
+	_, _, err := processQueryResultsListSnapshots(ctx, 5, 2, entries)
+	if status.Code(err) != codes.Aborted {
+		t.Fatalf("expected codes.Aborted for out of range starting token, got: %v", err)
+	}
+	snapEntries, nextToken, err := processQueryResultsListSnapshots(ctx, 0, 2, entries)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(snapEntries) != 2 || nextToken != "2" {
+		t.Fatalf("expected 2 entries with next token \"2\", got %d entries with next token %q",
+			len(snapEntries), nextToken)
+	}
+}
+
+func TestCreateVolumeFromInvalidVolumeSource(t *testing.T) {
+	ct := getControllerTest(t)
+
+	params := make(map[string]string)
+	if v := os.Getenv("VSPHERE_DATASTORE_URL"); v != "" {
+		params[common.AttributeDatastoreURL] = v
+	}
+	capabilities := []*csi.VolumeCapability{
+		{
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			},
+		},
+	}
+	reqCreate := &csi.CreateVolumeRequest{
+		Name: testVolumeName + "-" + uuid.New().String(),
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: 1 * common.GbInBytes,
+		},
+		Parameters:         params,
+		VolumeCapabilities: capabilities,
+	}
+	respCreate, err := ct.controller.CreateVolume(ctx, reqCreate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volID := respCreate.Volume.VolumeId
+	defer func() {
+		_, err := ct.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: volID})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	tests := []struct {
+		name           string
+		sourceVolumeID string
+		requiredBytes  int64
+		expectedCode   codes.Code
+	}{
+		{"unknown source volume", uuid.New().String(), 1 * common.GbInBytes, codes.NotFound},
+		{"smaller than source volume", volID, 512 * common.MbInBytes, codes.InvalidArgument},
+	}
+	for _, test := range tests {
+		reqClone := &csi.CreateVolumeRequest{
+			Name: testVolumeName + "-" + uuid.New().String(),
+			CapacityRange: &csi.CapacityRange{
+				RequiredBytes: test.requiredBytes,
+			},
+			Parameters:         params,
+			VolumeCapabilities: capabilities,
+			VolumeContentSource: &csi.VolumeContentSource{
+				Type: &csi.VolumeContentSource_Volume{
+					Volume: &csi.VolumeContentSource_VolumeSource{
+						VolumeId: test.sourceVolumeID,
+					},
+				},
+			},
+		}
+		_, err := ct.controller.CreateVolume(ctx, reqClone)
+		if status.Code(err) != test.expectedCode {
+			t.Fatalf("%s: expected %v, got: %v", test.name, test.expectedCode, err)
+		}
+	}
+}
+
+func TestValidateClonedVolume(t *testing.T) {
+	ct := getControllerTest(t)
+
+	params := make(map[string]string)
+	if v := os.Getenv("VSPHERE_DATASTORE_URL"); v != "" {
+		params[common.AttributeDatastoreURL] = v
+	}
+	respCreate, err := ct.controller.CreateVolume(ctx, &csi.CreateVolumeRequest{
+		Name: testVolumeName + "-" + uuid.New().String(),
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: 1 * common.GbInBytes,
+		},
+		Parameters: params,
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	volID := respCreate.Volume.VolumeId
+	defer func() {
+		_, err := ct.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: volID})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	volume, err := common.QueryVolumeByID(ctx, ct.controller.manager.VolumeManager, volID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		datastoreURL    string
+		storagePolicyID string
+		volSizeMB       int64
+		expectedCode    codes.Code
+	}{
+		{"compatible", volume.DatastoreUrl, volume.StoragePolicyId, 1024, codes.OK},
+		{"to be expanded", volume.DatastoreUrl, "", 2048, codes.OK},
+		{"other datastore", "ds:///vmfs/volumes/other/", "", 1024, codes.AlreadyExists},
+		{"other storage policy", volume.DatastoreUrl, "policy-" + uuid.New().String(), 1024, codes.AlreadyExists},
+		{"larger than requested", volume.DatastoreUrl, "", 512, codes.AlreadyExists},
+	}
+	for _, test := range tests {
+		cloneSizeMB, _, err := validateClonedVolume(ctx, ct.controller.manager.VolumeManager, volID,
+			test.datastoreURL, test.storagePolicyID, test.volSizeMB)
+		if status.Code(err) != test.expectedCode {
+			t.Errorf("%s: expected %v, got: %v", test.name, test.expectedCode, err)
+		}
+		if err == nil && cloneSizeMB != 1024 {
+			t.Errorf("%s: expected the size of the cloned volume to be 1024 MB, got %d MB", test.name, cloneSizeMB)
+		}
+	}
+}
+
+func TestControllerGetCapabilitiesCloneVolume(t *testing.T) {
+	ct := getControllerTest(t)
+	hasCloneVolume := func() bool {
+		resp, err := ct.controller.ControllerGetCapabilities(ctx, &csi.ControllerGetCapabilitiesRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, capability := range resp.Capabilities {
+			if capability.GetRpc().GetType() == csi.ControllerServiceCapability_RPC_CLONE_VOLUME {
+				return true
+			}
+		}
+		return false
+	}
+	if !hasCloneVolume() {
+		t.Errorf("expected CLONE_VOLUME to be advertised")
+	}
+	// Cloning from a volume is rejected in multi vCenter deployments.
+	multivCenterCSITopologyEnabled = true
+	defer func() { multivCenterCSITopologyEnabled = false }()
+	if hasCloneVolume() {
+		t.Errorf("expected CLONE_VOLUME not to be advertised in multi vCenter deployments")
+	}
+}
+
+func TestVolumeGroupSnapshot(t *testing.T) {
+	ct := getControllerTest(t)
+
+	// The group snapshot capability is not advertised unless it is enabled.
+	respCaps, err := ct.controller.GroupControllerGetCapabilities(ctx, &csi.GroupControllerGetCapabilitiesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(respCaps.Capabilities) != 0 {
+		t.Errorf("expected no group controller capability, got: %+v", respCaps.Capabilities)
+	}
+	_, err = ct.controller.CreateVolumeGroupSnapshot(ctx, &csi.CreateVolumeGroupSnapshotRequest{
+		Name:            "groupsnapshot-" + uuid.New().String(),
+		SourceVolumeIds: []string{uuid.New().String()},
+	})
+	if status.Code(err) != codes.Unimplemented {
+		t.Fatalf("expected codes.Unimplemented with group snapshots disabled, got: %v", err)
+	}
+	groupSnapshotEnabled = true
+	defer func() { groupSnapshotEnabled = false }()
+	respCaps, err = ct.controller.GroupControllerGetCapabilities(ctx, &csi.GroupControllerGetCapabilitiesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(respCaps.Capabilities) != 1 {
+		t.Errorf("expected the group snapshot capability, got: %+v", respCaps.Capabilities)
+	}
+
+	params := make(map[string]string)
+	if v := os.Getenv("VSPHERE_DATASTORE_URL"); v != "" {
+		params[common.AttributeDatastoreURL] = v
+	}
+	capabilities := []*csi.VolumeCapability{
+		{
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			},
+		},
+	}
+	var volIDs []string
+	for i := 0; i < 2; i++ {
+		reqCreate := &csi.CreateVolumeRequest{
+			Name: testVolumeName + "-" + uuid.New().String(),
+			CapacityRange: &csi.CapacityRange{
+				RequiredBytes: 1 * common.GbInBytes,
+			},
+			Parameters:         params,
+			VolumeCapabilities: capabilities,
+		}
+		respCreate, err := ct.controller.CreateVolume(ctx, reqCreate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		volIDs = append(volIDs, respCreate.Volume.VolumeId)
+	}
+	defer func() {
+		for _, volID := range volIDs {
+			_, err := ct.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: volID})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+
+	// A group snapshot with an unknown member must fail without leaving any member snapshot behind.
+	groupName := "groupsnapshot-" + uuid.New().String()
+	_, err = ct.controller.CreateVolumeGroupSnapshot(ctx, &csi.CreateVolumeGroupSnapshotRequest{
+		Name:            groupName,
+		SourceVolumeIds: []string{volIDs[0], uuid.New().String()},
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected codes.NotFound for unknown source volume, got: %v", err)
+	}
+
+	respCreate, err := ct.controller.CreateVolumeGroupSnapshot(ctx, &csi.CreateVolumeGroupSnapshotRequest{
+		Name:            groupName,
+		SourceVolumeIds: volIDs,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groupSnapshot := respCreate.GroupSnapshot
+	if groupSnapshot.GroupSnapshotId != groupName || len(groupSnapshot.Snapshots) != len(volIDs) {
+		t.Fatalf("unexpected group snapshot: %+v", groupSnapshot)
+	}
+	var snapshotIDs []string
+	for _, snapshot := range groupSnapshot.Snapshots {
+		snapshotIDs = append(snapshotIDs, snapshot.SnapshotId)
+	}
+
+	respGet, err := ct.controller.GetVolumeGroupSnapshot(ctx, &csi.GetVolumeGroupSnapshotRequest{
+		GroupSnapshotId: groupName,
+		SnapshotIds:     snapshotIDs,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(respGet.GroupSnapshot.Snapshots) != len(snapshotIDs) {
+		t.Fatalf("unexpected group snapshot: %+v", respGet.GroupSnapshot)
+	}
+	_, err = ct.controller.GetVolumeGroupSnapshot(ctx, &csi.GetVolumeGroupSnapshotRequest{
+		GroupSnapshotId: "groupsnapshot-" + uuid.New().String(),
+		SnapshotIds:     snapshotIDs,
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected codes.NotFound for snapshots of another group, got: %v", err)
+	}
+
+	deleteReq := &csi.DeleteVolumeGroupSnapshotRequest{
+		GroupSnapshotId: groupName,
+		SnapshotIds:     snapshotIDs,
+	}
+	if _, err = ct.controller.DeleteVolumeGroupSnapshot(ctx, deleteReq); err != nil {
+		t.Fatal(err)
+	}
+	// Deleting again must succeed as the member snapshots are already gone.
+	if _, err = ct.controller.DeleteVolumeGroupSnapshot(ctx, deleteReq); err != nil {
+		t.Fatal(err)
+	}
+
+	// A member snapshot left behind by a previous attempt, e.g. completing after
+	// its rollback, is reused when the creation is retried.
+	groupName = "groupsnapshot-" + uuid.New().String()
+	volumeManager, err := ct.controller.getVolumeManagerForGroupSnapshot(ctx, volIDs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lateSnapshotID, _, err := common.CreateSnapshotUtil(ctx, volumeManager, volIDs[0], groupName, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	respCreate, err = ct.controller.CreateVolumeGroupSnapshot(ctx, &csi.CreateVolumeGroupSnapshotRequest{
+		Name:            groupName,
+		SourceVolumeIds: volIDs,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if respCreate.GroupSnapshot.Snapshots[0].SnapshotId != lateSnapshotID {
+		t.Errorf("expected snapshot %q to be reused, got: %q", lateSnapshotID,
+			respCreate.GroupSnapshot.Snapshots[0].SnapshotId)
+	}
+
+	// The rollback must delete the member snapshots found in CNS even once the request context has expired.
+	expiredCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	ct.controller.rollbackGroupSnapshot(expiredCtx, volumeManager, groupName, volIDs)
+	for _, snapshot := range respCreate.GroupSnapshot.Snapshots {
+		_, member, err := ct.controller.queryGroupSnapshotMember(ctx, snapshot.SnapshotId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if member != nil {
+			t.Errorf("expected snapshot %q to be rolled back", snapshot.SnapshotId)
+		}
+	}
+}
+
+func TestGetModifyVolumeStoragePolicy(t *testing.T) {
+	ctx := context.Background()
+	for _, params := range []map[string]string{
+		{},
+		{common.AttributeStoragePolicyID: "policy-id", common.AttributeStoragePolicyName: "policy"},
+		{common.AttributeStoragePolicyID: "policy-id", common.AttributeDiskFormat: "thin"},
+	} {
+		if _, _, err := getModifyVolumeStoragePolicy(ctx, nil, params); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("expected codes.InvalidArgument for params %v, got: %v", params, err)
+		}
+	}
+}
+
+func TestGetModifyVolumeStoragePolicyByName(t *testing.T) {
+	ct := getControllerTest(t)
+	storagePolicyID, _, err := getModifyVolumeStoragePolicy(ctx, ct.vcenter,
+		map[string]string{common.AttributeStoragePolicyName: "vSAN Default Storage Policy"})
+	if err != nil || storagePolicyID == "" {
+		t.Fatalf("unexpected storage policy ID %q, err: %v", storagePolicyID, err)
+	}
+	_, _, err = getModifyVolumeStoragePolicy(ctx, ct.vcenter,
+		map[string]string{common.AttributeStoragePolicyName: "no-such-policy"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected codes.InvalidArgument for a missing storage policy, got: %v", err)
+	}
+
+	// The storage policy ID is validated upfront.
+	id, _, err := getModifyVolumeStoragePolicy(ctx, ct.vcenter,
+		map[string]string{common.AttributeStoragePolicyID: storagePolicyID})
+	if err != nil || id != storagePolicyID {
+		t.Errorf("expected storage policy ID %q, got %q, err: %v", storagePolicyID, id, err)
+	}
+	_, _, err = getModifyVolumeStoragePolicy(ctx, ct.vcenter,
+		map[string]string{common.AttributeStoragePolicyID: "no-such-policy-id"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected codes.InvalidArgument for a missing storage policy ID, got: %v", err)
+	}
+}
+
+func TestModifyVolumeStoragePolicyWithRelocationInProgress(t *testing.T) {
+	ctx := context.Background()
+	modifyVolumeRelocations.add("vol-1", "policy-a", nil)
+	defer modifyVolumeRelocations.remove("vol-1")
+	// A request for another storage policy is rejected until the relocation
+	// in progress completes.
+	c := &controller{}
+	if _, err := c.modifyVolumeStoragePolicy(ctx, nil, nil, "vol-1", "policy-b"); status.Code(err) != codes.Aborted {
+		t.Errorf("expected codes.Aborted while the volume is relocated to another policy, got: %v", err)
+	}
+}
+
+func TestGetModifyVolumeIopsLimit(t *testing.T) {
+	ctx := context.Background()
+	iopsLimit, ok, otherParams, _, err := getModifyVolumeIopsLimit(ctx, map[string]string{
+		common.AttributeIopsLimit:       "1000",
+		common.AttributeStoragePolicyID: "policy-id",
+	})
+	if err != nil || !ok || iopsLimit != 1000 {
+		t.Fatalf("unexpected IOPS limit %d, ok: %v, err: %v", iopsLimit, ok, err)
+	}
+	if len(otherParams) != 1 || otherParams[common.AttributeStoragePolicyID] != "policy-id" {
+		t.Errorf("unexpected remaining params %v", otherParams)
+	}
+	if _, ok, _, _, err = getModifyVolumeIopsLimit(ctx, map[string]string{
+		common.AttributeStoragePolicyID: "policy-id",
+	}); err != nil || ok {
+		t.Errorf("no IOPS limit expected without the IOPS params, ok: %v, err: %v", ok, err)
+	}
+	if _, _, _, _, err = getModifyVolumeIopsLimit(ctx, map[string]string{
+		common.AttributeThroughputLimit: "-1",
+	}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected codes.InvalidArgument for an invalid throughput limit, got: %v", err)
+	}
+}
+
+func TestOperationLimiter(t *testing.T) {
+	limiter := &operationLimiter{slots: make(map[string]chan struct{})}
+	limiter.setLimit(2)
+
+	release1, err := limiter.acquire(ctx, "host-1")
+	if err != nil {
+		t.Fatalf("failed to acquire first slot: %v", err)
+	}
+	release2, err := limiter.acquire(ctx, "host-1")
+	if err != nil {
+		t.Fatalf("failed to acquire second slot: %v", err)
+	}
+	// Slots of other hosts are independent.
+	release3, err := limiter.acquire(ctx, "host-2")
+	if err != nil {
+		t.Fatalf("failed to acquire slot on another host: %v", err)
+	}
+	release3()
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.acquire(timeoutCtx, "host-1"); err == nil {
+		t.Fatal("expected acquiring a slot over the limit to time out")
+	}
+
+	release1()
+	release4, err := limiter.acquire(ctx, "host-1")
+	if err != nil {
+		t.Fatalf("failed to acquire released slot: %v", err)
+	}
+	release2()
+	release4()
+
+	limiter.setLimit(0)
+	for i := 0; i < 5; i++ {
+		if _, err := limiter.acquire(ctx, "host-1"); err != nil {
+			t.Fatalf("expected disabled limiter not to block: %v", err)
+		}
+	}
+}
+
+func TestOperationLimiterClassLimits(t *testing.T) {
+	limiter := &operationLimiter{slots: make(map[string]chan struct{})}
+	limiter.setLimit(2)
+	limiter.setClassLimits(getHostAttachLimits(map[string]*config.HostAttachLimitConfig{
+		"strict-model":    {MaxConcurrentAttaches: 1},
+		"unlimited-model": {MaxConcurrentAttaches: -1},
+		"default-model":   {},
+	}))
+	if !limiter.hasClassLimits() {
+		t.Fatal("expected limiter to have class limits")
+	}
+
+	release, err := limiter.acquireForClass(context.Background(), "host-1", "strict-model")
+	if err != nil {
+		t.Fatalf("failed to acquire slot: %v", err)
+	}
+	timeoutCtx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.acquireForClass(timeoutCtx, "host-1", "strict-model"); err == nil {
+		t.Fatal("expected acquiring a slot over the class limit to time out")
+	}
+	release()
+
+	for i := 0; i < 5; i++ {
+		if _, err := limiter.acquireForClass(context.Background(), "host-2", "unlimited-model"); err != nil {
+			t.Fatalf("expected class with disabled limit not to block: %v", err)
+		}
+	}
+	// Unlisted models, and models with no limit, use the global limit.
+	for _, model := range []string{"default-model", "other-model", ""} {
+		host := "host-" + model
+		for i := 0; i < 2; i++ {
+			if _, err := limiter.acquireForClass(context.Background(), host, model); err != nil {
+				t.Fatalf("failed to acquire slot %d of model %q: %v", i, model, err)
+			}
+		}
+		timeoutCtx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		if _, err := limiter.acquireForClass(timeoutCtx, host, model); err == nil {
+			t.Fatalf("expected acquiring a slot of model %q over the global limit to time out", model)
+		}
+		cancel()
+	}
+}
+
+func TestNodeDetachTracker(t *testing.T) {
+	tracker := &nodeDetachTracker{batches: make(map[string]*nodeDetachBatch)}
+	tracker.begin("node-1")
+	tracker.begin("node-1")
+	tracker.end(ctx, "node-1", nil)
+	batch, ok := tracker.batches["node-1"]
+	if !ok || batch.inFlight != 1 || batch.detached != 1 {
+		t.Fatalf("expected batch with one detach in flight and one done, got %+v", batch)
+	}
+	// A failed detach does not abort the batch.
+	tracker.end(ctx, "node-1", errors.New("detach failed"))
+	if _, ok := tracker.batches["node-1"]; ok {
+		t.Fatal("expected batch to be done once no detach is in flight")
+	}
+	// Unknown nodes are ignored.
+	tracker.end(ctx, "node-2", nil)
+}
+
+func TestGetDatastoreOvercommitRatio(t *testing.T) {
+	gb := int64(1024 * 1024 * 1024)
+	summary := vimtypes.DatastoreSummary{
+		Capacity:    100 * gb,
+		FreeSpace:   40 * gb,
+		Uncommitted: 50 * gb,
+	}
+	if ratio := getDatastoreOvercommitRatio(summary, 0); ratio != 1.1 {
+		t.Errorf("expected overcommit ratio 1.1, got %v", ratio)
+	}
+	if ratio := getDatastoreOvercommitRatio(summary, 40*gb); ratio != 1.5 {
+		t.Errorf("expected overcommit ratio 1.5 with the new volume, got %v", ratio)
+	}
+	if ratio := getDatastoreOvercommitRatio(vimtypes.DatastoreSummary{}, gb); ratio != 0 {
+		t.Errorf("expected overcommit ratio 0 for a datastore without capacity, got %v", ratio)
+	}
+}
+
+func TestFilterDatastoresByQualifiedName(t *testing.T) {
+	ct := getControllerTest(t)
+	sharedDatastores, err := ct.controller.nodeMgr.GetSharedDatastoresInK8SCluster(ctx)
+	if err != nil || len(sharedDatastores) == 0 {
+		t.Fatalf("failed to get shared datastores. Error: %v", err)
+	}
+	datacenters, err := ct.vcenter.GetDatacenters(ctx)
+	if err != nil || len(datacenters) == 0 {
+		t.Fatalf("failed to get datacenters. Error: %v", err)
+	}
+	dcName := strings.Trim(datacenters[0].InventoryPath, "/")
+	expected := sharedDatastores[0]
+	qualifiedName := dcName + "/" + expected.Info.Name
+	filtered, _, err := filterDatastoresByQualifiedName(ctx, ct.vcenter, sharedDatastores, qualifiedName)
+	if err != nil {
+		t.Fatalf("failed to filter datastores by %q. Error: %v", qualifiedName, err)
+	}
+	if len(filtered) != 1 || filtered[0].Info.Url != expected.Info.Url {
+		t.Errorf("expected datastore %q for %q, got %v", expected.Info.Url, qualifiedName, filtered)
+	}
+	for _, invalidName := range []string{dcName + "/unknown-datastore", "unknown-datacenter/" + expected.Info.Name} {
+		_, _, err = filterDatastoresByQualifiedName(ctx, ct.vcenter, sharedDatastores, invalidName)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("expected InvalidArgument error for %q, got %v", invalidName, err)
+		}
+	}
+}
+
+func TestGetAttachmentDrift(t *testing.T) {
+	attached := volumeAttachmentKey{volumeID: "vol-1", nodeVMUUID: "vm-1"}
+	missing := volumeAttachmentKey{volumeID: "vol-2", nodeVMUUID: "vm-1"}
+	attaching := volumeAttachmentKey{volumeID: "vol-3", nodeVMUUID: "vm-2"}
+	orphaned := volumeAttachmentKey{volumeID: "vol-1", nodeVMUUID: "vm-2"}
+	unresolved := volumeAttachmentKey{volumeID: "vol-4", nodeVMUUID: "vm-2"}
+	foreign := volumeAttachmentKey{volumeID: "disk-1", nodeVMUUID: "vm-1"}
+	ephemeral := volumeAttachmentKey{volumeID: "vol-5", nodeVMUUID: "vm-1"}
+	vaAttachments := map[volumeAttachmentKey]bool{attached: true, missing: true, attaching: false}
+	vmAttachments := map[volumeAttachmentKey]bool{attached: true, attaching: true, orphaned: true,
+		unresolved: true, foreign: true, ephemeral: true}
+	clusterVolumes := map[string]bool{"vol-1": true, "vol-2": true, "vol-3": true, "vol-4": true, "vol-5": true}
+	pvVolumes := map[string]bool{"vol-1": true, "vol-2": true, "vol-3": true, "vol-4": true}
+	drift := getAttachmentDrift(vaAttachments, map[string]bool{"vol-4": true}, vmAttachments, clusterVolumes,
+		pvVolumes)
+	if len(drift.missing) != 1 || drift.missing[0] != missing {
+		t.Errorf("expected missing attachments [%v], got %v", missing, drift.missing)
+	}
+	if len(drift.orphaned) != 1 || !drift.orphaned[orphaned] {
+		t.Errorf("expected orphaned attachments [%v], got %v", orphaned, drift.orphaned)
+	}
+}
+
+func TestFormatVolumeSnapshots(t *testing.T) {
+	snapshots := []*csi.Snapshot{{SnapshotId: "vol-1+snap-1"}, {SnapshotId: "vol-1+snap-2"}}
+	volumeSnapshots := map[string]string{"vol-1+snap-1": "VolumeSnapshot default/snapshot-1"}
+	expected := `"vol-1+snap-1" (VolumeSnapshot default/snapshot-1), "vol-1+snap-2"`
+	if actual := formatVolumeSnapshots(snapshots, volumeSnapshots); actual != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+	defer func(policy string) { defaultSnapshotDeletePolicy = policy }(defaultSnapshotDeletePolicy)
+	setDefaultSnapshotDeletePolicy(context.Background(), "invalid")
+	if defaultSnapshotDeletePolicy != common.SnapshotDeletePolicyFail {
+		t.Errorf("expected default snapshot delete policy %q for an invalid policy, got %q",
+			common.SnapshotDeletePolicyFail, defaultSnapshotDeletePolicy)
+	}
+}
+
+func TestGetStoragePolicyMigrationTarget(t *testing.T) {
+	blockMode := v1.PersistentVolumeBlock
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-1"},
+		Spec: v1.PersistentVolumeSpec{
+			Capacity:    v1.ResourceList{v1.ResourceStorage: resource.MustParse("1Gi")},
+			AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteMany},
+			VolumeMode:  &blockMode,
+			ClaimRef:    &v1.ObjectReference{Name: "data", Namespace: "app"},
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{Driver: "csi.vsphere.vmware.com", VolumeHandle: "volume-1"},
+			},
+		},
+	}
+	storageClass := &storagev1.StorageClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "gold"},
+		Parameters: map[string]string{
+			common.AttributeStoragePolicyName: "gold-policy",
+			"csi.storage.k8s.io/fstype":       "ext4",
+		},
+	}
+
+	capabilities := getPVVolumeCapabilities(pv)
+	if len(capabilities) != 1 || capabilities[0].GetBlock() == nil ||
+		capabilities[0].AccessMode.Mode != csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER {
+		t.Errorf("unexpected volume capabilities %v", capabilities)
+	}
+
+	params := getMigrationCreateVolumeParams(storageClass, pv, "migrated-pvc-1")
+	expectedParams := map[string]string{
+		common.AttributeStoragePolicyName: "gold-policy",
+		common.AttributePvName:            "migrated-pvc-1",
+		common.AttributePvcName:           "data",
+		common.AttributePvcNamespace:      "app",
+	}
+	if !reflect.DeepEqual(params, expectedParams) {
+		t.Errorf("expected params %v, got %v", expectedParams, params)
+	}
+
+	migration := &storagePolicyMigration{
+		TargetVolumeID: "volume-2",
+		TargetTopology: []map[string]string{{"topology.csi.vmware.com/k8s-zone": "zone-a"}},
+	}
+	targetPV := getMigrationTargetPV(pv, storageClass, "migrated-pvc-1", migration)
+	if targetPV.Spec.CSI.VolumeHandle != "volume-2" || targetPV.Spec.StorageClassName != "gold" ||
+		targetPV.Spec.ClaimRef != nil {
+		t.Errorf("unexpected target PV %v", targetPV)
+	}
+	if targetPV.Spec.NodeAffinity == nil ||
+		len(targetPV.Spec.NodeAffinity.Required.NodeSelectorTerms) != 1 {
+		t.Errorf("expected node affinity of the target volume topology, got %v", targetPV.Spec.NodeAffinity)
+	}
+}
+
+func TestGetPVCAntiAffinityGroup(t *testing.T) {
+	pvc := &v1.PersistentVolumeClaim{}
+	if group := getPVCAntiAffinityGroup(pvc, nil); group != "" {
+		t.Errorf("expected no anti-affinity group, got %q", group)
+	}
+	scParameters := map[string]string{"AntiAffinityGroup": "sc-group"}
+	if group := getPVCAntiAffinityGroup(pvc, scParameters); group != "sc-group" {
+		t.Errorf("expected anti-affinity group of the storage class, got %q", group)
+	}
+	pvc.Annotations = map[string]string{common.AnnAntiAffinityGroup: " pvc-group "}
+	if group := getPVCAntiAffinityGroup(pvc, scParameters); group != "pvc-group" {
+		t.Errorf("expected anti-affinity group of the PVC annotation, got %q", group)
+	}
+}
+
+func TestCrossPolicyRestoreOnSharedDatastoresOnly(t *testing.T) {
+	ct := getControllerTest(t)
+	if os.Getenv("VSPHERE_DATASTORE_URL") != "" {
+		t.Skip("requires the datastores of the simulator")
+	}
+	respCreate, err := ct.controller.CreateVolume(ctx, &csi.CreateVolumeRequest{
+		Name:          testVolumeName + "-" + uuid.New().String(),
+		CapacityRange: &csi.CapacityRange{RequiredBytes: 1 * common.GbInBytes},
+		VolumeCapabilities: []*csi.VolumeCapability{{
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	volID := respCreate.Volume.VolumeId
+	defer func() {
+		if _, err := ct.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: volID}); err != nil {
+			t.Error(err)
+		}
+	}()
+	respSnapshot, err := ct.controller.CreateSnapshot(ctx, &csi.CreateSnapshotRequest{
+		SourceVolumeId: volID,
+		Name:           "snapshot-" + uuid.New().String(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapID := respSnapshot.Snapshot.SnapshotId
+	defer func() {
+		if _, err := ct.controller.DeleteSnapshot(ctx, &csi.DeleteSnapshotRequest{SnapshotId: snapID}); err != nil {
+			t.Error(err)
+		}
+	}()
+	datacenters, err := ct.vcenter.GetDatacenters(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dsInfos, err := datacenters[0].GetAllDatastores(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sharedDatastores []*cnsvsphere.DatastoreInfo
+	for _, dsInfo := range dsInfos {
+		sharedDatastores = append(sharedDatastores, dsInfo)
+	}
+	getSpec := func() *common.CreateVolumeSpec {
+		return &common.CreateVolumeSpec{
+			Name:                    testVolumeName + "-" + uuid.New().String(),
+			ScParams:                &common.StorageClassParams{},
+			CapacityMB:              1024,
+			VolumeType:              common.BlockVolumeType,
+			ContentSourceSnapshotID: snapID,
+		}
+	}
+	opts := common.CreateBlockVolumeOptions{AllowCrossPolicyRestore: true}
+
+	// The datastore of the snapshot is not shared by the nodes of the topology.
+	_, _, err = common.CreateBlockVolumeUtil(ctx, cnstypes.CnsClusterFlavorVanilla, ct.controller.manager,
+		getSpec(), nil, opts, nil)
+	if err == nil {
+		t.Errorf("expected the restore on a datastore not shared by the nodes to fail")
+	}
+
+	volumeInfo, _, err := common.CreateBlockVolumeUtil(ctx, cnstypes.CnsClusterFlavorVanilla,
+		ct.controller.manager, getSpec(), sharedDatastores, opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ct.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: volumeInfo.VolumeID.Id})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIsDatastoreSharedAcrossHosts(t *testing.T) {
+	ct := getControllerTest(t)
+	if os.Getenv("VSPHERE_DATASTORE_URL") != "" {
+		t.Skip("requires the datastores of the simulator")
+	}
+	datacenters, err := ct.vcenter.GetDatacenters(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dsInfos, err := datacenters[0].GetAllDatastores(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The datastores of the simulator are mounted on all the hosts of the cluster.
+	for dsURL := range dsInfos {
+		shared, err := common.IsDatastoreSharedAcrossHosts(ctx, ct.vcenter, dsURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !shared {
+			t.Errorf("expected datastore %q to be shared across hosts", dsURL)
+		}
+	}
+	if _, err := common.IsDatastoreSharedAcrossHosts(ctx, ct.vcenter, "ds:///vmfs/volumes/unknown/"); err == nil {
+		t.Errorf("expected an error for an unknown datastore")
+	}
+}
+
+func TestGetAntiAffinityGroup(t *testing.T) {
+	getControllerTest(t)
+	scParams := &common.StorageClassParams{AntiAffinityGroup: "db"}
+	if group := getAntiAffinityGroup(ctx, map[string]string{}, scParams); group != "" {
+		t.Errorf("expected no anti-affinity group when the PVC is unknown, got %q", group)
+	}
+	params := map[string]string{common.AttributePvcName: "data-0", common.AttributePvcNamespace: "ns-1"}
+	if group := getAntiAffinityGroup(ctx, params, scParams); group != "ns-1/db" {
+		t.Errorf("expected anti-affinity group scoped to the namespace of the PVC, got %q", group)
+	}
+	if group := getAntiAffinityGroup(ctx, params, &common.StorageClassParams{}); group != "" {
+		t.Errorf("expected no anti-affinity group, got %q", group)
+	}
+}
+
+func TestGetAntiAffinityDatastoreURLs(t *testing.T) {
+	ct := getControllerTest(t)
+	reqCreate := &csi.CreateVolumeRequest{
+		Name:          testVolumeName + "-" + uuid.New().String(),
+		CapacityRange: &csi.CapacityRange{RequiredBytes: 1 * common.GbInBytes},
+		VolumeCapabilities: []*csi.VolumeCapability{{
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+		}},
+	}
+	respCreate, err := ct.controller.CreateVolume(ctx, reqCreate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volumeID := respCreate.Volume.VolumeId
+	defer func() {
+		if _, err := ct.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: volumeID}); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	savedGetAntiAffinityGroupVolumeIDs := getAntiAffinityGroupVolumeIDs
+	defer func() { getAntiAffinityGroupVolumeIDs = savedGetAntiAffinityGroupVolumeIDs }()
+	getAntiAffinityGroupVolumeIDs = func(ctx context.Context, namespace string, group string) ([]string, error) {
+		if namespace == "ns-1" && group == "db" {
+			return []string{volumeID}, nil
+		}
+		return nil, nil
+	}
+	// The placements of the group are rebuilt from the volumes of its PVCs.
+	if urls := ct.controller.getAntiAffinityDatastoreURLs(ctx, "ns-1/db"); len(urls) != 1 || urls[0] == "" {
+		t.Errorf("expected the datastore of volume %q, got %v", volumeID, urls)
+	}
+	// Groups of the same name in other namespaces are unrelated.
+	if urls := ct.controller.getAntiAffinityDatastoreURLs(ctx, "ns-2/db"); len(urls) != 0 {
+		t.Errorf("expected no datastore for the group of another namespace, got %v", urls)
+	}
+	// The anti-affinity is best-effort.
+	getAntiAffinityGroupVolumeIDs = func(ctx context.Context, namespace string, group string) ([]string, error) {
+		return nil, errors.New("API server unavailable")
+	}
+	if urls := ct.controller.getAntiAffinityDatastoreURLs(ctx, "ns-1/db"); len(urls) != 0 {
+		t.Errorf("expected no datastore when the volumes of the group cannot be listed, got %v", urls)
+	}
+}
+
+func TestGetNodeTopologySegments(t *testing.T) {
+	zone1 := map[string]string{"topology.csi.vmware.com/k8s-zone": "zone1",
+		"topology.csi.vmware.com/k8s-region": "region1"}
+	zone2 := map[string]string{"topology.csi.vmware.com/k8s-zone": "zone2",
+		"topology.csi.vmware.com/k8s-region": "region1"}
+	success := string(csinodetopologyv1alpha1.CSINodeTopologySuccess)
+	nodes := map[string]commoncotypes.NodeTopologyDump{
+		"node-1": {Status: success, TopologyLabels: zone2},
+		"node-2": {Status: success, TopologyLabels: zone1},
+		"node-3": {Status: success, TopologyLabels: zone1},
+		"node-4": {Status: string(csinodetopologyv1alpha1.CSINodeTopologyError), ErrorMessage: "failed"},
+		"node-5": {Status: success},
+	}
+	segments := getNodeTopologySegments(nodes)
+	if !reflect.DeepEqual(segments, []map[string]string{zone1, zone2}) {
+		t.Errorf("unexpected topology segments %v", segments)
+	}
+}
+
+// metadataVolumeManager is a volume manager serving the given FCD metadata.
+type metadataVolumeManager struct {
+	cnsvolume.Manager
+	metadata []vimtypes.KeyValue
+	err      error
+}
+
+func (m *metadataVolumeManager) RetrieveVStorageObjectMetadata(ctx context.Context, volumeID string,
+	prefix string) ([]vimtypes.KeyValue, error) {
+	return m.metadata, m.err
+}
+
+func TestIsMultiWriterVolume(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name        string
+		manager     *metadataVolumeManager
+		expected    bool
+		expectError bool
+	}{
+		{
+			name: "marked",
+			manager: &metadataVolumeManager{metadata: []vimtypes.KeyValue{
+				{Key: common.MultiWriterMetadataKey, Value: "true"}}},
+			expected: true,
+		},
+		{
+			name:    "not marked",
+			manager: &metadataVolumeManager{},
+		},
+		{
+			name:    "vslm not supported",
+			manager: &metadataVolumeManager{err: fmt.Errorf("vslm endpoint is %w", cnsvsphere.ErrNotSupported)},
+		},
+		{
+			name:        "metadata not retrieved",
+			manager:     &metadataVolumeManager{err: errors.New("connection refused")},
+			expectError: true,
+		},
+	}
+	for _, test := range tests {
+		multiWriter, err := isMultiWriterVolume(ctx, test.manager, "vol-1")
+		if (err != nil) != test.expectError {
+			t.Errorf("%s: expected error %v, got: %v", test.name, test.expectError, err)
+		}
+		if multiWriter != test.expected {
+			t.Errorf("%s: expected multi-writer %v, got %v", test.name, test.expected, multiWriter)
+		}
+	}
+}
+
+func TestGetDeletionRetention(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		manager   *metadataVolumeManager
+		retention time.Duration
+		expectErr bool
+	}{
+		{
+			name: "recorded",
+			manager: &metadataVolumeManager{metadata: []vimtypes.KeyValue{
+				{Key: common.DeletionRetentionMetadataKey, Value: "60"}}},
+			retention: time.Hour,
+		},
+		{
+			name:    "not recorded",
+			manager: &metadataVolumeManager{},
+		},
+		{
+			name:    "vslm not supported",
+			manager: &metadataVolumeManager{err: fmt.Errorf("vslm endpoint is %w", cnsvsphere.ErrNotSupported)},
+		},
+		{
+			name:      "metadata not retrieved",
+			manager:   &metadataVolumeManager{err: errors.New("connection refused")},
+			expectErr: true,
+		},
+		{
+			name: "invalid",
+			manager: &metadataVolumeManager{metadata: []vimtypes.KeyValue{
+				{Key: common.DeletionRetentionMetadataKey, Value: "1 day"}}},
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		retention, err := getDeletionRetention(ctx, test.manager, "vol-1")
+		if (err != nil) != test.expectErr {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+		if retention != test.retention {
+			t.Errorf("%s: expected retention %v, got %v", test.name, test.retention, retention)
+		}
+	}
+}
+
+func TestSoftDeletedVolumeReconciliation(t *testing.T) {
+	softDeletedMetadata := &cnstypes.CnsKubernetesEntityMetadata{
+		CnsEntityMetadata: cnstypes.CnsEntityMetadata{
+			EntityName: "pv-1",
+			Labels: []vimtypes.KeyValue{
+				{Key: "app", Value: "db"},
+				{Key: common.SoftDeletedLabel, Value: "true"},
+				{Key: common.DeleteAfterLabel, Value: "2025-01-02T03:04:05Z"},
+				{Key: common.SoftDeletedPVUIDLabel, Value: "uid-1"},
+			},
+		},
+	}
+	deletedPV := &v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pv-1", UID: "uid-1"}}
+	restoredPV := &v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pv-1", UID: "uid-2"}}
+	if isVolumeReclaimed(softDeletedMetadata, nil) {
+		t.Errorf("expected volume without PV not to be reclaimed")
+	}
+	if isVolumeReclaimed(softDeletedMetadata, deletedPV) {
+		t.Errorf("expected volume referenced by the deleted PV not to be reclaimed")
+	}
+	if !isVolumeReclaimed(softDeletedMetadata, restoredPV) {
+		t.Errorf("expected volume referenced by a PV of the same name and another UID to be reclaimed")
+	}
+
+	reclaimedMetadata := getReclaimedPVMetadata(softDeletedMetadata, restoredPV, "cluster-1")
+	if reclaimedMetadata.Delete || len(reclaimedMetadata.Labels) != 1 || reclaimedMetadata.Labels[0].Key != "app" {
+		t.Errorf("expected the soft delete labels to be removed, got %+v", reclaimedMetadata)
+	}
+	otherPV := &v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pv-2", UID: "uid-3"}}
+	if reclaimedMetadata = getReclaimedPVMetadata(softDeletedMetadata, otherPV, "cluster-1"); !reclaimedMetadata.Delete {
+		t.Errorf("expected the entity of the soft deleted PV to be removed, got %+v", reclaimedMetadata)
+	}
+
+	deleteAfter, err := getSoftDeleteDeadline(softDeletedMetadata)
+	if err != nil || !deleteAfter.Equal(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("unexpected deadline %v, error %v", deleteAfter, err)
+	}
+	invalidMetadata := &cnstypes.CnsKubernetesEntityMetadata{
+		CnsEntityMetadata: cnstypes.CnsEntityMetadata{
+			Labels: []vimtypes.KeyValue{{Key: common.DeleteAfterLabel, Value: "tomorrow"}},
+		},
+	}
+	if _, err := getSoftDeleteDeadline(invalidMetadata); err == nil {
+		t.Errorf("expected an error for an invalid deadline")
+	}
+	if _, err := getSoftDeleteDeadline(&cnstypes.CnsKubernetesEntityMetadata{}); err == nil {
+		t.Errorf("expected an error for a missing deadline")
+	}
+}
+
+// fakeMigrationControllerServer is a controller server recording the calls of
+// storage policy migrations.
+type fakeMigrationControllerServer struct {
+	csi.UnimplementedControllerServer
+	createSnapshotErr error
+	createVolumeErr   error
+	deletedSnapshots  []string
+	deletedVolumes    []string
+}
+
+func (s *fakeMigrationControllerServer) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequest) (
+	*csi.CreateSnapshotResponse, error) {
+	if s.createSnapshotErr != nil {
+		return nil, s.createSnapshotErr
+	}
+	return &csi.CreateSnapshotResponse{
+		Snapshot: &csi.Snapshot{SnapshotId: req.SourceVolumeId + "+snap-1", SourceVolumeId: req.SourceVolumeId},
+	}, nil
+}
+
+func (s *fakeMigrationControllerServer) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (
+	*csi.CreateVolumeResponse, error) {
+	if s.createVolumeErr != nil {
+		return nil, s.createVolumeErr
+	}
+	return &csi.CreateVolumeResponse{Volume: &csi.Volume{VolumeId: req.Name + "-volume"}}, nil
+}
+
+func (s *fakeMigrationControllerServer) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotRequest) (
+	*csi.DeleteSnapshotResponse, error) {
+	s.deletedSnapshots = append(s.deletedSnapshots, req.SnapshotId)
+	return &csi.DeleteSnapshotResponse{}, nil
+}
+
+func (s *fakeMigrationControllerServer) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest) (
+	*csi.DeleteVolumeResponse, error) {
+	s.deletedVolumes = append(s.deletedVolumes, req.VolumeId)
+	return &csi.DeleteVolumeResponse{}, nil
+}
+
+func TestStoragePolicyMigrationStateMachine(t *testing.T) {
+	ctx := context.Background()
+	newPV := func(name string) *v1.PersistentVolume {
+		return &v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Annotations: map[string]string{annMigrateToStorageClass: "gold"},
+			},
+			Spec: v1.PersistentVolumeSpec{
+				Capacity:    v1.ResourceList{v1.ResourceStorage: resource.MustParse("1Gi")},
+				AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+				PersistentVolumeSource: v1.PersistentVolumeSource{
+					CSI: &v1.CSIPersistentVolumeSource{Driver: "csi.vsphere.vmware.com", VolumeHandle: name + "-vol"},
+				},
+			},
+		}
+	}
+	storageClass := &storagev1.StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: "gold"},
+		Provisioner: "csi.vsphere.vmware.com",
+	}
+	k8sClient := testclient.NewSimpleClientset(newPV("pv-1"), storageClass)
+	getMigration := func(pvName string) *storagePolicyMigration {
+		pv, err := k8sClient.CoreV1().PersistentVolumes().Get(ctx, pvName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("failed to get PV %q: %v", pvName, err)
+		}
+		migration := &storagePolicyMigration{}
+		if err := json.Unmarshal([]byte(pv.Annotations[annStoragePolicyMigration]), migration); err != nil {
+			t.Fatalf("failed to parse migration state of PV %q: %v", pvName, err)
+		}
+		return migration
+	}
+
+	// A transient error is recorded and the step is retried.
+	controllerServer := &fakeMigrationControllerServer{
+		createSnapshotErr: status.Error(codes.Unavailable, "vCenter is not reachable"),
+	}
+	reconcileStoragePolicyMigrationsOnce(ctx, controllerServer, k8sClient)
+	if migration := getMigration("pv-1"); migration.Phase != "" || migration.Message == "" {
+		t.Errorf("expected the migration to be retried, got %+v", migration)
+	}
+
+	controllerServer.createSnapshotErr = nil
+	reconcileStoragePolicyMigrationsOnce(ctx, controllerServer, k8sClient)
+	migration := getMigration("pv-1")
+	if migration.Phase != migrationPhaseAwaitingSwitchover || migration.TargetPV != "migrated-pv-1" ||
+		migration.TargetVolumeID != "migrated-pv-1-volume" || migration.SnapshotID != "pv-1-vol+snap-1" {
+		t.Errorf("expected the migration to await the switchover, got %+v", migration)
+	}
+	targetPV, err := k8sClient.CoreV1().PersistentVolumes().Get(ctx, "migrated-pv-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the target PV to be created: %v", err)
+	}
+
+	// The workload switches over once the target PV is bound.
+	setPVPhase := func(pv *v1.PersistentVolume, phase v1.PersistentVolumePhase) {
+		pv.Status.Phase = phase
+		if _, err := k8sClient.CoreV1().PersistentVolumes().UpdateStatus(ctx, pv, metav1.UpdateOptions{}); err != nil {
+			t.Fatalf("failed to update the phase of PV %q: %v", pv.Name, err)
+		}
+	}
+	setPVPhase(targetPV, v1.VolumeBound)
+	sourcePV, err := k8sClient.CoreV1().PersistentVolumes().Get(ctx, "pv-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setPVPhase(sourcePV, v1.VolumeBound)
+	reconcileStoragePolicyMigrationsOnce(ctx, controllerServer, k8sClient)
+	if migration := getMigration("pv-1"); migration.Phase != migrationPhaseSwitchedOver {
+		t.Errorf("expected the workload to be switched over, got %+v", migration)
+	}
+	if !reflect.DeepEqual(controllerServer.deletedSnapshots, []string{"pv-1-vol+snap-1"}) {
+		t.Errorf("expected the snapshot of the migration to be deleted, got %v", controllerServer.deletedSnapshots)
+	}
+	if len(controllerServer.deletedVolumes) != 0 {
+		t.Errorf("expected the source volume to be kept while its PV is bound, got %v",
+			controllerServer.deletedVolumes)
+	}
+
+	// The source volume and PV are deleted once the source PV is released.
+	sourcePV, err = k8sClient.CoreV1().PersistentVolumes().Get(ctx, "pv-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setPVPhase(sourcePV, v1.VolumeReleased)
+	reconcileStoragePolicyMigrationsOnce(ctx, controllerServer, k8sClient)
+	if !reflect.DeepEqual(controllerServer.deletedVolumes, []string{"pv-1-vol"}) {
+		t.Errorf("expected the source volume to be deleted, got %v", controllerServer.deletedVolumes)
+	}
+	if _, err := k8sClient.CoreV1().PersistentVolumes().Get(ctx, "pv-1",
+		metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the source PV to be deleted, got err %v", err)
+	}
+
+	// A terminal error fails the migration and its snapshot is cleaned up.
+	if _, err := k8sClient.CoreV1().PersistentVolumes().Create(ctx, newPV("pv-2"),
+		metav1.CreateOptions{}); err != nil {
+		t.Fatalf("failed to create PV: %v", err)
+	}
+	controllerServer = &fakeMigrationControllerServer{
+		createVolumeErr: status.Error(codes.InvalidArgument, "storage policy not compatible"),
+	}
+	reconcileStoragePolicyMigrationsOnce(ctx, controllerServer, k8sClient)
+	if migration := getMigration("pv-2"); migration.Phase != migrationPhaseFailed || migration.SnapshotID != "" {
+		t.Errorf("expected the migration to fail, got %+v", migration)
+	}
+	if !reflect.DeepEqual(controllerServer.deletedSnapshots, []string{"pv-2-vol+snap-1"}) {
+		t.Errorf("expected the snapshot of the failed migration to be deleted, got %v",
+			controllerServer.deletedSnapshots)
+	}
+
+	// The volume of an attached PV is not snapshotted until it is detached.
+	pvName := "pv-3"
+	if _, err := k8sClient.CoreV1().PersistentVolumes().Create(ctx, newPV(pvName),
+		metav1.CreateOptions{}); err != nil {
+		t.Fatalf("failed to create PV: %v", err)
+	}
+	va := &storagev1.VolumeAttachment{
+		ObjectMeta: metav1.ObjectMeta{Name: "va-3"},
+		Spec: storagev1.VolumeAttachmentSpec{
+			Attacher: "csi.vsphere.vmware.com",
+			NodeName: "node-1",
+			Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &pvName},
+		},
+	}
+	if _, err := k8sClient.StorageV1().VolumeAttachments().Create(ctx, va, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("failed to create VolumeAttachment: %v", err)
+	}
+	controllerServer = &fakeMigrationControllerServer{}
+	reconcileStoragePolicyMigrationsOnce(ctx, controllerServer, k8sClient)
+	if migration := getMigration(pvName); migration.Phase != "" || !strings.Contains(migration.Message, "attached") {
+		t.Errorf("expected the migration to wait for the PV to be detached, got %+v", migration)
+	}
+	if err := k8sClient.StorageV1().VolumeAttachments().Delete(ctx, "va-3", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	reconcileStoragePolicyMigrationsOnce(ctx, controllerServer, k8sClient)
+	if migration := getMigration(pvName); migration.Phase != migrationPhaseAwaitingSwitchover {
+		t.Errorf("expected the migration to await the switchover, got %+v", migration)
+	}
+
+	// The target volume is cleaned up if its PV is deleted before the
+	// workload switched over.
+	if err := k8sClient.CoreV1().PersistentVolumes().Delete(ctx, "migrated-pv-3",
+		metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	reconcileStoragePolicyMigrationsOnce(ctx, controllerServer, k8sClient)
+	if migration := getMigration(pvName); migration.Phase != migrationPhaseFailed ||
+		migration.TargetVolumeID != "" || migration.TargetPV != "" {
+		t.Errorf("expected the migration to fail and its target to be cleaned up, got %+v", migration)
+	}
+	if !reflect.DeepEqual(controllerServer.deletedVolumes, []string{"migrated-pv-3-volume"}) {
+		t.Errorf("expected the target volume to be deleted, got %v", controllerServer.deletedVolumes)
+	}
+}
+
+func TestIsTerminalMigrationError(t *testing.T) {
+	tests := map[error]bool{
+		status.Error(codes.InvalidArgument, "invalid"):                                   true,
+		fmt.Errorf("failed: %w", status.Error(codes.FailedPrecondition, "precondition")): true,
+		&terminalMigrationError{err: errors.New("file volume")}:                          true,
+		status.Error(codes.Unavailable, "unavailable"):                                   false,
+		status.Error(codes.Internal, "task failed"):                                      false,
+		errors.New("connection refused"):                                                 false,
+	}
+	for err, terminal := range tests {
+		if isTerminalMigrationError(err) != terminal {
+			t.Errorf("expected terminal %t for error %v", terminal, err)
+		}
+	}
+}
+
+func TestDeleteVolumeSnapshotsReferencedByContents(t *testing.T) {
+	ctx := context.Background()
+	snapshotHandle := "vol-1+snap-1"
+	dynamicContent := &snapshotv1.VolumeSnapshotContent{
+		ObjectMeta: metav1.ObjectMeta{Name: "snapcontent-1"},
+		Spec: snapshotv1.VolumeSnapshotContentSpec{
+			VolumeSnapshotRef: v1.ObjectReference{Namespace: "default", Name: "snapshot-1"},
+		},
+		Status: &snapshotv1.VolumeSnapshotContentStatus{SnapshotHandle: &snapshotHandle},
+	}
+	staticContent := &snapshotv1.VolumeSnapshotContent{
+		ObjectMeta: metav1.ObjectMeta{Name: "snapcontent-2"},
+		Spec: snapshotv1.VolumeSnapshotContentSpec{
+			Source: snapshotv1.VolumeSnapshotContentSource{SnapshotHandle: &snapshotHandle},
+		},
+	}
+	for _, content := range []*snapshotv1.VolumeSnapshotContent{dynamicContent, staticContent} {
+		handles, err := getVolumeSnapshotContentSnapshotHandles(content)
+		if err != nil || !reflect.DeepEqual(handles, []string{snapshotHandle}) {
+			t.Errorf("expected VolumeSnapshotContent %q to be indexed by %q, got %v, error %v", content.Name,
+				snapshotHandle, handles, err)
+		}
+	}
+
+	originalGetVolumeSnapshotsOfSnapshots := getVolumeSnapshotsOfSnapshots
+	defer func() { getVolumeSnapshotsOfSnapshots = originalGetVolumeSnapshotsOfSnapshots }()
+	getVolumeSnapshotsOfSnapshots = func(ctx context.Context, snapshots []*csi.Snapshot) (map[string]string, error) {
+		return map[string]string{snapshotHandle: "VolumeSnapshot default/snapshot-1"}, nil
+	}
+	// The volume manager is not used as no snapshot may be deleted.
+	_, err := deleteVolumeSnapshots(ctx, nil, "vol-1", []*csi.Snapshot{{SnapshotId: snapshotHandle}})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected FailedPrecondition for snapshots referenced by VolumeSnapshotContents, got %v", err)
+	}
+	getVolumeSnapshotsOfSnapshots = func(ctx context.Context, snapshots []*csi.Snapshot) (map[string]string, error) {
+		return nil, errors.New("connection refused")
+	}
+	_, err = deleteVolumeSnapshots(ctx, nil, "vol-1", []*csi.Snapshot{{SnapshotId: snapshotHandle}})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("expected Unavailable when the VolumeSnapshotContents cannot be checked, got %v", err)
+	}
+}
+
+func TestCapacityCacheKey(t *testing.T) {
+	req := &csi.GetCapacityRequest{
+		Parameters:         map[string]string{common.AttributeStoragePolicyName: "gold"},
+		AccessibleTopology: &csi.Topology{Segments: map[string]string{v1.LabelTopologyZone: "zone-a"}},
+	}
+	if capacityCacheKey(req, false) == capacityCacheKey(req, true) {
+		t.Errorf("expected the capacity of block and file volumes to be cached separately")
+	}
+	other := &csi.GetCapacityRequest{
+		Parameters:         req.Parameters,
+		AccessibleTopology: &csi.Topology{Segments: map[string]string{v1.LabelTopologyZone: "zone-b"}},
+	}
+	if capacityCacheKey(req, false) == capacityCacheKey(other, false) {
+		t.Errorf("expected the capacity of different topology segments to be cached separately")
+	}
+}
+
+func TestGetCapacity(t *testing.T) {
+	ct := getControllerTest(t)
+	blockCapabilities := []*csi.VolumeCapability{{
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+	}}
+	fileCapabilities := []*csi.VolumeCapability{{
+		AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER},
+	}}
+
+	resp, err := ct.controller.getCapacity(ctx, &csi.GetCapacityRequest{VolumeCapabilities: blockCapabilities})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.AvailableCapacity <= 0 || resp.MaximumVolumeSize.GetValue() > resp.AvailableCapacity {
+		t.Errorf("unexpected capacity for block volumes: %+v", resp)
+	}
+
+	// File volumes only count the vSAN datastores with file service enabled.
+	if _, err = ct.controller.getCapacity(ctx, &csi.GetCapacityRequest{
+		VolumeCapabilities: fileCapabilities}); err != nil {
+		t.Errorf("expected the capacity of file volumes to be reported, got %v", err)
+	}
+
+	// A topology segment is required to pick the vCenter in multi vCenter
+	// deployments.
+	multiVCController := &controller{managers: &common.Managers{
+		VcenterConfigs: map[string]*cnsvsphere.VirtualCenterConfig{"vc-1": {}, "vc-2": {}},
+	}}
+	multivCenterCSITopologyEnabled = true
+	defer func() { multivCenterCSITopologyEnabled = false }()
+	_, err = multiVCController.getCapacity(ctx, &csi.GetCapacityRequest{
+		Parameters:         map[string]string{"multi-vc": "true"},
+		VolumeCapabilities: blockCapabilities,
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument without a topology segment in a multi-VC environment, got %v", err)
+	}
+}
+
+func TestRecommendStoragePodDatastore(t *testing.T) {
+	ct := getControllerTest(t)
+	if os.Getenv("VSPHERE_DATASTORE_URL") != "" {
+		t.Skip("requires the simulator")
+	}
+	datacenters, err := ct.vcenter.GetDatacenters(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc := datacenters[0]
+	folders, err := dc.Folders(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := find.NewFinder(ct.vcenter.Client.Client).SetDatacenter(dc.Datacenter).HostSystemList(ctx, "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Datastores cannot be moved out of a datastore cluster in the simulator,
+	// use a local datastore of a host as the member.
+	dss, err := hosts[0].ConfigManager().DatastoreSystem(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	member, err := dss.CreateLocalDatastore(ctx, "recommend-pod-ds", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	storagePod, err := folders.DatastoreFolder.CreateStoragePod(ctx, "recommend-pod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	task, err := storagePod.MoveInto(ctx, []vimtypes.ManagedObjectReference{member.Reference()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = task.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	newDatastoreInfo := func(ds *object.Datastore) *cnsvsphere.DatastoreInfo {
+		return &cnsvsphere.DatastoreInfo{
+			Datastore: &cnsvsphere.Datastore{Datastore: ds, Datacenter: dc},
+			Info:      &vimtypes.DatastoreInfo{Name: ds.Name(), Url: ds.InventoryPath},
+		}
+	}
+	other, err := find.NewFinder(ct.vcenter.Client.Client).SetDatacenter(dc.Datacenter).Datastore(ctx, "LocalDS_0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recommended, _, err := recommendStoragePodDatastore(ctx, ct.vcenter,
+		[]*cnsvsphere.DatastoreInfo{newDatastoreInfo(other), newDatastoreInfo(member)}, "recommend-pod", 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recommended) != 1 || recommended[0].Reference() != member.Reference() {
+		t.Errorf("expected datastore %v to be recommended, got %v", member.Reference(), recommended)
+	}
+	_, _, err = recommendStoragePodDatastore(ctx, ct.vcenter,
+		[]*cnsvsphere.DatastoreInfo{newDatastoreInfo(other)}, "recommend-pod", 1024)
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected FailedPrecondition when the recommended datastore is not compatible, got %v", err)
+	}
+	_, _, err = recommendStoragePodDatastore(ctx, ct.vcenter,
+		[]*cnsvsphere.DatastoreInfo{newDatastoreInfo(member)}, "no-such-pod", 1024)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for a missing datastore cluster, got %v", err)
+	}
+}
+
+func TestIsInaccessibleDatastoreAttachFault(t *testing.T) {
+	for faultType, expected := range map[string]bool{
+		csifault.VimFaultPrefix + "InaccessibleDatastore":      true,
+		csifault.VimFaultPrefix + "DatastoreNotWritableOnHost": true,
+		csifault.VimFaultPrefix + "CannotAccessFile":           true,
+		csifault.VimFaultPrefix + "InvalidState":               false,
+		csifault.CSIInternalFault:                              false,
+	} {
+		if actual := isInaccessibleDatastoreAttachFault(faultType); actual != expected {
+			t.Errorf("isInaccessibleDatastoreAttachFault(%q) = %v, expected %v", faultType, actual, expected)
+		}
+	}
+}
+
+func TestFilterDatastoresAccessibleFromNodes(t *testing.T) {
+	const zoneKey = "topology.csi.vmware.com/zone"
+	newNode := func(name, zone string) *v1.Node {
+		return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{zoneKey: zone}}}
+	}
+	newDatastoreInfo := func(url string) *cnsvsphere.DatastoreInfo {
+		return &cnsvsphere.DatastoreInfo{Info: &vimtypes.DatastoreInfo{Url: url}}
+	}
+	k8sClient := testclient.NewSimpleClientset(newNode("node-a1", "zone-a"), newNode("node-a2", "zone-a"),
+		newNode("node-b1", "zone-b"))
+	accessible := map[string][]string{
+		"node-a1": {"shared", "zone-a", "node-a1-local"},
+		"node-a2": {"shared", "zone-a"},
+		"node-b1": {"shared"},
+	}
+	origGetURLs := getNodeAccessibleDatastoreURLs
+	defer func() { getNodeAccessibleDatastoreURLs = origGetURLs }()
+	getNodeAccessibleDatastoreURLs = func(ctx context.Context, nodeMgr NodeManagerInterface,
+		nodeName string) ([]string, error) {
+		return accessible[nodeName], nil
+	}
+	urls := func(datastores []*cnsvsphere.DatastoreInfo) []string {
+		var urls []string
+		for _, dsInfo := range datastores {
+			urls = append(urls, dsInfo.Info.Url)
+		}
+		return urls
+	}
+	// Datastores accessible from node-a1, the node the volume failed to attach to.
+	candidates := func() []*cnsvsphere.DatastoreInfo {
+		return []*cnsvsphere.DatastoreInfo{newDatastoreInfo("shared"), newDatastoreInfo("zone-a"),
+			newDatastoreInfo("node-a1-local")}
+	}
+
+	zonalPV := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pv-zone-a"},
+		Spec: v1.PersistentVolumeSpec{
+			NodeAffinity: &v1.VolumeNodeAffinity{
+				Required: &v1.NodeSelector{
+					NodeSelectorTerms: []v1.NodeSelectorTerm{{
+						MatchExpressions: []v1.NodeSelectorRequirement{{
+							Key:      zoneKey,
+							Operator: v1.NodeSelectorOpIn,
+							Values:   []string{"zone-a"},
+						}},
+					}},
+				},
+			},
+		},
+	}
+	ctx := context.Background()
+	filtered, err := filterDatastoresAccessibleFromNodes(ctx, k8sClient, nil, zonalPV, candidates())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := urls(filtered); !reflect.DeepEqual(actual, []string{"shared", "zone-a"}) {
+		t.Errorf("expected datastores accessible from all nodes of zone-a, got %v", actual)
+	}
+
+	noAffinityPV := &v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pv-no-affinity"}}
+	filtered, err = filterDatastoresAccessibleFromNodes(ctx, k8sClient, nil, noAffinityPV, candidates())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := urls(filtered); !reflect.DeepEqual(actual, []string{"shared"}) {
+		t.Errorf("expected datastores accessible from all nodes, got %v", actual)
+	}
+
+	getNodeAccessibleDatastoreURLs = func(ctx context.Context, nodeMgr NodeManagerInterface,
+		nodeName string) ([]string, error) {
+		return nil, errors.New("node VM not found")
+	}
+	if _, err = filterDatastoresAccessibleFromNodes(ctx, k8sClient, nil, zonalPV, candidates()); err == nil {
+		t.Errorf("expected an error when the datastores accessible from a node cannot be found")
+	}
+}
+
+func TestRelocateVolumeForAttachDisabled(t *testing.T) {
+	orig := relocateOnInaccessibleDatastoreAttach
+	defer func() { relocateOnInaccessibleDatastoreAttach = orig }()
+	relocateOnInaccessibleDatastoreAttach = false
+	c := &controller{}
+	if c.relocateVolumeForAttach(context.Background(), nil, &cnsvsphere.VirtualMachine{}, "volume-1") {
+		t.Errorf("expected the volume not to be relocated when relocation on attach is disabled")
+	}
+}
+
+func TestGetNodeVMHost(t *testing.T) {
+	ct := getControllerTest(t)
+	vms, err := find.NewFinder(ct.vcenter.Client.Client).VirtualMachineList(ctx, "/*/vm/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeVM := &cnsvsphere.VirtualMachine{
+		VirtualCenterHost: ct.vcenter.Config.Host,
+		UUID:              vms[0].UUID(ctx),
+		VirtualMachine:    vms[0],
+	}
+	expectedHost, err := vms[0].HostSystem(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeKey := nodeVM.VirtualCenterHost + "/" + nodeVM.UUID
+	defer nodeVMHosts.Delete(nodeKey)
+
+	host, err := getNodeVMHost(ctx, nodeVM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host.Reference() != expectedHost.Reference() {
+		t.Errorf("expected host %v, got %v", expectedHost.Reference(), host.Reference())
+	}
+	// The cached host is returned without looking it up again.
+	otherHost := vimtypes.ManagedObjectReference{Type: "HostSystem", Value: "host-cached"}
+	nodeVMHosts.Store(nodeKey, cachedNodeVMHost{host: otherHost, expiry: time.Now().Add(time.Minute)})
+	host, err = getNodeVMHost(ctx, nodeVM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host.Reference() != otherHost {
+		t.Errorf("expected cached host %v, got %v", otherHost, host.Reference())
+	}
+	// An expired entry is refreshed.
+	nodeVMHosts.Store(nodeKey, cachedNodeVMHost{host: otherHost, expiry: time.Now().Add(-time.Minute)})
+	host, err = getNodeVMHost(ctx, nodeVM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host.Reference() != expectedHost.Reference() {
+		t.Errorf("expected host %v after the cache entry expired, got %v", expectedHost.Reference(),
+			host.Reference())
+	}
+}
+
+func TestAcquireAttachSlotHostLookups(t *testing.T) {
+	ct := getControllerTest(t)
+	origLimiter := attachLimiter
+	defer func() { attachLimiter = origLimiter }()
+
+	// The host of the node VM is not looked up if attaches are not limited.
+	attachLimiter = &operationLimiter{slots: make(map[string]chan struct{})}
+	attachLimiter.setLimit(-1)
+	release, err := acquireAttachSlot(ctx, &cnsvsphere.VirtualMachine{UUID: "unlimited-node"})
+	if err != nil {
+		t.Fatalf("failed to acquire attach slot: %v", err)
+	}
+	release()
+
+	// The hardware model of the host is not looked up without class limits.
+	vms, err := find.NewFinder(ct.vcenter.Client.Client).VirtualMachineList(ctx, "/*/vm/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeVM := &cnsvsphere.VirtualMachine{
+		VirtualCenterHost: ct.vcenter.Config.Host,
+		UUID:              vms[0].UUID(ctx),
+		VirtualMachine:    vms[0],
+	}
+	defer nodeVMHosts.Delete(nodeVM.VirtualCenterHost + "/" + nodeVM.UUID)
+	host, err := vms[0].HostSystem(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey := nodeVM.VirtualCenterHost + "/" + host.Reference().Value
+	hostHardwareModels.Delete(hostKey)
+	attachLimiter = &operationLimiter{slots: make(map[string]chan struct{})}
+	attachLimiter.setLimit(1)
+	release, err = acquireAttachSlot(ctx, nodeVM)
+	if err != nil {
+		t.Fatalf("failed to acquire attach slot: %v", err)
+	}
+	release()
+	if _, ok := hostHardwareModels.Load(hostKey); ok {
+		t.Errorf("expected the hardware model of host %q not to be looked up without class limits", hostKey)
+	}
+	if _, ok := attachLimiter.slots[hostKey]; !ok {
+		t.Errorf("expected the attach to be limited on host %q", hostKey)
+	}
+}
+
+// staleNodeVMVolumeManager reports the VMs a volume is attached to and records
+// the VMs it is detached from.
+type staleNodeVMVolumeManager struct {
+	cnsvolume.Manager
+	associations []vslmtypes.VslmVsoVStorageObjectAssociationsVmDiskAssociation
+	detachedVMs  []string
+}
+
+func (m *staleNodeVMVolumeManager) RetrieveVStorageObjectAssociations(ctx context.Context,
+	volumeID string) ([]vslmtypes.VslmVsoVStorageObjectAssociationsVmDiskAssociation, error) {
+	return m.associations, nil
+}
+
+func (m *staleNodeVMVolumeManager) DetachVolume(ctx context.Context, vm *cnsvsphere.VirtualMachine,
+	volumeID string) (string, error) {
+	m.detachedVMs = append(m.detachedVMs, vm.Reference().Value)
+	return "", nil
+}
+
+// staleNodeVMNodeManager resolves the names of the nodes of the given VM UUIDs.
+type staleNodeVMNodeManager struct {
+	NodeManagerInterface
+	nodeNames map[string]string
+}
+
+func (m *staleNodeVMNodeManager) GetNodeNameByUUID(ctx context.Context, nodeUUID string) (string, error) {
+	if nodeName, ok := m.nodeNames[nodeUUID]; ok {
+		return nodeName, nil
+	}
+	return "", node.ErrNodeNotFound
+}
+
+func TestDetachVolumeFromStaleNodeVMs(t *testing.T) {
+	model := simulator.VPX()
+	model.Machine = 4
+	defer model.Remove()
+	err := model.Run(func(ctx context.Context, c *vim25.Client) error {
+		simVMs := model.Map().All("VirtualMachine")
+		vms := make([]*simulator.VirtualMachine, len(simVMs))
+		for i, simVM := range simVMs {
+			vms[i] = simVM.(*simulator.VirtualMachine)
+		}
+		nodeVM := &cnsvsphere.VirtualMachine{
+			UUID:           vms[0].Config.Uuid,
+			VirtualMachine: object.NewVirtualMachine(c, vms[0].Reference()),
+		}
+		orphanedVM, orphanedNodeVM, connectedVM := vms[1], vms[2], vms[3]
+		orphanedVM.Runtime.ConnectionState = vimtypes.VirtualMachineConnectionStateOrphaned
+		orphanedNodeVM.Runtime.ConnectionState = vimtypes.VirtualMachineConnectionStateOrphaned
+		controller := &controller{nodeMgr: &staleNodeVMNodeManager{
+			nodeNames: map[string]string{orphanedNodeVM.Config.Uuid: "node-2"},
+		}}
+
+		tests := []struct {
+			name             string
+			vms              []string
+			expectedDetached bool
+			expectedVMs      []string
+		}{
+			{
+				name:             "orphaned VM of a removed node",
+				vms:              []string{nodeVM.Reference().Value, orphanedVM.Reference().Value},
+				expectedDetached: true,
+				expectedVMs:      []string{orphanedVM.Reference().Value},
+			},
+			{
+				name: "connected VM",
+				vms:  []string{orphanedVM.Reference().Value, connectedVM.Reference().Value},
+			},
+			{
+				name: "orphaned VM of a node still present",
+				vms:  []string{orphanedNodeVM.Reference().Value},
+			},
+			{
+				name:             "VM gone from vCenter",
+				vms:              []string{"vm-gone"},
+				expectedDetached: true,
+				expectedVMs:      []string{"vm-gone"},
+			},
+			{
+				name: "attached to the node VM only",
+				vms:  []string{nodeVM.Reference().Value},
+			},
+		}
+		for _, test := range tests {
+			volumeManager := &staleNodeVMVolumeManager{}
+			for _, vm := range test.vms {
+				volumeManager.associations = append(volumeManager.associations,
+					vslmtypes.VslmVsoVStorageObjectAssociationsVmDiskAssociation{VmId: vm})
+			}
+			detached := controller.detachVolumeFromStaleNodeVMs(ctx, volumeManager, nodeVM, "volume-1")
+			if detached != test.expectedDetached {
+				t.Errorf("%s: expected detached %t, got %t", test.name, test.expectedDetached, detached)
+			}
+			if !reflect.DeepEqual(volumeManager.detachedVMs, test.expectedVMs) {
+				t.Errorf("%s: expected the volume to be detached from %v, got %v", test.name, test.expectedVMs,
+					volumeManager.detachedVMs)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateFileVolumeWhenFileVolumesDisabled(t *testing.T) {
+	ct := getControllerTest(t)
+	req := &csi.CreateVolumeRequest{
+		Name:          testVolumeName + "-" + uuid.New().String(),
+		CapacityRange: &csi.CapacityRange{RequiredBytes: 1 * common.GbInBytes},
+		VolumeCapabilities: []*csi.VolumeCapability{{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+			},
+		}},
+	}
+
+	ct.controller.manager.CnsConfig.Global.FileVolumesDisabled = true
+	_, err := ct.controller.CreateVolume(ctx, req)
+	ct.controller.manager.CnsConfig.Global.FileVolumesDisabled = false
+	if status.Code(err) != codes.Unimplemented || !strings.Contains(err.Error(), "file-volumes-disabled") {
+		t.Fatalf("expected file volume creation to fail with %v when file volumes are disabled, got: %v",
+			codes.Unimplemented, err)
+	}
+}
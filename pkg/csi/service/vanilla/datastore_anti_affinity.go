@@ -0,0 +1,167 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vanilla
+
+import (
+	"context"
+	"strings"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/utils"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common/commonco"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/types"
+	k8s "sigs.k8s.io/vsphere-csi-driver/v3/pkg/kubernetes"
+)
+
+// getAntiAffinityGroup returns the anti-affinity group of the volume to
+// create, given by the annotation of its PVC, or else by the storage class.
+// Groups are scoped to the namespace of the PVC, as "<namespace>/<group>", so
+// that the volumes of a namespace are not placed away from the ones of another
+// namespace using the same group name. The volume has no anti-affinity group
+// if the external-provisioner does not pass the PVC, i.e. if it does not run
+// with --extra-create-metadata.
+func getAntiAffinityGroup(ctx context.Context, params map[string]string,
+	scParams *common.StorageClassParams) string {
+	log := logger.GetLogger(ctx)
+	pvcName, pvcNamespace := params[common.AttributePvcName], params[common.AttributePvcNamespace]
+	if pvcName == "" || pvcNamespace == "" {
+		if scParams.AntiAffinityGroup != "" {
+			log.Warnf("anti-affinity group %q of the storage class is ignored as the PVC of the volume "+
+				"is unknown, the external-provisioner must run with --extra-create-metadata",
+				scParams.AntiAffinityGroup)
+		}
+		return ""
+	}
+	group := scParams.AntiAffinityGroup
+	annotations, err := commonco.ContainerOrchestratorUtility.GetPVCAnnotations(ctx, pvcName, pvcNamespace)
+	if err != nil {
+		log.Warnf("failed to get annotations of PVC %s/%s, using the anti-affinity group of the "+
+			"storage class. Error: %v", pvcNamespace, pvcName, err)
+	} else if pvcGroup := strings.TrimSpace(annotations[common.AnnAntiAffinityGroup]); pvcGroup != "" {
+		group = pvcGroup
+	}
+	if group == "" {
+		return ""
+	}
+	return pvcNamespace + "/" + group
+}
+
+// getPVCAntiAffinityGroup returns the anti-affinity group of the PVC, given
+// by its annotation, or else by the parameters of its storage class.
+func getPVCAntiAffinityGroup(pvc *v1.PersistentVolumeClaim, scParameters map[string]string) string {
+	if group := strings.TrimSpace(pvc.Annotations[common.AnnAntiAffinityGroup]); group != "" {
+		return group
+	}
+	for param, value := range scParameters {
+		if strings.EqualFold(param, common.AttributeAntiAffinityGroup) {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// getAntiAffinityGroupVolumeIDs returns the IDs of the volumes bound to the
+// PVCs of the namespace in the anti-affinity group.
+var getAntiAffinityGroupVolumeIDs = func(ctx context.Context, namespace string, group string) ([]string, error) {
+	k8sClient, err := k8s.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	scList, err := k8sClient.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	scParameters := make(map[string]map[string]string)
+	for _, sc := range scList.Items {
+		if sc.Provisioner == csitypes.Name {
+			scParameters[sc.Name] = sc.Parameters
+		}
+	}
+	pvcList, err := k8sClient.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var volumeIDs []string
+	for i := range pvcList.Items {
+		pvc := &pvcList.Items[i]
+		if pvc.Spec.VolumeName == "" || pvc.Status.Phase != v1.ClaimBound {
+			continue
+		}
+		var params map[string]string
+		if pvc.Spec.StorageClassName != nil {
+			params = scParameters[*pvc.Spec.StorageClassName]
+		}
+		if getPVCAntiAffinityGroup(pvc, params) != group {
+			continue
+		}
+		pv, err := k8sClient.CoreV1().PersistentVolumes().Get(ctx, pvc.Spec.VolumeName, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == csitypes.Name {
+			volumeIDs = append(volumeIDs, pv.Spec.CSI.VolumeHandle)
+		}
+	}
+	return volumeIDs, nil
+}
+
+// getAntiAffinityDatastoreURLs returns the URLs of the datastores holding the
+// volumes of the anti-affinity group. The placements are rebuilt from the PVCs
+// and CNS on each call, so that they hold across restarts and leader changes
+// of the controller. The anti-affinity is best-effort: no datastore is
+// returned if they cannot be retrieved.
+func (c *controller) getAntiAffinityDatastoreURLs(ctx context.Context, scopedGroup string) []string {
+	log := logger.GetLogger(ctx)
+	namespace, group, _ := strings.Cut(scopedGroup, "/")
+	volumeIDs, err := getAntiAffinityGroupVolumeIDs(ctx, namespace, group)
+	if err != nil {
+		log.Warnf("failed to get the volumes of anti-affinity group %q, the volume is placed regardless of "+
+			"the group. Error: %v", scopedGroup, err)
+		return nil
+	}
+	if len(volumeIDs) == 0 {
+		return nil
+	}
+	filter := cnstypes.CnsQueryFilter{}
+	for _, volumeID := range volumeIDs {
+		filter.VolumeIds = append(filter.VolumeIds, cnstypes.CnsVolumeId{Id: volumeID})
+	}
+	queryResult, err := utils.QueryVolumeUtil(ctx, c.manager.VolumeManager, filter,
+		&cnstypes.CnsQuerySelection{Names: []string{string(cnstypes.QuerySelectionNameTypeDataStoreUrl)}}, true)
+	if err != nil {
+		log.Warnf("failed to query the datastores of the volumes of anti-affinity group %q, the volume is "+
+			"placed regardless of the group. Error: %v", scopedGroup, err)
+		return nil
+	}
+	var datastoreURLs []string
+	for _, volume := range queryResult.Volumes {
+		if volume.DatastoreUrl != "" {
+			datastoreURLs = append(datastoreURLs, volume.DatastoreUrl)
+		}
+	}
+	log.Debugf("Volumes of anti-affinity group %q are placed on datastores %v", scopedGroup, datastoreURLs)
+	return datastoreURLs
+}
@@ -0,0 +1,478 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vanilla
+
+import (
+	"context"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	cnsvolume "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/volume"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/prometheus"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/utils"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common/commonco"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+)
+
+// Group snapshots are not a CNS object. The name of the group snapshot is used
+// as the group snapshot id and is used as the name of every member CNS snapshot,
+// which the volume manager records as "<name>-<volume id>" in the snapshot
+// description. The group membership can therefore be resolved from CNS at any
+// time, including after a controller restart.
+//
+// The member snapshots are taken one after the other, without quiescing the
+// I/O of the source volumes. Each member snapshot is crash-consistent on its
+// own, but the group is not crash-consistent as a whole: a write spanning
+// several volumes may be captured by some member snapshots and not by others.
+// Applications needing a consistent group must quiesce their I/O, e.g. freeze
+// their filesystems, for the duration of the group snapshot creation. The group
+// snapshot capability is therefore only advertised if it is enabled in the
+// configuration.
+
+// groupSnapshotRollbackTimeout is the timeout of the deletion of the member
+// snapshots of a group snapshot whose creation failed.
+const groupSnapshotRollbackTimeout = 5 * time.Minute
+
+// groupSnapshotEnabled advertises the group snapshot capability and allows the
+// creation of group snapshots.
+var groupSnapshotEnabled bool
+
+// GroupControllerGetCapabilities returns the capabilities of the group controller service.
+func (c *controller) GroupControllerGetCapabilities(ctx context.Context,
+	req *csi.GroupControllerGetCapabilitiesRequest) (*csi.GroupControllerGetCapabilitiesResponse, error) {
+	ctx = logger.NewContextWithLogger(ctx)
+	log := logger.GetLogger(ctx)
+	log.Infof("GroupControllerGetCapabilities: called with args %+v", *req)
+	if !groupSnapshotEnabled {
+		return &csi.GroupControllerGetCapabilitiesResponse{}, nil
+	}
+	return &csi.GroupControllerGetCapabilitiesResponse{
+		Capabilities: []*csi.GroupControllerServiceCapability{
+			{
+				Type: &csi.GroupControllerServiceCapability_Rpc{
+					Rpc: &csi.GroupControllerServiceCapability_RPC{
+						Type: csi.GroupControllerServiceCapability_RPC_CREATE_DELETE_GET_VOLUME_GROUP_SNAPSHOT,
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// CreateVolumeGroupSnapshot creates a CNS snapshot of every source volume and
+// groups them under the requested name. Member snapshots are taken back to back
+// on the vCenter of the source volumes, so the group is not crash-consistent as
+// a whole. If any member snapshot fails, the member snapshots of the group found
+// in CNS are deleted so that a partial group is not left behind. A member
+// snapshot completing after the rollback is reused when the creation is retried.
+func (c *controller) CreateVolumeGroupSnapshot(ctx context.Context, req *csi.CreateVolumeGroupSnapshotRequest) (
+	*csi.CreateVolumeGroupSnapshotResponse, error) {
+	ctx = logger.NewContextWithLogger(ctx)
+	log := logger.GetLogger(ctx)
+	log.Infof("CreateVolumeGroupSnapshot: called with args %+v", *req)
+
+	createGroupSnapshotInternal := func() (*csi.CreateVolumeGroupSnapshotResponse, error) {
+		if !groupSnapshotEnabled {
+			return nil, logger.LogNewErrorCode(log, codes.Unimplemented, "createVolumeGroupSnapshot")
+		}
+		if req.GetName() == "" {
+			return nil, logger.LogNewErrorCode(log, codes.InvalidArgument, "group snapshot name must be provided")
+		}
+		if len(req.GetSourceVolumeIds()) == 0 {
+			return nil, logger.LogNewErrorCode(log, codes.InvalidArgument, "source volume ids must be provided")
+		}
+		seen := make(map[string]struct{})
+		for _, volumeID := range req.GetSourceVolumeIds() {
+			if _, ok := seen[volumeID]; ok {
+				return nil, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+					"source volume %q is specified more than once", volumeID)
+			}
+			seen[volumeID] = struct{}{}
+		}
+		volumeManager, err := c.getVolumeManagerForGroupSnapshot(ctx, req.GetSourceVolumeIds())
+		if err != nil {
+			return nil, err
+		}
+
+		volumeIds := make([]cnstypes.CnsVolumeId, 0, len(req.GetSourceVolumeIds()))
+		for _, volumeID := range req.GetSourceVolumeIds() {
+			volumeIds = append(volumeIds, cnstypes.CnsVolumeId{Id: volumeID})
+		}
+		cnsVolumeDetailsMap, err := utils.QueryVolumeDetailsUtil(ctx, volumeManager, volumeIds)
+		if err != nil {
+			return nil, err
+		}
+		// Member snapshots may exist from a previous attempt, e.g. a member whose
+		// creation completed after the rollback of the attempt. They are reused
+		// instead of being duplicated.
+		existingSnapshots := make(map[string]*cnstypes.CnsSnapshot)
+		for _, volumeID := range req.GetSourceVolumeIds() {
+			volumeDetails, ok := cnsVolumeDetailsMap[volumeID]
+			if !ok {
+				return nil, logger.LogNewErrorCodef(log, codes.NotFound,
+					"source volume %q not found", volumeID)
+			}
+			if volumeDetails.VolumeType != common.BlockVolumeType {
+				return nil, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+					"source volume %q is of type %s, only block volumes can be snapshotted",
+					volumeID, volumeDetails.VolumeType)
+			}
+			existingSnapshot, err := c.queryUntrackedVolumeSnapshot(ctx, volumeManager, volumeID, req.GetName())
+			if err != nil {
+				return nil, err
+			}
+			if existingSnapshot != nil {
+				existingSnapshots[volumeID] = existingSnapshot
+				continue
+			}
+			if err := c.checkSnapshotQuota(ctx, volumeManager, volumeID, volumeDetails.DatastoreUrl); err != nil {
+				return nil, err
+			}
+		}
+
+		snapshotOperations.start(req.GetSourceVolumeIds()...)
+		defer snapshotOperations.done(req.GetSourceVolumeIds()...)
+		var (
+			snapshots    []*csi.Snapshot
+			creationTime time.Time
+		)
+		for _, volumeID := range req.GetSourceVolumeIds() {
+			var (
+				snapshotID         string
+				snapshotCreateTime time.Time
+			)
+			if existingSnapshot, ok := existingSnapshots[volumeID]; ok {
+				snapshotID = volumeID + common.VSphereCSISnapshotIdDelimiter + existingSnapshot.SnapshotId.Id
+				snapshotCreateTime = existingSnapshot.CreateTime
+				log.Infof("Reusing snapshot %q of group snapshot %q", snapshotID, req.GetName())
+			} else {
+				var cnsSnapshotInfo *cnsvolume.CnsSnapshotInfo
+				snapshotID, cnsSnapshotInfo, err = common.CreateSnapshotUtil(ctx, volumeManager, volumeID,
+					req.GetName(), nil)
+				if err != nil {
+					c.rollbackGroupSnapshot(ctx, volumeManager, req.GetName(), req.GetSourceVolumeIds())
+					return nil, logger.LogNewErrorCodef(log, codes.Internal,
+						"failed to create snapshot on volume %q for group snapshot %q with error: %v",
+						volumeID, req.GetName(), err)
+				}
+				snapshotCreateTime = cnsSnapshotInfo.SnapshotLatestOperationCompleteTime
+			}
+			if snapshotCreateTime.After(creationTime) {
+				creationTime = snapshotCreateTime
+			}
+			snapshots = append(snapshots, &csi.Snapshot{
+				SizeBytes:       cnsVolumeDetailsMap[volumeID].SizeInMB * common.MbInBytes,
+				SnapshotId:      snapshotID,
+				SourceVolumeId:  volumeID,
+				CreationTime:    timestamppb.New(snapshotCreateTime),
+				ReadyToUse:      true,
+				GroupSnapshotId: req.GetName(),
+			})
+		}
+		return &csi.CreateVolumeGroupSnapshotResponse{
+			GroupSnapshot: &csi.VolumeGroupSnapshot{
+				GroupSnapshotId: req.GetName(),
+				Snapshots:       snapshots,
+				CreationTime:    timestamppb.New(creationTime),
+				ReadyToUse:      true,
+			},
+		}, nil
+	}
+
+	start := time.Now()
+	resp, err := createGroupSnapshotInternal()
+	observeGroupSnapshotOp(prometheus.PrometheusCreateGroupSnapshotOpType, start, err)
+	if err == nil {
+		log.Infof("Group snapshot %q created successfully with %d member snapshots.",
+			req.GetName(), len(resp.GroupSnapshot.Snapshots))
+	}
+	return resp, err
+}
+
+// DeleteVolumeGroupSnapshot deletes all member snapshots of the given group
+// snapshot. Member snapshots which are already deleted are skipped.
+func (c *controller) DeleteVolumeGroupSnapshot(ctx context.Context, req *csi.DeleteVolumeGroupSnapshotRequest) (
+	*csi.DeleteVolumeGroupSnapshotResponse, error) {
+	ctx = logger.NewContextWithLogger(ctx)
+	log := logger.GetLogger(ctx)
+	log.Infof("DeleteVolumeGroupSnapshot: called with args %+v", *req)
+
+	deleteGroupSnapshotInternal := func() (*csi.DeleteVolumeGroupSnapshotResponse, error) {
+		if err := validateGroupSnapshotRequest(ctx, req.GetGroupSnapshotId(), req.GetSnapshotIds()); err != nil {
+			return nil, err
+		}
+		for _, csiSnapshotID := range req.GetSnapshotIds() {
+			volumeManager, snapshot, err := c.queryGroupSnapshotMember(ctx, csiSnapshotID)
+			if err != nil {
+				return nil, err
+			}
+			if snapshot == nil {
+				log.Infof("snapshot %q of group snapshot %q is already deleted", csiSnapshotID,
+					req.GetGroupSnapshotId())
+				continue
+			}
+			if !isGroupSnapshotMember(snapshot, req.GetGroupSnapshotId()) {
+				return nil, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+					"snapshot %q is not a member of group snapshot %q", csiSnapshotID, req.GetGroupSnapshotId())
+			}
+			snapshotOperations.start(snapshot.VolumeId.Id)
+			_, err = common.DeleteSnapshotUtil(ctx, volumeManager, csiSnapshotID, nil)
+			snapshotOperations.done(snapshot.VolumeId.Id)
+			if err != nil {
+				return nil, logger.LogNewErrorCodef(log, codes.Internal,
+					"failed to delete snapshot %q of group snapshot %q. Error: %+v",
+					csiSnapshotID, req.GetGroupSnapshotId(), err)
+			}
+		}
+		return &csi.DeleteVolumeGroupSnapshotResponse{}, nil
+	}
+
+	start := time.Now()
+	resp, err := deleteGroupSnapshotInternal()
+	observeGroupSnapshotOp(prometheus.PrometheusDeleteGroupSnapshotOpType, start, err)
+	if err == nil {
+		log.Infof("Group snapshot %q deleted successfully.", req.GetGroupSnapshotId())
+	}
+	return resp, err
+}
+
+// GetVolumeGroupSnapshot returns the group snapshot with the given id after
+// verifying every member snapshot against CNS.
+func (c *controller) GetVolumeGroupSnapshot(ctx context.Context, req *csi.GetVolumeGroupSnapshotRequest) (
+	*csi.GetVolumeGroupSnapshotResponse, error) {
+	ctx = logger.NewContextWithLogger(ctx)
+	log := logger.GetLogger(ctx)
+	log.Infof("GetVolumeGroupSnapshot: called with args %+v", *req)
+
+	getGroupSnapshotInternal := func() (*csi.GetVolumeGroupSnapshotResponse, error) {
+		if err := validateGroupSnapshotRequest(ctx, req.GetGroupSnapshotId(), req.GetSnapshotIds()); err != nil {
+			return nil, err
+		}
+		var (
+			snapshots    []*csi.Snapshot
+			creationTime time.Time
+		)
+		for _, csiSnapshotID := range req.GetSnapshotIds() {
+			volumeManager, snapshot, err := c.queryGroupSnapshotMember(ctx, csiSnapshotID)
+			if err != nil {
+				return nil, err
+			}
+			if snapshot == nil || !isGroupSnapshotMember(snapshot, req.GetGroupSnapshotId()) {
+				return nil, logger.LogNewErrorCodef(log, codes.NotFound,
+					"snapshot %q of group snapshot %q not found", csiSnapshotID, req.GetGroupSnapshotId())
+			}
+			volumeID := snapshot.VolumeId.Id
+			cnsVolumeDetailsMap, err := utils.QueryVolumeDetailsUtil(ctx, volumeManager,
+				[]cnstypes.CnsVolumeId{{Id: volumeID}})
+			if err != nil {
+				return nil, err
+			}
+			volumeDetails, ok := cnsVolumeDetailsMap[volumeID]
+			if !ok {
+				return nil, logger.LogNewErrorCodef(log, codes.Internal,
+					"cns query volume did not return the volume: %s", volumeID)
+			}
+			if snapshot.CreateTime.After(creationTime) {
+				creationTime = snapshot.CreateTime
+			}
+			snapshots = append(snapshots, &csi.Snapshot{
+				SizeBytes:       volumeDetails.SizeInMB * common.MbInBytes,
+				SnapshotId:      csiSnapshotID,
+				SourceVolumeId:  volumeID,
+				CreationTime:    timestamppb.New(snapshot.CreateTime),
+				ReadyToUse:      true,
+				GroupSnapshotId: req.GetGroupSnapshotId(),
+			})
+		}
+		return &csi.GetVolumeGroupSnapshotResponse{
+			GroupSnapshot: &csi.VolumeGroupSnapshot{
+				GroupSnapshotId: req.GetGroupSnapshotId(),
+				Snapshots:       snapshots,
+				CreationTime:    timestamppb.New(creationTime),
+				ReadyToUse:      true,
+			},
+		}, nil
+	}
+
+	start := time.Now()
+	resp, err := getGroupSnapshotInternal()
+	observeGroupSnapshotOp(prometheus.PrometheusGetGroupSnapshotOpType, start, err)
+	return resp, err
+}
+
+// validateGroupSnapshotRequest validates the group snapshot id and member
+// snapshot ids of Get and Delete group snapshot requests.
+func validateGroupSnapshotRequest(ctx context.Context, groupSnapshotID string, snapshotIDs []string) error {
+	log := logger.GetLogger(ctx)
+	if !commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.BlockVolumeSnapshot) {
+		return logger.LogNewErrorCode(log, codes.Unimplemented, "group snapshot")
+	}
+	if groupSnapshotID == "" {
+		return logger.LogNewErrorCode(log, codes.InvalidArgument, "group snapshot id must be provided")
+	}
+	if len(snapshotIDs) == 0 {
+		return logger.LogNewErrorCode(log, codes.InvalidArgument, "snapshot ids must be provided")
+	}
+	for _, csiSnapshotID := range snapshotIDs {
+		if _, _, err := common.ParseCSISnapshotID(csiSnapshotID); err != nil {
+			return logger.LogNewErrorCode(log, codes.InvalidArgument, err.Error())
+		}
+	}
+	return nil
+}
+
+// getVolumeManagerForGroupSnapshot returns the volume manager of the vCenter
+// hosting all the given volumes. All the members of a group snapshot must be
+// on the same vCenter.
+func (c *controller) getVolumeManagerForGroupSnapshot(ctx context.Context, volumeIDs []string) (
+	cnsvolume.Manager, error) {
+	log := logger.GetLogger(ctx)
+	if !commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.BlockVolumeSnapshot) {
+		return nil, logger.LogNewErrorCode(log, codes.Unimplemented, "createVolumeGroupSnapshot")
+	}
+	var (
+		groupVCenterHost string
+		volumeManager    cnsvolume.Manager
+	)
+	for _, volumeID := range volumeIDs {
+		vCenterHost, manager, err := getVCenterAndVolumeManagerForVolumeID(ctx, c, volumeID, volumeInfoService)
+		if err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to get vCenter/volume manager for volume Id: %q. Error: %v", volumeID, err)
+		}
+		if groupVCenterHost != "" && vCenterHost != groupVCenterHost {
+			return nil, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+				"source volumes of a group snapshot must be on the same vCenter, volume %q is on %q and not on %q",
+				volumeID, vCenterHost, groupVCenterHost)
+		}
+		groupVCenterHost, volumeManager = vCenterHost, manager
+	}
+	isCnsSnapshotSupported, err := getVCenterManagerForVCenter(ctx, c).IsCnsSnapshotSupported(ctx,
+		groupVCenterHost)
+	if err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to check if cns snapshot is supported on VC due to error: %v", err)
+	}
+	if !isCnsSnapshotSupported {
+		return nil, logger.LogNewErrorCode(log, codes.Unimplemented,
+			"VC version does not support snapshot operations")
+	}
+	return volumeManager, nil
+}
+
+// queryGroupSnapshotMember queries CNS for the given member snapshot and returns
+// it along with the volume manager of its vCenter. A nil snapshot is returned
+// if the snapshot does not exist.
+func (c *controller) queryGroupSnapshotMember(ctx context.Context, csiSnapshotID string) (
+	cnsvolume.Manager, *cnstypes.CnsSnapshot, error) {
+	log := logger.GetLogger(ctx)
+	volumeID, snapshotID, err := common.ParseCSISnapshotID(csiSnapshotID)
+	if err != nil {
+		return nil, nil, logger.LogNewErrorCode(log, codes.InvalidArgument, err.Error())
+	}
+	_, volumeManager, err := getVCenterAndVolumeManagerForVolumeID(ctx, c, volumeID, volumeInfoService)
+	if err != nil {
+		return nil, nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to get vCenter/volume manager for snapshot Id: %q. Error: %v", csiSnapshotID, err)
+	}
+	querySnapFilter := cnstypes.CnsSnapshotQueryFilter{
+		SnapshotQuerySpecs: []cnstypes.CnsSnapshotQuerySpec{
+			{
+				VolumeId:   cnstypes.CnsVolumeId{Id: volumeID},
+				SnapshotId: &cnstypes.CnsSnapshotId{Id: snapshotID},
+			},
+		},
+		Cursor: &cnstypes.CnsCursor{
+			Offset: 0,
+			Limit:  common.QuerySnapshotLimit,
+		},
+	}
+	queryResultEntries, _, err := utils.QuerySnapshotsUtil(ctx, volumeManager, querySnapFilter,
+		common.QuerySnapshotLimit)
+	if err != nil {
+		return nil, nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to query snapshot %q. Error: %+v", csiSnapshotID, err)
+	}
+	if len(queryResultEntries) == 0 {
+		return volumeManager, nil, nil
+	}
+	if queryResultEntries[0].Error != nil {
+		switch queryResultEntries[0].Error.Fault.(type) {
+		case cnstypes.CnsSnapshotNotFoundFault, *cnstypes.CnsSnapshotNotFoundFault:
+			return volumeManager, nil, nil
+		case cnstypes.CnsVolumeNotFoundFault, *cnstypes.CnsVolumeNotFoundFault:
+			return volumeManager, nil, nil
+		}
+		return nil, nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"unexpected error received when querying snapshot %q. Error: %+v",
+			csiSnapshotID, queryResultEntries[0].Error.Fault)
+	}
+	return volumeManager, &queryResultEntries[0].Snapshot, nil
+}
+
+// isGroupSnapshotMember returns true if the given CNS snapshot was created as a
+// member of the group snapshot with the given id.
+func isGroupSnapshotMember(snapshot *cnstypes.CnsSnapshot, groupSnapshotID string) bool {
+	return snapshot.Description == groupSnapshotID+"-"+snapshot.VolumeId.Id
+}
+
+// rollbackGroupSnapshot deletes the member snapshots of a group snapshot whose
+// creation failed. The members are looked up in CNS on every source volume, so
+// that a member whose creation completed after its request failed, e.g. on a
+// timeout, is deleted as well. The creation may have failed because the request
+// context has expired, so the member snapshots are deleted with a context
+// detached from the cancellation of the request.
+func (c *controller) rollbackGroupSnapshot(ctx context.Context, volumeManager cnsvolume.Manager,
+	groupSnapshotID string, volumeIDs []string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), groupSnapshotRollbackTimeout)
+	defer cancel()
+	log := logger.GetLogger(ctx)
+	for _, volumeID := range volumeIDs {
+		snapshot, err := common.QueryVolumeSnapshotByName(ctx, volumeManager, volumeID, groupSnapshotID)
+		if err != nil {
+			log.Errorf("failed to look up the snapshot of volume %q of group snapshot %q. Error: %+v",
+				volumeID, groupSnapshotID, err)
+			continue
+		}
+		if snapshot == nil {
+			continue
+		}
+		snapshotID := volumeID + common.VSphereCSISnapshotIdDelimiter + snapshot.SnapshotId.Id
+		log.Infof("Rolling back snapshot %q of group snapshot %q", snapshotID, groupSnapshotID)
+		if _, err := common.DeleteSnapshotUtil(ctx, volumeManager, snapshotID, nil); err != nil {
+			log.Errorf("failed to roll back snapshot %q of group snapshot %q. Error: %+v",
+				snapshotID, groupSnapshotID, err)
+		}
+	}
+}
+
+// observeGroupSnapshotOp records the result of a group snapshot operation in Prometheus.
+func observeGroupSnapshotOp(opType string, start time.Time, err error) {
+	status := prometheus.PrometheusPassStatus
+	faultType := ""
+	if err != nil {
+		status = prometheus.PrometheusFailStatus
+		faultType = "NotComputed"
+	}
+	prometheus.CsiControlOpsHistVec.WithLabelValues(prometheus.PrometheusBlockVolumeType, opType,
+		status, faultType).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vanilla
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"k8s.io/client-go/tools/leaderelection"
+	rl "k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+	k8s "sigs.k8s.io/vsphere-csi-driver/v3/pkg/kubernetes"
+)
+
+const (
+	// reconcilersLockName is the name of the lease electing the controller
+	// replica running the background reconcilers. Unlike the CSI sidecars,
+	// the driver container is not leader elected, so every replica would run
+	// them otherwise.
+	reconcilersLockName = "vsphere-csi-controller-reconcilers"
+	// reconcilersLeaseDuration, reconcilersRenewDeadline and
+	// reconcilersRetryPeriod are the timings of the election, matching the
+	// defaults of the CSI sidecars.
+	reconcilersLeaseDuration = 15 * time.Second
+	reconcilersRenewDeadline = 10 * time.Second
+	reconcilersRetryPeriod   = 5 * time.Second
+)
+
+// runOnLeader runs the background reconcilers while the replica is the
+// leader. The context given to the reconcilers is cancelled when the replica
+// loses the lease, after which it campaigns again.
+func runOnLeader(ctx context.Context, reconcilers ...func(ctx context.Context)) {
+	log := logger.GetLogger(ctx)
+	k8sClient, err := k8s.NewClient(ctx)
+	if err != nil {
+		log.Errorf("failed to create k8s client to elect the replica running the reconcilers. "+
+			"The reconcilers are not run. Error: %+v", err)
+		return
+	}
+	identity, err := os.Hostname()
+	if err != nil {
+		log.Errorf("failed to get the identity of the replica to elect the replica running the reconcilers. "+
+			"The reconcilers are not run. Error: %+v", err)
+		return
+	}
+	lock, err := rl.New(rl.LeasesResourceLock, common.GetCSINamespace(), reconcilersLockName,
+		k8sClient.CoreV1(), k8sClient.CoordinationV1(), rl.ResourceLockConfig{Identity: identity})
+	if err != nil {
+		log.Errorf("failed to create lock to elect the replica running the reconcilers. "+
+			"The reconcilers are not run. Error: %+v", err)
+		return
+	}
+	for ctx.Err() == nil {
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:          lock,
+			LeaseDuration: reconcilersLeaseDuration,
+			RenewDeadline: reconcilersRenewDeadline,
+			RetryPeriod:   reconcilersRetryPeriod,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(leaderCtx context.Context) {
+					log.Infof("Became leader of %q, starting %d reconciler(s)", reconcilersLockName,
+						len(reconcilers))
+					for _, reconcile := range reconcilers {
+						go reconcile(leaderCtx)
+					}
+				},
+				OnStoppedLeading: func() {
+					log.Infof("Stopped leading %q, stopping the reconcilers", reconcilersLockName)
+				},
+			},
+			ReleaseOnCancel: true,
+			Name:            reconcilersLockName,
+		})
+	}
+}
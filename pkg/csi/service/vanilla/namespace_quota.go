@@ -0,0 +1,249 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vanilla
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	"google.golang.org/grpc/codes"
+
+	cnsvolume "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/volume"
+	cnsconfig "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/config"
+	csifault "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/fault"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/utils"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common/commonco"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+)
+
+// namespaceQuotaCacheTTL is the time after which the usage of the namespaces
+// is recomputed from CNS, to account for the volumes created or resized
+// outside of CreateVolume, e.g. statically provisioned or expanded volumes.
+const namespaceQuotaCacheTTL = 10 * time.Minute
+
+// quotaVolume is a block volume accounted in the usage of a namespace.
+type quotaVolume struct {
+	namespace string
+	sizeMB    int64
+	// volumeID is empty while the volume is being created.
+	volumeID string
+}
+
+// namespaceQuotaTracker caches the capacity of the block volumes provisioned
+// for the PVCs of each namespace, to enforce the provisioning quotas of the
+// namespaces given in the vSphere CSI config.
+type namespaceQuotaTracker struct {
+	mutex sync.Mutex
+	// limitsMB maps namespaces to their quota in MB.
+	limitsMB map[string]int64
+	// volumes maps the names of the CNS volumes to their namespace and size.
+	volumes map[string]*quotaVolume
+	// usedMB maps namespaces to the total capacity of their volumes in MB.
+	usedMB map[string]int64
+	// refreshedAt is the time the usage was last computed from CNS.
+	refreshedAt time.Time
+}
+
+// namespaceQuotas tracks the usage of the namespaces having a provisioning
+// quota.
+var namespaceQuotas = &namespaceQuotaTracker{
+	volumes: make(map[string]*quotaVolume),
+	usedMB:  make(map[string]int64),
+}
+
+// setLimits sets the provisioning quotas of the namespaces from the config.
+func (t *namespaceQuotaTracker) setLimits(quotas map[string]*cnsconfig.NamespaceQuotaConfig) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.limitsMB = make(map[string]int64)
+	for namespace, quota := range quotas {
+		if quota != nil && quota.MaxCapacityInMB > 0 {
+			t.limitsMB[namespace] = quota.MaxCapacityInMB
+		}
+	}
+}
+
+// getLimit returns the provisioning quota of the namespace in MB, 0 if the
+// namespace has no quota.
+func (t *namespaceQuotaTracker) getLimit(namespace string) int64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.limitsMB[namespace]
+}
+
+// refresh recomputes the usage of the namespaces from the CNS volumes of the
+// cluster, if it is older than namespaceQuotaCacheTTL. Volumes being created
+// are kept, and volumes which have no PVC metadata yet are accounted in the
+// namespace they were created for.
+// NOTE: The caller must hold the mutex.
+func (t *namespaceQuotaTracker) refresh(ctx context.Context, volumeManager cnsvolume.Manager,
+	clusterID string) error {
+	if time.Since(t.refreshedAt) < namespaceQuotaCacheTTL {
+		return nil
+	}
+	queryAllResult, err := utils.QueryAllVolumesForCluster(ctx, volumeManager, clusterID,
+		cnstypes.CnsQuerySelection{})
+	if err != nil {
+		return err
+	}
+	volumes := make(map[string]*quotaVolume)
+	for _, volume := range queryAllResult.Volumes {
+		if volume.VolumeType != common.BlockVolumeType {
+			continue
+		}
+		namespace := getVolumeNamespace(&volume, clusterID)
+		if cached, ok := t.volumes[volume.Name]; ok && namespace == "" {
+			namespace = cached.namespace
+		}
+		if namespace == "" {
+			continue
+		}
+		var sizeMB int64
+		if backingObjectDetails := volume.BackingObjectDetails; backingObjectDetails != nil {
+			sizeMB = backingObjectDetails.GetCnsBackingObjectDetails().CapacityInMb
+		}
+		volumes[volume.Name] = &quotaVolume{namespace: namespace, sizeMB: sizeMB, volumeID: volume.VolumeId.Id}
+	}
+	for name, volume := range t.volumes {
+		if _, ok := volumes[name]; !ok && volume.volumeID == "" {
+			volumes[name] = volume
+		}
+	}
+	t.volumes = volumes
+	t.usedMB = make(map[string]int64)
+	for _, volume := range volumes {
+		t.usedMB[volume.namespace] += volume.sizeMB
+	}
+	t.refreshedAt = time.Now()
+	return nil
+}
+
+// reserve accounts a volume of the given size about to be created in the
+// namespace, if it fits in its quota. It returns false if the volume is
+// already accounted, i.e. when the creation of the volume is retried.
+// NOTE: The caller must hold the mutex.
+func (t *namespaceQuotaTracker) reserve(ctx context.Context, name string, namespace string,
+	sizeMB int64) (bool, error) {
+	log := logger.GetLogger(ctx)
+	if _, ok := t.volumes[name]; ok {
+		return false, nil
+	}
+	limitMB := t.limitsMB[namespace]
+	if limitMB > 0 && t.usedMB[namespace]+sizeMB > limitMB {
+		return false, logger.LogNewErrorCodef(log, codes.ResourceExhausted,
+			"volume %q of %d MB exceeds the provisioning quota of namespace %q, %d MB of %d MB are in use",
+			name, sizeMB, namespace, t.usedMB[namespace], limitMB)
+	}
+	t.volumes[name] = &quotaVolume{namespace: namespace, sizeMB: sizeMB}
+	t.usedMB[namespace] += sizeMB
+	return true, nil
+}
+
+// commit records the id of the volume reserved with the given name once it
+// has been created, or releases its reservation if the creation failed.
+func (t *namespaceQuotaTracker) commit(name string, volumeID string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	volume, ok := t.volumes[name]
+	if !ok {
+		return
+	}
+	if volumeID == "" {
+		delete(t.volumes, name)
+		t.usedMB[volume.namespace] -= volume.sizeMB
+		return
+	}
+	volume.volumeID = volumeID
+}
+
+// removeVolume stops accounting the deleted volume in the usage of its
+// namespace.
+func (t *namespaceQuotaTracker) removeVolume(volumeID string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for name, volume := range t.volumes {
+		if volume.volumeID == volumeID {
+			delete(t.volumes, name)
+			t.usedMB[volume.namespace] -= volume.sizeMB
+			return
+		}
+	}
+}
+
+// getVolumeNamespace returns the namespace of the PVC of the volume in the
+// given cluster, as recorded in its CNS metadata.
+func getVolumeNamespace(volume *cnstypes.CnsVolume, clusterID string) string {
+	for _, metadata := range volume.Metadata.EntityMetadata {
+		k8sMetadata, ok := metadata.(*cnstypes.CnsKubernetesEntityMetadata)
+		if ok && k8sMetadata.ClusterID == clusterID &&
+			k8sMetadata.EntityType == string(cnstypes.CnsKubernetesEntityTypePVC) {
+			return k8sMetadata.Namespace
+		}
+	}
+	return ""
+}
+
+// createBlockVolumeWithinQuota creates the block volume if it fits in the
+// provisioning quota of the namespace of its PVC, as passed by the
+// external-provisioner with --extra-create-metadata. The usage of the
+// namespace is computed from the capacity of its CNS volumes, so that volumes
+// not accounted by Kubernetes ResourceQuotas are accounted as well.
+func (c *controller) createBlockVolumeWithinQuota(ctx context.Context, req *csi.CreateVolumeRequest) (
+	*csi.CreateVolumeResponse, string, error) {
+	log := logger.GetLogger(ctx)
+	namespace := req.Parameters[common.AttributePvcNamespace]
+	if namespace == "" || namespaceQuotas.getLimit(namespace) == 0 {
+		return c.createBlockVolume(ctx, req)
+	}
+	// Invalid requests are rejected by createBlockVolume.
+	_, volSizeMB, err := common.GetVolumeSizeFromCapacityRange(ctx, req.GetCapacityRange())
+	if err != nil {
+		return c.createBlockVolume(ctx, req)
+	}
+	scParams, err := common.ParseStorageClassParams(ctx, req.Parameters,
+		commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.CSIMigration))
+	if err != nil || scParams.DryRun {
+		return c.createBlockVolume(ctx, req)
+	}
+	name := common.GetCnsVolumeName(scParams, req.Name)
+
+	namespaceQuotas.mutex.Lock()
+	if err := namespaceQuotas.refresh(ctx, c.manager.VolumeManager, c.manager.CnsConfig.Global.ClusterID); err != nil {
+		namespaceQuotas.mutex.Unlock()
+		return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to compute the usage of namespace %q. Error: %+v", namespace, err)
+	}
+	reserved, err := namespaceQuotas.reserve(ctx, name, namespace, volSizeMB)
+	namespaceQuotas.mutex.Unlock()
+	if err != nil {
+		return nil, csifault.CSIResourceExhaustedFault, err
+	}
+
+	resp, faultType, err := c.createBlockVolume(ctx, req)
+	if reserved {
+		var volumeID string
+		if err == nil {
+			volumeID = resp.GetVolume().GetVolumeId()
+		}
+		namespaceQuotas.commit(name, volumeID)
+	}
+	return resp, faultType, err
+}
@@ -0,0 +1,304 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vanilla
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	"github.com/vmware/govmomi/vim25/types"
+	"google.golang.org/grpc/codes"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cnsvolume "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/volume"
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/vsphere"
+	csifault "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/fault"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common/commonco"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+	k8s "sigs.k8s.io/vsphere-csi-driver/v3/pkg/kubernetes"
+)
+
+// softDeleteReconcileInterval is the interval between two passes of the
+// reconciler destroying the soft deleted volumes whose retention window has
+// elapsed.
+const softDeleteReconcileInterval = 5 * time.Minute
+
+// getDeletionRetention returns the deletion retention window recorded in the
+// FCD metadata of the block volume, 0 if none was recorded. Volumes whose
+// metadata cannot be recorded, i.e. when the vCenter does not serve the vslm
+// endpoint, have no window. An error is returned if the window cannot be
+// determined, so that a volume is never destroyed before its window elapsed.
+func getDeletionRetention(ctx context.Context, volumeManager cnsvolume.Manager,
+	volumeID string) (time.Duration, error) {
+	metadata, err := volumeManager.RetrieveVStorageObjectMetadata(ctx, volumeID, common.DeletionRetentionMetadataKey)
+	if err != nil {
+		if cnsvsphere.IsNotFoundError(err) || errors.Is(err, cnsvsphere.ErrNotSupported) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	for _, kv := range metadata {
+		if kv.Key != common.DeletionRetentionMetadataKey {
+			continue
+		}
+		retentionMinutes, err := strconv.ParseInt(kv.Value, 10, 64)
+		if err != nil || retentionMinutes < 0 {
+			return 0, fmt.Errorf("invalid deletion retention %q recorded for volume %q", kv.Value, volumeID)
+		}
+		return time.Duration(retentionMinutes) * time.Minute, nil
+	}
+	return 0, nil
+}
+
+// getPVOfVolume returns the PV referencing the volume, nil if there is none.
+// It is a variable so that unit tests can stub the lookup of the PV.
+var getPVOfVolume = func(ctx context.Context, volumeID string) (*v1.PersistentVolume, error) {
+	pvName, found := commonco.ContainerOrchestratorUtility.GetPVNameFromCSIVolumeID(volumeID)
+	if !found {
+		return nil, nil
+	}
+	k8sClient, err := k8s.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pv, err := k8sClient.CoreV1().PersistentVolumes().Get(ctx, pvName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if pv.Spec.CSI == nil || pv.Spec.CSI.VolumeHandle != volumeID {
+		return nil, nil
+	}
+	return pv, nil
+}
+
+// softDeleteVolume marks the block volume as deleted in its CNS metadata
+// instead of destroying it. The disk is destroyed by
+// reconcileSoftDeletedVolumes once the retention window has elapsed, unless
+// the volume is reclaimed in the meantime. As the mark is held by CNS, the
+// window is honored across restarts of the controller.
+func (c *controller) softDeleteVolume(ctx context.Context, volumeManager cnsvolume.Manager, vcHost string,
+	volumeID string, retention time.Duration) (string, error) {
+	log := logger.GetLogger(ctx)
+	clusterID := c.manager.CnsConfig.Global.ClusterID
+	queryResult, err := volumeManager.QueryVolume(ctx, cnstypes.CnsQueryFilter{
+		VolumeIds: []cnstypes.CnsVolumeId{{Id: volumeID}},
+	})
+	if err != nil {
+		return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to query volume %q. Error: %+v", volumeID, err)
+	}
+	if len(queryResult.Volumes) == 0 {
+		log.Infof("volume %q not found, assuming it is deleted", volumeID)
+		return "", nil
+	}
+	volume := queryResult.Volumes[0]
+	if common.GetSoftDeletedEntityMetadata(&volume, clusterID) != nil {
+		log.Infof("volume %q is already soft deleted", volumeID)
+		return "", nil
+	}
+	// The PV being deleted is recorded, so that the volume is only considered
+	// reclaimed once another PV, even of the same name, references it.
+	pv, err := getPVOfVolume(ctx, volumeID)
+	if err != nil {
+		return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to get the PV of volume %q. Error: %+v", volumeID, err)
+	}
+
+	// Mark the PV entity of the volume, so that the volume is not reported as
+	// orphaned by the full sync once the PV is deleted.
+	entityName := volume.Name
+	labels := make(map[string]string)
+	for _, metadata := range volume.Metadata.EntityMetadata {
+		k8sMetadata, ok := metadata.(*cnstypes.CnsKubernetesEntityMetadata)
+		if ok && k8sMetadata.ClusterID == clusterID &&
+			k8sMetadata.EntityType == string(cnstypes.CnsKubernetesEntityTypePV) {
+			entityName = k8sMetadata.EntityName
+			for _, label := range k8sMetadata.Labels {
+				labels[label.Key] = label.Value
+			}
+			break
+		}
+	}
+	deleteAfter := time.Now().Add(retention).UTC()
+	labels[common.SoftDeletedLabel] = "true"
+	labels[common.DeleteAfterLabel] = deleteAfter.Format(time.RFC3339)
+	if pv != nil {
+		labels[common.SoftDeletedPVUIDLabel] = string(pv.UID)
+	}
+	pvMetadata := cnsvsphere.GetCnsKubernetesEntityMetaData(entityName, labels, false,
+		string(cnstypes.CnsKubernetesEntityTypePV), "", clusterID, nil)
+	if err := c.updatePVEntityMetadata(ctx, volumeManager, vcHost, volumeID, pvMetadata); err != nil {
+		return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to mark volume %q as soft deleted. Error: %+v", volumeID, err)
+	}
+	log.Infof("Volume %q is soft deleted, its disk will be destroyed after %v", volumeID,
+		deleteAfter.Format(time.RFC3339))
+	return "", nil
+}
+
+// updatePVEntityMetadata updates the given PV entity metadata of the volume.
+func (c *controller) updatePVEntityMetadata(ctx context.Context, volumeManager cnsvolume.Manager, vcHost string,
+	volumeID string, pvMetadata *cnstypes.CnsKubernetesEntityMetadata) error {
+	containerCluster := cnsvsphere.GetContainerCluster(c.manager.CnsConfig.Global.ClusterID,
+		c.manager.CnsConfig.VirtualCenter[vcHost].User, cnstypes.CnsClusterFlavorVanilla,
+		c.manager.CnsConfig.Global.ClusterDistribution)
+	return volumeManager.UpdateVolumeMetadata(ctx, &cnstypes.CnsVolumeMetadataUpdateSpec{
+		VolumeId: cnstypes.CnsVolumeId{Id: volumeID},
+		Metadata: cnstypes.CnsVolumeMetadata{
+			ContainerCluster:      containerCluster,
+			ContainerClusterArray: []cnstypes.CnsContainerCluster{containerCluster},
+			EntityMetadata:        []cnstypes.BaseCnsEntityMetadata{pvMetadata},
+		},
+	})
+}
+
+// reconcileSoftDeletedVolumes periodically destroys the soft deleted volumes
+// whose retention window has elapsed, until ctx is cancelled. It runs on the
+// elected controller replica only, see runOnLeader.
+func (c *controller) reconcileSoftDeletedVolumes(ctx context.Context) {
+	ticker := time.NewTicker(softDeleteReconcileInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.reconcileSoftDeletedVolumesOnce(ctx)
+		}
+	}
+}
+
+// reconcileSoftDeletedVolumesOnce destroys the soft deleted volumes whose
+// retention window has elapsed. Volumes which have been reclaimed, i.e. which
+// are referenced by another PV of the cluster, are unmarked instead. Volumes
+// whose state cannot be determined are kept until the next pass.
+func (c *controller) reconcileSoftDeletedVolumesOnce(ctx context.Context) {
+	log := logger.GetLogger(ctx)
+	clusterID := c.manager.CnsConfig.Global.ClusterID
+	vcHost := c.manager.VcenterConfig.Host
+	volumeManager := c.manager.VolumeManager
+	queryResult, err := volumeManager.QueryVolume(ctx, cnstypes.CnsQueryFilter{
+		ContainerClusterIds: []string{clusterID},
+		Labels:              []types.KeyValue{{Key: common.SoftDeletedLabel, Value: "true"}},
+	})
+	if err != nil {
+		log.Errorf("failed to query soft deleted volumes. Error: %+v", err)
+		return
+	}
+	for i := range queryResult.Volumes {
+		if ctx.Err() != nil {
+			return
+		}
+		volume := &queryResult.Volumes[i]
+		volumeID := volume.VolumeId.Id
+		softDeletedMetadata := common.GetSoftDeletedEntityMetadata(volume, clusterID)
+		if softDeletedMetadata == nil {
+			continue
+		}
+		pv, err := getPVOfVolume(ctx, volumeID)
+		if err != nil {
+			log.Errorf("failed to get the PV of soft deleted volume %q, skipping it. Error: %+v", volumeID, err)
+			continue
+		}
+		if isVolumeReclaimed(softDeletedMetadata, pv) {
+			log.Infof("Soft deleted volume %q has been reclaimed by PV %q, removing its soft delete mark",
+				volumeID, pv.Name)
+			if err := c.updatePVEntityMetadata(ctx, volumeManager, vcHost, volumeID,
+				getReclaimedPVMetadata(softDeletedMetadata, pv, clusterID)); err != nil {
+				log.Errorf("failed to remove soft delete mark of volume %q. Error: %+v", volumeID, err)
+			}
+			continue
+		}
+		deleteAfter, err := getSoftDeleteDeadline(softDeletedMetadata)
+		if err != nil {
+			log.Errorf("failed to get the retention window of soft deleted volume %q, skipping it. Error: %+v",
+				volumeID, err)
+			continue
+		}
+		if time.Now().Before(deleteAfter) {
+			continue
+		}
+		log.Infof("Retention window of soft deleted volume %q has elapsed, destroying it", volumeID)
+		if _, err := common.DeleteVolumeUtil(ctx, volumeManager, volumeID, true); err != nil {
+			log.Errorf("failed to destroy soft deleted volume %q. Error: %+v", volumeID, err)
+		}
+	}
+}
+
+// getSoftDeleteDeadline returns the time after which the disk of the soft
+// deleted volume is destroyed.
+func getSoftDeleteDeadline(softDeletedMetadata *cnstypes.CnsKubernetesEntityMetadata) (time.Time, error) {
+	for _, label := range softDeletedMetadata.Labels {
+		if label.Key == common.DeleteAfterLabel {
+			deleteAfter, err := time.Parse(time.RFC3339, label.Value)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid %s label %q", common.DeleteAfterLabel, label.Value)
+			}
+			return deleteAfter, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("missing %s label", common.DeleteAfterLabel)
+}
+
+// isVolumeReclaimed returns true if the volume is referenced by a PV other
+// than the soft deleted one. PVs are compared by UID, as the volume may be
+// reclaimed by a PV of the same name, e.g. when the PV is restored.
+func isVolumeReclaimed(softDeletedMetadata *cnstypes.CnsKubernetesEntityMetadata, pv *v1.PersistentVolume) bool {
+	if pv == nil {
+		return false
+	}
+	for _, label := range softDeletedMetadata.Labels {
+		if label.Key == common.SoftDeletedPVUIDLabel {
+			return label.Value != string(pv.UID)
+		}
+	}
+	// The soft deleted PV was not known, the PV referencing the volume cannot
+	// be the one being deleted.
+	return true
+}
+
+// getReclaimedPVMetadata returns the PV entity metadata removing the soft
+// delete mark of the volume reclaimed by the given PV. The entity of the soft
+// deleted PV is kept without the soft delete labels if the PV is of the same
+// name, and removed otherwise.
+func getReclaimedPVMetadata(softDeletedMetadata *cnstypes.CnsKubernetesEntityMetadata, pv *v1.PersistentVolume,
+	clusterID string) *cnstypes.CnsKubernetesEntityMetadata {
+	if softDeletedMetadata.EntityName != pv.Name {
+		return cnsvsphere.GetCnsKubernetesEntityMetaData(softDeletedMetadata.EntityName, nil, true,
+			string(cnstypes.CnsKubernetesEntityTypePV), "", clusterID, nil)
+	}
+	labels := make(map[string]string)
+	for _, label := range softDeletedMetadata.Labels {
+		switch label.Key {
+		case common.SoftDeletedLabel, common.DeleteAfterLabel, common.SoftDeletedPVUIDLabel:
+		default:
+			labels[label.Key] = label.Value
+		}
+	}
+	return cnsvsphere.GetCnsKubernetesEntityMetaData(pv.Name, labels, false,
+		string(cnstypes.CnsKubernetesEntityTypePV), "", clusterID, nil)
+}
@@ -0,0 +1,531 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vanilla
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/types"
+	k8s "sigs.k8s.io/vsphere-csi-driver/v3/pkg/kubernetes"
+)
+
+const (
+	// annMigrateToStorageClass is set on a PV by an admin to copy the data of
+	// its volume to a new volume in the storage policy of the given
+	// StorageClass, e.g. to move the PVC to another storage tier.
+	annMigrateToStorageClass = "cns.vmware.com/migrate-to-storage-class"
+	// annStoragePolicyMigration records the state of the migration requested
+	// using annMigrateToStorageClass as JSON, so that the migration resumes
+	// from its last completed step after a restart of the controller.
+	annStoragePolicyMigration = "cns.vmware.com/storage-policy-migration"
+	// storagePolicyMigrationInterval is the interval at which the migrations
+	// requested on PVs are reconciled.
+	storagePolicyMigrationInterval = time.Minute
+
+	// The volume of the PV has been snapshotted.
+	migrationPhaseSnapshotCreated = "SnapshotCreated"
+	// The target volume has been created from the snapshot.
+	migrationPhaseVolumeCreated = "VolumeCreated"
+	// The target PV has been created, waiting for a PVC of the workload to be
+	// bound to it.
+	migrationPhaseAwaitingSwitchover = "AwaitingSwitchover"
+	// The workload switched over to the target PV and the snapshot has been
+	// deleted, waiting for the PVC of the source PV to be deleted. The source
+	// volume and PV are then deleted, which completes the migration.
+	migrationPhaseSwitchedOver = "SwitchedOver"
+	// The migration failed. The request annotation must be set again to retry.
+	migrationPhaseFailed = "Failed"
+
+	// kubernetesParamPrefix is the prefix of the StorageClass parameters
+	// interpreted by the external-provisioner, which are not passed to the
+	// driver.
+	kubernetesParamPrefix = "csi.storage.k8s.io/"
+)
+
+// storagePolicyMigration is the state of the migration of the volume of a PV
+// to the storage policy of another StorageClass.
+type storagePolicyMigration struct {
+	StorageClass string `json:"storageClass"`
+	Phase        string `json:"phase,omitempty"`
+	// SnapshotID is the CSI ID of the intermediate snapshot of the volume.
+	SnapshotID string `json:"snapshotID,omitempty"`
+	// TargetVolumeID is the ID of the volume created from the snapshot.
+	TargetVolumeID      string              `json:"targetVolumeID,omitempty"`
+	TargetVolumeContext map[string]string   `json:"targetVolumeContext,omitempty"`
+	TargetTopology      []map[string]string `json:"targetTopology,omitempty"`
+	TargetPV            string              `json:"targetPV,omitempty"`
+	Message             string              `json:"message,omitempty"`
+}
+
+// reconcileStoragePolicyMigrations periodically runs the migrations of
+// volumes to the storage policy of another StorageClass requested on PVs,
+// until ctx is cancelled. It runs on the elected controller replica only, see
+// runOnLeader.
+func (c *controller) reconcileStoragePolicyMigrations(ctx context.Context) {
+	log := logger.GetLogger(ctx)
+	ticker := time.NewTicker(storagePolicyMigrationInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			k8sClient, err := k8s.NewClient(ctx)
+			if err != nil {
+				log.Errorf("failed to create k8s client to reconcile storage policy migrations. Error: %+v", err)
+				continue
+			}
+			reconcileStoragePolicyMigrationsOnce(ctx, c, k8sClient)
+		}
+	}
+}
+
+// reconcileStoragePolicyMigrationsOnce runs the pending steps of the
+// migrations requested on PVs, using the given controller server. A migration
+// failing with a terminal error is cleaned up and recorded as failed, other
+// errors are recorded and the step is retried on the next pass.
+func reconcileStoragePolicyMigrationsOnce(ctx context.Context, controllerServer csi.ControllerServer,
+	k8sClient kubernetes.Interface) {
+	log := logger.GetLogger(ctx)
+	pvList, err := k8sClient.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		log.Errorf("failed to list PVs to reconcile storage policy migrations. Error: %+v", err)
+		return
+	}
+	for i := range pvList.Items {
+		if ctx.Err() != nil {
+			return
+		}
+		pv := &pvList.Items[i]
+		storageClass := strings.TrimSpace(pv.Annotations[annMigrateToStorageClass])
+		if storageClass == "" || pv.Spec.CSI == nil || pv.Spec.CSI.Driver != csitypes.Name ||
+			pv.DeletionTimestamp != nil {
+			continue
+		}
+		migration := &storagePolicyMigration{}
+		if state := pv.Annotations[annStoragePolicyMigration]; state != "" {
+			if err := json.Unmarshal([]byte(state), migration); err != nil {
+				log.Errorf("failed to parse storage policy migration state %q of PV %q. Error: %+v",
+					state, pv.Name, err)
+				continue
+			}
+		}
+		if migration.StorageClass != storageClass {
+			// A new migration is requested, the state of the previous one is
+			// discarded.
+			migration = &storagePolicyMigration{StorageClass: storageClass}
+		}
+		if migration.Phase == migrationPhaseFailed {
+			continue
+		}
+		save := func(migration *storagePolicyMigration) error {
+			return patchPVStoragePolicyMigration(ctx, k8sClient, pv.Name, migration)
+		}
+		err := migrateVolumeStoragePolicy(ctx, controllerServer, k8sClient, pv, migration, save)
+		if err == nil {
+			continue
+		}
+		if isTerminalMigrationError(err) {
+			log.Errorf("Storage policy migration of PV %q to StorageClass %q failed. Error: %+v",
+				pv.Name, storageClass, err)
+			cleanupStoragePolicyMigration(ctx, controllerServer, k8sClient, migration)
+			migration.Phase = migrationPhaseFailed
+		} else {
+			log.Warnf("Storage policy migration of PV %q to StorageClass %q will be retried. Error: %+v",
+				pv.Name, storageClass, err)
+		}
+		migration.Message = err.Error()
+		if err := save(migration); err != nil {
+			log.Errorf("failed to record storage policy migration state of PV %q. Error: %+v", pv.Name, err)
+		}
+	}
+}
+
+// terminalMigrationError is an error of a migration which cannot succeed
+// when retried.
+type terminalMigrationError struct {
+	err error
+}
+
+func (e *terminalMigrationError) Error() string {
+	return e.err.Error()
+}
+
+func (e *terminalMigrationError) Unwrap() error {
+	return e.err
+}
+
+// isTerminalMigrationError returns true if the migration failed with an error
+// which cannot be resolved by retrying the failed step, i.e. an invalid
+// request or a gRPC error of the driver which is not transient.
+func isTerminalMigrationError(err error) bool {
+	var terminalErr *terminalMigrationError
+	if errors.As(err, &terminalErr) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.PermissionDenied,
+		codes.FailedPrecondition, codes.OutOfRange, codes.Unimplemented:
+		return true
+	}
+	return false
+}
+
+// migrateVolumeStoragePolicy runs the pending steps of the migration of the
+// volume of the PV. The volume is snapshotted once it is no longer attached,
+// so that no write of the workload is lost, and a new volume is created from
+// the snapshot in the storage policy of the target StorageClass, and exposed
+// as a new PV for the workload to switch over to, e.g. by binding a new PVC to
+// it. The snapshot is deleted once the new PV is bound, and the source volume
+// and PV once the PVC of the source PV is deleted. The state is saved after
+// each step, so that the migration can be resumed, and the steps are
+// idempotent. It is up to the caller to clean up a failed migration.
+func migrateVolumeStoragePolicy(ctx context.Context, controllerServer csi.ControllerServer,
+	k8sClient kubernetes.Interface, pv *v1.PersistentVolume, migration *storagePolicyMigration,
+	save func(*storagePolicyMigration) error) error {
+	log := logger.GetLogger(ctx)
+	volumeID := pv.Spec.CSI.VolumeHandle
+	if strings.HasPrefix(volumeID, "file:") {
+		return &terminalMigrationError{
+			err: fmt.Errorf("volume %q is a file volume, only block volumes can be migrated", volumeID),
+		}
+	}
+	storageClass, err := k8sClient.StorageV1().StorageClasses().Get(ctx, migration.StorageClass,
+		metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return &terminalMigrationError{err: fmt.Errorf("StorageClass %q not found", migration.StorageClass)}
+		}
+		return fmt.Errorf("failed to get StorageClass %q: %w", migration.StorageClass, err)
+	}
+	if storageClass.Provisioner != csitypes.Name {
+		return &terminalMigrationError{
+			err: fmt.Errorf("StorageClass %q is not provisioned by %s", storageClass.Name, csitypes.Name),
+		}
+	}
+	targetName := "migrated-" + pv.Name
+
+	if migration.Phase == "" {
+		nodeName, err := getPVAttachedNode(ctx, k8sClient, pv.Name)
+		if err != nil {
+			return err
+		}
+		if nodeName != "" {
+			return fmt.Errorf("PV %q is attached to node %q, the workload must be stopped for its volume to "+
+				"be migrated", pv.Name, nodeName)
+		}
+		log.Infof("Migrating volume %q of PV %q to StorageClass %q, creating snapshot", volumeID, pv.Name,
+			storageClass.Name)
+		resp, err := controllerServer.CreateSnapshot(ctx, &csi.CreateSnapshotRequest{
+			SourceVolumeId: volumeID,
+			Name:           targetName,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to snapshot volume %q: %w", volumeID, err)
+		}
+		migration.SnapshotID = resp.Snapshot.SnapshotId
+		migration.Phase = migrationPhaseSnapshotCreated
+		migration.Message = ""
+		if err := save(migration); err != nil {
+			return err
+		}
+	}
+
+	if migration.Phase == migrationPhaseSnapshotCreated {
+		log.Infof("Creating volume %q from snapshot %q in StorageClass %q", targetName, migration.SnapshotID,
+			storageClass.Name)
+		resp, err := controllerServer.CreateVolume(ctx, &csi.CreateVolumeRequest{
+			Name: targetName,
+			CapacityRange: &csi.CapacityRange{
+				RequiredBytes: pv.Spec.Capacity.Storage().Value(),
+			},
+			VolumeCapabilities: getPVVolumeCapabilities(pv),
+			Parameters:         getMigrationCreateVolumeParams(storageClass, pv, targetName),
+			VolumeContentSource: &csi.VolumeContentSource{
+				Type: &csi.VolumeContentSource_Snapshot{
+					Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: migration.SnapshotID},
+				},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create volume from snapshot %q: %w", migration.SnapshotID, err)
+		}
+		migration.TargetVolumeID = resp.Volume.VolumeId
+		migration.TargetVolumeContext = resp.Volume.VolumeContext
+		migration.TargetTopology = nil
+		for _, topology := range resp.Volume.AccessibleTopology {
+			migration.TargetTopology = append(migration.TargetTopology, topology.Segments)
+		}
+		migration.Phase = migrationPhaseVolumeCreated
+		if err := save(migration); err != nil {
+			return err
+		}
+	}
+
+	if migration.Phase == migrationPhaseVolumeCreated {
+		targetPV := getMigrationTargetPV(pv, storageClass, targetName, migration)
+		_, err := k8sClient.CoreV1().PersistentVolumes().Create(ctx, targetPV, metav1.CreateOptions{})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create PV %q for volume %q: %w", targetName, migration.TargetVolumeID, err)
+		}
+		log.Infof("Created PV %q for volume %q migrated from PV %q, waiting for the workload to switch over",
+			targetName, migration.TargetVolumeID, pv.Name)
+		migration.TargetPV = targetName
+		migration.Phase = migrationPhaseAwaitingSwitchover
+		if err := save(migration); err != nil {
+			return err
+		}
+	}
+
+	if migration.Phase == migrationPhaseAwaitingSwitchover {
+		targetPV, err := k8sClient.CoreV1().PersistentVolumes().Get(ctx, migration.TargetPV, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return &terminalMigrationError{err: fmt.Errorf("PV %q not found", migration.TargetPV)}
+			}
+			return fmt.Errorf("failed to get PV %q: %w", migration.TargetPV, err)
+		}
+		if targetPV.Status.Phase != v1.VolumeBound {
+			log.Debugf("PV %q migrated from PV %q is not bound yet", targetPV.Name, pv.Name)
+			return nil
+		}
+		if err := deleteMigrationSnapshot(ctx, controllerServer, migration); err != nil {
+			return err
+		}
+		log.Infof("Workload switched over to PV %q, waiting for the PVC of PV %q to be deleted",
+			targetPV.Name, pv.Name)
+		migration.Phase = migrationPhaseSwitchedOver
+		if err := save(migration); err != nil {
+			return err
+		}
+	}
+
+	if migration.Phase == migrationPhaseSwitchedOver {
+		if pv.Status.Phase == v1.VolumeBound {
+			log.Debugf("PV %q migrated to PV %q is still bound", pv.Name, migration.TargetPV)
+			return nil
+		}
+		_, err := controllerServer.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: volumeID})
+		if err != nil && status.Code(err) != codes.NotFound {
+			return fmt.Errorf("failed to delete volume %q: %w", volumeID, err)
+		}
+		err = k8sClient.CoreV1().PersistentVolumes().Delete(ctx, pv.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete PV %q: %w", pv.Name, err)
+		}
+		log.Infof("Deleted volume %q and PV %q, storage policy migration to PV %q is complete",
+			volumeID, pv.Name, migration.TargetPV)
+	}
+	return nil
+}
+
+// getPVAttachedNode returns the node the PV is attached to, or an empty
+// string if the PV is not attached.
+func getPVAttachedNode(ctx context.Context, k8sClient kubernetes.Interface, pvName string) (string, error) {
+	vaList, err := k8sClient.StorageV1().VolumeAttachments().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to list VolumeAttachments: %w", err)
+	}
+	for _, va := range vaList.Items {
+		if va.Spec.Source.PersistentVolumeName != nil && *va.Spec.Source.PersistentVolumeName == pvName {
+			return va.Spec.NodeName, nil
+		}
+	}
+	return "", nil
+}
+
+// cleanupStoragePolicyMigration deletes the intermediate snapshot of a failed
+// migration, and the target volume and PV unless the workload switched over
+// to the target PV.
+func cleanupStoragePolicyMigration(ctx context.Context, controllerServer csi.ControllerServer,
+	k8sClient kubernetes.Interface, migration *storagePolicyMigration) {
+	log := logger.GetLogger(ctx)
+	if migration.TargetPV != "" {
+		targetPV, err := k8sClient.CoreV1().PersistentVolumes().Get(ctx, migration.TargetPV, metav1.GetOptions{})
+		switch {
+		case err == nil && targetPV.Status.Phase == v1.VolumeBound:
+			log.Infof("Keeping PV %q of failed storage policy migration as it is bound", migration.TargetPV)
+		case err == nil || apierrors.IsNotFound(err):
+			err = k8sClient.CoreV1().PersistentVolumes().Delete(ctx, migration.TargetPV, metav1.DeleteOptions{})
+			if err == nil || apierrors.IsNotFound(err) {
+				migration.TargetPV = ""
+			} else {
+				log.Errorf("failed to delete PV %q of failed storage policy migration. Error: %+v",
+					migration.TargetPV, err)
+			}
+		default:
+			log.Errorf("failed to get PV %q of failed storage policy migration. Error: %+v",
+				migration.TargetPV, err)
+		}
+	}
+	if migration.TargetVolumeID != "" && migration.TargetPV == "" {
+		_, err := controllerServer.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: migration.TargetVolumeID})
+		if err != nil {
+			log.Errorf("failed to delete volume %q of failed storage policy migration. Error: %+v",
+				migration.TargetVolumeID, err)
+		} else {
+			migration.TargetVolumeID = ""
+		}
+	}
+	if err := deleteMigrationSnapshot(ctx, controllerServer, migration); err != nil {
+		log.Errorf("failed to clean up storage policy migration. Error: %+v", err)
+	}
+}
+
+// deleteMigrationSnapshot deletes the intermediate snapshot of the migration.
+func deleteMigrationSnapshot(ctx context.Context, controllerServer csi.ControllerServer,
+	migration *storagePolicyMigration) error {
+	if migration.SnapshotID == "" {
+		return nil
+	}
+	_, err := controllerServer.DeleteSnapshot(ctx, &csi.DeleteSnapshotRequest{SnapshotId: migration.SnapshotID})
+	if err != nil {
+		return fmt.Errorf("failed to delete snapshot %q: %w", migration.SnapshotID, err)
+	}
+	migration.SnapshotID = ""
+	return nil
+}
+
+// getPVVolumeCapabilities returns the CSI volume capabilities matching the
+// access modes and volume mode of the PV.
+func getPVVolumeCapabilities(pv *v1.PersistentVolume) []*csi.VolumeCapability {
+	var capabilities []*csi.VolumeCapability
+	for _, accessMode := range pv.Spec.AccessModes {
+		capability := &csi.VolumeCapability{AccessMode: &csi.VolumeCapability_AccessMode{}}
+		switch accessMode {
+		case v1.ReadWriteMany:
+			capability.AccessMode.Mode = csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER
+		case v1.ReadOnlyMany:
+			capability.AccessMode.Mode = csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY
+		case v1.ReadWriteOncePod:
+			capability.AccessMode.Mode = csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER
+		default:
+			capability.AccessMode.Mode = csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER
+		}
+		if pv.Spec.VolumeMode != nil && *pv.Spec.VolumeMode == v1.PersistentVolumeBlock {
+			capability.AccessType = &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}}
+		} else {
+			capability.AccessType = &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{FsType: pv.Spec.CSI.FSType},
+			}
+		}
+		capabilities = append(capabilities, capability)
+	}
+	return capabilities
+}
+
+// getMigrationCreateVolumeParams returns the parameters of the CreateVolume
+// request of the target volume of the migration of the PV, i.e. the
+// parameters of the StorageClass with the metadata of the PVC of the PV.
+func getMigrationCreateVolumeParams(storageClass *storagev1.StorageClass, pv *v1.PersistentVolume,
+	targetName string) map[string]string {
+	params := make(map[string]string)
+	for key, value := range storageClass.Parameters {
+		if !strings.HasPrefix(strings.ToLower(key), kubernetesParamPrefix) {
+			params[key] = value
+		}
+	}
+	params[common.AttributePvName] = targetName
+	if pv.Spec.ClaimRef != nil {
+		params[common.AttributePvcName] = pv.Spec.ClaimRef.Name
+		params[common.AttributePvcNamespace] = pv.Spec.ClaimRef.Namespace
+	}
+	return params
+}
+
+// getMigrationTargetPV returns the PV of the target volume of the migration
+// of the PV. The PV is not bound, so that a new PVC of the workload can be
+// bound to it.
+func getMigrationTargetPV(pv *v1.PersistentVolume, storageClass *storagev1.StorageClass, targetName string,
+	migration *storagePolicyMigration) *v1.PersistentVolume {
+	targetPV := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        targetName,
+			Annotations: map[string]string{"pv.kubernetes.io/provisioned-by": csitypes.Name},
+		},
+		Spec: v1.PersistentVolumeSpec{
+			Capacity:                      pv.Spec.Capacity,
+			AccessModes:                   pv.Spec.AccessModes,
+			VolumeMode:                    pv.Spec.VolumeMode,
+			MountOptions:                  pv.Spec.MountOptions,
+			PersistentVolumeReclaimPolicy: pv.Spec.PersistentVolumeReclaimPolicy,
+			StorageClassName:              storageClass.Name,
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{
+					Driver:           csitypes.Name,
+					VolumeHandle:     migration.TargetVolumeID,
+					FSType:           pv.Spec.CSI.FSType,
+					VolumeAttributes: migration.TargetVolumeContext,
+				},
+			},
+		},
+	}
+	var terms []v1.NodeSelectorTerm
+	for _, segments := range migration.TargetTopology {
+		var expressions []v1.NodeSelectorRequirement
+		for key, value := range segments {
+			expressions = append(expressions, v1.NodeSelectorRequirement{
+				Key:      key,
+				Operator: v1.NodeSelectorOpIn,
+				Values:   []string{value},
+			})
+		}
+		terms = append(terms, v1.NodeSelectorTerm{MatchExpressions: expressions})
+	}
+	if len(terms) != 0 {
+		targetPV.Spec.NodeAffinity = &v1.VolumeNodeAffinity{Required: &v1.NodeSelector{NodeSelectorTerms: terms}}
+	}
+	return targetPV
+}
+
+// patchPVStoragePolicyMigration records the state of the storage policy
+// migration of the PV in its annotation.
+func patchPVStoragePolicyMigration(ctx context.Context, k8sClient kubernetes.Interface, pvName string,
+	migration *storagePolicyMigration) error {
+	state, err := json.Marshal(migration)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{annStoragePolicyMigration: string(state)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = k8sClient.CoreV1().PersistentVolumes().Patch(ctx, pvName, apitypes.MergePatchType, patch,
+		metav1.PatchOptions{})
+	return err
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vanilla
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+
+	commoncotypes "sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common/commonco/types"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+	csinodetopologyv1alpha1 "sigs.k8s.io/vsphere-csi-driver/v3/pkg/internalapis/csinodetopology/v1alpha1"
+)
+
+// topologyDebugPath is the path of the debug endpoint dumping the topology
+// caches of the controller.
+const topologyDebugPath = "/debug/topology"
+
+// topologyDebugDump is the response of the topology debug endpoint.
+type topologyDebugDump struct {
+	*commoncotypes.TopologyCacheDump
+	// DatastoreAccessibility lists the datastores accessible from all the
+	// nodes of each topology segment of the nodes. It is only computed, from
+	// vCenter, if the datastores query parameter is set to true.
+	DatastoreAccessibility []segmentDatastores `json:"datastoreAccessibility,omitempty"`
+}
+
+// segmentDatastores holds the URLs of the datastores accessible from all the
+// nodes of a topology segment.
+type segmentDatastores struct {
+	Segment       map[string]string `json:"segment"`
+	DatastoreURLs []string          `json:"datastoreUrls"`
+	Error         string            `json:"error,omitempty"`
+}
+
+// startTopologyDebugServer serves the topology debug endpoint on localhost
+// in the background. The caches are read on every request, so that the dump
+// reflects their live state.
+func (c *controller) startTopologyDebugServer(ctx context.Context, port int) {
+	log := logger.GetLogger(ctx)
+	if port <= 0 || port > 65535 {
+		log.Errorf("Topology debug endpoint is disabled, invalid port %d", port)
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(topologyDebugPath, c.dumpTopology)
+	server := &http.Server{
+		Addr:              net.JoinHostPort("127.0.0.1", strconv.Itoa(port)),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		for {
+			log.Infof("Starting the topology debug endpoint on %s%s", server.Addr, topologyDebugPath)
+			err := server.ListenAndServe()
+			log.Warnf("Topology debug endpoint exited with err: %+v, restarting", err)
+			time.Sleep(time.Minute)
+		}
+	}()
+}
+
+// dumpTopology writes the topology caches of the controller as JSON.
+func (c *controller) dumpTopology(w http.ResponseWriter, r *http.Request) {
+	ctx, log := logger.GetNewContextWithLogger()
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	dumper, ok := c.topologyMgr.(commoncotypes.TopologyCacheDumper)
+	if !ok {
+		http.Error(w, "topology caches cannot be dumped in this deployment", http.StatusNotImplemented)
+		return
+	}
+	dump := topologyDebugDump{TopologyCacheDump: dumper.DumpTopologyCache(ctx)}
+	if strings.EqualFold(r.URL.Query().Get("datastores"), "true") {
+		dump.DatastoreAccessibility = c.getSegmentDatastores(ctx, getNodeTopologySegments(dump.Nodes))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(dump); err != nil {
+		log.Errorf("Topology debug endpoint: failed to write the topology caches. Err: %v", err)
+	}
+}
+
+// getSegmentDatastores returns the datastores accessible from all the nodes
+// of each of the given topology segments, as computed for provisioning.
+func (c *controller) getSegmentDatastores(ctx context.Context,
+	segments []map[string]string) []segmentDatastores {
+	accessibility := make([]segmentDatastores, 0, len(segments))
+	vc, err := c.manager.VcenterManager.GetVirtualCenter(ctx, c.manager.VcenterConfig.Host)
+	for _, segment := range segments {
+		entry := segmentDatastores{Segment: segment, DatastoreURLs: []string{}}
+		if err != nil {
+			entry.Error = err.Error()
+			accessibility = append(accessibility, entry)
+			continue
+		}
+		topology := []*csi.Topology{{Segments: segment}}
+		datastores, dsErr := c.topologyMgr.GetSharedDatastoresInTopology(ctx,
+			commoncotypes.VanillaTopologyFetchDSParams{
+				TopologyRequirement: &csi.TopologyRequirement{Requisite: topology},
+				Vc:                  vc,
+			})
+		if dsErr != nil {
+			entry.Error = dsErr.Error()
+		}
+		for _, ds := range datastores {
+			entry.DatastoreURLs = append(entry.DatastoreURLs, ds.Info.Url)
+		}
+		slices.Sort(entry.DatastoreURLs)
+		accessibility = append(accessibility, entry)
+	}
+	return accessibility
+}
+
+// getNodeTopologySegments returns the distinct topology segments of the nodes
+// whose topology was discovered successfully, sorted for a stable output.
+func getNodeTopologySegments(nodes map[string]commoncotypes.NodeTopologyDump) []map[string]string {
+	segments := make(map[string]map[string]string)
+	for _, node := range nodes {
+		if node.Status != string(csinodetopologyv1alpha1.CSINodeTopologySuccess) || len(node.TopologyLabels) == 0 {
+			continue
+		}
+		var labels []string
+		for key, value := range node.TopologyLabels {
+			labels = append(labels, key+"="+value)
+		}
+		slices.Sort(labels)
+		segments[strings.Join(labels, ",")] = node.TopologyLabels
+	}
+	keys := make([]string, 0, len(segments))
+	for key := range segments {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	sorted := make([]map[string]string, 0, len(keys))
+	for _, key := range keys {
+		sorted = append(sorted, segments[key])
+	}
+	return sorted
+}
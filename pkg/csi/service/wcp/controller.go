@@ -135,6 +135,19 @@ func (c *controller) Init(config *cnsconfig.Config, version string) error {
 		}
 	}
 
+	cnsvolume.SetTaskPollBackoff(ctx, cnsvolume.TaskPollBackoff{
+		InitialInterval: time.Duration(config.TaskPolling.InitialIntervalInMs) * time.Millisecond,
+		MaxInterval:     time.Duration(config.TaskPolling.MaxIntervalInMs) * time.Millisecond,
+		Multiplier:      config.TaskPolling.Multiplier,
+	})
+	cnsvolume.SetStuckTaskTimeout(ctx, time.Duration(config.TaskPolling.StuckTaskTimeoutInMin)*time.Minute)
+	cnsvolume.SetQueryVolumeCacheConfig(ctx, config.Global.QueryVolumeCacheTTLInSec,
+		config.Global.QueryVolumeCacheDisabled)
+	cnsvolume.SetAuditLogEnabled(ctx, config.Global.CnsAuditLogEnabled)
+	cnsvsphere.SetInventoryCallLimits(ctx,
+		time.Duration(config.Global.VCInventoryCallTimeoutInSec)*time.Second,
+		config.Global.VCInventoryCircuitBreakerThreshold)
+
 	// Get VirtualCenterManager instance and validate version.
 	vcenterconfig, err := cnsvsphere.GetVirtualCenterConfig(ctx, config)
 	if err != nil {
@@ -631,12 +644,10 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 		}
 	}
 
-	// Volume Size - Default is 10 GiB.
-	volSizeBytes := int64(common.DefaultGbDiskSize * common.GbInBytes)
-	if req.GetCapacityRange() != nil && req.GetCapacityRange().RequiredBytes != 0 {
-		volSizeBytes = int64(req.GetCapacityRange().GetRequiredBytes())
+	volSizeBytes, volSizeMB, err := common.GetVolumeSizeFromCapacityRange(ctx, req.GetCapacityRange())
+	if err != nil {
+		return nil, csifault.CSIInvalidArgumentFault, err
 	}
-	volSizeMB := int64(common.RoundUpSize(volSizeBytes, common.MbInBytes))
 	isBlockVolumeSnapshotEnabled := commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.BlockVolumeSnapshot)
 	// Check if requested volume size and source snapshot size matches
 	volumeSource := req.GetVolumeContentSource()
@@ -696,6 +707,19 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 		}
 	}
 
+	// The guest disk hints of the PVCs of VM service VMs are stored in CNS
+	// along with the volume, so that tooling can classify the disks.
+	var guestDiskHints map[string]string
+	if pvcName != "" && pvcNamespace != "" {
+		pvcAnnotations, err := commonco.ContainerOrchestratorUtility.GetPVCAnnotations(ctx, pvcName, pvcNamespace)
+		if err != nil {
+			log.Warnf("failed to get annotations of PVC %s/%s, guest disk hints are not stored. Error: %v",
+				pvcNamespace, pvcName, err)
+		} else {
+			guestDiskHints = common.GetGuestDiskHints(ctx, pvcAnnotations)
+		}
+	}
+
 	// Create CreateVolumeSpec and populate values.
 	var createVolumeSpec = common.CreateVolumeSpec{
 		CapacityMB:              volSizeMB,
@@ -707,6 +731,9 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 		VsanDatastoreURL:        selectedDatastoreURL,
 		ContentSourceSnapshotID: contentSourceSnapshotID,
 		CryptoKeyID:             cryptoKeyID,
+		PVCName:                 pvcName,
+		PVCNamespace:            pvcNamespace,
+		GuestDiskHints:          guestDiskHints,
 	}
 
 	createVolumeOpts := common.CreateBlockVolumeOptions{
@@ -910,12 +937,10 @@ func (c *controller) createFileVolume(ctx context.Context, req *csi.CreateVolume
 		faultType            string
 	)
 	topologyRequirement = req.AccessibilityRequirements
-	// Volume Size - Default is 10 GiB.
-	volSizeBytes := int64(common.DefaultGbDiskSize * common.GbInBytes)
-	if req.GetCapacityRange() != nil && req.GetCapacityRange().RequiredBytes != 0 {
-		volSizeBytes = int64(req.GetCapacityRange().GetRequiredBytes())
+	volSizeBytes, volSizeMB, err := common.GetVolumeSizeFromCapacityRange(ctx, req.GetCapacityRange())
+	if err != nil {
+		return nil, csifault.CSIInvalidArgumentFault, err
 	}
-	volSizeMB := int64(common.RoundUpSize(volSizeBytes, common.MbInBytes))
 
 	for paramName := range req.Parameters {
 		param := strings.ToLower(paramName)
@@ -1153,6 +1178,8 @@ func (c *controller) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequ
 
 	start := time.Now()
 	ctx = logger.NewContextWithLogger(ctx)
+	ctx = cnsvolume.ContextWithAuditRequester(ctx, req.Parameters[common.AttributePvcNamespace],
+		req.Parameters[common.AttributePvcName])
 	log := logger.GetLogger(ctx)
 
 	volumeType := prometheus.PrometheusUnknownVolumeType
@@ -1920,6 +1947,8 @@ func (c *controller) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshot
 	*csi.CreateSnapshotResponse, error) {
 
 	ctx = logger.NewContextWithLogger(ctx)
+	ctx = cnsvolume.ContextWithAuditRequester(ctx, req.Parameters[common.VolumeSnapshotNamespaceKey],
+		req.Parameters[common.VolumeSnapshotNameKey])
 	log := logger.GetLogger(ctx)
 	log.Infof("WCP CreateSnapshot: called with args %+v", *req)
 	isBlockVolumeSnapshotWCPEnabled := commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.BlockVolumeSnapshot)
@@ -2162,6 +2191,9 @@ func (c *controller) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsRe
 		snapshots, nextToken, err := common.ListSnapshotsUtil(ctx, c.manager.VolumeManager, req.SourceVolumeId,
 			req.SnapshotId, req.StartingToken, maxEntries)
 		if err != nil {
+			if status.Code(err) == codes.Aborted {
+				return nil, err
+			}
 			return nil, logger.LogNewErrorCodef(log, codes.Internal, "failed to retrieve the snapshots, err: %+v", err)
 		}
 		var entries []*csi.ListSnapshotsResponse_Entry
@@ -90,6 +90,10 @@ func validateCreateFileReqParam(paramName, value string) bool {
 // sending this parameter.
 func validateWCPCreateVolumeRequest(ctx context.Context, req *csi.CreateVolumeRequest, isBlockRequest bool) error {
 	// Get create params.
+	if common.IsMultiWriterBlockVolumeRequest(ctx, req.GetVolumeCapabilities()) {
+		return status.Error(codes.InvalidArgument,
+			"multi-writer block volumes are not supported in WCP CSI driver")
+	}
 	params := req.GetParameters()
 	for paramName, value := range params {
 		paramName = strings.ToLower(paramName)
@@ -215,11 +219,12 @@ func validateWCPListSnapshotRequest(ctx context.Context, req *csi.ListSnapshotsR
 		return logger.LogNewErrorCodef(log, codes.InvalidArgument,
 			"ListSnapshots MaxEntries: %d cannot be negative", maxEntries)
 	}
-	// validate the starting token by verifying that it can be converted to a int
+	// validate the starting token by verifying that it can be converted to a non-negative int.
+	// As per CSI spec, an invalid starting token must be reported with codes.Aborted.
 	if req.StartingToken != "" {
-		_, err := strconv.Atoi(req.StartingToken)
-		if err != nil {
-			return logger.LogNewErrorCodef(log, codes.InvalidArgument,
+		token, err := strconv.Atoi(req.StartingToken)
+		if err != nil || token < 0 {
+			return logger.LogNewErrorCodef(log, codes.Aborted,
 				"ListSnapshots StartingToken: %s cannot be parsed", req.StartingToken)
 		}
 	}
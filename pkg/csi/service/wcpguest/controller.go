@@ -1411,13 +1411,9 @@ func (c *controller) ControllerExpandVolume(ctx context.Context, req *csi.Contro
 			}
 		}
 
+		// Node expansion is also required for raw block volumes, as the device
+		// needs to be rescanned on the node for the guest OS to see the new size.
 		nodeExpansionRequired := true
-		// Set NodeExpansionRequired to false for raw block volumes
-		if _, ok := req.GetVolumeCapability().GetAccessType().(*csi.VolumeCapability_Block); ok {
-			log.Infof("Node Expansion not supported for raw block volume ID %q in namespace %s of supervisor",
-				volumeID, c.supervisorNamespace)
-			nodeExpansionRequired = false
-		}
 		resp := &csi.ControllerExpandVolumeResponse{
 			CapacityBytes:         volSizeBytes,
 			NodeExpansionRequired: nodeExpansionRequired,
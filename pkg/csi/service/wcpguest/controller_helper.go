@@ -95,6 +95,10 @@ func validateGuestClusterCreateVolumeRequest(ctx context.Context, req *csi.Creat
 		}
 	}
 
+	if common.IsMultiWriterBlockVolumeRequest(ctx, req.GetVolumeCapabilities()) {
+		return logger.LogNewErrorCode(log, codes.InvalidArgument,
+			"multi-writer block volumes are not supported in guest clusters")
+	}
 	// Fail file volume creation if file volume feature gate is disabled
 	if !commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.FileVolume) &&
 		common.IsFileVolumeRequest(ctx, req.GetVolumeCapabilities()) {
@@ -25,6 +25,7 @@ import (
 	v1 "k8s.io/client-go/informers/core/v1"
 	clientset "k8s.io/client-go/kubernetes"
 	corelisters "k8s.io/client-go/listers/core/v1"
+	storagelisters "k8s.io/client-go/listers/storage/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/sample-controller/pkg/signals"
 
@@ -276,6 +277,17 @@ func (im *InformerManager) GetPodLister() corelisters.PodLister {
 	return im.informerFactory.Core().V1().Pods().Lister()
 }
 
+// GetVolumeAttachmentLister returns VolumeAttachment Lister for the calling
+// informer manager. The VolumeAttachment informer is started and synced by the
+// next call to Listen.
+func (im *InformerManager) GetVolumeAttachmentLister() storagelisters.VolumeAttachmentLister {
+	if im.volumeAttachmentInformer == nil {
+		im.volumeAttachmentInformer = im.informerFactory.Storage().V1().VolumeAttachments().Informer()
+	}
+	im.volumeAttachmentSynced = im.volumeAttachmentInformer.HasSynced
+	return im.informerFactory.Storage().V1().VolumeAttachments().Lister()
+}
+
 // Listen starts the Informers.
 func (im *InformerManager) Listen() (stopCh <-chan struct{}) {
 	go im.informerFactory.Start(im.stopCh)
@@ -285,6 +297,11 @@ func (im *InformerManager) Listen() (stopCh <-chan struct{}) {
 		}
 
 	}
+	if im.volumeAttachmentSynced != nil {
+		if !cache.WaitForCacheSync(im.stopCh, im.volumeAttachmentSynced) {
+			return
+		}
+	}
 	return im.stopCh
 }
 
@@ -0,0 +1,339 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	storagelisters "k8s.io/client-go/listers/storage/v1"
+
+	volumes "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/volume"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/types"
+)
+
+const (
+	// envAdminAPIPort is the name of the env variable which sets the port of
+	// the admin API. The admin API is disabled if it is not set.
+	envAdminAPIPort = "ADMIN_API_PORT"
+	// envAdminAPITokenFile is the name of the env variable which sets the file
+	// holding the bearer token clients of the admin API must present.
+	envAdminAPITokenFile = "ADMIN_API_TOKEN_FILE"
+	// envAdminAPICertFile and envAdminAPIKeyFile are the names of the env
+	// variables which set the certificate and key the admin API is served
+	// with over TLS. Without them, the admin API is served over plain HTTP on
+	// the loopback interface only, so that the token is not sent in clear
+	// over the network.
+	envAdminAPICertFile = "ADMIN_API_CERT_FILE"
+	envAdminAPIKeyFile  = "ADMIN_API_KEY_FILE"
+
+	// adminVolumesPath is the path of the admin API listing the volumes.
+	adminVolumesPath = "/v1/volumes"
+	// defaultAdminVolumesLimit is the number of volumes listed per page if
+	// the client does not set a limit.
+	defaultAdminVolumesLimit = 100
+	// maxAdminVolumesLimit is the maximum number of volumes listed per page.
+	maxAdminVolumesLimit = 500
+)
+
+// adminVolume is the state of a volume managed by the driver, as listed by
+// the admin API.
+type adminVolume struct {
+	PVName           string   `json:"pvName"`
+	PVPhase          string   `json:"pvPhase"`
+	PVCNamespace     string   `json:"pvcNamespace,omitempty"`
+	PVCName          string   `json:"pvcName,omitempty"`
+	VolumeID         string   `json:"volumeId"`
+	VCenter          string   `json:"vCenter,omitempty"`
+	VolumeType       string   `json:"volumeType,omitempty"`
+	CapacityInMB     int64    `json:"capacityInMb,omitempty"`
+	DatastoreURL     string   `json:"datastoreUrl,omitempty"`
+	StoragePolicyID  string   `json:"storagePolicyId,omitempty"`
+	HealthStatus     string   `json:"healthStatus,omitempty"`
+	ComplianceStatus string   `json:"complianceStatus,omitempty"`
+	AttachedNodes    []string `json:"attachedNodes,omitempty"`
+	// Error is set if the state of the volume could not be retrieved from CNS.
+	Error string `json:"error,omitempty"`
+}
+
+// adminVolumeList is a page of the volumes listed by the admin API. Continue
+// is passed as the continue query parameter to get the next page, and is
+// empty on the last page.
+type adminVolumeList struct {
+	Volumes  []adminVolume `json:"volumes"`
+	Continue string        `json:"continue,omitempty"`
+}
+
+// adminServer serves the admin API of the syncer.
+type adminServer struct {
+	metadataSyncer         *metadataSyncInformer
+	volumeAttachmentLister storagelisters.VolumeAttachmentLister
+	token                  string
+}
+
+// startAdminServer serves the admin API in the background if ADMIN_API_PORT
+// is set. The admin API requires the bearer token read from the file set by
+// ADMIN_API_TOKEN_FILE, and is not started without one.
+func startAdminServer(ctx context.Context, metadataSyncer *metadataSyncInformer) {
+	log := logger.GetLogger(ctx)
+	port := os.Getenv(envAdminAPIPort)
+	if port == "" {
+		return
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		log.Errorf("Admin API is disabled, invalid port %q set in env variable %s", port, envAdminAPIPort)
+		return
+	}
+	tokenFile := os.Getenv(envAdminAPITokenFile)
+	if tokenFile == "" {
+		log.Errorf("Admin API is disabled, env variable %s is not set", envAdminAPITokenFile)
+		return
+	}
+	token, err := os.ReadFile(tokenFile)
+	if err != nil || strings.TrimSpace(string(token)) == "" {
+		log.Errorf("Admin API is disabled, failed to read a token from %q. Err: %v", tokenFile, err)
+		return
+	}
+	certFile, keyFile := os.Getenv(envAdminAPICertFile), os.Getenv(envAdminAPIKeyFile)
+	if (certFile == "") != (keyFile == "") {
+		log.Errorf("Admin API is disabled, env variables %s and %s must be set together",
+			envAdminAPICertFile, envAdminAPIKeyFile)
+		return
+	}
+	useTLS := certFile != ""
+	s := &adminServer{
+		metadataSyncer:         metadataSyncer,
+		volumeAttachmentLister: metadataSyncer.k8sInformerManager.GetVolumeAttachmentLister(),
+		token:                  strings.TrimSpace(string(token)),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(adminVolumesPath, s.authorize(s.listVolumes))
+	server := &http.Server{
+		Addr:              getAdminServerAddr(port, useTLS),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		// Start the VolumeAttachment informer.
+		metadataSyncer.k8sInformerManager.Listen()
+		for {
+			log.Infof("Starting the admin API on %s, TLS: %t", server.Addr, useTLS)
+			if useTLS {
+				err = server.ListenAndServeTLS(certFile, keyFile)
+			} else {
+				err = server.ListenAndServe()
+			}
+			log.Warnf("Admin API exited with err: %+v, restarting", err)
+			time.Sleep(time.Minute)
+		}
+	}()
+}
+
+// getAdminServerAddr returns the address the admin API listens on. The admin
+// API is only reachable from the pod when it is not served over TLS.
+func getAdminServerAddr(port string, useTLS bool) string {
+	if useTLS {
+		return ":" + port
+	}
+	return "127.0.0.1:" + port
+}
+
+// authorize rejects the requests which do not carry the bearer token of the
+// admin API.
+func (s *adminServer) authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// listVolumes lists a page of the PVs of the driver with the state of their
+// CNS volume and the nodes they are attached to. The page size is set by the
+// limit query parameter, and the next page by the continue query parameter.
+func (s *adminServer) listVolumes(w http.ResponseWriter, r *http.Request) {
+	ctx, log := logger.GetNewContextWithLogger()
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	limit, offset, err := parseAdminPagination(r.URL.Query().Get("limit"), r.URL.Query().Get("continue"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pvs, err := s.metadataSyncer.pvLister.List(labels.Everything())
+	if err != nil {
+		log.Errorf("Admin API: failed to list PVs. Err: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	var driverPVs []*v1.PersistentVolume
+	for _, pv := range pvs {
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == csitypes.Name {
+			driverPVs = append(driverPVs, pv)
+		}
+	}
+	page, next := paginateAdminPVs(driverPVs, limit, offset)
+	list := adminVolumeList{Volumes: s.getAdminVolumes(ctx, page)}
+	if next > 0 {
+		list.Continue = strconv.Itoa(next)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		log.Errorf("Admin API: failed to write the list of volumes. Err: %v", err)
+	}
+}
+
+// parseAdminPagination parses the limit and continue query parameters of the
+// admin API into the page size and the offset of the page.
+func parseAdminPagination(limitParam string, continueParam string) (int, int, error) {
+	limit := defaultAdminVolumesLimit
+	if limitParam != "" {
+		value, err := strconv.Atoi(limitParam)
+		if err != nil || value <= 0 {
+			return 0, 0, fmt.Errorf("invalid limit %q, expecting a positive number", limitParam)
+		}
+		limit = min(value, maxAdminVolumesLimit)
+	}
+	offset := 0
+	if continueParam != "" {
+		value, err := strconv.Atoi(continueParam)
+		if err != nil || value < 0 {
+			return 0, 0, fmt.Errorf("invalid continue token %q", continueParam)
+		}
+		offset = value
+	}
+	return limit, offset, nil
+}
+
+// paginateAdminPVs returns the page of the PVs sorted by name starting at
+// offset, and the offset of the next page, 0 if this is the last page.
+func paginateAdminPVs(pvs []*v1.PersistentVolume, limit int, offset int) ([]*v1.PersistentVolume, int) {
+	sort.Slice(pvs, func(i, j int) bool {
+		return pvs[i].Name < pvs[j].Name
+	})
+	if offset >= len(pvs) {
+		return nil, 0
+	}
+	end := offset + limit
+	if end >= len(pvs) {
+		return pvs[offset:], 0
+	}
+	return pvs[offset:end], end
+}
+
+// getAdminVolumes returns the state of the volumes of the given PVs. CNS is
+// queried once per vCenter for the volumes of the page.
+func (s *adminServer) getAdminVolumes(ctx context.Context, pvs []*v1.PersistentVolume) []adminVolume {
+	log := logger.GetLogger(ctx)
+	attachedNodes := s.getAttachedNodes(ctx)
+	adminVolumes := make([]adminVolume, len(pvs))
+	volumeIndexes := make(map[string]int, len(pvs))
+	vcVolumeIDs := make(map[string][]cnstypes.CnsVolumeId)
+	vcVolumeManagers := make(map[string]volumes.Manager)
+	for i, pv := range pvs {
+		volumeID := pv.Spec.CSI.VolumeHandle
+		adminVolumes[i] = adminVolume{
+			PVName:        pv.Name,
+			PVPhase:       string(pv.Status.Phase),
+			VolumeID:      volumeID,
+			AttachedNodes: attachedNodes[pv.Name],
+		}
+		if pv.Spec.ClaimRef != nil {
+			adminVolumes[i].PVCNamespace = pv.Spec.ClaimRef.Namespace
+			adminVolumes[i].PVCName = pv.Spec.ClaimRef.Name
+		}
+		vc, volManager, err := getVcHostAndVolumeManagerForVolumeID(ctx, s.metadataSyncer, volumeID)
+		if err != nil {
+			adminVolumes[i].Error = fmt.Sprintf("failed to get vCenter of the volume: %v", err)
+			continue
+		}
+		adminVolumes[i].VCenter = vc
+		volumeIndexes[volumeID] = i
+		vcVolumeIDs[vc] = append(vcVolumeIDs[vc], cnstypes.CnsVolumeId{Id: volumeID})
+		vcVolumeManagers[vc] = volManager
+	}
+	for vc, volumeIDs := range vcVolumeIDs {
+		queryResult, err := vcVolumeManagers[vc].QueryVolume(ctx, cnstypes.CnsQueryFilter{VolumeIds: volumeIDs})
+		if err != nil {
+			log.Errorf("Admin API: failed to query volumes on vCenter %q. Err: %v", vc, err)
+			for _, volumeID := range volumeIDs {
+				adminVolumes[volumeIndexes[volumeID.Id]].Error = fmt.Sprintf("failed to query CNS: %v", err)
+			}
+			continue
+		}
+		found := make(map[string]bool, len(queryResult.Volumes))
+		for _, volume := range queryResult.Volumes {
+			i, ok := volumeIndexes[volume.VolumeId.Id]
+			if !ok {
+				continue
+			}
+			found[volume.VolumeId.Id] = true
+			adminVolumes[i].VolumeType = volume.VolumeType
+			adminVolumes[i].DatastoreURL = volume.DatastoreUrl
+			adminVolumes[i].StoragePolicyID = volume.StoragePolicyId
+			adminVolumes[i].HealthStatus = volume.HealthStatus
+			adminVolumes[i].ComplianceStatus = volume.ComplianceStatus
+			if volume.BackingObjectDetails != nil {
+				adminVolumes[i].CapacityInMB =
+					volume.BackingObjectDetails.GetCnsBackingObjectDetails().CapacityInMb
+			}
+		}
+		for _, volumeID := range volumeIDs {
+			if !found[volumeID.Id] {
+				adminVolumes[volumeIndexes[volumeID.Id]].Error = "volume not found in CNS"
+			}
+		}
+	}
+	return adminVolumes
+}
+
+// getAttachedNodes returns the names of the nodes each PV of the driver is
+// attached to, according to the VolumeAttachments in the informer cache.
+func (s *adminServer) getAttachedNodes(ctx context.Context) map[string][]string {
+	log := logger.GetLogger(ctx)
+	attachedNodes := make(map[string][]string)
+	volumeAttachments, err := s.volumeAttachmentLister.List(labels.Everything())
+	if err != nil {
+		log.Errorf("Admin API: failed to list VolumeAttachments. Err: %v", err)
+		return attachedNodes
+	}
+	for _, va := range volumeAttachments {
+		if va.Spec.Attacher != csitypes.Name || va.Spec.Source.PersistentVolumeName == nil || !va.Status.Attached {
+			continue
+		}
+		pvName := *va.Spec.Source.PersistentVolumeName
+		attachedNodes[pvName] = append(attachedNodes[pvName], va.Spec.NodeName)
+	}
+	return attachedNodes
+}
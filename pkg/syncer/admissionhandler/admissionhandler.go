@@ -62,6 +62,9 @@ var (
 	featureGateTopologyAwareFileVolumeEnabled bool
 	featureGateByokEnabled                    bool
 	featureFileVolumesWithVmServiceEnabled    bool
+	// validatePVCEncryptionAccessModeEnabled is set if the access modes of
+	// encrypted PVCs are validated.
+	validatePVCEncryptionAccessModeEnabled bool
 )
 
 // watchConfigChange watches on the webhook configuration directory for changes
@@ -147,6 +150,9 @@ func StartWebhookServer(ctx context.Context, enableWebhookClientCertVerification
 		featureGateVolumeHealthEnabled = containerOrchestratorUtility.IsFSSEnabled(ctx, common.VolumeHealth)
 		featureGateBlockVolumeSnapshotEnabled = containerOrchestratorUtility.IsFSSEnabled(ctx, common.BlockVolumeSnapshot)
 		featureGateByokEnabled = containerOrchestratorUtility.IsFSSEnabled(ctx, common.WCP_VMService_BYOK)
+		if featureGateByokEnabled {
+			validatePVCEncryptionAccessModeEnabled = isPVCEncryptionAccessModeValidationEnabled(ctx)
+		}
 		if err := startCNSCSIWebhookManager(ctx, enableWebhookClientCertVerification); err != nil {
 			return fmt.Errorf("unable to run the webhook manager: %w", err)
 		}
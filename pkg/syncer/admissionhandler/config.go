@@ -45,6 +45,10 @@ type webHookConfig struct {
 	KeyFile string `gcfg:"key-file"`
 	// Port is the webhook port on which http server should be started
 	Port string `gcfg:"port"`
+	// ValidatePVCEncryptionAccessMode enables rejecting PVCs with an
+	// EncryptionClass requesting an access mode which is not supported for
+	// encrypted volumes.
+	ValidatePVCEncryptionAccessMode bool `gcfg:"validate-pvc-encryption-access-mode"`
 }
 
 // getWebHookConfig returns webhook config
@@ -25,23 +25,21 @@ func setDefaultEncryptionClass(
 		return false, nil
 	}
 
-	if ok, _, err := cryptoClient.IsEncryptedStorageClass(ctx, *pvc.Spec.StorageClassName); err != nil {
-		return false, err
-	} else if !ok {
-		// The StorageClass does not support encryption, so we do not need to set
-		// a default EncryptionClass for the PVC.
-		return false, nil
-	}
-
-	defaultEncClass, err := cryptoClient.GetDefaultEncryptionClass(ctx, pvc.Namespace)
+	defaultEncClassName, err := cryptoClient.ResolveEncryptionClassNameForPVC(ctx, pvc)
 	if err != nil {
 		if err == crypto.ErrDefaultEncryptionClassNotFound {
+			// The validation webhook rejects the PVC with a clear error.
 			return false, nil
 		}
 		return false, err
 	}
+	if defaultEncClassName == "" {
+		// The StorageClass does not support encryption, so we do not need to set
+		// a default EncryptionClass for the PVC.
+		return false, nil
+	}
 
-	crypto.SetEncryptionClassNameForPVC(pvc, defaultEncClass.Name)
+	crypto.SetEncryptionClassNameForPVC(pvc, defaultEncClassName)
 
 	return true, nil
 }
@@ -3,6 +3,7 @@ package admissionhandler
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strings"
 
@@ -35,6 +36,9 @@ func validatePVCRequestForCrypto(
 	}
 
 	fieldErrs := validatePVCCrypto(ctx, cryptoClient, newPVC)
+	if validatePVCEncryptionAccessModeEnabled {
+		fieldErrs = append(fieldErrs, validatePVCEncryptionAccessMode(newPVC)...)
+	}
 
 	validationErrs := make([]string, 0, len(fieldErrs))
 	for _, fieldErr := range fieldErrs {
@@ -67,16 +71,29 @@ func validatePVCCrypto(
 		return nil
 	}
 
-	encClassName := crypto.GetEncryptionClassNameForPVC(pvc)
-	if encClassName == "" {
-		return nil
-	}
-
 	var (
 		allErrs          field.ErrorList
 		encClassNamePath = field.NewPath("annotations", crypto.PVCEncryptionClassAnnotationName)
 	)
 
+	encClassName := crypto.GetEncryptionClassNameForPVC(pvc)
+	if encClassName == "" {
+		// The PVC does not specify an EncryptionClass and none was defaulted.
+		// Reject it if its StorageClass requires encryption.
+		if _, err := cryptoClient.ResolveEncryptionClassNameForPVC(ctx, pvc); err != nil {
+			if err == crypto.ErrDefaultEncryptionClassNotFound {
+				allErrs = append(allErrs, field.Required(encClassNamePath, fmt.Sprintf(
+					"storage class %q requires encryption, but the PVC does not specify an EncryptionClass "+
+						"and namespace %q has no default EncryptionClass with the label %s=%s",
+					*pvc.Spec.StorageClassName, pvc.Namespace,
+					crypto.DefaultEncryptionClassLabelName, crypto.DefaultEncryptionClassLabelValue)))
+			} else {
+				allErrs = append(allErrs, field.InternalError(encClassNamePath, err))
+			}
+		}
+		return allErrs
+	}
+
 	if ok, _, err := cryptoClient.IsEncryptedStorageClass(ctx, *pvc.Spec.StorageClassName); err != nil {
 		allErrs = append(allErrs, field.InternalError(encClassNamePath, err))
 	} else if !ok {
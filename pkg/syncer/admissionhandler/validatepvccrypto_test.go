@@ -0,0 +1,182 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admissionhandler
+
+import (
+	"context"
+	"testing"
+
+	byokv1 "github.com/vmware-tanzu/vm-operator/external/byok/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/crypto"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/types"
+)
+
+func newTestCryptoClient(t *testing.T, ctx context.Context) crypto.Client {
+	scheme, err := crypto.NewK8sScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedSC := &storagev1.StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: "encrypted-sc", UID: "encrypted-sc-uid"},
+		Provisioner: types.Name,
+		Parameters:  map[string]string{"storagePolicyID": "encrypted-policy"},
+	}
+	plainSC := &storagev1.StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: "plain-sc", UID: "plain-sc-uid"},
+		Provisioner: types.Name,
+		Parameters:  map[string]string{"storagePolicyID": "plain-policy"},
+	}
+	defaultEncClass := &byokv1.EncryptionClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "default-enc-class",
+			Namespace: "ns-with-default",
+			Labels: map[string]string{
+				crypto.DefaultEncryptionClassLabelName: crypto.DefaultEncryptionClassLabelValue,
+			},
+		},
+	}
+	k8sClient := fake.NewClientBuilder().WithScheme(scheme).
+		WithObjects(encryptedSC, plainSC, defaultEncClass).Build()
+	cryptoClient := crypto.NewClient(ctx, k8sClient)
+	if err := cryptoClient.MarkEncryptedStorageClass(ctx, encryptedSC, true); err != nil {
+		t.Fatal(err)
+	}
+	return cryptoClient
+}
+
+func TestSetDefaultEncryptionClassAndValidatePVCCrypto(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cryptoClient := newTestCryptoClient(t, ctx)
+
+	newPVC := func(namespace, storageClass, encClass string) *corev1.PersistentVolumeClaim {
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc", Namespace: namespace},
+			Spec:       corev1.PersistentVolumeClaimSpec{StorageClassName: &storageClass},
+		}
+		crypto.SetEncryptionClassNameForPVC(pvc, encClass)
+		return pvc
+	}
+
+	tests := []struct {
+		name             string
+		pvc              *corev1.PersistentVolumeClaim
+		expectedEncClass string
+		expectValid      bool
+	}{
+		{
+			name:             "PVC specified EncryptionClass takes precedence",
+			pvc:              newPVC("ns-with-default", "encrypted-sc", "my-enc-class"),
+			expectedEncClass: "my-enc-class",
+			expectValid:      true,
+		},
+		{
+			name:             "Namespace default EncryptionClass is used",
+			pvc:              newPVC("ns-with-default", "encrypted-sc", ""),
+			expectedEncClass: "default-enc-class",
+			expectValid:      true,
+		},
+		{
+			name:             "No EncryptionClass for a StorageClass without encryption",
+			pvc:              newPVC("ns-with-default", "plain-sc", ""),
+			expectedEncClass: "",
+			expectValid:      true,
+		},
+		{
+			name:             "Encryption requested without any EncryptionClass is rejected",
+			pvc:              newPVC("ns-without-default", "encrypted-sc", ""),
+			expectedEncClass: "",
+			expectValid:      false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := setDefaultEncryptionClass(ctx, cryptoClient, test.pvc); err != nil {
+				t.Fatalf("setDefaultEncryptionClass failed: %v", err)
+			}
+			if encClass := crypto.GetEncryptionClassNameForPVC(test.pvc); encClass != test.expectedEncClass {
+				t.Errorf("expected EncryptionClass %q, got %q", test.expectedEncClass, encClass)
+			}
+			errs := validatePVCCrypto(ctx, cryptoClient, test.pvc)
+			if test.expectValid && len(errs) > 0 {
+				t.Errorf("expected PVC to be valid, got errors: %v", errs)
+			} else if !test.expectValid && len(errs) == 0 {
+				t.Errorf("expected PVC to be rejected")
+			}
+		})
+	}
+}
+
+func TestValidatePVCEncryptionAccessMode(t *testing.T) {
+	blockMode := corev1.PersistentVolumeBlock
+	newPVC := func(encClass string, volumeMode *corev1.PersistentVolumeMode,
+		accessModes ...corev1.PersistentVolumeAccessMode) *corev1.PersistentVolumeClaim {
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc", Namespace: "ns"},
+			Spec:       corev1.PersistentVolumeClaimSpec{AccessModes: accessModes, VolumeMode: volumeMode},
+		}
+		crypto.SetEncryptionClassNameForPVC(pvc, encClass)
+		return pvc
+	}
+
+	tests := []struct {
+		name        string
+		pvc         *corev1.PersistentVolumeClaim
+		expectValid bool
+	}{
+		{
+			name:        "Encrypted ReadWriteOnce filesystem volume is allowed",
+			pvc:         newPVC("enc-class", nil, corev1.ReadWriteOnce),
+			expectValid: true,
+		},
+		{
+			name:        "Encrypted ReadWriteMany filesystem volume is rejected",
+			pvc:         newPVC("enc-class", nil, corev1.ReadWriteMany),
+			expectValid: false,
+		},
+		{
+			name:        "Encrypted ReadOnlyMany filesystem volume is rejected",
+			pvc:         newPVC("enc-class", nil, corev1.ReadWriteOnce, corev1.ReadOnlyMany),
+			expectValid: false,
+		},
+		{
+			name:        "Encrypted ReadWriteMany block volume is allowed",
+			pvc:         newPVC("enc-class", &blockMode, corev1.ReadWriteMany),
+			expectValid: true,
+		},
+		{
+			name:        "Unencrypted ReadWriteMany filesystem volume is allowed",
+			pvc:         newPVC("", nil, corev1.ReadWriteMany),
+			expectValid: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			errs := validatePVCEncryptionAccessMode(test.pvc)
+			if test.expectValid && len(errs) > 0 {
+				t.Errorf("expected PVC to be valid, got errors: %v", errs)
+			} else if !test.expectValid && len(errs) == 0 {
+				t.Errorf("expected PVC to be rejected")
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admissionhandler
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/crypto"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+)
+
+// isPVCEncryptionAccessModeValidationEnabled returns true if the validation of
+// the access modes of encrypted PVCs is enabled in the webhook config. The
+// validation is disabled if there is no webhook config.
+func isPVCEncryptionAccessModeValidationEnabled(ctx context.Context) bool {
+	log := logger.GetLogger(ctx)
+	webHookConfigPath := os.Getenv(envWebHookConfigPath)
+	if webHookConfigPath == "" {
+		webHookConfigPath = defaultWebHookConfigPath
+	}
+	if _, err := os.Stat(webHookConfigPath); err != nil {
+		log.Infof("Webhook config %q not found, access modes of encrypted PVCs are not validated",
+			webHookConfigPath)
+		return false
+	}
+	webHookCfg, err := getWebHookConfig(ctx)
+	if err != nil {
+		log.Warnf("Access modes of encrypted PVCs are not validated, failed to read webhook config. Err: %v", err)
+		return false
+	}
+	log.Infof("Validation of the access modes of encrypted PVCs enabled: %t",
+		webHookCfg.WebHookConfig.ValidatePVCEncryptionAccessMode)
+	return webHookCfg.WebHookConfig.ValidatePVCEncryptionAccessMode
+}
+
+// validatePVCEncryptionAccessMode rejects PVCs with an EncryptionClass which
+// request a shared access mode for a filesystem volume. Such PVCs are
+// provisioned as file volumes, which cannot be encrypted, and would otherwise
+// stay pending once provisioning fails.
+func validatePVCEncryptionAccessMode(pvc *corev1.PersistentVolumeClaim) field.ErrorList {
+	encClassName := crypto.GetEncryptionClassNameForPVC(pvc)
+	if encClassName == "" || (pvc.Spec.VolumeMode != nil && *pvc.Spec.VolumeMode == corev1.PersistentVolumeBlock) {
+		return nil
+	}
+	var allErrs field.ErrorList
+	accessModesPath := field.NewPath("spec", "accessModes")
+	for i, accessMode := range pvc.Spec.AccessModes {
+		if accessMode != corev1.ReadWriteMany && accessMode != corev1.ReadOnlyMany {
+			continue
+		}
+		allErrs = append(allErrs, field.Forbidden(accessModesPath.Index(i), fmt.Sprintf(
+			"access mode %s is not supported with EncryptionClass %q, encryption is only supported for "+
+				"%s or %s filesystem volumes and for block volumes", accessMode, encClassName,
+			corev1.ReadWriteOnce, corev1.ReadWriteOncePod)))
+	}
+	return allErrs
+}
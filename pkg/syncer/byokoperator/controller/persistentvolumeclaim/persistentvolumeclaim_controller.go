@@ -18,13 +18,17 @@ package persistentvolumeclaim
 
 import (
 	"context"
+	"fmt"
 	"reflect"
+	"time"
 
 	byokv1 "github.com/vmware-tanzu/vm-operator/external/byok/api/v1alpha1"
 	cnstypes "github.com/vmware/govmomi/cns/types"
 	vimtypes "github.com/vmware/govmomi/vim25/types"
 	"go.uber.org/zap"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
@@ -36,6 +40,10 @@ import (
 	ctrlcommoon "sigs.k8s.io/vsphere-csi-driver/v3/pkg/syncer/byokoperator/controller/common"
 )
 
+// encryptionMigrationRetryInterval is the interval at which the encryption
+// migration of a volume waiting for its workload to be scaled down is retried.
+const encryptionMigrationRetryInterval = time.Minute
+
 func AddToManager(ctx context.Context, mgr manager.Manager, opts ctrlcommoon.Options) error {
 	var (
 		controlledType     = &corev1.PersistentVolumeClaim{}
@@ -45,6 +53,7 @@ func AddToManager(ctx context.Context, mgr manager.Manager, opts ctrlcommoon.Opt
 	r := &reconciler{
 		Client:        mgr.GetClient(),
 		logger:        logger.GetLoggerWithNoContext().Named("controllers").Named(controlledTypeName),
+		recorder:      mgr.GetEventRecorderFor("byok-operator"),
 		cryptoClient:  opts.CryptoClient,
 		volumeManager: opts.VolumeManager,
 	}
@@ -61,6 +70,7 @@ func AddToManager(ctx context.Context, mgr manager.Manager, opts ctrlcommoon.Opt
 type reconciler struct {
 	client.Client
 	logger        *zap.SugaredLogger
+	recorder      record.EventRecorder
 	cryptoClient  crypto.Client
 	volumeManager volume.Manager
 }
@@ -75,41 +85,50 @@ func (r *reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resu
 		return ctrl.Result{}, nil
 	}
 
-	return ctrl.Result{}, r.reconcileNormal(ctx, obj)
+	return r.reconcileNormal(ctx, obj)
 }
 
-func (r *reconciler) reconcileNormal(ctx context.Context, pvc *corev1.PersistentVolumeClaim) error {
+func (r *reconciler) reconcileNormal(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (ctrl.Result, error) {
 	if pvc.Spec.VolumeName == "" || pvc.Spec.StorageClassName == nil {
-		return nil
+		return ctrl.Result{}, nil
 	}
 
 	encrypted, profileID, err := r.cryptoClient.IsEncryptedStorageClass(ctx, *pvc.Spec.StorageClassName)
 	if err != nil {
-		return err
+		return ctrl.Result{}, err
 	} else if !encrypted {
-		return nil
+		return ctrl.Result{}, nil
 	}
 
 	encClass, err := r.findEncryptionClass(ctx, pvc)
 	if err != nil {
-		return err
-	} else if encClass == nil {
-		return nil
+		return ctrl.Result{}, err
+	}
+	migrate := isEncryptionMigrationRequested(pvc)
+	if encClass == nil && migrate {
+		// PVCs created before encryption was enabled do not specify an
+		// EncryptionClass, they are encrypted with the default one.
+		if encClass, err = r.findDefaultEncryptionClass(ctx, pvc); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if encClass == nil {
+		return ctrl.Result{}, nil
 	}
 
 	volume, err := r.findVolume(ctx, pvc)
 	if err != nil {
-		return err
+		return ctrl.Result{}, err
 	} else if volume == nil {
 		r.logger.Infof("Volume %s not found for PVC %s ()", pvc.Spec.VolumeName, pvc.Name)
-		return nil
+		return ctrl.Result{}, nil
 	} else if volume.VolumeType != csicommon.BlockVolumeType {
-		return nil
+		return ctrl.Result{}, nil
 	}
 
 	existingKeyID, err := csicommon.QueryVolumeCryptoKeyByID(ctx, r.volumeManager, volume.VolumeId.Id)
 	if err != nil {
-		return err
+		return ctrl.Result{}, err
 	}
 
 	newKeyID := vimtypes.CryptoKeyId{
@@ -122,7 +141,35 @@ func (r *reconciler) reconcileNormal(ctx context.Context, pvc *corev1.Persistent
 	if existingKeyID != nil &&
 		existingKeyID.KeyId == newKeyID.KeyId &&
 		existingKeyID.ProviderId.Id == newKeyID.ProviderId.Id {
-		return nil
+		// The volume may have been encrypted by a migration which was
+		// interrupted before its completion was recorded.
+		if migrate {
+			return ctrl.Result{}, r.completeEncryptionMigration(ctx, pvc, encClass.Name)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// Volumes are migrated to encryption while detached, so that the key is
+	// not changed under a running workload.
+	migrate = migrate && existingKeyID == nil
+	if migrate {
+		vmDiskAssociations, err := r.volumeManager.RetrieveVStorageObjectAssociations(ctx, volume.VolumeId.Id)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if len(vmDiskAssociations) > 0 {
+			r.recorder.Eventf(pvc, corev1.EventTypeWarning, "EncryptionMigrationBlocked",
+				"Volume %s is attached to VM %s, scale down the workload using the PVC to encrypt the volume",
+				volume.VolumeId.Id, vmDiskAssociations[0].VmId)
+			if err := r.setEncryptionMigrationStatus(ctx, pvc,
+				crypto.EncryptionMigrationStatusWaitingForDetach); err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: encryptionMigrationRetryInterval}, nil
+		}
+		if err := r.setEncryptionMigrationStatus(ctx, pvc, crypto.EncryptionMigrationStatusInProgress); err != nil {
+			return ctrl.Result{}, err
+		}
 	}
 
 	var cryptoSpec vimtypes.BaseCryptoSpec
@@ -144,7 +191,90 @@ func (r *reconciler) reconcileNormal(ctx context.Context, pvc *corev1.Persistent
 		},
 	}
 
-	return r.volumeManager.UpdateVolumeCrypto(ctx, updateSpec)
+	// If the update fails, e.g. because the key provider is unreachable, CNS
+	// leaves the volume encrypted with the existing key. Surface the failure
+	// on the PVC and requeue so that the key change is retried.
+	if err := r.volumeManager.UpdateVolumeCrypto(ctx, updateSpec); err != nil {
+		msg := fmt.Sprintf("Failed to update encryption key of volume %s to key %q of provider %q",
+			volume.VolumeId.Id, newKeyID.KeyId, newKeyID.ProviderId.Id)
+		if existingKeyID != nil {
+			msg += fmt.Sprintf(", existing key %q remains active", existingKeyID.KeyId)
+		}
+		r.recorder.Event(pvc, corev1.EventTypeWarning, "EncryptionKeyUpdateFailed", fmt.Sprintf("%s: %v", msg, err))
+		if migrate {
+			if statusErr := r.setEncryptionMigrationStatus(ctx, pvc,
+				crypto.EncryptionMigrationStatusFailed); statusErr != nil {
+				r.logger.Warnf("Failed to update encryption migration status of PVC %s/%s: %v",
+					pvc.Namespace, pvc.Name, statusErr)
+			}
+		}
+		return ctrl.Result{}, err
+	}
+
+	if existingKeyID != nil {
+		r.recorder.Eventf(pvc, corev1.EventTypeNormal, "EncryptionKeyRotated",
+			"Rotated encryption key of volume %s from key %q to key %q of provider %q",
+			volume.VolumeId.Id, existingKeyID.KeyId, newKeyID.KeyId, newKeyID.ProviderId.Id)
+	} else {
+		r.recorder.Eventf(pvc, corev1.EventTypeNormal, "VolumeEncrypted",
+			"Encrypted volume %s with key %q of provider %q",
+			volume.VolumeId.Id, newKeyID.KeyId, newKeyID.ProviderId.Id)
+	}
+	if migrate {
+		return ctrl.Result{}, r.completeEncryptionMigration(ctx, pvc, encClass.Name)
+	}
+	return ctrl.Result{}, nil
+}
+
+// findDefaultEncryptionClass returns the default EncryptionClass of the
+// namespace of the PVC, or nil if the namespace has none.
+func (r *reconciler) findDefaultEncryptionClass(
+	ctx context.Context,
+	pvc *corev1.PersistentVolumeClaim,
+) (*byokv1.EncryptionClass, error) {
+	encClass, err := r.cryptoClient.GetDefaultEncryptionClass(ctx, pvc.Namespace)
+	if err == crypto.ErrDefaultEncryptionClassNotFound {
+		r.recorder.Eventf(pvc, corev1.EventTypeWarning, "EncryptionMigrationBlocked",
+			"Namespace %s has no default EncryptionClass to encrypt the volume of the PVC with", pvc.Namespace)
+		return nil, nil
+	}
+	return encClass, err
+}
+
+// setEncryptionMigrationStatus records the status of the encryption
+// migration of the volume of the PVC.
+func (r *reconciler) setEncryptionMigrationStatus(
+	ctx context.Context,
+	pvc *corev1.PersistentVolumeClaim,
+	status string,
+) error {
+	if pvc.Annotations[crypto.PVCEncryptionMigrationStatusAnnotationName] == status {
+		return nil
+	}
+	patch := client.MergeFrom(pvc.DeepCopy())
+	metav1.SetMetaDataAnnotation(&pvc.ObjectMeta, crypto.PVCEncryptionMigrationStatusAnnotationName, status)
+	return r.Patch(ctx, pvc, patch)
+}
+
+// completeEncryptionMigration records on the PVC that its volume has been
+// encrypted with the given EncryptionClass, so that the volume follows the
+// key changes of the EncryptionClass from now on.
+func (r *reconciler) completeEncryptionMigration(
+	ctx context.Context,
+	pvc *corev1.PersistentVolumeClaim,
+	encClassName string,
+) error {
+	patch := client.MergeFrom(pvc.DeepCopy())
+	crypto.SetEncryptionClassNameForPVC(pvc, encClassName)
+	delete(pvc.Annotations, crypto.PVCEncryptionMigrationAnnotationName)
+	metav1.SetMetaDataAnnotation(&pvc.ObjectMeta, crypto.PVCEncryptionMigrationStatusAnnotationName,
+		crypto.EncryptionMigrationStatusCompleted)
+	if err := r.Patch(ctx, pvc, patch); err != nil {
+		return err
+	}
+	r.recorder.Eventf(pvc, corev1.EventTypeNormal, "EncryptionMigrationCompleted",
+		"Volume %s of the PVC is encrypted with EncryptionClass %s", pvc.Spec.VolumeName, encClassName)
+	return nil
 }
 
 func (r *reconciler) findEncryptionClass(
@@ -0,0 +1,273 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package persistentvolumeclaim
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	byokv1 "github.com/vmware-tanzu/vm-operator/external/byok/api/v1alpha1"
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	vimtypes "github.com/vmware/govmomi/vim25/types"
+	vslmtypes "github.com/vmware/govmomi/vslm/types"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/crypto"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/volume"
+	csicommon "sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/types"
+)
+
+const (
+	testNamespace    = "test-ns"
+	testPVCName      = "test-pvc"
+	testPVName       = "test-pv"
+	testVolumeID     = "test-volume-id"
+	testStorageClass = "encrypted-sc"
+	testEncClass     = "default-enc-class"
+	testKeyID        = "key-1"
+	testKeyProvider  = "provider-1"
+)
+
+// fakeVolumeManager serves a single block volume with the configured key and
+// VM associations, and records the crypto updates of the volume.
+type fakeVolumeManager struct {
+	volume.Manager
+	keyID         *vimtypes.CryptoKeyId
+	associations  []vslmtypes.VslmVsoVStorageObjectAssociationsVmDiskAssociation
+	updateErr     error
+	cryptoUpdates []*cnstypes.CnsVolumeCryptoUpdateSpec
+}
+
+func (m *fakeVolumeManager) QueryVolume(ctx context.Context,
+	queryFilter cnstypes.CnsQueryFilter) (*cnstypes.CnsQueryResult, error) {
+	return &cnstypes.CnsQueryResult{Volumes: []cnstypes.CnsVolume{{
+		VolumeId:   cnstypes.CnsVolumeId{Id: testVolumeID},
+		Name:       testPVName,
+		VolumeType: csicommon.BlockVolumeType,
+	}}}, nil
+}
+
+func (m *fakeVolumeManager) QueryVolumeInfo(ctx context.Context,
+	volumeIDList []cnstypes.CnsVolumeId) (*cnstypes.CnsQueryVolumeInfoResult, error) {
+	return &cnstypes.CnsQueryVolumeInfoResult{VolumeInfo: &cnstypes.CnsBlockVolumeInfo{
+		VStorageObject: vimtypes.VStorageObject{Config: vimtypes.VStorageObjectConfigInfo{
+			BaseConfigInfo: vimtypes.BaseConfigInfo{
+				Backing: &vimtypes.BaseConfigInfoDiskFileBackingInfo{
+					BaseConfigInfoFileBackingInfo: vimtypes.BaseConfigInfoFileBackingInfo{KeyId: m.keyID},
+				},
+			},
+		}},
+	}}, nil
+}
+
+func (m *fakeVolumeManager) RetrieveVStorageObjectAssociations(ctx context.Context,
+	volumeID string) ([]vslmtypes.VslmVsoVStorageObjectAssociationsVmDiskAssociation, error) {
+	return m.associations, nil
+}
+
+func (m *fakeVolumeManager) UpdateVolumeCrypto(ctx context.Context,
+	spec *cnstypes.CnsVolumeCryptoUpdateSpec) error {
+	m.cryptoUpdates = append(m.cryptoUpdates, spec)
+	return m.updateErr
+}
+
+// newTestReconciler returns a reconciler of a PVC requesting the encryption
+// migration of its volume in a namespace with a default EncryptionClass.
+func newTestReconciler(t *testing.T, ctx context.Context, volumeManager volume.Manager) *reconciler {
+	scheme, err := crypto.NewK8sScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+	storageClass := &storagev1.StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: testStorageClass, UID: "encrypted-sc-uid"},
+		Provisioner: csitypes.Name,
+		Parameters:  map[string]string{"storagePolicyID": "encrypted-policy"},
+	}
+	encClass := &byokv1.EncryptionClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testEncClass,
+			Namespace: testNamespace,
+			Labels: map[string]string{
+				crypto.DefaultEncryptionClassLabelName: crypto.DefaultEncryptionClassLabelValue,
+			},
+		},
+		Spec: byokv1.EncryptionClassSpec{KeyProvider: testKeyProvider, KeyID: testKeyID},
+	}
+	storageClassName := testStorageClass
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testPVCName,
+			Namespace: testNamespace,
+			Annotations: map[string]string{
+				crypto.PVCEncryptionMigrationAnnotationName: "true",
+			},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			StorageClassName: &storageClassName,
+			VolumeName:       testPVName,
+		},
+	}
+	k8sClient := fake.NewClientBuilder().WithScheme(scheme).
+		WithObjects(storageClass, encClass, pvc).Build()
+	cryptoClient := crypto.NewClient(ctx, k8sClient)
+	if err := cryptoClient.MarkEncryptedStorageClass(ctx, storageClass, true); err != nil {
+		t.Fatal(err)
+	}
+	return &reconciler{
+		Client:        k8sClient,
+		logger:        logger.GetLoggerWithNoContext(),
+		recorder:      record.NewFakeRecorder(10),
+		cryptoClient:  cryptoClient,
+		volumeManager: volumeManager,
+	}
+}
+
+func reconcileTestPVC(t *testing.T, ctx context.Context,
+	r *reconciler) (ctrl.Result, *corev1.PersistentVolumeClaim, error) {
+	key := types.NamespacedName{Namespace: testNamespace, Name: testPVCName}
+	result, reconcileErr := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	pvc := &corev1.PersistentVolumeClaim{}
+	if err := r.Get(ctx, key, pvc); err != nil {
+		t.Fatal(err)
+	}
+	return result, pvc, reconcileErr
+}
+
+func assertMigrationCompleted(t *testing.T, pvc *corev1.PersistentVolumeClaim) {
+	if status := pvc.Annotations[crypto.PVCEncryptionMigrationStatusAnnotationName]; status !=
+		crypto.EncryptionMigrationStatusCompleted {
+		t.Errorf("expected migration status %q, got %q", crypto.EncryptionMigrationStatusCompleted, status)
+	}
+	if encClass := crypto.GetEncryptionClassNameForPVC(pvc); encClass != testEncClass {
+		t.Errorf("expected EncryptionClass %q, got %q", testEncClass, encClass)
+	}
+	if _, found := pvc.Annotations[crypto.PVCEncryptionMigrationAnnotationName]; found {
+		t.Errorf("expected the migration annotation to be removed")
+	}
+}
+
+func TestEncryptionMigrationOfAttachedVolume(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	volumeManager := &fakeVolumeManager{
+		associations: []vslmtypes.VslmVsoVStorageObjectAssociationsVmDiskAssociation{{VmId: "vm-1"}},
+	}
+	r := newTestReconciler(t, ctx, volumeManager)
+
+	result, pvc, err := reconcileTestPVC(t, ctx, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RequeueAfter != encryptionMigrationRetryInterval {
+		t.Errorf("expected a requeue after %v, got %v", encryptionMigrationRetryInterval, result.RequeueAfter)
+	}
+	if status := pvc.Annotations[crypto.PVCEncryptionMigrationStatusAnnotationName]; status !=
+		crypto.EncryptionMigrationStatusWaitingForDetach {
+		t.Errorf("expected migration status %q, got %q", crypto.EncryptionMigrationStatusWaitingForDetach, status)
+	}
+	if len(volumeManager.cryptoUpdates) != 0 {
+		t.Errorf("expected an attached volume not to be encrypted, got %d crypto updates",
+			len(volumeManager.cryptoUpdates))
+	}
+
+	// The migration proceeds once the workload is scaled down.
+	volumeManager.associations = nil
+	if _, pvc, err = reconcileTestPVC(t, ctx, r); err != nil {
+		t.Fatal(err)
+	}
+	if len(volumeManager.cryptoUpdates) != 1 {
+		t.Fatalf("expected 1 crypto update, got %d", len(volumeManager.cryptoUpdates))
+	}
+	assertMigrationCompleted(t, pvc)
+}
+
+func TestEncryptionMigrationOfDetachedVolume(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	volumeManager := &fakeVolumeManager{}
+	r := newTestReconciler(t, ctx, volumeManager)
+
+	result, pvc, err := reconcileTestPVC(t, ctx, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RequeueAfter != 0 {
+		t.Errorf("expected no requeue, got %v", result.RequeueAfter)
+	}
+	if len(volumeManager.cryptoUpdates) != 1 {
+		t.Fatalf("expected 1 crypto update, got %d", len(volumeManager.cryptoUpdates))
+	}
+	spec, ok := volumeManager.cryptoUpdates[0].DisksCrypto.Crypto.(*vimtypes.CryptoSpecEncrypt)
+	if !ok {
+		t.Fatalf("expected an encrypt crypto spec, got %T", volumeManager.cryptoUpdates[0].DisksCrypto.Crypto)
+	}
+	if spec.CryptoKeyId.KeyId != testKeyID || spec.CryptoKeyId.ProviderId.Id != testKeyProvider {
+		t.Errorf("expected key %q of provider %q, got %+v", testKeyID, testKeyProvider, spec.CryptoKeyId)
+	}
+	assertMigrationCompleted(t, pvc)
+}
+
+func TestEncryptionMigrationOfEncryptedVolume(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// The volume was encrypted by a migration interrupted before its
+	// completion was recorded on the PVC.
+	volumeManager := &fakeVolumeManager{
+		keyID: &vimtypes.CryptoKeyId{KeyId: testKeyID, ProviderId: &vimtypes.KeyProviderId{Id: testKeyProvider}},
+	}
+	r := newTestReconciler(t, ctx, volumeManager)
+
+	_, pvc, err := reconcileTestPVC(t, ctx, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(volumeManager.cryptoUpdates) != 0 {
+		t.Errorf("expected no crypto update, got %d", len(volumeManager.cryptoUpdates))
+	}
+	assertMigrationCompleted(t, pvc)
+}
+
+func TestEncryptionMigrationFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	volumeManager := &fakeVolumeManager{updateErr: errors.New("key provider unreachable")}
+	r := newTestReconciler(t, ctx, volumeManager)
+
+	_, pvc, err := reconcileTestPVC(t, ctx, r)
+	if err == nil {
+		t.Fatal("expected the reconcile to fail")
+	}
+	if status := pvc.Annotations[crypto.PVCEncryptionMigrationStatusAnnotationName]; status !=
+		crypto.EncryptionMigrationStatusFailed {
+		t.Errorf("expected migration status %q, got %q", crypto.EncryptionMigrationStatusFailed, status)
+	}
+	if pvc.Annotations[crypto.PVCEncryptionMigrationAnnotationName] != "true" {
+		t.Errorf("expected the migration to remain requested")
+	}
+	if encClass := crypto.GetEncryptionClassNameForPVC(pvc); encClass != "" {
+		t.Errorf("expected no EncryptionClass on the PVC, got %q", encClass)
+	}
+}
@@ -19,6 +19,7 @@ package persistentvolumeclaim
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	byokv1 "github.com/vmware-tanzu/vm-operator/external/byok/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
@@ -93,3 +94,9 @@ func EncryptionClassToPersistentVolumeClaimMapper(
 		return requests
 	}
 }
+
+// isEncryptionMigrationRequested returns true if the PVC requests that its
+// unencrypted volume be encrypted in place.
+func isEncryptionMigrationRequested(pvc *corev1.PersistentVolumeClaim) bool {
+	return strings.EqualFold(pvc.GetAnnotations()[crypto.PVCEncryptionMigrationAnnotationName], "true")
+}
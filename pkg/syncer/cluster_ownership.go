@@ -0,0 +1,75 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+
+	volumes "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/volume"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+)
+
+// clusterOwnershipCheckLimit is the number of volumes of the cluster
+// inspected by the cluster ID ownership check at startup.
+const clusterOwnershipCheckLimit = 100
+
+// verifyClusterIDOwnership fails if volumes tagged with the given cluster ID
+// are owned by a container cluster of another flavor, i.e. if the cluster ID
+// is shared with another cluster of the vCenter. Reconciling the volumes of
+// such a cluster may delete the volumes of the other one.
+func verifyClusterIDOwnership(ctx context.Context, volManager volumes.Manager, vcHost string, clusterID string,
+	clusterFlavor cnstypes.CnsClusterFlavor) error {
+	log := logger.GetLogger(ctx)
+	if clusterID == "" {
+		return logger.LogNewErrorf(log, "cluster ID is not set for vCenter %q", vcHost)
+	}
+	queryResult, err := volManager.QueryVolume(ctx, cnstypes.CnsQueryFilter{
+		ContainerClusterIds: []string{clusterID},
+		Cursor:              &cnstypes.CnsCursor{Limit: clusterOwnershipCheckLimit},
+	})
+	if err != nil {
+		return logger.LogNewErrorf(log, "failed to query volumes of cluster %q in vCenter %q. Err: %v",
+			clusterID, vcHost, err)
+	}
+	for _, volume := range queryResult.Volumes {
+		if owner := getForeignClusterFlavor(volume, clusterID, clusterFlavor); owner != "" {
+			return logger.LogNewErrorf(log, "cluster ID %q is already used by a %s cluster in vCenter %q, "+
+				"e.g. for volume %q. Set a cluster ID unique to this cluster in the vSphere config secret",
+				clusterID, owner, vcHost, volume.VolumeId.Id)
+		}
+	}
+	log.Infof("Verified that cluster ID %q is not used by another cluster flavor in vCenter %q", clusterID, vcHost)
+	return nil
+}
+
+// getForeignClusterFlavor returns the flavor of the container cluster of the
+// volume with the given cluster ID if it differs from clusterFlavor, and an
+// empty string otherwise.
+func getForeignClusterFlavor(volume cnstypes.CnsVolume, clusterID string,
+	clusterFlavor cnstypes.CnsClusterFlavor) string {
+	containerClusters := append([]cnstypes.CnsContainerCluster{volume.Metadata.ContainerCluster},
+		volume.Metadata.ContainerClusterArray...)
+	for _, cluster := range containerClusters {
+		if cluster.ClusterId == clusterID && cluster.ClusterFlavor != "" &&
+			cluster.ClusterFlavor != string(clusterFlavor) {
+			return cluster.ClusterFlavor
+		}
+	}
+	return ""
+}
@@ -326,6 +326,18 @@ func (r *ReconcileCSINodeTopology) reconcileForVanilla(ctx context.Context, requ
 			return reconcile.Result{RequeueAfter: timeout}, nil
 		}
 
+		if r.configInfo.Cfg.Labels.HostTopology {
+			k8sNode := &corev1.Node{}
+			err = r.client.Get(ctx, types.NamespacedName{Name: instance.Name}, k8sNode)
+			if err != nil && !apierrors.IsNotFound(err) {
+				msg := fmt.Sprintf("failed to get node %q. Error: %v", instance.Name, err)
+				log.Error(msg)
+				_ = updateCRStatus(ctx, r, instance, csinodetopologyv1alpha1.CSINodeTopologyError, msg)
+				return reconcile.Result{RequeueAfter: timeout}, nil
+			}
+			topologyLabels = keepHostTopologyOfNode(ctx, k8sNode, topologyLabels)
+		}
+
 		// Update CSINodeTopology instance.
 		instance.Status.TopologyLabels = topologyLabels
 		err = updateCRStatus(ctx, r, instance, csinodetopologyv1alpha1.CSINodeTopologySuccess,
@@ -575,5 +587,42 @@ func getNodeTopologyInfo(ctx context.Context, nodeVM *cnsvsphere.VirtualMachine,
 				csinodetopologyv1alpha1.TopologyLabel{Key: common.TopologyLabelsDomain + "/" + key, Value: val})
 		}
 	}
+	if cfg.Labels.HostTopology {
+		host, err := nodeVM.HostSystem(ctx)
+		if err != nil {
+			return nil, logger.LogNewErrorf(log, "failed to get the host of nodeVM %v. Error: %v",
+				nodeVM.Reference(), err)
+		}
+		// The moref of the host is not unique across vCenters, use its UUID.
+		hostUUID, err := (&cnsvsphere.HostSystem{HostSystem: host}).GetHostUUID(ctx)
+		if err != nil {
+			return nil, logger.LogNewErrorf(log, "failed to get the UUID of host %v of nodeVM %v. Error: %v",
+				host.Reference(), nodeVM.Reference(), err)
+		}
+		topologyLabels = append(topologyLabels,
+			csinodetopologyv1alpha1.TopologyLabel{Key: common.HostTopologyLabel, Value: hostUUID})
+	}
 	return topologyLabels, nil
 }
+
+// keepHostTopologyOfNode keeps the host-level topology label the node already
+// carries if the node VM has since moved to another host, e.g. with a DRS
+// vMotion. Kubelet fails to re-register the driver on a node whose topology
+// labels change, so the node has to be drained and its host-level topology
+// label removed to move its topology to the new host.
+func keepHostTopologyOfNode(ctx context.Context, k8sNode *corev1.Node,
+	topologyLabels []csinodetopologyv1alpha1.TopologyLabel) []csinodetopologyv1alpha1.TopologyLabel {
+	log := logger.GetLogger(ctx)
+	nodeHost, ok := k8sNode.Labels[common.HostTopologyLabel]
+	if !ok {
+		return topologyLabels
+	}
+	for i, label := range topologyLabels {
+		if label.Key == common.HostTopologyLabel && label.Value != nodeHost {
+			log.Warnf("Node %q moved from host %q to host %q. Keeping its %q topology label, drain the node "+
+				"and remove the label to update it", k8sNode.Name, nodeHost, label.Value, common.HostTopologyLabel)
+			topologyLabels[i].Value = nodeHost
+		}
+	}
+	return topologyLabels
+}
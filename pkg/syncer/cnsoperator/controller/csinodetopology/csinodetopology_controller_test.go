@@ -34,6 +34,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	cnsconfig "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/config"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
 	csinodetopologyv1alpha1 "sigs.k8s.io/vsphere-csi-driver/v3/pkg/internalapis/csinodetopology/v1alpha1"
 )
 
@@ -190,3 +191,20 @@ func TestCSINodeTopologyControllerForTKGSHA(t *testing.T) {
 		})
 	}
 }
+
+func TestKeepHostTopologyOfNode(t *testing.T) {
+	ctx := context.Background()
+	zoneLabel := csinodetopologyv1alpha1.TopologyLabel{Key: common.TopologyLabelsDomain + "/k8s-zone", Value: "zone-a"}
+	getTopologyLabels := func(host string) []csinodetopologyv1alpha1.TopologyLabel {
+		return []csinodetopologyv1alpha1.TopologyLabel{zoneLabel, {Key: common.HostTopologyLabel, Value: host}}
+	}
+	k8sNode := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+
+	// A new node gets the topology of its current host.
+	assert.Equal(t, getTopologyLabels("host-2"), keepHostTopologyOfNode(ctx, k8sNode, getTopologyLabels("host-2")))
+
+	// A node which moved to another host keeps its host-level topology label.
+	k8sNode.Labels = map[string]string{common.HostTopologyLabel: "host-1"}
+	assert.Equal(t, getTopologyLabels("host-1"), keepHostTopologyOfNode(ctx, k8sNode, getTopologyLabels("host-2")))
+	assert.Equal(t, getTopologyLabels("host-1"), keepHostTopologyOfNode(ctx, k8sNode, getTopologyLabels("host-1")))
+}
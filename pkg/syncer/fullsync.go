@@ -119,6 +119,8 @@ func CsiFullSync(ctx context.Context, metadataSyncer *metadataSyncInformer, vc s
 		}
 		prometheus.FullSyncOpsHistVec.WithLabelValues(fullSyncStatus).Observe(
 			(time.Since(fullSyncStartTime)).Seconds())
+		prometheus.FullSyncDurationGauge.WithLabelValues(vc).Set(
+			(time.Since(fullSyncStartTime)).Seconds())
 	}()
 
 	// Get K8s PVs in State "Bound", "Available" or "Released" for the given VC.
@@ -230,8 +232,8 @@ func CsiFullSync(ctx context.Context, metadataSyncer *metadataSyncInformer, vc s
 		}
 	}
 
-	queryAllResult, err := utils.QueryAllVolumesForCluster(ctx, volManager,
-		metadataSyncer.configInfo.Cfg.Global.ClusterID, cnstypes.CnsQuerySelection{})
+	queryAllResult, err := fullSyncQueryAllVolumes(ctx, volManager,
+		metadataSyncer.configInfo.Cfg.Global.ClusterID, cnstypes.CnsQuerySelection{}, metadataSyncer)
 	if err != nil {
 		log.Errorf("FullSync for VC %s: QueryVolume failed with err=%+v", vc, err.Error())
 		return err
@@ -329,11 +331,12 @@ func CsiFullSync(ctx context.Context, metadataSyncer *metadataSyncInformer, vc s
 			Names: []string{
 				string(cnstypes.QuerySelectionNameTypeVolumeType),
 				string(cnstypes.QuerySelectionNameTypeBackingObjectDetails),
+				string(cnstypes.QuerySelectionNameTypeDataStoreUrl),
 			},
 		}
 		// get queryAllResult using new Supervisor ID for rest of full sync operations
-		queryAllResult, err = utils.QueryAllVolumesForCluster(ctx, volManager,
-			metadataSyncer.configInfo.Cfg.Global.SupervisorID, querySelection)
+		queryAllResult, err = fullSyncQueryAllVolumes(ctx, volManager,
+			metadataSyncer.configInfo.Cfg.Global.SupervisorID, querySelection, metadataSyncer)
 		if err != nil {
 			log.Errorf("FullSync for VC %s: QueryVolume failed with err=%+v", vc, err.Error())
 			return err
@@ -390,6 +393,13 @@ func CsiFullSync(ctx context.Context, metadataSyncer *metadataSyncInformer, vc s
 	go fullSyncDeleteVolumes(ctx, volToBeDeleted, metadataSyncer, &wg, migrationFeatureStateForFullSync, volManager, vc)
 	wg.Wait()
 
+	// Set the encryption annotations of the PVs missing them, and refresh the
+	// datastore URL annotations of the PVs whose volumes were relocated.
+	if metadataSyncer.clusterFlavor != cnstypes.CnsClusterFlavorGuest {
+		fullSyncPVEncryption(ctx, k8sPVs, volManager)
+		fullSyncPVDatastoreURL(ctx, k8sPVs, queryAllResult.Volumes)
+	}
+
 	cleanupCnsMaps(k8sPVMap, vc)
 	log.Debugf("FullSync for VC %s: cnsDeletionMap at end of cycle: %v", vc, cnsDeletionMap)
 	log.Debugf("FullSync for VC %s: cnsCreationMap at end of cycle: %v", vc, cnsCreationMap)
@@ -926,7 +936,9 @@ func fullSyncCreateVolumes(ctx context.Context, createSpecArray []cnstypes.CnsVo
 			currentK8sPVMap[volumeHandle] = pv
 		}
 	}
-	for _, createSpec := range createSpecArray {
+	var creationMapLock sync.Mutex
+	runFullSyncWorkers(ctx, len(createSpecArray), func(i int) {
+		createSpec := createSpecArray[i]
 		// Create volume if present in currentK8sPVMap.
 		var volumeID string
 		if createSpec.VolumeType == common.BlockVolumeType && createSpec.BackingObjectDetails != nil &&
@@ -939,7 +951,7 @@ func fullSyncCreateVolumes(ctx context.Context, createSpecArray []cnstypes.CnsVo
 		} else {
 			log.Warnf("Skipping createSpec: %+v as VolumeType is unknown or BackingObjectDetails is not valid",
 				spew.Sdump(createSpec))
-			continue
+			return
 		}
 		if pv, existsInK8s := currentK8sPVMap[volumeID]; existsInK8s {
 			log.Debugf("FullSync for VC %s: Calling CreateVolume for volume id: %q with createSpec %+v",
@@ -948,7 +960,7 @@ func fullSyncCreateVolumes(ctx context.Context, createSpecArray []cnstypes.CnsVo
 			if err != nil {
 				log.Warnf("FullSync for VC %s: Failed to create volume with the spec: %+v. "+
 					"Err: %+v", vc, spew.Sdump(createSpec), err)
-				continue
+				return
 			}
 
 			if !isDynamicallyCreatedVolume(ctx, pv) {
@@ -969,9 +981,10 @@ func fullSyncCreateVolumes(ctx context.Context, createSpecArray []cnstypes.CnsVo
 			log.Debugf("FullSync for VC %s: volumeID %s does not exist in Kubernetes, "+
 				"no need to create volume in CNS", vc, volumeID)
 		}
+		creationMapLock.Lock()
 		delete(cnsCreationMap[vc], volumeID)
-	}
-
+		creationMapLock.Unlock()
+	})
 }
 
 // fullSyncDeleteVolumes deletes volumes with given array of volumeId.
@@ -1031,53 +1044,59 @@ func fullSyncDeleteVolumes(ctx context.Context, volumeIDDeleteArray []cnstypes.C
 		log.Errorf("FullSync for VC %s: fullSyncGetQueryResults failed to query volume metadata from vc. Err: %v", vc, err)
 		return
 	}
-	// Verify if Volume is not in use by any other Cluster before removing CNS tag
+	var queriedVolumes []cnstypes.CnsVolume
 	for _, queryResult := range allQueryResults {
-		for _, volume := range queryResult.Volumes {
-			inUsebyOtherK8SCluster := false
-			for _, metadata := range volume.Metadata.EntityMetadata {
-				if metadata.(*cnstypes.CnsKubernetesEntityMetadata).ClusterID != clusterIDforVolumeMetadata {
-					inUsebyOtherK8SCluster = true
-					log.Debugf("FullSync for VC %s: fullSyncDeleteVolumes: Volume: %q is "+
-						"in use by other cluster.", vc, volume.VolumeId.Id)
-					break
-				}
+		queriedVolumes = append(queriedVolumes, queryResult.Volumes...)
+	}
+	var deletionMapLock sync.Mutex
+	// Verify if Volume is not in use by any other Cluster before removing CNS tag
+	runFullSyncWorkers(ctx, len(queriedVolumes), func(i int) {
+		volume := queriedVolumes[i]
+		inUsebyOtherK8SCluster := false
+		for _, metadata := range volume.Metadata.EntityMetadata {
+			if metadata.(*cnstypes.CnsKubernetesEntityMetadata).ClusterID != clusterIDforVolumeMetadata {
+				inUsebyOtherK8SCluster = true
+				log.Debugf("FullSync for VC %s: fullSyncDeleteVolumes: Volume: %q is "+
+					"in use by other cluster.", vc, volume.VolumeId.Id)
+				break
+			}
+		}
+		if !inUsebyOtherK8SCluster {
+			log.Infof("FullSync for VC %s: fullSyncDeleteVolumes: Calling DeleteVolume for volume %v with delete disk %v",
+				vc, volume.VolumeId.Id, deleteDisk)
+			_, err := volManager.DeleteVolume(ctx, volume.VolumeId.Id, deleteDisk)
+			if err != nil {
+				log.Warnf("FullSync for VC %s: fullSyncDeleteVolumes: Failed to delete volume %s with error %+v",
+					vc, volume.VolumeId.Id, err)
+				return
 			}
-			if !inUsebyOtherK8SCluster {
-				log.Infof("FullSync for VC %s: fullSyncDeleteVolumes: Calling DeleteVolume for volume %v with delete disk %v",
-					vc, volume.VolumeId.Id, deleteDisk)
-				_, err := volManager.DeleteVolume(ctx, volume.VolumeId.Id, deleteDisk)
-				if err != nil {
-					log.Warnf("FullSync for VC %s: fullSyncDeleteVolumes: Failed to delete volume %s with error %+v",
-						vc, volume.VolumeId.Id, err)
-					continue
-				}
 
-				if isMultiVCenterFssEnabled && len(metadataSyncer.configInfo.Cfg.VirtualCenter) > 1 {
-					// Delete CNSVolumeInfo CR for the volume ID.
-					err = volumeInfoService.DeleteVolumeInfo(ctx, volume.VolumeId.Id)
-					if err != nil {
-						log.Errorf("failed to remove volumeID %q for vCenter %q from CNSVolumeInfo CR. Error: %+v",
-							volume.VolumeId.Id, vc, err)
-					}
+			if isMultiVCenterFssEnabled && len(metadataSyncer.configInfo.Cfg.VirtualCenter) > 1 {
+				// Delete CNSVolumeInfo CR for the volume ID.
+				err = volumeInfoService.DeleteVolumeInfo(ctx, volume.VolumeId.Id)
+				if err != nil {
+					log.Errorf("failed to remove volumeID %q for vCenter %q from CNSVolumeInfo CR. Error: %+v",
+						volume.VolumeId.Id, vc, err)
 				}
+			}
 
-				if migrationFeatureStateForFullSync {
-					err = volumeMigrationService.DeleteVolumeInfo(ctx, volume.VolumeId.Id)
-					// For non-migrated volumes DeleteVolumeInfo will not return
-					// error. So, the volume id will be deleted from cnsDeletionMap.
-					if err != nil {
-						log.Warnf("FullSync for VC %s: fullSyncDeleteVolumes: Failed to delete volume mapping CR for %s. Err: %+v",
-							vc, volume.VolumeId.Id, err)
-						continue
-					}
+			if migrationFeatureStateForFullSync {
+				err = volumeMigrationService.DeleteVolumeInfo(ctx, volume.VolumeId.Id)
+				// For non-migrated volumes DeleteVolumeInfo will not return
+				// error. So, the volume id will be deleted from cnsDeletionMap.
+				if err != nil {
+					log.Warnf("FullSync for VC %s: fullSyncDeleteVolumes: Failed to delete volume mapping CR for %s. Err: %+v",
+						vc, volume.VolumeId.Id, err)
+					return
 				}
 			}
-			// Delete volume from cnsDeletionMap which is successfully deleted from
-			// CNS.
-			delete(cnsDeletionMap[vc], volume.VolumeId.Id)
 		}
-	}
+		// Delete volume from cnsDeletionMap which is successfully deleted from
+		// CNS.
+		deletionMapLock.Lock()
+		delete(cnsDeletionMap[vc], volume.VolumeId.Id)
+		deletionMapLock.Unlock()
+	})
 }
 
 // fullSyncUpdateVolumes update metadata for volumes with given array of
@@ -1087,19 +1106,61 @@ func fullSyncUpdateVolumes(ctx context.Context, updateSpecArray []cnstypes.CnsVo
 	vc string) {
 	defer wg.Done()
 	log := logger.GetLogger(ctx)
+	// A volume may have several update specs, e.g. one per pod using it. The
+	// specs of a volume are applied in order by the same worker.
+	var volumeIDs []string
+	volumeUpdateSpecs := make(map[string][]cnstypes.CnsVolumeMetadataUpdateSpec)
 	for _, updateSpec := range updateSpecArray {
-		log.Debugf("FullSync for VC %s: Calling UpdateVolumeMetadata for volume %s with updateSpec: %+v",
-			vc, updateSpec.VolumeId.Id, spew.Sdump(updateSpec))
-		if err := volManager.UpdateVolumeMetadata(ctx, &updateSpec); err != nil {
-			log.Warnf("FullSync for VC %s: UpdateVolumeMetadata failed with err %v", vc, err)
+		if _, ok := volumeUpdateSpecs[updateSpec.VolumeId.Id]; !ok {
+			volumeIDs = append(volumeIDs, updateSpec.VolumeId.Id)
 		}
+		volumeUpdateSpecs[updateSpec.VolumeId.Id] = append(volumeUpdateSpecs[updateSpec.VolumeId.Id], updateSpec)
 	}
+	runFullSyncWorkers(ctx, len(volumeIDs), func(i int) {
+		for _, updateSpec := range volumeUpdateSpecs[volumeIDs[i]] {
+			log.Debugf("FullSync for VC %s: Calling UpdateVolumeMetadata for volume %s with updateSpec: %+v",
+				vc, updateSpec.VolumeId.Id, spew.Sdump(updateSpec))
+			if err := volManager.UpdateVolumeMetadata(ctx, &updateSpec); err != nil {
+				log.Warnf("FullSync for VC %s: UpdateVolumeMetadata failed with err %v", vc, err)
+			}
+		}
+	})
+}
+
+// runFullSyncWorkers calls process with the indexes 0 to n-1 from the full
+// sync worker pool, and returns once all the calls are done. The calls are
+// rate limited by the limiter shared by all the full sync workers, so that
+// the workers do not overload vCenter.
+func runFullSyncWorkers(ctx context.Context, n int, process func(i int)) {
+	log := logger.GetLogger(ctx)
+	workers := min(getFullSyncWorkers(ctx), n)
+	rateLimiter := getFullSyncRateLimiter(ctx)
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := rateLimiter.Wait(ctx); err != nil {
+					log.Warnf("FullSync: skipping operation as the context is done. Err: %v", err)
+					continue
+				}
+				process(i)
+			}
+		}()
+	}
+	for i := range n {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
 }
 
 // buildCnsMetadataList build metadata list for given PV.
 // Metadata list may include PV metadata, PVC metadata and POD metadata.
 func buildCnsMetadataList(ctx context.Context, pv *v1.PersistentVolume, pvToPVCMap pvcMap,
-	pvcToPodMap podMap, clusterID string, vc string) []cnstypes.BaseCnsEntityMetadata {
+	pvcToPodMap podMap, clusterID string, vc string, syncedPVCLabelKeys []string) []cnstypes.BaseCnsEntityMetadata {
 	log := logger.GetLogger(ctx)
 	var metadataList []cnstypes.BaseCnsEntityMetadata
 	// Get pv metadata.
@@ -1110,7 +1171,8 @@ func buildCnsMetadataList(ctx context.Context, pv *v1.PersistentVolume, pvToPVCM
 		// Get pvc metadata.
 		pvEntityReference := cnsvsphere.CreateCnsKuberenetesEntityReference(
 			string(cnstypes.CnsKubernetesEntityTypePV), pv.Name, "", clusterID)
-		pvcMetadata := cnsvsphere.GetCnsKubernetesEntityMetaData(pvc.Name, pvc.GetLabels(),
+		pvcMetadata := cnsvsphere.GetCnsKubernetesEntityMetaData(pvc.Name,
+			getCnsPVCLabels(ctx, pvc, syncedPVCLabelKeys),
 			false, string(cnstypes.CnsKubernetesEntityTypePVC), pvc.Namespace, clusterID,
 			[]cnstypes.CnsKubernetesEntityReference{pvEntityReference})
 		metadataList = append(metadataList, cnstypes.BaseCnsEntityMetadata(pvcMetadata))
@@ -1154,8 +1216,10 @@ func fullSyncConstructVolumeMaps(ctx context.Context, pvList []*v1.PersistentVol
 	}
 	var err error
 	var queryVolumeIds []cnstypes.CnsVolumeId
+	syncedPVCLabelKeys := getSyncedPVCLabelKeys(metadataSyncer.configInfo.Cfg)
 	for _, pv := range pvList {
-		k8sMetadata := buildCnsMetadataList(ctx, pv, pvToPVCMap, pvcToPodMap, clusterIDforVolumeMetadata, vc)
+		k8sMetadata := buildCnsMetadataList(ctx, pv, pvToPVCMap, pvcToPodMap, clusterIDforVolumeMetadata, vc,
+			syncedPVCLabelKeys)
 		var volumeHandle string
 		if pv.Spec.CSI != nil {
 			volumeHandle = pv.Spec.CSI.VolumeHandle
@@ -1414,8 +1478,30 @@ func getVolumesToBeDeleted(ctx context.Context, cnsVolumeList []cnstypes.CnsVolu
 			return volToBeDeleted, err
 		}
 	}
+	orphanVolumeCleanupEnabled := metadataSyncer.clusterFlavor == cnstypes.CnsClusterFlavorVanilla &&
+		!isOrphanVolumeCleanupDryRun(ctx)
 	for _, vol := range cnsVolumeList {
 		if _, existsInK8s := k8sPVMap[vol.VolumeId.Id]; !existsInK8s {
+			if orphanVolumeCleanupEnabled && len(vol.Metadata.EntityMetadata) == 0 {
+				// Volumes never tracked by Kubernetes are deleted by the orphan
+				// volume cleanup, along with their disk only if they were
+				// created by the driver.
+				log.Debugf("FullSync for VC %s: Skipping volume with id %s which has no Kubernetes metadata",
+					vc, vol.VolumeId.Id)
+				continue
+			}
+			if common.IsEphemeralVolume(&vol) {
+				// Ephemeral inline volumes are deleted by the node plugin, or by the
+				// orphan volume cleanup once their pod is gone.
+				log.Debugf("FullSync for VC %s: Skipping ephemeral volume with id %s", vc, vol.VolumeId.Id)
+				continue
+			}
+			if common.GetSoftDeletedEntityMetadata(&vol, clusterIDforVolumeMetadata) != nil {
+				// Soft deleted volumes are destroyed by the controller once their
+				// deletion retention window has elapsed.
+				log.Debugf("FullSync for VC %s: Skipping soft deleted volume with id %s", vc, vol.VolumeId.Id)
+				continue
+			}
 			if _, existsInCnsDeletionMap := cnsDeletionMap[vc][vol.VolumeId.Id]; existsInCnsDeletionMap {
 				// Volume does not exist in K8s across two fullsync cycles, because
 				// it was present in cnsDeletionMap across two full sync cycles.
@@ -0,0 +1,217 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"slices"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/prometheus"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/types"
+)
+
+// csiReconcileMetadataDrift corrects the PVC entity metadata of the volumes
+// of this cluster on the given vCenter which does not match the PVC bound to
+// their PV, e.g. after a restore of the PVC in another namespace. To avoid
+// racing with the metadata syncer while a PVC is being bound or deleted, a
+// volume is corrected only if it is found drifting in two consecutive passes.
+func csiReconcileMetadataDrift(ctx context.Context, metadataSyncer *metadataSyncInformer, vc string) {
+	log := logger.GetLogger(ctx)
+	log.Debugf("csiReconcileMetadataDrift for %s: start", vc)
+	volManager, err := getVolManagerForVcHost(ctx, vc, metadataSyncer)
+	if err != nil {
+		log.Errorf("csiReconcileMetadataDrift for %s: Failed to get volume manager. Err: %v", vc, err)
+		return
+	}
+	vcHostObj, ok := metadataSyncer.configInfo.Cfg.VirtualCenter[vc]
+	if !ok {
+		log.Errorf("csiReconcileMetadataDrift for %s: Failed to find vCenter config", vc)
+		return
+	}
+	pvs, err := metadataSyncer.pvLister.List(labels.Everything())
+	if err != nil {
+		log.Errorf("csiReconcileMetadataDrift for %s: Failed to get PVs from kubernetes. Err: %+v", vc, err)
+		return
+	}
+	// Volumes published as sub paths may be shared by several PVs, each bound
+	// to its own PVC.
+	boundPVs := make(map[string][]boundPV)
+	var volumeIDs []cnstypes.CnsVolumeId
+	for _, pv := range pvs {
+		pvc := getBoundPVC(metadataSyncer, pv)
+		if pvc == nil {
+			continue
+		}
+		volumeID := pv.Spec.CSI.VolumeHandle
+		if _, exists := boundPVs[volumeID]; !exists {
+			volumeIDs = append(volumeIDs, cnstypes.CnsVolumeId{Id: volumeID})
+		}
+		boundPVs[volumeID] = append(boundPVs[volumeID], boundPV{pvName: pv.Name, pvc: pvc})
+	}
+	if len(volumeIDs) == 0 {
+		metadataDriftFirstSeen[vc] = nil
+		return
+	}
+
+	// Metadata syncer and full sync may update the metadata of volumes of this
+	// vCenter concurrently, hold the shared lock while reconciling.
+	volumeOperationsLock[vc].Lock()
+	defer volumeOperationsLock[vc].Unlock()
+	queryResults, err := fullSyncGetQueryResults(ctx, volumeIDs, clusterIDforVolumeMetadata, volManager,
+		metadataSyncer)
+	if err != nil {
+		log.Errorf("csiReconcileMetadataDrift for %s: failed to query volumes. Err: %v", vc, err)
+		return
+	}
+	drifting := make(map[string]bool)
+	for _, queryResult := range queryResults {
+		for i := range queryResult.Volumes {
+			volume := &queryResult.Volumes[i]
+			volumeID := volume.VolumeId.Id
+			if len(boundPVs[volumeID]) == 0 {
+				continue
+			}
+			var pvcs []*v1.PersistentVolumeClaim
+			for _, bound := range boundPVs[volumeID] {
+				pvcs = append(pvcs, bound.pvc)
+			}
+			missing, staleMetadata := getPVCEntityMetadataDrift(volume, pvcs, clusterIDforVolumeMetadata)
+			if len(missing) == 0 && len(staleMetadata) == 0 {
+				continue
+			}
+			var metadataList []cnstypes.BaseCnsEntityMetadata
+			for _, bound := range boundPVs[volumeID] {
+				pvc := bound.pvc
+				if len(staleMetadata) == 0 && !slices.Contains(missing, pvc) {
+					continue
+				}
+				key := bound.driftKey()
+				drifting[key] = true
+				if !metadataDriftFirstSeen[vc][key] {
+					log.Infof("csiReconcileMetadataDrift for %s: PVC metadata of volume %q does not match PVC %s/%s "+
+						"bound to PV %q, correcting it in the next pass if it still drifts",
+						vc, volumeID, pvc.Namespace, pvc.Name, bound.pvName)
+					continue
+				}
+				log.Infof("csiReconcileMetadataDrift for %s: Correcting PVC metadata of volume %q to PVC %s/%s "+
+					"bound to PV %q", vc, volumeID, pvc.Namespace, pvc.Name, bound.pvName)
+				entityReference := cnsvsphere.CreateCnsKuberenetesEntityReference(
+					string(cnstypes.CnsKubernetesEntityTypePV), bound.pvName, "", clusterIDforVolumeMetadata)
+				pvcLabels := getCnsPVCLabels(ctx, pvc, getSyncedPVCLabelKeys(metadataSyncer.configInfo.Cfg))
+				metadataList = append(metadataList, cnsvsphere.GetCnsKubernetesEntityMetaData(pvc.Name, pvcLabels,
+					false, string(cnstypes.CnsKubernetesEntityTypePVC), pvc.Namespace, clusterIDforVolumeMetadata,
+					[]cnstypes.CnsKubernetesEntityReference{entityReference}))
+			}
+			if len(metadataList) == 0 {
+				continue
+			}
+			for _, stale := range staleMetadata {
+				metadataList = append(metadataList, cnsvsphere.GetCnsKubernetesEntityMetaData(stale.EntityName, nil,
+					true, string(cnstypes.CnsKubernetesEntityTypePVC), stale.Namespace, clusterIDforVolumeMetadata,
+					nil))
+			}
+			containerCluster := cnsvsphere.GetContainerCluster(clusterIDforVolumeMetadata, vcHostObj.User,
+				metadataSyncer.clusterFlavor, metadataSyncer.configInfo.Cfg.Global.ClusterDistribution)
+			updateSpec := &cnstypes.CnsVolumeMetadataUpdateSpec{
+				VolumeId: volume.VolumeId,
+				Metadata: cnstypes.CnsVolumeMetadata{
+					ContainerCluster:      containerCluster,
+					ContainerClusterArray: []cnstypes.CnsContainerCluster{containerCluster},
+					EntityMetadata:        metadataList,
+				},
+			}
+			if err := volManager.UpdateVolumeMetadata(ctx, updateSpec); err != nil {
+				log.Errorf("csiReconcileMetadataDrift for %s: Failed to correct PVC metadata of volume %q. Err: %v",
+					vc, volumeID, err)
+				continue
+			}
+			prometheus.MetadataDriftCorrectionCount.Inc()
+			for _, bound := range boundPVs[volumeID] {
+				delete(drifting, bound.driftKey())
+			}
+		}
+	}
+	metadataDriftFirstSeen[vc] = drifting
+	log.Debugf("csiReconcileMetadataDrift for %s: end", vc)
+}
+
+// boundPV is a PV of a volume along with the PVC bound to it.
+type boundPV struct {
+	pvName string
+	pvc    *v1.PersistentVolumeClaim
+}
+
+// driftKey returns the key of the PV in metadataDriftFirstSeen. The UID of the
+// PVC is part of the key, so that a PVC re-created with the same name is not
+// corrected before it is found drifting in two passes.
+func (b boundPV) driftKey() string {
+	return b.pvName + "/" + string(b.pvc.UID)
+}
+
+// getBoundPVC returns the PVC bound to the given PV of this driver, or nil if
+// the PV is not bound, e.g. while the PVC is being bound or deleted.
+func getBoundPVC(metadataSyncer *metadataSyncInformer, pv *v1.PersistentVolume) *v1.PersistentVolumeClaim {
+	if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != csitypes.Name || pv.Status.Phase != v1.VolumeBound ||
+		pv.Spec.ClaimRef == nil || pv.DeletionTimestamp != nil {
+		return nil
+	}
+	pvc, err := metadataSyncer.pvcLister.PersistentVolumeClaims(pv.Spec.ClaimRef.Namespace).Get(
+		pv.Spec.ClaimRef.Name)
+	if err != nil || pvc.UID != pv.Spec.ClaimRef.UID || pvc.Status.Phase != v1.ClaimBound ||
+		pvc.DeletionTimestamp != nil {
+		return nil
+	}
+	return pvc
+}
+
+// getPVCEntityMetadataDrift compares the PVC entity metadata of the volume
+// for the given cluster with the PVCs bound to its PVs. It returns the PVCs
+// without PVC entity metadata, and the PVC entity metadata of other PVCs. The
+// metadata is in sync if both are empty.
+func getPVCEntityMetadataDrift(volume *cnstypes.CnsVolume, pvcs []*v1.PersistentVolumeClaim,
+	clusterID string) ([]*v1.PersistentVolumeClaim, []*cnstypes.CnsKubernetesEntityMetadata) {
+	var staleMetadata []*cnstypes.CnsKubernetesEntityMetadata
+	found := make(map[*v1.PersistentVolumeClaim]bool)
+	for _, metadata := range volume.Metadata.EntityMetadata {
+		k8sMetadata, ok := metadata.(*cnstypes.CnsKubernetesEntityMetadata)
+		if !ok || k8sMetadata.ClusterID != clusterID ||
+			k8sMetadata.EntityType != string(cnstypes.CnsKubernetesEntityTypePVC) {
+			continue
+		}
+		idx := slices.IndexFunc(pvcs, func(pvc *v1.PersistentVolumeClaim) bool {
+			return k8sMetadata.EntityName == pvc.Name && k8sMetadata.Namespace == pvc.Namespace
+		})
+		if idx >= 0 {
+			found[pvcs[idx]] = true
+			continue
+		}
+		staleMetadata = append(staleMetadata, k8sMetadata)
+	}
+	var missing []*v1.PersistentVolumeClaim
+	for _, pvc := range pvcs {
+		if !found[pvc] {
+			missing = append(missing, pvc)
+		}
+	}
+	return missing, staleMetadata
+}
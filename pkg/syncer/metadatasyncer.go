@@ -45,6 +45,7 @@ import (
 	clientset "k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/flowcontrol"
 	"k8s.io/client-go/util/workqueue"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
@@ -166,6 +167,67 @@ func getFullSyncIntervalInMin(ctx context.Context) int {
 	return fullSyncIntervalInMin
 }
 
+// getFullSyncWorkers returns the number of workers concurrently running the
+// CNS operations of a full sync.
+// If environment variable FULL_SYNC_WORKERS is set and valid, return the
+// value read from environment variable. Otherwise, use the default value 4.
+func getFullSyncWorkers(ctx context.Context) int {
+	log := logger.GetLogger(ctx)
+	if v := os.Getenv("FULL_SYNC_WORKERS"); v != "" {
+		if value, err := strconv.Atoi(v); err == nil && value > 0 {
+			return value
+		}
+		log.Warnf("FullSync: number of workers set in env variable FULL_SYNC_WORKERS %s "+
+			"is invalid, will use the default value %d", v, defaultFullSyncWorkers)
+	}
+	return defaultFullSyncWorkers
+}
+
+// getFullSyncQueryBatchSize returns the number of volumes queried from CNS
+// per batch by a full sync.
+// If environment variable FULL_SYNC_QUERY_BATCH_SIZE is set and valid, return
+// the value read from environment variable. Otherwise, use the default value
+// 500.
+func getFullSyncQueryBatchSize(ctx context.Context) int64 {
+	log := logger.GetLogger(ctx)
+	if v := os.Getenv("FULL_SYNC_QUERY_BATCH_SIZE"); v != "" {
+		if value, err := strconv.ParseInt(v, 10, 64); err == nil && value > 0 {
+			return value
+		}
+		log.Warnf("FullSync: query batch size set in env variable FULL_SYNC_QUERY_BATCH_SIZE %s "+
+			"is invalid, will use the default value %d", v, defaultFullSyncQueryBatchSize)
+	}
+	return defaultFullSyncQueryBatchSize
+}
+
+var (
+	// fullSyncRateLimiter limits the rate of the CNS operations of full syncs.
+	fullSyncRateLimiter     flowcontrol.RateLimiter
+	fullSyncRateLimiterOnce sync.Once
+)
+
+// getFullSyncRateLimiter returns the rate limiter shared by the full sync
+// workers. If environment variable FULL_SYNC_CNS_OPS_PER_SECOND is set and
+// valid, the CNS operations are limited to the rate read from environment
+// variable. Otherwise, use the default rate of 20 operations per second.
+func getFullSyncRateLimiter(ctx context.Context) flowcontrol.RateLimiter {
+	fullSyncRateLimiterOnce.Do(func() {
+		log := logger.GetLogger(ctx)
+		opsPerSecond := defaultFullSyncCnsOpsPerSecond
+		if v := os.Getenv("FULL_SYNC_CNS_OPS_PER_SECOND"); v != "" {
+			if value, err := strconv.Atoi(v); err == nil && value > 0 {
+				opsPerSecond = value
+			} else {
+				log.Warnf("FullSync: rate set in env variable FULL_SYNC_CNS_OPS_PER_SECOND %s "+
+					"is invalid, will use the default rate %d", v, defaultFullSyncCnsOpsPerSecond)
+			}
+		}
+		log.Infof("FullSync: CNS operations are limited to %d per second", opsPerSecond)
+		fullSyncRateLimiter = flowcontrol.NewTokenBucketRateLimiter(float32(opsPerSecond), opsPerSecond)
+	})
+	return fullSyncRateLimiter
+}
+
 // getVolumeHealthIntervalInMin returns the VolumeHealthInterval.
 // If environment variable VOLUME_HEALTH_STATUS_INTERVAL_MINUTES is set and valid,
 // return the interval value read from environment variable.
@@ -190,6 +252,31 @@ func getVolumeHealthIntervalInMin(ctx context.Context) int {
 	return volumeHealthIntervalInMin
 }
 
+// getPolicyComplianceIntervalInMin returns the interval of the storage policy compliance check.
+// If environment variable POLICY_COMPLIANCE_INTERVAL_MINUTES is set and valid,
+// return the interval value read from environment variable.
+// Otherwise, use the default value 60 minutes.
+func getPolicyComplianceIntervalInMin(ctx context.Context) int {
+	log := logger.GetLogger(ctx)
+	policyComplianceIntervalInMin := defaultPolicyComplianceIntervalInMin
+	if v := os.Getenv("POLICY_COMPLIANCE_INTERVAL_MINUTES"); v != "" {
+		if value, err := strconv.Atoi(v); err == nil {
+			if value <= 0 {
+				log.Warnf("PolicyCompliance: PolicyCompliance interval set in env variable "+
+					"POLICY_COMPLIANCE_INTERVAL_MINUTES %s is equal or less than 0, will use the default interval", v)
+			} else {
+				policyComplianceIntervalInMin = value
+				log.Infof("PolicyCompliance: PolicyCompliance interval is set to %d minutes",
+					policyComplianceIntervalInMin)
+			}
+		} else {
+			log.Warnf("PolicyCompliance: PolicyCompliance interval set in env variable "+
+				"POLICY_COMPLIANCE_INTERVAL_MINUTES %s is invalid, will use the default interval", v)
+		}
+	}
+	return policyComplianceIntervalInMin
+}
+
 // getPVtoBackingDiskObjectIdIntervalInMin returns pv to backingdiskobjectid interval.
 func getPVtoBackingDiskObjectIdIntervalInMin(ctx context.Context) int {
 	log := logger.GetLogger(ctx)
@@ -213,6 +300,87 @@ func getPVtoBackingDiskObjectIdIntervalInMin(ctx context.Context) int {
 	return pvtoBackingDiskObjectIdIntervalInMin
 }
 
+// getOrphanVolumeCleanupIntervalInMin returns the interval of the orphan volume cleanup.
+// If environment variable ORPHAN_VOLUME_CLEANUP_INTERVAL_MINUTES is set and valid,
+// return the interval value read from environment variable.
+// Otherwise, use the default value 60 minutes.
+func getOrphanVolumeCleanupIntervalInMin(ctx context.Context) int {
+	log := logger.GetLogger(ctx)
+	orphanVolumeCleanupIntervalInMin := defaultOrphanVolumeCleanupIntervalInMin
+	if v := os.Getenv("ORPHAN_VOLUME_CLEANUP_INTERVAL_MINUTES"); v != "" {
+		if value, err := strconv.Atoi(v); err == nil {
+			if value <= 0 {
+				log.Warnf("OrphanVolumeCleanup: OrphanVolumeCleanup interval set in env variable "+
+					"ORPHAN_VOLUME_CLEANUP_INTERVAL_MINUTES %s is equal or less than 0, will use the default interval", v)
+			} else {
+				orphanVolumeCleanupIntervalInMin = value
+				log.Infof("OrphanVolumeCleanup: OrphanVolumeCleanup interval is set to %d minutes",
+					orphanVolumeCleanupIntervalInMin)
+			}
+		} else {
+			log.Warnf("OrphanVolumeCleanup: OrphanVolumeCleanup interval set in env variable "+
+				"ORPHAN_VOLUME_CLEANUP_INTERVAL_MINUTES %s is invalid, will use the default interval", v)
+		}
+	}
+	return orphanVolumeCleanupIntervalInMin
+}
+
+// getMetadataDriftReconcileIntervalInMin returns the interval of the metadata
+// drift reconciliation.
+// If environment variable METADATA_DRIFT_RECONCILE_INTERVAL_MINUTES is set and
+// valid, return the interval value read from environment variable.
+// Otherwise, use the default value 30 minutes.
+func getMetadataDriftReconcileIntervalInMin(ctx context.Context) int {
+	log := logger.GetLogger(ctx)
+	metadataDriftReconcileIntervalInMin := defaultMetadataDriftReconcileIntervalInMin
+	if v := os.Getenv("METADATA_DRIFT_RECONCILE_INTERVAL_MINUTES"); v != "" {
+		if value, err := strconv.Atoi(v); err == nil && value > 0 {
+			metadataDriftReconcileIntervalInMin = value
+			log.Infof("MetadataDriftReconcile: MetadataDriftReconcile interval is set to %d minutes",
+				metadataDriftReconcileIntervalInMin)
+		} else {
+			log.Warnf("MetadataDriftReconcile: MetadataDriftReconcile interval set in env variable "+
+				"METADATA_DRIFT_RECONCILE_INTERVAL_MINUTES %s is invalid, will use the default interval", v)
+		}
+	}
+	return metadataDriftReconcileIntervalInMin
+}
+
+// getOrphanVolumeGracePeriodInMin returns the time for which a volume must
+// have had no PV to be considered orphaned.
+// If environment variable ORPHAN_VOLUME_GRACE_PERIOD_MINUTES is set and valid,
+// return the value read from environment variable.
+// Otherwise, use the default value 60 minutes.
+func getOrphanVolumeGracePeriodInMin(ctx context.Context) int {
+	log := logger.GetLogger(ctx)
+	orphanVolumeGracePeriodInMin := defaultOrphanVolumeGracePeriodInMin
+	if v := os.Getenv("ORPHAN_VOLUME_GRACE_PERIOD_MINUTES"); v != "" {
+		if value, err := strconv.Atoi(v); err == nil && value > 0 {
+			orphanVolumeGracePeriodInMin = value
+		} else {
+			log.Warnf("OrphanVolumeCleanup: grace period set in env variable "+
+				"ORPHAN_VOLUME_GRACE_PERIOD_MINUTES %s is invalid, will use the default grace period", v)
+		}
+	}
+	return orphanVolumeGracePeriodInMin
+}
+
+// isOrphanVolumeCleanupDryRun returns whether orphaned volumes are only
+// reported instead of being deleted. Orphaned volumes are deleted only if
+// environment variable ORPHAN_VOLUME_CLEANUP_DRY_RUN is set to false.
+func isOrphanVolumeCleanupDryRun(ctx context.Context) bool {
+	log := logger.GetLogger(ctx)
+	if v := os.Getenv("ORPHAN_VOLUME_CLEANUP_DRY_RUN"); v != "" {
+		dryRun, err := strconv.ParseBool(v)
+		if err == nil {
+			return dryRun
+		}
+		log.Warnf("OrphanVolumeCleanup: value set in env variable ORPHAN_VOLUME_CLEANUP_DRY_RUN %s "+
+			"is invalid, will run in dry run mode", v)
+	}
+	return true
+}
+
 // InitMetadataSyncer initializes the Metadata Sync Informer.
 func InitMetadataSyncer(ctx context.Context, clusterFlavor cnstypes.CnsClusterFlavor,
 	configInfo *cnsconfig.ConfigurationInfo) error {
@@ -223,6 +391,10 @@ func InitMetadataSyncer(ctx context.Context, clusterFlavor cnstypes.CnsClusterFl
 	metadataSyncer := newInformer()
 	MetadataSyncer = metadataSyncer
 	metadataSyncer.configInfo = configInfo
+	volumes.SetSlowOperationThreshold(ctx, volumes.GetSlowOperationThresholdFromEnv(ctx))
+	volumes.SetAuditLogEnabled(ctx, configInfo.Cfg.Global.CnsAuditLogEnabled)
+	volumes.SetQueryVolumeCacheConfig(ctx, configInfo.Cfg.Global.QueryVolumeCacheTTLInSec,
+		configInfo.Cfg.Global.QueryVolumeCacheDisabled)
 
 	if clusterFlavor == cnstypes.CnsClusterFlavorVanilla {
 		isMultiVCenterFssEnabled = commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.MultiVCenterCSITopology)
@@ -556,6 +728,11 @@ func InitMetadataSyncer(ctx context.Context, clusterFlavor cnstypes.CnsClusterFl
 				return logger.LogNewErrorf(log, "failed to create an instance of volume manager. err=%v", err)
 			}
 			metadataSyncer.volumeManager = volumeManager
+			err = verifyClusterIDOwnership(ctx, volumeManager, vCenter.Config.Host, configInfo.Cfg.Global.ClusterID,
+				metadataSyncer.clusterFlavor)
+			if err != nil {
+				return err
+			}
 		} else {
 			vcconfigs, err := cnsvsphere.GetVirtualCenterConfigs(ctx, configInfo.Cfg)
 			if err != nil {
@@ -579,6 +756,11 @@ func InitMetadataSyncer(ctx context.Context, clusterFlavor cnstypes.CnsClusterFl
 				if err != nil {
 					return logger.LogNewErrorf(log, "failed to create an instance of volume manager. err=%v", err)
 				}
+				err = verifyClusterIDOwnership(ctx, volumeManager, vcconfig.Host, configInfo.Cfg.Global.ClusterID,
+					metadataSyncer.clusterFlavor)
+				if err != nil {
+					return err
+				}
 
 				metadataSyncer.volumeManagers[vcconfig.Host] = volumeManager
 				cnsDeletionMap[vcconfig.Host] = make(map[string]bool)
@@ -920,6 +1102,87 @@ func InitMetadataSyncer(ctx context.Context, clusterFlavor cnstypes.CnsClusterFl
 		}
 	}
 
+	// Trigger storage policy compliance check on vanilla cluster.
+	if metadataSyncer.clusterFlavor == cnstypes.CnsClusterFlavorVanilla {
+		policyComplianceTicker := time.NewTicker(time.Duration(
+			getPolicyComplianceIntervalInMin(ctx)) * time.Minute)
+		defer policyComplianceTicker.Stop()
+		go func() {
+			for ; true; <-policyComplianceTicker.C {
+				ctx, log := logger.GetNewContextWithLogger()
+				log.Info("storage policy compliance check is triggered")
+				if !isMultiVCenterFssEnabled {
+					csiGetVolumePolicyComplianceStatus(ctx, k8sClient, metadataSyncer,
+						metadataSyncer.configInfo.Cfg.Global.VCenterIP)
+					continue
+				}
+				vcconfigs, err := cnsvsphere.GetVirtualCenterConfigs(ctx, metadataSyncer.configInfo.Cfg)
+				if err != nil {
+					log.Errorf("failed to get VirtualCenterConfigs. err: %v", err)
+					continue
+				}
+				for _, vcconfig := range vcconfigs {
+					csiGetVolumePolicyComplianceStatus(ctx, k8sClient, metadataSyncer, vcconfig.Host)
+				}
+			}
+		}()
+	}
+
+	// Serve the admin API listing the volumes managed by the driver.
+	if metadataSyncer.clusterFlavor != cnstypes.CnsClusterFlavorGuest {
+		startAdminServer(ctx, metadataSyncer)
+	}
+
+	// Trigger orphan volume cleanup on vanilla cluster.
+	if metadataSyncer.clusterFlavor == cnstypes.CnsClusterFlavorVanilla {
+		orphanVolumeCleanupTicker := time.NewTicker(time.Duration(
+			getOrphanVolumeCleanupIntervalInMin(ctx)) * time.Minute)
+		defer orphanVolumeCleanupTicker.Stop()
+		go func() {
+			for ; true; <-orphanVolumeCleanupTicker.C {
+				ctx, log := logger.GetNewContextWithLogger()
+				log.Info("orphan volume cleanup is triggered")
+				if !isMultiVCenterFssEnabled {
+					csiCleanupOrphanVolumes(ctx, metadataSyncer, metadataSyncer.configInfo.Cfg.Global.VCenterIP)
+					continue
+				}
+				vcconfigs, err := cnsvsphere.GetVirtualCenterConfigs(ctx, metadataSyncer.configInfo.Cfg)
+				if err != nil {
+					log.Errorf("failed to get VirtualCenterConfigs. err: %v", err)
+					continue
+				}
+				for _, vcconfig := range vcconfigs {
+					csiCleanupOrphanVolumes(ctx, metadataSyncer, vcconfig.Host)
+				}
+			}
+		}()
+	}
+
+	// Trigger metadata drift reconciliation on vanilla cluster.
+	if metadataSyncer.clusterFlavor == cnstypes.CnsClusterFlavorVanilla {
+		metadataDriftTicker := time.NewTicker(time.Duration(
+			getMetadataDriftReconcileIntervalInMin(ctx)) * time.Minute)
+		defer metadataDriftTicker.Stop()
+		go func() {
+			for range metadataDriftTicker.C {
+				ctx, log := logger.GetNewContextWithLogger()
+				log.Info("metadata drift reconciliation is triggered")
+				if !isMultiVCenterFssEnabled {
+					csiReconcileMetadataDrift(ctx, metadataSyncer, metadataSyncer.configInfo.Cfg.Global.VCenterIP)
+					continue
+				}
+				vcconfigs, err := cnsvsphere.GetVirtualCenterConfigs(ctx, metadataSyncer.configInfo.Cfg)
+				if err != nil {
+					log.Errorf("failed to get VirtualCenterConfigs. err: %v", err)
+					continue
+				}
+				for _, vcconfig := range vcconfigs {
+					csiReconcileMetadataDrift(ctx, metadataSyncer, vcconfig.Host)
+				}
+			}
+		}()
+	}
+
 	volumeHealthTicker := time.NewTicker(time.Duration(getVolumeHealthIntervalInMin(ctx)) * time.Minute)
 	defer volumeHealthTicker.Stop()
 
@@ -2377,6 +2640,11 @@ func pvcUpdated(oldObj, newObj interface{}, metadataSyncer *metadataSyncInformer
 		log.Debugf("PVCUpdated: Found Persistent Volume %s from API server", newPvc.Spec.VolumeName)
 	}
 
+	if metadataSyncer.clusterFlavor == cnstypes.CnsClusterFlavorVanilla &&
+		pv.Spec.CSI != nil && pv.Spec.CSI.Driver == csitypes.Name {
+		retryNodeExpansion(ctx, newPvc)
+	}
+
 	// Verify if csi migration is ON and check if there is any label update or
 	// migrated-to annotation was received for the PVC.
 	if IsMigrationEnabled && pv.Spec.VsphereVolume != nil {
@@ -2427,8 +2695,11 @@ func pvcUpdated(oldObj, newObj interface{}, metadataSyncer *metadataSyncInformer
 			log.Debugf("PVCUpdated: Not a vSphere CSI Volume")
 			return
 		}
-		// For volumes provisioned by CSI driver, verify if old and new labels are not equal.
-		if oldPvc.Status.Phase == v1.ClaimBound && reflect.DeepEqual(newPvc.Labels, oldPvc.Labels) {
+		// For volumes provisioned by CSI driver, verify if old and new labels
+		// synced to CNS are not equal.
+		syncedPVCLabelKeys := getSyncedPVCLabelKeys(metadataSyncer.configInfo.Cfg)
+		if oldPvc.Status.Phase == v1.ClaimBound && reflect.DeepEqual(
+			getCnsPVCLabels(ctx, newPvc, syncedPVCLabelKeys), getCnsPVCLabels(ctx, oldPvc, syncedPVCLabelKeys)) {
 			log.Debugf("PVCUpdated: Old PVC and New PVC labels equal")
 			return
 		}
@@ -2524,6 +2795,17 @@ func pvUpdated(oldObj, newObj interface{}, metadataSyncer *metadataSyncInformer)
 			newPv.Name, newPv.Status.Phase)
 		return
 	}
+	// Relocate the volume if requested by an admin.
+	if metadataSyncer.clusterFlavor == cnstypes.CnsClusterFlavorVanilla && newPv.Spec.CSI != nil &&
+		newPv.Spec.CSI.Driver == csitypes.Name && newPv.DeletionTimestamp == nil {
+		relocatePVVolume(ctx, newPv, metadataSyncer)
+	}
+	// Record the datastore of the volume once the PV is bound.
+	if metadataSyncer.clusterFlavor != cnstypes.CnsClusterFlavorGuest && newPv.Spec.CSI != nil &&
+		newPv.Spec.CSI.Driver == csitypes.Name {
+		annotatePVDatastoreURL(ctx, newPv, metadataSyncer)
+		annotatePVEncryption(ctx, newPv, metadataSyncer)
+	}
 	if IsMigrationEnabled && newPv.Spec.VsphereVolume != nil {
 
 		// If it is a multi VC setup, then skip this volume as we do not support vSphere to CSI migrated volumes
@@ -2850,7 +3132,8 @@ func csiPVCUpdated(ctx context.Context, pvc *v1.PersistentVolumeClaim,
 	var metadataList []cnstypes.BaseCnsEntityMetadata
 	entityReference := cnsvsphere.CreateCnsKuberenetesEntityReference(string(cnstypes.CnsKubernetesEntityTypePV),
 		pv.Name, "", clusterIDforVolumeMetadata)
-	pvcMetadata := cnsvsphere.GetCnsKubernetesEntityMetaData(pvc.Name, pvc.Labels, false,
+	pvcLabels := getCnsPVCLabels(ctx, pvc, getSyncedPVCLabelKeys(metadataSyncer.configInfo.Cfg))
+	pvcMetadata := cnsvsphere.GetCnsKubernetesEntityMetaData(pvc.Name, pvcLabels, false,
 		string(cnstypes.CnsKubernetesEntityTypePVC), pvc.Namespace, clusterIDforVolumeMetadata,
 		[]cnstypes.CnsKubernetesEntityReference{entityReference})
 
@@ -3107,6 +3390,14 @@ func csiPVUpdated(ctx context.Context, newPv *v1.PersistentVolume, oldPv *v1.Per
 			if len(queryResult.Volumes) == 0 {
 				log.Infof("PVUpdated: Verified volume: %q is not marked as container volume in CNS. "+
 					"Calling CreateVolume with BackingID to mark volume as Container Volume.", oldPv.Spec.CSI.VolumeHandle)
+				if volumeType == common.BlockVolumeType {
+					if err := validateStaticBlockVolume(ctx, newPv, cnsVolumeMgr, false); err != nil {
+						log.Errorf("PVUpdated: Failed to validate static PV %q. Error: %v", newPv.Name, err)
+						generateEventOnPv(ctx, oldPv, v1.EventTypeWarning,
+							staticVolumeProvisioningFailure, err.Error())
+						return
+					}
+				}
 				// Call CreateVolume for Static Volume Provisioning.
 				err = createCnsVolume(ctx, oldPv, metadataSyncer, cnsVolumeMgr, volumeType, vcHost, metadataList, volumeHandle)
 				if err != nil {
@@ -3119,6 +3410,14 @@ func csiPVUpdated(ctx context.Context, newPv *v1.PersistentVolume, oldPv *v1.Per
 			} else if queryResult.Volumes[0].VolumeId.Id == oldPv.Spec.CSI.VolumeHandle {
 				log.Infof("PVUpdated: Verified volume: %q is already marked as container volume in CNS.",
 					oldPv.Spec.CSI.VolumeHandle)
+				if volumeType == common.BlockVolumeType {
+					if err := validateStaticBlockVolume(ctx, newPv, cnsVolumeMgr, true); err != nil {
+						log.Errorf("PVUpdated: Failed to validate static PV %q. Error: %v", newPv.Name, err)
+						generateEventOnPv(ctx, oldPv, v1.EventTypeWarning,
+							staticVolumeProvisioningFailure, err.Error())
+						return
+					}
+				}
 				// Volume is already present in the CNS, so continue with the
 				// UpdateVolumeMetadata.
 			} else {
@@ -0,0 +1,105 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+	k8s "sigs.k8s.io/vsphere-csi-driver/v3/pkg/kubernetes"
+)
+
+// retryNodeExpansion retries the node expansion of the volume of the PVC
+// annotated with common.AnnRetryNodeExpansion, once the admin fixed the
+// filesystem which failed to be resized on the node. The volume is already
+// expanded in CNS, so only the resize of its filesystem is retried by kubelet.
+// The annotation is removed once handled.
+func retryNodeExpansion(ctx context.Context, pvc *v1.PersistentVolumeClaim) {
+	log := logger.GetLogger(ctx)
+	if _, ok := pvc.Annotations[common.AnnRetryNodeExpansion]; !ok {
+		return
+	}
+	k8sClient, err := k8s.NewClient(ctx)
+	if err != nil {
+		log.Errorf("PVCUpdated: Creating Kubernetes client failed to retry node expansion of PVC %s/%s. Err: %v",
+			pvc.Namespace, pvc.Name, err)
+		return
+	}
+	if retriedPVC, ok := resetNodeResizeStatus(pvc); ok {
+		if _, err = patchPVCStatus(ctx, pvc, retriedPVC, k8sClient); err != nil {
+			log.Errorf("PVCUpdated: failed to retry node expansion of PVC %s/%s. Err: %v",
+				pvc.Namespace, pvc.Name, err)
+			return
+		}
+		log.Infof("PVCUpdated: node expansion of PVC %s/%s is pending again", pvc.Namespace, pvc.Name)
+	} else {
+		log.Infof("PVCUpdated: node expansion of PVC %s/%s has not failed, nothing to retry",
+			pvc.Namespace, pvc.Name)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{common.AnnRetryNodeExpansion: nil},
+		},
+	})
+	if err != nil {
+		log.Errorf("PVCUpdated: failed to create patch removing annotation %q. Err: %v",
+			common.AnnRetryNodeExpansion, err)
+		return
+	}
+	_, err = k8sClient.CoreV1().PersistentVolumeClaims(pvc.Namespace).Patch(ctx, pvc.Name,
+		types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		log.Errorf("PVCUpdated: failed to remove annotation %q from PVC %s/%s. Err: %v",
+			common.AnnRetryNodeExpansion, pvc.Namespace, pvc.Name, err)
+	}
+}
+
+// resetNodeResizeStatus returns a copy of the PVC whose failed node expansion
+// is marked pending again, without its NodeResizeError condition, and whether
+// the node expansion of the PVC had failed.
+func resetNodeResizeStatus(pvc *v1.PersistentVolumeClaim) (*v1.PersistentVolumeClaim, bool) {
+	failed := false
+	retriedPVC := pvc.DeepCopy()
+	var conditions []v1.PersistentVolumeClaimCondition
+	for _, condition := range retriedPVC.Status.Conditions {
+		if condition.Type == v1.PersistentVolumeClaimNodeResizeError {
+			failed = true
+			continue
+		}
+		conditions = append(conditions, condition)
+	}
+	retriedPVC.Status.Conditions = conditions
+	// Kubelet leaves the node expansion in progress on errors it retries.
+	switch retriedPVC.Status.AllocatedResourceStatuses[v1.ResourceStorage] {
+	case v1.PersistentVolumeClaimNodeResizeInfeasible:
+		failed = true
+	case v1.PersistentVolumeClaimNodeResizeInProgress:
+		if !failed {
+			return retriedPVC, false
+		}
+	default:
+		return retriedPVC, failed
+	}
+	retriedPVC.Status.AllocatedResourceStatuses[v1.ResourceStorage] = v1.PersistentVolumeClaimNodeResizePending
+	return retriedPVC, true
+}
@@ -0,0 +1,244 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"time"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	volumes "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/volume"
+	cnsconfig "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/config"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/utils"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/types"
+	cnsvolumeoprequestv1alpha1 "sigs.k8s.io/vsphere-csi-driver/v3/pkg/internalapis/cnsvolumeoperationrequest/v1alpha1"
+	k8s "sigs.k8s.io/vsphere-csi-driver/v3/pkg/kubernetes"
+)
+
+// csiCleanupOrphanVolumes deletes the CNS volumes of this cluster on the given
+// vCenter which were never tracked by Kubernetes. Such volumes are left behind
+// when the driver crashes after CNS CreateVolume succeeds, but before the
+// response reaches the external-provisioner. A volume is considered orphaned
+// when no PV refers to it, CNS has no Kubernetes entity metadata for it and it
+// is older than the orphan volume grace period. The disk of an orphaned volume
+// is only destroyed if the volume was provably created by the driver, see
+// isDriverCreatedVolume, otherwise the volume is only removed from CNS. The
+// volumes backing CSI ephemeral inline volumes are orphaned once their pod is
+// gone, e.g. when the node was removed before the node plugin deleted them. In
+// dry run mode, orphaned volumes are only reported.
+func csiCleanupOrphanVolumes(ctx context.Context, metadataSyncer *metadataSyncInformer, vc string) {
+	log := logger.GetLogger(ctx)
+	log.Debugf("csiCleanupOrphanVolumes for %s: start", vc)
+	gracePeriod := time.Duration(getOrphanVolumeGracePeriodInMin(ctx)) * time.Minute
+	dryRun := isOrphanVolumeCleanupDryRun(ctx)
+
+	volManager, err := getVolManagerForVcHost(ctx, vc, metadataSyncer)
+	if err != nil {
+		log.Errorf("csiCleanupOrphanVolumes for %s: Failed to get volume manager. Err: %v", vc, err)
+		return
+	}
+	// Metadata syncer and full sync may create or delete volumes of this
+	// vCenter concurrently, hold the shared lock while cleaning up.
+	volumeOperationsLock[vc].Lock()
+	defer volumeOperationsLock[vc].Unlock()
+
+	queryAllResult, err := utils.QueryAllVolumesForCluster(ctx, volManager,
+		metadataSyncer.configInfo.Cfg.Global.ClusterID, cnstypes.CnsQuerySelection{})
+	if err != nil {
+		log.Errorf("csiCleanupOrphanVolumes for %s: failed to QueryAllVolume with err=%+v", vc, err)
+		return
+	}
+	// PVs in any phase refer to volumes tracked by Kubernetes.
+	pvs, err := metadataSyncer.pvLister.List(labels.Everything())
+	if err != nil {
+		log.Errorf("csiCleanupOrphanVolumes for %s: Failed to get PVs from kubernetes. Err: %+v", vc, err)
+		return
+	}
+	k8sVolumeIDs := make(map[string]bool, len(pvs))
+	for _, pv := range pvs {
+		if pv.Spec.CSI != nil {
+			k8sVolumeIDs[pv.Spec.CSI.VolumeHandle] = true
+		}
+	}
+	operationRequests, err := getVolumeOperationRequests(ctx)
+	if err != nil {
+		log.Errorf("csiCleanupOrphanVolumes for %s: Failed to list CnsVolumeOperationRequests. Err: %+v", vc, err)
+		return
+	}
+	pods, err := metadataSyncer.podLister.List(labels.Everything())
+	if err != nil {
+		log.Errorf("csiCleanupOrphanVolumes for %s: Failed to get pods from kubernetes. Err: %+v", vc, err)
+		return
+	}
+	ephemeralVolumeNames := getPodEphemeralVolumeNames(pods)
+
+	orphanVolumes := make(map[string]bool)
+	for _, vol := range queryAllResult.Volumes {
+		if k8sVolumeIDs[vol.VolumeId.Id] || len(vol.Metadata.EntityMetadata) != 0 {
+			continue
+		}
+		// Ephemeral inline volumes have no PV and are deleted by the node plugin
+		// while their pod exists.
+		isEphemeralVolume := common.IsEphemeralVolume(&vol)
+		if isEphemeralVolume && ephemeralVolumeNames[vol.Name] {
+			continue
+		}
+		orphanVolumes[vol.VolumeId.Id] = true
+		age, err := getOrphanVolumeAge(ctx, volManager, vol, vc)
+		if err != nil {
+			log.Warnf("csiCleanupOrphanVolumes for %s: Failed to get age of volume %q. Err: %v",
+				vc, vol.VolumeId.Id, err)
+			continue
+		}
+		if age < gracePeriod {
+			log.Debugf("csiCleanupOrphanVolumes for %s: Volume %q with name %q has no PV, skipping it as it "+
+				"is younger than the grace period of %v", vc, vol.VolumeId.Id, vol.Name, gracePeriod)
+			continue
+		}
+		deleteDisk := isEphemeralVolume || isDriverCreatedVolume(vol, operationRequests[vol.Name])
+		if dryRun {
+			log.Warnf("csiCleanupOrphanVolumes for %s: Volume %q with name %q has had no PV for %v. "+
+				"It would be deleted, with its disk %v, if orphan volume cleanup was not in dry run mode.",
+				vc, vol.VolumeId.Id, vol.Name, age.Round(time.Second), deleteDisk)
+			continue
+		}
+		if deleteDisk && vol.VolumeType == common.BlockVolumeType &&
+			isVolumeRetentionLocked(ctx, volManager, vol.VolumeId.Id) {
+			log.Infof("csiCleanupOrphanVolumes for %s: Volume %q with name %q has had no PV for %v, skipping it "+
+				"as it is retention locked", vc, vol.VolumeId.Id, vol.Name, age.Round(time.Second))
+			continue
+		}
+		if deleteDisk {
+			log.Infof("csiCleanupOrphanVolumes for %s: Deleting volume %q with name %q as it has had no PV "+
+				"for %v", vc, vol.VolumeId.Id, vol.Name, age.Round(time.Second))
+		} else {
+			log.Infof("csiCleanupOrphanVolumes for %s: Removing volume %q with name %q from CNS as it has had no "+
+				"PV for %v. Its disk is kept as the volume was not created by the driver",
+				vc, vol.VolumeId.Id, vol.Name, age.Round(time.Second))
+		}
+		if _, err := volManager.DeleteVolume(ctx, vol.VolumeId.Id, deleteDisk); err != nil {
+			log.Errorf("csiCleanupOrphanVolumes for %s: Failed to delete volume %q. Err: %v",
+				vc, vol.VolumeId.Id, err)
+			continue
+		}
+		delete(orphanVolumes, vol.VolumeId.Id)
+		delete(cnsDeletionMap[vc], vol.VolumeId.Id)
+	}
+	// Forget volumes which are no longer orphaned.
+	for volumeID := range orphanVolumeFirstSeen[vc] {
+		if !orphanVolumes[volumeID] {
+			delete(orphanVolumeFirstSeen[vc], volumeID)
+		}
+	}
+	log.Debugf("csiCleanupOrphanVolumes for %s: end", vc)
+}
+
+// getPodEphemeralVolumeNames returns the names of the CNS volumes backing the
+// CSI ephemeral inline volumes of the driver in the given pods.
+func getPodEphemeralVolumeNames(pods []*v1.Pod) map[string]bool {
+	names := make(map[string]bool)
+	for _, pod := range pods {
+		for _, volume := range pod.Spec.Volumes {
+			if volume.CSI == nil || volume.CSI.Driver != csitypes.Name {
+				continue
+			}
+			volumeHandle := common.GetEphemeralVolumeHandle(string(pod.UID), volume.Name)
+			names[common.GetEphemeralVolumeName(volumeHandle)] = true
+		}
+	}
+	return names
+}
+
+// getVolumeOperationRequests returns the CnsVolumeOperationRequests persisted
+// by the controller, keyed by name.
+var getVolumeOperationRequests = func(ctx context.Context) (
+	map[string]*cnsvolumeoprequestv1alpha1.CnsVolumeOperationRequest, error) {
+	config, err := k8s.GetKubeConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	k8sClient, err := k8s.NewClientForGroup(ctx, config, cnsvolumeoprequestv1alpha1.SchemeGroupVersion.Group)
+	if err != nil {
+		return nil, err
+	}
+	requestList := &cnsvolumeoprequestv1alpha1.CnsVolumeOperationRequestList{}
+	if err := k8sClient.List(ctx, requestList, client.InNamespace(cnsconfig.GetCSINamespace())); err != nil {
+		return nil, err
+	}
+	requests := make(map[string]*cnsvolumeoprequestv1alpha1.CnsVolumeOperationRequest, len(requestList.Items))
+	for i := range requestList.Items {
+		requests[requestList.Items[i].Name] = &requestList.Items[i]
+	}
+	return requests, nil
+}
+
+// isDriverCreatedVolume returns true if the volume was created by the
+// CreateVolume call of the controller whose CnsVolumeOperationRequest, named
+// after the volume, is given. Volumes registered or imported in CNS, and
+// statically provisioned disks, have no such request. A volume with no PV
+// and no Kubernetes entity metadata was never bound to a PV, as the volume of
+// a deleted PV is removed from CNS along with it, so a volume created by the
+// driver cannot have been retained by a Retain reclaim policy.
+func isDriverCreatedVolume(vol cnstypes.CnsVolume,
+	request *cnsvolumeoprequestv1alpha1.CnsVolumeOperationRequest) bool {
+	return request != nil && request.Status.VolumeID != "" && request.Status.VolumeID == vol.VolumeId.Id
+}
+
+// getOrphanVolumeAge returns the age of the given volume. The creation time of
+// the virtual disk is used for block volumes. For file volumes, whose creation
+// time is not available, the time the volume was first seen orphaned is used.
+func getOrphanVolumeAge(ctx context.Context, volManager volumes.Manager, vol cnstypes.CnsVolume,
+	vc string) (time.Duration, error) {
+	if vol.VolumeType == common.BlockVolumeType {
+		vStorageObject, err := volManager.RetrieveVStorageObject(ctx, vol.VolumeId.Id)
+		if err != nil {
+			return 0, err
+		}
+		return time.Since(vStorageObject.Config.CreateTime), nil
+	}
+	if orphanVolumeFirstSeen[vc] == nil {
+		orphanVolumeFirstSeen[vc] = make(map[string]time.Time)
+	}
+	firstSeen, ok := orphanVolumeFirstSeen[vc][vol.VolumeId.Id]
+	if !ok {
+		firstSeen = time.Now()
+		orphanVolumeFirstSeen[vc][vol.VolumeId.Id] = firstSeen
+	}
+	return time.Since(firstSeen), nil
+}
+
+// isVolumeRetentionLocked returns true if the disk of the block volume must not
+// be destroyed as its retention lock has not expired yet. Volumes whose
+// metadata cannot be retrieved are considered locked until the next cleanup,
+// so that a locked volume is never destroyed because vCenter failed to serve
+// its metadata.
+func isVolumeRetentionLocked(ctx context.Context, volManager volumes.Manager, volumeID string) bool {
+	log := logger.GetLogger(ctx)
+	retainUntil, err := common.GetVolumeRetainUntil(ctx, volManager, volumeID)
+	if err != nil {
+		log.Warnf("Failed to retrieve the retention lock of volume %q, skipping it until the next cleanup. "+
+			"Err: %v", volumeID, err)
+		return true
+	}
+	return time.Now().Before(retainUntil)
+}
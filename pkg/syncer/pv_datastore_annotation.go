@@ -0,0 +1,152 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+	k8s "sigs.k8s.io/vsphere-csi-driver/v3/pkg/kubernetes"
+)
+
+// annDatastoreURL records on a bound PV the URL of the datastore backing its
+// CNS volume, so that the placement of the volume is known without looking
+// it up in vCenter.
+const annDatastoreURL = "cns.vmware.com/datastore-url"
+
+// pvDatastoreURLUpdates holds the names of the PVs whose datastore URL
+// annotation is being set, so that repeated updates of a PV do not query CNS
+// more than once.
+var pvDatastoreURLUpdates sync.Map
+
+// annotatePVDatastoreURL sets annDatastoreURL on the bound PV in the
+// background, if it is not set yet. The datastore URL is queried from CNS.
+func annotatePVDatastoreURL(ctx context.Context, pv *v1.PersistentVolume, metadataSyncer *metadataSyncInformer) {
+	log := logger.GetLogger(ctx)
+	if !isDatastoreURLAnnotatedPV(pv) {
+		return
+	}
+	if _, found := pv.GetAnnotations()[annDatastoreURL]; found {
+		return
+	}
+	if _, inProgress := pvDatastoreURLUpdates.LoadOrStore(pv.Name, struct{}{}); inProgress {
+		return
+	}
+	go func() {
+		defer pvDatastoreURLUpdates.Delete(pv.Name)
+		volumeID := pv.Spec.CSI.VolumeHandle
+		_, volManager, err := getVcHostAndVolumeManagerForVolumeID(ctx, metadataSyncer, volumeID)
+		if err != nil {
+			log.Errorf("failed to get vCenter of volume %q of PV %q. Err: %v", volumeID, pv.Name, err)
+			return
+		}
+		queryResult, err := volManager.QueryVolume(ctx, cnstypes.CnsQueryFilter{
+			VolumeIds: []cnstypes.CnsVolumeId{{Id: volumeID}},
+		})
+		if err != nil {
+			log.Errorf("failed to query volume %q of PV %q. Err: %v", volumeID, pv.Name, err)
+			return
+		}
+		if len(queryResult.Volumes) == 0 || strings.TrimSpace(queryResult.Volumes[0].DatastoreUrl) == "" {
+			log.Debugf("Datastore of volume %q of PV %q not found in CNS", volumeID, pv.Name)
+			return
+		}
+		datastoreURL := strings.TrimSpace(queryResult.Volumes[0].DatastoreUrl)
+		if err := patchPVDatastoreURL(ctx, pv.Name, datastoreURL); err != nil {
+			log.Errorf("failed to set datastore URL annotation of PV %q. Err: %v", pv.Name, err)
+			return
+		}
+		log.Infof("Set datastore URL of PV %q to %q", pv.Name, datastoreURL)
+	}()
+}
+
+// fullSyncPVDatastoreURL sets annDatastoreURL of the bound PVs to the
+// datastore URL of their volume in CNS, so that the annotation follows the
+// relocations of the volumes done outside of the syncer, e.g. using Storage
+// vMotion.
+func fullSyncPVDatastoreURL(ctx context.Context, k8sPVs []*v1.PersistentVolume, cnsVolumes []cnstypes.CnsVolume) {
+	log := logger.GetLogger(ctx)
+	for pvName, datastoreURL := range getPVDatastoreURLUpdates(k8sPVs, cnsVolumes) {
+		if _, inProgress := pvDatastoreURLUpdates.LoadOrStore(pvName, struct{}{}); inProgress {
+			continue
+		}
+		err := patchPVDatastoreURL(ctx, pvName, datastoreURL)
+		pvDatastoreURLUpdates.Delete(pvName)
+		if err != nil {
+			log.Errorf("failed to set datastore URL annotation of PV %q. Err: %v", pvName, err)
+			continue
+		}
+		log.Infof("FullSync: set datastore URL of PV %q to %q", pvName, datastoreURL)
+	}
+}
+
+// getPVDatastoreURLUpdates returns the datastore URLs of the volumes in CNS
+// by the name of their bound PV, for the PVs whose annDatastoreURL is missing
+// or differs. The PVs of the volumes without datastore URL are skipped.
+func getPVDatastoreURLUpdates(k8sPVs []*v1.PersistentVolume, cnsVolumes []cnstypes.CnsVolume) map[string]string {
+	datastoreURLs := make(map[string]string, len(cnsVolumes))
+	for _, volume := range cnsVolumes {
+		if datastoreURL := strings.TrimSpace(volume.DatastoreUrl); datastoreURL != "" {
+			datastoreURLs[volume.VolumeId.Id] = datastoreURL
+		}
+	}
+	updates := make(map[string]string)
+	for _, pv := range k8sPVs {
+		if !isDatastoreURLAnnotatedPV(pv) {
+			continue
+		}
+		datastoreURL, found := datastoreURLs[pv.Spec.CSI.VolumeHandle]
+		if !found || pv.GetAnnotations()[annDatastoreURL] == datastoreURL {
+			continue
+		}
+		updates[pv.Name] = datastoreURL
+	}
+	return updates
+}
+
+// isDatastoreURLAnnotatedPV returns true if the PV is a bound PV of a CSI
+// volume, which carries annDatastoreURL.
+func isDatastoreURLAnnotatedPV(pv *v1.PersistentVolume) bool {
+	return pv.Status.Phase == v1.VolumeBound && pv.Spec.CSI != nil && pv.DeletionTimestamp == nil
+}
+
+// patchPVDatastoreURL sets annDatastoreURL of the PV to the given URL.
+func patchPVDatastoreURL(ctx context.Context, pvName string, datastoreURL string) error {
+	k8sClient, err := k8s.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{annDatastoreURL: datastoreURL},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = k8sClient.CoreV1().PersistentVolumes().Patch(ctx, pvName, apitypes.MergePatchType, patch,
+		metav1.PatchOptions{})
+	return err
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+
+	vim25types "github.com/vmware/govmomi/vim25/types"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+
+	cnsvolume "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/volume"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+	k8s "sigs.k8s.io/vsphere-csi-driver/v3/pkg/kubernetes"
+)
+
+const (
+	// annEncrypted records on a bound PV whether the FCD backing its CNS
+	// volume is encrypted, i.e. "true" or "false".
+	annEncrypted = "cns.vmware.com/encrypted"
+	// annEncryptionKeyProvider records on a bound PV the id of the key
+	// provider of the key encrypting its FCD. Not set for unencrypted FCDs.
+	annEncryptionKeyProvider = "cns.vmware.com/encryption-key-provider"
+	// annEncryptionKeyID records on a bound PV the id of the key encrypting
+	// its FCD. Only the id of the key is recorded, never the key itself.
+	// Not set for unencrypted FCDs.
+	annEncryptionKeyID = "cns.vmware.com/encryption-key-id"
+)
+
+// pvEncryptionUpdates holds the names of the PVs whose encryption
+// annotations are being set, so that repeated updates of a PV do not query
+// vCenter more than once.
+var pvEncryptionUpdates sync.Map
+
+// annotatePVEncryption sets the encryption annotations on the bound PV of a
+// block volume in the background, if they are not set yet. The annotations
+// are set once, removing the annEncrypted annotation, e.g. after a rekey of
+// the volume, makes the syncer set them again.
+func annotatePVEncryption(ctx context.Context, pv *v1.PersistentVolume, metadataSyncer *metadataSyncInformer) {
+	log := logger.GetLogger(ctx)
+	if !isPVEncryptionAnnotationMissing(pv) {
+		return
+	}
+	if _, inProgress := pvEncryptionUpdates.LoadOrStore(pv.Name, struct{}{}); inProgress {
+		return
+	}
+	go func() {
+		defer pvEncryptionUpdates.Delete(pv.Name)
+		volumeID := pv.Spec.CSI.VolumeHandle
+		_, volManager, err := getVcHostAndVolumeManagerForVolumeID(ctx, metadataSyncer, volumeID)
+		if err != nil {
+			log.Errorf("failed to get vCenter of volume %q of PV %q. Err: %v", volumeID, pv.Name, err)
+			return
+		}
+		syncPVEncryption(ctx, pv, volManager)
+	}()
+}
+
+// fullSyncPVEncryption sets the encryption annotations of the bound PVs of
+// block volumes which are missing them, e.g. because the syncer was down when
+// the PV was bound. The PVs which are annotated already are skipped, so that
+// vCenter is not queried for every volume on every full sync.
+func fullSyncPVEncryption(ctx context.Context, k8sPVs []*v1.PersistentVolume, volManager cnsvolume.Manager) {
+	for _, pv := range k8sPVs {
+		if !isPVEncryptionAnnotationMissing(pv) {
+			continue
+		}
+		if _, inProgress := pvEncryptionUpdates.LoadOrStore(pv.Name, struct{}{}); inProgress {
+			continue
+		}
+		syncPVEncryption(ctx, pv, volManager)
+		pvEncryptionUpdates.Delete(pv.Name)
+	}
+}
+
+// isEncryptionAnnotatedPV returns true if the PV is a bound PV of a CSI
+// block volume, which carries the encryption annotations.
+func isEncryptionAnnotatedPV(pv *v1.PersistentVolume) bool {
+	return pv.Status.Phase == v1.VolumeBound && pv.Spec.CSI != nil && pv.DeletionTimestamp == nil &&
+		!strings.HasPrefix(pv.Spec.CSI.VolumeHandle, "file:")
+}
+
+// isPVEncryptionAnnotationMissing returns true if the PV carries the
+// encryption annotations but they are not set yet.
+func isPVEncryptionAnnotationMissing(pv *v1.PersistentVolume) bool {
+	if !isEncryptionAnnotatedPV(pv) {
+		return false
+	}
+	_, found := pv.GetAnnotations()[annEncrypted]
+	return !found
+}
+
+// syncPVEncryption retrieves the key of the FCD backing the PV and updates
+// the encryption annotations of the PV if they differ.
+func syncPVEncryption(ctx context.Context, pv *v1.PersistentVolume, volManager cnsvolume.Manager) {
+	log := logger.GetLogger(ctx)
+	volumeID := pv.Spec.CSI.VolumeHandle
+	vStorageObject, err := volManager.RetrieveVStorageObject(ctx, volumeID)
+	if err != nil {
+		log.Warnf("failed to retrieve volume %q of PV %q to find its encryption. Err: %v", volumeID, pv.Name, err)
+		return
+	}
+	var keyID *vim25types.CryptoKeyId
+	if backingInfo, ok := vStorageObject.Config.Backing.(*vim25types.BaseConfigInfoDiskFileBackingInfo); ok {
+		keyID = backingInfo.KeyId
+	}
+	annotations := getPVEncryptionAnnotations(keyID)
+	if !isPVEncryptionAnnotationUpdateRequired(pv, annotations) {
+		return
+	}
+	if err := patchPVEncryption(ctx, pv.Name, annotations); err != nil {
+		log.Errorf("failed to set encryption annotations of PV %q. Err: %v", pv.Name, err)
+		return
+	}
+	log.Infof("Set encryption annotations of PV %q to %v", pv.Name, annotations)
+}
+
+// getPVEncryptionAnnotations returns the encryption annotations for a volume
+// encrypted with the given key, or for an unencrypted volume if keyID is nil.
+// Annotations which do not apply are mapped to an empty value.
+func getPVEncryptionAnnotations(keyID *vim25types.CryptoKeyId) map[string]string {
+	annotations := map[string]string{
+		annEncrypted:             strconv.FormatBool(keyID != nil),
+		annEncryptionKeyProvider: "",
+		annEncryptionKeyID:       "",
+	}
+	if keyID != nil {
+		if keyID.ProviderId != nil {
+			annotations[annEncryptionKeyProvider] = keyID.ProviderId.Id
+		}
+		annotations[annEncryptionKeyID] = keyID.KeyId
+	}
+	return annotations
+}
+
+// isPVEncryptionAnnotationUpdateRequired returns true if the annotations of
+// the PV differ from the given encryption annotations. An empty value means
+// that the annotation must not be set.
+func isPVEncryptionAnnotationUpdateRequired(pv *v1.PersistentVolume, annotations map[string]string) bool {
+	for key, value := range annotations {
+		current, found := pv.GetAnnotations()[key]
+		if current != value || (value == "" && found) {
+			return true
+		}
+	}
+	return false
+}
+
+// patchPVEncryption sets the given encryption annotations on the PV and
+// removes the ones with an empty value.
+func patchPVEncryption(ctx context.Context, pvName string, annotations map[string]string) error {
+	k8sClient, err := k8s.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	patchAnnotations := make(map[string]interface{}, len(annotations))
+	for key, value := range annotations {
+		if value == "" {
+			patchAnnotations[key] = nil
+		} else {
+			patchAnnotations[key] = value
+		}
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": patchAnnotations,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = k8sClient.CoreV1().PersistentVolumes().Patch(ctx, pvName, apitypes.MergePatchType, patch,
+		metav1.PatchOptions{})
+	return err
+}
@@ -988,3 +988,35 @@ func TestGetVCForTopologySegments(t *testing.T) {
 		})
 	}
 }
+
+func TestRunFullSyncWorkers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	t.Setenv("FULL_SYNC_WORKERS", "3")
+
+	var mu sync.Mutex
+	processed := make(map[int]int)
+	running, maxRunning := 0, 0
+	runFullSyncWorkers(ctx, 10, func(i int) {
+		mu.Lock()
+		processed[i]++
+		running++
+		maxRunning = max(maxRunning, running)
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+	if len(processed) != 10 {
+		t.Fatalf("expected 10 processed indexes, got %d", len(processed))
+	}
+	for i, count := range processed {
+		if count != 1 {
+			t.Errorf("index %d processed %d times", i, count)
+		}
+	}
+	if maxRunning > 3 {
+		t.Errorf("expected at most 3 concurrent workers, got %d", maxRunning)
+	}
+}
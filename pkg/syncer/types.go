@@ -38,6 +38,18 @@ const (
 	// default interval for csi full sync, used unless overridden by user in csi-controller YAML
 	defaultFullSyncIntervalInMin = 30
 
+	// default number of workers concurrently running the CNS operations of a full sync
+	defaultFullSyncWorkers = 4
+
+	// default maximum rate of the CNS operations of a full sync, in operations per second
+	defaultFullSyncCnsOpsPerSecond = 20
+
+	// default number of volumes queried from CNS per batch by a full sync
+	defaultFullSyncQueryBatchSize = 500
+
+	// number of attempts of a batch of volumes queried from CNS by a full sync
+	fullSyncQueryBatchAttempts = 3
+
 	// key for HealthStatus annotation on PVC
 	annVolumeHealth = "volumehealth.storage.kubernetes.io/health"
 
@@ -63,6 +75,25 @@ const (
 
 	// default interval for pv to backingdiskobjectid mapping
 	defaultPVtoBackingDiskObjectIdIntervalInMin = 10
+
+	// key for storage policy compliance annotation on PV
+	annPolicyCompliance = "cns.vmware.com/policy-compliance"
+	// key for expressing timestamp of the last storage policy compliance check on PV
+	annPolicyComplianceTS = "cns.vmware.com/policy-compliance-timestamp"
+	// value of the policy compliance annotation for volumes compliant with their storage policy
+	policyComplianceStatusCompliant = "compliant"
+	// value of the policy compliance annotation for volumes not compliant with their storage policy
+	policyComplianceStatusNonCompliant = "noncompliant"
+	// reason of the event generated on PV when the volume becomes noncompliant
+	policyNonCompliantReason = "StoragePolicyNonCompliant"
+	// default interval for storage policy compliance check
+	defaultPolicyComplianceIntervalInMin = 60
+	// default interval for orphan volume cleanup
+	defaultOrphanVolumeCleanupIntervalInMin = 60
+	// default time for which a volume must have had no PV to be considered orphaned
+	defaultOrphanVolumeGracePeriodInMin = 60
+	// default interval for metadata drift reconciliation
+	defaultMetadataDriftReconcileIntervalInMin = 30
 )
 
 var (
@@ -88,6 +119,17 @@ var (
 	// the cluster but the corresponding PV for that volume does not exist.
 	// A separate map is maintained for each VC.
 	volumeInfoCrDeletionMap map[string]map[string]bool
+
+	// orphanVolumeFirstSeen tracks the time file volumes without a PV were
+	// first seen by the orphan volume cleanup.
+	// A separate map is maintained for each VC.
+	orphanVolumeFirstSeen = make(map[string]map[string]time.Time)
+
+	// metadataDriftFirstSeen tracks the PVs, keyed by PV name and PVC UID, whose
+	// PVC metadata was found drifting in the last pass of the metadata drift
+	// reconciler.
+	// A separate map is maintained for each VC.
+	metadataDriftFirstSeen = make(map[string]map[string]bool)
 )
 
 type (
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
+	"strings"
 	"time"
 
 	"google.golang.org/grpc/codes"
@@ -53,6 +55,10 @@ const (
 	volumdIDLimitPerQuery = 1000
 )
 
+// fullSyncQueryRetryInterval is the time waited before retrying a failed
+// batch of volumes queried from CNS by a full sync.
+var fullSyncQueryRetryInterval = 5 * time.Second
+
 // getPVsInBoundAvailableOrReleased return PVs in Bound, Available or Released
 // state.
 func getPVsInBoundAvailableOrReleased(ctx context.Context,
@@ -190,9 +196,10 @@ func fullSyncGetQueryResults(ctx context.Context, volumeIds []cnstypes.CnsVolume
 	log.Debugf("FullSync: fullSyncGetQueryResults is called with volumeIds %v for clusterID %s",
 		volumeIds, clusterID)
 	useQueryVolumeAsync := metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.AsyncQueryVolume)
+	batchSize := int(min(getFullSyncQueryBatchSize(ctx), volumdIDLimitPerQuery))
 	var volumeIdsBatchesToFilter [][]cnstypes.CnsVolumeId
-	for i := 0; i < len(volumeIds); i += volumdIDLimitPerQuery {
-		end := i + volumdIDLimitPerQuery
+	for i := 0; i < len(volumeIds); i += batchSize {
+		end := i + batchSize
 		if end > len(volumeIds) {
 			end = len(volumeIds)
 		}
@@ -200,15 +207,17 @@ func fullSyncGetQueryResults(ctx context.Context, volumeIds []cnstypes.CnsVolume
 	}
 
 	var allQueryResults []*cnstypes.CnsQueryResult
-	for _, volumeIdsBatch := range volumeIdsBatchesToFilter {
+	for i, volumeIdsBatch := range volumeIdsBatchesToFilter {
 		queryFilter := cnstypes.CnsQueryFilter{
 			VolumeIds: volumeIdsBatch,
 		}
 		if clusterID != "" {
 			queryFilter.ContainerClusterIds = []string{clusterID}
 		}
-		queryResult, err := utils.QueryVolumeUtil(ctx, volumeManager, queryFilter, nil,
-			useQueryVolumeAsync)
+		queryResult, err := queryFullSyncBatch(ctx, fmt.Sprintf("batch %d/%d of volume IDs", i+1,
+			len(volumeIdsBatchesToFilter)), func() (*cnstypes.CnsQueryResult, error) {
+			return utils.QueryVolumeUtil(ctx, volumeManager, queryFilter, nil, useQueryVolumeAsync)
+		})
 		if err != nil {
 			return nil, logger.LogNewErrorCodef(log, codes.Internal,
 				"queryVolumeUtil failed with err=%+v", err.Error())
@@ -217,11 +226,116 @@ func fullSyncGetQueryResults(ctx context.Context, volumeIds []cnstypes.CnsVolume
 			log.Info("Observed empty queryResult")
 			continue
 		}
+		utils.FilterVolumesOfCluster(ctx, queryResult, clusterID)
 		allQueryResults = append(allQueryResults, queryResult)
 	}
 	return allQueryResults, nil
 }
 
+// fullSyncQueryAllVolumes returns the volumes of the cluster clusterID. The
+// volumes are queried from CNS in batches of the configured size, rather than
+// in a single query whose result may exceed the response limits of vCenter on
+// large clusters.
+func fullSyncQueryAllVolumes(ctx context.Context, volumeManager volumes.Manager, clusterID string,
+	querySelection cnstypes.CnsQuerySelection, metadataSyncer *metadataSyncInformer) (*cnstypes.CnsQueryResult, error) {
+	useQueryVolumeAsync := metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.AsyncQueryVolume)
+	var selection *cnstypes.CnsQuerySelection
+	if len(querySelection.Names) > 0 {
+		selection = &querySelection
+	}
+	queryAllResult, err := queryVolumesInBatches(ctx, getFullSyncQueryBatchSize(ctx),
+		func(cursor cnstypes.CnsCursor) (*cnstypes.CnsQueryResult, error) {
+			queryFilter := cnstypes.CnsQueryFilter{
+				ContainerClusterIds: []string{clusterID},
+				Cursor:              &cursor,
+			}
+			return utils.QueryVolumeUtil(ctx, volumeManager, queryFilter, selection, useQueryVolumeAsync)
+		})
+	if err != nil {
+		return nil, err
+	}
+	utils.FilterVolumesOfCluster(ctx, queryAllResult, clusterID)
+	return queryAllResult, nil
+}
+
+// queryVolumesInBatches pages through the volumes returned by queryBatch,
+// batchSize volumes at a time, following the cursor returned by CNS, and
+// returns all of them. A failed batch is retried from its offset, without
+// querying the previous batches again. CNS only pages by offset, so volumes
+// deleted while paging shift the following volumes to lower offsets. When
+// the total number of volumes shrinks between two batches, the offsets the
+// volumes were shifted from are queried again so that they are not skipped,
+// and the volumes returned twice are deduplicated.
+func queryVolumesInBatches(ctx context.Context, batchSize int64,
+	queryBatch func(cursor cnstypes.CnsCursor) (*cnstypes.CnsQueryResult, error)) (*cnstypes.CnsQueryResult, error) {
+	log := logger.GetLogger(ctx)
+	queryAllResult := &cnstypes.CnsQueryResult{}
+	queriedVolumeIDs := make(map[string]struct{})
+	cursor := cnstypes.CnsCursor{Limit: batchSize}
+	var lastTotalRecords int64
+	for {
+		queryResult, err := queryFullSyncBatch(ctx, fmt.Sprintf("volumes at offset %d", cursor.Offset),
+			func() (*cnstypes.CnsQueryResult, error) {
+				return queryBatch(cursor)
+			})
+		if err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to query volumes at offset %d. Err: %v", cursor.Offset, err)
+		}
+		if queryResult == nil {
+			break
+		}
+		for _, volume := range queryResult.Volumes {
+			if _, queried := queriedVolumeIDs[volume.VolumeId.Id]; queried {
+				continue
+			}
+			queriedVolumeIDs[volume.VolumeId.Id] = struct{}{}
+			queryAllResult.Volumes = append(queryAllResult.Volumes, volume)
+		}
+		queryAllResult.Cursor.TotalRecords = max(queryResult.Cursor.TotalRecords,
+			int64(len(queryAllResult.Volumes)))
+		log.Infof("FullSync: queried %d/%d volumes from CNS", len(queryAllResult.Volumes),
+			queryAllResult.Cursor.TotalRecords)
+		nextOffset := queryResult.Cursor.Offset
+		if deleted := lastTotalRecords - queryResult.Cursor.TotalRecords; lastTotalRecords > 0 && deleted > 0 &&
+			queryResult.Cursor.TotalRecords > 0 {
+			nextOffset = max(cursor.Offset-deleted, 0)
+			log.Infof("FullSync: %d volumes were deleted while querying volumes, querying again from offset %d",
+				deleted, nextOffset)
+		} else if len(queryResult.Volumes) == 0 || queryResult.Cursor.Offset <= cursor.Offset ||
+			queryResult.Cursor.Offset >= queryResult.Cursor.TotalRecords {
+			// Stop if the cursor does not move forward, e.g. if CNS ignored it
+			// and returned all the volumes at once.
+			break
+		}
+		lastTotalRecords = queryResult.Cursor.TotalRecords
+		cursor.Offset = nextOffset
+	}
+	queryAllResult.Cursor.Offset = int64(len(queryAllResult.Volumes))
+	return queryAllResult, nil
+}
+
+// queryFullSyncBatch runs the query of a batch of volumes of a full sync,
+// described by batch, and retries it on failure, so that a transient failure
+// of one batch does not fail the whole full sync.
+func queryFullSyncBatch(ctx context.Context, batch string,
+	query func() (*cnstypes.CnsQueryResult, error)) (*cnstypes.CnsQueryResult, error) {
+	log := logger.GetLogger(ctx)
+	var err error
+	for attempt := 1; ; attempt++ {
+		var queryResult *cnstypes.CnsQueryResult
+		if queryResult, err = query(); err == nil {
+			return queryResult, nil
+		}
+		if attempt >= fullSyncQueryBatchAttempts {
+			return nil, err
+		}
+		log.Warnf("FullSync: query of %s failed on attempt %d/%d, retrying in %v. Err: %v",
+			batch, attempt, fullSyncQueryBatchAttempts, fullSyncQueryRetryInterval, err)
+		time.Sleep(fullSyncQueryRetryInterval)
+	}
+}
+
 // getPVCKey helps to get the PVC name from PVC object.
 func getPVCKey(ctx context.Context, obj interface{}) (string, error) {
 	log := logger.GetLogger(ctx)
@@ -712,6 +826,78 @@ func generateEventOnPv(ctx context.Context, pv *v1.PersistentVolume,
 	eventRecorder.Event(pv, eventType, failureReason, errorMsg)
 }
 
+// validateStaticVolumeCapacity returns an error if the capacity claimed by the
+// statically provisioned PV exceeds the capacity of the volume it references,
+// which usually means that the volume handle of the PV is mistyped.
+func validateStaticVolumeCapacity(pv *v1.PersistentVolume, capacityInMB int64) error {
+	capacity, ok := pv.Spec.Capacity[v1.ResourceStorage]
+	if !ok || capacityInMB <= 0 {
+		return nil
+	}
+	claimedMB := (capacity.Value() + common.MbInBytes - 1) / common.MbInBytes
+	if claimedMB > capacityInMB {
+		return fmt.Errorf("PV %q claims a capacity of %d MB but volume %q has a capacity of %d MB",
+			pv.Name, claimedMB, pv.Spec.CSI.VolumeHandle, capacityInMB)
+	}
+	return nil
+}
+
+// validateStaticVolumeCluster returns an error if the CNS volume referenced
+// by a statically provisioned PV is registered for other clusters only, as
+// the volume is then in use by these clusters.
+func validateStaticVolumeCluster(volume *cnstypes.CnsVolume, clusterID string) error {
+	if len(volume.Metadata.ContainerClusterArray) == 0 {
+		return nil
+	}
+	var clusterIDs []string
+	for _, containerCluster := range volume.Metadata.ContainerClusterArray {
+		if containerCluster.ClusterId == clusterID {
+			return nil
+		}
+		clusterIDs = append(clusterIDs, containerCluster.ClusterId)
+	}
+	return fmt.Errorf("volume %q belongs to cluster(s) %v", volume.VolumeId.Id, clusterIDs)
+}
+
+// validateStaticBlockVolume verifies that the volume referenced by the
+// statically provisioned block PV exists, is not in use by another cluster
+// and has the capacity claimed by the PV. The volume is retrieved from CNS if
+// it is registered, otherwise from the FCDs of the vCenter. If the FCD
+// cannot be retrieved, e.g. when the vCenter does not serve the vslm
+// endpoint, its validation is left to its registration with CNS.
+func validateStaticBlockVolume(ctx context.Context, pv *v1.PersistentVolume, cnsVolumeMgr volumes.Manager,
+	registered bool) error {
+	log := logger.GetLogger(ctx)
+	volumeHandle := pv.Spec.CSI.VolumeHandle
+	if !registered {
+		vStorageObject, err := cnsVolumeMgr.RetrieveVStorageObject(ctx, volumeHandle)
+		if err != nil {
+			log.Warnf("failed to retrieve volume %q of static PV %q, skipping its validation. Err: %v",
+				volumeHandle, pv.Name, err)
+			return nil
+		}
+		return validateStaticVolumeCapacity(pv, vStorageObject.Config.CapacityInMB)
+	}
+	queryResult, err := cnsVolumeMgr.QueryVolume(ctx, cnstypes.CnsQueryFilter{
+		VolumeIds: []cnstypes.CnsVolumeId{{Id: volumeHandle}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to query volume %q. Err: %v", volumeHandle, err)
+	}
+	if len(queryResult.Volumes) == 0 {
+		return fmt.Errorf("volume %q not found in CNS", volumeHandle)
+	}
+	volume := &queryResult.Volumes[0]
+	if err := validateStaticVolumeCluster(volume, clusterIDforVolumeMetadata); err != nil {
+		return err
+	}
+	if volume.BackingObjectDetails == nil {
+		return nil
+	}
+	return validateStaticVolumeCapacity(pv,
+		volume.BackingObjectDetails.GetCnsBackingObjectDetails().CapacityInMb)
+}
+
 func createCnsVolume(ctx context.Context, pv *v1.PersistentVolume,
 	metadataSyncer *metadataSyncInformer, cnsVolumeMgr volumes.Manager, volumeType string,
 	vcHost string, metadataList []cnstypes.BaseCnsEntityMetadata, volumeHandle string) error {
@@ -849,6 +1035,52 @@ func createMissingFileVolumeInfoCrs(ctx context.Context, metadataSyncer *metadat
 	}
 }
 
+// getSyncedPVCLabelKeys returns the PVC label keys which are synced to CNS,
+// as configured by synced-pvc-label-keys. nil is returned if all labels are
+// synced.
+func getSyncedPVCLabelKeys(cfg *cnsconfig.Config) []string {
+	if cfg == nil {
+		return nil
+	}
+	var keys []string
+	for _, key := range strings.Split(cfg.Global.SyncedPVCLabelKeys, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// filterPVCLabels returns the PVC labels with keys in syncedKeys, so that
+// only the selected labels are synced to CNS. All labels are returned if
+// syncedKeys is empty.
+func filterPVCLabels(labels map[string]string, syncedKeys []string) map[string]string {
+	if len(syncedKeys) == 0 {
+		return labels
+	}
+	filtered := make(map[string]string)
+	for _, key := range syncedKeys {
+		if value, ok := labels[key]; ok {
+			filtered[key] = value
+		}
+	}
+	return filtered
+}
+
+// getCnsPVCLabels returns the labels of the PVC synced to CNS, i.e. the PVC
+// labels with keys in syncedKeys and the guest disk hints of the PVC.
+func getCnsPVCLabels(ctx context.Context, pvc *v1.PersistentVolumeClaim, syncedKeys []string) map[string]string {
+	labels := filterPVCLabels(pvc.GetLabels(), syncedKeys)
+	hints := common.GetGuestDiskHints(ctx, pvc.GetAnnotations())
+	if len(hints) == 0 {
+		return labels
+	}
+	cnsLabels := make(map[string]string, len(labels)+len(hints))
+	maps.Copy(cnsLabels, labels)
+	maps.Copy(cnsLabels, hints)
+	return cnsLabels
+}
+
 func isDynamicallyCreatedVolume(ctx context.Context, pv *v1.PersistentVolume) bool {
 	isdynamicCSIPV := false
 	if pv.Spec.CSI != nil {
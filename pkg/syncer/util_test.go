@@ -2,16 +2,29 @@ package syncer
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strconv"
 	"testing"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	cnstypes "github.com/vmware/govmomi/cns/types"
+	vim25types "github.com/vmware/govmomi/vim25/types"
 	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	testclient "k8s.io/client-go/kubernetes/fake"
 
+	cnsvolume "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/volume"
+	cnsconfig "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/config"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
+	cnsvolumeoprequestv1alpha1 "sigs.k8s.io/vsphere-csi-driver/v3/pkg/internalapis/cnsvolumeoperationrequest/v1alpha1"
 	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/syncer/k8scloudoperator"
 )
 
@@ -476,3 +489,504 @@ func TestHasClusterDistributionSet(t *testing.T) {
 		})
 	}
 }
+
+func TestFilterPVCLabels(t *testing.T) {
+	labels := map[string]string{"app": "db", "team": "storage", "tier": "backend"}
+	cfg := &cnsconfig.Config{}
+	assert.Equal(t, labels, filterPVCLabels(labels, getSyncedPVCLabelKeys(cfg)))
+
+	cfg.Global.SyncedPVCLabelKeys = " team, tier ,missing,"
+	keys := getSyncedPVCLabelKeys(cfg)
+	assert.Equal(t, []string{"team", "tier", "missing"}, keys)
+	assert.Equal(t, map[string]string{"team": "storage", "tier": "backend"}, filterPVCLabels(labels, keys))
+	assert.Empty(t, filterPVCLabels(nil, keys))
+}
+
+func TestGetCnsPVCLabels(t *testing.T) {
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+		Name:      "pvc-1",
+		Namespace: "ns-1",
+		Labels:    map[string]string{"app": "db", "team": "storage"},
+	}}
+	assert.Equal(t, map[string]string{"app": "db"}, getCnsPVCLabels(context.Background(), pvc, []string{"app"}))
+
+	pvc.Annotations = map[string]string{
+		common.AnnGuestDiskType:                 common.GuestDiskTypeOS,
+		common.AnnGuestDiskHintPrefix + "other": "value",
+	}
+	assert.Equal(t, map[string]string{"app": "db", common.AnnGuestDiskType: common.GuestDiskTypeOS},
+		getCnsPVCLabels(context.Background(), pvc, []string{"app"}))
+	assert.Equal(t, map[string]string{"app": "db", "team": "storage"}, pvc.Labels)
+}
+
+func TestGetForeignClusterFlavor(t *testing.T) {
+	clusterID := "cluster-1"
+	volume := cnstypes.CnsVolume{}
+	volume.Metadata.ContainerCluster = cnstypes.CnsContainerCluster{
+		ClusterId:     clusterID,
+		ClusterFlavor: string(cnstypes.CnsClusterFlavorVanilla),
+	}
+	assert.Equal(t, "", getForeignClusterFlavor(volume, clusterID, cnstypes.CnsClusterFlavorVanilla))
+
+	volume.Metadata.ContainerClusterArray = []cnstypes.CnsContainerCluster{{
+		ClusterId:     clusterID,
+		ClusterFlavor: string(cnstypes.CnsClusterFlavorGuest),
+	}}
+	assert.Equal(t, string(cnstypes.CnsClusterFlavorGuest),
+		getForeignClusterFlavor(volume, clusterID, cnstypes.CnsClusterFlavorVanilla))
+	assert.Equal(t, "", getForeignClusterFlavor(volume, "cluster-2", cnstypes.CnsClusterFlavorVanilla))
+}
+
+func TestGetPVCEntityMetadataDrift(t *testing.T) {
+	clusterID := "cluster-1"
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "pvc-1", Namespace: "ns-1"}}
+	newPVCMetadata := func(name, namespace, clusterID string) *cnstypes.CnsKubernetesEntityMetadata {
+		return &cnstypes.CnsKubernetesEntityMetadata{
+			CnsEntityMetadata: cnstypes.CnsEntityMetadata{EntityName: name, ClusterID: clusterID},
+			EntityType:        string(cnstypes.CnsKubernetesEntityTypePVC),
+			Namespace:         namespace,
+		}
+	}
+	newVolume := func(metadata ...*cnstypes.CnsKubernetesEntityMetadata) *cnstypes.CnsVolume {
+		volume := &cnstypes.CnsVolume{}
+		for _, m := range metadata {
+			volume.Metadata.EntityMetadata = append(volume.Metadata.EntityMetadata, m)
+		}
+		return volume
+	}
+
+	missing, stale := getPVCEntityMetadataDrift(newVolume(newPVCMetadata("pvc-1", "ns-1", clusterID),
+		newPVCMetadata("pvc-1", "ns-2", "cluster-2")), []*corev1.PersistentVolumeClaim{pvc}, clusterID)
+	assert.Empty(t, missing)
+	assert.Empty(t, stale)
+
+	missing, stale = getPVCEntityMetadataDrift(newVolume(newPVCMetadata("pvc-1", "ns-old", clusterID)),
+		[]*corev1.PersistentVolumeClaim{pvc}, clusterID)
+	assert.Equal(t, []*corev1.PersistentVolumeClaim{pvc}, missing)
+	assert.Len(t, stale, 1)
+	assert.Equal(t, "ns-old", stale[0].Namespace)
+
+	missing, stale = getPVCEntityMetadataDrift(newVolume(), []*corev1.PersistentVolumeClaim{pvc}, clusterID)
+	assert.Equal(t, []*corev1.PersistentVolumeClaim{pvc}, missing)
+	assert.Empty(t, stale)
+
+	// A volume shared by several PVs carries the metadata of each bound PVC.
+	pvc2 := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "pvc-2", Namespace: "ns-1"}}
+	missing, stale = getPVCEntityMetadataDrift(newVolume(newPVCMetadata("pvc-1", "ns-1", clusterID),
+		newPVCMetadata("pvc-2", "ns-1", clusterID)), []*corev1.PersistentVolumeClaim{pvc, pvc2}, clusterID)
+	assert.Empty(t, missing)
+	assert.Empty(t, stale)
+
+	missing, stale = getPVCEntityMetadataDrift(newVolume(newPVCMetadata("pvc-1", "ns-1", clusterID)),
+		[]*corev1.PersistentVolumeClaim{pvc, pvc2}, clusterID)
+	assert.Equal(t, []*corev1.PersistentVolumeClaim{pvc2}, missing)
+	assert.Empty(t, stale)
+}
+
+func TestValidateStaticVolumeCapacity(t *testing.T) {
+	pv := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "static-pv"},
+		Spec: corev1.PersistentVolumeSpec{
+			Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("2Gi")},
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{VolumeHandle: "fcd-1"},
+			},
+		},
+	}
+	assert.NoError(t, validateStaticVolumeCapacity(pv, 2048))
+	assert.NoError(t, validateStaticVolumeCapacity(pv, 4096))
+	assert.Error(t, validateStaticVolumeCapacity(pv, 1024))
+	// Capacity of the volume unknown.
+	assert.NoError(t, validateStaticVolumeCapacity(pv, 0))
+}
+
+func TestValidateStaticVolumeCluster(t *testing.T) {
+	volume := &cnstypes.CnsVolume{VolumeId: cnstypes.CnsVolumeId{Id: "fcd-1"}}
+	assert.NoError(t, validateStaticVolumeCluster(volume, "cluster-1"))
+
+	volume.Metadata.ContainerClusterArray = []cnstypes.CnsContainerCluster{{ClusterId: "cluster-2"}}
+	assert.Error(t, validateStaticVolumeCluster(volume, "cluster-1"))
+
+	volume.Metadata.ContainerClusterArray = append(volume.Metadata.ContainerClusterArray,
+		cnstypes.CnsContainerCluster{ClusterId: "cluster-1"})
+	assert.NoError(t, validateStaticVolumeCluster(volume, "cluster-1"))
+}
+
+func TestPVEncryptionAnnotations(t *testing.T) {
+	pv := &corev1.PersistentVolume{}
+	unencrypted := getPVEncryptionAnnotations(nil)
+	assert.Equal(t, "false", unencrypted[annEncrypted])
+	assert.True(t, isPVEncryptionAnnotationUpdateRequired(pv, unencrypted))
+
+	pv.Annotations = map[string]string{annEncrypted: "false"}
+	assert.False(t, isPVEncryptionAnnotationUpdateRequired(pv, unencrypted))
+
+	encrypted := getPVEncryptionAnnotations(&vim25types.CryptoKeyId{
+		KeyId:      "key-1",
+		ProviderId: &vim25types.KeyProviderId{Id: "provider-1"},
+	})
+	assert.Equal(t, map[string]string{
+		annEncrypted:             "true",
+		annEncryptionKeyProvider: "provider-1",
+		annEncryptionKeyID:       "key-1",
+	}, encrypted)
+	assert.True(t, isPVEncryptionAnnotationUpdateRequired(pv, encrypted))
+
+	// A rekey changes the key of the volume.
+	pv.Annotations = encrypted
+	rekeyed := getPVEncryptionAnnotations(&vim25types.CryptoKeyId{
+		KeyId:      "key-2",
+		ProviderId: &vim25types.KeyProviderId{Id: "provider-1"},
+	})
+	assert.False(t, isPVEncryptionAnnotationUpdateRequired(pv, encrypted))
+	assert.True(t, isPVEncryptionAnnotationUpdateRequired(pv, rekeyed))
+
+	// The key annotations of an unencrypted volume must be removed.
+	pv.Annotations = map[string]string{annEncrypted: "false", annEncryptionKeyID: "key-1"}
+	assert.True(t, isPVEncryptionAnnotationUpdateRequired(pv, unencrypted))
+}
+
+func TestAdminAPIPagination(t *testing.T) {
+	var pvs []*corev1.PersistentVolume
+	for _, name := range []string{"pv-c", "pv-a", "pv-b"} {
+		pvs = append(pvs, &corev1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	limit, offset, err := parseAdminPagination("2", "")
+	assert.NoError(t, err)
+	page, next := paginateAdminPVs(pvs, limit, offset)
+	assert.Equal(t, 2, next)
+	assert.Equal(t, []string{"pv-a", "pv-b"}, []string{page[0].Name, page[1].Name})
+
+	limit, offset, err = parseAdminPagination("2", strconv.Itoa(next))
+	assert.NoError(t, err)
+	page, next = paginateAdminPVs(pvs, limit, offset)
+	assert.Equal(t, 0, next)
+	assert.Len(t, page, 1)
+	assert.Equal(t, "pv-c", page[0].Name)
+
+	limit, _, err = parseAdminPagination("", "")
+	assert.NoError(t, err)
+	assert.Equal(t, defaultAdminVolumesLimit, limit)
+	limit, _, err = parseAdminPagination("100000", "")
+	assert.NoError(t, err)
+	assert.Equal(t, maxAdminVolumesLimit, limit)
+	for _, params := range [][2]string{{"0", ""}, {"abc", ""}, {"", "-1"}} {
+		_, _, err = parseAdminPagination(params[0], params[1])
+		assert.Error(t, err, "params: %v", params)
+	}
+}
+
+func TestAdminAPIAddr(t *testing.T) {
+	assert.Equal(t, "127.0.0.1:9443", getAdminServerAddr("9443", false))
+	assert.Equal(t, ":9443", getAdminServerAddr("9443", true))
+}
+
+func TestAdminAPIAttachedNodes(t *testing.T) {
+	informer := informers.NewSharedInformerFactory(testclient.NewSimpleClientset(), 0).
+		Storage().V1().VolumeAttachments()
+	newVolumeAttachment := func(name, attacher, pvName, nodeName string, attached bool) *storagev1.VolumeAttachment {
+		return &storagev1.VolumeAttachment{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: storagev1.VolumeAttachmentSpec{
+				Attacher: attacher,
+				Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &pvName},
+				NodeName: nodeName,
+			},
+			Status: storagev1.VolumeAttachmentStatus{Attached: attached},
+		}
+	}
+	for _, va := range []*storagev1.VolumeAttachment{
+		newVolumeAttachment("va-1", "csi.vsphere.vmware.com", "pv-1", "node-1", true),
+		newVolumeAttachment("va-2", "csi.vsphere.vmware.com", "pv-1", "node-2", true),
+		newVolumeAttachment("va-3", "csi.vsphere.vmware.com", "pv-2", "node-1", false),
+		newVolumeAttachment("va-4", "other.csi.driver", "pv-3", "node-1", true),
+	} {
+		assert.NoError(t, informer.Informer().GetIndexer().Add(va))
+	}
+	s := &adminServer{volumeAttachmentLister: informer.Lister()}
+	attachedNodes := s.getAttachedNodes(context.Background())
+	assert.ElementsMatch(t, []string{"node-1", "node-2"}, attachedNodes["pv-1"])
+	assert.NotContains(t, attachedNodes, "pv-2")
+	assert.NotContains(t, attachedNodes, "pv-3")
+}
+
+func TestAdminAPIAuthorization(t *testing.T) {
+	s := &adminServer{token: "secret"}
+	handler := s.authorize(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	for header, expectedStatus := range map[string]int{
+		"":              http.StatusUnauthorized,
+		"Bearer wrong":  http.StatusUnauthorized,
+		"secret":        http.StatusUnauthorized,
+		"Bearer secret": http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodGet, adminVolumesPath, nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		assert.Equal(t, expectedStatus, rec.Code, "Authorization header: %q", header)
+	}
+}
+
+func TestQueryVolumesInBatches(t *testing.T) {
+	fullSyncQueryRetryInterval = 0
+	var volumes []cnstypes.CnsVolume
+	for i := range 5 {
+		volumes = append(volumes, cnstypes.CnsVolume{VolumeId: cnstypes.CnsVolumeId{Id: strconv.Itoa(i)}})
+	}
+	failures := map[int64]int{2: fullSyncQueryBatchAttempts - 1}
+	var offsets []int64
+	queryBatch := func(cursor cnstypes.CnsCursor) (*cnstypes.CnsQueryResult, error) {
+		offsets = append(offsets, cursor.Offset)
+		if failures[cursor.Offset] > 0 {
+			failures[cursor.Offset]--
+			return nil, fmt.Errorf("query of offset %d failed", cursor.Offset)
+		}
+		end := min(cursor.Offset+cursor.Limit, int64(len(volumes)))
+		return &cnstypes.CnsQueryResult{
+			Volumes: volumes[cursor.Offset:end],
+			Cursor:  cnstypes.CnsCursor{Offset: end, Limit: cursor.Limit, TotalRecords: int64(len(volumes))},
+		}, nil
+	}
+	queryResult, err := queryVolumesInBatches(context.Background(), 2, queryBatch)
+	assert.NoError(t, err)
+	assert.Equal(t, volumes, queryResult.Volumes)
+	// Only the failed batch is queried again.
+	assert.Equal(t, []int64{0, 2, 2, 2, 4}, offsets)
+
+	failures = map[int64]int{2: fullSyncQueryBatchAttempts}
+	_, err = queryVolumesInBatches(context.Background(), 2, queryBatch)
+	assert.Error(t, err)
+
+	// A cursor ignored by CNS returns all the volumes in the first batch.
+	queryResult, err = queryVolumesInBatches(context.Background(), 2,
+		func(cursor cnstypes.CnsCursor) (*cnstypes.CnsQueryResult, error) {
+			return &cnstypes.CnsQueryResult{Volumes: volumes}, nil
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, volumes, queryResult.Volumes)
+
+	// A volume deleted before the second batch shifts the following volumes
+	// to lower offsets, the shifted offsets are queried again.
+	liveVolumes := append([]cnstypes.CnsVolume{}, volumes...)
+	offsets = nil
+	queryResult, err = queryVolumesInBatches(context.Background(), 2,
+		func(cursor cnstypes.CnsCursor) (*cnstypes.CnsQueryResult, error) {
+			offsets = append(offsets, cursor.Offset)
+			if len(offsets) == 2 {
+				liveVolumes = liveVolumes[1:]
+			}
+			end := min(cursor.Offset+cursor.Limit, int64(len(liveVolumes)))
+			return &cnstypes.CnsQueryResult{
+				Volumes: liveVolumes[cursor.Offset:end],
+				Cursor:  cnstypes.CnsCursor{Offset: end, Limit: cursor.Limit, TotalRecords: int64(len(liveVolumes))},
+			}, nil
+		})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, volumes, queryResult.Volumes)
+	assert.Equal(t, []int64{0, 2, 1, 3}, offsets)
+}
+
+func TestResetNodeResizeStatus(t *testing.T) {
+	resizeError := corev1.PersistentVolumeClaimCondition{Type: corev1.PersistentVolumeClaimNodeResizeError,
+		Status: corev1.ConditionTrue, Message: "FilesystemCheckRequired: failed to resize filesystem"}
+	modifying := corev1.PersistentVolumeClaimCondition{Type: corev1.PersistentVolumeClaimVolumeModifyingVolume,
+		Status: corev1.ConditionTrue}
+	newPVC := func(resizeStatus corev1.ClaimResourceStatus,
+		conditions ...corev1.PersistentVolumeClaimCondition) *corev1.PersistentVolumeClaim {
+		return &corev1.PersistentVolumeClaim{Status: corev1.PersistentVolumeClaimStatus{
+			AllocatedResourceStatuses: map[corev1.ResourceName]corev1.ClaimResourceStatus{
+				corev1.ResourceStorage: resizeStatus,
+			},
+			Conditions: conditions,
+		}}
+	}
+	tests := []struct {
+		name         string
+		pvc          *corev1.PersistentVolumeClaim
+		failed       bool
+		resizeStatus corev1.ClaimResourceStatus
+		conditions   []corev1.PersistentVolumeClaimCondition
+	}{
+		{
+			name:         "infeasible node expansion",
+			pvc:          newPVC(corev1.PersistentVolumeClaimNodeResizeInfeasible, resizeError, modifying),
+			failed:       true,
+			resizeStatus: corev1.PersistentVolumeClaimNodeResizePending,
+			conditions:   []corev1.PersistentVolumeClaimCondition{modifying},
+		},
+		{
+			name:         "failed node expansion retried by kubelet",
+			pvc:          newPVC(corev1.PersistentVolumeClaimNodeResizeInProgress, resizeError),
+			failed:       true,
+			resizeStatus: corev1.PersistentVolumeClaimNodeResizePending,
+		},
+		{
+			name:         "node expansion in progress",
+			pvc:          newPVC(corev1.PersistentVolumeClaimNodeResizeInProgress, modifying),
+			failed:       false,
+			resizeStatus: corev1.PersistentVolumeClaimNodeResizeInProgress,
+			conditions:   []corev1.PersistentVolumeClaimCondition{modifying},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			retriedPVC, failed := resetNodeResizeStatus(test.pvc)
+			assert.Equal(t, test.failed, failed)
+			assert.Equal(t, test.resizeStatus, retriedPVC.Status.AllocatedResourceStatuses[corev1.ResourceStorage])
+			assert.Equal(t, test.conditions, retriedPVC.Status.Conditions)
+		})
+	}
+}
+
+func TestIsDriverCreatedVolume(t *testing.T) {
+	vol := cnstypes.CnsVolume{VolumeId: cnstypes.CnsVolumeId{Id: "vol-1"}, Name: "pvc-1"}
+	newRequest := func(volumeID string) *cnsvolumeoprequestv1alpha1.CnsVolumeOperationRequest {
+		return &cnsvolumeoprequestv1alpha1.CnsVolumeOperationRequest{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc-1"},
+			Status:     cnsvolumeoprequestv1alpha1.CnsVolumeOperationRequestStatus{VolumeID: volumeID},
+		}
+	}
+	tests := []struct {
+		name     string
+		request  *cnsvolumeoprequestv1alpha1.CnsVolumeOperationRequest
+		expected bool
+	}{
+		{name: "statically provisioned volume with no request", request: nil, expected: false},
+		{name: "request with no created volume", request: newRequest(""), expected: false},
+		{name: "request which created another volume", request: newRequest("vol-2"), expected: false},
+		{name: "volume created by the driver", request: newRequest("vol-1"), expected: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, isDriverCreatedVolume(vol, test.request))
+		})
+	}
+}
+
+func TestGetPodEphemeralVolumeNames(t *testing.T) {
+	newCSIVolume := func(name, driver string) corev1.Volume {
+		return corev1.Volume{
+			Name:         name,
+			VolumeSource: corev1.VolumeSource{CSI: &corev1.CSIVolumeSource{Driver: driver}},
+		}
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod-1", UID: "uid-1"},
+		Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{
+				newCSIVolume("scratch", "csi.vsphere.vmware.com"),
+				newCSIVolume("secrets", "secrets-store.csi.k8s.io"),
+				{Name: "data", VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "pvc-1"},
+				}},
+			},
+		},
+	}
+	names := getPodEphemeralVolumeNames([]*corev1.Pod{pod})
+	// Only the inline volume of the driver is backed by a CNS volume, named
+	// after the volume handle kubelet generates for it.
+	expected := common.GetEphemeralVolumeName(common.GetEphemeralVolumeHandle("uid-1", "scratch"))
+	assert.Equal(t, map[string]bool{expected: true}, names)
+}
+
+func TestGetVolumesToBeDeletedSkipsEphemeralVolumes(t *testing.T) {
+	ctx := context.Background()
+	savedCnsDeletionMap := cnsDeletionMap
+	defer func() { cnsDeletionMap = savedCnsDeletionMap }()
+	cnsDeletionMap = map[string]map[string]bool{"vc-1": {}}
+	metadataSyncer := &metadataSyncInformer{clusterFlavor: cnstypes.CnsClusterFlavorVanilla}
+	cnsVolumes := []cnstypes.CnsVolume{
+		{VolumeId: cnstypes.CnsVolumeId{Id: "vol-1"}, Name: "pvc-1"},
+		{VolumeId: cnstypes.CnsVolumeId{Id: "vol-2"}, Name: common.EphemeralVolumeNamePrefix + "2"},
+	}
+	// Volumes are deleted once they have had no PV across two full syncs.
+	for range 2 {
+		volumes, err := getVolumesToBeDeleted(ctx, cnsVolumes, map[string]string{}, metadataSyncer, false, "vc-1")
+		assert.NoError(t, err)
+		for _, volume := range volumes {
+			assert.NotEqual(t, "vol-2", volume.Id, "ephemeral volume must not be deleted by full sync")
+		}
+	}
+	assert.NotContains(t, cnsDeletionMap["vc-1"], "vol-2")
+	assert.Contains(t, cnsDeletionMap["vc-1"], "vol-1")
+}
+
+// countingVolumeManager counts the calls to RetrieveVStorageObject.
+type countingVolumeManager struct {
+	cnsvolume.Manager
+	retrieved []string
+}
+
+func (m *countingVolumeManager) RetrieveVStorageObject(ctx context.Context,
+	volumeID string) (*vim25types.VStorageObject, error) {
+	m.retrieved = append(m.retrieved, volumeID)
+	return nil, errors.New("not found")
+}
+
+func TestFullSyncPVEncryption(t *testing.T) {
+	newPV := func(name string, annotations map[string]string) *corev1.PersistentVolume {
+		return &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: annotations},
+			Spec: corev1.PersistentVolumeSpec{
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{VolumeHandle: "vol-" + name},
+				},
+			},
+			Status: corev1.PersistentVolumeStatus{Phase: corev1.VolumeBound},
+		}
+	}
+	pvs := []*corev1.PersistentVolume{
+		newPV("annotated", map[string]string{annEncrypted: "false"}),
+		newPV("missing", nil),
+	}
+	volManager := &countingVolumeManager{}
+	fullSyncPVEncryption(context.Background(), pvs, volManager)
+	// Only the PV missing the annotations is looked up in vCenter.
+	assert.Equal(t, []string{"vol-missing"}, volManager.retrieved)
+}
+
+func TestGetPVDatastoreURLUpdates(t *testing.T) {
+	newPV := func(name string, datastoreURL string) *corev1.PersistentVolume {
+		pv := &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: corev1.PersistentVolumeSpec{
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{VolumeHandle: "vol-" + name},
+				},
+			},
+			Status: corev1.PersistentVolumeStatus{Phase: corev1.VolumeBound},
+		}
+		if datastoreURL != "" {
+			pv.Annotations = map[string]string{annDatastoreURL: datastoreURL}
+		}
+		return pv
+	}
+	newVolume := func(name string, datastoreURL string) cnstypes.CnsVolume {
+		return cnstypes.CnsVolume{VolumeId: cnstypes.CnsVolumeId{Id: "vol-" + name}, DatastoreUrl: datastoreURL}
+	}
+	unbound := newPV("unbound", "")
+	unbound.Status.Phase = corev1.VolumeReleased
+	k8sPVs := []*corev1.PersistentVolume{
+		newPV("missing", ""),
+		newPV("relocated", "ds:///vmfs/volumes/ds-1/"),
+		newPV("unchanged", "ds:///vmfs/volumes/ds-1/"),
+		newPV("unknown", "ds:///vmfs/volumes/ds-1/"),
+		newPV("no-datastore", "ds:///vmfs/volumes/ds-1/"),
+		unbound,
+	}
+	cnsVolumes := []cnstypes.CnsVolume{
+		newVolume("missing", "ds:///vmfs/volumes/ds-1/"),
+		newVolume("relocated", " ds:///vmfs/volumes/ds-2/ "),
+		newVolume("unchanged", "ds:///vmfs/volumes/ds-1/"),
+		newVolume("no-datastore", ""),
+		newVolume("unbound", "ds:///vmfs/volumes/ds-1/"),
+	}
+	assert.Equal(t, map[string]string{
+		"missing":   "ds:///vmfs/volumes/ds-1/",
+		"relocated": "ds:///vmfs/volumes/ds-2/",
+	}, getPVDatastoreURLUpdates(k8sPVs, cnsVolumes))
+}
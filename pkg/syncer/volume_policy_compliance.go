@@ -0,0 +1,174 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	pbmtypes "github.com/vmware/govmomi/pbm/types"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/utils"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+)
+
+// csiGetVolumePolicyComplianceStatus queries CNS for the storage policy
+// compliance status of all the volumes of this cluster on the given vCenter
+// and records it on the bound PVs with the policy compliance annotations.
+// PVs whose storage class does not specify a storage policy are skipped.
+func csiGetVolumePolicyComplianceStatus(ctx context.Context, k8sclient clientset.Interface,
+	metadataSyncer *metadataSyncInformer, vc string) {
+	log := logger.GetLogger(ctx)
+	log.Debugf("csiGetVolumePolicyComplianceStatus for %s: start", vc)
+	querySelection := cnstypes.CnsQuerySelection{
+		Names: []string{
+			string(cnstypes.QuerySelectionNameTypeComplianceStatus),
+		},
+	}
+
+	cnsVolumeMgr, err := getVolManagerForVcHost(ctx, vc, metadataSyncer)
+	if err != nil {
+		log.Errorf("csiGetVolumePolicyComplianceStatus for %s: Failed to get volume manager. Err: %v", vc, err)
+		return
+	}
+	queryAllResult, err := utils.QueryAllVolumesForCluster(ctx, cnsVolumeMgr,
+		clusterIDforVolumeMetadata, querySelection)
+	if err != nil {
+		log.Errorf("csiGetVolumePolicyComplianceStatus for %s: failed to QueryAllVolume with err=%+v", vc, err)
+		return
+	}
+
+	// Get K8s PVs in State "Bound".
+	k8sPVs, err := getBoundPVs(ctx, metadataSyncer)
+	if err != nil {
+		log.Errorf("csiGetVolumePolicyComplianceStatus for %s: Failed to get PVs from kubernetes. Err: %+v", vc, err)
+		return
+	}
+
+	storageClassList, err := k8sclient.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		log.Errorf("csiGetVolumePolicyComplianceStatus for %s: Failed to list storageclasses. Err: %+v", vc, err)
+		return
+	}
+	// scWithPolicy holds the names of the storage classes which specify a storage policy.
+	scWithPolicy := make(map[string]bool)
+	for _, sc := range storageClassList.Items {
+		for param := range sc.Parameters {
+			param = strings.ToLower(param)
+			if param == common.AttributeStoragePolicyName || param == common.AttributeStoragePolicyID {
+				scWithPolicy[sc.Name] = true
+				break
+			}
+		}
+	}
+
+	// volumeIdToComplianceStatusMap maps vol.VolumeId.Id to vol.ComplianceStatus.
+	volumeIdToComplianceStatusMap := make(map[string]string, len(queryAllResult.Volumes))
+	for _, vol := range queryAllResult.Volumes {
+		volumeIdToComplianceStatusMap[vol.VolumeId.Id] = vol.ComplianceStatus
+	}
+
+	for _, pv := range k8sPVs {
+		if !scWithPolicy[pv.Spec.StorageClassName] {
+			log.Debugf("csiGetVolumePolicyComplianceStatus for %s: Skipping pv %s as its storage class %q "+
+				"does not specify a storage policy", vc, pv.Name, pv.Spec.StorageClassName)
+			continue
+		}
+		complianceStatus, ok := volumeIdToComplianceStatusMap[pv.Spec.CSI.VolumeHandle]
+		if !ok {
+			log.Debugf("csiGetVolumePolicyComplianceStatus for %s: Skipping vol %s as it is not found on this VC.",
+				vc, pv.Spec.CSI.VolumeHandle)
+			continue
+		}
+		complianceStatusAnn := convertPolicyComplianceStatus(complianceStatus)
+		if complianceStatusAnn == "" {
+			log.Debugf("csiGetVolumePolicyComplianceStatus for %s: Skipping pv %s with compliance status %q",
+				vc, pv.Name, complianceStatus)
+			continue
+		}
+		updateVolumePolicyComplianceStatus(ctx, k8sclient, pv, complianceStatusAnn)
+	}
+	log.Debugf("csiGetVolumePolicyComplianceStatus for %s: end", vc)
+}
+
+// convertPolicyComplianceStatus converts the SPBM compliance status reported
+// by CNS to the value of the policy compliance annotation. An empty string is
+// returned if the compliance of the volume cannot be determined.
+func convertPolicyComplianceStatus(complianceStatus string) string {
+	switch pbmtypes.PbmComplianceStatus(complianceStatus) {
+	case pbmtypes.PbmComplianceStatusCompliant:
+		return policyComplianceStatusCompliant
+	case pbmtypes.PbmComplianceStatusNonCompliant, pbmtypes.PbmComplianceStatusOutOfDate:
+		return policyComplianceStatusNonCompliant
+	default:
+		return ""
+	}
+}
+
+// updateVolumePolicyComplianceStatus sets the policy compliance annotation and
+// its last checked timestamp on the given PV. A warning event is generated on
+// the PV when it transitions to noncompliant.
+func updateVolumePolicyComplianceStatus(ctx context.Context, k8sclient clientset.Interface,
+	pv *v1.PersistentVolume, complianceStatus string) {
+	log := logger.GetLogger(ctx)
+
+	oldComplianceStatus := pv.Annotations[annPolicyCompliance]
+	timeNow := time.Now().Format(time.UnixDate)
+	newPv := pv.DeepCopy()
+	metav1.SetMetaDataAnnotation(&newPv.ObjectMeta, annPolicyCompliance, complianceStatus)
+	metav1.SetMetaDataAnnotation(&newPv.ObjectMeta, annPolicyComplianceTS, timeNow)
+	_, err := k8sclient.CoreV1().PersistentVolumes().Update(ctx, newPv, metav1.UpdateOptions{})
+	if err != nil {
+		if !apierrors.IsConflict(err) {
+			log.Errorf("updateVolumePolicyComplianceStatus: Failed to update pv %s with err:%+v", pv.Name, err)
+			return
+		}
+		log.Debugf("updateVolumePolicyComplianceStatus: Failed to update pv %s with err:%+v, will retry the update",
+			pv.Name, err)
+		// pv get from pvLister may be stale, try to get updated pv from API server.
+		newPv, err = k8sclient.CoreV1().PersistentVolumes().Get(ctx, pv.Name, metav1.GetOptions{})
+		if err != nil {
+			log.Errorf("updateVolumePolicyComplianceStatus: policy compliance annotation for pv %s is not updated "+
+				"because failed to get pv from API server. err=%+v", pv.Name, err)
+			return
+		}
+		oldComplianceStatus = newPv.Annotations[annPolicyCompliance]
+		metav1.SetMetaDataAnnotation(&newPv.ObjectMeta, annPolicyCompliance, complianceStatus)
+		metav1.SetMetaDataAnnotation(&newPv.ObjectMeta, annPolicyComplianceTS, timeNow)
+		_, err = k8sclient.CoreV1().PersistentVolumes().Update(ctx, newPv, metav1.UpdateOptions{})
+		if err != nil {
+			log.Errorf("updateVolumePolicyComplianceStatus: Failed to update pv %s with err:%+v", pv.Name, err)
+			return
+		}
+	}
+	if oldComplianceStatus != complianceStatus {
+		log.Infof("updateVolumePolicyComplianceStatus: set policy compliance annotation for pv %s from old "+
+			"value %q to new value %q", pv.Name, oldComplianceStatus, complianceStatus)
+		if complianceStatus == policyComplianceStatusNonCompliant {
+			generateEventOnPv(ctx, newPv, v1.EventTypeWarning, policyNonCompliantReason,
+				fmt.Sprintf("Volume %s is not compliant with its storage policy", pv.Spec.CSI.VolumeHandle))
+		}
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	pbmtypes "github.com/vmware/govmomi/pbm/types"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestConvertPolicyComplianceStatus(t *testing.T) {
+	tests := map[string]string{
+		string(pbmtypes.PbmComplianceStatusCompliant):     policyComplianceStatusCompliant,
+		string(pbmtypes.PbmComplianceStatusNonCompliant):  policyComplianceStatusNonCompliant,
+		string(pbmtypes.PbmComplianceStatusOutOfDate):     policyComplianceStatusNonCompliant,
+		string(pbmtypes.PbmComplianceStatusUnknown):       "",
+		string(pbmtypes.PbmComplianceStatusNotApplicable): "",
+		"": "",
+	}
+	for complianceStatus, expected := range tests {
+		assert.Equal(t, expected, convertPolicyComplianceStatus(complianceStatus), complianceStatus)
+	}
+}
+
+func TestUpdateVolumePolicyComplianceStatus(t *testing.T) {
+	ctx := context.TODO()
+	newPV := func(annotations map[string]string) *corev1.PersistentVolume {
+		return &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-1", Annotations: annotations},
+			Spec: corev1.PersistentVolumeSpec{
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{VolumeHandle: "volume-1"},
+				},
+			},
+		}
+	}
+	getAnnotations := func(k8sClient *testclient.Clientset) map[string]string {
+		pv, err := k8sClient.CoreV1().PersistentVolumes().Get(ctx, "pv-1", metav1.GetOptions{})
+		assert.NoError(t, err)
+		return pv.Annotations
+	}
+
+	// The annotations are added to a PV which was never checked.
+	k8sClient := testclient.NewSimpleClientset(newPV(nil))
+	updateVolumePolicyComplianceStatus(ctx, k8sClient, newPV(nil), policyComplianceStatusCompliant)
+	annotations := getAnnotations(k8sClient)
+	assert.Equal(t, policyComplianceStatusCompliant, annotations[annPolicyCompliance])
+	assert.NotEmpty(t, annotations[annPolicyComplianceTS])
+
+	// Other annotations of the PV are preserved.
+	pv := newPV(map[string]string{"foo": "bar", annPolicyCompliance: policyComplianceStatusCompliant})
+	k8sClient = testclient.NewSimpleClientset(pv)
+	updateVolumePolicyComplianceStatus(ctx, k8sClient, pv, policyComplianceStatusNonCompliant)
+	annotations = getAnnotations(k8sClient)
+	assert.Equal(t, policyComplianceStatusNonCompliant, annotations[annPolicyCompliance])
+	assert.Equal(t, "bar", annotations["foo"])
+	// The PV passed in is not modified.
+	assert.Equal(t, policyComplianceStatusCompliant, pv.Annotations[annPolicyCompliance])
+
+	// A conflict on update is retried with the PV from the API server.
+	k8sClient = testclient.NewSimpleClientset(newPV(map[string]string{"foo": "baz"}))
+	conflicts := 0
+	k8sClient.PrependReactor("update", "persistentvolumes",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if conflicts > 0 {
+				return false, nil, nil
+			}
+			conflicts++
+			return true, nil, apierrors.NewConflict(schema.GroupResource{Resource: "persistentvolumes"},
+				"pv-1", nil)
+		})
+	updateVolumePolicyComplianceStatus(ctx, k8sClient, newPV(nil), policyComplianceStatusCompliant)
+	annotations = getAnnotations(k8sClient)
+	assert.Equal(t, 1, conflicts)
+	assert.Equal(t, policyComplianceStatusCompliant, annotations[annPolicyCompliance])
+	assert.Equal(t, "baz", annotations["foo"])
+}
@@ -0,0 +1,365 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	"github.com/vmware/govmomi/vim25/progress"
+	"github.com/vmware/govmomi/vim25/soap"
+	vim25types "github.com/vmware/govmomi/vim25/types"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	clientset "k8s.io/client-go/kubernetes"
+	corev1helpers "k8s.io/component-helpers/scheduling/corev1"
+
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/node"
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/v3/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/v3/pkg/csi/service/logger"
+	k8s "sigs.k8s.io/vsphere-csi-driver/v3/pkg/kubernetes"
+)
+
+const (
+	// annRelocateToDatastoreURL is set on a PV by an admin to relocate the
+	// volume to the datastore with the given URL, e.g. to evacuate a datastore
+	// for maintenance. It is removed once the relocation is done.
+	annRelocateToDatastoreURL = "cns.vmware.com/relocate-to-datastore-url"
+	// annRelocationStatus records the status of the last relocation of the
+	// volume requested using annRelocateToDatastoreURL.
+	annRelocationStatus = "cns.vmware.com/relocation-status"
+
+	relocationStatusInProgress = "InProgress"
+	relocationStatusSucceeded  = "Succeeded"
+	relocationStatusFailed     = "Failed"
+	relocationStatusSkipped    = "Skipped"
+
+	// Reasons of the events generated on the PV for its relocation.
+	volumeRelocationStartedReason   = "VolumeRelocationStarted"
+	volumeRelocationSucceededReason = "VolumeRelocationSucceeded"
+	volumeRelocationFailedReason    = "VolumeRelocationFailed"
+	volumeRelocationSkippedReason   = "VolumeRelocationSkipped"
+)
+
+// pvRelocations holds the names of the PVs being relocated, so that updates
+// of a PV during its relocation do not start another one.
+var pvRelocations sync.Map
+
+// relocatePVVolume relocates the CNS volume of the PV in the background to the
+// datastore requested using annRelocateToDatastoreURL. The volume stays bound
+// during the relocation. The progress is recorded in annRelocationStatus and
+// the outcome is reported as a PV event.
+func relocatePVVolume(ctx context.Context, pv *v1.PersistentVolume, metadataSyncer *metadataSyncInformer) {
+	log := logger.GetLogger(ctx)
+	datastoreURL := strings.TrimSpace(pv.GetAnnotations()[annRelocateToDatastoreURL])
+	if datastoreURL == "" || pv.Spec.CSI == nil {
+		return
+	}
+	if _, inProgress := pvRelocations.LoadOrStore(pv.Name, struct{}{}); inProgress {
+		log.Debugf("Relocation of PV %q is already in progress", pv.Name)
+		return
+	}
+	go func() {
+		defer pvRelocations.Delete(pv.Name)
+		status, reason, message := relocateVolumeToDatastore(ctx, pv, metadataSyncer, datastoreURL)
+		eventType := v1.EventTypeNormal
+		if status != relocationStatusSucceeded {
+			eventType = v1.EventTypeWarning
+			log.Errorf("Relocation of PV %q: %s", pv.Name, message)
+		} else {
+			log.Infof("Relocation of PV %q: %s", pv.Name, message)
+		}
+		generateEventOnPv(ctx, pv, eventType, reason, message)
+		if status == relocationStatusSucceeded {
+			if err := patchPVDatastoreURL(ctx, pv.Name, datastoreURL); err != nil {
+				log.Errorf("failed to update datastore URL annotation of PV %q. Err: %v", pv.Name, err)
+			}
+		}
+		if err := patchPVRelocationStatus(ctx, pv.Name, status+": "+message, true); err != nil {
+			log.Errorf("failed to update relocation status of PV %q. Err: %v", pv.Name, err)
+		}
+	}()
+}
+
+// relocateVolumeToDatastore relocates the volume of the PV to the datastore
+// with the given URL. It returns the status of the relocation, with the
+// reason and message of the event to generate on the PV.
+func relocateVolumeToDatastore(ctx context.Context, pv *v1.PersistentVolume,
+	metadataSyncer *metadataSyncInformer, datastoreURL string) (string, string, string) {
+	log := logger.GetLogger(ctx)
+	volumeID := pv.Spec.CSI.VolumeHandle
+	failed := func(format string, args ...interface{}) (string, string, string) {
+		return relocationStatusFailed, volumeRelocationFailedReason, fmt.Sprintf(format, args...)
+	}
+	if strings.HasPrefix(volumeID, "file:") {
+		return relocationStatusSkipped, volumeRelocationSkippedReason,
+			fmt.Sprintf("volume %q is a file volume, only block volumes can be relocated", volumeID)
+	}
+
+	vcHost, volManager, err := getVcHostAndVolumeManagerForVolumeID(ctx, metadataSyncer, volumeID)
+	if err != nil {
+		return failed("failed to get vCenter of volume %q. Err: %v", volumeID, err)
+	}
+	vc, err := cnsvsphere.GetVirtualCenterInstanceForVCenterHost(ctx, vcHost, true)
+	if err != nil {
+		return failed("failed to get vCenter %q. Err: %v", vcHost, err)
+	}
+	queryResult, err := volManager.QueryVolume(ctx, cnstypes.CnsQueryFilter{
+		VolumeIds: []cnstypes.CnsVolumeId{{Id: volumeID}},
+	})
+	if err != nil {
+		return failed("failed to query volume %q. Err: %v", volumeID, err)
+	}
+	if len(queryResult.Volumes) == 0 {
+		return failed("volume %q not found in CNS", volumeID)
+	}
+	cnsVolume := queryResult.Volumes[0]
+	if strings.TrimSpace(cnsVolume.DatastoreUrl) == datastoreURL {
+		return relocationStatusSucceeded, volumeRelocationSucceededReason,
+			fmt.Sprintf("volume %q is already on datastore %q", volumeID, datastoreURL)
+	}
+
+	nodeName, err := getPVAttachedNodeName(ctx, pv.Name)
+	if err != nil {
+		return failed("failed to check if volume %q is attached. Err: %v", volumeID, err)
+	}
+	if nodeName != "" {
+		onlineRelocation, err := common.IsvSphere8AndAbove(ctx, vc.Client.ServiceContent.About)
+		if err != nil {
+			return failed("failed to check vCenter %q version. Err: %v", vcHost, err)
+		}
+		if !onlineRelocation {
+			return relocationStatusSkipped, volumeRelocationSkippedReason,
+				fmt.Sprintf("volume %q is attached to node %q and vCenter %q does not support relocating "+
+					"attached volumes, detach the volume to relocate it", volumeID, nodeName, vcHost)
+		}
+		log.Infof("Volume %q is attached to node %q, relocating it online", volumeID, nodeName)
+	}
+
+	datastoreInfo, err := getDatastoreInfoByURL(ctx, vc, datastoreURL)
+	if err != nil {
+		return failed("failed to find datastore %q. Err: %v", datastoreURL, err)
+	}
+	if cnsvsphere.IsVolumeCreationSuspended(ctx, datastoreInfo) {
+		return failed("datastore %q is suspended and not available for relocating volumes", datastoreURL)
+	}
+	if err := validateDatastoreAccessibleFromPVNodes(ctx, pv, datastoreURL); err != nil {
+		return failed("cannot relocate volume %q to datastore %q. Err: %v", volumeID, datastoreURL, err)
+	}
+	var profileSpecs []vim25types.BaseVirtualMachineProfileSpec
+	if cnsVolume.StoragePolicyId != "" {
+		compat, err := vc.PbmCheckCompatibility(ctx,
+			[]vim25types.ManagedObjectReference{datastoreInfo.Reference()}, cnsVolume.StoragePolicyId)
+		if err != nil {
+			return failed("failed to check compatibility of datastore %q with the storage policy %q of "+
+				"volume %q. Err: %v", datastoreURL, cnsVolume.StoragePolicyId, volumeID, err)
+		}
+		if len(compat.CompatibleDatastores()) == 0 {
+			return failed("datastore %q is not compatible with the storage policy %q of volume %q",
+				datastoreURL, cnsVolume.StoragePolicyId, volumeID)
+		}
+		profileSpecs = append(profileSpecs,
+			&vim25types.VirtualMachineDefinedProfileSpec{ProfileId: cnsVolume.StoragePolicyId})
+	}
+
+	message := fmt.Sprintf("relocating volume %q from datastore %q to datastore %q", volumeID,
+		cnsVolume.DatastoreUrl, datastoreURL)
+	generateEventOnPv(ctx, pv, v1.EventTypeNormal, volumeRelocationStartedReason, message)
+	if err := patchPVRelocationStatus(ctx, pv.Name, relocationStatusInProgress+": "+message, false); err != nil {
+		log.Warnf("failed to update relocation status of PV %q. Err: %v", pv.Name, err)
+	}
+	relocateSpec := cnstypes.NewCnsBlockVolumeRelocateSpec(volumeID, datastoreInfo.Reference(), profileSpecs...)
+	task, err := volManager.RelocateVolume(ctx, relocateSpec)
+	if err != nil {
+		if soap.IsSoapFault(err) {
+			if _, ok := soap.ToSoapFault(err).VimFault().(vim25types.AlreadyExists); ok {
+				return relocationStatusSucceeded, volumeRelocationSucceededReason,
+					fmt.Sprintf("volume %q is already on datastore %q", volumeID, datastoreURL)
+			}
+		}
+		return failed("failed to relocate volume %q to datastore %q. Err: %v", volumeID, datastoreURL, err)
+	}
+	lastReported := 0
+	progressSinker := progress.SinkFunc(func() chan<- progress.Report {
+		reports := make(chan progress.Report)
+		go func() {
+			for report := range reports {
+				percentage := int(report.Percentage())
+				if percentage/10 == lastReported/10 {
+					continue
+				}
+				lastReported = percentage
+				log.Infof("Relocation of volume %q is %d%% complete", volumeID, percentage)
+				err := patchPVRelocationStatus(ctx, pv.Name,
+					fmt.Sprintf("%s (%d%%): %s", relocationStatusInProgress, percentage, message), false)
+				if err != nil {
+					log.Warnf("failed to update relocation status of PV %q. Err: %v", pv.Name, err)
+				}
+			}
+		}()
+		return reports
+	})
+	taskInfo, err := task.WaitForResultEx(ctx, progressSinker)
+	if err != nil {
+		return failed("failed to relocate volume %q to datastore %q. Err: %v", volumeID, datastoreURL, err)
+	}
+	if results, ok := taskInfo.Result.(cnstypes.CnsVolumeOperationBatchResult); ok {
+		for _, result := range results.VolumeResults {
+			if fault := result.GetCnsVolumeOperationResult().Fault; fault != nil {
+				return failed("failed to relocate volume %q to datastore %q. Fault: %s", volumeID,
+					datastoreURL, fault.LocalizedMessage)
+			}
+		}
+	}
+	return relocationStatusSucceeded, volumeRelocationSucceededReason,
+		fmt.Sprintf("volume %q relocated to datastore %q", volumeID, datastoreURL)
+}
+
+// getDatastoreInfoByURL returns the datastore with the given URL in the
+// datacenters of the vCenter.
+func getDatastoreInfoByURL(ctx context.Context, vc *cnsvsphere.VirtualCenter,
+	datastoreURL string) (*cnsvsphere.DatastoreInfo, error) {
+	datacenters, err := vc.GetDatacenters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, datacenter := range datacenters {
+		if datastoreInfo, err := datacenter.GetDatastoreInfoByURL(ctx, datastoreURL); err == nil {
+			return datastoreInfo, nil
+		}
+	}
+	return nil, fmt.Errorf("datastore with URL %q not found in vCenter %q", datastoreURL, vc.Config.Host)
+}
+
+// getPVAttachedNodeName returns the name of the node the PV is attached to,
+// or "" if it is not attached.
+func getPVAttachedNodeName(ctx context.Context, pvName string) (string, error) {
+	k8sClient, err := k8s.NewClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	attachments, err := k8sClient.StorageV1().VolumeAttachments().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	for _, attachment := range attachments.Items {
+		if attachment.Spec.Source.PersistentVolumeName != nil &&
+			*attachment.Spec.Source.PersistentVolumeName == pvName && attachment.Status.Attached {
+			return attachment.Spec.NodeName, nil
+		}
+	}
+	return "", nil
+}
+
+// getNodeAccessibleDatastoreURLs returns the URLs of the datastores accessible
+// from the node VM of the given node.
+var getNodeAccessibleDatastoreURLs = func(ctx context.Context, k8sClient clientset.Interface,
+	nodeName string) ([]string, error) {
+	nodeUUID, err := k8s.GetNodeUUID(ctx, k8sClient, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	nodeVM, err := node.GetManager(ctx).GetNodeVMAndUpdateCache(ctx, nodeUUID, nil)
+	if err != nil {
+		return nil, err
+	}
+	datastores, err := nodeVM.GetAllAccessibleDatastores(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var urls []string
+	for _, ds := range datastores {
+		urls = append(urls, strings.TrimSpace(ds.Info.Url))
+	}
+	return urls, nil
+}
+
+// validateDatastoreAccessibleFromPVNodes returns an error if the datastore is
+// not accessible from every node the PV can be used on, i.e. the nodes matching
+// the node affinity of the PV, or all nodes if the PV has no node affinity.
+// Relocating the volume to such a datastore would leave pods unschedulable or
+// unable to attach the volume on those nodes.
+func validateDatastoreAccessibleFromPVNodes(ctx context.Context, pv *v1.PersistentVolume,
+	datastoreURL string) error {
+	k8sClient, err := k8s.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	return validateDatastoreAccessibleFromNodes(ctx, k8sClient, pv, datastoreURL)
+}
+
+func validateDatastoreAccessibleFromNodes(ctx context.Context, k8sClient clientset.Interface,
+	pv *v1.PersistentVolume, datastoreURL string) error {
+	nodes, err := k8sClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes. Err: %v", err)
+	}
+	var inaccessibleNodes []string
+	for i := range nodes.Items {
+		n := &nodes.Items[i]
+		if pv.Spec.NodeAffinity != nil && pv.Spec.NodeAffinity.Required != nil {
+			match, err := corev1helpers.MatchNodeSelectorTerms(n, pv.Spec.NodeAffinity.Required)
+			if err != nil {
+				return fmt.Errorf("failed to match node affinity of PV %q with node %q. Err: %v",
+					pv.Name, n.Name, err)
+			}
+			if !match {
+				continue
+			}
+		}
+		urls, err := getNodeAccessibleDatastoreURLs(ctx, k8sClient, n.Name)
+		if err != nil {
+			return fmt.Errorf("failed to get datastores accessible from node %q. Err: %v", n.Name, err)
+		}
+		if !slices.Contains(urls, datastoreURL) {
+			inaccessibleNodes = append(inaccessibleNodes, n.Name)
+		}
+	}
+	if len(inaccessibleNodes) > 0 {
+		return fmt.Errorf("datastore %q is not accessible from nodes %v", datastoreURL, inaccessibleNodes)
+	}
+	return nil
+}
+
+// patchPVRelocationStatus sets the relocation status annotation of the PV. If
+// done is true, the relocation request annotation is removed.
+func patchPVRelocationStatus(ctx context.Context, pvName string, status string, done bool) error {
+	k8sClient, err := k8s.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	annotations := map[string]interface{}{annRelocationStatus: status}
+	if done {
+		annotations[annRelocateToDatastoreURL] = nil
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": annotations},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = k8sClient.CoreV1().PersistentVolumes().Patch(ctx, pvName, apitypes.MergePatchType, patch,
+		metav1.PatchOptions{})
+	return err
+}
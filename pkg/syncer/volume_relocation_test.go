@@ -0,0 +1,89 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestValidateDatastoreAccessibleFromNodes(t *testing.T) {
+	const (
+		sharedDS = "ds:///vmfs/volumes/shared/"
+		zoneADS  = "ds:///vmfs/volumes/zone-a/"
+		zoneKey  = "topology.csi.vmware.com/zone"
+	)
+	newNode := func(name, zone string) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{zoneKey: zone}}}
+	}
+	k8sClient := testclient.NewSimpleClientset(newNode("node-a1", "zone-a"), newNode("node-a2", "zone-a"),
+		newNode("node-b1", "zone-b"))
+	accessible := map[string][]string{
+		"node-a1": {sharedDS, zoneADS},
+		"node-a2": {sharedDS, zoneADS},
+		"node-b1": {sharedDS},
+	}
+	origGetURLs := getNodeAccessibleDatastoreURLs
+	defer func() { getNodeAccessibleDatastoreURLs = origGetURLs }()
+	getNodeAccessibleDatastoreURLs = func(ctx context.Context, k8sClient clientset.Interface,
+		nodeName string) ([]string, error) {
+		return accessible[nodeName], nil
+	}
+
+	zoneAPV := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pv-zone-a"},
+		Spec: corev1.PersistentVolumeSpec{
+			NodeAffinity: &corev1.VolumeNodeAffinity{
+				Required: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+						MatchExpressions: []corev1.NodeSelectorRequirement{{
+							Key:      zoneKey,
+							Operator: corev1.NodeSelectorOpIn,
+							Values:   []string{"zone-a"},
+						}},
+					}},
+				},
+			},
+		},
+	}
+	noAffinityPV := &corev1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pv-no-affinity"}}
+
+	ctx := context.Background()
+	// Datastore accessible from all nodes matching the node affinity.
+	assert.NoError(t, validateDatastoreAccessibleFromNodes(ctx, k8sClient, zoneAPV, zoneADS))
+	assert.NoError(t, validateDatastoreAccessibleFromNodes(ctx, k8sClient, zoneAPV, sharedDS))
+	// Without node affinity the volume can be used on every node.
+	assert.NoError(t, validateDatastoreAccessibleFromNodes(ctx, k8sClient, noAffinityPV, sharedDS))
+	err := validateDatastoreAccessibleFromNodes(ctx, k8sClient, noAffinityPV, zoneADS)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "node-b1")
+		assert.NotContains(t, err.Error(), "node-a1")
+	}
+	// Datastore not accessible from any node.
+	err = validateDatastoreAccessibleFromNodes(ctx, k8sClient, zoneAPV, "ds:///vmfs/volumes/other/")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "node-a1")
+		assert.Contains(t, err.Error(), "node-a2")
+		assert.NotContains(t, err.Error(), "node-b1")
+	}
+}